@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// reportLFSUsage shows the Git LFS storage of the repository as its forge
+// reports it and, inside a clone of it, as the clone references it.
+// Failures are shown as such: the report never stops a deletion.
+func reportLFSUsage(p forge.Provider, repo, host string) {
+	fmt.Printf("Git LFS storage of %s:\n", repo)
+
+	var notes []string
+	if reporter, ok := p.(forge.LFSReporter); ok {
+		usage, err := reporter.LFSUsage(repo)
+		switch {
+		case err != nil:
+			fmt.Printf("  Forge:        unavailable: %v\n", err)
+		case usage.StoredIn != "":
+			fmt.Printf("  Forge:        stored with %s\n", usage.StoredIn)
+		default:
+			fmt.Printf("  Forge:        %s (%s)\n", common.FormatSize(usage.Bytes), usage.Source)
+		}
+		notes = usage.Notes
+	} else {
+		fmt.Printf("  Forge:        %s does not report Git LFS storage\n", p.Name())
+	}
+
+	if count, size, ok := localLFSUsage(repo, host); ok {
+		fmt.Printf("  Local clone:  %s in %d objects referenced by this clone\n", common.FormatSize(size), count)
+	}
+
+	for _, note := range notes {
+		fmt.Printf("  - %s\n", note)
+	}
+}
+
+// localLFSUsage sums the distinct LFS objects reachable in the current
+// repository when its origin is repo on host
+func localLFSUsage(repo, host string) (int, int64, bool) {
+	origin, err := forge.OriginRemote()
+	if err != nil || !strings.EqualFold(origin.Host, host) || !strings.EqualFold(origin.Path, repo) {
+		return 0, 0, false
+	}
+	pointers, err := lfspointer.Reachable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to list the LFS objects of this clone: %v\n", err)
+		return 0, 0, false
+	}
+	seen := make(map[string]bool)
+	var size int64
+	for _, p := range pointers {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			size += p.Size
+		}
+	}
+	return len(seen), size, true
+}
@@ -1,43 +1,139 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
 	"github.com/mslinn/git_lfs_scripts/internal/github"
 	flag "github.com/spf13/pflag"
 )
 
 func main() {
 	showHelp := flag.BoolP("help", "h", false, "Show help")
+	dryRun := flag.BoolP("dry-run", "d", false, "Print the command or API request instead of deleting the repository")
+	provider := flag.StringP("provider", "p", "", "Forge hosting the repository: github, gitlab, gitea or bitbucket (default: detected)")
+	baseURL := flag.String("url", "", "Base URL of a self-hosted GitLab, Gitea or Bitbucket instance (default: https://HOST)")
+	reportOnly := flag.Bool("report-only", false, "Only show the Git LFS storage of the repository, without deleting it")
+	yes := flag.BoolP("yes", "y", false, "Delete the repository of remote.origin.url without asking for confirmation")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-delete-github-repo")
+	completion.Handle(completion.Command{Name: "git-delete-github-repo", Flags: flag.CommandLine, Args: completion.ArgGitHubRepo})
 	flag.Parse()
+	common.SetDryRun(*dryRun)
 
 	if *showHelp {
 		printHelp("")
 		os.Exit(0)
 	}
 
-	if flag.NArg() == 0 {
-		printHelp("Error: The name of your GitHub repository must be specified")
+	if flag.NArg() > 1 {
+		printHelp("Error: Only one repository can be deleted at a time")
 		os.Exit(1)
 	}
 
-	repoName := flag.Arg(0)
+	// Without a name, the current repository is deleted, after confirmation
+	current := flag.NArg() == 0
+	repo, host, err := resolveRepo(flag.Arg(0))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if *baseURL != "" {
+		u, err := url.Parse(*baseURL)
+		if err != nil || u.Hostname() == "" {
+			common.PrintError("Invalid --url '%s'", *baseURL)
+		}
+		host = u.Hostname()
+	}
+	name := *provider
+	switch {
+	case name != "":
+	case host == "":
+		name = "github"
+	default:
+		if name = forge.DetectProvider(host); name == "" {
+			common.PrintError("Cannot tell which forge %s runs; specify --provider %s", host, strings.Join(forge.Providers, "|"))
+		}
+	}
+	if host == "" {
+		host = map[string]string{"github": "github.com", "gitlab": "gitlab.com", "bitbucket": "bitbucket.org"}[name]
+	}
 
-	// Check if gh is installed
-	if err := github.CheckGHInstalled(); err != nil {
+	// gh holds the GitHub credentials; a dry run installs nothing
+	if name == "github" && !common.DryRun {
+		if err := github.CheckGHInstalled(); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+	p, err := forge.NewProvider(name, host, *baseURL, "")
+	if err != nil {
 		common.PrintError("%v", err)
 	}
 
-	fmt.Printf("Deleting GitHub repository: %s\n", repoName)
+	reportLFSUsage(p, repo, host)
+	if *reportOnly {
+		return
+	}
 
-	if err := github.DeleteRepo(repoName); err != nil {
+	if current && !common.DryRun && !*yes && !confirm(fmt.Sprintf("\nDelete %s, the origin of this repository, from %s?", repo, host)) {
+		fmt.Println("Not deleted")
+		os.Exit(1)
+	}
+	fmt.Printf("\nDeleting %s repository: %s\n", p.Name(), repo)
+
+	audit := common.StartAudit("git-delete-github-repo", common.DryRun)
+	if err := p.DeleteRepo(repo); err != nil {
+		audit.Finish(err)
 		common.PrintError("%v", err)
 	}
+	if common.DryRun {
+		audit.Finish(nil)
+		return
+	}
+	audit.Deleted(host + "/" + repo)
+	audit.Finish(nil)
 
-	fmt.Printf("Successfully deleted repository: %s\n", repoName)
+	fmt.Printf("Successfully deleted repository: %s\n", repo)
+}
+
+// confirm asks a yes/no question on the terminal; anything but y or yes,
+// including end of input, declines
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// resolveRepo returns the repository path and the host it lives on. A
+// remote URL names both; a bare path lives on the host of remote.origin.url,
+// or on no known host outside a repository or when origin has no usable URL.
+// Without arg, it is the repository of remote.origin.url.
+func resolveRepo(arg string) (string, string, error) {
+	if arg == "" {
+		remote, err := forge.CurrentRepo("")
+		if err != nil {
+			return "", "", fmt.Errorf("%v\nSpecify the repository to delete", err)
+		}
+		return remote.Path, remote.Host, nil
+	}
+	if strings.Contains(arg, "://") || strings.Contains(arg, "@") {
+		remote, err := forge.ParseRemoteURL(arg)
+		if err != nil {
+			return "", "", err
+		}
+		return remote.Path, remote.Host, nil
+	}
+	if remote, err := forge.OriginRemote(); err == nil {
+		return strings.Trim(arg, "/"), remote.Host, nil
+	}
+	return strings.Trim(arg, "/"), "", nil
 }
 
 func printHelp(msg string) {
@@ -47,24 +143,68 @@ func printHelp(msg string) {
 	}
 
 	fmt.Print(dedent.Dedent(`
-		git-delete-github-repo - Delete a GitHub repository
+		git-delete-github-repo - Delete a GitHub, GitLab, Gitea or Bitbucket repository
 
 		SYNTAX:
-		  git delete-github-repo [OPTIONS] REPOSITORY_NAME
+		  git delete-github-repo [OPTIONS] [REPOSITORY]
 
 		OPTIONS:
-		  -h  Show this help message
+		  -p, --provider NAME  Forge hosting the repository: github, gitlab, gitea
+		                       or bitbucket (default: detected from the host)
+		  --url URL            Base URL of a self-hosted GitLab, Gitea or Bitbucket
+		                       instance, or of GitHub Enterprise (default: https://HOST)
+		  --report-only        Only show the Git LFS storage of the repository
+		  -y, --yes            Delete the repository of remote.origin.url
+		                       without asking for confirmation
+		  -d, --dry-run        Print the command or API request instead of deleting
+		  --trace              Print every external command before running it
+		  -h                   Show this help message
+		  --version            Show the version, commit and build date
 
 		DESCRIPTION:
-		  This command uses the GitHub CLI (gh) to delete a repository.
-
-		  If gh is not installed, it will attempt automatic installation on:
+		  REPOSITORY is OWNER/NAME (GROUP/SUBGROUP/NAME on GitLab) or a remote
+		  URL such as https://gitlab.example.com/team/assets.git. A bare path
+		  lives on the host of remote.origin.url; outside a repository it
+		  lives on github.com, or gitlab.com or bitbucket.org with --provider.
+		  The provider is detected from the host: github.com, hosts
+		  containing 'gitlab' or 'bitbucket', and codeberg.org or hosts
+		  containing 'gitea' or 'forgejo'. Use --provider for other hosts.
+		  Without REPOSITORY, the repository of remote.origin.url is deleted,
+		  once you confirm it, or without asking with --yes.
+		  Bitbucket repositories are WORKSPACE/SLUG on Bitbucket Cloud and
+		  PROJECT/SLUG on Bitbucket Data Center.
+
+		  Before deleting, the Git LFS storage of the repository is shown, with
+		  what deleting it does to that usage. GitHub reports it from the
+		  billing usage report of the owner, which takes an admin or billing
+		  manager token; a fork's LFS objects count against the root of its
+		  network, so deleting a fork frees nothing. GitLab reports it from
+		  the project statistics. Run inside a clone of the repository, the
+		  size of the LFS objects the clone references is shown too, which is
+		  the only figure available on Gitea and Bitbucket.
+
+		  GitHub repositories are deleted with the GitHub CLI (gh). If gh is
+		  not installed, it will attempt automatic installation on:
 		    - Ubuntu/Debian (using apt-get)
 		    - macOS (using Homebrew)
-
 		  You must have gh authenticated (run 'gh auth login' after installation).
+		  OWNER may be an organization; deleting its repositories takes admin
+		  access to them and gh's delete_repo scope ('gh auth refresh -s
+		  delete_repo').
+
+		  GitLab, Gitea and Bitbucket repositories are deleted through their
+		  REST APIs. Set GITLAB_TOKEN (scope 'api'), GITEA_TOKEN (scope
+		  'write:repository') or BITBUCKET_TOKEN to a token allowed to delete
+		  the repository. A Bitbucket Cloud API token also needs
+		  BITBUCKET_USERNAME.
 
-		EXAMPLE:
+		EXAMPLES:
 		  git delete-github-repo my-test-repo
+		  git delete-github-repo --dry-run my-test-repo
+		  git delete-github-repo --report-only mslinn/old-assets
+		  git delete-github-repo --report-only    # The origin of this clone
+		  git delete-github-repo https://gitlab.example.com/team/sandbox.git
+		  git delete-github-repo --provider gitea --url https://git.internal team/sandbox
+		  git delete-github-repo --provider bitbucket --url https://bitbucket.example.com PROJ/sandbox
 	`))
 }
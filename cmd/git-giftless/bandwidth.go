@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// throttleChunk is the most bytes read before waiting for tokens, so
+// concurrent transfers interleave smoothly
+const throttleChunk = 32 * 1024
+
+// idleClientTimeout is how long an idle client's buckets are kept
+const idleClientTimeout = 10 * time.Minute
+
+// tokenBucket limits a byte stream to rate bytes per second with bursts of up
+// to one second. Transfers reserve tokens and sleep off any debt, so
+// concurrent readers share the rate fairly. A nil bucket is unlimited.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// take reserves n bytes, sleeping until the bucket can afford them
+func (b *tokenBucket) take(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// throttledBody passes reads through every bucket
+type throttledBody struct {
+	io.ReadCloser
+	buckets []*tokenBucket
+}
+
+func (t *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.ReadCloser.Read(p)
+	for _, b := range t.buckets {
+		b.take(n)
+	}
+	return n, err
+}
+
+// clientBuckets are the per-client upload and download buckets
+type clientBuckets struct {
+	upload   *tokenBucket
+	download *tokenBucket
+	lastUsed time.Time
+}
+
+// bandwidthLimiter holds the global buckets and the buckets of each client address
+type bandwidthLimiter struct {
+	upload, download *tokenBucket // Global, shared by all clients
+	perClient        int64        // Bytes per second per client and direction; 0 is unlimited
+
+	mu      sync.Mutex
+	clients map[string]*clientBuckets
+}
+
+func newBandwidthLimiter(global, perClient int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		upload:    newTokenBucket(global),
+		download:  newTokenBucket(global),
+		perClient: perClient,
+		clients:   make(map[string]*clientBuckets),
+	}
+}
+
+// client returns the buckets of a client, dropping those of idle clients
+func (l *bandwidthLimiter) client(remoteAddr string) *clientBuckets {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for addr, c := range l.clients {
+		if now.Sub(c.lastUsed) > idleClientTimeout {
+			delete(l.clients, addr)
+		}
+	}
+	c, ok := l.clients[host]
+	if !ok {
+		c = &clientBuckets{upload: newTokenBucket(l.perClient), download: newTokenBucket(l.perClient)}
+		l.clients[host] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// newThrottlingProxy returns a reverse proxy to backend that shapes request
+// bodies (uploads) and response bodies (downloads). The Host header is kept,
+// so giftless builds transfer URLs that point back at the proxy.
+func newThrottlingProxy(backend string, l *bandwidthLimiter) (http.Handler, error) {
+	target, err := url.Parse("http://" + backend)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = -1 // Stream downloads as they are throttled
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		c := l.client(resp.Request.RemoteAddr)
+		resp.Body = &throttledBody{ReadCloser: resp.Body, buckets: []*tokenBucket{c.download, l.download}}
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			c := l.client(r.RemoteAddr)
+			r.Body = &throttledBody{ReadCloser: r.Body, buckets: []*tokenBucket{c.upload, l.upload}}
+		}
+		proxy.ServeHTTP(w, r)
+	}), nil
+}
+
+// startThrottlingProxy listens on a binding and forwards to backend in the
+// background, serving HTTPS when files is set. Listening happens before
+// returning so errors such as a port in use are reported before the server
+// starts.
+func startThrottlingProxy(b binding, backend string, global, perClient int64, files *tlsFiles) error {
+	handler, err := newThrottlingProxy(backend, newBandwidthLimiter(global, perClient))
+	if err != nil {
+		return err
+	}
+	listener, err := b.listen()
+	if err != nil {
+		return err
+	}
+	if files == nil {
+		go func() {
+			if err := http.Serve(listener, handler); err != nil {
+				common.PrintError("Bandwidth proxy failed: %v", err)
+			}
+		}()
+		return nil
+	}
+
+	// 'git giftless reload' sends SIGHUP to have a renewed certificate served
+	certificate, err := newReloadableCertificate(files)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := certificate.reload(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: kept the previous TLS certificate: %v\n", err)
+			} else {
+				fmt.Println("Reloaded the TLS certificate")
+			}
+		}
+	}()
+	server := &http.Server{Handler: handler, TLSConfig: &tls.Config{GetCertificate: certificate.get}}
+	go func() {
+		if err := server.ServeTLS(listener, "", ""); err != nil {
+			common.PrintError("Bandwidth proxy failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// freeLoopbackPort returns a port on 127.0.0.1 that is currently unused
+func freeLoopbackPort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, nil
+}
+
+// parseBandwidth parses a rate such as 10M or 10M/s in bytes per second
+func parseBandwidth(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return common.ParseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+}
+
+// describeBandwidth formats a rate for display
+func describeBandwidth(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return common.FormatSize(rate) + "/s"
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+)
+
+// defaultDockerImage is the pinned giftless image used by --docker
+const defaultDockerImage = "datopian/giftless:0.5.0"
+
+// containerStoragePath is where the storage directory is mounted in the container
+const containerStoragePath = "/lfs-storage"
+
+// containerPort is the port uwsgi listens on inside the container
+const containerPort = "5000"
+
+// dockerRequirement replaces the Python requirements in Docker mode
+var dockerRequirement = prereq.Bin("docker", "install from: https://docs.docker.com/get-docker/")
+
+// dockerConfig configures giftless in the container to keep objects in the
+// mounted storage directory
+var dockerConfig = fmt.Sprintf(`TRANSFER_ADAPTERS:
+  basic:
+    factory: giftless.transfer.basic_streaming:factory
+    options:
+      storage_class: giftless.storage.local_storage:LocalStorage
+      storage_options:
+        path: %s
+`, containerStoragePath)
+
+// checkDocker verifies the docker CLI is installed and the daemon is reachable
+func checkDocker() {
+	if err := prereq.Verify(dockerRequirement); err != nil {
+		common.PrintError("%v", err)
+	}
+	if _, err := common.Query(exec.Command("docker", "info", "--format", "{{.ServerVersion}}")); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			common.PrintError("Cannot connect to the Docker daemon: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		common.PrintError("Cannot connect to the Docker daemon: %v", err)
+	}
+
+	fmt.Println("✓ Docker is available")
+}
+
+// containerTLSPath is where the TLS certificate and key are mounted in the container
+const containerTLSPath = "/tls"
+
+// containerHtpasswdPath is where the credentials file is mounted in the container
+const containerHtpasswdPath = "/auth/htpasswd"
+
+// dockerCommand builds the docker run command for a giftless container that
+// mounts storage and publishes the container's port on host:port, serving
+// HTTPS with the mounted files when they are set and requiring the users of
+// the mounted credentials file when it is set
+func dockerCommand(image, storage, host, port string, threads, workers int, files *tlsFiles, credentials string, behindProxy bool, mercy int) (*exec.Cmd, error) {
+	absStorage, err := filepath.Abs(storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path: %v", err)
+	}
+	if err := os.MkdirAll(absStorage, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", absStorage, err)
+	}
+
+	if err := common.Run(exec.Command("docker", "pull", image)); err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %v", image, err)
+	}
+
+	args := []string{
+		"run", "--rm", "--init",
+		"--name", "giftless-" + port,
+		"--publish", net.JoinHostPort(host, port) + ":" + containerPort,
+		"--volume", fmt.Sprintf("%s:%s", absStorage, containerStoragePath),
+	}
+	containerCredentials := ""
+	if credentials != "" {
+		containerCredentials = containerHtpasswdPath
+		args = append(args, "--volume", fmt.Sprintf("%s:%s:ro", credentials, containerCredentials))
+	}
+	args = append(args, "--env", "GIFTLESS_CONFIG_STR="+giftlessConfig(dockerConfig, credentials, behindProxy))
+	var containerFiles *tlsFiles
+	if files != nil {
+		containerFiles = &tlsFiles{cert: containerTLSPath + "/cert.pem", key: containerTLSPath + "/key.pem"}
+		args = append(args,
+			"--volume", fmt.Sprintf("%s:%s:ro", files.cert, containerFiles.cert),
+			"--volume", fmt.Sprintf("%s:%s:ro", files.key, containerFiles.key))
+	}
+	// The image's entrypoint is uwsgi
+	args = append(args, image)
+	args = append(args, uwsgiArgs(binding{host: "0.0.0.0", port: containerPort}, threads, workers, containerFiles, containerCredentials, containerFifo, mercy)...)
+	fmt.Printf("Storage: %s (mounted at %s)\n", absStorage, containerStoragePath)
+	return exec.Command("docker", args...), nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+// importFailure is an object that could not be imported
+type importFailure struct {
+	oid    string
+	reason string
+}
+
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	endpoint := flags.String("from-endpoint", "", "LFS endpoint of the existing server, e.g. https://github.com/ORG/NAME.git/info/lfs")
+	repo := flags.String("repo", "", "Repository ORG/NAME; objects are stored below STORAGE/ORG/NAME")
+	storage := flags.String("storage", defaultStoragePath, "Giftless local storage directory")
+	batchSize := flags.Int("batch-size", 100, "Objects per Batch API request")
+	anonymous := flags.Bool("anonymous", false, "Do not look up credentials for the existing server")
+	dryRun := flags.BoolP("dry-run", "d", false, "List the objects that would be imported without downloading them")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp {
+		printImportHelp()
+		os.Exit(0)
+	}
+	if *endpoint == "" || *repo == "" {
+		printImportHelp()
+		os.Exit(1)
+	}
+	prefix := strings.Trim(*repo, "/")
+	if strings.Count(prefix, "/") != 1 || strings.Contains(prefix, "..") {
+		common.PrintError("--repo must be ORG/NAME, not '%s'", *repo)
+	}
+	if *batchSize <= 0 {
+		common.PrintError("--batch-size must be positive")
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v (run import inside a clone of %s)", err, prefix)
+	}
+
+	objects, err := importObjects()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	targetDir := filepath.Join(*storage, filepath.FromSlash(prefix))
+	fmt.Printf("Importing %d objects referenced by %s\n", len(objects), prefix)
+	fmt.Printf("  from %s\n", *endpoint)
+	fmt.Printf("  into %s\n", targetDir)
+
+	// Objects already stored with the right size are not downloaded again,
+	// so an interrupted import can be resumed
+	var pending []lfsapi.Object
+	for _, obj := range objects {
+		if info, err := os.Stat(filepath.Join(targetDir, obj.OID)); err == nil && info.Size() == obj.Size {
+			continue
+		}
+		pending = append(pending, obj)
+	}
+	fmt.Printf("Already present: %d, to download: %d (%s)\n",
+		len(objects)-len(pending), len(pending), common.FormatSize(objectsSize(pending)))
+
+	if *dryRun {
+		for _, obj := range pending {
+			fmt.Printf("DRY RUN: would import %s (%s)\n", obj.OID, common.FormatSize(obj.Size))
+		}
+		return
+	}
+
+	audit := common.StartAudit("git-giftless import", false)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		common.PrintError("Failed to create %s: %v", targetDir, err)
+	}
+
+	client := lfsapi.NewClient(*endpoint, !*anonymous)
+	var failures []importFailure
+	imported := 0
+	for start := 0; start < len(pending); start += *batchSize {
+		batch := pending[start:min(start+*batchSize, len(pending))]
+		resp, err := client.Batch(lfsapi.BatchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: batch})
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("Batch request failed: %v", err)
+		}
+
+		actions := make(map[string]lfsapi.Object)
+		for _, obj := range resp.Objects {
+			actions[obj.OID] = obj
+		}
+		for _, obj := range batch {
+			answer, ok := actions[obj.OID]
+			switch {
+			case !ok:
+				failures = append(failures, importFailure{obj.OID, "not in batch response"})
+			case answer.Error != nil:
+				failures = append(failures, importFailure{obj.OID, fmt.Sprintf("HTTP %d: %s", answer.Error.Code, answer.Error.Message)})
+			case answer.Actions["download"].Href == "":
+				failures = append(failures, importFailure{obj.OID, "no download action"})
+			default:
+				if err := importObject(client, answer.Actions["download"], obj, targetDir); err != nil {
+					failures = append(failures, importFailure{obj.OID, err.Error()})
+					fmt.Printf("  ✗ %s: %v\n", obj.OID, err)
+					continue
+				}
+				imported++
+				fmt.Printf("  ✓ %s (%s)\n", obj.OID, common.FormatSize(obj.Size))
+			}
+		}
+	}
+	if imported > 0 {
+		audit.Changed(targetDir)
+	}
+
+	fmt.Println("\nVerifying stored objects...")
+	stored, problems := verifyImport(objects, targetDir)
+
+	fmt.Println()
+	fmt.Println("Import summary:")
+	fmt.Printf("  Referenced:  %d\n", len(objects))
+	fmt.Printf("  Downloaded:  %d\n", imported)
+	fmt.Printf("  Verified:    %d\n", stored)
+	fmt.Printf("  Failed:      %d\n", len(failures))
+	failed := make(map[string]bool)
+	for _, f := range failures {
+		failed[f.oid] = true
+		fmt.Printf("    %s: %s\n", f.oid, f.reason)
+	}
+	for oid, problem := range problems {
+		if !failed[oid] {
+			fmt.Printf("    %s: %s\n", oid, problem)
+		}
+	}
+
+	if stored != len(objects) {
+		err := fmt.Errorf("%d of %d objects are missing or invalid in %s", len(objects)-stored, len(objects), targetDir)
+		audit.Finish(err)
+		fmt.Printf("\n✗ %v; rerun to retry\n", err)
+		os.Exit(2)
+	}
+	audit.Finish(nil)
+	fmt.Printf("\n✓ All %d objects are stored and verified\n", len(objects))
+}
+
+// importObjects returns every LFS object committed anywhere in the history of any ref
+func importObjects() ([]lfsapi.Object, error) {
+	refs, err := lfspointer.AllRefs()
+	if err != nil {
+		return nil, err
+	}
+	pointers, err := lfspointer.ListRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	history, err := lfspointer.Added("", refs)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var objects []lfsapi.Object
+	for _, p := range append(pointers, history...) {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			objects = append(objects, lfsapi.Object{OID: p.OID, Size: p.Size})
+		}
+	}
+	return objects, nil
+}
+
+// importObject downloads one object to a temporary file, checks its size and
+// hash, and only then moves it into place, so giftless never serves a
+// partial object
+func importObject(client *lfsapi.Client, action lfsapi.Action, obj lfsapi.Object, targetDir string) error {
+	body, err := client.Download(action)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(targetDir, ".import-"+obj.OID[:12]+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != obj.Size {
+		return fmt.Errorf("received %d bytes, expected %d", written, obj.Size)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != obj.OID {
+		return fmt.Errorf("content hashes to %s", actual)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(targetDir, obj.OID))
+}
+
+// verifyImport re-hashes every referenced object in the target directory and
+// returns how many are intact, with the problem of each other object
+func verifyImport(objects []lfsapi.Object, targetDir string) (int, map[string]string) {
+	intact := 0
+	problems := make(map[string]string)
+	for _, obj := range objects {
+		path := filepath.Join(targetDir, obj.OID)
+		actual, err := hashFile(path, newThrottle(0))
+		switch {
+		case os.IsNotExist(err):
+			problems[obj.OID] = "missing"
+		case err != nil:
+			problems[obj.OID] = err.Error()
+		case actual != obj.OID:
+			problems[obj.OID] = "corrupt (content hashes to " + actual + ")"
+		default:
+			intact++
+		}
+	}
+	return intact, problems
+}
+
+func objectsSize(objects []lfsapi.Object) int64 {
+	var total int64
+	for _, obj := range objects {
+		total += obj.Size
+	}
+	return total
+}
+
+func printImportHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-giftless import - Copy a repository's LFS objects from another server into giftless
+
+		USAGE:
+		  git giftless import --from-endpoint URL --repo ORG/NAME [OPTIONS]
+
+		OPTIONS:
+		  --from-endpoint URL  LFS endpoint of the existing server,
+		                       e.g. https://github.com/ORG/NAME.git/info/lfs
+		  --repo ORG/NAME      Repository the objects belong to; they are stored
+		                       below STORAGE/ORG/NAME, where giftless serves them
+		  --storage DIR        Giftless local storage directory (default: /opt/giftless/lfs-storage)
+		  --batch-size N       Objects per Batch API request (default: 100)
+		  --anonymous          Do not look up credentials for the existing server
+		  -d, --dry-run        List the objects that would be imported
+		  -h, --help           Show this help message
+
+		DESCRIPTION:
+		  Run inside an up-to-date clone of the repository. Every LFS object
+		  committed anywhere in the history of any branch or tag is downloaded from
+		  the existing server via the Batch API, checked against its size and
+		  SHA-256, and written to the giftless storage directory. Credentials for
+		  the existing server come from the Git credential helper.
+
+		  Objects that are already stored with the right size are skipped, so an
+		  interrupted import can simply be rerun. Finally every referenced object
+		  is re-hashed in storage and the counts are compared.
+
+		  The exit status is 2 when any object is missing or invalid.
+
+		EXAMPLES:
+		  # Move a GitHub-hosted repository's LFS objects into giftless
+		  git clone --mirror https://github.com/myorg/myrepo.git && cd myrepo.git
+		  git giftless import --repo myorg/myrepo \
+		    --from-endpoint https://github.com/myorg/myrepo.git/info/lfs
+
+		  # Then point clones at giftless
+		  git lfs-server-migrate --verify-only http://giftless.example.com:9876/myorg/myrepo
+	`))
+}
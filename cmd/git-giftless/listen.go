@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// binding is where the server accepts clients: a TCP host and port, or a
+// unix socket that a reverse proxy on the same machine connects to
+type binding struct {
+	host   string // Without brackets, e.g. 0.0.0.0 or ::
+	port   string
+	socket string // Absolute path of a unix socket, instead of host and port
+}
+
+// parseBinding returns the binding of --listen, or of --host and --port
+// without it. A listen address is unix:PATH, or HOST:PORT with an IPv6 HOST
+// in brackets; --host takes an IPv6 address with or without them.
+func parseBinding(listen, host, port string) (binding, error) {
+	if path, found := strings.CutPrefix(listen, "unix:"); found {
+		if path == "" {
+			return binding{}, fmt.Errorf("--listen unix: needs the path of the socket, e.g. unix:/run/giftless/giftless.sock")
+		}
+		socket, err := filepath.Abs(path)
+		if err != nil {
+			return binding{}, err
+		}
+		return binding{socket: socket}, nil
+	}
+	if listen != "" {
+		var err error
+		if host, port, err = net.SplitHostPort(listen); err != nil {
+			return binding{}, fmt.Errorf("invalid --listen '%s': use unix:PATH or HOST:PORT, e.g. [::1]:9876", listen)
+		}
+	}
+
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return binding{}, fmt.Errorf("invalid host '%s': not an IPv6 address", host)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return binding{}, fmt.Errorf("invalid port '%s'", port)
+	}
+	return binding{host: host, port: port}, nil
+}
+
+func (b binding) unix() bool {
+	return b.socket != ""
+}
+
+func (b binding) network() string {
+	if b.unix() {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// address is what uwsgi and net.Listen take: HOST:PORT with an IPv6 host
+// in brackets, or the path of the socket
+func (b binding) address() string {
+	if b.unix() {
+		return b.socket
+	}
+	return net.JoinHostPort(b.host, b.port)
+}
+
+func (b binding) String() string {
+	if b.unix() {
+		return "unix:" + b.socket
+	}
+	return b.address()
+}
+
+// key names the state and master FIFO of the server: its port, or a hash
+// of the path of its socket
+func (b binding) key() string {
+	if b.unix() {
+		return fmt.Sprintf("unix-%x", sha256.Sum256([]byte(b.socket)))[:17]
+	}
+	return b.port
+}
+
+// removeStaleSocket removes the socket of a server that did not stop
+// cleanly, failing when a server still accepts connections on it
+func (b binding) removeStaleSocket() error {
+	if !b.unix() {
+		return nil
+	}
+	info, err := os.Lstat(b.socket)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.Dial("unix", b.socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by a running server", b.socket)
+	}
+	return os.Remove(b.socket)
+}
+
+// listen listens on the binding. A new socket is made accessible to the
+// group, which the reverse proxy's user should belong to.
+func (b binding) listen() (net.Listener, error) {
+	if err := b.removeStaleSocket(); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen(b.network(), b.address())
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", b, err)
+	}
+	if b.unix() {
+		if err := os.Chmod(b.socket, 0660); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// proxyConfig makes giftless build transfer URLs from the X-Forwarded-*
+// headers of a reverse proxy, so that clients are sent to the proxy's
+// scheme, host and port rather than the address giftless listens on
+const proxyConfig = `MIDDLEWARE:
+  - class: werkzeug.middleware.proxy_fix:ProxyFix
+    kwargs:
+      x_for: 1
+      x_proto: 1
+      x_host: 1
+      x_port: 1
+      x_prefix: 1
+`
+
+// nginxConfig returns an nginx server block that terminates TLS and
+// forwards to the binding, streaming the large bodies of LFS transfers
+// instead of buffering them; backendTLS is set when giftless serves HTTPS
+func nginxConfig(b binding, backendTLS bool) string {
+	upstream := "http://unix:" + b.socket + ":"
+	if !b.unix() {
+		host := b.host
+		switch host {
+		case "", "0.0.0.0":
+			host = "127.0.0.1"
+		case "::":
+			host = "::1"
+		}
+		scheme := "http"
+		if backendTLS {
+			scheme = "https"
+		}
+		upstream = scheme + "://" + net.JoinHostPort(host, b.port)
+	}
+	name := publicHost("")
+	return fmt.Sprintf(`server {
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name %[1]s;
+    ssl_certificate     /etc/ssl/certs/%[1]s.pem;
+    ssl_certificate_key /etc/ssl/private/%[1]s.key;
+
+    # LFS objects can be gigabytes: no size limit, no buffering
+    client_max_body_size 0;
+    proxy_request_buffering off;
+    proxy_buffering off;
+    proxy_read_timeout 1h;
+    proxy_send_timeout 1h;
+
+    location / {
+        proxy_pass %[2]s;
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header X-Forwarded-Host $host;
+        proxy_set_header X-Forwarded-Port $server_port;
+    }
+}
+`, name, upstream)
+}
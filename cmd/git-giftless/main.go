@@ -4,12 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"os/signal"
-	"strings"
-	"syscall"
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
 	flag "github.com/spf13/pflag"
 )
 
@@ -20,21 +19,77 @@ const (
 )
 
 func main() {
+	// Subcommands parse their own options
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "scrub":
+			runScrub(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "user":
+			runUser(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "reload":
+			runReload(os.Args[2:])
+			return
+		}
+	}
+
 	var (
-		venvPath string
-		host     string
-		port     string
-		threads  int
-		workers  int
-		showHelp bool
+		venvPath       string
+		host           string
+		port           string
+		listen         string
+		behindProxy    bool
+		printNginx     bool
+		threads        int
+		workers        int
+		installMissing bool
+		docker         bool
+		image          string
+		storage        string
+		maxBandwidth   string
+		clientLimit    string
+		tlsCert        string
+		tlsKey         string
+		autoTLS        bool
+		basicAuth      bool
+		htpasswdFile   string
+		statsAddress   string
+		reloadMercy    int
+		showHelp       bool
 	)
 
 	flag.StringVar(&venvPath, "venv", defaultVenvPath, "Path to Python virtual environment activation script")
-	flag.StringVar(&host, "host", defaultHost, "Host address to bind to")
+	flag.StringVar(&host, "host", defaultHost, "Host address to bind to; IPv6 addresses with or without brackets")
 	flag.StringVar(&port, "port", defaultPort, "Port to listen on")
+	flag.StringVar(&listen, "listen", "", "Listen on unix:PATH, or on HOST:PORT instead of --host and --port")
+	flag.BoolVar(&behindProxy, "behind-proxy", false, "Build transfer URLs from the X-Forwarded-* headers of a reverse proxy")
+	flag.BoolVar(&printNginx, "print-nginx", false, "Print an nginx reverse proxy configuration for the binding and exit")
 	flag.IntVar(&threads, "threads", 2, "Number of threads per worker")
 	flag.IntVar(&workers, "workers", 2, "Number of worker processes")
+	flag.BoolVar(&installMissing, "install-missing", false, "Install missing Python packages with pip")
+	flag.BoolVar(&docker, "docker", false, "Run giftless in a Docker container instead of a local venv")
+	flag.StringVar(&image, "image", defaultDockerImage, "Docker image to run with --docker")
+	flag.StringVar(&storage, "storage", defaultStoragePath, "Storage directory mounted into the container with --docker and reported by --stats")
+	flag.StringVar(&maxBandwidth, "max-bandwidth", "", "Limit total upload and download bandwidth, e.g. 20M (bytes per second)")
+	flag.StringVar(&clientLimit, "per-client-bandwidth", "", "Limit each client's upload and download bandwidth, e.g. 5M")
+	flag.StringVar(&tlsCert, "tls-cert", "", "Serve HTTPS with this PEM certificate (chain)")
+	flag.StringVar(&tlsKey, "tls-key", "", "PEM private key of --tls-cert")
+	flag.BoolVar(&autoTLS, "auto-tls", false, "Serve HTTPS with a self-signed certificate kept in the config directory")
+	flag.BoolVar(&basicAuth, "basic-auth", false, "Require the credentials of the users added with 'git giftless user add'")
+	flag.StringVar(&htpasswdFile, "htpasswd", "", "Require basic auth with the credentials in this htpasswd file")
+	flag.StringVar(&statsAddress, "stats", "", "Serve storage statistics as JSON at http://ADDRESS/stats")
+	flag.IntVar(&reloadMercy, "reload-mercy", defaultReloadMercy, "Seconds a worker may spend finishing transfers when reloaded")
 	flag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-giftless")
+	completion.Handle(completion.Command{Name: "git-giftless", Flags: flag.CommandLine, Subcommands: []string{"scrub", "import", "user", "stats", "reload"}})
 	flag.Parse()
 
 	if showHelp {
@@ -42,61 +97,197 @@ func main() {
 		os.Exit(0)
 	}
 
+	if listen != "" && (flag.CommandLine.Changed("host") || flag.CommandLine.Changed("port")) {
+		common.PrintError("--listen replaces --host and --port")
+	}
+	bound, err := parseBinding(listen, host, port)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if printNginx {
+		fmt.Print(nginxConfig(bound, tlsCert != "" || autoTLS))
+		if !bound.unix() && !behindProxy {
+			fmt.Fprintln(os.Stderr, "Start giftless with --behind-proxy too, so that it sends clients URLs of the proxy")
+		}
+		return
+	}
+	if bound.unix() {
+		// The reverse proxy in front of the socket terminates TLS
+		switch {
+		case tlsCert != "" || tlsKey != "" || autoTLS:
+			common.PrintError("--tls-cert, --tls-key and --auto-tls cannot be used with a unix socket; the reverse proxy serves HTTPS")
+		case docker:
+			common.PrintError("--docker publishes a TCP port; use --host and --port instead of a unix socket")
+		}
+		behindProxy = true
+	}
+
+	global, err := parseBandwidth(maxBandwidth)
+	if err != nil {
+		common.PrintError("--max-bandwidth: %v", err)
+	}
+	perClient, err := parseBandwidth(clientLimit)
+	if err != nil {
+		common.PrintError("--per-client-bandwidth: %v", err)
+	}
+	tlsServed, err := resolveTLS(tlsCert, tlsKey, autoTLS, certificateNames(bound.host))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	credentials, err := resolveBasicAuth(basicAuth, htpasswdFile)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	if reloadMercy < 1 {
+		common.PrintError("--reload-mercy must be at least 1")
+	}
+	if docker && isBucket(storage) {
+		common.PrintError("--storage must be a directory with --docker")
+	}
+	if statsAddress != "" {
+		location, err := resolveStorage(storage)
+		if err != nil {
+			common.PrintError("--stats: %v", err)
+		}
+		if err := startStatsServer(statsAddress, location); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+
+	// With bandwidth limits, clients connect to the throttling proxy on
+	// the binding and giftless only listens on a loopback port behind it;
+	// the proxy then terminates TLS and giftless serves plain HTTP
+	server, serverTLS := bound, tlsServed
+	var state serverState
+	if global > 0 || perClient > 0 {
+		serverPort, err := freeLoopbackPort()
+		if err != nil {
+			common.PrintError("Failed to find a port for giftless: %v", err)
+		}
+		server, serverTLS = binding{host: "127.0.0.1", port: serverPort}, nil
+		if err := startThrottlingProxy(bound, server.address(), global, perClient, tlsServed); err != nil {
+			common.PrintError("%v", err)
+		}
+		state.ProxyTLS = tlsServed != nil
+		fmt.Printf("Bandwidth limits: %s in total, %s per client (each direction)\n",
+			describeBandwidth(global), describeBandwidth(perClient))
+	}
+
+	if docker {
+		checkDocker()
+
+		fmt.Printf("Starting Giftless LFS server in %s on %s\n", image, bound)
+		fmt.Printf("Workers: %d, Threads: %d\n", workers, threads)
+		cmd, err := dockerCommand(image, storage, server.host, server.port, threads, workers, serverTLS, credentials, behindProxy, reloadMercy)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		state.Container = "giftless-" + server.port
+		printClientConfig(bound, tlsServed, credentials)
+		runServer(cmd, bound.key(), state)
+		return
+	}
+
 	// Check all prerequisites before starting
-	checkPrerequisites()
+	checkPrerequisites(installMissing)
 
-	fmt.Printf("Starting Giftless LFS server on %s:%s\n", host, port)
+	fmt.Printf("Starting Giftless LFS server on %s\n", bound)
 	fmt.Printf("Workers: %d, Threads: %d\n", workers, threads)
+	if err := server.removeStaleSocket(); err != nil {
+		common.PrintError("%v", err)
+	}
 
 	// Build uwsgi command
-	cmd := exec.Command("uwsgi",
-		"--master",
-		fmt.Sprintf("--threads=%d", threads),
-		fmt.Sprintf("--processes=%d", workers),
-		"--manage-script-name",
-		"--module=giftless.wsgi_entrypoint",
-		"--callable=app",
-		fmt.Sprintf("--http=%s:%s", host, port),
-	)
+	if state.Fifo, err = masterFifo(bound.key()); err != nil {
+		common.PrintError("%v", err)
+	}
+	cmd := exec.Command("uwsgi", uwsgiArgs(server, threads, workers, serverTLS, credentials, state.Fifo, reloadMercy)...)
 
 	// If venv path exists, we need to activate it first
 	// For simplicity, we'll use bash to source the venv and run uwsgi
 	if _, err := os.Stat(venvPath); err == nil {
-		bashCmd := fmt.Sprintf("source %s && uwsgi --master --threads=%d --processes=%d --manage-script-name --module=giftless.wsgi_entrypoint --callable=app --http=%s:%s",
-			venvPath, threads, workers, host, port)
-
-		cmd = exec.Command("bash", "-c", bashCmd)
+		cmd = exec.Command("bash", "-c", fmt.Sprintf("source %s && %s", venvPath, common.FormatCommand(cmd)))
+	}
+	if config := giftlessConfig("", credentials, behindProxy); config != "" {
+		cmd.Env = append(os.Environ(), "GIFTLESS_CONFIG_STR="+config)
+	}
+	if credentials != "" {
+		fmt.Printf("Basic auth: users of %s\n", credentials)
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	printClientConfig(bound, tlsServed, credentials)
+	runServer(cmd, bound.key(), state)
+}
 
-	// Handle signals for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+// giftlessConfig adds the settings of basic auth and of a reverse proxy in
+// front of giftless to base, the giftless configuration in YAML
+func giftlessConfig(base, credentials string, behindProxy bool) string {
+	if credentials != "" {
+		base += authConfig
+	}
+	if behindProxy {
+		base += proxyConfig
+	}
+	return base
+}
 
-	// Start the server in a goroutine
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- cmd.Run()
-	}()
+// uwsgiArgs returns the uwsgi options serving giftless on a binding, over
+// HTTPS when files is set. uwsgi must have been built with OpenSSL for that.
+// On a unix socket, the workers speak HTTP themselves, without uwsgi's HTTP
+// router, and uwsgi removes the socket when it stops.
+// With credentials, uwsgi's basicauth router rejects requests without a
+// user and password of that htpasswd file. 'git giftless reload' writes to
+// the master FIFO; each worker loads the app itself so that workers can be
+// chain reloaded, and gets mercy seconds to finish its transfers.
+func uwsgiArgs(b binding, threads, workers int, files *tlsFiles, credentials, fifo string, mercy int) []string {
+	listen := "--http=" + b.address()
+	switch {
+	case b.unix():
+		listen = "--http-socket=" + b.address()
+	case files != nil:
+		listen = fmt.Sprintf("--https=%s,%s,%s", b.address(), files.cert, files.key)
+	}
+	args := []string{
+		"--master",
+		fmt.Sprintf("--threads=%d", threads),
+		fmt.Sprintf("--processes=%d", workers),
+		"--manage-script-name",
+		"--module=giftless.wsgi_entrypoint",
+		"--callable=app",
+		listen,
+		"--master-fifo=" + fifo,
+		"--lazy-apps",
+		fmt.Sprintf("--worker-reload-mercy=%d", mercy),
+		fmt.Sprintf("--reload-mercy=%d", mercy),
+	}
+	if b.unix() {
+		args = append(args, "--chmod-socket=660", "--vacuum")
+	}
+	if credentials != "" {
+		args = append(args, fmt.Sprintf("--route=^/ basicauth:%s,%s", authRealm, credentials))
+	}
+	return args
+}
 
-	// Wait for either completion or signal
-	select {
-	case err := <-errChan:
-		if err != nil {
-			common.PrintError("Server exited with error: %v", err)
-		}
-		fmt.Println("Server stopped")
-	case sig := <-sigChan:
-		fmt.Printf("\nReceived signal %v, shutting down...\n", sig)
-		if cmd.Process != nil {
-			cmd.Process.Signal(sig)
-		}
-		// Wait for process to exit
-		<-errChan
-		fmt.Println("Server stopped")
+// runServer runs the server in the foreground and records state for 'git
+// giftless reload', under the key of its binding, while it runs. SIGINT and
+// SIGTERM interrupt the server, and kill it if it has not stopped 10
+// seconds later.
+func runServer(cmd *exec.Cmd, key string, state serverState) {
+	state.PID = os.Getpid()
+	if err := writeServerState(key, state); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: 'git giftless reload' cannot reach this server: %v\n", err)
+	}
+	defer removeServerState(key)
+
+	err := common.Run(cmd)
+	if common.Interrupted(err) {
+		fmt.Println("\nShutting down...")
+	} else if err != nil {
+		common.PrintError("Server exited with error: %v", err)
 	}
+	fmt.Println("Server stopped")
 }
 
 func printHelp() {
@@ -105,20 +296,110 @@ func printHelp() {
 
 		USAGE:
 		  git giftless [OPTIONS]
+		  git giftless SUBCOMMAND [OPTIONS]
 
 		OPTIONS:
-		  --venv PATH      Path to Python virtual environment (default: /opt/giftless/.venv/bin/activate)
-		  --host ADDRESS   Host address to bind to (default: 0.0.0.0)
-		  --port PORT      Port to listen on (default: 9876)
-		  --threads N      Number of threads per worker (default: 2)
-		  --workers N      Number of worker processes (default: 2)
-		  -h, --help       Show this help message
+		  --venv PATH        Path to Python virtual environment (default: /opt/giftless/.venv/bin/activate)
+		  --host ADDRESS     Host address to bind to, e.g. :: or [::1] for IPv6
+		                     (default: 0.0.0.0)
+		  --port PORT        Port to listen on (default: 9876)
+		  --listen ADDRESS   Listen on a unix socket, unix:PATH, for a reverse proxy
+		                     on this machine, or on HOST:PORT instead of --host
+		                     and --port, e.g. [::1]:9876
+		  --behind-proxy     Build transfer URLs from the X-Forwarded-* headers of
+		                     a reverse proxy (implied by unix sockets)
+		  --print-nginx      Print an nginx reverse proxy configuration for the
+		                     binding and exit
+		  --threads N        Number of threads per worker (default: 2)
+		  --workers N        Number of worker processes (default: 2)
+		  --install-missing  Install missing Python packages with pip before starting
+		  --docker           Run giftless in a Docker container instead of a local venv
+		  --image IMAGE      Docker image for --docker (default: datopian/giftless:0.5.0)
+		  --storage DIR      Storage directory mounted into the container with --docker
+		                     and reported by --stats; --stats also accepts the bucket
+		                     of a cloud backend (default: /opt/giftless/lfs-storage)
+		  --max-bandwidth RATE
+		                     Limit the total bandwidth of all clients, per direction
+		  --per-client-bandwidth RATE
+		                     Limit the bandwidth of each client address, per direction
+		  --tls-cert FILE    Serve HTTPS with this PEM certificate (or chain)
+		  --tls-key FILE     PEM private key of --tls-cert
+		  --auto-tls         Serve HTTPS with a self-signed certificate, created in
+		                     ~/.config/git-lfs-scripts/giftless-tls and reused
+		  --basic-auth       Require the user name and password of a user added
+		                     with 'git giftless user add'
+		  --htpasswd FILE    Require basic auth with the users of this htpasswd
+		                     file instead (implies --basic-auth)
+		  --stats ADDRESS    Serve the statistics of 'git giftless stats' for --storage
+		                     as JSON at http://ADDRESS/stats, e.g. 127.0.0.1:9877
+		  --reload-mercy SECONDS
+		                     How long a worker may finish its transfers when
+		                     reloaded (default: 300)
+		  --trace            Print every external command before running it
+		  -h, --help         Show this help message
+		  --version          Show the version, commit and build date
 
 		DESCRIPTION:
 		  This command starts a Giftless Git LFS server using uwsgi as a WSGI server.
 		  All prerequisites are verified before starting the server.
 
+		  With --docker, the pinned giftless image is pulled and run instead, so no
+		  local Python environment is needed; only Docker is required. The storage
+		  directory is mounted into the container and the container's port is
+		  published on --host and --port. --venv and --install-missing are ignored.
+
+		  With --max-bandwidth or --per-client-bandwidth, a built-in proxy listens
+		  on --host and --port and giftless listens on a loopback port behind it.
+		  The proxy shapes uploads and downloads with token buckets, so a single
+		  large push cannot saturate a shared uplink. Uploads and downloads are
+		  limited separately; RATE is in bytes per second with K, M or G suffixes,
+		  optionally followed by /s.
+
+		  Many credential helpers refuse to send credentials over plain HTTP, so
+		  the server can serve HTTPS. --tls-cert and --tls-key use an existing
+		  certificate; --auto-tls creates a self-signed one for this host name,
+		  localhost and the loopback addresses, renewing it when it nears expiry
+		  or the host name changes. uwsgi serves HTTPS itself (it must be built
+		  with OpenSSL), except with bandwidth limits, where the proxy terminates
+		  TLS. On start, the lfs.url clients must set is printed, plus the
+		  http.sslCAInfo setting that makes them trust a self-signed certificate.
+
+		  With --basic-auth, a small team can require credentials without JWT
+		  infrastructure: uwsgi's basicauth router checks every request against
+		  the bcrypt hashes of the htpasswd file that 'git giftless user' manages,
+		  and giftless then grants read and write access to whoever got through.
+		  The file is read on start, including in the container with --docker.
+		  Git LFS asks for the credentials through Git's credential helpers;
+		  serve HTTPS so they are not sent in the clear.
+
+		  Behind a reverse proxy such as nginx, giftless can listen on a unix
+		  socket, which only local users in its group can reach, instead of a
+		  TCP port. Its workers then speak HTTP on the socket, and the proxy
+		  terminates TLS, so the TLS options cannot be used. Giftless builds the
+		  URLs it sends clients from the proxy's X-Forwarded-* headers; give
+		  --behind-proxy for a proxy in front of a TCP port. The start message
+		  and --print-nginx show an nginx configuration that streams large
+		  transfers instead of buffering them.
+
+		  'git giftless reload' reloads a running server without dropping
+		  transfers: the workers are replaced one at a time, and with --full the
+		  uwsgi master restarts too, reading a renewed TLS certificate. Stop the
+		  server with Ctrl+C or SIGTERM as before.
+
+		SUBCOMMANDS:
+		  scrub            Verify stored objects against their OIDs and quarantine corrupt ones
+		                   (see 'git giftless scrub -h')
+		  import           Copy a repository's LFS objects from an existing LFS server
+		                   (see 'git giftless import -h')
+		  user             Add, remove and list the users of --basic-auth
+		                   (see 'git giftless user -h')
+		  stats            Report object count, size, growth and the largest repositories
+		                   (see 'git giftless stats -h')
+		  reload           Reload a running server without dropping transfers
+		                   (see 'git giftless reload -h')
+
 		REQUIREMENTS:
+		  With --docker, only Docker. Otherwise:
 		  - Python 3 (python3 command must be available)
 		  - Giftless direct dependencies:
 		    azure-storage-blob, boto3, cachetools, cryptography, figcan,
@@ -137,81 +418,62 @@ func printHelp() {
 
 		  # Use specific virtual environment
 		  git giftless --venv /path/to/venv/bin/activate
-	`))
-}
 
-func checkPrerequisites() {
-	var missing []string
-	var missingPackages []string
-
-	// Check Python 3
-	if err := checkCommand("python3", "--version"); err != nil {
-		missing = append(missing, "Python 3 (install from: https://www.python.org/)")
-	}
-
-	// Check giftless direct dependencies
-	deps := []struct {
-		module string
-		pkg    string
-	}{
-		{"azure.storage.blob", "azure-storage-blob"},
-		{"boto3", "boto3"},
-		{"cachetools", "cachetools"},
-		{"cryptography", "cryptography"},
-		{"figcan", "figcan"},
-		{"flask", "flask"},
-		{"flask_classful", "flask-classful"},
-		{"flask_marshmallow", "flask-marshmallow"},
-		{"google.cloud.storage", "google-cloud-storage"},
-		{"importlib_metadata", "importlib-metadata"},
-		{"jwt", "pyjwt"},
-		{"dateutil", "python-dateutil"},
-		{"dotenv", "python-dotenv"},
-		{"yaml", "pyyaml"},
-		{"typing_extensions", "typing-extensions"},
-		{"webargs", "webargs"},
-		{"werkzeug", "werkzeug"},
-	}
-
-	for _, dep := range deps {
-		if err := checkCommand("python3", "-c", "import "+dep.module); err != nil {
-			missing = append(missing, dep.pkg)
-			missingPackages = append(missingPackages, dep.pkg)
-		}
-	}
+		  # Run in Docker, keeping objects in ~/lfs-storage
+		  git giftless --docker --storage ~/lfs-storage --port 8080
 
-	// Check giftless
-	if err := checkCommand("python3", "-c", "import giftless"); err != nil {
-		missing = append(missing, "giftless")
-		missingPackages = append(missingPackages, "giftless")
-	}
+		  # Share 20 MB/s between all clients, at most 5 MB/s each
+		  git giftless --max-bandwidth 20M --per-client-bandwidth 5M
 
-	// Check uwsgi
-	if err := checkCommand("uwsgi", "--version"); err != nil {
-		missing = append(missing, "uwsgi")
-		missingPackages = append(missingPackages, "uwsgi")
-	}
+		  # Serve HTTPS with a certificate from your CA, or a self-signed one
+		  git giftless --tls-cert /etc/ssl/lfs.pem --tls-key /etc/ssl/private/lfs.key
+		  git giftless --auto-tls
 
-	if len(missing) > 0 {
-		fmt.Fprintf(os.Stderr, "Error: Missing required dependencies:\n")
-		for _, dep := range missing {
-			fmt.Fprintf(os.Stderr, "  ✗ %s\n", dep)
-		}
-		fmt.Fprintf(os.Stderr, "\nTo install all missing dependencies, run:\n")
-		fmt.Fprintf(os.Stderr, "  pip install %s\n", strings.Join(missingPackages, " "))
-		os.Exit(1)
-	}
+		  # Require credentials, over HTTPS
+		  git giftless user add alice
+		  git giftless --basic-auth --auto-tls
 
-	fmt.Println("✓ All prerequisites verified")
+		  # Listen on IPv6 only, or behind nginx on a unix socket
+		  git giftless --host ::1
+		  git giftless --listen unix:/run/giftless/giftless.sock
+		  git giftless --listen unix:/run/giftless/giftless.sock --print-nginx
+
+		  # Expose storage statistics to local monitoring
+		  git giftless --stats 127.0.0.1:9877
+
+		  # Serve a renewed certificate without dropping transfers
+		  git giftless reload --full
+	`))
+}
+
+// giftlessRequirements lists Python, the giftless direct dependencies, giftless and uwsgi
+var giftlessRequirements = []prereq.Requirement{
+	prereq.Python,
+	prereq.Module("azure.storage.blob", "azure-storage-blob"),
+	prereq.Module("boto3", "boto3"),
+	prereq.Module("cachetools", "cachetools"),
+	prereq.Module("cryptography", "cryptography"),
+	prereq.Module("figcan", "figcan"),
+	prereq.Module("flask", "flask"),
+	prereq.Module("flask_classful", "flask-classful"),
+	prereq.Module("flask_marshmallow", "flask-marshmallow"),
+	prereq.Module("google.cloud.storage", "google-cloud-storage"),
+	prereq.Module("importlib_metadata", "importlib-metadata"),
+	prereq.Module("jwt", "pyjwt"),
+	prereq.Module("dateutil", "python-dateutil"),
+	prereq.Module("dotenv", "python-dotenv"),
+	prereq.Module("yaml", "pyyaml"),
+	prereq.Module("typing_extensions", "typing-extensions"),
+	prereq.Module("webargs", "webargs"),
+	prereq.Module("werkzeug", "werkzeug"),
+	prereq.Module("giftless", "giftless"),
+	prereq.Script("uwsgi", "uwsgi"),
 }
 
-func checkCommand(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	// Suppress output, we only care about exit code
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("command '%s' not found or failed", name)
+func checkPrerequisites(installMissing bool) {
+	if err := prereq.Ensure(installMissing, giftlessRequirements...); err != nil {
+		common.PrintError("%v", err)
 	}
-	return nil
+
+	fmt.Println("✓ All prerequisites verified")
 }
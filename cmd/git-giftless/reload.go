@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	flag "github.com/spf13/pflag"
+)
+
+// defaultReloadMercy is how many seconds a worker may spend finishing its
+// transfers when it is reloaded, before uwsgi kills it
+const defaultReloadMercy = 300
+
+// containerFifo is the uwsgi master FIFO inside the container
+const containerFifo = "/tmp/uwsgi-master.fifo"
+
+// Commands of the uwsgi master FIFO
+const (
+	chainReload    = "c" // Replace the workers one at a time
+	gracefulReload = "r" // Restart the master, keeping the listening sockets
+)
+
+// serverState is what 'git giftless reload' needs to reach a running
+// server. The server keeps it in the run directory, named after the key of
+// its binding: its port, or a hash of the path of its unix socket.
+type serverState struct {
+	PID       int    `json:"pid"`                 // The git-giftless process
+	Fifo      string `json:"fifo,omitempty"`      // uwsgi master FIFO, without --docker
+	Container string `json:"container,omitempty"` // Container name, with --docker
+	ProxyTLS  bool   `json:"proxy_tls,omitempty"` // The bandwidth proxy serves the certificate
+}
+
+// runDir returns the directory holding the state and FIFOs of running servers
+func runDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "git-lfs-scripts", "giftless-run")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// masterFifo returns the uwsgi master FIFO of the server with key
+func masterFifo(key string) (string, error) {
+	dir, err := runDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, key+".fifo"), nil
+}
+
+func statePath(key string) (string, error) {
+	dir, err := runDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, key+".json"), nil
+}
+
+// writeServerState records how to reach the server with key
+func writeServerState(key string, state serverState) error {
+	path, err := statePath(key)
+	if err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(state, "", "  ")
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// removeServerState forgets the server with key once it stopped
+func removeServerState(key string) {
+	if path, err := statePath(key); err == nil {
+		os.Remove(path)
+	}
+}
+
+// readServerState returns the state of the server on a binding, checking
+// that its git-giftless process still runs
+func readServerState(b binding) (serverState, error) {
+	var state serverState
+	path, err := statePath(b.key())
+	if err != nil {
+		return state, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, fmt.Errorf("no git giftless server was started on %s", describeBinding(b))
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid server state %s: %v", path, err)
+	}
+	process, err := os.FindProcess(state.PID)
+	if err == nil {
+		err = process.Signal(syscall.Signal(0))
+	}
+	if err != nil {
+		os.Remove(path)
+		return state, fmt.Errorf("the git giftless server on %s is no longer running", describeBinding(b))
+	}
+	return state, nil
+}
+
+// describeBinding names a server in messages by its port or socket, since
+// servers on the same port and different hosts share their state
+func describeBinding(b binding) string {
+	if b.unix() {
+		return b.String()
+	}
+	return "port " + b.port
+}
+
+// sendReload asks the server's uwsgi master to reload, and the bandwidth
+// proxy to read its certificate again
+func sendReload(state serverState, command string) error {
+	if state.ProxyTLS {
+		process, err := os.FindProcess(state.PID)
+		if err == nil {
+			err = process.Signal(syscall.SIGHUP)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to signal the bandwidth proxy: %v", err)
+		}
+	}
+
+	if state.Container != "" {
+		output, err := exec.Command("docker", "exec", state.Container, "sh", "-c",
+			fmt.Sprintf("echo %s > %s", command, containerFifo)).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to reach uwsgi in %s: %v: %s", state.Container, err, output)
+		}
+		return nil
+	}
+
+	// Non-blocking, so that a FIFO without its uwsgi master fails at once
+	fifo, err := os.OpenFile(state.Fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to reach uwsgi through %s: %v", state.Fifo, err)
+	}
+	defer fifo.Close()
+	_, err = fifo.WriteString(command)
+	return err
+}
+
+func runReload(args []string) {
+	flags := flag.NewFlagSet("reload", flag.ExitOnError)
+	port := flags.String("port", defaultPort, "Port of the server to reload")
+	listen := flags.String("listen", "", "Address of the server to reload, as given to its --listen, e.g. unix:PATH")
+	full := flags.Bool("full", false, "Restart the uwsgi master too, e.g. for a new certificate or users")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp {
+		printReloadHelp()
+		os.Exit(0)
+	}
+	if flags.NArg() > 0 {
+		common.PrintError("Unexpected argument: %s", flags.Arg(0))
+	}
+
+	if *listen != "" && flags.Changed("port") {
+		common.PrintError("--listen replaces --port")
+	}
+	b, err := parseBinding(*listen, "", *port)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	state, err := readServerState(b)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	command, description := chainReload, "Chain reload requested: workers are replaced one at a time"
+	if *full {
+		command, description = gracefulReload, "Graceful reload requested: uwsgi restarts, keeping its listening socket"
+	}
+	if err := sendReload(state, command); err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("✓ %s\n", description)
+	if state.ProxyTLS {
+		fmt.Println("✓ The bandwidth proxy reloads its TLS certificate")
+	}
+}
+
+func printReloadHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-giftless reload - Reload a running server without dropping transfers
+
+		USAGE:
+		  git giftless reload [OPTIONS]
+
+		OPTIONS:
+		  --port PORT      Port of the server to reload (default: 9876)
+		  --listen ADDRESS Address of the server to reload, as given to its
+		                   --listen, e.g. unix:/run/giftless/giftless.sock
+		  --full           Restart the uwsgi master too, not only the workers
+		  -h, --help       Show this help message
+
+		DESCRIPTION:
+		  By default the workers are chain reloaded: uwsgi starts a new worker,
+		  which loads giftless and its configuration afresh, before retiring an
+		  old one, so requests are always served. A retiring worker first
+		  finishes its transfers, for at most --reload-mercy seconds (default:
+		  300) as given when the server was started.
+
+		  --full gracefully restarts the uwsgi master as well. It keeps the
+		  listening socket, so clients are not refused, and reads the TLS
+		  certificate and the htpasswd file of --basic-auth again. Use it after
+		  renewing the certificate or changing users. The bandwidth proxy, when
+		  it serves the certificate, reads it again on every reload.
+
+		  The server records how to reach it under
+		  ~/.config/git-lfs-scripts/giftless-run; servers started before this
+		  command existed must be restarted once.
+
+		EXAMPLES:
+		  # Pick up a changed giftless configuration
+		  git giftless reload
+
+		  # After renewing the certificate of the server on port 8443
+		  git giftless reload --port 8443 --full
+
+		  # Reload the server behind nginx
+		  git giftless reload --listen unix:/run/giftless/giftless.sock
+	`))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	flag "github.com/spf13/pflag"
+)
+
+// scrubReport summarizes a scrub run; it is also written as JSON with --report
+type scrubReport struct {
+	Storage     string        `json:"storage"`
+	Started     time.Time     `json:"started"`
+	Finished    time.Time     `json:"finished"`
+	Objects     int           `json:"objects"`
+	Bytes       int64         `json:"bytes"`
+	Corrupt     []scrubResult `json:"corrupt"`
+	Unreadable  []scrubResult `json:"unreadable"`
+	Quarantined int           `json:"quarantined"`
+}
+
+// scrubResult describes one object that failed verification
+type scrubResult struct {
+	Path   string `json:"path"`
+	OID    string `json:"oid"`
+	Actual string `json:"actual,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// throttle limits the aggregate read rate to bytesPerSecond (0 means unlimited)
+type throttle struct {
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	return &throttle{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+// consumed records n bytes read and sleeps until the rate is back under the limit
+func (t *throttle) consumed(n int) {
+	if t.bytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	t.read += int64(n)
+	expected := time.Duration(float64(t.read) / float64(t.bytesPerSecond) * float64(time.Second))
+	if elapsed := time.Since(t.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+}
+
+// throttledReader reads through a shared throttle
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	tr.t.consumed(n)
+	return n, err
+}
+
+func runScrub(args []string) {
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	storage := flags.String("storage", defaultStoragePath, "Giftless local storage directory")
+	rate := flags.String("rate", "50M", "Maximum read rate per second (0 for unlimited)")
+	quarantine := flags.String("quarantine", "", "Directory for corrupt objects (default: STORAGE/.quarantine)")
+	reportPath := flags.String("report", "", "Write a JSON report to this file")
+	dryRun := flags.BoolP("dry-run", "d", false, "Report corrupt objects without quarantining them")
+	printTimer := flags.Bool("print-timer", false, "Print systemd service and timer units for scheduled scrubs")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp {
+		printScrubHelp()
+		os.Exit(0)
+	}
+
+	bytesPerSecond, err := common.ParseSize(*rate)
+	if err != nil {
+		common.PrintError("--rate: %v", err)
+	}
+
+	absStorage, err := filepath.Abs(*storage)
+	if err != nil {
+		common.PrintError("Failed to resolve storage path: %v", err)
+	}
+	if info, err := os.Stat(absStorage); err != nil || !info.IsDir() {
+		common.PrintError("Storage directory %s does not exist", absStorage)
+	}
+
+	quarantineDir := filepath.Join(absStorage, quarantineDirName)
+	if *quarantine != "" {
+		if quarantineDir, err = filepath.Abs(*quarantine); err != nil {
+			common.PrintError("Failed to resolve quarantine path: %v", err)
+		}
+	}
+
+	if *printTimer {
+		options := []string{"--storage", absStorage, "--rate", *rate}
+		if *quarantine != "" {
+			options = append(options, "--quarantine", quarantineDir)
+		}
+		report := "/var/log/giftless-scrub.json"
+		if *reportPath != "" {
+			if report, err = filepath.Abs(*reportPath); err != nil {
+				common.PrintError("Failed to resolve report path: %v", err)
+			}
+		}
+		options = append(options, "--report", report)
+		if *dryRun {
+			options = append(options, "--dry-run")
+		}
+		printScrubTimer(options)
+		return
+	}
+
+	limiter := newThrottle(bytesPerSecond)
+	report := scrubReport{Storage: absStorage, Started: time.Now()}
+	fmt.Printf("Scrubbing %s at up to %s/s...\n", absStorage, *rate)
+
+	err = walkObjects(absStorage, quarantineDir, func(obj storedObject) error {
+		report.Objects++
+		report.Bytes += obj.size
+
+		actual, err := hashFile(obj.path, limiter)
+		if err != nil {
+			report.Unreadable = append(report.Unreadable, scrubResult{Path: obj.path, OID: obj.oid, Error: err.Error()})
+			fmt.Printf("  ✗ unreadable: %s (%v)\n", obj.path, err)
+			return nil
+		}
+		if actual == obj.oid {
+			return nil
+		}
+
+		report.Corrupt = append(report.Corrupt, scrubResult{Path: obj.path, OID: obj.oid, Actual: actual})
+		fmt.Printf("  ✗ corrupt: %s (content hashes to %s)\n", obj.path, actual)
+		if !*dryRun {
+			if err := quarantineObject(absStorage, quarantineDir, obj); err != nil {
+				fmt.Printf("    failed to quarantine: %v\n", err)
+			} else {
+				report.Quarantined++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		common.PrintError("Failed to walk storage: %v", err)
+	}
+	report.Finished = time.Now()
+
+	printScrubSummary(report, quarantineDir, *dryRun)
+
+	if *reportPath != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*reportPath, append(data, '\n'), 0644); err != nil {
+			common.PrintError("Failed to write report: %v", err)
+		}
+		fmt.Printf("Report written to %s\n", *reportPath)
+	}
+
+	if len(report.Corrupt) > 0 || len(report.Unreadable) > 0 {
+		os.Exit(2)
+	}
+}
+
+// hashFile returns the hex SHA-256 of a file, reading through the throttle
+func hashFile(path string, limiter *throttle) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	reader := &throttledReader{r: file, t: limiter}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// quarantineObject moves a corrupt object into the quarantine directory,
+// preserving its PREFIX/OID layout
+func quarantineObject(storage, quarantineDir string, obj storedObject) error {
+	rel, err := filepath.Rel(storage, obj.path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(quarantineDir, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(obj.path, target)
+}
+
+func printScrubSummary(report scrubReport, quarantineDir string, dryRun bool) {
+	fmt.Println()
+	fmt.Println("Scrub summary:")
+	fmt.Printf("  Objects verified: %d (%s)\n", report.Objects, common.FormatSize(report.Bytes))
+	fmt.Printf("  Corrupt:          %d\n", len(report.Corrupt))
+	fmt.Printf("  Unreadable:       %d\n", len(report.Unreadable))
+	if dryRun {
+		fmt.Println("  Quarantined:      0 (dry run)")
+	} else {
+		fmt.Printf("  Quarantined:      %d (in %s)\n", report.Quarantined, quarantineDir)
+	}
+	fmt.Printf("  Duration:         %s\n", report.Finished.Sub(report.Started).Round(time.Second))
+}
+
+// printScrubTimer prints systemd units that run a weekly scrub with options
+func printScrubTimer(options []string) {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = "/usr/local/bin/git-giftless"
+	}
+	command := []string{common.ShellQuote(executable), "scrub"}
+	for _, option := range options {
+		command = append(command, common.ShellQuote(option))
+	}
+
+	fmt.Print(dedent.Dedent(fmt.Sprintf(`
+		# /etc/systemd/system/giftless-scrub.service
+		[Unit]
+		Description=Verify Giftless LFS objects against their OIDs
+
+		[Service]
+		Type=oneshot
+		Nice=19
+		IOSchedulingClass=idle
+		ExecStart=%s
+
+		# /etc/systemd/system/giftless-scrub.timer
+		[Unit]
+		Description=Weekly Giftless LFS object scrub
+
+		[Timer]
+		OnCalendar=weekly
+		RandomizedDelaySec=1h
+		Persistent=true
+
+		[Install]
+		WantedBy=timers.target
+
+		# Enable with: sudo systemctl enable --now giftless-scrub.timer
+	`, strings.Join(command, " "))))
+}
+
+func printScrubHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-giftless scrub - Verify stored Git LFS objects against their OIDs
+
+		USAGE:
+		  git giftless scrub [OPTIONS]
+
+		OPTIONS:
+		  --storage DIR      Giftless local storage directory (default: /opt/giftless/lfs-storage)
+		  --rate SIZE        Maximum read rate per second, e.g. 20M (default: 50M, 0 for unlimited)
+		  --quarantine DIR   Directory for corrupt objects (default: STORAGE/.quarantine)
+		  --report FILE      Write a JSON report to FILE
+		  -d, --dry-run      Report corrupt objects without quarantining them
+		  --print-timer      Print systemd service and timer units that scrub weekly
+		                     with the other options given
+		  -h, --help         Show this help message
+
+		DESCRIPTION:
+		  Walks the storage directory, re-hashes every object and compares the
+		  SHA-256 with the OID in its file name. Objects that do not match are moved
+		  into the quarantine directory so giftless stops serving them; clients that
+		  still have the original content can push it again.
+
+		  Reads are throttled so a scrub can run alongside a busy server.
+		  The exit status is 2 when corrupt or unreadable objects were found.
+
+		EXAMPLES:
+		  # Check everything without moving anything
+		  git giftless scrub --dry-run
+
+		  # Scrub weekly via systemd
+		  git giftless scrub --print-timer --rate 20M
+	`))
+}
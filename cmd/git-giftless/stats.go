@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	flag "github.com/spf13/pflag"
+)
+
+// growthWindows are the periods, in days, whose new objects are reported
+var growthWindows = []int{1, 7, 30}
+
+// statsCacheTTL is how long the /stats endpoint reuses a walk of the storage
+const statsCacheTTL = 5 * time.Minute
+
+// usageStats summarizes the objects in a storage directory or bucket; it is
+// also the JSON of stats --json and of the /stats endpoint
+type usageStats struct {
+	Storage   string        `json:"storage"`
+	Generated time.Time     `json:"generated"`
+	Objects   int           `json:"objects"`
+	Bytes     int64         `json:"bytes"`
+	Growth    []growth      `json:"growth"`
+	Prefixes  int           `json:"prefixes"`
+	Top       []prefixUsage `json:"top"`
+}
+
+// growth counts the objects stored during the last Days days
+type growth struct {
+	Days    int   `json:"days"`
+	Objects int   `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// prefixUsage is the usage of one storage prefix, normally a repository ORG/REPO
+type prefixUsage struct {
+	Prefix  string `json:"prefix"`
+	Objects int    `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// collectStats walks storage, a directory or a bucket URL, and returns its
+// usage with the top prefixes by size
+func collectStats(storage string, top int, now time.Time) (usageStats, error) {
+	stats := usageStats{Storage: storage, Generated: now}
+	for _, days := range growthWindows {
+		stats.Growth = append(stats.Growth, growth{Days: days})
+	}
+	prefixes := make(map[string]*prefixUsage)
+
+	walk := walkBucket
+	if !isBucket(storage) {
+		walk = func(dir string, fn func(obj storedObject) error) error {
+			return walkObjects(dir, "", fn)
+		}
+	}
+	err := walk(storage, func(obj storedObject) error {
+		stats.Objects++
+		stats.Bytes += obj.size
+		for i := range stats.Growth {
+			if now.Sub(obj.modified) <= time.Duration(stats.Growth[i].Days)*24*time.Hour {
+				stats.Growth[i].Objects++
+				stats.Growth[i].Bytes += obj.size
+			}
+		}
+		usage, ok := prefixes[obj.prefix]
+		if !ok {
+			usage = &prefixUsage{Prefix: obj.prefix}
+			prefixes[obj.prefix] = usage
+		}
+		usage.Objects++
+		usage.Bytes += obj.size
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Prefixes = len(prefixes)
+	stats.Top = make([]prefixUsage, 0, len(prefixes))
+	for _, usage := range prefixes {
+		stats.Top = append(stats.Top, *usage)
+	}
+	sort.Slice(stats.Top, func(i, j int) bool {
+		if stats.Top[i].Bytes != stats.Top[j].Bytes {
+			return stats.Top[i].Bytes > stats.Top[j].Bytes
+		}
+		return stats.Top[i].Prefix < stats.Top[j].Prefix
+	})
+	if top > 0 && len(stats.Top) > top {
+		stats.Top = stats.Top[:top]
+	}
+	return stats, nil
+}
+
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	storage := flags.String("storage", defaultStoragePath, "Giftless local storage directory, or an s3:// or gs:// bucket URL")
+	top := flags.Int("top", 10, "Number of prefixes to list (0 for all)")
+	asJSON := flags.Bool("json", false, "Print the statistics as JSON")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp {
+		printStatsHelp()
+		os.Exit(0)
+	}
+	if *top < 0 {
+		common.PrintError("--top must not be negative")
+	}
+
+	location, err := resolveStorage(*storage)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	stats, err := collectStats(location, *top, time.Now())
+	if err != nil {
+		common.PrintError("Failed to read storage: %v", err)
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printStats(stats)
+}
+
+// resolveStorage makes a storage directory absolute and checks that it
+// exists; bucket URLs are returned unchanged
+func resolveStorage(storage string) (string, error) {
+	if isBucket(storage) {
+		return storage, nil
+	}
+	abs, err := filepath.Abs(storage)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve storage path: %v", err)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("storage directory %s does not exist", abs)
+	}
+	return abs, nil
+}
+
+func printStats(stats usageStats) {
+	fmt.Printf("Storage: %s\n", stats.Storage)
+	fmt.Printf("  Objects:    %d (%s)\n", stats.Objects, common.FormatSize(stats.Bytes))
+	fmt.Printf("  Prefixes:   %d\n", stats.Prefixes)
+	fmt.Println()
+	fmt.Println("Growth:")
+	for _, g := range stats.Growth {
+		label := fmt.Sprintf("Last %d days:", g.Days)
+		if g.Days == 1 {
+			label = "Last day:"
+		}
+		fmt.Printf("  %-14s +%d objects (+%s)\n", label, g.Objects, common.FormatSize(g.Bytes))
+	}
+	if len(stats.Top) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Top prefixes by size:")
+	fmt.Printf("  %-40s %10s %10s %6s\n", "PREFIX", "OBJECTS", "SIZE", "SHARE")
+	for _, usage := range stats.Top {
+		prefix := usage.Prefix
+		if prefix == "" {
+			prefix = "(top level)"
+		}
+		share := 0.0
+		if stats.Bytes > 0 {
+			share = float64(usage.Bytes) / float64(stats.Bytes) * 100
+		}
+		fmt.Printf("  %-40s %10d %10s %5.1f%%\n", prefix, usage.Objects, common.FormatSize(usage.Bytes), share)
+	}
+}
+
+// statsHandler serves the usage of storage as JSON, walking it at most once
+// per statsCacheTTL so that frequent polling does not load the disk
+type statsHandler struct {
+	storage string
+	mu      sync.Mutex
+	cached  *usageStats
+}
+
+func (h *statsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.Lock()
+	if h.cached == nil || time.Since(h.cached.Generated) > statsCacheTTL {
+		stats, err := collectStats(h.storage, 10, time.Now())
+		if err != nil {
+			h.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.cached = &stats
+	}
+	stats := *h.cached
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// startStatsServer serves the usage of storage at http://address/stats while
+// the giftless server runs
+func startStatsServer(address, storage string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for --stats: %v", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/stats", &statsHandler{storage: storage})
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Statistics endpoint stopped: %v\n", err)
+		}
+	}()
+	fmt.Printf("Storage statistics: http://%s/stats\n", listener.Addr())
+	return nil
+}
+
+func printStatsHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-giftless stats - Report the storage used by Git LFS objects
+
+		USAGE:
+		  git giftless stats [OPTIONS]
+
+		OPTIONS:
+		  --storage LOCATION Giftless local storage directory, or the bucket of a
+		                     cloud backend as s3://BUCKET/PATH or gs://BUCKET/PATH
+		                     (default: /opt/giftless/lfs-storage)
+		  --top N            Number of prefixes to list (default: 10, 0 for all)
+		  --json             Print the statistics as JSON
+		  -h, --help         Show this help message
+
+		DESCRIPTION:
+		  Counts the objects in the storage and their total size, the objects
+		  stored during the last day, 7 days and 30 days, and lists the prefixes
+		  that use the most space. Giftless stores the objects of a repository
+		  below its prefix, normally ORG/REPO. Quarantined objects are not
+		  counted.
+
+		  Buckets are listed with the aws or gcloud CLI, using their
+		  credentials. Growth is based on file modification times, or the
+		  upload times of bucket objects.
+
+		  'git giftless --stats ADDRESS' serves the same JSON at
+		  http://ADDRESS/stats while the server runs, for dashboards and
+		  monitoring. The storage is walked at most once every 5 minutes.
+
+		EXAMPLES:
+		  # Usage of the default storage directory
+		  git giftless stats
+
+		  # The 20 largest repositories of an S3 backend
+		  git giftless stats --storage s3://lfs-objects/giftless --top 20
+
+		  # Statistics for a script
+		  git giftless stats --json
+	`))
+}
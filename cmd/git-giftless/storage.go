@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+)
+
+// defaultStoragePath is where the giftless LocalStorage backend keeps objects
+const defaultStoragePath = "/opt/giftless/lfs-storage"
+
+// quarantineDirName is the storage subdirectory holding objects that failed verification
+const quarantineDirName = ".quarantine"
+
+// storedObject is an LFS object found in the storage directory
+type storedObject struct {
+	path     string // Absolute path of the object file
+	prefix   string // Storage prefix, normally ORG/REPO
+	oid      string
+	size     int64
+	modified time.Time
+}
+
+// walkObjects calls fn for every LFS object below storage, skipping
+// directories named .quarantine and the quarantine directory, which may be
+// named otherwise. Giftless LocalStorage lays objects out as PREFIX/OID.
+func walkObjects(storage, quarantine string, fn func(obj storedObject) error) error {
+	return filepath.Walk(storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == quarantineDirName || path == quarantine {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !lfspointer.ValidOID(info.Name()) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(storage, filepath.Dir(path))
+		prefix := filepath.ToSlash(rel)
+		if prefix == "." {
+			prefix = ""
+		}
+		return fn(storedObject{
+			path:     path,
+			prefix:   strings.Trim(prefix, "/"),
+			oid:      info.Name(),
+			size:     info.Size(),
+			modified: info.ModTime(),
+		})
+	})
+}
+
+// isBucket reports whether storage is a cloud bucket URL rather than a directory
+func isBucket(storage string) bool {
+	return strings.HasPrefix(storage, "s3://") || strings.HasPrefix(storage, "gs://")
+}
+
+// walkBucket calls fn for every LFS object below a bucket URL, listing it
+// with the aws or gcloud CLI, which hold the credentials. The giftless cloud
+// backends lay objects out as PATH_PREFIX/PREFIX/OID like LocalStorage.
+func walkBucket(url string, fn func(obj storedObject) error) error {
+	var cmd *exec.Cmd
+	parse := parseS3Listing
+	switch {
+	case strings.HasPrefix(url, "s3://"):
+		if err := prereq.Verify(prereq.Bin("aws", "install from: https://aws.amazon.com/cli/")); err != nil {
+			return err
+		}
+		cmd = exec.Command("aws", "s3", "ls", "--recursive", strings.TrimSuffix(url, "/")+"/")
+	case strings.HasPrefix(url, "gs://"):
+		if err := prereq.Verify(prereq.Bin("gcloud", "install from: https://cloud.google.com/sdk/docs/install")); err != nil {
+			return err
+		}
+		cmd = exec.Command("gcloud", "storage", "ls", "--long", "--recursive", strings.TrimSuffix(url, "/")+"/**")
+		parse = parseGCSListing
+	default:
+		return fmt.Errorf("unsupported bucket URL %s; use s3://BUCKET/PATH or gs://BUCKET/PATH", url)
+	}
+	output, err := common.Query(cmd)
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("failed to list %s: %s", url, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("failed to list %s: %v", url, err)
+	}
+
+	// Listings name keys relative to the bucket; prefixes are relative to url
+	scheme, location, _ := strings.Cut(url, "://")
+	bucket, root, _ := strings.Cut(location, "/")
+	root = strings.Trim(root, "/")
+	for _, line := range strings.Split(string(output), "\n") {
+		key, size, modified, ok := parse(line, bucket)
+		if !ok {
+			continue
+		}
+		dir, oid := "", key
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			dir, oid = key[:i], key[i+1:]
+		}
+		if !lfspointer.ValidOID(oid) {
+			continue
+		}
+		if root != "" {
+			if dir != root && !strings.HasPrefix(dir, root+"/") {
+				continue
+			}
+			dir = strings.Trim(strings.TrimPrefix(dir, root), "/")
+		}
+		if dir == quarantineDirName || strings.HasPrefix(dir, quarantineDirName+"/") {
+			continue
+		}
+		obj := storedObject{path: scheme + "://" + bucket + "/" + key, prefix: dir, oid: oid, size: size, modified: modified}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Listing matches a line of aws s3 ls --recursive output:
+// DATE TIME SIZE KEY, with the time in the local time zone
+var s3Listing = regexp.MustCompile(`^(\S+ \S+)\s+(\d+) (.+)$`)
+
+// parseS3Listing reads a line of aws s3 ls --recursive output
+func parseS3Listing(line, _ string) (string, int64, time.Time, bool) {
+	match := s3Listing.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if match == nil {
+		return "", 0, time.Time{}, false
+	}
+	modified, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], time.Local)
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	size, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	return match[3], size, modified, true
+}
+
+// parseGCSListing reads a line of gcloud storage ls --long output:
+// SIZE TIME gs://BUCKET/KEY
+func parseGCSListing(line, bucket string) (string, int64, time.Time, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", 0, time.Time{}, false
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	modified, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	key, found := strings.CutPrefix(fields[2], "gs://"+bucket+"/")
+	if !found {
+		return "", 0, time.Time{}, false
+	}
+	return key, size, modified, true
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// selfSignedValidity is how long an --auto-tls certificate is valid; it is
+// renewed when less than a month remains
+const selfSignedValidity = 2 * 365 * 24 * time.Hour
+
+// tlsFiles are the PEM certificate and key uwsgi or the proxy serves
+type tlsFiles struct {
+	cert       string
+	key        string
+	selfSigned bool // Made by --auto-tls; clients must be told to trust it
+}
+
+// reloadableCertificate is a certificate that can be read again from its
+// files while it is being served
+type reloadableCertificate struct {
+	files *tlsFiles
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+}
+
+func newReloadableCertificate(files *tlsFiles) (*reloadableCertificate, error) {
+	c := &reloadableCertificate{files: files}
+	return c, c.reload()
+}
+
+// reload reads the certificate and key again, keeping the previous pair
+// when they are invalid
+func (c *reloadableCertificate) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.files.cert, c.files.key)
+	if err != nil {
+		return fmt.Errorf("invalid TLS certificate or key: %v", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// get serves as tls.Config.GetCertificate
+func (c *reloadableCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// resolveTLS checks the TLS options and returns the files to serve, or nil
+// for plain HTTP. With auto, a self-signed certificate for names is created
+// in the config directory, or reused while it is valid and covers them.
+func resolveTLS(certFile, keyFile string, auto bool, names []string) (*tlsFiles, error) {
+	switch {
+	case auto && (certFile != "" || keyFile != ""):
+		return nil, fmt.Errorf("--auto-tls cannot be combined with --tls-cert or --tls-key")
+	case (certFile == "") != (keyFile == ""):
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+	case auto:
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		return ensureSelfSigned(filepath.Join(dir, "git-lfs-scripts", "giftless-tls"), names)
+	case certFile == "":
+		return nil, nil
+	}
+
+	cert, err := filepath.Abs(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := filepath.Abs(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		return nil, fmt.Errorf("invalid TLS certificate or key: %v", err)
+	}
+	return &tlsFiles{cert: cert, key: key}, nil
+}
+
+// ensureSelfSigned returns dir/cert.pem and dir/key.pem, creating them when
+// missing, expiring within a month or not covering every name
+func ensureSelfSigned(dir string, names []string) (*tlsFiles, error) {
+	files := &tlsFiles{cert: filepath.Join(dir, "cert.pem"), key: filepath.Join(dir, "key.pem"), selfSigned: true}
+	if pair, err := tls.LoadX509KeyPair(files.cert, files.key); err == nil && covers(pair.Leaf, names) {
+		return files, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[0], Organization: []string{"git-giftless self-signed"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // Lets clients trust it directly through http.sslCAInfo
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(files.key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(files.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Created self-signed certificate %s\n", files.cert)
+	return files, nil
+}
+
+// covers reports whether a certificate is valid for another month and for
+// every name
+func covers(cert *x509.Certificate, names []string) bool {
+	if cert == nil || time.Until(cert.NotAfter) < 30*24*time.Hour {
+		return false
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost is the name clients use to reach a server bound to host
+func publicHost(host string) string {
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		return host
+	}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "localhost"
+}
+
+// certificateNames lists the names an --auto-tls certificate must cover
+func certificateNames(host string) []string {
+	names := []string{publicHost(host), "localhost", "127.0.0.1", "::1"}
+	var unique []string
+	for _, name := range names {
+		if !slices.Contains(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// printClientConfig shows the git config clients need for this server, and
+// for a unix socket the reverse proxy configuration they connect through
+func printClientConfig(b binding, files *tlsFiles, credentials string) {
+	scheme := "http"
+	if files != nil {
+		scheme = "https"
+	}
+	base := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(publicHost(b.host), b.port))
+	if b.unix() {
+		base = "https://" + publicHost("")
+	}
+
+	fmt.Println()
+	if b.unix() {
+		fmt.Println("Only a reverse proxy on this machine can reach the socket, e.g. nginx with:")
+		fmt.Println()
+		fmt.Print(nginxConfig(b, false))
+		fmt.Println()
+		fmt.Println("The proxy's user must be in the group of the socket.")
+	}
+	fmt.Println("Clients configure each repository with:")
+	fmt.Printf("  git config lfs.url %s/ORG/REPO\n", base)
+	switch {
+	case b.unix():
+		// The proxy serves HTTPS
+	case files == nil:
+		fmt.Println("Plain HTTP: many credential helpers refuse to send credentials; consider --auto-tls or --tls-cert.")
+	case files.selfSigned:
+		fmt.Printf("The certificate is self-signed; copy %s to each client and trust it with:\n", files.cert)
+		fmt.Printf("  git config --global http.%s/.sslCAInfo /path/to/cert.pem\n", base)
+	}
+	if credentials != "" {
+		fmt.Println("Git LFS asks for a user name and password from 'git giftless user list'; store them with a credential helper.")
+	}
+	fmt.Println()
+}
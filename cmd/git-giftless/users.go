@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/htpasswd"
+	flag "github.com/spf13/pflag"
+)
+
+// authRealm is the realm of the basic auth challenge
+const authRealm = "giftless"
+
+// authConfig lets every request giftless sees read and write, since uwsgi
+// only lets through those with valid credentials
+const authConfig = `AUTH_PROVIDERS:
+  - giftless.auth.allow_anon:read_write
+`
+
+// defaultHtpasswd returns the credentials file used without --htpasswd
+func defaultHtpasswd() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-lfs-scripts", "giftless-htpasswd"), nil
+}
+
+// resolveBasicAuth returns the absolute path of the credentials file the
+// server requires, or "" without basic auth. The file must have a user.
+func resolveBasicAuth(enabled bool, file string) (string, error) {
+	if file == "" {
+		if !enabled {
+			return "", nil
+		}
+		var err error
+		if file, err = defaultHtpasswd(); err != nil {
+			return "", err
+		}
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	users, err := htpasswd.Load(file)
+	if err != nil {
+		return "", err
+	}
+	if len(users.Entries) == 0 {
+		return "", fmt.Errorf("%s has no users; add one with: git giftless user --htpasswd %s add NAME", file, common.ShellQuote(file))
+	}
+	return file, nil
+}
+
+func runUser(args []string) {
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	file := flags.String("htpasswd", "", "Credentials file (default: ~/.config/git-lfs-scripts/giftless-htpasswd)")
+	cost := flags.Int("cost", htpasswd.DefaultCost, "bcrypt cost of new passwords")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp {
+		printUserHelp("")
+		os.Exit(0)
+	}
+	if flags.NArg() == 0 {
+		printUserHelp("Error: An action must be specified")
+		os.Exit(1)
+	}
+	if *file == "" {
+		path, err := defaultHtpasswd()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		*file = path
+	}
+	users, err := htpasswd.Load(*file)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	action, names := flags.Arg(0), flags.Args()[1:]
+	switch action {
+	case "list":
+		if len(names) > 0 {
+			common.PrintError("list takes no user names")
+		}
+		for _, entry := range users.Entries {
+			fmt.Println(entry.User)
+		}
+		return
+	case "add", "remove":
+		if len(names) != 1 {
+			printUserHelp(fmt.Sprintf("Error: %s takes one user name", action))
+			os.Exit(1)
+		}
+	default:
+		printUserHelp(fmt.Sprintf("Error: Unknown action '%s'", action))
+		os.Exit(1)
+	}
+
+	name := names[0]
+	audit := common.StartAudit("git-giftless user", false)
+	if action == "remove" {
+		if !users.Remove(name) {
+			common.PrintError("%s has no user %s", *file, name)
+		}
+		if err := users.Save(); err != nil {
+			audit.Finish(err)
+			common.PrintError("%v", err)
+		}
+		audit.Changed(*file)
+		audit.Finish(nil)
+		fmt.Printf("✓ Removed %s from %s\n", name, *file)
+		return
+	}
+
+	if err := htpasswd.ValidUser(name); err != nil {
+		common.PrintError("%v", err)
+	}
+	password, err := readPassword(name)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	hash, err := htpasswd.Hash(password, *cost)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	verb := "Changed the password of"
+	if users.Set(name, hash) {
+		verb = "Added"
+	}
+	if err := users.Save(); err != nil {
+		audit.Finish(err)
+		common.PrintError("%v", err)
+	}
+	audit.Changed(*file)
+	audit.Finish(nil)
+	fmt.Printf("✓ %s %s in %s\n", verb, name, *file)
+	fmt.Println("  Servers started with --basic-auth read the file on start; restart them to apply the change.")
+}
+
+// readPassword asks twice for the password of user without echoing it, or
+// reads its first line when standard input is not a terminal
+func readPassword(user string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("no password on standard input: %v", err)
+		}
+		return password, nil
+	}
+
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	defer stty("echo")
+	reader := bufio.NewReader(os.Stdin)
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		line, _ := reader.ReadString('\n')
+		fmt.Println()
+		return strings.TrimRight(line, "\r\n")
+	}
+	password := ask(fmt.Sprintf("Password for %s: ", user))
+	if password == "" {
+		return "", fmt.Errorf("the password cannot be empty")
+	}
+	if ask("Repeat the password: ") != password {
+		return "", fmt.Errorf("the passwords do not match")
+	}
+	return password, nil
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func printUserHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-giftless user - Manage the users of a basic auth Giftless server
+
+		USAGE:
+		  git giftless user [OPTIONS] add NAME
+		  git giftless user [OPTIONS] remove NAME
+		  git giftless user [OPTIONS] list
+
+		OPTIONS:
+		  --htpasswd FILE  Credentials file (default:
+		                   ~/.config/git-lfs-scripts/giftless-htpasswd)
+		  --cost N         bcrypt cost of new passwords, 4 to 31 (default: 10)
+		  -h, --help       Show this help message
+
+		DESCRIPTION:
+		  Keeps the users of 'git giftless --basic-auth' in an htpasswd file,
+		  readable only by its owner, with passwords hashed with bcrypt. add
+		  creates a user or changes their password; it asks for the password
+		  twice on a terminal, and otherwise reads it from the first line of
+		  standard input. The file is in Apache's format, so htpasswd -B can
+		  manage it too.
+
+		EXAMPLES:
+		  git giftless user add alice
+		  printf '%s\n' "$PASSWORD" | git giftless user add ci-bot
+		  git giftless user remove bob
+		  git giftless user list
+	`))
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsarchive"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// defaultRevs are archived when no revisions are given
+var defaultRevs = []string{"--branches", "--tags", "HEAD"}
+
+// maxMissingListed is how many missing objects the error lists
+const maxMissingListed = 10
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	tipsOnly := flag.Bool("tips-only", false, "Only include the LFS objects of the archived ref tips, not of their history")
+	allowMissing := flag.Bool("allow-missing", false, "Archive even when LFS objects are missing from local storage")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be archived without writing the archive")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-archive")
+	completion.Handle(completion.Command{Name: "git-lfs-archive", Flags: flag.CommandLine, Args: completion.ArgFile})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		printHelp("Error: The archive file must be specified")
+		os.Exit(1)
+	}
+	archive := flag.Arg(0)
+	revs := flag.Args()[1:]
+	if len(revs) == 0 {
+		revs = defaultRevs
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := prereq.Verify(prereq.Git); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	manifest, err := newManifest(archive)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	pointers, err := referencedPointers(revs, *tipsOnly)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	for _, p := range pointers {
+		obj := lfsarchive.Object{OID: p.OID, Size: p.Size, Path: p.Path}
+		if info, err := os.Stat(lfspointer.ObjectPath(storage, p.OID)); err == nil && info.Size() == p.Size {
+			manifest.Objects = append(manifest.Objects, obj)
+		} else {
+			manifest.Missing = append(manifest.Missing, obj)
+		}
+	}
+
+	fmt.Printf("LFS objects referenced by %s: %d (%s)\n", strings.Join(revs, " "), len(pointers), common.FormatSize(lfspointer.TotalSize(pointers)))
+	if len(manifest.Missing) > 0 {
+		reportMissing(manifest.Missing, !*allowMissing)
+	}
+	if *dryRun {
+		fmt.Printf("DRY RUN: would archive a bundle of %s and %d LFS objects to %s\n", strings.Join(revs, " "), len(manifest.Objects), archive)
+		return
+	}
+
+	audit := common.StartAudit("git-lfs-archive", false)
+	if err := writeArchive(archive, &manifest, revs, storage); err != nil {
+		audit.Finish(err)
+		common.PrintError("%v", err)
+	}
+	audit.Created(archive)
+	audit.Finish(nil)
+
+	info, _ := os.Stat(archive)
+	fmt.Printf("✓ Archived %d refs and %d LFS objects to %s (%s)\n", len(manifest.Refs), len(manifest.Objects), archive, common.FormatSize(info.Size()))
+	fmt.Printf("  Restore with: git lfs-unarchive %s, or extract it and run sh %s/%s\n", archive, manifest.Name, lfsarchive.ScriptName)
+}
+
+// newManifest describes the current repository; the archive name is only
+// used when the repository has no name of its own
+func newManifest(archive string) (lfsarchive.Manifest, error) {
+	top, err := common.ExecGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		return lfsarchive.Manifest{}, fmt.Errorf("not inside a Git working tree")
+	}
+	name := filepath.Base(strings.TrimSpace(top))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(filepath.Base(archive), ".tgz"), ".gz"), ".tar")
+	}
+	source, _ := common.ExecGitCommand("config", "--get", "remote.origin.url")
+	head, _ := common.ExecGitCommand("symbolic-ref", "--quiet", "--short", "HEAD")
+	return lfsarchive.Manifest{
+		Format:  lfsarchive.Format,
+		Name:    name,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Source:  strings.TrimSpace(source),
+		Head:    strings.TrimSpace(head),
+	}, nil
+}
+
+// referencedPointers returns the pointers the archived history references,
+// each oid once: those of every commit, or with tipsOnly of the commits revs
+// name
+func referencedPointers(revs []string, tipsOnly bool) ([]lfspointer.Pointer, error) {
+	var pointers []lfspointer.Pointer
+	if tipsOnly {
+		output, err := exec.Command("git", append([]string{"rev-parse"}, revs...)...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s", strings.Join(revs, " "))
+		}
+		var commits []string
+		for _, commit := range strings.Fields(string(output)) {
+			if !strings.HasPrefix(commit, "^") {
+				commits = append(commits, commit)
+			}
+		}
+		return lfspointer.ListRefs(commits)
+	}
+
+	found, err := lfspointer.ReachableFrom(revs)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, p := range found {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			pointers = append(pointers, p)
+		}
+	}
+	return pointers, nil
+}
+
+// reportMissing lists objects missing from local storage, and with fatal
+// stops
+func reportMissing(missing []lfsarchive.Object, fatal bool) {
+	var size int64
+	for _, obj := range missing {
+		size += obj.Size
+	}
+	fmt.Fprintf(os.Stderr, "⚠ %d LFS objects (%s) are not in local storage:\n", len(missing), common.FormatSize(size))
+	for i, obj := range missing {
+		if i == maxMissingListed {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(missing)-maxMissingListed)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s  %s\n", obj.OID[:12], obj.Path)
+	}
+	if fatal {
+		common.PrintError("Fetch them with 'git lfs fetch --all', or archive without them with --allow-missing")
+	}
+	fmt.Fprintln(os.Stderr, "  They are listed as missing in the manifest; their files stay pointers when restored.")
+}
+
+// writeArchive bundles revs and writes the archive next to its final name,
+// renaming it into place once complete
+func writeArchive(archive string, manifest *lfsarchive.Manifest, revs []string, storage string) error {
+	dir, err := os.MkdirTemp("", "lfs-archive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, lfsarchive.BundleName)
+	if err := common.RunCommand("git", append([]string{"bundle", "create", bundle}, revs...)...); err != nil {
+		return fmt.Errorf("git bundle create failed: %v", err)
+	}
+	output, err := exec.Command("git", "bundle", "list-heads", bundle).Output()
+	if err != nil {
+		return fmt.Errorf("git bundle list-heads failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if _, ref, ok := strings.Cut(line, " "); ok && ref != "HEAD" {
+			manifest.Refs = append(manifest.Refs, ref)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(archive), filepath.Base(archive)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var w io.Writer = tmp
+	var gz *gzip.Writer
+	if lfsarchive.IsGzip(archive) {
+		gz = gzip.NewWriter(tmp)
+		w = gz
+	}
+	err = lfsarchive.Write(w, *manifest, bundle, storage)
+	if gz != nil && err == nil {
+		err = gz.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", archive, err)
+	}
+	return os.Rename(tmp.Name(), archive)
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-archive - Export a repository with its LFS objects as one file
+
+		USAGE:
+		  git lfs-archive [OPTIONS] ARCHIVE [REV...]
+
+		OPTIONS:
+		  --tips-only          Only include the LFS objects of the archived ref
+		                       tips, not of their history
+		  --allow-missing      Archive even when LFS objects are missing from
+		                       local storage
+		  -d, --dry-run        Show what would be archived without writing it
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  A git bundle carries a repository offline, but not its Git LFS
+		  objects, so a clone of it has only pointer files. git-lfs-archive
+		  writes a tar file (compressed when ARCHIVE ends in .tar.gz or .tgz)
+		  holding, below a directory named after the repository:
+		    manifest.json   The refs, the origin URL and every LFS object
+		    restore.sh      Restores the repository with only git and git-lfs
+		    repo.bundle     A git bundle of REV..., by default every branch,
+		                    every tag and HEAD
+		    lfs/objects/    The LFS objects the bundled history references
+
+		  Every LFS object of the bundled history is included, so any commit
+		  can be checked out offline; --tips-only includes only those of the
+		  commits REV... name. The objects must be in local storage: fetch
+		  them first with 'git lfs fetch --all'. With --allow-missing the
+		  archive is written anyway and the manifest lists what is missing.
+
+		  Restore the archive with git-lfs-unarchive, which verifies every
+		  object, or on a machine without it by extracting the archive and
+		  running restore.sh.
+
+		EXAMPLES:
+		  # Everything, for an air-gapped network
+		  git lfs-fetch-all-refs && git lfs-archive /media/usb/assets.tar.gz
+
+		  # Only the release branch, with the objects of its latest commit
+		  git lfs-archive --tips-only release-2.0.tar release/2.0
+
+		  # What would be archived, and which objects are missing locally
+		  git lfs-archive --dry-run assets.tar
+	`))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// adapterRunner transfers objects with git lfs itself in a scratch
+// repository, so a custom transfer agent (an S3 agent, git-lfs-trace, ...)
+// is measured exactly as clients use it. Git LFS batches and schedules the
+// transfers, so only whole phases are timed.
+type adapterRunner struct {
+	dir      string // Scratch repository
+	endpoint string
+	adapter  string // Name of a lfs.customtransfer.NAME agent, or "" for git-lfs's own
+}
+
+// newAdapterRunner creates a scratch repository that uses endpoint and
+// copies the agent's lfs.customtransfer.NAME.* settings from the current
+// repository's configuration
+func newAdapterRunner(endpoint, adapter string) (*adapterRunner, error) {
+	dir, err := os.MkdirTemp("", "git-lfs-bench-")
+	if err != nil {
+		return nil, err
+	}
+	r := &adapterRunner{dir: dir, endpoint: endpoint, adapter: adapter}
+
+	settings := [][]string{
+		{"init", "--quiet"},
+		{"config", "lfs.url", endpoint},
+		{"config", "remote.origin.url", strings.TrimSuffix(strings.TrimSuffix(endpoint, "/info/lfs"), ".git") + ".git"},
+	}
+	if adapter != "" {
+		output, _ := exec.Command("git", "config", "--get-regexp", `^lfs\.customtransfer\.`+adapter+`\.`).Output()
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(lines) == 0 || lines[0] == "" {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("transfer agent '%s' is not configured (git config lfs.customtransfer.%s.path)", adapter, adapter)
+		}
+		for _, line := range lines {
+			key, value, _ := strings.Cut(line, " ")
+			settings = append(settings, []string{"config", key, value})
+		}
+		settings = append(settings, []string{"config", "lfs.standalonetransferagent", adapter})
+	}
+	for _, args := range settings {
+		if err := r.git(args...); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *adapterRunner) close() {
+	os.RemoveAll(r.dir)
+}
+
+// upload writes the objects to local LFS storage and pushes them by oid
+func (r *adapterRunner) upload(objects []syntheticObject, concurrency int) (time.Duration, []sample) {
+	storage := filepath.Join(r.dir, ".git", "lfs", "objects")
+	for _, obj := range objects {
+		if err := writeObject(lfspointer.ObjectPath(storage, obj.oid), obj); err != nil {
+			return 0, failAll(objects, err)
+		}
+	}
+
+	args := []string{"-c", "lfs.concurrenttransfers=" + strconv.Itoa(concurrency), "lfs", "push", "--object-id", "origin"}
+	for _, obj := range objects {
+		args = append(args, obj.oid)
+	}
+	start := time.Now()
+	err := r.git(args...)
+	return time.Since(start), wholePhase(objects, err)
+}
+
+// download commits pointers to the objects, empties local storage and
+// fetches them back
+func (r *adapterRunner) download(objects []syntheticObject, concurrency int) (time.Duration, []sample) {
+	// Only this phase's pointers may be in HEAD, or earlier phases' objects
+	// would be fetched again
+	if err := r.git("rm", "-r", "--quiet", "--ignore-unmatch", "."); err != nil {
+		return 0, failAll(objects, err)
+	}
+	for _, obj := range objects {
+		pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", obj.oid, obj.size)
+		if err := os.WriteFile(filepath.Join(r.dir, obj.oid), []byte(pointer), 0644); err != nil {
+			return 0, failAll(objects, err)
+		}
+	}
+	if err := r.git("add", "--all"); err != nil {
+		return 0, failAll(objects, err)
+	}
+	if err := r.git("-c", "user.name=git-lfs-bench", "-c", "user.email=bench@localhost", "commit", "--quiet", "--no-verify", "--allow-empty", "-m", "bench"); err != nil {
+		return 0, failAll(objects, err)
+	}
+	if err := os.RemoveAll(filepath.Join(r.dir, ".git", "lfs", "objects")); err != nil {
+		return 0, failAll(objects, err)
+	}
+
+	start := time.Now()
+	err := r.git("-c", "lfs.concurrenttransfers="+strconv.Itoa(concurrency), "lfs", "fetch", "origin", "HEAD")
+	wall := time.Since(start)
+	if err == nil {
+		storage := filepath.Join(r.dir, ".git", "lfs", "objects")
+		for _, obj := range objects {
+			if info, statErr := os.Stat(lfspointer.ObjectPath(storage, obj.oid)); statErr != nil || info.Size() != obj.size {
+				err = fmt.Errorf("%s was not fetched", obj.oid[:12])
+				break
+			}
+		}
+	}
+	return wall, wholePhase(objects, err)
+}
+
+func (r *adapterRunner) git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v\n%s", strings.Join(args[:min(len(args), 4)], " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func writeObject(path string, obj syntheticObject) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, obj.reader()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// wholePhase records a phase that succeeded or failed as a whole; adapter
+// mode has no per-object timings
+func wholePhase(objects []syntheticObject, err error) []sample {
+	if err != nil {
+		return failAll(objects, err)
+	}
+	samples := make([]sample, len(objects))
+	for i, obj := range objects {
+		samples[i] = sample{bytes: obj.size}
+	}
+	return samples
+}
+
+func failAll(objects []syntheticObject, err error) []sample {
+	samples := make([]sample, len(objects))
+	for i := range samples {
+		samples[i] = sample{err: err}
+	}
+	return samples
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+)
+
+// apiRunner transfers objects with the basic transfer adapter over the Batch
+// API, one object per batch request, so each object's latency is measured
+type apiRunner struct {
+	client *lfsapi.Client
+}
+
+func (r apiRunner) upload(objects []syntheticObject, concurrency int) (time.Duration, []sample) {
+	return parallel(objects, concurrency, r.uploadOne)
+}
+
+func (r apiRunner) download(objects []syntheticObject, concurrency int) (time.Duration, []sample) {
+	return parallel(objects, concurrency, r.downloadOne)
+}
+
+func (r apiRunner) uploadOne(obj syntheticObject) sample {
+	start := time.Now()
+	resp, err := r.client.Batch(lfsapi.BatchRequest{Operation: "upload", Transfers: []string{"basic"}, Objects: []lfsapi.Object{obj.object()}})
+	s := sample{latency: time.Since(start)}
+	if err != nil {
+		s.err = err
+		return s
+	}
+	answer, err := single(resp, obj)
+	if err != nil {
+		s.err = err
+		return s
+	}
+
+	upload, ok := answer.Actions["upload"]
+	if !ok {
+		s.skipped = true
+		s.duration = time.Since(start)
+		return s
+	}
+	if err := r.client.Upload(upload, obj.reader(), obj.size); err != nil {
+		s.err = err
+		return s
+	}
+	if verify, ok := answer.Actions["verify"]; ok {
+		if err := r.client.Verify(verify, obj.object()); err != nil {
+			s.err = err
+			return s
+		}
+	}
+	s.bytes = obj.size
+	s.duration = time.Since(start)
+	return s
+}
+
+func (r apiRunner) downloadOne(obj syntheticObject) sample {
+	start := time.Now()
+	resp, err := r.client.Batch(lfsapi.BatchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: []lfsapi.Object{obj.object()}})
+	s := sample{latency: time.Since(start)}
+	if err != nil {
+		s.err = err
+		return s
+	}
+	answer, err := single(resp, obj)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	download, ok := answer.Actions["download"]
+	if !ok {
+		s.err = fmt.Errorf("%s: no download action", obj.oid[:12])
+		return s
+	}
+
+	body, err := r.client.Download(download)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	defer body.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, body)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	if n != obj.size || hex.EncodeToString(hash.Sum(nil)) != obj.oid {
+		s.err = fmt.Errorf("%s: downloaded content does not match", obj.oid[:12])
+		return s
+	}
+	s.bytes = n
+	s.duration = time.Since(start)
+	return s
+}
+
+// single returns the batch response entry of obj, or its error
+func single(resp *lfsapi.BatchResponse, obj syntheticObject) (lfsapi.Object, error) {
+	for _, answer := range resp.Objects {
+		if answer.OID != obj.oid {
+			continue
+		}
+		if answer.Error != nil {
+			return answer, fmt.Errorf("%s: HTTP %d: %s", obj.oid[:12], answer.Error.Code, answer.Error.Message)
+		}
+		return answer, nil
+	}
+	return lfsapi.Object{}, fmt.Errorf("%s: not in batch response", obj.oid[:12])
+}
+
+// parallel runs transfer over objects with concurrency workers and returns
+// the wall time with the samples in object order
+func parallel(objects []syntheticObject, concurrency int, transfer func(syntheticObject) sample) (time.Duration, []sample) {
+	samples := make([]sample, len(objects))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for range min(concurrency, len(objects)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				samples[i] = transfer(objects[i])
+			}
+		}()
+	}
+	for i := range objects {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return time.Since(start), samples
+}
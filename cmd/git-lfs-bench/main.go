@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// runner transfers a set of objects at a concurrency level
+type runner interface {
+	upload(objects []syntheticObject, concurrency int) (time.Duration, []sample)
+	download(objects []syntheticObject, concurrency int) (time.Duration, []sample)
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	endpoint := flag.StringP("endpoint", "e", "", "LFS endpoint to benchmark (default: the endpoint of --remote)")
+	remote := flag.StringP("remote", "r", "origin", "Remote whose LFS endpoint is benchmarked")
+	sizeList := flag.StringP("sizes", "s", "1K,1M,10M", "Comma-separated object sizes")
+	count := flag.IntP("count", "n", 5, "Objects per size and concurrency level")
+	concurrencyList := flag.StringP("concurrency", "c", "1,4", "Comma-separated numbers of parallel transfers")
+	operation := flag.String("operation", "both", "upload, download or both")
+	useGit := flag.Bool("git", false, "Transfer with git lfs push and fetch instead of the Batch API")
+	adapter := flag.String("adapter", "", "With git lfs, use the configured custom transfer agent NAME (implies --git)")
+	anonymous := flag.Bool("anonymous", false, "Do not look up credentials for the endpoint")
+	asJSON := flag.Bool("json", false, "Print the results as JSON")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-bench")
+	completion.Handle(completion.Command{Name: "git-lfs-bench", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	sizes, err := parseSizes(*sizeList)
+	if err != nil {
+		common.PrintError("--sizes: %v", err)
+	}
+	levels, err := parseLevels(*concurrencyList)
+	if err != nil {
+		common.PrintError("--concurrency: %v", err)
+	}
+	if *count <= 0 {
+		common.PrintError("--count must be positive")
+	}
+	doUpload, doDownload := *operation != "download", *operation != "upload"
+	if *operation != "upload" && *operation != "download" && *operation != "both" {
+		common.PrintError("--operation must be upload, download or both")
+	}
+
+	if *endpoint == "" {
+		*endpoint, err = remoteEndpoint(*remote)
+		if err != nil {
+			common.PrintError("%v (or use --endpoint)", err)
+		}
+	}
+
+	var bench runner
+	cleanup := func() {}
+	mode := "Batch API with the basic transfer adapter"
+	if *useGit || *adapter != "" {
+		if err := prereq.Verify(prereq.GitLFS); err != nil {
+			common.PrintError("%v", err)
+		}
+		r, err := newAdapterRunner(*endpoint, *adapter)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		bench, cleanup = r, r.close
+		mode = "git lfs push/fetch"
+		if *adapter != "" {
+			mode += " with transfer agent " + *adapter
+		}
+	} else {
+		bench = apiRunner{client: lfsapi.NewClient(*endpoint, !*anonymous)}
+	}
+
+	fmt.Fprintf(os.Stderr, "Benchmarking %s\n  via %s\n", *endpoint, mode)
+	var results []result
+	for _, size := range sizes {
+		for _, level := range levels {
+			fmt.Fprintf(os.Stderr, "Generating %d objects of %s...\n", *count, common.FormatSize(size))
+			objects, err := generate(*count, size)
+			if err != nil {
+				common.PrintError("%v", err)
+			}
+
+			// Downloads need objects on the server, so a download-only run
+			// still uploads them first without reporting it
+			fmt.Fprintf(os.Stderr, "  upload   ×%d...\n", level)
+			wall, samples := bench.upload(objects, level)
+			if doUpload {
+				results = append(results, summarize("upload", size, level, wall, samples))
+			}
+			if doDownload {
+				fmt.Fprintf(os.Stderr, "  download ×%d...\n", level)
+				wall, samples := bench.download(objects, level)
+				results = append(results, summarize("download", size, level, wall, samples))
+			}
+		}
+	}
+
+	cleanup()
+	printResults(results, *asJSON)
+	fmt.Fprintln(os.Stderr, "\nThe benchmark objects remain on the server; on giftless, git lfs-orphans can remove them.")
+
+	for _, r := range results {
+		if r.Failed > 0 {
+			os.Exit(2)
+		}
+	}
+}
+
+// remoteEndpoint returns the LFS endpoint Git LFS uses for remote
+func remoteEndpoint(remote string) (string, error) {
+	if url := gitConfig("lfs.url"); url != "" {
+		return url, nil
+	}
+	if url := gitConfig("remote." + remote + ".lfsurl"); url != "" {
+		return url, nil
+	}
+	remoteURL := gitConfig("remote." + remote + ".url")
+	if remoteURL == "" {
+		return "", fmt.Errorf("remote '%s' is not configured and no lfs.url is set", remote)
+	}
+	return lfsapi.EndpointForRemote(remoteURL), nil
+}
+
+// gitConfig returns a trimmed git config value, or "" when it is not set
+func gitConfig(key string) string {
+	output, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func parseSizes(list string) ([]int64, error) {
+	var sizes []int64
+	for _, field := range strings.Split(list, ",") {
+		size, err := common.ParseSize(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("sizes must be positive")
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+func parseLevels(list string) ([]int, error) {
+	var levels []int
+	for _, field := range strings.Split(list, ",") {
+		level, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || level <= 0 {
+			return nil, fmt.Errorf("'%s' is not a positive number", field)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-bench - Measure Git LFS transfer performance of a server
+
+		USAGE:
+		  git lfs-bench [OPTIONS]
+
+		OPTIONS:
+		  -e, --endpoint URL       LFS endpoint to benchmark (default: the endpoint of --remote)
+		  -r, --remote NAME        Remote whose LFS endpoint is benchmarked (default: origin)
+		  -s, --sizes LIST         Comma-separated object sizes (default: 1K,1M,10M)
+		  -n, --count N            Objects per size and concurrency level (default: 5)
+		  -c, --concurrency LIST   Comma-separated numbers of parallel transfers (default: 1,4)
+		  --operation OP           upload, download or both (default: both)
+		  --git                    Transfer with git lfs push and fetch instead of the Batch API
+		  --adapter NAME           Use the custom transfer agent configured as
+		                           lfs.customtransfer.NAME (implies --git)
+		  --anonymous              Do not look up credentials for the endpoint
+		  --json                   Print the results as JSON
+		  -h, --help               Show this help message
+		  --version                Show the version, commit and build date
+
+		DESCRIPTION:
+		  Generates random objects of each size, uploads them to the endpoint and
+		  downloads them again, once per concurrency level, and reports:
+
+		    THROUGHPUT  Bytes transferred per second of wall time
+		    LAT P50..   Batch API round trip percentiles
+		    OBJ P95     95th percentile of the time for a whole object, including
+		                the batch request, the transfer and any verify action
+
+		  Followed by how throughput scales with concurrency. Downloaded content is
+		  checked against its SHA-256.
+
+		  By default objects are transferred directly with the Batch API and the
+		  basic transfer adapter, one object per request. With --git or --adapter,
+		  git lfs does the transfers in a scratch repository, so custom agents
+		  (S3, SSH, tracing) are measured the way clients use them; git lfs
+		  schedules those transfers itself, so only throughput is reported.
+
+		  Every object is new random content, so the server cannot skip uploads.
+		  The objects stay on the server; use a dedicated test repository.
+		  The exit status is 2 when any transfer failed.
+
+		EXAMPLES:
+		  # Benchmark the current repository's LFS server
+		  git lfs-bench
+
+		  # Compare giftless with GitHub at higher concurrency
+		  git lfs-bench -e http://giftless.example.com:9876/test/bench -c 1,4,16 --json > giftless.json
+		  git lfs-bench -e https://github.com/myorg/bench.git/info/lfs -c 1,4,16 --json > github.json
+
+		  # Measure an S3 transfer agent configured as lfs.customtransfer.s3
+		  git lfs-bench --adapter s3 -s 100M -n 3
+	`))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// sample is the measurement of one object transfer
+type sample struct {
+	latency  time.Duration // Batch API round trip
+	duration time.Duration // Batch request, transfer and verification
+	bytes    int64
+	skipped  bool // The server already had the object
+	err      error
+}
+
+// result summarizes one operation at one size and concurrency
+type result struct {
+	Operation   string  `json:"operation"` // "upload" or "download"
+	Size        int64   `json:"size"`
+	Concurrency int     `json:"concurrency"`
+	Objects     int     `json:"objects"`
+	Failed      int     `json:"failed"`
+	Skipped     int     `json:"skipped,omitempty"`
+	Bytes       int64   `json:"bytes"`
+	WallSeconds float64 `json:"wall_seconds"`
+	Throughput  float64 `json:"throughput_bytes_per_second"`
+	// Percentiles in milliseconds; absent in adapter mode, which only
+	// measures whole transfers
+	LatencyP50 *float64 `json:"latency_p50_ms,omitempty"`
+	LatencyP95 *float64 `json:"latency_p95_ms,omitempty"`
+	LatencyP99 *float64 `json:"latency_p99_ms,omitempty"`
+	ObjectP50  *float64 `json:"object_p50_ms,omitempty"`
+	ObjectP95  *float64 `json:"object_p95_ms,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// summarize turns the samples of one phase into a result; throughput is the
+// bytes actually transferred over the wall time of the phase
+func summarize(operation string, size int64, concurrency int, wall time.Duration, samples []sample) result {
+	r := result{Operation: operation, Size: size, Concurrency: concurrency, Objects: len(samples), WallSeconds: wall.Seconds()}
+	var latencies, durations []time.Duration
+	for _, s := range samples {
+		switch {
+		case s.err != nil:
+			r.Failed++
+			if len(r.Errors) < 3 {
+				r.Errors = append(r.Errors, s.err.Error())
+			}
+			continue
+		case s.skipped:
+			r.Skipped++
+		}
+		r.Bytes += s.bytes
+		if s.duration > 0 { // Adapter mode only times whole phases
+			latencies = append(latencies, s.latency)
+			durations = append(durations, s.duration)
+		}
+	}
+	if wall > 0 {
+		r.Throughput = float64(r.Bytes) / wall.Seconds()
+	}
+	if len(latencies) > 0 {
+		r.LatencyP50 = percentile(latencies, 50)
+		r.LatencyP95 = percentile(latencies, 95)
+		r.LatencyP99 = percentile(latencies, 99)
+		r.ObjectP50 = percentile(durations, 50)
+		r.ObjectP95 = percentile(durations, 95)
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of values in milliseconds
+func percentile(values []time.Duration, p int) *float64 {
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	ms := float64(sorted[rank-1].Microseconds()) / 1000
+	return &ms
+}
+
+func printResults(results []result, asJSON bool) {
+	if asJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("\n%-9s %9s %5s %8s %12s %10s %10s %10s %10s\n",
+		"OPERATION", "SIZE", "CONC", "OBJECTS", "THROUGHPUT", "LAT P50", "LAT P95", "LAT P99", "OBJ P95")
+	for _, r := range results {
+		objects := fmt.Sprintf("%d", r.Objects-r.Failed)
+		if r.Failed > 0 {
+			objects = fmt.Sprintf("%d/%d", r.Objects-r.Failed, r.Objects)
+		}
+		fmt.Printf("%-9s %9s %5d %8s %10s/s %10s %10s %10s %10s\n",
+			r.Operation, common.FormatSize(r.Size), r.Concurrency, objects,
+			common.FormatSize(int64(r.Throughput)),
+			formatMS(r.LatencyP50), formatMS(r.LatencyP95), formatMS(r.LatencyP99), formatMS(r.ObjectP95))
+	}
+
+	for _, r := range results {
+		if r.Skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Note: %d uploads of %s were skipped because the server already had the object\n",
+				r.Skipped, common.FormatSize(r.Size))
+		}
+		for _, e := range r.Errors {
+			fmt.Fprintf(os.Stderr, "✗ %s %s ×%d: %s\n", r.Operation, common.FormatSize(r.Size), r.Concurrency, e)
+		}
+	}
+	printScaling(results)
+}
+
+// printScaling compares each concurrency level's throughput with the lowest
+// level measured for the same operation and size
+func printScaling(results []result) {
+	base := make(map[string]result)
+	var lines []string
+	for _, r := range results {
+		key := fmt.Sprintf("%s %s", r.Operation, common.FormatSize(r.Size))
+		b, ok := base[key]
+		if !ok {
+			base[key] = r
+			continue
+		}
+		if b.Throughput > 0 {
+			lines = append(lines, fmt.Sprintf("  %-20s ×%d → ×%d: %.2fx throughput", key, b.Concurrency, r.Concurrency, r.Throughput/b.Throughput))
+		}
+	}
+	if len(lines) > 0 {
+		fmt.Println("\nConcurrency scaling:")
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+}
+
+func formatMS(ms *float64) string {
+	if ms == nil {
+		return "-"
+	}
+	if *ms >= 1000 {
+		return fmt.Sprintf("%.2fs", *ms/1000)
+	}
+	return fmt.Sprintf("%.1fms", *ms)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	mathrand "math/rand/v2"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+)
+
+// syntheticObject is random content that is regenerated from its seed
+// whenever it is needed, so even large objects are never held in memory
+type syntheticObject struct {
+	seed [32]byte
+	size int64
+	oid  string
+}
+
+// newSyntheticObject creates an object with a fresh random seed; the server
+// has never seen its content, so uploads are never skipped as duplicates
+func newSyntheticObject(size int64) (syntheticObject, error) {
+	obj := syntheticObject{size: size}
+	if _, err := rand.Read(obj.seed[:]); err != nil {
+		return obj, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, obj.reader()); err != nil {
+		return obj, err
+	}
+	obj.oid = hex.EncodeToString(hash.Sum(nil))
+	return obj, nil
+}
+
+// reader returns the object's content
+func (o syntheticObject) reader() io.Reader {
+	return io.LimitReader(mathrand.NewChaCha8(o.seed), o.size)
+}
+
+func (o syntheticObject) object() lfsapi.Object {
+	return lfsapi.Object{OID: o.oid, Size: o.size}
+}
+
+// generate creates count objects of size
+func generate(count int, size int64) ([]syntheticObject, error) {
+	objects := make([]syntheticObject, count)
+	for i := range objects {
+		obj, err := newSyntheticObject(size)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = obj
+	}
+	return objects, nil
+}
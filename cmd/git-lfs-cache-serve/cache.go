@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// cache stores objects on disk in the layout of Git LFS's own storage
+// (OID[0:2]/OID[2:4]/OID). When it grows beyond maxSize, the least recently
+// used objects are removed.
+type cache struct {
+	dir     string
+	maxSize int64 // 0 is unlimited
+
+	mu       sync.Mutex
+	size     int64
+	objects  int
+	inflight map[string]*fill // Downloads in progress, so each object is fetched once
+
+	hits, misses      atomic.Int64
+	served, retrieved atomic.Int64 // Bytes sent to clients and fetched from upstream
+}
+
+// fill is a download into the cache that concurrent requests wait for
+type fill struct {
+	done chan struct{}
+	err  error
+}
+
+// openCache creates dir if needed and measures what it already holds
+func openCache(dir string, maxSize int64) (*cache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %v", dir, err)
+	}
+	c := &cache{dir: dir, maxSize: maxSize, inflight: make(map[string]*fill)}
+	for _, entry := range c.entries() {
+		c.size += entry.size
+		c.objects++
+	}
+	return c, nil
+}
+
+// open returns the cached object, or nil when it is not cached. A hit
+// counts as a use for eviction.
+func (c *cache) open(oid string, size int64) *os.File {
+	path := lfspointer.ObjectPath(c.dir, oid)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != size {
+		f.Close()
+		return nil
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return f
+}
+
+// fetch stores an object from download in the cache. Concurrent fetches of
+// the same object wait for the first one instead of downloading it again.
+func (c *cache) fetch(oid string, size int64, download func() (io.ReadCloser, error)) error {
+	c.mu.Lock()
+	if f, ok := c.inflight[oid]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.err
+	}
+	f := &fill{done: make(chan struct{})}
+	c.inflight[oid] = f
+	c.mu.Unlock()
+
+	f.err = c.store(oid, size, download)
+
+	c.mu.Lock()
+	delete(c.inflight, oid)
+	c.mu.Unlock()
+	close(f.done)
+	return f.err
+}
+
+// store downloads an object into a temporary file, verifies its size and
+// hash, and moves it into place
+func (c *cache) store(oid string, size int64, download func() (io.ReadCloser, error)) error {
+	body, err := download()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), oid+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", oid, err)
+	}
+	if written != size || hex.EncodeToString(hash.Sum(nil)) != oid {
+		return fmt.Errorf("upstream sent %d bytes that do not match object %s of %d bytes", written, oid, size)
+	}
+
+	path := lfspointer.ObjectPath(c.dir, oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	c.retrieved.Add(size)
+
+	c.mu.Lock()
+	c.size += size
+	c.objects++
+	c.mu.Unlock()
+	c.evict(path)
+	return nil
+}
+
+// cacheEntry is an object file found in the cache
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// entries lists the cached objects, skipping temporary files
+func (c *cache) entries() []cacheEntry {
+	var entries []cacheEntry
+	_ = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path == filepath.Join(c.dir, "tmp") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			entries = append(entries, cacheEntry{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	return entries
+}
+
+// evict removes the least recently used objects until the cache fits in
+// maxSize, sparing the object at keep so it can be served even when it is
+// larger than the whole cache. Clients that have a removed object open keep
+// reading it.
+func (c *cache) evict(keep string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+
+	entries := c.entries()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, entry := range entries {
+		if c.size <= c.maxSize {
+			break
+		}
+		if entry.path != keep && os.Remove(entry.path) == nil {
+			c.size -= entry.size
+			c.objects--
+		}
+	}
+}
+
+// usage returns the number and total size of the cached objects
+func (c *cache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.objects, c.size
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	flag "github.com/spf13/pflag"
+)
+
+const defaultListen = ":8080"
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	upstream := flag.StringP("upstream", "u", "", "Upstream LFS server or endpoint, e.g. https://github.com")
+	listen := flag.StringP("listen", "l", defaultListen, "Address to listen on")
+	cacheDir := flag.StringP("cache-dir", "d", "", "Directory holding cached objects (default: the user cache directory)")
+	maxCacheSize := flag.StringP("max-cache-size", "m", "", "Evict the least recently used objects beyond this size, e.g. 200G")
+	publicURL := flag.String("public-url", "", "URL clients reach this server on (default: taken from each request)")
+	useCredentials := flag.Bool("credentials", false, "Authenticate download batches to upstream with git credential fill when clients send no credentials")
+	tlsCert := flag.String("tls-cert", "", "Serve HTTPS with this PEM certificate (chain)")
+	tlsKey := flag.String("tls-key", "", "PEM private key of --tls-cert")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-cache-serve")
+	completion.Handle(completion.Command{Name: "git-lfs-cache-serve", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if *upstream == "" {
+		printHelp("Error: --upstream must be specified")
+		os.Exit(1)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		common.PrintError("--tls-cert and --tls-key must be given together")
+	}
+	var limit int64
+	if *maxCacheSize != "" {
+		var err error
+		if limit, err = common.ParseSize(*maxCacheSize); err != nil {
+			common.PrintError("--max-cache-size: %v", err)
+		}
+	}
+	if *cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		*cacheDir = filepath.Join(dir, "git-lfs-scripts", "lfs-cache")
+	}
+
+	c, err := openCache(*cacheDir, limit)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	c.evict("")
+	p, err := newProxy(*upstream, *publicURL, lfsapi.NewClient(*upstream, *useCredentials), c)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		common.PrintError("Failed to listen on %s: %v", *listen, err)
+	}
+	objects, size := c.usage()
+	capacity := "unlimited"
+	if limit > 0 {
+		capacity = common.FormatSize(limit)
+	}
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("Caching LFS objects of %s in %s\n", p.upstream, *cacheDir)
+	fmt.Printf("Cache: %d objects, %s of %s\n", objects, common.FormatSize(size), capacity)
+	fmt.Printf("Listening on %s://%s (statistics at %s)\n", scheme, listener.Addr(), statsPath)
+
+	if *tlsCert != "" {
+		err = http.ServeTLS(listener, p, *tlsCert, *tlsKey)
+	} else {
+		err = http.Serve(listener, p)
+	}
+	common.PrintError("Server failed: %v", err)
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-cache-serve - Caching proxy for a Git LFS server
+
+		USAGE:
+		  git lfs-cache-serve --upstream URL [OPTIONS]
+
+		OPTIONS:
+		  -u, --upstream URL         Upstream LFS server or endpoint, e.g. https://github.com
+		  -l, --listen ADDR          Address to listen on (default: :8080)
+		  -d, --cache-dir DIR        Directory holding cached objects
+		                             (default: ~/.cache/git-lfs-scripts/lfs-cache)
+		  -m, --max-cache-size SIZE  Evict the least recently used objects beyond SIZE, e.g. 200G
+		  --public-url URL           URL clients reach this server on, when a load balancer
+		                             or another proxy is in front (default: from each request)
+		  --credentials              Authenticate download batches to upstream with git
+		                             credential fill when clients send no credentials
+		  --tls-cert FILE            Serve HTTPS with this PEM certificate (chain)
+		  --tls-key FILE             PEM private key of --tls-cert
+		  -h, --help                 Show this help message
+		  --version                  Show the version, commit and build date
+
+		DESCRIPTION:
+		  Serves the Git LFS Batch API in front of an upstream LFS server and
+		  keeps downloaded objects on local disk, so a farm of build machines
+		  fetches each object from upstream once instead of once per machine.
+
+		  The path of each request is appended to the upstream URL, so with
+		  --upstream https://github.com one cache serves every repository:
+		  http://cache:8080/myorg/assets.git/info/lfs fronts
+		  https://github.com/myorg/assets.git/info/lfs.
+
+		  Every download batch request is still sent upstream with the client's
+		  credentials, and only objects upstream grants are served, so the
+		  cache never lets a client read an object it could not download
+		  itself. Download actions are replaced by links to this server, valid
+		  for an hour. Concurrent requests for an uncached object wait for a
+		  single download, which is verified against its oid before it is
+		  stored. Uploads, locks and every other request pass through to
+		  upstream unchanged, with the client's own credentials only:
+		  --credentials never authenticates them.
+
+		  The cache uses the layout of Git LFS's own storage. Cache hits and
+		  misses are logged; GET /_cache/stats reports them as JSON.
+
+		EXAMPLES:
+		  # Cache GitHub LFS objects for the build farm, in at most 500G
+		  git lfs-cache-serve -u https://github.com -d /srv/lfs-cache -m 500G --credentials
+
+		  # On each build machine, fetch through the cache
+		  git config lfs.url http://lfs-cache.internal:8080/myorg/assets.git/info/lfs
+
+		  # Front a single endpoint
+		  git lfs-cache-serve -u https://lfs.example.com/team/assets -l :9000
+		  git config lfs.url http://lfs-cache.internal:9000
+	`))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// mediaType is the content type of Git LFS API requests and responses
+const mediaType = "application/vnd.git-lfs+json"
+
+// objectsPath is where the proxy serves cached objects; batch responses
+// point download actions here
+const objectsPath = "/_cache/objects/"
+
+// statsPath reports cache usage and hit rates as JSON
+const statsPath = "/_cache/stats"
+
+// ticketLifetime is how long a rewritten download action stays valid
+const ticketLifetime = time.Hour
+
+// maxBatchBody bounds the size of a batch request read into memory
+const maxBatchBody = 16 << 20
+
+// ticket authorizes one download through the proxy. It is only issued when
+// upstream granted the client a download action for the object, so the
+// cache never serves an object the client could not download itself.
+type ticket struct {
+	oid           string
+	size          int64
+	action        lfsapi.Action // Upstream's action, used on a cache miss
+	authorization string        // The client's credentials for upstream
+	expires       time.Time
+}
+
+// proxy fronts an upstream LFS server: batch requests are forwarded, and
+// download actions are rewritten to be served from the cache
+type proxy struct {
+	upstream  *url.URL
+	publicURL string         // Base URL clients reach the proxy on; derived from each request when empty
+	client    *lfsapi.Client // Downloads from upstream, with --credentials when set
+	cache     *cache
+	reverse   *httputil.ReverseProxy
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+func newProxy(upstream, publicURL string, client *lfsapi.Client, c *cache) (*proxy, error) {
+	u, err := url.Parse(strings.TrimSuffix(upstream, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL '%s'", upstream)
+	}
+	p := &proxy{
+		upstream:  u,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    client,
+		cache:     c,
+		tickets:   make(map[string]ticket),
+	}
+	// Everything but download batches (uploads, locks) passes through
+	// unchanged, with the client's credentials only: the proxy's own would
+	// let anyone reaching the listen address write upstream
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(u)
+			r.Out.Host = u.Host
+		},
+		FlushInterval: -1,
+	}
+	return p, nil
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, objectsPath) && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		p.serveObject(w, r, strings.TrimPrefix(r.URL.Path, objectsPath))
+	case r.URL.Path == statsPath:
+		p.serveStats(w)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/objects/batch"):
+		p.batch(w, r)
+	default:
+		p.reverse.ServeHTTP(w, r)
+	}
+}
+
+// authorize sends the proxy's own upstream credentials when the client
+// brings none. Only download batches get them; the ticketed downloads
+// reuse what their batch was granted with.
+func (p *proxy) authorize(req *http.Request) {
+	p.client.Authorize(req)
+}
+
+// batch forwards a batch request upstream. Download actions in the response
+// are replaced by tickets for the proxy; anything else is returned as is.
+func (p *proxy) batch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBatchBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req lfsapi.BatchRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Operation != "download" {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		p.reverse.ServeHTTP(w, r)
+		return
+	}
+
+	upstreamReq, err := http.NewRequest(http.MethodPost, p.upstream.String()+r.URL.Path, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, key := range []string{"Accept", "Content-Type", "Authorization", "User-Agent"} {
+		if value := r.Header.Get(key); value != "" {
+			upstreamReq.Header.Set(key, value)
+		}
+	}
+	p.authorize(upstreamReq)
+	resp, err := (&http.Client{Timeout: 60 * time.Second}).Do(upstreamReq)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("upstream batch request failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("upstream batch request failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	var batch lfsapi.BatchResponse
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(data, &batch) != nil ||
+		(batch.Transfer != "" && batch.Transfer != "basic") {
+		// Authentication challenges and errors reach the client untouched
+		for _, key := range []string{"Content-Type", "WWW-Authenticate", "LFS-Authenticate"} {
+			if value := resp.Header.Get(key); value != "" {
+				w.Header().Set(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		w.Write(data)
+		return
+	}
+
+	base := p.baseURL(r)
+	for i, obj := range batch.Objects {
+		action, ok := obj.Actions["download"]
+		if !ok || obj.Error != nil || !lfspointer.ValidOID(obj.OID) {
+			continue
+		}
+		t := p.issue(ticket{
+			oid:           obj.OID,
+			size:          obj.Size,
+			action:        action,
+			authorization: upstreamReq.Header.Get("Authorization"),
+			expires:       time.Now().Add(ticketLifetime),
+		})
+		batch.Objects[i].Actions = map[string]lfsapi.Action{"download": {
+			Href:      base + objectsPath + obj.OID + "?ticket=" + t,
+			ExpiresIn: int(ticketLifetime.Seconds()),
+		}}
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	json.NewEncoder(w).Encode(batch)
+}
+
+// baseURL returns the URL clients reach the proxy on
+func (p *proxy) baseURL(r *http.Request) string {
+	if p.publicURL != "" {
+		return p.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + r.Host
+}
+
+// issue stores a ticket under a random name, dropping expired ones
+func (p *proxy) issue(t ticket) string {
+	name := make([]byte, 16)
+	rand.Read(name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for key, existing := range p.tickets {
+		if now.After(existing.expires) {
+			delete(p.tickets, key)
+		}
+	}
+	key := hex.EncodeToString(name)
+	p.tickets[key] = t
+	return key
+}
+
+func (p *proxy) lookup(name, oid string) (ticket, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tickets[name]
+	return t, ok && t.oid == oid && time.Now().Before(t.expires)
+}
+
+// serveObject sends an object from the cache, downloading it from upstream
+// first on a miss
+func (p *proxy) serveObject(w http.ResponseWriter, r *http.Request, oid string) {
+	t, ok := p.lookup(r.URL.Query().Get("ticket"), oid)
+	if !ok {
+		http.Error(w, "unknown or expired download ticket; repeat the batch request", http.StatusForbidden)
+		return
+	}
+
+	f := p.cache.open(oid, t.size)
+	status := "HIT "
+	if f == nil {
+		status = "MISS"
+		err := p.cache.fetch(oid, t.size, func() (io.ReadCloser, error) {
+			return p.client.Download(p.upstreamAction(t))
+		})
+		if err != nil {
+			log.Printf("FAIL %s %s: %v", oid, common.FormatSize(t.size), err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if f = p.cache.open(oid, t.size); f == nil {
+			http.Error(w, "object was evicted before it could be served; increase --max-cache-size", http.StatusServiceUnavailable)
+			return
+		}
+		p.cache.misses.Add(1)
+	} else {
+		p.cache.hits.Add(1)
+	}
+	defer f.Close()
+
+	log.Printf("%s %s %s to %s", status, oid, common.FormatSize(t.size), r.RemoteAddr)
+	if r.Method == http.MethodGet {
+		p.cache.served.Add(t.size)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// upstreamAction returns the action to download a ticket's object with,
+// adding the client's credentials when upstream expects them on its own host
+func (p *proxy) upstreamAction(t ticket) lfsapi.Action {
+	action := lfsapi.Action{Href: t.action.Href, Header: make(map[string]string)}
+	for key, value := range t.action.Header {
+		action.Header[key] = value
+	}
+	href, err := url.Parse(action.Href)
+	_, hasAuth := action.Header["Authorization"]
+	if !hasAuth && t.authorization != "" && err == nil && href.Scheme == p.upstream.Scheme && href.Host == p.upstream.Host {
+		action.Header["Authorization"] = t.authorization
+	}
+	return action
+}
+
+// stats is the JSON report of statsPath
+type stats struct {
+	Objects        int   `json:"objects"`
+	Bytes          int64 `json:"bytes"`
+	MaxBytes       int64 `json:"max_bytes"`
+	Hits           int64 `json:"hits"`
+	Misses         int64 `json:"misses"`
+	ServedBytes    int64 `json:"served_bytes"`
+	RetrievedBytes int64 `json:"retrieved_bytes"` // Fetched from upstream
+}
+
+func (p *proxy) serveStats(w http.ResponseWriter) {
+	objects, size := p.cache.usage()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats{
+		Objects:        objects,
+		Bytes:          size,
+		MaxBytes:       p.cache.maxSize,
+		Hits:           p.cache.hits.Load(),
+		Misses:         p.cache.misses.Load(),
+		ServedBytes:    p.cache.served.Load(),
+		RetrievedBytes: p.cache.retrieved.Load(),
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// cacheKey returns prefix followed by a hash of the distinct oids of the
+// pointers, so the key changes exactly when the set of objects does
+func cacheKey(prefix string, pointers []lfspointer.Pointer) string {
+	seen := make(map[string]bool)
+	var oids []string
+	for _, pointer := range pointers {
+		if !seen[pointer.OID] {
+			seen[pointer.OID] = true
+			oids = append(oids, pointer.OID)
+		}
+	}
+	sort.Strings(oids)
+
+	hash := sha256.New()
+	for _, oid := range oids {
+		hash.Write([]byte(oid + "\n"))
+	}
+	return prefix + hex.EncodeToString(hash.Sum(nil))[:32]
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	includes := flag.StringSliceP("include", "I", nil, "Only fetch LFS files matching these patterns (repeatable or comma-separated)")
+	excludes := flag.StringSliceP("exclude", "X", nil, "Do not fetch LFS files matching these patterns (repeatable or comma-separated)")
+	concurrency := flag.IntP("concurrency", "j", 8, "Number of concurrent LFS transfers")
+	keyOnly := flag.Bool("key-only", false, "Print the cache key and the directory to cache, without changing anything")
+	keyPrefix := flag.String("key-prefix", "lfs-", "Prefix of the cache key")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-ci-prepare")
+	completion.Handle(completion.Command{Name: "git-lfs-ci-prepare", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+	}
+	if *concurrency < 1 {
+		printHelp("--concurrency must be at least 1")
+	}
+
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	pointers, err := lfspointer.ListTree("HEAD")
+	if err != nil {
+		common.PrintError("Failed to list the LFS files of HEAD: %v", err)
+	}
+	selected := lfsfiles.SelectPointers(pointers, *includes, *excludes)
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	key := cacheKey(*keyPrefix, selected)
+
+	if *keyOnly {
+		fmt.Printf("Cache key:  %s\n", key)
+		fmt.Printf("Cache path: %s\n", storage)
+		writeOutputs(key, storage)
+		return
+	}
+
+	// Checkouts and later git commands must not download every LFS file
+	fmt.Println("Disabling the automatic download of LFS files on checkout...")
+	if err := common.RunCommand("git", "lfs", "install", "--local", "--skip-smudge"); err != nil {
+		common.PrintError("git lfs install --skip-smudge failed: %v", err)
+	}
+	os.Setenv("GIT_LFS_SKIP_SMUDGE", "1")
+	if err := exportSkipSmudge(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	fmt.Printf("\nFetching %d of %d LFS files (%s), %d transfers at a time...\n",
+		len(selected), len(pointers), common.FormatSize(lfspointer.TotalSize(selected)), *concurrency)
+	if len(selected) > 0 {
+		args := []string{"-c", fmt.Sprintf("lfs.concurrenttransfers=%d", *concurrency), "lfs", "pull"}
+		if len(*includes) > 0 {
+			args = append(args, "--include="+strings.Join(*includes, ","))
+		}
+		if len(*excludes) > 0 {
+			args = append(args, "--exclude="+strings.Join(*excludes, ","))
+		}
+		if err := common.RunCommand("git", args...); err != nil {
+			common.PrintError("git lfs pull failed: %v", err)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Cache key:  %s\n", key)
+	fmt.Printf("Cache path: %s\n", storage)
+	writeOutputs(key, storage)
+	fmt.Println("\n✓ LFS files ready")
+}
+
+// exportSkipSmudge keeps GIT_LFS_SKIP_SMUDGE set for the later steps of a
+// GitHub Actions job; other CI systems are shown the line to add
+func exportSkipSmudge() error {
+	if path := os.Getenv("GITHUB_ENV"); path != "" {
+		if common.DryRun {
+			fmt.Printf("DRY RUN: append GIT_LFS_SKIP_SMUDGE=1 to %s\n", path)
+			return nil
+		}
+		return appendLines(path, "GIT_LFS_SKIP_SMUDGE=1")
+	}
+	fmt.Println("  Set GIT_LFS_SKIP_SMUDGE=1 in the environment of later steps that check out")
+	return nil
+}
+
+// writeOutputs makes the cache key and path step outputs of a GitHub
+// Actions job, for actions/cache
+func writeOutputs(key, storage string) {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return
+	}
+	if common.DryRun {
+		fmt.Printf("DRY RUN: append cache-key and cache-path to %s\n", path)
+		return
+	}
+	if err := appendLines(path, "cache-key="+key, "cache-path="+storage); err != nil {
+		common.PrintError("%v", err)
+	}
+}
+
+// appendLines appends lines to a file of the CI runner
+func appendLines(path string, lines ...string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	}
+	fmt.Print(dedent.Dedent(`
+		git-lfs-ci-prepare - Fetch only the Git LFS files a CI build needs
+
+		USAGE:
+		  git lfs-ci-prepare [OPTIONS]
+
+		OPTIONS:
+		  -I, --include PATTERN  Only fetch LFS files matching PATTERN; repeat or
+		                         separate with commas (default: every LFS file)
+		  -X, --exclude PATTERN  Do not fetch LFS files matching PATTERN
+		  -j, --concurrency N    Number of concurrent LFS transfers (default: 8)
+		  --key-only             Print the cache key and the directory to cache,
+		                         without changing anything
+		  --key-prefix PREFIX    Prefix of the cache key (default: lfs-)
+		  -d, --dry-run          Show what would be done without doing it
+		  --trace                Print every external command before running it
+		  -h, --help             Show this help message
+		  --version              Show the version, commit and build date
+
+		DESCRIPTION:
+		  Run this in a CI job right after checking out the repository. It:
+
+		    1. Runs 'git lfs install --local --skip-smudge', so later checkouts
+		       leave LFS files as pointers, and sets GIT_LFS_SKIP_SMUDGE=1 for
+		       the following steps of a GitHub Actions job
+		    2. Runs 'git lfs pull' for the LFS files of HEAD matching --include
+		       and not --exclude, with lfs.concurrenttransfers set to N
+		    3. Prints a cache key and the local LFS object directory
+
+		  Patterns are those of 'git lfs fetch --include': globs, or directories
+		  standing for everything below them.
+
+		  The cache key is a hash of the oids of the selected LFS files, so it
+		  changes exactly when they do. Restore the object directory from the
+		  cache before pulling and only the missing objects are downloaded. In
+		  GitHub Actions the key and directory also become the step outputs
+		  cache-key and cache-path. Compute the key before restoring the cache
+		  with --key-only.
+
+		EXAMPLES:
+		  # Fetch only the textures and models the build needs
+		  git lfs-ci-prepare -I 'assets/textures/**' -I 'assets/models/**'
+
+		  # Everything except raw footage, 16 transfers at a time
+		  git lfs-ci-prepare -X 'footage/raw' -j 16
+
+		  # GitHub Actions: restore the LFS cache, then fetch
+		  - id: lfs
+		    run: git lfs-ci-prepare --key-only -I 'assets/**'
+		  - uses: actions/cache@v4
+		    with:
+		      key: ${{ steps.lfs.outputs.cache-key }}
+		      path: ${{ steps.lfs.outputs.cache-path }}
+		  - run: git lfs-ci-prepare -I 'assets/**'
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+// file is an added, removed or changed file in the JSON report
+type file struct {
+	Path string `json:"path"`
+	OID  string `json:"oid,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	From *side  `json:"from,omitempty"`
+	To   *side  `json:"to,omitempty"`
+}
+
+type side struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// report is the JSON form of a comparison
+type report struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Added         []file `json:"added"`
+	Removed       []file `json:"removed"`
+	Changed       []file `json:"changed"`
+	Unchanged     int    `json:"unchanged"`
+	TransferCount int    `json:"transfer_objects"`
+	TransferBytes int64  `json:"transfer_bytes"`
+	CachedCount   int    `json:"cached_objects"` // Transfer objects already in local LFS storage
+	CachedBytes   int64  `json:"cached_bytes"`
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	summary := flag.BoolP("summary", "s", false, "Only print the totals, not each file")
+	asJSON := flag.Bool("json", false, "Print the comparison as JSON")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-compare")
+	completion.Handle(completion.Command{Name: "git-lfs-compare", Flags: flag.CommandLine, Args: completion.ArgDirectory})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() != 2 {
+		printHelp("Error: Exactly two refs or checkouts must be specified")
+		os.Exit(1)
+	}
+
+	fromName, toName := flag.Arg(0), flag.Arg(1)
+	from, err := pointersOf(fromName)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	to, err := pointersOf(toName)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	c := lfspointer.Compare(from, to)
+	cached := cachedObjects(c.Transfer)
+
+	if *asJSON {
+		printJSON(fromName, toName, c, cached)
+		return
+	}
+
+	fmt.Printf("Comparing LFS files of %s (%d) and %s (%d)\n", fromName, len(from), toName, len(to))
+	if !*summary {
+		printChanges(c)
+	}
+	fmt.Printf("\nAdded: %d, removed: %d, changed: %d, unchanged: %d\n",
+		len(c.Added), len(c.Removed), len(c.Changed), c.Unchanged)
+	fmt.Printf("Transfer to switch from %s to %s: %d objects, %s\n",
+		fromName, toName, len(c.Transfer), common.FormatSize(lfspointer.TotalSize(c.Transfer)))
+	if len(cached) > 0 {
+		fmt.Printf("  of which already in local LFS storage: %d objects, %s\n",
+			len(cached), common.FormatSize(lfspointer.TotalSize(cached)))
+	}
+}
+
+// pointersOf returns the pointer files of a ref in the current repository,
+// or of the HEAD commit of a checkout. Explicit paths are always checkouts;
+// anything else is a ref if it names a tree.
+func pointersOf(operand string) ([]lfspointer.Pointer, error) {
+	if !looksLikePath(operand) && common.CheckGitRepo() == nil {
+		if err := exec.Command("git", "rev-parse", "--verify", "--quiet", operand+"^{tree}").Run(); err == nil {
+			return lfspointer.ListTree(operand)
+		}
+	}
+	if info, err := os.Stat(operand); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("'%s' is neither a ref nor a directory", operand)
+	}
+	if err := exec.Command("git", "-C", operand, "rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+		return nil, fmt.Errorf("'%s' is not a checkout with any commits", operand)
+	}
+	return lfspointer.ListTreeIn(operand, "HEAD")
+}
+
+// looksLikePath tells whether an operand can only be a directory; refs such
+// as release/2.0 contain slashes too, so only explicit paths qualify
+func looksLikePath(operand string) bool {
+	return operand == "." || operand == ".." || filepath.IsAbs(operand) ||
+		strings.HasPrefix(operand, "./") || strings.HasPrefix(operand, "../")
+}
+
+// cachedObjects returns the objects to transfer that are already in the
+// current repository's local LFS storage, so switching needs no download
+func cachedObjects(transfer []lfspointer.Pointer) []lfspointer.Pointer {
+	if len(transfer) == 0 || common.CheckGitRepo() != nil {
+		return nil
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		return nil
+	}
+	var cached []lfspointer.Pointer
+	for _, p := range transfer {
+		if info, err := os.Stat(lfspointer.ObjectPath(storage, p.OID)); err == nil && info.Size() == p.Size {
+			cached = append(cached, p)
+		}
+	}
+	return cached
+}
+
+func printChanges(c lfspointer.Comparison) {
+	if len(c.Added)+len(c.Removed)+len(c.Changed) == 0 {
+		fmt.Println("\nNo LFS files differ")
+		return
+	}
+	fmt.Println()
+	for _, change := range c.Added {
+		fmt.Printf("  A  %s  (%s)\n", change.Path, common.FormatSize(change.To.Size))
+	}
+	for _, change := range c.Removed {
+		fmt.Printf("  D  %s  (%s)\n", change.Path, common.FormatSize(change.From.Size))
+	}
+	for _, change := range c.Changed {
+		fmt.Printf("  M  %s  (%s → %s)\n", change.Path,
+			common.FormatSize(change.From.Size), common.FormatSize(change.To.Size))
+	}
+}
+
+func printJSON(fromName, toName string, c lfspointer.Comparison, cached []lfspointer.Pointer) {
+	r := report{
+		From:          fromName,
+		To:            toName,
+		Added:         []file{},
+		Removed:       []file{},
+		Changed:       []file{},
+		Unchanged:     c.Unchanged,
+		TransferCount: len(c.Transfer),
+		TransferBytes: lfspointer.TotalSize(c.Transfer),
+		CachedCount:   len(cached),
+		CachedBytes:   lfspointer.TotalSize(cached),
+	}
+	for _, change := range c.Added {
+		r.Added = append(r.Added, file{Path: change.Path, OID: change.To.OID, Size: change.To.Size})
+	}
+	for _, change := range c.Removed {
+		r.Removed = append(r.Removed, file{Path: change.Path, OID: change.From.OID, Size: change.From.Size})
+	}
+	for _, change := range c.Changed {
+		r.Changed = append(r.Changed, file{
+			Path: change.Path,
+			From: &side{OID: change.From.OID, Size: change.From.Size},
+			To:   &side{OID: change.To.OID, Size: change.To.Size},
+		})
+	}
+	data, _ := json.MarshalIndent(r, "", "  ")
+	fmt.Println(string(data))
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-compare - Compare the LFS files of two refs or checkouts
+
+		USAGE:
+		  git lfs-compare [OPTIONS] FROM TO
+
+		OPTIONS:
+		  -s, --summary        Only print the totals, not each file
+		  --json               Print the comparison as JSON
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Compares the LFS pointer files of FROM and TO by path, oid and size,
+		  and lists the files that were added (A), removed (D) and changed (M).
+
+		  FROM and TO are branches, tags or commits of the current repository,
+		  or directories of other checkouts, whose HEAD commit is compared. An
+		  operand that names a ref is a ref; use ./NAME for a directory that
+		  has the name of a ref.
+
+		  The transfer is every object TO references that FROM does not, each
+		  counted once: what checking out TO after FROM downloads. Objects that
+		  are already in this repository's local LFS storage are reported too,
+		  as they need no download.
+
+		EXAMPLES:
+		  # What does checking out the release branch in CI cost?
+		  git lfs-compare main release/2.0
+
+		  # Only the totals, between two tags
+		  git lfs-compare -s v1.0 v2.0
+
+		  # Compare two clones
+		  git lfs-compare ~/work/assets /mnt/ci/assets
+
+		  # Feed the comparison to another tool
+		  git lfs-compare --json main feature/textures > compare.json
+	`))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	allRefs := flag.BoolP("all", "a", false, "Measure objects referenced by all branches and tags, not just HEAD")
+	storage := flag.String("storage", "", "Use this storage size instead of measuring the repository")
+	egress := flag.String("egress", "", "Use this monthly bandwidth instead of estimating it")
+	days := flag.Int("days", 30, "Number of days of history used to measure recent growth")
+	clones := flag.Int("clones", 2, "Full clones per month (CI runners, new machines)")
+	team := flag.Int("team", 5, "Developers pulling newly added objects")
+	pricingPath := flag.String("pricing", "", "JSON file overriding or adding pricing options")
+	printPricing := flag.Bool("print-pricing", false, "Print the built-in pricing table as JSON and exit")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-cost")
+	completion.Handle(completion.Command{Name: "git-lfs-cost", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	if *printPricing {
+		data, _ := json.MarshalIndent(pricingFile{Options: builtinPricing}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	if *days <= 0 {
+		common.PrintError("--days must be positive")
+	}
+
+	options, err := loadPricing(*pricingPath)
+	if err != nil {
+		common.PrintError("Failed to load pricing: %v", err)
+	}
+
+	var storageBytes, egressBytes int64
+	if *storage != "" {
+		if storageBytes, err = common.ParseSize(*storage); err != nil {
+			common.PrintError("--storage: %v", err)
+		}
+	}
+	if *egress != "" {
+		if egressBytes, err = common.ParseSize(*egress); err != nil {
+			common.PrintError("--egress: %v", err)
+		}
+	}
+
+	fmt.Println("LFS usage:")
+	if *storage == "" || *egress == "" {
+		if err := common.CheckGitRepo(); err != nil {
+			common.PrintError("%v", err)
+		}
+
+		refs := []string{"HEAD"}
+		if *allRefs {
+			if refs, err = lfspointer.AllRefs(); err != nil {
+				common.PrintError("%v", err)
+			}
+		}
+
+		if *storage == "" {
+			pointers, err := lfspointer.ListRefs(refs)
+			if err != nil {
+				common.PrintError("Failed to list LFS objects: %v", err)
+			}
+			storageBytes = lfspointer.TotalSize(pointers)
+			fmt.Printf("  Storage:              %s (%d objects)\n", common.FormatSize(storageBytes), len(pointers))
+		}
+
+		if *egress == "" {
+			added, err := lfspointer.Added(fmt.Sprintf("%d days ago", *days), refs)
+			if err != nil {
+				common.PrintError("Failed to measure recent LFS objects: %v", err)
+			}
+			addedBytes := lfspointer.TotalSize(added)
+			monthlyGrowth := addedBytes * 30 / int64(*days)
+			egressBytes = int64(*clones)*storageBytes + int64(*team)*monthlyGrowth
+			fmt.Printf("  Added in %d days:     %s (%d objects)\n", *days, common.FormatSize(addedBytes), len(added))
+			fmt.Printf("  Monthly bandwidth:    %s (%d clones x storage + %d developers x new objects)\n",
+				common.FormatSize(egressBytes), *clones, *team)
+		}
+	}
+	if *storage != "" {
+		fmt.Printf("  Storage:              %s (from --storage)\n", common.FormatSize(storageBytes))
+	}
+	if *egress != "" {
+		fmt.Printf("  Monthly bandwidth:    %s (from --egress)\n", common.FormatSize(egressBytes))
+	}
+
+	type row struct {
+		option   pricing
+		estimate estimate
+	}
+	rows := make([]row, 0, len(options))
+	for _, option := range options {
+		rows = append(rows, row{option, estimateCost(option, storageBytes, egressBytes)})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].estimate.total < rows[j].estimate.total
+	})
+
+	fmt.Println()
+	fmt.Println("Estimated monthly cost (USD):")
+	for _, r := range rows {
+		fmt.Printf("  %-32s %9.2f   %s\n", r.option.Name, r.estimate.total, r.estimate.detail)
+		if r.option.Notes != "" {
+			fmt.Printf("  %-32s             %s\n", "", r.option.Notes)
+		}
+	}
+	fmt.Println()
+	fmt.Println("Prices are approximate list prices; use --pricing to supply current rates.")
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-cost - Estimate the monthly cost of hosting a repository's Git LFS objects
+
+		USAGE:
+		  git lfs-cost [OPTIONS]
+
+		OPTIONS:
+		  -a, --all            Measure objects referenced by all branches and tags, not just HEAD
+		  --storage SIZE       Use SIZE as the storage instead of measuring the repository
+		  --egress SIZE        Use SIZE as the monthly bandwidth instead of estimating it
+		  --days N             Days of history used to measure recent growth (default: 30)
+		  --clones N           Full clones per month, e.g. CI runners (default: 2)
+		  --team N             Developers pulling newly added objects (default: 5)
+		  --pricing FILE       JSON file overriding or adding pricing options
+		  --print-pricing      Print the built-in pricing table as JSON and exit
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Storage is the total size of the distinct LFS objects referenced by HEAD
+		  (or every branch and tag with --all), read from the pointer files, so the
+		  objects themselves do not need to be downloaded.
+
+		  Monthly bandwidth is estimated as the number of full clones times the
+		  storage, plus the objects added during the last --days days (scaled to a
+		  month) times the number of developers fetching them.
+
+		  The estimate is priced against GitHub data packs, AWS S3, Azure Blob
+		  Storage and Google Cloud Storage, cheapest first. Built-in prices are
+		  approximate and change over time; save the output of --print-pricing,
+		  edit it and pass it back with --pricing. Options in the file replace
+		  built-in options with the same name, and options with new names are
+		  added. Sizes accept K, M, G and T suffixes.
+
+		EXAMPLES:
+		  # Estimate costs for the current branch
+		  git lfs-cost
+
+		  # Include every branch and tag, with a busier CI
+		  git lfs-cost --all --clones 50
+
+		  # Price a hypothetical repository
+		  git lfs-cost --storage 200G --egress 1T
+
+		  # Use your negotiated rates
+		  git lfs-cost --print-pricing > pricing.json
+		  git lfs-cost --pricing pricing.json
+	`))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// bytesPerGB converts byte counts to the GiB units used by hosting price lists
+const bytesPerGB = 1024 * 1024 * 1024
+
+// pricing describes how one hosting option bills LFS storage and bandwidth.
+// Options either bill per GB (StoragePerGB, EgressPerGB) or sell data packs
+// (PackPrice buys PackStorageGB of storage and PackBandwidthGB of bandwidth).
+type pricing struct {
+	Name            string  `json:"name"`
+	StoragePerGB    float64 `json:"storage_per_gb,omitempty"`
+	EgressPerGB     float64 `json:"egress_per_gb,omitempty"`
+	FreeStorageGB   float64 `json:"free_storage_gb,omitempty"`
+	FreeEgressGB    float64 `json:"free_egress_gb,omitempty"`
+	PackPrice       float64 `json:"pack_price,omitempty"`
+	PackStorageGB   float64 `json:"pack_storage_gb,omitempty"`
+	PackBandwidthGB float64 `json:"pack_bandwidth_gb,omitempty"`
+	Notes           string  `json:"notes,omitempty"`
+}
+
+// pricingFile is the format of the --pricing file
+type pricingFile struct {
+	Options []pricing `json:"options"`
+}
+
+// builtinPricing holds approximate list prices in USD per month. They change
+// over time, so --pricing can override them.
+var builtinPricing = []pricing{
+	{
+		Name:            "GitHub data packs",
+		FreeStorageGB:   1,
+		FreeEgressGB:    1,
+		PackPrice:       5,
+		PackStorageGB:   50,
+		PackBandwidthGB: 50,
+		Notes:           "$5 per 50 GB storage + 50 GB bandwidth",
+	},
+	{
+		Name:         "AWS S3 Standard",
+		StoragePerGB: 0.023,
+		EgressPerGB:  0.09,
+		FreeEgressGB: 100,
+		Notes:        "us-east-1, excludes request charges",
+	},
+	{
+		Name:         "Azure Blob Hot (LRS)",
+		StoragePerGB: 0.0184,
+		EgressPerGB:  0.087,
+		FreeEgressGB: 100,
+		Notes:        "East US, excludes operation charges",
+	},
+	{
+		Name:         "Google Cloud Storage Standard",
+		StoragePerGB: 0.020,
+		EgressPerGB:  0.12,
+		Notes:        "us-central1, premium network tier",
+	},
+}
+
+// loadPricing returns the built-in pricing merged with the options in path.
+// Options in the file replace built-in options with the same name; other
+// options are added.
+func loadPricing(path string) ([]pricing, error) {
+	options := append([]pricing(nil), builtinPricing...)
+	if path == "" {
+		return options, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file pricingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid pricing file %s: %v", path, err)
+	}
+
+	for _, override := range file.Options {
+		if override.Name == "" {
+			return nil, fmt.Errorf("invalid pricing file %s: every option needs a name", path)
+		}
+		if override.PackPrice > 0 && (override.PackStorageGB <= 0 || override.PackBandwidthGB <= 0) {
+			return nil, fmt.Errorf("invalid pricing file %s: %s needs pack_storage_gb and pack_bandwidth_gb", path, override.Name)
+		}
+		replaced := false
+		for i := range options {
+			if options[i].Name == override.Name {
+				options[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			options = append(options, override)
+		}
+	}
+	return options, nil
+}
+
+// estimate is the monthly cost of one hosting option
+type estimate struct {
+	storage float64
+	egress  float64
+	total   float64
+	detail  string
+}
+
+// estimateCost computes the monthly cost of storing storageBytes and serving
+// egressBytes with the given pricing
+func estimateCost(p pricing, storageBytes, egressBytes int64) estimate {
+	storageGB := float64(storageBytes) / bytesPerGB
+	egressGB := float64(egressBytes) / bytesPerGB
+
+	if p.PackPrice > 0 {
+		storagePacks := math.Ceil(math.Max(0, storageGB-p.FreeStorageGB) / p.PackStorageGB)
+		bandwidthPacks := math.Ceil(math.Max(0, egressGB-p.FreeEgressGB) / p.PackBandwidthGB)
+		packs := math.Max(storagePacks, bandwidthPacks)
+		return estimate{
+			total:  packs * p.PackPrice,
+			detail: fmt.Sprintf("%d data pack(s)", int(packs)),
+		}
+	}
+
+	e := estimate{
+		storage: math.Max(0, storageGB-p.FreeStorageGB) * p.StoragePerGB,
+		egress:  math.Max(0, egressGB-p.FreeEgressGB) * p.EgressPerGB,
+	}
+	e.total = e.storage + e.egress
+	e.detail = fmt.Sprintf("storage $%.2f + egress $%.2f", e.storage, e.egress)
+	return e
+}
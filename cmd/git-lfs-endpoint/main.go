@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	// Everything after the subcommand belongs to it, so only leading
+	// options are parsed here
+	flag.CommandLine.SetInterspersed(false)
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	file := flag.StringP("file", "f", "", "Profiles file (default: lfs-scripts.endpoints, or ~/.config/git-lfs-scripts/endpoints)")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-endpoint")
+	completion.Handle(completion.Command{
+		Name:        "git-lfs-endpoint",
+		Flags:       flag.CommandLine,
+		Subcommands: []string{"list", "add", "remove", "use", "show", "diff"},
+	})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		printHelp("Error: A subcommand must be specified")
+		os.Exit(1)
+	}
+
+	path, err := profilesFile(*file)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "list":
+		runList(path)
+	case "add":
+		runAdd(path, args)
+	case "remove":
+		runRemove(path, args)
+	case "use":
+		runUse(path, args)
+	case "show":
+		runShow(path, args)
+	case "diff":
+		runDiff(path, args)
+	default:
+		printHelp(fmt.Sprintf("Error: Unknown subcommand '%s'", flag.Arg(0)))
+		os.Exit(1)
+	}
+}
+
+func loadProfiles(path string) []profile {
+	profiles, err := readProfiles(path)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	return profiles
+}
+
+// profileArg returns the single profile name of a subcommand
+func profileArg(flags *flag.FlagSet, usage string) string {
+	if flags.NArg() != 1 {
+		common.PrintError("Usage: git lfs-endpoint %s", usage)
+	}
+	return flags.Arg(0)
+}
+
+func runList(path string) {
+	profiles := loadProfiles(path)
+	if len(profiles) == 0 {
+		fmt.Printf("No profiles in %s; add one with 'git lfs-endpoint add'\n", path)
+		return
+	}
+	current := ""
+	if common.CheckGitRepo() == nil {
+		current, _ = gitOutput("config", currentKey)
+	}
+	for _, p := range profiles {
+		marker := " "
+		if p.name == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %-15s %s\n", marker, p.name, p.url)
+	}
+}
+
+func runAdd(path string, args []string) {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	var p profile
+	flags.StringVar(&p.url, "url", "", "LFS endpoint URL")
+	flags.StringVar(&p.auth, "auth", "", "Authentication: basic or negotiate (lfs.<url>.access)")
+	flags.StringVar(&p.transfer, "transfer", "", "Standalone transfer agent (lfs.standalonetransferagent)")
+	flags.StringVar(&p.transferPath, "transfer-path", "", "Program implementing the transfer agent")
+	flags.IntVar(&p.concurrentTransfers, "concurrent-transfers", 0, "Value of lfs.concurrenttransfers")
+	flags.Parse(args)
+
+	p.name = profileArg(flags, "add NAME --url URL [OPTIONS]")
+	if err := p.validate(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := saveProfile(path, p); err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("✓ Saved profile '%s' in %s\n", p.name, path)
+}
+
+func runRemove(path string, args []string) {
+	flags := flag.NewFlagSet("remove", flag.ExitOnError)
+	flags.Parse(args)
+
+	name := profileArg(flags, "remove NAME")
+	if _, err := findProfile(loadProfiles(path), name); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := deleteProfile(path, name); err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("✓ Removed profile '%s' from %s\n", name, path)
+}
+
+// planSwitch returns the repository and the changes that switch it to the
+// profile called name
+func planSwitch(path, name string, local bool) (*repository, profile, []change) {
+	profiles := loadProfiles(path)
+	p, err := findProfile(profiles, name)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	repo, err := openRepository()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	var previous *profile
+	if current, _ := gitOutput("config", "--file", repo.config, currentKey); current != "" {
+		if prev, err := findProfile(profiles, current); err == nil {
+			previous = &prev
+		}
+	}
+	return repo, p, repo.plan(p, previous, local)
+}
+
+func runUse(path string, args []string) {
+	flags := flag.NewFlagSet("use", flag.ExitOnError)
+	local := flags.Bool("local", false, "Set lfs.url in this clone's git config instead of .lfsconfig")
+	flags.Parse(args)
+
+	repo, p, changes := planSwitch(path, profileArg(flags, "use [--local] NAME"), *local)
+	if len(changes) == 0 {
+		fmt.Printf("Already using profile '%s' (%s)\n", p.name, p.url)
+		return
+	}
+	if err := repo.apply(changes); err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("✓ Switched to profile '%s' (%s)\n", p.name, p.url)
+	repo.printChanges(changes)
+	for _, c := range changes {
+		if c.file == repo.lfsConfig {
+			fmt.Printf("\nCommit %s to switch every clone of this repository.\n", lfsapi.LFSConfigFile)
+			break
+		}
+	}
+}
+
+func runDiff(path string, args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	local := flags.Bool("local", false, "Compare with 'use --local'")
+	flags.Parse(args)
+
+	repo, p, changes := planSwitch(path, profileArg(flags, "diff [--local] NAME"), *local)
+	if len(changes) == 0 {
+		fmt.Printf("Profile '%s' is already in use; nothing would change\n", p.name)
+		return
+	}
+	fmt.Printf("Switching to profile '%s' would change:\n", p.name)
+	repo.printChanges(changes)
+}
+
+func runShow(path string, args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	remote := flags.StringP("remote", "r", "origin", "Remote whose effective endpoint is shown")
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		p, err := findProfile(loadProfiles(path), profileArg(flags, "show [NAME]"))
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		printProfile(p)
+		return
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	current := repo.get(repo.config, currentKey)
+	fmt.Printf("Profile:  %s\n", display(current))
+	url, source, err := lfsapi.Endpoint(*remote)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("Endpoint: %s (%s)\n", url, source)
+
+	if current == "" {
+		return
+	}
+	p, err := findProfile(loadProfiles(path), current)
+	if err != nil {
+		fmt.Printf("⚠ Profile '%s' is no longer in %s\n", current, path)
+		return
+	}
+	if p.url != url {
+		fmt.Printf("⚠ The profile's endpoint is %s; %s overrides it\n", p.url, source)
+	}
+	if changes := repo.plan(p, nil, repo.get(repo.config, "lfs.url") == p.url); len(changes) > 0 {
+		fmt.Printf("⚠ The repository has drifted from the profile; 'git lfs-endpoint use %s' would change:\n", p.name)
+		repo.printChanges(changes)
+	}
+}
+
+func printProfile(p profile) {
+	fmt.Printf("Profile:              %s\n", p.name)
+	fmt.Printf("URL:                  %s\n", p.url)
+	fmt.Printf("Authentication:       %s\n", display(p.auth))
+	fmt.Printf("Transfer agent:       %s\n", display(p.transfer))
+	if p.transferPath != "" {
+		fmt.Printf("Transfer agent path:  %s\n", p.transferPath)
+	}
+	concurrent := "(unset)"
+	if p.concurrentTransfers > 0 {
+		concurrent = fmt.Sprint(p.concurrentTransfers)
+	}
+	fmt.Printf("Concurrent transfers: %s\n", concurrent)
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-endpoint - Switch a repository between named LFS endpoint profiles
+
+		USAGE:
+		  git lfs-endpoint [--file FILE] list
+		  git lfs-endpoint [--file FILE] add NAME --url URL [OPTIONS]
+		  git lfs-endpoint [--file FILE] remove NAME
+		  git lfs-endpoint [--file FILE] use [--local] NAME
+		  git lfs-endpoint [--file FILE] diff [--local] NAME
+		  git lfs-endpoint [--file FILE] show [--remote NAME] [NAME]
+
+		OPTIONS:
+		  -f, --file FILE      Profiles file (default: the file named by git config
+		                       lfs-scripts.endpoints, or ~/.config/git-lfs-scripts/endpoints)
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		ADD OPTIONS:
+		  --url URL                  LFS endpoint URL (required)
+		  --auth MODE                basic or negotiate, set as lfs.<url>.access
+		  --transfer NAME            Standalone transfer agent, e.g. lfs-folderstore
+		  --transfer-path PROGRAM    Program implementing the transfer agent
+		  --concurrent-transfers N   Value of lfs.concurrenttransfers
+
+		SUBCOMMANDS:
+		  list       List the profiles; '*' marks the one this repository uses
+		  add        Add or replace a profile
+		  remove     Remove a profile
+		  use        Switch this repository to a profile
+		  diff       Show what 'use' would change, without changing anything
+		  show       Show the repository's profile and effective endpoint, and
+		             whether its settings have drifted; with NAME, show a profile
+
+		DESCRIPTION:
+		  A profile names an LFS endpoint together with the settings that go with
+		  it. Profiles live in one file in git config syntax, so a team can share
+		  them by pointing lfs-scripts.endpoints at a file on a shared drive:
+
+		    [endpoint "staging"]
+		        url = https://lfs-staging.example.com/team/assets
+		        auth = basic
+		        concurrenttransfers = 8
+
+		  'use' writes lfs.url to .lfsconfig, which reaches every clone once it is
+		  committed, and removes an lfs.url from this clone's git config that would
+		  override it. With --local, lfs.url is set in git config instead and
+		  .lfsconfig is left alone. lfs.<url>.access, lfs.standalonetransferagent,
+		  lfs.customtransfer.NAME.path and lfs.concurrenttransfers are set in git
+		  config, and settings of the previous profile are removed. Both files are
+		  restored if any change fails, so a repository is never left between two
+		  profiles.
+
+		EXAMPLES:
+		  # Define a staging and a production endpoint
+		  git lfs-endpoint add staging --url https://lfs-staging.example.com/team/assets --auth basic
+		  git lfs-endpoint add production --url https://lfs.example.com/team/assets --concurrent-transfers 8
+
+		  # Preview, then make the switch
+		  git lfs-endpoint diff staging
+		  git lfs-endpoint use staging
+
+		  # Use a folder store for this clone only
+		  git lfs-endpoint add nas --url https://nas.local/lfs --transfer lfs-folderstore \
+		    --transfer-path /usr/local/bin/lfs-folderstore
+		  git lfs-endpoint use --local nas
+	`))
+}
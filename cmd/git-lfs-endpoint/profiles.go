@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// profileSection is the git config section of the profiles file; each
+// profile is a subsection, e.g. [endpoint "staging"]
+const profileSection = "endpoint"
+
+// profilesConfigKey names a profiles file to use instead of the user's, e.g.
+// one on a shared drive so a whole team switches between the same endpoints
+const profilesConfigKey = "lfs-scripts.endpoints"
+
+// profileName restricts names to ones that are easy to type and quote
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// profile is a named LFS endpoint configuration
+type profile struct {
+	name                string
+	url                 string // lfs.url
+	auth                string // lfs.<url>.access: basic or negotiate; empty leaves it unset
+	transfer            string // lfs.standalonetransferagent
+	transferPath        string // lfs.customtransfer.<transfer>.path
+	concurrentTransfers int    // lfs.concurrenttransfers; 0 leaves it unset
+}
+
+// profilesFile returns the profiles file: the one given, the one named by
+// lfs-scripts.endpoints, or ~/.config/git-lfs-scripts/endpoints
+func profilesFile(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	output, _ := common.Query(exec.Command("git", "config", "--path", profilesConfigKey))
+	if configured := strings.TrimSpace(string(output)); configured != "" {
+		return configured, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the user configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "git-lfs-scripts", "endpoints"), nil
+}
+
+// readProfiles returns the profiles in path, sorted by name; a missing file
+// holds no profiles
+func readProfiles(path string) ([]profile, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	output, err := common.Query(exec.Command("git", "config", "--file", path, "--null", "--list"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles from %s: %v", path, err)
+	}
+	profiles, err := parseProfiles(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+// parseProfiles parses git config --null --list output, ignoring sections
+// other than profileSection
+func parseProfiles(output string) ([]profile, error) {
+	byName := make(map[string]*profile)
+	for _, entry := range strings.Split(output, "\x00") {
+		key, value, _ := strings.Cut(entry, "\n")
+		if !strings.HasPrefix(key, profileSection+".") {
+			continue
+		}
+		rest := strings.TrimPrefix(key, profileSection+".")
+		dot := strings.LastIndexByte(rest, '.')
+		if dot < 0 {
+			continue
+		}
+		name, variable := rest[:dot], rest[dot+1:]
+		p, ok := byName[name]
+		if !ok {
+			p = &profile{name: name}
+			byName[name] = p
+		}
+
+		switch variable {
+		case "url":
+			p.url = value
+		case "auth":
+			p.auth = value
+		case "transfer":
+			p.transfer = value
+		case "transferpath":
+			p.transferPath = value
+		case "concurrenttransfers":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("profile '%s': concurrenttransfers must be a number, not '%s'", name, value)
+			}
+			p.concurrentTransfers = n
+		default:
+			return nil, fmt.Errorf("profile '%s': unknown setting '%s'", name, variable)
+		}
+	}
+
+	profiles := make([]profile, 0, len(byName))
+	for _, p := range byName {
+		if p.url == "" {
+			return nil, fmt.Errorf("profile '%s' has no url", p.name)
+		}
+		profiles = append(profiles, *p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].name < profiles[j].name })
+	return profiles, nil
+}
+
+// findProfile returns the profile called name
+func findProfile(profiles []profile, name string) (profile, error) {
+	for _, p := range profiles {
+		if p.name == name {
+			return p, nil
+		}
+	}
+	return profile{}, fmt.Errorf("no profile named '%s'; run 'git lfs-endpoint list'", name)
+}
+
+// validate checks a profile before it is saved
+func (p profile) validate() error {
+	if !profileName.MatchString(p.name) {
+		return fmt.Errorf("invalid profile name '%s' (letters, digits, '.', '_' and '-')", p.name)
+	}
+	if p.url == "" {
+		return fmt.Errorf("profile '%s' needs --url", p.name)
+	}
+	switch p.auth {
+	case "", "basic", "negotiate":
+	default:
+		return fmt.Errorf("--auth must be 'basic' or 'negotiate', not '%s'", p.auth)
+	}
+	if p.transferPath != "" && p.transfer == "" {
+		return fmt.Errorf("--transfer-path needs --transfer to name the agent")
+	}
+	if p.concurrentTransfers < 0 {
+		return fmt.Errorf("--concurrent-transfers must not be negative")
+	}
+	return nil
+}
+
+// saveProfile writes p to the profiles file, replacing any profile of the
+// same name
+func saveProfile(path string, p profile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	section := profileSection + "." + p.name
+	if _, err := os.Stat(path); err == nil {
+		// Fails when there is no such section yet
+		_ = gitConfigFile(path, "--remove-section", section)
+	}
+
+	concurrent := ""
+	if p.concurrentTransfers > 0 {
+		concurrent = strconv.Itoa(p.concurrentTransfers)
+	}
+	for _, v := range []struct{ variable, value string }{
+		{"url", p.url},
+		{"auth", p.auth},
+		{"transfer", p.transfer},
+		{"transferpath", p.transferPath},
+		{"concurrenttransfers", concurrent},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if err := gitConfigFile(path, section+"."+v.variable, v.value); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// deleteProfile removes the profile called name from the profiles file
+func deleteProfile(path, name string) error {
+	if err := gitConfigFile(path, "--remove-section", profileSection+"."+name); err != nil {
+		return fmt.Errorf("failed to remove profile '%s' from %s: %v", name, path, err)
+	}
+	return nil
+}
+
+// gitConfigFile changes the profiles file path with git config, through
+// common.Run; the error is what git reported
+func gitConfigFile(path string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"config", "--file", path}, args...)...)
+	cmd.Stderr = &stderr
+	if err := common.Run(cmd); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s", message)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+)
+
+// currentKey records in the repository's config which profile is in use
+const currentKey = "lfs-scripts.endpoint"
+
+// repository holds the two files a switch edits
+type repository struct {
+	lfsConfig string // .lfsconfig at the top of the working tree
+	config    string // The repository's own config file
+}
+
+// setting is a git config value in one of the repository's files; an empty
+// value means the key is unset
+type setting struct {
+	file  string // repository.lfsConfig or repository.config
+	key   string
+	value string
+}
+
+// change is a setting whose current value differs from the wanted one
+type change struct {
+	setting
+	current string
+}
+
+func openRepository() (*repository, error) {
+	top, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not inside a working tree: %v", err)
+	}
+	config, err := gitOutput("rev-parse", "--git-path", "config")
+	if err != nil {
+		return nil, err
+	}
+	if config, err = filepath.Abs(config); err != nil {
+		return nil, err
+	}
+	return &repository{lfsConfig: filepath.Join(top, lfsapi.LFSConfigFile), config: config}, nil
+}
+
+// settings returns the values a profile gives the repository. The endpoint
+// goes to .lfsconfig so it reaches every clone, unless local is set; the
+// other settings only concern this clone. A local lfs.url would override
+// .lfsconfig, so it is removed otherwise.
+func (r *repository) settings(p profile, local bool) []setting {
+	endpoint := []setting{{r.lfsConfig, "lfs.url", p.url}, {r.config, "lfs.url", ""}}
+	if local {
+		endpoint = []setting{{r.config, "lfs.url", p.url}}
+	}
+	concurrent := ""
+	if p.concurrentTransfers > 0 {
+		concurrent = strconv.Itoa(p.concurrentTransfers)
+	}
+
+	settings := append(endpoint,
+		setting{r.config, "lfs." + p.url + ".access", p.auth},
+		setting{r.config, "lfs.standalonetransferagent", p.transfer},
+		setting{r.config, "lfs.concurrenttransfers", concurrent},
+	)
+	if p.transfer != "" {
+		settings = append(settings, setting{r.config, "lfs.customtransfer." + p.transfer + ".path", p.transferPath})
+	}
+	return append(settings, setting{r.config, currentKey, p.name})
+}
+
+// plan returns the changes that switch the repository to p. Settings of
+// the previous profile that p does not have are removed.
+func (r *repository) plan(p profile, previous *profile, local bool) []change {
+	wanted := r.settings(p, local)
+	seen := make(map[string]bool)
+	for _, s := range wanted {
+		seen[s.file+"\x00"+s.key] = true
+	}
+	if previous != nil {
+		for _, s := range r.settings(*previous, local) {
+			if !seen[s.file+"\x00"+s.key] {
+				seen[s.file+"\x00"+s.key] = true
+				wanted = append(wanted, setting{s.file, s.key, ""})
+			}
+		}
+	}
+
+	var changes []change
+	for _, s := range wanted {
+		current := r.get(s.file, s.key)
+		if current != s.value {
+			changes = append(changes, change{setting: s, current: current})
+		}
+	}
+	return changes
+}
+
+// get returns the value of key in file, or an empty string
+func (r *repository) get(file, key string) string {
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	value, _ := gitOutput("config", "--file", file, "--get", key)
+	return value
+}
+
+// apply makes the changes. Both files are restored if any change fails,
+// so the repository is never left between two profiles.
+func (r *repository) apply(changes []change) error {
+	backups := make(map[string][]byte)
+	for _, file := range []string{r.lfsConfig, r.config} {
+		if content, err := os.ReadFile(file); err == nil {
+			backups[file] = content
+		}
+	}
+	restore := func() {
+		for _, file := range []string{r.lfsConfig, r.config} {
+			if content, ok := backups[file]; ok {
+				_ = os.WriteFile(file, content, 0644)
+			} else {
+				_ = os.Remove(file)
+			}
+		}
+	}
+
+	for _, c := range changes {
+		args := []string{"config", "--file", c.file, c.key, c.value}
+		if c.value == "" {
+			args = []string{"config", "--file", c.file, "--unset-all", c.key}
+		}
+		if _, err := gitOutput(args...); err != nil {
+			restore()
+			return fmt.Errorf("failed to set %s in %s, nothing was changed: %v", c.key, c.file, err)
+		}
+	}
+	return nil
+}
+
+// label names a file of the repository for display
+func (r *repository) label(file string) string {
+	if file == r.lfsConfig {
+		return lfsapi.LFSConfigFile
+	}
+	return "git config"
+}
+
+// printChanges lists changes as old and new values
+func (r *repository) printChanges(changes []change) {
+	for _, c := range changes {
+		fmt.Printf("  %-11s %s\n", r.label(c.file), c.key)
+		fmt.Printf("  %-11s   - %s\n", "", display(c.current))
+		fmt.Printf("  %-11s   + %s\n", "", display(c.value))
+	}
+}
+
+// display shows unset values explicitly
+func display(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+func gitOutput(args ...string) (string, error) {
+	output, err := common.Query(exec.Command("git", args...))
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	remote := flag.StringP("remote", "r", "", "Remote to fetch from (default: git lfs default remote)")
+	noFetch := flag.Bool("no-fetch", false, "Only verify objects already present locally")
+	history := flag.Bool("history", false, "Also verify objects referenced anywhere in the history of each ref")
+	verify := flag.Bool("verify", false, "Re-hash local objects instead of only checking their size")
+	manifest := flag.StringP("manifest", "m", "", "Write a manifest of all referenced oids to this file")
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-fetch-all-refs")
+	completion.Handle(completion.Command{Name: "git-lfs-fetch-all-refs", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckLFSInstalled(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	if !*noFetch {
+		args := []string{"lfs", "fetch", "--all"}
+		if *remote != "" {
+			args = append(args, *remote)
+		}
+		fmt.Printf("Running: git %s\n", strings.Join(args, " "))
+		if err := common.RunNetwork("git", args...); err != nil {
+			// Keep going: the verification below shows what is missing
+			fmt.Fprintf(os.Stderr, "Warning: git lfs fetch --all failed: %v\n", err)
+		}
+	}
+
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	refs, err := lfspointer.AllRefs()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	// Verify each object once, even when several refs reference it
+	status := make(map[string]string)
+	all := make(map[string]lfspointer.Pointer)
+	incompleteRefs := 0
+
+	fmt.Println()
+	fmt.Printf("Verifying LFS objects for %d refs in %s\n", len(refs), storage)
+	for _, ref := range refs {
+		pointers, err := refPointers(ref, *history)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+
+		var missing []string
+		for _, p := range pointers {
+			if _, seen := all[p.OID]; !seen {
+				all[p.OID] = p
+			}
+			problem, checked := status[p.OID]
+			if !checked {
+				problem = checkObject(storage, p, *verify)
+				status[p.OID] = problem
+			}
+			if problem != "" {
+				missing = append(missing, fmt.Sprintf("%s %s (%s)", p.OID[:12], p.Path, problem))
+			}
+		}
+
+		if len(missing) == 0 {
+			fmt.Printf("  ✓ %s: %d objects\n", ref, len(pointers))
+			continue
+		}
+		incompleteRefs++
+		fmt.Printf("  ✗ %s: %d of %d objects missing\n", ref, len(missing), len(pointers))
+		for _, m := range missing {
+			fmt.Printf("      %s\n", m)
+		}
+	}
+
+	if *manifest != "" {
+		if err := writeManifest(*manifest, all, status); err != nil {
+			common.PrintError("Failed to write manifest: %v", err)
+		}
+		fmt.Printf("\nManifest of %d objects written to %s\n", len(all), *manifest)
+	}
+
+	var totalSize int64
+	missingObjects := 0
+	for oid, p := range all {
+		totalSize += p.Size
+		if status[oid] != "" {
+			missingObjects++
+		}
+	}
+	fmt.Println()
+	fmt.Printf("Objects: %d (%s), missing: %d, incomplete refs: %d\n",
+		len(all), common.FormatSize(totalSize), missingObjects, incompleteRefs)
+	if missingObjects > 0 {
+		os.Exit(2)
+	}
+}
+
+// refPointers returns the pointers in the tree of ref and, with history, every
+// pointer added in the commits reachable from ref
+func refPointers(ref string, history bool) ([]lfspointer.Pointer, error) {
+	pointers, err := lfspointer.ListTree(ref)
+	if err != nil || !history {
+		return pointers, err
+	}
+
+	added, err := lfspointer.Added("", []string{ref})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, p := range pointers {
+		seen[p.OID] = true
+	}
+	for _, p := range added {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			pointers = append(pointers, p)
+		}
+	}
+	return pointers, nil
+}
+
+// checkObject returns an empty string when the object is present and intact,
+// otherwise a short description of the problem
+func checkObject(storage string, p lfspointer.Pointer, verify bool) string {
+	path := lfspointer.ObjectPath(storage, p.OID)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	if info.Size() != p.Size {
+		return fmt.Sprintf("size %d, expected %d", info.Size(), p.Size)
+	}
+	if !verify {
+		return ""
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "unreadable"
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "unreadable"
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != p.OID {
+		return "corrupt"
+	}
+	return ""
+}
+
+// writeManifest writes one line per object: OID, size, status and a path that references it
+func writeManifest(path string, all map[string]lfspointer.Pointer, status map[string]string) error {
+	oids := make([]string, 0, len(all))
+	for oid := range all {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+
+	var b strings.Builder
+	b.WriteString("# oid\tsize\tstatus\tpath\n")
+	for _, oid := range oids {
+		state := "ok"
+		if status[oid] != "" {
+			state = "missing"
+		}
+		p := all[oid]
+		fmt.Fprintf(&b, "%s\t%d\t%s\t%s\n", oid, p.Size, state, p.Path)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-fetch-all-refs - Fetch and verify Git LFS objects for all branches and tags
+
+		USAGE:
+		  git lfs-fetch-all-refs [OPTIONS]
+
+		OPTIONS:
+		  -r, --remote NAME     Remote to fetch from (default: the Git LFS default remote)
+		  --no-fetch            Only verify objects already present locally
+		  --history             Also verify objects referenced anywhere in each ref's history
+		  --verify              Re-hash local objects instead of only checking their size
+		  -m, --manifest FILE   Write a manifest of all referenced oids to FILE
+		  --timeout DURATION    Stop the fetch if it takes longer, e.g. 1h (default: no limit)
+		  --retries N           Retry a failed fetch N times (default: 2)
+		  -h, --help            Show this help message
+		  --version             Show the version, commit and build date
+
+		DESCRIPTION:
+		  Runs 'git lfs fetch --all' and then checks that every LFS object referenced
+		  by every local branch, remote-tracking branch and tag is present in local
+		  LFS storage with the expected size. Refs with missing objects are listed
+		  together with the objects they lack.
+
+		  By default only the files at the tip of each ref are checked; --history
+		  extends the check to every LFS object committed in the ref's history,
+		  which is what a complete mirror for a server migration or an air-gapped
+		  backup needs.
+
+		  The manifest is tab-separated with one line per object: oid, size,
+		  status (ok or missing) and a path that references the object.
+
+		  The exit status is 2 when any object is missing.
+
+		EXAMPLES:
+		  # Mirror everything from origin and check it
+		  git lfs-fetch-all-refs --remote origin --history
+
+		  # Check an existing mirror without network access
+		  git lfs-fetch-all-refs --no-fetch --verify --manifest lfs-manifest.tsv
+	`))
+}
@@ -4,19 +4,33 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/inventory"
 	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
 	"github.com/spf13/pflag"
 )
 
 func main() {
 	var opts lfsfiles.Options
-	var showHelp bool
+	var showHelp, nameOnly, noCache, long bool
 
 	pflag.BoolVarP(&opts.BothCases, "bothcases", "c", false, "Expand pattern to upper and lower case")
+	pflag.BoolVar(&opts.AllCases, "all-cases", false, "Expand pattern to match every case combination")
 	pflag.BoolVarP(&opts.DryRun, "dryrun", "d", false, "Dry run")
 	pflag.BoolVarP(&opts.Everywhere, "everywhere", "e", false, "Apply pattern everywhere")
+	pflag.StringSliceVar(&opts.Paths, "path", nil, "Anchor patterns to these directories instead of the current one")
 	pflag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	pflag.BoolVarP(&nameOnly, "name-only", "n", false, "List matching LFS paths from the inventory cache")
+	pflag.BoolVar(&noCache, "no-cache", false, "With --name-only, classify every file without using the cache")
+	pflag.BoolVarP(&long, "long", "l", false, "Show oid, size, local storage presence and checkout state")
+	pflag.BoolVarP(&opts.Null, "null", "z", false, "Terminate paths or --long lines with NUL instead of newline")
+	common.AddTraceFlag(pflag.CommandLine)
+	common.AddVersionFlag(pflag.CommandLine, "git-lfs-files")
+	completion.Handle(completion.Command{Name: "git-lfs-files", Flags: pflag.CommandLine, Args: completion.ArgExtension})
 	pflag.Parse()
+	common.SetDryRun(opts.DryRun)
+	opts.DryRun = common.DryRun
 
 	if showHelp {
 		lfsfiles.PrintHelp(lfsfiles.LfsLsFiles)
@@ -24,10 +38,99 @@ func main() {
 	}
 
 	opts.Command = lfsfiles.GetCommandString(lfsfiles.LfsLsFiles)
-	patterns := pflag.Args()
+	patterns, err := lfsfiles.ExpandPresets(pflag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// git lfs ls-files cannot terminate paths with NUL, the inventory can
+	if opts.Null && !long {
+		nameOnly = true
+	}
+
+	// --long and --name-only match paths relative to the top of the working tree
+	if (long || nameOnly) && !opts.DryRun {
+		paths, err := lfsfiles.TopRelativeDirs(opts.Paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Paths = paths
+	}
+
+	if long && !opts.DryRun {
+		if err := listLong(patterns, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if nameOnly && !opts.DryRun {
+		if err := listNames(patterns, opts, !noCache); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	if err := lfsfiles.Execute(patterns, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// listLong prints the LFS files matching any expanded pattern with their
+// oid, size, local storage presence and checkout state
+func listLong(patterns []string, opts lfsfiles.Options) error {
+	if err := common.CheckLFSInstalled(); err != nil {
+		return err
+	}
+
+	var expanded []string
+	for _, pattern := range patterns {
+		expanded = append(expanded, lfsfiles.ExpandPattern(pattern, opts)...)
+	}
+	entries, err := lfsfiles.ListLong(expanded)
+	if err != nil {
+		return err
+	}
+	lfsfiles.PrintLong(os.Stdout, entries, opts.Null)
+	return nil
+}
+
+// listNames prints the LFS paths matching any expanded pattern, or every
+// LFS path when no patterns are given, using the shared inventory
+func listNames(patterns []string, opts lfsfiles.Options, useCache bool) error {
+	files, _, err := inventory.Load(useCache)
+	if err != nil {
+		return err
+	}
+
+	var expanded []string
+	for _, pattern := range patterns {
+		expanded = append(expanded, lfsfiles.ExpandPattern(pattern, opts)...)
+	}
+
+	end := "\n"
+	if opts.Null {
+		end = "\x00"
+	}
+	for _, file := range files {
+		if !file.LFS {
+			continue
+		}
+		if len(expanded) == 0 {
+			fmt.Print(file.Path, end)
+			continue
+		}
+		for _, pattern := range expanded {
+			if lfsfiles.MatchPath(pattern, file.Path) {
+				fmt.Print(file.Path, end)
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+// Error codes of failed transfers, as HTTP status codes
+const (
+	codeNotFound = 404
+	codeInvalid  = 422
+	codeFailed   = 500
+)
+
+// progressStep is how many bytes are transferred between progress events
+const progressStep = 1 << 20
+
+// agent answers the requests of Git LFS on one process's stdin and stdout.
+// Git LFS sends requests one at a time and runs several agents for
+// concurrent transfers.
+type agent struct {
+	dir         string
+	lockTimeout time.Duration
+	store       *store
+	tmpDir      string // Where downloads are written for Git LFS to move
+	out         io.Writer
+}
+
+// run answers requests until terminate or the end of input
+func (a *agent) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var request transfer.Request
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			fmt.Fprintf(os.Stderr, "git-lfs-folder-agent: invalid request: %v\n", err)
+			continue
+		}
+		if request.Event == transfer.EventTerminate {
+			return nil
+		}
+		a.handle(request)
+	}
+	return scanner.Err()
+}
+
+// handle answers one request
+func (a *agent) handle(request transfer.Request) {
+	err := request.Validate()
+	switch {
+	case request.Event == transfer.EventInit:
+		if err == nil {
+			err = a.init(request.Operation)
+		}
+		var response transfer.InitResponse
+		if err != nil {
+			response.Error = &transfer.Error{Code: codeFailed, Message: err.Error()}
+		}
+		transfer.Write(a.out, response)
+	case err != nil && request.OID == "":
+		fmt.Fprintf(os.Stderr, "git-lfs-folder-agent: %v\n", err)
+	case err != nil:
+		a.complete(request.OID, "", &transfer.Error{Code: codeInvalid, Message: err.Error()})
+	case a.store == nil:
+		a.complete(request.OID, "", &transfer.Error{Code: codeFailed, Message: "init was not sent"})
+	case request.Event == transfer.EventUpload:
+		a.upload(request)
+	default:
+		a.download(request)
+	}
+}
+
+// init opens the store, and for downloads finds the repository's LFS
+// temporary directory, where Git LFS expects downloaded files
+func (a *agent) init(operation string) error {
+	s, err := openStore(a.dir, a.lockTimeout)
+	if err != nil {
+		return err
+	}
+	if operation == transfer.EventDownload {
+		if _, err := os.Stat(s.root); err != nil {
+			return fmt.Errorf("store %s holds no objects: %v", s.root, err)
+		}
+		a.tmpDir = lfsTempDir()
+		if err := os.MkdirAll(a.tmpDir, 0755); err != nil {
+			return err
+		}
+	}
+	a.store = s
+	return nil
+}
+
+// lfsTempDir returns the repository's lfs/tmp directory, which lies on
+// the same file system as its objects, so Git LFS can move downloads there
+func lfsTempDir() string {
+	gitDir, err := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-common-dir").Output()
+	if err != nil {
+		return os.TempDir()
+	}
+	return filepath.Join(strings.TrimSpace(string(gitDir)), "lfs", "tmp")
+}
+
+func (a *agent) upload(request transfer.Request) {
+	progress := &progressWriter{agent: a, oid: request.OID}
+	err := a.store.put(request.OID, request.Size, request.Path, progress)
+	progress.flush()
+	if err != nil {
+		a.complete(request.OID, "", &transfer.Error{Code: codeFailed, Message: fmt.Sprintf("storing %s: %v", request.OID, err)})
+		return
+	}
+	a.complete(request.OID, "", nil)
+}
+
+func (a *agent) download(request transfer.Request) {
+	progress := &progressWriter{agent: a, oid: request.OID}
+	path, err := a.store.get(request.OID, request.Size, a.tmpDir, progress)
+	progress.flush()
+	switch {
+	case errors.Is(err, errNotFound):
+		a.complete(request.OID, "", &transfer.Error{Code: codeNotFound, Message: fmt.Sprintf("object %s is not in %s", request.OID, a.store.root)})
+	case err != nil:
+		a.complete(request.OID, "", &transfer.Error{Code: codeFailed, Message: fmt.Sprintf("reading %s: %v", request.OID, err)})
+	default:
+		a.complete(request.OID, path, nil)
+	}
+}
+
+func (a *agent) complete(oid, path string, e *transfer.Error) {
+	transfer.Write(a.out, transfer.Complete{Event: transfer.EventComplete, OID: oid, Path: path, Error: e})
+}
+
+// progressWriter counts the bytes of a transfer and sends a progress event
+// for every progressStep of them
+type progressWriter struct {
+	agent    *agent
+	oid      string
+	soFar    int64
+	reported int64
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.soFar += int64(len(data))
+	if p.soFar-p.reported >= progressStep {
+		p.flush()
+	}
+	return len(data), nil
+}
+
+// flush reports the bytes transferred since the last progress event
+func (p *progressWriter) flush() {
+	if p.soFar == p.reported {
+		return
+	}
+	transfer.Write(p.agent.out, transfer.Progress{
+		Event:          transfer.EventProgress,
+		OID:            p.oid,
+		BytesSoFar:     p.soFar,
+		BytesSinceLast: p.soFar - p.reported,
+	})
+	p.reported = p.soFar
+}
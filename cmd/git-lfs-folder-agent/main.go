@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	// Subcommands parse their own options
+	if len(os.Args) > 1 && os.Args[1] == "setup" {
+		runSetup(os.Args[2:])
+		return
+	}
+
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	lockTimeout := flag.Duration("lock-timeout", 10*time.Minute, "Age after which an object's lock file is considered stale")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-folder-agent")
+	completion.Handle(completion.Command{Name: "git-lfs-folder-agent", Flags: flag.CommandLine, Args: completion.ArgDirectory, Subcommands: []string{"setup"}})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() != 1 {
+		printHelp("Expected the store directory")
+	}
+	if *lockTimeout <= 0 {
+		printHelp("--lock-timeout must be positive")
+	}
+
+	dir, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	a := &agent{dir: dir, lockTimeout: *lockTimeout, out: os.Stdout}
+	if err := a.run(os.Stdin); err != nil {
+		common.PrintError("Failed to read requests: %v", err)
+	}
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-folder-agent - Store Git LFS objects in a shared folder
+
+		USAGE:
+		  git lfs-folder-agent [OPTIONS] DIR
+		  git lfs-folder-agent setup [--global] DIR
+
+		OPTIONS:
+		  --lock-timeout DURATION
+		                       Age after which an object's lock file is
+		                       considered stale (default: 10m)
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  A Git LFS standalone transfer agent that keeps LFS objects in a
+		  directory instead of on an LFS server: an NFS or SMB share, a NAS or
+		  a USB drive that every client mounts. Git LFS starts it for every push
+		  and fetch and talks to it on stdin and stdout, so it is not run by
+		  hand; 'setup' configures a repository to use it.
+
+		  Objects are stored in the layout Git LFS uses locally,
+		  DIR/OI/D_/OID. When DIR is a bare repository, e.g. one that
+		  git new-bare-repo created on the share, objects go to its lfs/objects
+		  directory instead, next to the Git objects, where its
+		  limits.maxLFSStorage limit and git lfs fetch --all find them.
+
+		  DIR must exist, so an unmounted share fails the transfer instead of
+		  filling the mount point. Uploads are copied to a temporary file next
+		  to their place, checked against their OID and size, and renamed into
+		  place, so a reader never sees a partial object. Objects already in
+		  the store are not copied again. Downloads are checked the same way
+		  before Git LFS moves them into the repository.
+
+		  Several clients may push at once. Before copying an object, a client
+		  creates OID.lock beside it, which works on network file systems where
+		  file locks may not; other clients pushing the same object wait and
+		  then find it stored. A lock older than --lock-timeout was left by a
+		  client that died and is removed.
+
+		SETUP:
+		  setup DIR sets lfs.customtransfer.folder.path and .args and
+		  lfs.standalonetransferagent in the repository's config, or with
+		  --global in your global config, so every push and fetch of LFS
+		  objects goes to DIR. Run it in each clone; DIR is the path of the
+		  share on that machine.
+
+		EXAMPLES:
+		  # Create a shared repository on the NAS and clone it
+		  git new-bare-repo /mnt/nas/git/project
+		  git clone /mnt/nas/git/project.git && cd project
+
+		  # Keep its LFS objects in the repository on the NAS
+		  git lfs-folder-agent setup /mnt/nas/git/project.git
+
+		  # Keep LFS objects on a USB drive, for every repository
+		  git lfs-folder-agent setup --global /media/usb/lfs-store
+
+		  # The same configuration by hand
+		  git config lfs.customtransfer.folder.path git-lfs-folder-agent
+		  git config lfs.customtransfer.folder.args /mnt/nas/lfs-store
+		  git config lfs.standalonetransferagent folder
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
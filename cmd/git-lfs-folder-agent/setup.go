@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	flag "github.com/spf13/pflag"
+)
+
+// agentName is the name of the transfer agent in git config
+const agentName = "folder"
+
+func runSetup(args []string) {
+	flags := flag.NewFlagSet("setup", flag.ExitOnError)
+	global := flags.Bool("global", false, "Configure every repository of this user")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	common.AddTraceFlag(flags)
+	flags.Parse(args)
+
+	if *showHelp || flags.NArg() != 1 {
+		printSetupHelp()
+		if *showHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	if !*global {
+		if err := common.CheckGitRepo(); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+
+	dir, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	s, err := openStore(dir, 0)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	program, err := os.Executable()
+	if err != nil {
+		common.PrintError("Cannot find this program's path: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(program); err == nil {
+		program = resolved
+	}
+
+	settings := [][2]string{
+		{"lfs.customtransfer." + agentName + ".path", program},
+		{"lfs.customtransfer." + agentName + ".args", common.ShellQuote(dir)},
+		{"lfs.standalonetransferagent", agentName},
+	}
+	for _, setting := range settings {
+		args := []string{"config"}
+		if *global {
+			args = append(args, "--global")
+		}
+		if err := common.RunCommand("git", append(args, setting[0], setting[1])...); err != nil {
+			common.PrintError("Failed to set %s: %v", setting[0], err)
+		}
+	}
+	scope := "this repository"
+	if *global {
+		scope = "every repository"
+	}
+	fmt.Printf("✓ LFS objects of %s are stored in %s\n", scope, s.root)
+}
+
+func printSetupHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-folder-agent setup - Store a repository's LFS objects in a folder
+
+		USAGE:
+		  git lfs-folder-agent setup [OPTIONS] DIR
+
+		OPTIONS:
+		  --global     Configure every repository of this user instead of the
+		               current one
+		  --trace      Print every external command before running it
+		  -h, --help   Show this help message
+
+		DESCRIPTION:
+		  Sets lfs.customtransfer.folder.path to this program,
+		  lfs.customtransfer.folder.args to DIR and lfs.standalonetransferagent
+		  to folder, so Git LFS transfers every object to and from DIR without
+		  asking an LFS server. DIR must exist; when it is a bare repository,
+		  objects go to its lfs/objects directory.
+
+		EXAMPLES:
+		  git lfs-folder-agent setup /mnt/nas/git/project.git
+		  git lfs-folder-agent setup --global /media/usb/lfs-store
+	`))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// store is a directory of LFS objects in the sharded layout of Git LFS,
+// objects/OI/D_/OID, on a share that several clients write at once
+type store struct {
+	root        string        // Directory holding the shards
+	lockTimeout time.Duration // Age after which a lock file is considered stale
+}
+
+// errNotFound is returned for objects that are not in the store
+var errNotFound = errors.New("object not found")
+
+// openStore opens the store in dir, which must exist so that an unmounted
+// share is never mistaken for an empty store. In a bare repository, as
+// git-new-bare-repo creates, objects go to its lfs/objects directory.
+func openStore(dir string, lockTimeout time.Duration) (*store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("store %s is not available: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("store %s is not a directory", dir)
+	}
+	root := dir
+	if isBareRepo(dir) {
+		root = filepath.Join(dir, "lfs", "objects")
+	}
+	return &store{root: root, lockTimeout: lockTimeout}, nil
+}
+
+// isBareRepo reports whether dir looks like a bare Git repository
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// path returns where an object is kept
+func (s *store) path(oid string) string {
+	return lfspointer.ObjectPath(s.root, oid)
+}
+
+// put copies the file at src into the store as oid. The content is written
+// to a temporary file next to its place and checked against oid and size
+// before it is renamed into place, so readers never see a partial object.
+// An object already in the store is not copied again.
+func (s *store) put(oid string, size int64, src string, progress io.Writer) error {
+	target := s.path(oid)
+	if present(target, size) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0775); err != nil {
+		return err
+	}
+	unlock, err := s.lock(target, size)
+	if err != nil {
+		return err
+	}
+	if unlock == nil {
+		return nil // Another client stored the object meanwhile
+	}
+	defer unlock()
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+oid[:12]+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	err = copyVerified(tmp, in, oid, size, progress)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// Objects never change once stored
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// get copies oid from the store into a new file in dir, checking it against
+// oid and size, and returns the file's path
+func (s *store) get(oid string, size int64, dir string, progress io.Writer) (string, error) {
+	in, err := os.Open(s.path(oid))
+	if os.IsNotExist(err) {
+		return "", errNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(dir, "folder-agent-"+oid[:12]+"-*")
+	if err != nil {
+		return "", err
+	}
+	err = copyVerified(tmp, in, oid, size, progress)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// copyVerified copies src to dst and fails unless the content has the
+// expected size and hashes to oid
+func copyVerified(dst io.Writer, src io.Reader, oid string, size int64, progress io.Writer) error {
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dst, hash, progress), src)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("size is %d bytes, not %d", n, size)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != oid {
+		return fmt.Errorf("content hashes to %s", actual)
+	}
+	return nil
+}
+
+// present reports whether an object of the given size is at path
+func present(path string, size int64) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Size() == size
+}
+
+// lock takes the lock of the object at target by creating target.lock,
+// which works on NFS and SMB shares where flock may not. While another
+// client holds the lock it waits; when that client stored the object
+// meanwhile, lock returns a nil unlock function. A lock older than
+// lockTimeout was left by a client that died and is broken. The lock only
+// saves copying an object twice: objects are renamed into place whole, so
+// even two clients holding it cannot damage the store.
+func (s *store) lock(target string, size int64) (func(), error) {
+	path := target + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0664)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			if present(target, size) {
+				os.Remove(path)
+				return nil, nil
+			}
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > s.lockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if present(target, size) {
+			return nil, nil
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// lockPoll is how often a held lock is checked
+const lockPoll = 200 * time.Millisecond
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testObject returns the oid and size of content
+func testObject(content string) (string, int64) {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:]), int64(len(content))
+}
+
+// writeFile creates the file path, and its directory, holding content
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPut tests that objects are verified before they are renamed into place
+func TestPut(t *testing.T) {
+	oid, size := testObject("object content")
+	tests := []struct {
+		name     string
+		source   string // Content of the file put; none when empty
+		stored   string // Content already in the store; none when empty
+		size     int64
+		wantErr  bool
+		wantFile string // Content of the object afterwards; none when empty
+	}{
+		{"new object", "object content", "", size, false, "object content"},
+		{"already stored", "", "object content", size, false, "object content"},
+		{"wrong content", "other content!", "", size, true, ""},
+		{"wrong size", "object content", "", size + 1, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &store{root: t.TempDir(), lockTimeout: time.Minute}
+			src := filepath.Join(t.TempDir(), "src")
+			if tt.source != "" {
+				writeFile(t, src, tt.source)
+			}
+			if tt.stored != "" {
+				writeFile(t, s.path(oid), tt.stored)
+			}
+
+			err := s.put(oid, tt.size, src, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("put() = %v, want error %v", err, tt.wantErr)
+			}
+			data, readErr := os.ReadFile(s.path(oid))
+			switch {
+			case tt.wantFile == "" && readErr == nil:
+				t.Errorf("put() stored %q", data)
+			case tt.wantFile != "" && string(data) != tt.wantFile:
+				t.Errorf("object = %q, %v, want %q", data, readErr, tt.wantFile)
+			}
+			// Neither the lock nor a temporary file is left behind
+			entries, _ := os.ReadDir(filepath.Dir(s.path(oid)))
+			for _, entry := range entries {
+				if entry.Name() != oid {
+					t.Errorf("put() left %s", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+// TestPutReadOnly tests that stored objects cannot be changed
+func TestPutReadOnly(t *testing.T) {
+	oid, size := testObject("read only")
+	s := &store{root: t.TempDir(), lockTimeout: time.Minute}
+	src := filepath.Join(t.TempDir(), "src")
+	writeFile(t, src, "read only")
+	if err := s.put(oid, size, src, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(s.path(oid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0444 {
+		t.Errorf("stored object mode = %v, want 0444", info.Mode().Perm())
+	}
+}
+
+// TestLock tests taking, breaking and waiting for the lock of an object
+func TestLock(t *testing.T) {
+	oid, size := testObject("locked content")
+	tests := []struct {
+		name       string
+		lockAge    time.Duration // Age of a lock held by another client; none when zero
+		stored     bool          // The object is already in the store
+		wantUnlock bool
+	}{
+		{"free", 0, false, true},
+		{"stale lock", 2 * time.Minute, false, true},
+		{"stored before locking", 0, true, false},
+		{"another client stored it", time.Second, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &store{root: t.TempDir(), lockTimeout: time.Minute}
+			target := s.path(oid)
+			lockPath := target + ".lock"
+			if tt.stored {
+				writeFile(t, target, "locked content")
+			}
+			if tt.lockAge > 0 {
+				writeFile(t, lockPath, "1\n")
+				old := time.Now().Add(-tt.lockAge)
+				if err := os.Chtimes(lockPath, old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			unlock, err := s.lock(target, size)
+			if err != nil {
+				t.Fatalf("lock() = %v", err)
+			}
+			if (unlock != nil) != tt.wantUnlock {
+				t.Fatalf("lock() returned unlock %v, want %v", unlock != nil, tt.wantUnlock)
+			}
+			if unlock == nil {
+				return
+			}
+			if _, err := os.Stat(lockPath); err != nil {
+				t.Errorf("lock file missing while held: %v", err)
+			}
+			unlock()
+			if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+				t.Errorf("unlock() left the lock file: %v", err)
+			}
+		})
+	}
+}
+
+// TestGet tests that objects are verified when they are read from the store
+func TestGet(t *testing.T) {
+	oid, size := testObject("stored content")
+	tests := []struct {
+		name     string
+		stored   string // Content in the store; none when empty
+		wantErr  bool
+		notFound bool // The error is errNotFound
+	}{
+		{"verified", "stored content", false, false},
+		{"missing", "", true, true},
+		{"corrupt", "stored c0ntent", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &store{root: t.TempDir(), lockTimeout: time.Minute}
+			if tt.stored != "" {
+				writeFile(t, s.path(oid), tt.stored)
+			}
+			dir := t.TempDir()
+
+			path, err := s.get(oid, size, dir, io.Discard)
+			if (err != nil) != tt.wantErr || (err == errNotFound) != tt.notFound {
+				t.Fatalf("get() = %v, want error %v, not found %v", err, tt.wantErr, tt.notFound)
+			}
+			if err != nil {
+				if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+					t.Errorf("get() left %s", entries[0].Name())
+				}
+				return
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != tt.stored {
+				t.Errorf("get() copy = %q, %v", data, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// runGitHub creates a repository or changes its settings, then shows them
+func runGitHub(p *forge.GitHub, subcommand, repo string, private bool, lfs, maxFileSize string, teams, removeTeams []string) error {
+	if err := lfsSetting(lfs); err != nil {
+		return err
+	}
+	if maxFileSize != "" {
+		return fmt.Errorf("--max-file-size is only supported on GitLab")
+	}
+	if subcommand == "create" && len(removeTeams) > 0 {
+		return fmt.Errorf("--remove-team is only used with settings")
+	}
+	type grant struct{ team, permission string }
+	var grants []grant
+	for _, value := range teams {
+		team, permission, err := github.ParseTeamPermission(value)
+		if err != nil {
+			return fmt.Errorf("--team: %v", err)
+		}
+		grants = append(grants, grant{team, permission})
+	}
+	if err := github.CheckGHInstalled(); err != nil {
+		return err
+	}
+
+	if subcommand == "create" {
+		if err := runCreate(p, repo, private, ""); err != nil {
+			return err
+		}
+	}
+	if lfs != "" {
+		fmt.Printf("Setting Git LFS for %s to %sd...\n", repo, lfs)
+		if err := github.SetLFSEnabled(repo, lfs == "enable"); err != nil {
+			return fmt.Errorf("failed to update LFS setting: %v", err)
+		}
+	}
+	for _, g := range grants {
+		fmt.Printf("Granting team %s %s access to %s...\n", g.team, g.permission, repo)
+		if err := github.SetTeamPermission(repo, g.team, g.permission); err != nil {
+			return fmt.Errorf("failed to grant team %s access: %v", g.team, err)
+		}
+	}
+	for _, team := range removeTeams {
+		fmt.Printf("Removing team %s from %s...\n", team, repo)
+		if err := github.RemoveTeam(repo, team); err != nil {
+			return fmt.Errorf("failed to remove team %s: %v", team, err)
+		}
+	}
+	return showGitHub(repo, lfs)
+}
+
+func showGitHub(repo, lfs string) error {
+	r, err := github.GetRepo(repo)
+	if err != nil {
+		return fmt.Errorf("failed to read repository %s: %v", repo, err)
+	}
+	visibility := "public"
+	if r.Private {
+		visibility = "private"
+	}
+	fmt.Printf("Project:            %s\n", r.FullName)
+	fmt.Printf("URL:                %s\n", r.URL)
+	fmt.Printf("Owner:              %s (%s)\n", r.Owner.Login, r.Owner.Type)
+	fmt.Printf("Visibility:         %s\n", visibility)
+	if lfs != "" {
+		fmt.Printf("Git LFS enabled:    %t\n", lfs == "enable")
+	} else {
+		fmt.Println("Git LFS enabled:    unknown (GitHub's API cannot read it)")
+	}
+	if r.Owner.Type != "Organization" {
+		return nil
+	}
+
+	teams, err := github.RepoTeams(repo)
+	switch {
+	case err != nil:
+		fmt.Println("Teams:              unavailable (requires the admin:org scope)")
+	case len(teams) == 0:
+		fmt.Println("Teams:              none")
+	default:
+		for i, team := range teams {
+			label := ""
+			if i == 0 {
+				label = "Teams:"
+			}
+			fmt.Printf("%-20s%s (%s)\n", label, team.Slug, team.Permission)
+		}
+	}
+	return nil
+}
+
+// runOrgLFS enables or disables Git LFS for every repository of an
+// organization, since GitHub has no organization-wide setting in its API
+func runOrgLFS(org, lfs string) error {
+	if err := lfsSetting(lfs); err != nil {
+		return err
+	}
+	if err := github.CheckGHInstalled(); err != nil {
+		return err
+	}
+	repos, err := github.OrgRepos(org)
+	if err != nil {
+		return fmt.Errorf("failed to list the repositories of %s: %v", org, err)
+	}
+	failed := 0
+	for _, repo := range repos {
+		if err := github.SetLFSEnabled(repo, lfs == "enable"); err != nil {
+			failed++
+			fmt.Printf("✗ %s: %v\n", repo, err)
+			continue
+		}
+		fmt.Printf("✓ %s: Git LFS %sd\n", repo, lfs)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repositories of %s failed", failed, len(repos), org)
+	}
+	fmt.Printf("Git LFS %sd for %d repositories of %s\n", lfs, len(repos), org)
+	return nil
+}
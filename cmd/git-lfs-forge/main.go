@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	var (
+		project     string
+		provider    string
+		baseURL     string
+		lfs         string
+		maxFileSize string
+		public      bool
+		showHelp    bool
+		teams       []string
+		removeTeams []string
+		org         string
+	)
+
+	flag.StringVarP(&project, "project", "p", "", "Project path, e.g. group/name (default: inferred from remote.origin.url)")
+	flag.StringVar(&provider, "provider", "", "Forge hosting the project: gitlab, bitbucket or github (default: detected)")
+	flag.StringVar(&baseURL, "url", "", "Base URL of the forge (default: inferred from remote.origin.url)")
+	flag.StringVar(&baseURL, "gitlab-url", "", "GitLab instance URL; same as --url")
+	flag.StringVar(&lfs, "lfs", "", "Enable or disable Git LFS for the project (enable|disable)")
+	flag.StringVar(&maxFileSize, "max-file-size", "", "Push rule limiting pushed file size, e.g. 100M (0 removes the limit)")
+	flag.BoolVar(&public, "public", false, "Create a public repository (create only; default: private)")
+	flag.StringArrayVar(&teams, "team", nil, "Grant an organization team a permission, as TEAM:PERMISSION (GitHub only; repeatable)")
+	flag.StringArrayVar(&removeTeams, "remove-team", nil, "Take away a team's access (GitHub settings only; repeatable)")
+	flag.StringVar(&org, "org", "", "With settings --lfs, apply the setting to every repository of this organization (GitHub only)")
+	flag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-forge")
+	completion.Handle(completion.Command{Name: "git-lfs-forge", Flags: flag.CommandLine, Subcommands: []string{"create", "settings"}})
+	flag.Parse()
+
+	if showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+
+	subcommand := flag.Arg(0)
+	if subcommand != "settings" && subcommand != "create" {
+		printHelp("Error: A subcommand must be specified")
+		os.Exit(1)
+	}
+
+	if org != "" {
+		// The organization's repositories replace the current project
+		if provider == "" {
+			provider = "github"
+		}
+		if provider != "github" || subcommand != "settings" || lfs == "" || project != "" || len(teams)+len(removeTeams) > 0 {
+			common.PrintError("--org is only used as 'settings --org ORG --lfs enable|disable' on GitHub")
+		}
+		if err := runOrgLFS(org, lfs); err != nil {
+			common.PrintError("%v", err)
+		}
+		return
+	}
+
+	project, host, err := resolveProject(project, baseURL)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if provider == "" {
+		// Every project was taken to be on GitLab before other forges were supported
+		if provider = forge.DetectProvider(host); provider == "" {
+			provider = "gitlab"
+		}
+	}
+	if provider != "gitlab" && provider != "bitbucket" && provider != "github" {
+		common.PrintError("git-lfs-forge supports gitlab, bitbucket and github, not '%s'", provider)
+	}
+	if provider != "github" && len(teams)+len(removeTeams) > 0 {
+		common.PrintError("--team and --remove-team are only supported on GitHub; use --provider github for projects outside github.com remotes")
+	}
+	p, err := forge.NewProvider(provider, host, baseURL, "")
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	if gh, ok := p.(*forge.GitHub); ok {
+		err = runGitHub(gh, subcommand, project, !public, lfs, maxFileSize, teams, removeTeams)
+	} else if subcommand == "create" {
+		err = runCreate(p, project, !public, lfs)
+	} else if gitlab, ok := p.(*forge.GitLab); ok {
+		err = runSettings(gitlab, project, lfs, maxFileSize)
+	} else if maxFileSize != "" {
+		err = fmt.Errorf("--max-file-size is only supported on GitLab")
+	} else {
+		err = runToggle(p, project, lfs)
+	}
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+}
+
+// resolveProject fills in the project path from remote.origin.url when not
+// given, and returns the host of the forge: that of baseURL when given,
+// otherwise that of remote.origin.url, or "" when neither is known
+func resolveProject(project, baseURL string) (string, string, error) {
+	host := ""
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Hostname() == "" {
+			return "", "", fmt.Errorf("invalid --url '%s'", baseURL)
+		}
+		host = u.Hostname()
+	}
+
+	remote, err := forge.OriginRemote()
+	if project != "" {
+		if host == "" && err == nil {
+			host = remote.Host
+		}
+		return project, host, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("%v\nSpecify the project with --project GROUP/NAME", err)
+	}
+	if host == "" {
+		host = remote.Host
+	}
+	return remote.Path, host, nil
+}
+
+// lfsSetting parses the --lfs option; "" leaves the setting unchanged
+func lfsSetting(lfs string) error {
+	if lfs != "" && lfs != "enable" && lfs != "disable" {
+		return fmt.Errorf("--lfs must be 'enable' or 'disable', not '%s'", lfs)
+	}
+	return nil
+}
+
+// runCreate creates an empty repository, then applies --lfs
+func runCreate(p forge.Provider, project string, private bool, lfs string) error {
+	if err := lfsSetting(lfs); err != nil {
+		return err
+	}
+	creator, ok := p.(forge.RepoCreator)
+	if !ok {
+		return fmt.Errorf("creating repositories is not supported on %s", p.Name())
+	}
+	visibility := "public"
+	if private {
+		visibility = "private"
+	}
+	fmt.Printf("Creating %s %s repository %s...\n", visibility, p.Name(), project)
+	if err := creator.CreateRepo(project, private); err != nil {
+		return fmt.Errorf("failed to create repository: %v", err)
+	}
+	if lfs == "" {
+		return nil
+	}
+	return runToggle(p, project, lfs)
+}
+
+// runToggle applies --lfs on a forge whose only Git LFS setting is whether
+// it is enabled, then shows that setting
+func runToggle(p forge.Provider, project, lfs string) error {
+	if err := lfsSetting(lfs); err != nil {
+		return err
+	}
+	toggler, ok := p.(forge.LFSToggler)
+	if !ok {
+		return fmt.Errorf("%s has no Git LFS settings", p.Name())
+	}
+	if lfs != "" {
+		fmt.Printf("Setting Git LFS for %s to %sd...\n", project, lfs)
+		if err := toggler.SetLFSEnabled(project, lfs == "enable"); err != nil {
+			return fmt.Errorf("failed to update LFS setting: %v", err)
+		}
+	}
+
+	enabled, err := toggler.LFSEnabled(project)
+	if err != nil {
+		return fmt.Errorf("failed to read project %s: %v", project, err)
+	}
+	fmt.Printf("Project:            %s\n", project)
+	fmt.Printf("Forge:              %s\n", p.Name())
+	fmt.Printf("Git LFS enabled:    %t\n", enabled)
+	return nil
+}
+
+func runSettings(gitlab *forge.GitLab, project, lfs, maxFileSize string) error {
+	if err := lfsSetting(lfs); err != nil {
+		return err
+	}
+	if lfs != "" {
+		fmt.Printf("Setting Git LFS for %s to %sd...\n", project, lfs)
+		if err := gitlab.SetLFSEnabled(project, lfs == "enable"); err != nil {
+			return fmt.Errorf("failed to update LFS setting: %v", err)
+		}
+	}
+
+	if maxFileSize != "" {
+		bytes, err := common.ParseSize(maxFileSize)
+		if err != nil {
+			return fmt.Errorf("--max-file-size: %v", err)
+		}
+		megabytes := int((bytes + (1 << 20) - 1) >> 20)
+		fmt.Printf("Setting maximum pushed file size for %s to %d MB...\n", project, megabytes)
+		if err := gitlab.SetMaxFileSize(project, megabytes); err != nil {
+			return fmt.Errorf("failed to update push rule (push rules require GitLab Premium): %v", err)
+		}
+	}
+
+	return showSettings(gitlab, project)
+}
+
+func showSettings(gitlab *forge.GitLab, project string) error {
+	p, err := gitlab.GetProject(project)
+	if err != nil {
+		return fmt.Errorf("failed to read project %s: %v", project, err)
+	}
+
+	fmt.Printf("Project:            %s\n", p.PathWithNamespace)
+	fmt.Printf("URL:                %s\n", p.WebURL)
+	fmt.Printf("Git LFS enabled:    %t\n", p.LFSEnabled)
+	if p.Statistics != nil {
+		fmt.Printf("LFS storage:        %s\n", common.FormatSize(p.Statistics.LFSObjectsSize))
+		fmt.Printf("Repository size:    %s\n", common.FormatSize(p.Statistics.RepositorySize))
+		fmt.Printf("Total storage:      %s\n", common.FormatSize(p.Statistics.StorageSize))
+	} else {
+		fmt.Println("LFS storage:        unavailable (requires at least Reporter access)")
+	}
+
+	rule, err := gitlab.GetPushRule(project)
+	switch {
+	case err != nil:
+		fmt.Println("Max pushed file:    unavailable (push rules require GitLab Premium)")
+	case rule == nil || rule.MaxFileSize == 0:
+		fmt.Println("Max pushed file:    unlimited")
+	default:
+		fmt.Printf("Max pushed file:    %d MB\n", rule.MaxFileSize)
+	}
+	return nil
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-forge - Manage Git LFS settings on a Git hosting service
+
+		USAGE:
+		  git lfs-forge settings [OPTIONS]
+		  git lfs-forge create [OPTIONS]
+
+		OPTIONS:
+		  -p, --project PATH      Project path, e.g. group/name (default: from remote.origin.url)
+		  --provider NAME         Forge hosting the project: gitlab, bitbucket or github
+		                          (default: detected from the host, otherwise gitlab)
+		  --url URL               Base URL of the forge (default: from remote.origin.url);
+		                          --gitlab-url is accepted as well
+		  --lfs enable|disable    Enable or disable Git LFS for the project
+		  --max-file-size SIZE    Push rule limiting pushed file size, e.g. 100M (0 removes
+		                          the limit; GitLab only)
+		  --public                Create a public repository (create only; default: private)
+		  --team TEAM:PERMISSION  Grant an organization team pull, triage, push, maintain
+		                          or admin access (GitHub only; repeatable)
+		  --remove-team TEAM      Take away a team's access (GitHub settings only; repeatable)
+		  --org ORG               With settings --lfs, switch Git LFS for every repository
+		                          of the organization (GitHub only)
+		  -h, --help              Show this help message
+		  --version               Show the version, commit and build date
+
+		DESCRIPTION:
+		  The settings subcommand displays the Git LFS settings of a project.
+		  Options that change settings are applied first. On GitLab these are
+		  whether LFS is enabled, LFS and repository storage statistics, and the
+		  maximum pushed file size. On Bitbucket only whether LFS is enabled is
+		  available; Bitbucket Cloud always enables it, while Bitbucket Data Center
+		  lets repository admins switch it.
+
+		  The create subcommand creates an empty Bitbucket repository, given as
+		  WORKSPACE/SLUG on Bitbucket Cloud or PROJECT/SLUG on Bitbucket Data
+		  Center, or GitHub repository, given as OWNER/NAME, then applies --lfs.
+
+		  On GitHub, OWNER may be an organization: the repository is created
+		  under it, and --team grants its teams access, replacing a team's
+		  previous permission. settings shows the owner, the visibility and the
+		  teams of the repository after applying --lfs, --team and
+		  --remove-team. GitHub's API neither reads the Git LFS setting back
+		  nor offers an organization-wide switch, so --org ORG applies --lfs to
+		  each repository of the organization in turn. GitHub requests go
+		  through the GitHub CLI (gh), which must be authenticated with the
+		  admin:org scope for teams.
+
+		  GitLab authentication uses a personal access token with the 'api' scope,
+		  read from the GITLAB_TOKEN environment variable. Bitbucket authentication
+		  reads BITBUCKET_TOKEN: an HTTP access token with repository admin
+		  permission on Data Center, or an API token on Cloud, which also needs
+		  BITBUCKET_USERNAME.
+
+		  Push rules require GitLab Premium.
+
+		EXAMPLES:
+		  # Show LFS settings for the current repository's GitLab project
+		  git lfs-forge settings
+
+		  # Enable LFS and limit pushed files to 100 MB
+		  git lfs-forge settings --lfs enable --max-file-size 100M
+
+		  # Self-hosted instance
+		  git lfs-forge settings --gitlab-url https://gitlab.example.com -p team/assets
+
+		  # Create a private repository of a GitHub organization for two teams
+		  git lfs-forge create -p acme/assets --team artists:push --team leads:maintain
+
+		  # Disable Git LFS for every repository of a GitHub organization
+		  git lfs-forge settings --org acme --lfs disable
+
+		  # Create a Bitbucket Data Center repository with Git LFS enabled
+		  git lfs-forge create --url https://bitbucket.example.com -p PROJ/assets --lfs enable
+	`))
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	dryRun := flag.BoolP("dry-run", "d", false, "Only report problems; move nothing")
+	redownload := flag.Bool("download", false, "Download corrupt objects again from the LFS server")
+	remote := flag.StringP("remote", "r", "origin", "With --download, the Git remote whose LFS endpoint is used")
+	endpoint := flag.StringP("endpoint", "e", "", "With --download, the LFS endpoint to use instead of the remote's")
+	batchSize := flag.Int("batch-size", 100, "With --download, objects per Batch API request")
+	storageDir := flag.String("storage", "", "Object directory to check (default: the repository's, honoring lfs.storage)")
+	quarantineDir := flag.String("quarantine", "", "Where corrupt objects are moved (default: a new directory below .git/lfs/quarantine)")
+	jobs := flag.IntP("jobs", "j", runtime.NumCPU(), "Objects hashed in parallel")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-fsck-cache")
+	completion.Handle(completion.Command{Name: "git-lfs-fsck-cache", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+	}
+	if *jobs <= 0 {
+		printHelp("--jobs must be positive")
+	}
+	if *batchSize <= 0 {
+		printHelp("--batch-size must be positive")
+	}
+	if (*endpoint != "" || flag.CommandLine.Changed("remote")) && !*redownload {
+		printHelp("--remote and --endpoint only apply with --download")
+	}
+	if *dryRun && *redownload {
+		printHelp("--dry-run and --download cannot be combined")
+	}
+
+	storage := *storageDir
+	if storage == "" {
+		if err := common.CheckGitRepo(); err != nil {
+			common.PrintError("%v", err)
+		}
+		var err error
+		if storage, err = lfspointer.LocalStorage(); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+	if abs, err := filepath.Abs(storage); err == nil {
+		storage = abs
+	}
+	if _, err := os.Stat(storage); os.IsNotExist(err) {
+		fmt.Printf("✓ No local LFS objects in %s\n", storage)
+		return
+	}
+
+	files, err := listStorage(storage)
+	if err != nil {
+		common.PrintError("Failed to list %s: %v", storage, err)
+	}
+	objects := 0
+	var total int64
+	for _, f := range files {
+		if f.oid != "" {
+			objects++
+			total += f.size
+		}
+	}
+	fmt.Printf("Checking %d objects (%s) in %s\n", objects, common.FormatSize(total), storage)
+	for _, f := range files {
+		if f.problem == problemUnexpected {
+			fmt.Printf("  ? %s is not an object; left in place\n", relative(storage, f.path))
+		}
+	}
+	checkFiles(storage, files, *jobs, func(f *cacheFile) {
+		switch f.problem {
+		case problemCorrupt:
+			fmt.Printf("  ✗ %s is corrupt: its content hashes to %s\n", relative(storage, f.path), f.actual)
+		case problemMisplaced:
+			fmt.Printf("  ! %s is intact but belongs at %s\n", relative(storage, f.path), relative(storage, lfspointer.ObjectPath(storage, f.oid)))
+		case problemUnreadable:
+			fmt.Printf("  ✗ %s is unreadable: %v\n", relative(storage, f.path), f.err)
+		}
+	})
+
+	count := make(map[string]int)
+	for _, f := range files {
+		count[f.problem]++
+	}
+	fmt.Println()
+	fmt.Printf("Intact:      %d\n", count[""])
+	fmt.Printf("Corrupt:     %d\n", count[problemCorrupt])
+	fmt.Printf("Misplaced:   %d\n", count[problemMisplaced])
+	fmt.Printf("Unreadable:  %d\n", count[problemUnreadable])
+	fmt.Printf("Unexpected:  %d\n", count[problemUnexpected])
+	if count[problemCorrupt]+count[problemMisplaced]+count[problemUnreadable] == 0 {
+		fmt.Println("\n✓ Every object is intact and in place")
+		return
+	}
+	if *dryRun {
+		fmt.Println("\nDRY RUN: nothing was moved; run without --dry-run to quarantine corrupt objects")
+		os.Exit(1)
+	}
+
+	if *quarantineDir == "" {
+		*quarantineDir = filepath.Join(filepath.Dir(storage), "quarantine", time.Now().Format("20060102-150405"))
+	}
+	audit := common.StartAudit("git-lfs-fsck-cache", false)
+	fmt.Println()
+	// Corrupt objects go first, so that an intact misplaced copy can take
+	// their place
+	damaged := make(map[string]int64) // OID to size of the corrupt objects
+	for _, f := range files {
+		if f.problem != problemCorrupt {
+			continue
+		}
+		target, err := quarantine(f, *quarantineDir)
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("Failed to quarantine %s: %v", f.path, err)
+		}
+		audit.Deleted(f.path)
+		fmt.Printf("Quarantined %s to %s\n", relative(storage, f.path), target)
+		damaged[f.oid] = f.size
+	}
+	for _, f := range files {
+		if f.problem != problemMisplaced {
+			continue
+		}
+		moved, err := moveIntoPlace(storage, f)
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("Failed to move %s into place: %v", f.path, err)
+		}
+		if moved {
+			audit.Changed(lfspointer.ObjectPath(storage, f.oid))
+			fmt.Printf("Moved %s into place\n", relative(storage, f.path))
+			continue
+		}
+		// An intact copy is already in place
+		target, err := quarantine(f, *quarantineDir)
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("Failed to quarantine %s: %v", f.path, err)
+		}
+		audit.Deleted(f.path)
+		fmt.Printf("Quarantined the duplicate %s to %s\n", relative(storage, f.path), target)
+	}
+	var lost []string // Corrupt objects without an intact copy in place
+	for oid := range damaged {
+		if _, err := os.Stat(lfspointer.ObjectPath(storage, oid)); err != nil {
+			lost = append(lost, oid)
+		}
+	}
+	sort.Strings(lost)
+
+	failed := len(lost)
+	if *redownload && len(lost) > 0 {
+		failures, err := restore(lost, damaged, storage, *remote, *endpoint, *batchSize)
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("%v", err)
+		}
+		failed = len(failures)
+		for _, oid := range lost {
+			if failures[oid] == "" {
+				audit.Changed(lfspointer.ObjectPath(storage, oid))
+			}
+		}
+	}
+
+	fmt.Println()
+	switch {
+	case failed > 0 && *redownload:
+		err = fmt.Errorf("%d corrupt %s could not be downloaded again", failed, common.Plural(failed, "object", "objects"))
+	case failed > 0:
+		err = fmt.Errorf("%d corrupt %s quarantined; fetch again with --download or git lfs fetch", failed, common.Plural(failed, "object was", "objects were"))
+	case count[problemUnreadable] > 0:
+		err = fmt.Errorf("%d unreadable %s left in place", count[problemUnreadable], common.Plural(count[problemUnreadable], "file", "files"))
+	}
+	audit.Finish(err)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("✓ Every object is intact and in place")
+}
+
+// restore downloads the lost objects again. Their sizes come from the
+// pointers reachable in the repository, or else from the corrupt files.
+func restore(lost []string, damaged map[string]int64, storage, remote, endpoint string, batchSize int) (map[string]string, error) {
+	sizes := make(map[string]int64)
+	if common.CheckGitRepo() == nil {
+		pointers, err := lfspointer.Reachable()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pointers {
+			sizes[p.OID] = p.Size
+		}
+	}
+
+	var client *lfsapi.Client
+	if endpoint != "" {
+		client = lfsapi.NewClient(endpoint, true)
+	} else {
+		var err error
+		if client, _, err = lfsapi.NewRemoteClient(remote, "download"); err != nil {
+			return nil, err
+		}
+	}
+	objects := make([]lfsapi.Object, len(lost))
+	for i, oid := range lost {
+		size, ok := sizes[oid]
+		if !ok {
+			size = damaged[oid]
+		}
+		objects[i] = lfsapi.Object{OID: oid, Size: size}
+	}
+	fmt.Printf("\nDownloading %d %s from %s\n", len(objects), common.Plural(len(objects), "object", "objects"), client.Endpoint)
+	return download(client, objects, storage, batchSize)
+}
+
+// relative shortens a path below storage for messages
+func relative(storage, path string) string {
+	if rel, err := filepath.Rel(storage, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-fsck-cache - Verify every object in the local Git LFS cache
+
+		USAGE:
+		  git lfs-fsck-cache [OPTIONS]
+
+		OPTIONS:
+		  -d, --dry-run        Only report problems; move nothing
+		  --download           Download corrupt objects again from the LFS server
+		  -r, --remote NAME    With --download, the Git remote whose LFS endpoint
+		                       is used (default: origin)
+		  -e, --endpoint URL   With --download, the LFS endpoint to use instead
+		                       of the remote's
+		  --batch-size N       With --download, objects per Batch API request
+		                       (default: 100)
+		  --storage DIR        Object directory to check (default: the
+		                       repository's, honoring lfs.storage)
+		  --quarantine DIR     Where corrupt objects are moved (default: a new
+		                       directory below .git/lfs/quarantine)
+		  -j, --jobs N         Objects hashed in parallel (default: the number of
+		                       CPUs)
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Walks the local object directory (.git/lfs/objects), hashes every
+		  file in it, and compares the SHA-256 with the file name and with the
+		  path Git LFS derives from it (objects/OI/D_/OID). Unlike git lfs fsck,
+		  which only checks the objects that the current refs reference, every
+		  object is checked, including those of old commits and other branches
+		  that a cache kept for years accumulates.
+
+		  Corrupt objects, whose content no longer hashes to their name, are
+		  moved to the quarantine directory, so that Git LFS downloads them
+		  again instead of checking out damaged files; they are kept for
+		  inspection, delete them when no longer needed. Intact objects at the
+		  wrong path are moved into place, and duplicates of objects already in
+		  place are quarantined. Files whose names are not object IDs are
+		  reported and left alone.
+
+		  With --download, corrupt objects are fetched again from the LFS
+		  server right away; each is checked against its OID before it
+		  replaces anything. Without it, git lfs fetch or git lfs pull fetches
+		  them when they are needed.
+
+		  The exit status is 1 when corrupt objects remain without an intact
+		  copy in place, or files are unreadable, and with --dry-run when
+		  anything would be done.
+
+		EXAMPLES:
+		  # Check the cache without changing anything
+		  git lfs-fsck-cache --dry-run
+
+		  # Quarantine corrupt objects and download them again
+		  git lfs-fsck-cache --download
+
+		  # Check a shared object directory with 4 workers
+		  git lfs-fsck-cache --storage /srv/lfs-cache/objects -j 4
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
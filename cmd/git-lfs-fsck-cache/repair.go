@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// quarantine moves a file into dir, keeping its name, so that Git LFS no
+// longer serves it but it can still be inspected
+func quarantine(f cacheFile, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(f.path))
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(f.path), i))
+	}
+	return target, os.Rename(f.path, target)
+}
+
+// moveIntoPlace moves an intact object to the path of its OID. It returns
+// false without moving it when an object is already there.
+func moveIntoPlace(storage string, f cacheFile) (bool, error) {
+	target := lfspointer.ObjectPath(storage, f.oid)
+	if _, err := os.Lstat(target); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, err
+	}
+	return true, os.Rename(f.path, target)
+}
+
+// download fetches objects from the server into storage in batches of
+// batchSize, and returns the problem of each object that was not restored
+func download(client *lfsapi.Client, objects []lfsapi.Object, storage string, batchSize int) (map[string]string, error) {
+	failures := make(map[string]string)
+	for start := 0; start < len(objects); start += batchSize {
+		batch := objects[start:min(start+batchSize, len(objects))]
+		resp, err := client.Batch(lfsapi.BatchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: batch})
+		if err != nil {
+			return nil, fmt.Errorf("batch request failed: %v", err)
+		}
+
+		answers := make(map[string]lfsapi.Object)
+		for _, obj := range resp.Objects {
+			answers[obj.OID] = obj
+		}
+		for _, obj := range batch {
+			answer, ok := answers[obj.OID]
+			switch {
+			case !ok:
+				failures[obj.OID] = "not in batch response"
+			case answer.Error != nil:
+				failures[obj.OID] = fmt.Sprintf("HTTP %d: %s", answer.Error.Code, answer.Error.Message)
+			case answer.Actions["download"].Href == "":
+				failures[obj.OID] = "no download action"
+			default:
+				if err := downloadObject(client, answer.Actions["download"], obj, storage); err != nil {
+					failures[obj.OID] = err.Error()
+					fmt.Printf("  ✗ %s: %v\n", obj.OID, err)
+					continue
+				}
+				fmt.Printf("  ✓ %s (restored)\n", obj.OID)
+			}
+		}
+	}
+	return failures, nil
+}
+
+// downloadObject downloads one object to a temporary file next to its
+// place, checks its hash, and only then moves it into place, so
+// that Git LFS never reads a partial object
+func downloadObject(client *lfsapi.Client, action lfsapi.Action, obj lfsapi.Object, storage string) error {
+	body, err := client.Download(action)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	target := lfspointer.ObjectPath(storage, obj.OID)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".fsck-"+obj.OID[:12]+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	// The hash also covers the size, which may not be known for certain
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != obj.OID {
+		return fmt.Errorf("received content hashes to %s", actual)
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// Problems found with a file in local storage
+const (
+	problemCorrupt    = "corrupt"    // The content does not hash to the name
+	problemMisplaced  = "misplaced"  // Intact, but not at the path of its OID
+	problemUnexpected = "unexpected" // The name is not an OID
+	problemUnreadable = "unreadable"
+)
+
+// cacheFile is a file in local storage and what was found when checking it
+type cacheFile struct {
+	path    string // Absolute
+	oid     string // From the file name; "" for an unexpected file
+	size    int64
+	actual  string // What the content hashes to
+	problem string // "" for an intact object at its place
+	err     error  // Why it is unreadable
+}
+
+// listStorage returns the regular files below storage
+func listStorage(storage string) ([]cacheFile, error) {
+	var files []cacheFile
+	err := filepath.WalkDir(storage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := cacheFile{path: path, size: info.Size()}
+		if name := d.Name(); lfspointer.ValidOID(name) {
+			f.oid = name
+		} else {
+			f.problem = problemUnexpected
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// checkFiles hashes the objects among files with jobs workers, calling
+// progress after each, and records their problems
+func checkFiles(storage string, files []cacheFile, jobs int, progress func(*cacheFile)) {
+	work := make(chan *cacheFile)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				checkFile(storage, f)
+				mu.Lock()
+				progress(f)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		if files[i].problem == "" {
+			work <- &files[i]
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// checkFile hashes an object and compares the hash to its name and path
+func checkFile(storage string, f *cacheFile) {
+	f.actual, f.err = hashFile(f.path)
+	switch {
+	case f.err != nil:
+		f.problem = problemUnreadable
+	case f.actual != f.oid:
+		f.problem = problemCorrupt
+	case f.path != lfspointer.ObjectPath(storage, f.oid):
+		f.problem = problemMisplaced
+	}
+}
+
+// hashFile returns the SHA-256 of the content of a file in hex
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// store is a local LFS object directory and the bare repositories using it
+type store struct {
+	Path       string   `json:"path"`
+	Repos      []string `json:"repos"`
+	Objects    int      `json:"objects"`
+	Bytes      int64    `json:"bytes"`
+	Referenced int      `json:"referenced"`
+	Young      int      `json:"young"`     // Unreferenced but within --min-age
+	Pruned     int      `json:"pruned"`    // Deleted, or would be deleted on a dry run
+	Reclaimed  int64    `json:"reclaimed"` // Bytes of the pruned objects
+	Failed     int      `json:"failed"`    // Deletions that failed
+	Error      string   `json:"error,omitempty"`
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	root := flag.StringP("root", "r", "", "Collect every bare repository below this directory")
+	minAge := flag.Duration("min-age", 7*24*time.Hour, "Keep unreferenced objects modified more recently than this")
+	dryRun := flag.BoolP("dry-run", "d", false, "Report what would be pruned without deleting anything")
+	asJSON := flag.Bool("json", false, "Print the report as JSON")
+	verbose := flag.BoolP("verbose", "v", false, "List every pruned object")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-gc-server")
+	completion.Handle(completion.Command{Name: "git-lfs-gc-server", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+	if *root == "" && flag.NArg() == 0 {
+		printHelp()
+		os.Exit(1)
+	}
+	if *minAge < 0 {
+		common.PrintError("--min-age must not be negative")
+	}
+	if err := prereq.Verify(prereq.Git); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	repos := flag.Args()
+	if *root != "" {
+		found, err := findBareRepos(*root)
+		if err != nil {
+			common.PrintError("Failed to scan %s: %v", *root, err)
+		}
+		repos = append(repos, found...)
+	}
+	if len(repos) == 0 {
+		common.PrintError("No bare repositories found")
+	}
+
+	stores, err := groupByStore(repos)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	audit := common.StartAudit("git-lfs-gc-server", common.DryRun)
+	cutoff := time.Now().Add(-*minAge)
+	failed := false
+	for _, s := range stores {
+		collect(s, cutoff, *verbose && !*asJSON, audit)
+		failed = failed || s.Error != "" || s.Failed > 0
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(stores, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printReport(stores, *minAge)
+	}
+
+	var auditErr error
+	if failed {
+		auditErr = fmt.Errorf("some stores were not collected completely")
+	}
+	audit.Finish(auditErr)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// findBareRepos returns the bare repositories below root, without looking
+// inside them
+func findBareRepos(root string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if isBareRepo(path) {
+			repos = append(repos, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repos, err
+}
+
+// isBareRepo reports whether dir looks like a bare repository and git agrees
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "--is-bare-repository").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// groupByStore resolves the LFS storage of each repository, honoring
+// lfs.storage, and groups repositories that share one
+func groupByStore(repos []string) ([]*store, error) {
+	byPath := make(map[string]*store)
+	for _, repo := range repos {
+		abs, err := filepath.Abs(repo)
+		if err != nil {
+			return nil, err
+		}
+		if !isBareRepo(abs) {
+			return nil, fmt.Errorf("%s is not a bare Git repository", repo)
+		}
+		path, err := lfspointer.LocalStorageIn(abs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", repo, err)
+		}
+		s := byPath[path]
+		if s == nil {
+			s = &store{Path: path}
+			byPath[path] = s
+		}
+		s.Repos = append(s.Repos, abs)
+	}
+
+	stores := make([]*store, 0, len(byPath))
+	for _, s := range byPath {
+		sort.Strings(s.Repos)
+		stores = append(stores, s)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].Path < stores[j].Path })
+	return stores, nil
+}
+
+// collect prunes the objects of a store that no repository using it can
+// reach. When any repository cannot be read, nothing is pruned, because its
+// objects would look unreferenced.
+func collect(s *store, cutoff time.Time, verbose bool, audit *common.Audit) {
+	referenced := make(map[string]bool)
+	for _, repo := range s.Repos {
+		pointers, err := lfspointer.ReachableIn(repo)
+		if err != nil {
+			s.Error = fmt.Sprintf("%s: %v; nothing pruned", repo, err)
+			return
+		}
+		for _, p := range pointers {
+			referenced[p.OID] = true
+		}
+	}
+
+	if _, err := os.Stat(s.Path); os.IsNotExist(err) {
+		return // No LFS object was ever pushed
+	}
+	err := filepath.WalkDir(s.Path, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !lfspointer.ValidOID(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.Objects++
+		s.Bytes += info.Size()
+		switch {
+		case referenced[d.Name()]:
+			s.Referenced++
+		case info.ModTime().After(cutoff):
+			// A push uploads objects before it updates refs
+			s.Young++
+		default:
+			prune(s, path, info.Size(), verbose, audit)
+		}
+		return nil
+	})
+	if err != nil {
+		s.Error = fmt.Sprintf("failed to scan %s: %v", s.Path, err)
+	}
+	if !common.DryRun {
+		removeEmptyDirs(s.Path)
+	}
+}
+
+// prune deletes one object file and counts it
+func prune(s *store, path string, size int64, verbose bool, audit *common.Audit) {
+	if common.DryRun {
+		if verbose {
+			fmt.Printf("DRY RUN: rm %s\n", path)
+		}
+	} else {
+		if err := os.Remove(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete %s: %v\n", path, err)
+			s.Failed++
+			return
+		}
+		if verbose {
+			fmt.Printf("Deleted %s\n", path)
+		}
+		audit.Deleted(path)
+	}
+	s.Pruned++
+	s.Reclaimed += size
+}
+
+// removeEmptyDirs removes the OO/ID and then OO directories that pruning
+// emptied
+func removeEmptyDirs(root string) {
+	for _, pattern := range []string{"*/*", "*"} {
+		dirs, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, dir := range dirs {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				os.Remove(dir) // Fails, harmlessly, unless empty
+			}
+		}
+	}
+}
+
+func printReport(stores []*store, minAge time.Duration) {
+	verb := "Pruned"
+	if common.DryRun {
+		verb = "Would prune"
+	}
+
+	var total, reclaimed int64
+	var pruned int
+	for _, s := range stores {
+		fmt.Printf("\n%s\n", s.Path)
+		for _, repo := range s.Repos {
+			fmt.Printf("  used by %s\n", repo)
+		}
+		if s.Error != "" {
+			fmt.Printf("  ✗ %s\n", s.Error)
+			continue
+		}
+		fmt.Printf("  Objects:      %d (%s)\n", s.Objects, common.FormatSize(s.Bytes))
+		fmt.Printf("  Referenced:   %d\n", s.Referenced)
+		if s.Young > 0 {
+			fmt.Printf("  Kept (young): %d, unreferenced but newer than %s\n", s.Young, minAge)
+		}
+		fmt.Printf("  %s: %d (%s)\n", verb, s.Pruned, common.FormatSize(s.Reclaimed))
+		if s.Failed > 0 {
+			fmt.Printf("  ✗ Failed to delete %d objects\n", s.Failed)
+		}
+		total += s.Bytes
+		pruned += s.Pruned
+		reclaimed += s.Reclaimed
+	}
+
+	fmt.Printf("\n%s %d objects in %d stores, reclaiming %s of %s\n",
+		verb, pruned, len(stores), common.FormatSize(reclaimed), common.FormatSize(total))
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-gc-server - Prune unreachable Git LFS objects from bare repositories
+
+		USAGE:
+		  git lfs-gc-server [OPTIONS] REPO.git ...
+		  git lfs-gc-server [OPTIONS] --root DIR
+
+		OPTIONS:
+		  -r, --root DIR        Collect every bare repository below DIR
+		  --min-age DURATION    Keep unreferenced objects modified more recently
+		                        (default: 168h)
+		  -d, --dry-run         Report what would be pruned without deleting
+		  -v, --verbose         List every pruned object
+		  --json                Print the report as JSON
+		  -h, --help            Show this help message
+		  --version             Show the version, commit and build date
+
+		DESCRIPTION:
+		  Run on the server that hosts bare repositories, such as those made by
+		  git-new-bare-repo, whose Git LFS objects are stored locally: in
+		  REPO.git/lfs/objects, or in a directory shared by several repositories
+		  through lfs.storage.
+
+		  Repositories are grouped by the store they use. An object is pruned
+		  only when no commit reachable from any ref or reflog entry of any
+		  repository in its group references it, and it is older than
+		  --min-age, because a push uploads objects before it updates refs. If
+		  any repository of a group cannot be read, nothing in that store is
+		  pruned.
+
+		  Every repository sharing a store must be named, or be below --root;
+		  objects that only an omitted repository references would be pruned.
+
+		  The report lists, per store, its repositories, the objects and bytes
+		  it holds, how many are referenced or kept for being young, and the
+		  space reclaimed. Deletions are recorded in the audit log when
+		  audit.path is set. The exit status is 1 when a store could not be
+		  collected completely.
+
+		EXAMPLES:
+		  # Preview, then collect, every repository on the server
+		  git lfs-gc-server --dry-run --root /srv/git
+		  git lfs-gc-server --root /srv/git
+
+		  # Two repositories sharing one store, keeping objects younger than a month
+		  git lfs-gc-server --min-age 720h /srv/git/game.git /srv/git/game-assets.git
+	`))
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// lfsHooks are the hooks that git lfs install writes, in the order they are reported
+var lfsHooks = []string{"pre-push", "post-checkout", "post-commit", "post-merge"}
+
+// hookMarker identifies hooks written by this command
+const hookMarker = "# Installed by git-lfs-hooks"
+
+// projectSuffix is appended to the name of a project hook that a merged
+// hook runs before Git LFS
+const projectSuffix = ".project"
+
+// lfsCheck is the line of Git LFS hooks that fails clearly when git-lfs is
+// not installed
+const lfsCheck = `command -v git-lfs >/dev/null 2>&1 || { printf >&2 "\n%s\n\n" "This repository is configured for Git LFS but 'git-lfs' was not found on your path."; exit 2; }`
+
+// state is the installation state of one hook
+type state int
+
+const (
+	stateCurrent       state = iota // Runs Git LFS as current versions of git lfs install do
+	stateOutdated                   // Runs Git LFS, but without checking that git-lfs is installed
+	stateMissing                    // No hook
+	stateForeign                    // A project hook that does not run Git LFS
+	stateNotExecutable              // Runs Git LFS, but Git skips it
+)
+
+// hook is the state of one hook in the hooks directory
+type hook struct {
+	name    string
+	path    string
+	state   state
+	owner   string // Command that wrote the hook: git-lfs-hooks, git-lfs-teamsetup or ""
+	project string // With a merged hook, the project hook it runs first
+}
+
+// ok reports whether the hook runs Git LFS as it should
+func (h hook) ok() bool {
+	return h.state == stateCurrent
+}
+
+// describe explains the state of the hook
+func (h hook) describe() string {
+	switch h.state {
+	case stateMissing:
+		return "missing"
+	case stateForeign:
+		return "project hook that does not run Git LFS"
+	case stateNotExecutable:
+		return "runs Git LFS but is not executable, so Git skips it"
+	case stateOutdated:
+		return "Git LFS hook without the check that git-lfs is installed"
+	}
+	switch {
+	case h.project != "":
+		return fmt.Sprintf("runs %s, then Git LFS", filepath.Base(h.project))
+	case h.owner == "git-lfs-teamsetup":
+		return "team hook of git-lfs-teamsetup, then Git LFS"
+	}
+	return "Git LFS hook, current"
+}
+
+// invokesLFS matches the line of a hook that runs the Git LFS hook of NAME
+func invokesLFS(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[\s|;&])git[ -]lfs ` + regexp.QuoteMeta(name) + `( "\$@")?(\s|$)`)
+}
+
+// inspect reads the state of the hook name in dir
+func inspect(dir, name string) hook {
+	h := hook{name: name, path: filepath.Join(dir, name)}
+	info, err := os.Stat(h.path)
+	if err != nil {
+		h.state = stateMissing
+		return h
+	}
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		h.state = stateForeign
+		return h
+	}
+	content := string(data)
+	switch {
+	case strings.Contains(content, hookMarker):
+		h.owner = "git-lfs-hooks"
+		if strings.Contains(content, name+projectSuffix) {
+			h.project = h.path + projectSuffix
+		}
+	case strings.Contains(content, "# Installed by git-lfs-teamsetup"):
+		h.owner = "git-lfs-teamsetup"
+	}
+
+	switch {
+	case !invokesLFS(name).MatchString(content):
+		h.state = stateForeign
+	case info.Mode()&0111 == 0:
+		h.state = stateNotExecutable
+	case !strings.Contains(content, "command -v git-lfs"):
+		h.state = stateOutdated
+	default:
+		h.state = stateCurrent
+	}
+	return h
+}
+
+// onlyLFS reports whether a hook does nothing but run Git LFS, so that
+// rewriting it loses nothing
+func onlyLFS(content, name string) bool {
+	pattern := invokesLFS(name)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "command -v git-lfs") || pattern.MatchString(line) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// lfsHook returns the hook that runs only Git LFS
+func lfsHook(name string) string {
+	return fmt.Sprintf("#!/bin/sh\n%s\n%s\ngit lfs %s \"$@\"\n", hookMarker, lfsCheck, name)
+}
+
+// mergedHook returns a hook that runs the project hook moved to
+// NAME.project, then Git LFS. Standard input, the refs given to pre-push,
+// is passed to both.
+func mergedHook(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n%s: runs %s%s, then Git LFS\n", hookMarker, name, projectSuffix)
+	b.WriteString(lfsCheck + "\n")
+	b.WriteString("input=$(cat)\n")
+	b.WriteString("feed() { if [ -n \"$input\" ]; then printf '%s\\n' \"$input\"; fi; }\n")
+	fmt.Fprintf(&b, "hook=\"$(dirname \"$0\")/%s%s\"\n", name, projectSuffix)
+	b.WriteString("if [ -x \"$hook\" ]; then\n")
+	b.WriteString("  feed | \"$hook\" \"$@\" || exit $?\n")
+	b.WriteString("fi\n")
+	fmt.Fprintf(&b, "feed | git lfs %s \"$@\"\n", name)
+	return b.String()
+}
+
+// repair makes a hook run Git LFS: a missing hook or one that only runs
+// Git LFS is (re)written, a project hook is moved aside and run by a merged
+// hook, and a hook that runs Git LFS among other things is made executable
+// or left for the user to update. It returns the files it created or
+// changed, and a message when it left the hook alone.
+func repair(h hook, dryRun bool) (created, changed []string, skipped string, err error) {
+	content := ""
+	if data, err := os.ReadFile(h.path); err == nil {
+		content = string(data)
+	}
+	write := func(path, text string) error {
+		if dryRun {
+			fmt.Printf("  DRY RUN: write %s\n", path)
+			return nil
+		}
+		if err := os.WriteFile(path, []byte(text), 0755); err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of an existing file
+		return os.Chmod(path, 0755)
+	}
+
+	switch h.state {
+	case stateMissing:
+		if !dryRun {
+			if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		return []string{h.path}, nil, "", write(h.path, lfsHook(h.name))
+
+	case stateNotExecutable:
+		if dryRun {
+			fmt.Printf("  DRY RUN: chmod +x %s\n", h.path)
+			return nil, []string{h.path}, "", nil
+		}
+		info, err := os.Stat(h.path)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return nil, []string{h.path}, "", os.Chmod(h.path, info.Mode()|0111)
+
+	case stateOutdated:
+		if !onlyLFS(content, h.name) {
+			return nil, nil, "it runs more than Git LFS; add the git-lfs check yourself (see 'git lfs update --manual')", nil
+		}
+		return nil, []string{h.path}, "", write(h.path, lfsHook(h.name))
+
+	case stateForeign:
+		project := h.path + projectSuffix
+		if _, err := os.Stat(project); err == nil {
+			return nil, nil, fmt.Sprintf("%s already exists; merge the hooks yourself", filepath.Base(project)), nil
+		}
+		if dryRun {
+			fmt.Printf("  DRY RUN: mv %s %s\n", h.path, project)
+		} else if err := os.Rename(h.path, project); err != nil {
+			return nil, nil, "", err
+		}
+		if err := write(h.path, mergedHook(h.name)); err != nil {
+			return nil, nil, "", err
+		}
+		return []string{project}, []string{h.path}, "", nil
+	}
+	return nil, nil, "", nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	repairHooks := flag.Bool("repair", false, "Install missing hooks and update outdated ones")
+	dryRun := flag.BoolP("dry-run", "d", false, "With --repair, show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-hooks")
+	completion.Handle(completion.Command{Name: "git-lfs-hooks", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+	}
+	if *dryRun && !*repairHooks {
+		printHelp("--dry-run requires --repair")
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	hooksDir, err := gitOutput("rev-parse", "--path-format=absolute", "--git-path", "hooks")
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("Hooks directory: %s\n", hooksDir)
+	if hooksPath, _ := gitOutput("config", "--get", "core.hooksPath"); hooksPath != "" {
+		fmt.Printf("  Set by core.hooksPath = %s\n", hooksPath)
+		if top, err := gitOutput("rev-parse", "--show-toplevel"); err == nil && within(hooksDir, top) {
+			fmt.Println("  It is in the working tree: commit the hooks so that everyone gets them")
+		}
+	}
+	fmt.Println()
+
+	hooks := make([]hook, 0, len(lfsHooks))
+	failing := 0
+	for _, name := range lfsHooks {
+		h := inspect(hooksDir, name)
+		hooks = append(hooks, h)
+		mark := "✓"
+		if !h.ok() {
+			mark = "✗"
+			failing++
+		}
+		fmt.Printf("  %s %-14s %s\n", mark, h.name, h.describe())
+	}
+
+	if !*repairHooks {
+		if failing > 0 {
+			fmt.Printf("\n%d of %d Git LFS hooks need attention; run 'git lfs-hooks --repair'\n", failing, len(lfsHooks))
+			os.Exit(1)
+		}
+		fmt.Println("\n✓ All Git LFS hooks are installed and current")
+		return
+	}
+	if failing == 0 {
+		fmt.Println("\n✓ All Git LFS hooks are installed and current; nothing to repair")
+		return
+	}
+
+	if err := prereq.Verify(prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Println("\nRepairing hooks...")
+	audit := common.StartAudit("git-lfs-hooks", *dryRun)
+	left := 0
+	for _, h := range hooks {
+		if h.ok() {
+			continue
+		}
+		created, changed, skipped, err := repair(h, *dryRun)
+		if err != nil {
+			audit.Finish(err)
+			common.PrintError("Failed to repair %s: %v", h.name, err)
+		}
+		if skipped != "" {
+			fmt.Printf("  ⚠ %s left unchanged: %s\n", h.name, skipped)
+			left++
+			continue
+		}
+		fmt.Printf("  ✓ %s repaired\n", h.name)
+		if !*dryRun {
+			for _, path := range created {
+				audit.Created(path)
+			}
+			for _, path := range changed {
+				audit.Changed(path)
+			}
+		}
+	}
+	audit.Finish(nil)
+
+	if left > 0 {
+		fmt.Printf("\n%d hook(s) need to be updated by hand\n", left)
+		os.Exit(1)
+	}
+	fmt.Println("\n✓ Git LFS hooks repaired")
+}
+
+// within reports whether path is dir or inside it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// gitOutput runs a git command and returns its trimmed output
+func gitOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	}
+	fmt.Print(dedent.Dedent(`
+		git-lfs-hooks - Report and repair the Git LFS hooks of a repository
+
+		USAGE:
+		  git lfs-hooks [OPTIONS]
+
+		OPTIONS:
+		  --repair              Install missing hooks and update outdated ones
+		  -d, --dry-run         With --repair, show what would be done without doing it
+		  --trace               Print every external command before running it
+		  -h, --help            Show this help message
+		  --version             Show the version, commit and build date
+
+		DESCRIPTION:
+		  Git LFS relies on the pre-push, post-checkout, post-commit and
+		  post-merge hooks: without pre-push, objects are not uploaded and the
+		  remote receives pointers to files it does not have. This command
+		  reports the state of each hook in the hooks directory, which is
+		  .git/hooks unless core.hooksPath names another one:
+
+		    current           Runs Git LFS and fails clearly without git-lfs
+		    outdated          Runs Git LFS, written by an old 'git lfs install'
+		    not executable    Runs Git LFS, but Git skips it
+		    project hook      Another hook that does not run Git LFS
+		    missing           No hook
+
+		  It exits with status 1 when any hook is not current.
+
+		  --repair fixes each hook without losing what the project's hooks do,
+		  unlike 'git lfs update --force', which overwrites them:
+
+		    - A missing hook, or an outdated one that only runs Git LFS, is
+		      written
+		    - A hook that runs Git LFS but is not executable is made executable
+		    - A project hook is renamed NAME.project and replaced by a hook that
+		      runs it, then Git LFS. If it fails, Git LFS does not run and the
+		      Git operation is stopped as before.
+		    - An outdated hook that runs other commands too is left alone with a
+		      message, as is a project hook when NAME.project already exists
+
+		  When core.hooksPath points into the working tree, the hooks are
+		  shared with the team; commit the repaired hooks.
+
+		EXAMPLES:
+		  # Check the hooks
+		  git lfs-hooks
+
+		  # Preview the repair
+		  git lfs-hooks --repair --dry-run
+
+		  # Install missing hooks and merge project hooks with Git LFS
+		  git lfs-hooks --repair
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	visibility := flag.String("visibility", "", "Only public or only private repositories")
+	archived := flag.Bool("archived", false, "Include archived repositories")
+	forks := flag.Bool("forks", false, "Include forks")
+	match := flag.String("match", "", "Only repositories whose name matches this glob, e.g. 'game-*'")
+	language := flag.String("language", "", "Only repositories whose main language is this")
+	pushedSince := flag.String("pushed-since", "", "Only repositories pushed to since this date (YYYY-MM-DD)")
+	lfsOnly := flag.Bool("lfs-only", false, "Only list repositories that use Git LFS")
+	asJSON := flag.Bool("json", false, "Print the inventory as JSON")
+	jobs := flag.IntP("jobs", "j", 8, "Repositories checked in parallel")
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-inventory")
+	completion.Handle(completion.Command{Name: "git-lfs-inventory", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 1 {
+		printHelp("Unexpected argument: " + flag.Arg(1))
+	}
+	if *jobs <= 0 {
+		printHelp("--jobs must be positive")
+	}
+	filter := github.RepoFilter{
+		Visibility: *visibility,
+		Archived:   *archived,
+		Forks:      *forks,
+		Match:      *match,
+		Language:   *language,
+	}
+	if *pushedSince != "" {
+		since, err := time.Parse("2006-01-02", *pushedSince)
+		if err != nil {
+			printHelp(fmt.Sprintf("--pushed-since: invalid date '%s'; use YYYY-MM-DD", *pushedSince))
+		}
+		filter.PushedSince = since
+	}
+
+	if err := github.CheckGHInstalled(); err != nil {
+		common.PrintError("%v", err)
+	}
+	owner := flag.Arg(0)
+	if owner == "" {
+		var err error
+		owner, err = github.CurrentUser()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+
+	repos, err := github.ListRepos(owner, filter)
+	if err != nil {
+		common.PrintError("Failed to list the repositories of %s: %v", owner, err)
+	}
+	if !*asJSON {
+		fmt.Fprintf(os.Stderr, "Checking .gitattributes of %d repositories of %s...\n", len(repos), owner)
+	}
+	results := scanRepos(repos, *jobs)
+
+	var listed []repoLFS
+	usingLFS, failed := 0, 0
+	for _, r := range results {
+		if r.usesLFS() {
+			usingLFS++
+		}
+		if r.Error != "" {
+			failed++
+		}
+		if !*lfsOnly || r.usesLFS() {
+			listed = append(listed, r)
+		}
+	}
+
+	if *asJSON {
+		if listed == nil {
+			listed = []repoLFS{}
+		}
+		data, _ := json.MarshalIndent(listed, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printTable(listed)
+		fmt.Printf("\n%d repositories, %d use Git LFS\n", len(results), usingLFS)
+	}
+	if failed > 0 {
+		common.PrintError("Failed to read .gitattributes of %d repositories", failed)
+	}
+}
+
+// printTable prints one line per repository
+func printTable(repos []repoLFS) {
+	width := len("REPOSITORY")
+	for _, r := range repos {
+		width = max(width, len(r.FullName))
+	}
+	fmt.Printf("%-*s  %-10s  %-3s  %-10s  %s\n", width, "REPOSITORY", "VISIBILITY", "LFS", "PUSHED", "PATTERNS")
+	for _, r := range repos {
+		visibility := "public"
+		if r.Private {
+			visibility = "private"
+		}
+		lfs, patterns := "no", ""
+		switch {
+		case r.Error != "":
+			lfs, patterns = "?", r.Error
+		case r.usesLFS():
+			lfs, patterns = "yes", strings.Join(r.Patterns, " ")
+		case !r.Attributes:
+			patterns = "(no .gitattributes)"
+		}
+		pushed := "never"
+		if !r.PushedAt.IsZero() {
+			pushed = r.PushedAt.Format("2006-01-02")
+		}
+		fmt.Printf("%-*s  %-10s  %-3s  %-10s  %s\n", width, r.FullName, visibility, lfs, pushed, patterns)
+	}
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-inventory - List the GitHub repositories of an account and which use Git LFS
+
+		USAGE:
+		  git lfs-inventory [OPTIONS] [OWNER]
+
+		OPTIONS:
+		  --visibility public|private
+		                          Only public or only private repositories
+		  --archived              Include archived repositories
+		  --forks                 Include forks
+		  --match GLOB            Only repositories whose name matches GLOB,
+		                          case-insensitively, e.g. 'game-*'
+		  --language NAME         Only repositories whose main language is NAME
+		  --pushed-since DATE     Only repositories pushed to since DATE (YYYY-MM-DD)
+		  --lfs-only              Only list repositories that use Git LFS
+		  --json                  Print the inventory as JSON
+		  -j, --jobs N            Repositories checked in parallel (default: 8)
+		  --timeout DURATION      Stop a GitHub API call that takes longer, e.g. 1m
+		  --retries N             Retry a failed GitHub API call N times (default: 2)
+		  -h, --help              Show this help message
+		  --version               Show the version, commit and build date
+
+		DESCRIPTION:
+		  Lists the repositories of OWNER, a GitHub user or organization, or of
+		  the authenticated user by default, and reads the .gitattributes at the
+		  root of each default branch with the GitHub contents API, without
+		  cloning anything. A repository uses Git LFS when a line of it sets
+		  filter=lfs; the patterns of those lines are shown.
+
+		  Only the root .gitattributes is read: rules in .gitattributes files of
+		  subdirectories, and LFS objects committed before tracking was set up,
+		  are not seen. Run git lfs-report in a clone for the full picture.
+
+		  Archived repositories and forks are skipped unless asked for. The
+		  private repositories of OWNER are listed when the authenticated user
+		  can see them: their own, and those of organizations they belong to.
+
+		  Requires:
+		    - gh (GitHub CLI), authenticated
+
+		EXAMPLES:
+		  # Your own repositories
+		  git lfs-inventory
+
+		  # Repositories of an organization that use Git LFS, as JSON
+		  git lfs-inventory --lfs-only --json myorg
+
+		  # Private game repositories pushed to this year
+		  git lfs-inventory --visibility private --match 'game-*' --pushed-since 2026-01-01 myorg
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
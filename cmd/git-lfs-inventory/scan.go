@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// repoLFS is a repository and the Git LFS patterns of its root .gitattributes
+type repoLFS struct {
+	github.ListedRepo
+	Attributes bool     `json:"gitattributes"` // Whether the root .gitattributes exists
+	Patterns   []string `json:"lfs_patterns"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// usesLFS reports whether the repository tracks any pattern with Git LFS
+func (r *repoLFS) usesLFS() bool {
+	return len(r.Patterns) > 0
+}
+
+// scanRepos reads the root .gitattributes of each repository, jobs at a
+// time, keeping the order of repos
+func scanRepos(repos []github.ListedRepo, jobs int) []repoLFS {
+	results := make([]repoLFS, len(repos))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = scanRepo(repos[i])
+			}
+		}()
+	}
+	for i := range repos {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+func scanRepo(repo github.ListedRepo) repoLFS {
+	r := repoLFS{ListedRepo: repo, Patterns: []string{}}
+	content, found, err := github.FileContent(repo.FullName, ".gitattributes")
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Attributes = found
+	if found {
+		if patterns := lfsfiles.LFSPatterns(string(content)); patterns != nil {
+			r.Patterns = patterns
+		}
+	}
+	return r
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+// storedObject is an LFS object found on the server
+type storedObject struct {
+	oid     string
+	size    int64
+	path    string // Empty for objects checked via the Batch API
+	modTime time.Time
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	storage := flag.StringP("storage", "s", "", "Server-side LFS storage directory to scan")
+	prefix := flag.StringP("prefix", "p", "", "Only scan STORAGE/PREFIX, e.g. the ORG/REPO directory of a giftless store")
+	endpoint := flag.StringP("endpoint", "e", "", "LFS endpoint to query with the Batch API instead of scanning storage")
+	candidates := flag.String("candidates", "", "File of oids to check on the endpoint, one per line (with --endpoint)")
+	minAge := flag.Duration("min-age", 24*time.Hour, "Ignore objects modified more recently than this")
+	batchSize := flag.Int("batch-size", 100, "Objects per Batch API request")
+	deleteOrphans := flag.Bool("delete", false, "Delete orphaned objects from the storage directory")
+	dryRun := flag.BoolP("dry-run", "d", false, "With --delete, show what would be deleted without deleting")
+	yes := flag.BoolP("yes", "y", false, "With --delete, delete without asking for confirmation")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-orphans")
+	completion.Handle(completion.Command{Name: "git-lfs-orphans", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	if (*storage == "") == (*endpoint == "") {
+		common.PrintError("Specify exactly one of --storage or --endpoint")
+	}
+	if *endpoint != "" && *candidates == "" {
+		common.PrintError("--endpoint needs --candidates: the Batch API cannot list the objects on a server")
+	}
+	if *deleteOrphans && *storage == "" {
+		common.PrintError("--delete needs --storage: the Batch API cannot delete objects")
+	}
+	if *batchSize <= 0 {
+		common.PrintError("--batch-size must be positive")
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if *deleteOrphans {
+		// A shallow clone lacks history that may still reference objects
+		if shallow, _ := common.ExecGitCommand("rev-parse", "--is-shallow-repository"); strings.TrimSpace(shallow) == "true" {
+			common.PrintError("--delete refuses to run in a shallow clone, whose missing history may reference the objects; run 'git fetch --unshallow' first")
+		}
+	}
+
+	referenced, err := referencedOIDs()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("Objects referenced by any ref: %d\n", len(referenced))
+
+	var stored []storedObject
+	if *storage != "" {
+		root := filepath.Join(*storage, filepath.FromSlash(*prefix))
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			common.PrintError("Storage directory %s does not exist", root)
+		}
+		if stored, err = scanStorage(root); err != nil {
+			common.PrintError("Failed to scan %s: %v", root, err)
+		}
+		fmt.Printf("Objects in %s: %d\n", root, len(stored))
+	} else {
+		if stored, err = queryEndpoint(*endpoint, *candidates, *batchSize); err != nil {
+			common.PrintError("%v", err)
+		}
+		fmt.Printf("Candidate objects present on %s: %d\n", *endpoint, len(stored))
+	}
+
+	var orphans []storedObject
+	recent := 0
+	cutoff := time.Now().Add(-*minAge)
+	for _, obj := range stored {
+		if referenced[obj.oid] {
+			continue
+		}
+		// Pushes upload objects before updating refs, so young objects may
+		// belong to a push in progress
+		if !obj.modTime.IsZero() && obj.modTime.After(cutoff) {
+			recent++
+			continue
+		}
+		orphans = append(orphans, obj)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].oid < orphans[j].oid })
+
+	fmt.Println()
+	if len(orphans) == 0 {
+		fmt.Println("✓ No orphaned objects found")
+	} else {
+		var total int64
+		fmt.Println("Orphaned objects:")
+		for _, obj := range orphans {
+			total += obj.size
+			if obj.path != "" {
+				fmt.Printf("  %s  %10s  %s\n", obj.oid, common.FormatSize(obj.size), obj.path)
+			} else {
+				fmt.Printf("  %s  %10s\n", obj.oid, common.FormatSize(obj.size))
+			}
+		}
+		fmt.Printf("\nOrphans: %d (%s)\n", len(orphans), common.FormatSize(total))
+	}
+	if recent > 0 {
+		fmt.Printf("Skipped %d unreferenced objects younger than %s\n", recent, *minAge)
+	}
+
+	if *deleteOrphans && len(orphans) > 0 {
+		if !*dryRun && !*yes && !confirm("\nDelete the orphaned objects listed above from the server? Objects referenced only by refs this clone lacks are lost too") {
+			fmt.Println("Nothing deleted")
+			os.Exit(1)
+		}
+		deleteObjects(orphans, *dryRun)
+	}
+}
+
+// referencedOIDs returns every oid in a blob reachable from any ref or
+// reflog entry, including the blobs that only a merge commit introduced
+func referencedOIDs() (map[string]bool, error) {
+	pointers, err := lfspointer.Reachable()
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, p := range pointers {
+		referenced[p.OID] = true
+	}
+	return referenced, nil
+}
+
+// scanStorage returns the objects below root. Both the giftless layout
+// (PREFIX/OID) and the Git LFS layout (OO/ID/OID) name files by their oid.
+func scanStorage(root string) ([]storedObject, error) {
+	var objects []storedObject
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") && path != root {
+				return filepath.SkipDir // e.g. the scrub quarantine
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && lfspointer.ValidOID(info.Name()) {
+			objects = append(objects, storedObject{
+				oid:     info.Name(),
+				size:    info.Size(),
+				path:    path,
+				modTime: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+// queryEndpoint reads candidate oids and returns those the server has
+func queryEndpoint(endpoint, candidatesFile string, batchSize int) ([]storedObject, error) {
+	file, err := os.Open(candidatesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Accept plain oid lists as well as git-lfs-fetch-all-refs manifests
+	var objects []lfsapi.Object
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !lfspointer.ValidOID(fields[0]) || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		obj := lfsapi.Object{OID: fields[0]}
+		if len(fields) > 1 {
+			if size, err := common.ParseSize(fields[1]); err == nil {
+				obj.Size = size
+			}
+		}
+		objects = append(objects, obj)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	missing, err := lfsapi.NewClient(endpoint, true).Missing(objects, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	absent := make(map[string]bool)
+	for _, obj := range missing {
+		absent[obj.OID] = true
+	}
+
+	var present []storedObject
+	for _, obj := range objects {
+		if !absent[obj.OID] {
+			present = append(present, storedObject{oid: obj.OID, size: obj.Size})
+		}
+	}
+	return present, nil
+}
+
+// confirm asks a yes/no question on the terminal; anything but y or yes,
+// including end of input, declines
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// deleteObjects removes orphaned object files and records them in the audit log
+func deleteObjects(orphans []storedObject, dryRun bool) {
+	audit := common.StartAudit("git-lfs-orphans", dryRun)
+	fmt.Println()
+	deleted := 0
+	for _, obj := range orphans {
+		if dryRun {
+			fmt.Printf("DRY RUN: would delete %s\n", obj.path)
+			continue
+		}
+		if err := os.Remove(obj.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete %s: %v\n", obj.path, err)
+			continue
+		}
+		audit.Deleted(obj.path)
+		deleted++
+	}
+	if !dryRun {
+		fmt.Printf("Deleted %d of %d orphaned objects\n", deleted, len(orphans))
+	}
+
+	var err error
+	if deleted < len(orphans) && !dryRun {
+		err = fmt.Errorf("%d objects could not be deleted", len(orphans)-deleted)
+	}
+	audit.Finish(err)
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-orphans - Find Git LFS objects on the server that no ref references
+
+		USAGE:
+		  git lfs-orphans --storage DIR [--prefix ORG/REPO] [OPTIONS]
+		  git lfs-orphans --endpoint URL --candidates FILE [OPTIONS]
+
+		OPTIONS:
+		  -s, --storage DIR      Server-side LFS storage directory to scan
+		  -p, --prefix PATH      Only scan STORAGE/PATH, e.g. the ORG/REPO directory
+		                         of a giftless store shared by several repositories
+		  -e, --endpoint URL     LFS endpoint to query with the Batch API
+		  --candidates FILE      Oids to check on the endpoint, one per line; the
+		                         manifest of git-lfs-fetch-all-refs is accepted
+		  --min-age DURATION     Ignore objects modified more recently (default: 24h)
+		  --batch-size N         Objects per Batch API request (default: 100)
+		  --delete               Delete orphaned objects from the storage directory
+		  -d, --dry-run          With --delete, show what would be deleted
+		  -y, --yes              With --delete, delete without asking for confirmation
+		  -h, --help             Show this help message
+		  --version              Show the version, commit and build date
+
+		DESCRIPTION:
+		  Collects the oid of every LFS pointer in the commits reachable from any
+		  branch, remote-tracking branch, tag or reflog entry, including files
+		  that only a merge resolution changed, and lists the objects on the
+		  server that none of them reference. Run it in an up-to-date clone or in
+		  the server's bare repository, otherwise objects of refs that are missing
+		  locally are reported as orphans.
+
+		  With --storage, every file named by an oid below the directory is an
+		  object; both the giftless layout (PREFIX/OID) and the Git LFS layout
+		  (OO/ID/OID) are understood. Objects modified within --min-age are skipped
+		  because a push uploads objects before it updates refs.
+
+		  The Batch API cannot enumerate a server's objects, so with --endpoint
+		  only the oids listed in --candidates are checked, for example the
+		  manifest of an older mirror. Deletion needs --storage.
+
+		  --delete lists the orphans and asks before deleting them, unless --yes
+		  is given. It refuses to run in a shallow clone, and objects that only
+		  branches missing from the clone reference, as in a single-branch
+		  clone, would be deleted too. Deletions are recorded in the audit log
+		  when audit.path is set.
+
+		EXAMPLES:
+		  # List orphans of one repository in a giftless store
+		  git lfs-orphans --storage /opt/giftless/lfs-storage --prefix myorg/myrepo
+
+		  # Preview, then delete, orphans older than a week in a bare repository
+		  cd /srv/git/myrepo.git
+		  git lfs-orphans --storage lfs/objects --min-age 168h --delete --dry-run
+		  git lfs-orphans --storage lfs/objects --min-age 168h --delete --yes
+
+		  # Check which objects of an old manifest are still on the server
+		  git lfs-orphans --endpoint https://lfs.example.com/myorg/myrepo --candidates old-manifest.tsv
+	`))
+}
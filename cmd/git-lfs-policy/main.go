@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspolicy"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	policyFile := flag.String("policy", "", "Policy file (default: .lfspolicy.yaml at the top of the working tree)")
+	commits := flag.Int("commits", -1, "With check, how many recent commits to check (default: the policy's commits, or 10)")
+	revRange := flag.String("range", "", "With check, the commits to check instead, e.g. origin/main..HEAD")
+	dryRun := flag.BoolP("dry-run", "d", false, "With apply, show the track commands without running them")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-policy")
+	completion.Handle(completion.Command{Name: "git-lfs-policy", Flags: flag.CommandLine, Subcommands: []string{"check", "apply"}})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	subcommand := flag.Arg(0)
+	if flag.NArg() != 1 || (subcommand != "check" && subcommand != "apply") {
+		printHelp("Error: check or apply must be specified")
+		os.Exit(1)
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	top, err := common.ExecGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		common.PrintError("Not inside a Git working tree")
+	}
+	top = strings.TrimSpace(top)
+	if *policyFile == "" {
+		*policyFile = filepath.Join(top, lfspolicy.FileName)
+	}
+	policy, err := lfspolicy.Load(*policyFile)
+	if os.IsNotExist(err) {
+		common.PrintError("%s does not exist; see 'git lfs-policy -h' for its format", *policyFile)
+	}
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	if subcommand == "apply" {
+		if err := apply(policy, top); err != nil {
+			common.PrintError("%v", err)
+		}
+		return
+	}
+
+	var revs []string
+	scope := "the working tree"
+	switch {
+	case *revRange != "":
+		revs = []string{*revRange}
+		scope += " and the commits of " + *revRange
+	case *commits == 0, *commits < 0 && policy.Commits == 0:
+		// Only the working tree
+	default:
+		n := policy.Commits
+		if *commits > 0 {
+			n = *commits
+		}
+		if _, err := common.ExecGitCommand("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+			revs = []string{"-n", strconv.Itoa(n), "HEAD"}
+			scope += fmt.Sprintf(" and the last %d commits", n)
+		}
+	}
+
+	fmt.Printf("Checking %s against %s\n", scope, *policyFile)
+	violations, err := check(policy, top, revs)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if violations > 0 {
+		fmt.Fprintf(os.Stderr, "✗ %d policy %s\n", violations, common.Plural(violations, "violation", "violations"))
+		os.Exit(1)
+	}
+	fmt.Println("✓ No policy violations")
+}
+
+// check prints every violation with the commands that fix it, and returns
+// how many there are
+func check(policy lfspolicy.Policy, top string, revs []string) (int, error) {
+	violations, err := policy.Check(top, revs)
+	if err != nil || len(violations) == 0 {
+		return 0, err
+	}
+	tracked, err := policy.Tracker(top)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range violations {
+		problem, fix := policy.Describe(v, tracked)
+		fmt.Printf("✗ %s (%s)\n", problem, v.Rule)
+		fmt.Printf("    fix: %s\n", fix)
+	}
+	return len(violations), nil
+}
+
+// apply tracks the extensions of the policy that .gitattributes does not
+func apply(policy lfspolicy.Policy, top string) error {
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		return err
+	}
+	untracked, err := lfspolicy.UntrackedExtensions(top, policy.Extensions(), policy.BothCases)
+	if err != nil {
+		return err
+	}
+	if len(untracked) == 0 {
+		fmt.Println("✓ Git LFS already tracks every extension of the policy")
+		return nil
+	}
+	if err := os.Chdir(top); err != nil {
+		return err
+	}
+
+	audit := common.StartAudit("git-lfs-policy apply", common.DryRun)
+	for _, ext := range untracked {
+		patterns := lfsfiles.EscapeAttributesPatterns(lfsfiles.ExpandPattern(ext, lfsfiles.Options{BothCases: policy.BothCases}))
+		if err := common.RunCommand("git", append([]string{"lfs", "track"}, patterns...)...); err != nil {
+			err = fmt.Errorf("git lfs track %s failed: %v", strings.Join(patterns, " "), err)
+			audit.Finish(err)
+			return err
+		}
+	}
+	if !common.DryRun {
+		audit.Changed(".gitattributes")
+	}
+	audit.Finish(nil)
+	if !common.DryRun {
+		fmt.Printf("✓ Tracked %d %s; commit .gitattributes\n", len(untracked), common.Plural(len(untracked), "extension", "extensions"))
+		fmt.Println("  Files committed before as plain Git blobs stay so; 'git lfs-policy check' lists them.")
+	}
+	return nil
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-policy - Check a repository against its Git LFS policy file
+
+		USAGE:
+		  git lfs-policy [OPTIONS] check
+		  git lfs-policy [OPTIONS] apply
+
+		OPTIONS:
+		  --policy FILE        Policy file (default: .lfspolicy.yaml at the top
+		                       of the working tree)
+		  --commits N          With check, how many recent commits to check
+		                       (default: the policy's commits, or 10; 0 checks
+		                       only the working tree)
+		  --range RANGE        With check, the commits to check instead, e.g.
+		                       origin/main..HEAD
+		  -d, --dry-run        With apply, show the track commands only
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  A repository states which files belong in Git LFS in .lfspolicy.yaml,
+		  committed at the top of its working tree:
+
+		    # Plain Git files may not be larger than this
+		    max_git_file_size: 1M
+		    # Nor may Git LFS objects
+		    max_lfs_file_size: 2G
+		    # .gitattributes must track these with Git LFS
+		    required_extensions: [psd, "@video"]
+		    # These may only be committed through Git LFS
+		    forbidden_extensions:
+		      - zip
+		      - iso
+		    # Track and check *.PSD as well as *.psd
+		    both_cases: true
+		    # Recent commits 'check' looks at
+		    commits: 10
+
+		  Extensions may be presets such as "@video" (quoted, as YAML requires);
+		  see 'git lfs-track -h'. Sizes take K, M and G suffixes.
+
+		  check validates the files the next commit would hold, staged or not
+		  ignored, and the files that recent commits added, and verifies that
+		  .gitattributes tracks the required extensions. Each violation is
+		  printed with the rule it breaks and the commands that fix it; the
+		  exit status is 1 when there are any, so check can gate CI jobs. In
+		  CI, check the commits of a pull request with --range.
+
+		  apply runs git lfs track for every required or forbidden extension
+		  that .gitattributes does not track yet. Files already committed as
+		  plain Git blobs are not converted; check lists them.
+
+		EXAMPLES:
+		  # Check the working tree and the last 10 commits
+		  git lfs-policy check
+
+		  # In CI, check the commits of a pull request
+		  git lfs-policy check --range origin/main..HEAD
+
+		  # Track what the policy requires, then check again
+		  git lfs-policy apply && git lfs-policy check
+	`))
+}
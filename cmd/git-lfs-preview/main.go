@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// defaultPreviewDir is the working tree directory previews are written to
+const defaultPreviewDir = ".previews"
+
+// assetKinds maps lower-case extensions to the kind of preview generated
+var assetKinds = map[string]string{
+	".png": "image", ".jpg": "image", ".jpeg": "image", ".gif": "image",
+	".mp4": "video", ".mov": "video", ".m4v": "video", ".mkv": "video", ".webm": "video", ".avi": "video",
+	".obj": "model", ".stl": "model", ".gltf": "model", ".glb": "model",
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	dir := flag.StringP("dir", "o", defaultPreviewDir, "Working tree directory for previews")
+	branch := flag.StringP("branch", "b", "", "Commit previews to this sidecar branch instead of a directory")
+	size := flag.IntP("size", "s", 256, "Maximum thumbnail width and height in pixels")
+	force := flag.BoolP("force", "f", false, "Regenerate every preview, even when the asset is unchanged")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be generated without writing anything")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-preview")
+	completion.Handle(completion.Command{Name: "git-lfs-preview", Flags: flag.CommandLine, Args: completion.ArgDirectory})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+	if *size <= 0 {
+		common.PrintError("--size must be positive")
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckLFSInstalled(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	pointers, err := lfspointer.ListTree("HEAD")
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	var store previewStore
+	if *branch != "" {
+		if store, err = newBranchStore(*branch); err != nil {
+			common.PrintError("%v", err)
+		}
+	} else {
+		store = &dirStore{root: strings.TrimSuffix(*dir, "/")}
+	}
+	previous, err := store.readManifest()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	haveFFmpeg := prereq.Check(ffmpegRequirement)[0].OK
+	audit := common.StartAudit("git-lfs-preview", *dryRun)
+	current := manifest{}
+	var generated, unchanged, skipped, removed int
+
+	fmt.Printf("Generating previews in %s\n", store.describe())
+	for _, p := range pointers {
+		if *branch == "" && withinPaths(p.Path, []string{*dir}) {
+			continue // Never preview the previews
+		}
+		if !withinPaths(p.Path, flag.Args()) {
+			if old, ok := previous[p.Path]; ok {
+				current[p.Path] = old // Outside this run's paths: keep as is
+			}
+			continue
+		}
+		kind, ok := assetKinds[strings.ToLower(path.Ext(p.Path))]
+		if !ok {
+			continue
+		}
+		if old, ok := previous[p.Path]; ok && old.OID == p.OID && !*force {
+			current[p.Path] = old
+			unchanged++
+			continue
+		}
+		if kind == "video" && !haveFFmpeg {
+			fmt.Printf("  - %s: skipped, ffmpeg is not installed\n", p.Path)
+			skipped++
+			continue
+		}
+
+		object := lfspointer.ObjectPath(storage, p.OID)
+		if _, err := os.Stat(object); err != nil {
+			fmt.Printf("  - %s: skipped, object not downloaded (run git lfs fetch)\n", p.Path)
+			skipped++
+			continue
+		}
+
+		pv, thumbnail, err := generate(p, kind, object, *size)
+		if err != nil {
+			fmt.Printf("  ✗ %s: %v\n", p.Path, err)
+			skipped++
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("  DRY RUN: would generate %s preview of %s\n", kind, p.Path)
+		} else {
+			if thumbnail != nil {
+				if err := store.write(pv.Thumbnail, thumbnail); err != nil {
+					common.PrintError("Failed to write preview of %s: %v", p.Path, err)
+				}
+				audit.Changed(pv.Thumbnail)
+			}
+			fmt.Printf("  ✓ %s (%s)\n", p.Path, kind)
+		}
+		current[p.Path] = pv
+		generated++
+	}
+
+	// Remove previews of deleted assets and thumbnails that were replaced
+	for assetPath, old := range previous {
+		pv, ok := current[assetPath]
+		if !ok {
+			removed++
+		}
+		if old.Thumbnail == "" || (ok && pv.Thumbnail == old.Thumbnail) {
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("  DRY RUN: would remove %s\n", old.Thumbnail)
+			continue
+		}
+		if err := store.remove(old.Thumbnail); err != nil {
+			common.PrintError("Failed to remove %s: %v", old.Thumbnail, err)
+		}
+		audit.Deleted(old.Thumbnail)
+	}
+
+	if err := store.save(current, *dryRun); err != nil {
+		common.PrintError("Failed to save previews: %v", err)
+	}
+	audit.Finish(nil)
+
+	fmt.Println()
+	fmt.Printf("Generated: %d, unchanged: %d, skipped: %d, removed: %d\n", generated, unchanged, skipped, removed)
+	if *branch == "" && !*dryRun && generated+removed > 0 {
+		fmt.Printf("Commit the previews with: git add %s && git commit -m \"Update LFS asset previews\"\n", *dir)
+	}
+}
+
+// generate creates the preview of one asset and returns its thumbnail, if any
+func generate(p lfspointer.Pointer, kind, object string, size int) (preview, []byte, error) {
+	pv := preview{OID: p.OID, Size: p.Size, Kind: kind}
+	var thumbnail []byte
+	var err error
+
+	switch kind {
+	case "image":
+		thumbnail, pv.Width, pv.Height, err = imageThumbnail(object, size)
+	case "video":
+		thumbnail, err = videoThumbnail(object, size)
+	case "model":
+		pv.Bounds, err = modelBounds(object, strings.ToLower(path.Ext(p.Path)))
+	}
+	if err != nil {
+		return pv, nil, err
+	}
+	if thumbnail != nil {
+		pv.Thumbnail = p.Path + ".jpg"
+	}
+	return pv, thumbnail, nil
+}
+
+// withinPaths reports whether file is one of paths or inside one of them;
+// no paths selects everything
+func withinPaths(file string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.Trim(path.Clean(strings.ReplaceAll(p, "\\", "/")), "/")
+		if p == "." || file == p || strings.HasPrefix(file, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKinds lists the supported extensions of a kind, for the help text
+func sortedKinds(kind string) string {
+	var exts []string
+	for ext, k := range assetKinds {
+		if k == kind {
+			exts = append(exts, strings.TrimPrefix(ext, "."))
+		}
+	}
+	sort.Strings(exts)
+	return strings.Join(exts, ", ")
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(fmt.Sprintf(`
+		git-lfs-preview - Generate lightweight previews of Git LFS assets
+
+		USAGE:
+		  git lfs-preview [OPTIONS] [PATH...]
+
+		OPTIONS:
+		  -o, --dir DIR       Working tree directory for previews (default: .previews)
+		  -b, --branch NAME   Commit previews to the sidecar branch NAME instead
+		  -s, --size PIXELS   Maximum thumbnail width and height (default: 256)
+		  -f, --force         Regenerate every preview, even for unchanged assets
+		  -d, --dry-run       Show what would be generated without writing anything
+		  -h, --help          Show this help message
+		  --version           Show the version, commit and build date
+
+		DESCRIPTION:
+		  Creates previews of the LFS-tracked assets at HEAD, optionally limited
+		  to the given files and directories, so reviewers can browse assets
+		  without downloading their full content:
+		    Images (%s): JPEG thumbnails
+		    Videos (%s): JPEG of the first frame, if ffmpeg is installed
+		    Models (%s): bounding box and vertex count
+
+		  Previews are read from local LFS storage; assets whose objects have not
+		  been fetched are skipped. Thumbnails are stored as PATH.jpg below the
+		  preview directory, and manifest.json records the oid, size, dimensions
+		  and bounds of every asset. Only assets whose oid differs from the one in
+		  the manifest are regenerated, and previews of deleted assets are removed.
+
+		  With --branch, previews are committed to a branch with its own history,
+		  leaving the working tree and index untouched; push it like any branch.
+
+		EXAMPLES:
+		  # Write previews to .previews/ and commit them with the assets
+		  git lfs-preview
+		  git add .previews && git commit -m "Update LFS asset previews"
+
+		  # Keep previews of the textures directory on a sidecar branch
+		  git lfs-preview --branch lfs-previews textures/
+		  git push origin lfs-previews
+	`, sortedKinds("image"), sortedKinds("video"), sortedKinds("model"))))
+}
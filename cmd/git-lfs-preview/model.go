@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// boundingBox is the axis-aligned extent of a 3D model
+type boundingBox struct {
+	Min      [3]float64 `json:"min"`
+	Max      [3]float64 `json:"max"`
+	Vertices int        `json:"vertices"`
+}
+
+func newBoundingBox() boundingBox {
+	inf := math.Inf(1)
+	return boundingBox{Min: [3]float64{inf, inf, inf}, Max: [3]float64{-inf, -inf, -inf}}
+}
+
+func (b *boundingBox) add(v [3]float64) {
+	for i := range v {
+		b.Min[i] = math.Min(b.Min[i], v[i])
+		b.Max[i] = math.Max(b.Max[i], v[i])
+	}
+	b.Vertices++
+}
+
+// modelBounds returns the bounding box of an OBJ, STL, glTF or GLB model
+func modelBounds(path, ext string) (*boundingBox, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var box boundingBox
+	switch ext {
+	case ".obj":
+		box, err = objBounds(file)
+	case ".stl":
+		box, err = stlBounds(file)
+	case ".gltf":
+		box, err = gltfBounds(file)
+	case ".glb":
+		box, err = glbBounds(file)
+	default:
+		return nil, fmt.Errorf("unsupported model format %s", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if box.Vertices == 0 {
+		return nil, fmt.Errorf("no vertices found")
+	}
+	return &box, nil
+}
+
+// objBounds reads the "v X Y Z" lines of a Wavefront OBJ file
+func objBounds(r io.Reader) (boundingBox, error) {
+	box := newBoundingBox()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "v" {
+			continue
+		}
+		if v, ok := parseVertex(fields[1:4]); ok {
+			box.add(v)
+		}
+	}
+	return box, scanner.Err()
+}
+
+// stlBounds reads an ASCII or binary STL file
+func stlBounds(r io.Reader) (boundingBox, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return boundingBox{}, err
+	}
+
+	box := newBoundingBox()
+	// Binary STL: 80-byte header, triangle count, then 50 bytes per triangle.
+	// Some binary files also start with "solid", so check the size first.
+	if len(data) >= 84 {
+		count := int(binary.LittleEndian.Uint32(data[80:84]))
+		if len(data) == 84+count*50 {
+			for t := 0; t < count; t++ {
+				offset := 84 + t*50 + 12 // Skip the normal
+				for v := 0; v < 3; v++ {
+					var vertex [3]float64
+					for i := range vertex {
+						bits := binary.LittleEndian.Uint32(data[offset+v*12+i*4:])
+						vertex[i] = float64(math.Float32frombits(bits))
+					}
+					box.add(vertex)
+				}
+			}
+			return box, nil
+		}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return box, fmt.Errorf("not an STL file")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[0] == "vertex" {
+			if v, ok := parseVertex(fields[1:]); ok {
+				box.add(v)
+			}
+		}
+	}
+	return box, nil
+}
+
+// gltfDocument holds the parts of a glTF document needed for bounds
+type gltfDocument struct {
+	Accessors []struct {
+		Count int       `json:"count"`
+		Min   []float64 `json:"min"`
+		Max   []float64 `json:"max"`
+	} `json:"accessors"`
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+}
+
+// gltfBounds combines the min and max of every POSITION accessor, which
+// glTF requires; node transforms are not applied
+func gltfBounds(r io.Reader) (boundingBox, error) {
+	var doc gltfDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return boundingBox{}, err
+	}
+
+	box := newBoundingBox()
+	for _, mesh := range doc.Meshes {
+		for _, primitive := range mesh.Primitives {
+			index, ok := primitive.Attributes["POSITION"]
+			if !ok || index < 0 || index >= len(doc.Accessors) {
+				continue
+			}
+			accessor := doc.Accessors[index]
+			if len(accessor.Min) != 3 || len(accessor.Max) != 3 {
+				continue
+			}
+			box.add([3]float64(accessor.Min))
+			box.add([3]float64(accessor.Max))
+			box.Vertices += accessor.Count - 2
+		}
+	}
+	return box, nil
+}
+
+// glbBounds reads the JSON chunk of a binary glTF file
+func glbBounds(r io.Reader) (boundingBox, error) {
+	// Header: magic, version, length; then the JSON chunk's length and type
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return boundingBox{}, err
+	}
+	if string(header[0:4]) != "glTF" || string(header[16:20]) != "JSON" {
+		return boundingBox{}, fmt.Errorf("not a GLB file")
+	}
+	length := binary.LittleEndian.Uint32(header[12:16])
+	return gltfBounds(io.LimitReader(r, int64(length)))
+}
+
+func parseVertex(fields []string) ([3]float64, bool) {
+	var v [3]float64
+	for i := range v {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return v, false
+		}
+		v[i] = f
+	}
+	return v, true
+}
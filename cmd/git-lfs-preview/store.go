@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// manifestName is the file, relative to the preview root, listing every preview
+const manifestName = "manifest.json"
+
+// previewAttributes keeps thumbnails out of Git LFS even when the repository
+// tracks their extension, so they can be browsed without LFS
+const previewAttributes = "* -filter -diff -merge -text\n"
+
+// preview describes the preview of one LFS-tracked asset
+type preview struct {
+	OID       string       `json:"oid"`
+	Size      int64        `json:"size"`
+	Kind      string       `json:"kind"`                // image, video or model
+	Thumbnail string       `json:"thumbnail,omitempty"` // Relative to the preview root
+	Width     int          `json:"width,omitempty"`
+	Height    int          `json:"height,omitempty"`
+	Bounds    *boundingBox `json:"bounds,omitempty"`
+}
+
+// manifest maps asset paths to their previews
+type manifest map[string]preview
+
+// previewStore is where previews are kept: a directory in the working tree
+// or a sidecar branch
+type previewStore interface {
+	readManifest() (manifest, error)
+	write(rel string, data []byte) error
+	remove(rel string) error
+	save(m manifest, dryRun bool) error
+	describe() string
+}
+
+func encodeManifest(m manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func decodeManifest(data []byte) (manifest, error) {
+	m := manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", manifestName, err)
+	}
+	return m, nil
+}
+
+// dirStore keeps previews in a directory of the working tree, to be committed
+// with the assets
+type dirStore struct {
+	root string
+}
+
+func (s *dirStore) readManifest() (manifest, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, manifestName))
+	if os.IsNotExist(err) {
+		return manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(data)
+}
+
+func (s *dirStore) write(rel string, data []byte) error {
+	path := filepath.Join(s.root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *dirStore) remove(rel string) error {
+	err := os.Remove(filepath.Join(s.root, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirStore) save(m manifest, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+	attributes := filepath.Join(s.root, ".gitattributes")
+	if _, err := os.Stat(attributes); os.IsNotExist(err) {
+		if err := s.write(".gitattributes", []byte(previewAttributes)); err != nil {
+			return err
+		}
+	}
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	return s.write(manifestName, data)
+}
+
+func (s *dirStore) describe() string {
+	return s.root + "/"
+}
+
+// branchStore keeps previews on a sidecar branch that shares no history with
+// the assets. Changes are staged in a private index, so neither the working
+// tree nor the real index is touched.
+type branchStore struct {
+	branch string
+	index  string // Temporary index file
+	parent string // Current commit of the branch, if it exists
+}
+
+func newBranchStore(branch string) (*branchStore, error) {
+	file, err := os.CreateTemp("", "git-lfs-preview-index-*")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	os.Remove(file.Name()) // git read-tree refuses an empty index file
+
+	s := &branchStore{branch: branch, index: file.Name()}
+	if output, err := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch).Output(); err == nil {
+		s.parent = strings.TrimSpace(string(output))
+	}
+	tree := "--empty"
+	if s.parent != "" {
+		tree = s.parent
+	}
+	if _, err := s.git(nil, "read-tree", tree); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// git runs a git command against the private index
+func (s *branchStore) git(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+s.index)
+	if stdin != nil {
+		cmd.Stdin = strings.NewReader(string(stdin))
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (s *branchStore) readManifest() (manifest, error) {
+	if s.parent == "" {
+		return manifest{}, nil
+	}
+	data, err := exec.Command("git", "show", s.parent+":"+manifestName).Output()
+	if err != nil {
+		return manifest{}, nil
+	}
+	return decodeManifest(data)
+}
+
+func (s *branchStore) write(rel string, data []byte) error {
+	blob, err := s.git(data, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	_, err = s.git(nil, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+rel)
+	return err
+}
+
+func (s *branchStore) remove(rel string) error {
+	_, err := s.git(nil, "update-index", "--force-remove", rel)
+	return err
+}
+
+// save commits the staged previews to the branch and removes the private index
+func (s *branchStore) save(m manifest, dryRun bool) error {
+	defer os.Remove(s.index)
+	if dryRun {
+		return nil
+	}
+
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	if err := s.write(manifestName, data); err != nil {
+		return err
+	}
+	tree, err := s.git(nil, "write-tree")
+	if err != nil {
+		return err
+	}
+	if s.parent != "" {
+		if parentTree, err := s.git(nil, "rev-parse", s.parent+"^{tree}"); err == nil && parentTree == tree {
+			return nil // Nothing changed
+		}
+	}
+
+	args := []string{"commit-tree", tree, "-m", "Update LFS asset previews"}
+	if s.parent != "" {
+		args = append(args, "-p", s.parent)
+	}
+	commit, err := s.git(nil, args...)
+	if err != nil {
+		return err
+	}
+	oldValue := s.parent
+	if oldValue == "" {
+		oldValue = strings.Repeat("0", 40)
+	}
+	_, err = s.git(nil, "update-ref", "refs/heads/"+s.branch, commit, oldValue)
+	return err
+}
+
+func (s *branchStore) describe() string {
+	return "branch " + s.branch
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register the GIF decoder
+	"image/jpeg"
+	_ "image/png" // Register the PNG decoder
+	"os"
+	"os/exec"
+
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+)
+
+// thumbnailQuality is the JPEG quality of generated thumbnails
+const thumbnailQuality = 80
+
+var ffmpegRequirement = prereq.Bin("ffmpeg", "install from: https://ffmpeg.org/download.html").WithPackage("ffmpeg")
+
+// imageThumbnail decodes a PNG, JPEG or GIF file and returns a JPEG no larger
+// than maxSize in either dimension, with the original dimensions
+func imageThumbnail(path string, maxSize int) ([]byte, int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := src.Bounds()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(src, maxSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), bounds.Dx(), bounds.Dy(), nil
+}
+
+// scaleDown shrinks an image to fit within maxSize x maxSize by averaging the
+// source pixels covered by each target pixel. Transparent areas become white,
+// since JPEG has no alpha channel.
+func scaleDown(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	scale := 1.0
+	if width > maxSize || height > maxSize {
+		scale = float64(maxSize) / float64(max(width, height))
+	}
+	dstW, dstH := max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := b.Min.Y+y*height/dstH, b.Min.Y+max((y+1)*height/dstH, y*height/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := b.Min.X+x*width/dstW, b.Min.X+max((x+1)*width/dstW, x*width/dstW+1)
+
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Composite the premultiplied color onto white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: 0xffff})
+		}
+	}
+	return dst
+}
+
+// videoThumbnail returns the first frame of a video as a JPEG no larger than
+// maxSize in either dimension
+func videoThumbnail(path string, maxSize int) ([]byte, error) {
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease", maxSize, maxSize)
+	cmd := exec.Command("ffmpeg", "-v", "error", "-i", path, "-frames:v", "1", "-vf", scale,
+		"-f", "image2pipe", "-vcodec", "mjpeg", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no frame")
+	}
+	return output, nil
+}
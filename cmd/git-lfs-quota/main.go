@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	account := flag.StringP("account", "a", "", "GitHub user or organization (default: owner of origin, or the authenticated user)")
+	storageQuota := flag.String("storage-quota", "10G", "Included Git LFS storage plus purchased data packs")
+	bandwidthQuota := flag.String("bandwidth-quota", "10G", "Included monthly Git LFS bandwidth plus purchased data packs")
+	days := flag.Int("days", 30, "Project storage growth from LFS objects pushed in this many days")
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-quota")
+	completion.Handle(completion.Command{Name: "git-lfs-quota", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	storageLimit, err := common.ParseSize(*storageQuota)
+	if err != nil {
+		common.PrintError("--storage-quota: %v", err)
+	}
+	bandwidthLimit, err := common.ParseSize(*bandwidthQuota)
+	if err != nil {
+		common.PrintError("--bandwidth-quota: %v", err)
+	}
+	if *days <= 0 {
+		common.PrintError("--days must be positive")
+	}
+
+	if err := github.CheckGHInstalled(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	inRepo := common.CheckGitRepo() == nil
+	name := *account
+	if name == "" {
+		name, err = defaultAccount(inRepo)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+	accountType, err := github.AccountType(name)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	now := time.Now()
+	usage, err := github.GetLFSUsage(name, accountType == "Organization", now)
+	if err != nil {
+		common.PrintError("Failed to read Git LFS usage for %s: %v\nReading billing usage requires an owner or billing manager; run 'gh auth refresh -s user' if the token lacks access", name, err)
+	}
+
+	storageUsed := github.GBToBytes(usage.StorageGB)
+	bandwidthUsed := github.GBToBytes(usage.BandwidthGB)
+	monthEnd := usage.Month.AddDate(0, 1, 0)
+	daysLeft := monthEnd.Sub(now).Hours() / 24
+
+	fmt.Printf("Git LFS usage for %s (%s)\n", name, usage.Month.Format("January 2006"))
+	fmt.Printf("  Storage:   %s\n", quotaLine(storageUsed, storageLimit))
+	fmt.Printf("  Bandwidth: %s, resets in %.0f days\n", quotaLine(bandwidthUsed, bandwidthLimit), daysLeft)
+	if usage.NetAmount > 0 {
+		fmt.Printf("  Billed so far this month: $%.2f\n", usage.NetAmount)
+	}
+
+	fmt.Println("\nProjection:")
+
+	// Bandwidth is projected from this month's usage so far
+	elapsed := now.Sub(usage.Month).Hours() / 24
+	if elapsed > 0 && bandwidthUsed > 0 {
+		rate := float64(bandwidthUsed) / elapsed
+		remaining := float64(bandwidthLimit - bandwidthUsed)
+		switch {
+		case remaining <= 0:
+			fmt.Println("  ✗ Bandwidth quota is exhausted until the month ends")
+		case remaining/rate < daysLeft:
+			fmt.Printf("  ⚠ At %s/day, bandwidth runs out in about %.0f days (%s), before the month ends\n",
+				common.FormatSize(int64(rate)), remaining/rate, now.Add(time.Duration(remaining/rate*24)*time.Hour).Format("2006-01-02"))
+		default:
+			fmt.Printf("  ✓ At %s/day, bandwidth lasts until the month ends\n", common.FormatSize(int64(rate)))
+		}
+	} else {
+		fmt.Println("  ✓ No bandwidth used yet this month")
+	}
+
+	// Storage grows with pushes; only this repository's pushes are visible locally
+	if !inRepo {
+		fmt.Println("  Run inside a repository to project storage from its recent pushes")
+		return
+	}
+	refs, err := lfspointer.AllRefs()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	added, err := lfspointer.Added(fmt.Sprintf("%d days ago", *days), refs)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	addedBytes := lfspointer.TotalSize(added)
+	rate := float64(addedBytes) / float64(*days)
+	fmt.Printf("  Commits in the last %d days added %s of LFS objects (%s/day) to this repository\n",
+		*days, common.FormatSize(addedBytes), common.FormatSize(int64(rate)))
+
+	remaining := float64(storageLimit - storageUsed)
+	switch {
+	case remaining <= 0:
+		fmt.Println("  ✗ Storage quota is exhausted; pushes of new LFS objects will be rejected")
+	case rate == 0:
+		fmt.Println("  ✓ Storage is not growing")
+	default:
+		daysUntil := remaining / rate
+		mark := "✓"
+		if daysUntil < 30 {
+			mark = "⚠"
+		}
+		fmt.Printf("  %s At this rate, storage runs out in about %.0f days (%s)\n",
+			mark, daysUntil, now.Add(time.Duration(daysUntil*24)*time.Hour).Format("2006-01-02"))
+	}
+}
+
+// defaultAccount returns the owner of a GitHub origin remote, or the authenticated user
+func defaultAccount(inRepo bool) (string, error) {
+	if inRepo {
+		if remote, err := forge.CurrentRepo("github"); err == nil && remote.Host == "github.com" {
+			return remote.Owner(), nil
+		}
+	}
+	return github.CurrentUser()
+}
+
+// quotaLine formats usage against a limit
+func quotaLine(used, limit int64) string {
+	percent := 0.0
+	if limit > 0 {
+		percent = float64(used) * 100 / float64(limit)
+	}
+	remaining := limit - used
+	if remaining < 0 {
+		return fmt.Sprintf("%s of %s (%.0f%%), over by %s", common.FormatSize(used), common.FormatSize(limit), percent, common.FormatSize(-remaining))
+	}
+	return fmt.Sprintf("%s of %s (%.0f%%), %s remaining", common.FormatSize(used), common.FormatSize(limit), percent, common.FormatSize(remaining))
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-quota - Report GitHub Git LFS quota and project when it runs out
+
+		USAGE:
+		  git lfs-quota [OPTIONS]
+
+		OPTIONS:
+		  -a, --account NAME        GitHub user or organization
+		                            (default: owner of origin, or the authenticated user)
+		  --storage-quota SIZE      Included storage plus data packs (default: 10G)
+		  --bandwidth-quota SIZE    Included monthly bandwidth plus data packs (default: 10G)
+		  --days N                  Project storage from pushes in the last N days (default: 30)
+		  --timeout DURATION        Stop a GitHub API call that takes longer, e.g. 1m
+		  --retries N               Retry a failed GitHub API call N times (default: 2)
+		  -h, --help                Show this help message
+		  --version                 Show the version, commit and build date
+
+		DESCRIPTION:
+		  Reads the account's Git LFS storage and bandwidth for the current month
+		  from the GitHub billing usage API and compares them with the quota.
+
+		  GitHub reports storage in gigabyte-hours; the storage shown is the
+		  average so far this month. The API does not report the quota itself,
+		  so pass the included amount plus any purchased data packs with
+		  --storage-quota and --bandwidth-quota. Sizes accept K, M, G and T suffixes.
+
+		  Bandwidth is projected from this month's daily average. Inside a
+		  repository, storage is projected from the size of the LFS objects
+		  committed on any ref during the last --days days.
+
+		  Requires:
+		    - gh (GitHub CLI), authenticated as an owner or billing manager
+		      of the account
+
+		EXAMPLES:
+		  # Quota of the account that owns origin
+		  git lfs-quota
+
+		  # An organization with one 50 GB data pack
+		  git lfs-quota --account myorg --storage-quota 60G --bandwidth-quota 60G
+	`))
+}
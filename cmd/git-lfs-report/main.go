@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspolicy"
+	"github.com/mslinn/git_lfs_scripts/internal/report"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	output := flag.StringP("output", "o", "", "Write the report to this file instead of standard output")
+	format := flag.StringP("format", "f", "", "markdown or html (default: html for an --output ending in .html, else markdown)")
+	title := flag.String("title", "", "Title of the report (default: Git LFS report: DIRECTORY)")
+	top := flag.Int("top", 10, "Extensions charted and listed; the others are summed as (other)")
+	policyFile := flag.String("policy", "", "Policy file (default: .lfspolicy.yaml at the top of the working tree, when it exists)")
+	commits := flag.Int("commits", -1, "How many recent commits the policy check covers (default: the policy's commits, or 10)")
+	revRange := flag.String("range", "", "The commits the policy check covers instead, e.g. origin/main..HEAD")
+	verifyRemote := flag.Bool("verify-remote", false, "Also ask the LFS server whether it has every object")
+	remote := flag.StringP("remote", "r", "origin", "With --verify-remote, the Git remote whose LFS endpoint is asked")
+	endpoint := flag.StringP("endpoint", "e", "", "With --verify-remote, the LFS endpoint to ask instead of the remote's")
+	batchSize := flag.Int("batch-size", 100, "With --verify-remote, objects per Batch API request")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-report")
+	completion.Handle(completion.Command{Name: "git-lfs-report", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+	}
+	if *format == "" {
+		*format = "markdown"
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = "html"
+		}
+	}
+	if *format != "markdown" && *format != "html" {
+		printHelp("--format must be markdown or html")
+	}
+	if *top <= 0 {
+		printHelp("--top must be positive")
+	}
+	if *batchSize <= 0 {
+		printHelp("--batch-size must be positive")
+	}
+	if (*endpoint != "" || flag.CommandLine.Changed("remote")) && !*verifyRemote {
+		printHelp("--remote and --endpoint only apply with --verify-remote")
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	topDir, err := common.ExecGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		common.PrintError("Not inside a Git working tree")
+	}
+	topDir = strings.TrimSpace(topDir)
+	// Relative to the current directory, not the top of the working tree
+	for _, file := range []*string{output, policyFile} {
+		if *file != "" {
+			if *file, err = filepath.Abs(*file); err != nil {
+				common.PrintError("%v", err)
+			}
+		}
+	}
+	if err := os.Chdir(topDir); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	r := report.Report{
+		Title:      *title,
+		Repository: repository(topDir),
+		Generated:  time.Now(),
+	}
+	if r.Title == "" {
+		r.Title = "Git LFS report: " + filepath.Base(topDir)
+	}
+	if head, err := common.ExecGitCommand("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		r.Commit = strings.TrimSpace(head)
+	}
+
+	fmt.Fprintln(os.Stderr, "Collecting file statistics...")
+	files, err := lfspolicy.WorkingTree(topDir)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	r.Stats = report.Summarize(files).Top(*top)
+
+	if r.Policy, err = checkPolicy(topDir, *policyFile, *commits, *revRange, r.Commit != ""); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	var pointers []lfspointer.Pointer
+	if r.Commit != "" {
+		if pointers, err = lfspointer.ListTree("HEAD"); err != nil {
+			common.PrintError("%v", err)
+		}
+		pointers = uniqueObjects(pointers)
+	}
+	if r.Local, err = verifyLocal(pointers, r.Commit != ""); err != nil {
+		common.PrintError("%v", err)
+	}
+	r.Remote = report.Verification{Note: "Not checked; run git lfs-report --verify-remote to ask the LFS server for every object."}
+	if *verifyRemote {
+		r.Remote = verifyServer(pointers, *remote, *endpoint, *batchSize, r.Commit != "")
+	}
+
+	var b bytes.Buffer
+	if *format == "html" {
+		err = r.HTML(&b)
+	} else {
+		err = r.Markdown(&b)
+	}
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(b.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, b.Bytes(), 0644); err != nil {
+		common.PrintError("Failed to write the report: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Wrote the report to %s\n", *output)
+}
+
+// repository names the repository by the URL of origin, without any
+// credentials in it, or else by its directory
+func repository(topDir string) string {
+	remoteURL, err := common.ExecGitCommand("remote", "get-url", "origin")
+	remoteURL = strings.TrimSpace(remoteURL)
+	if err != nil || remoteURL == "" {
+		return topDir
+	}
+	if u, err := url.Parse(remoteURL); err == nil && u.User != nil && u.Scheme != "" {
+		u.User = nil
+		return u.String()
+	}
+	return remoteURL
+}
+
+// checkPolicy checks the working tree, and the commits --commits or --range
+// select, against the policy file when there is one
+func checkPolicy(topDir, file string, commits int, revRange string, hasCommits bool) (report.Policy, error) {
+	explicit := file != ""
+	if !explicit {
+		file = filepath.Join(topDir, lfspolicy.FileName)
+	}
+	policy, err := lfspolicy.Load(file)
+	if os.IsNotExist(err) && !explicit {
+		return report.Policy{Note: fmt.Sprintf("Not checked: the repository has no %s; see 'git lfs-policy -h' for its format.", lfspolicy.FileName)}, nil
+	}
+	if err != nil {
+		return report.Policy{}, err
+	}
+
+	var revs []string
+	scope := "the working tree"
+	switch {
+	case revRange != "":
+		revs = []string{revRange}
+		scope += " and the commits of " + revRange
+	case commits == 0, commits < 0 && policy.Commits == 0, !hasCommits:
+		// Only the working tree
+	default:
+		n := policy.Commits
+		if commits > 0 {
+			n = commits
+		}
+		revs = []string{"-n", strconv.Itoa(n), "HEAD"}
+		scope += fmt.Sprintf(" and the last %d commits", n)
+	}
+
+	fmt.Fprintf(os.Stderr, "Checking %s against %s...\n", scope, file)
+	violations, err := policy.Check(topDir, revs)
+	if err != nil {
+		return report.Policy{}, err
+	}
+	tracked, err := policy.Tracker(topDir)
+	if err != nil {
+		return report.Policy{}, err
+	}
+	result := report.Policy{File: file, Scope: scope}
+	if rel, err := filepath.Rel(topDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		result.File = rel
+	}
+	for _, v := range violations {
+		problem, fix := policy.Describe(v, tracked)
+		result.Findings = append(result.Findings, report.Finding{Rule: v.Rule, Problem: problem, Fix: fix})
+	}
+	return result, nil
+}
+
+// uniqueObjects keeps the first pointer of each object
+func uniqueObjects(pointers []lfspointer.Pointer) []lfspointer.Pointer {
+	seen := make(map[string]bool)
+	var unique []lfspointer.Pointer
+	for _, p := range pointers {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// verifyLocal checks that local storage holds each object at its size
+func verifyLocal(pointers []lfspointer.Pointer, hasCommits bool) (report.Verification, error) {
+	if !hasCommits {
+		return report.Verification{Note: "Not checked: the repository has no commits."}, nil
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		return report.Verification{}, err
+	}
+	fmt.Fprintf(os.Stderr, "Checking %d %s in %s...\n", len(pointers), common.Plural(len(pointers), "object", "objects"), storage)
+	result := report.Verification{Where: storage, Objects: len(pointers), Size: lfspointer.TotalSize(pointers)}
+	for _, p := range pointers {
+		issue := ""
+		info, err := os.Stat(lfspointer.ObjectPath(storage, p.OID))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			issue = "not downloaded"
+		case err != nil:
+			issue = err.Error()
+		case info.Size() != p.Size:
+			issue = fmt.Sprintf("damaged: %s instead of %s", common.FormatSize(info.Size()), common.FormatSize(p.Size))
+		}
+		if issue != "" {
+			result.Problems = append(result.Problems, report.Problem{OID: p.OID, Size: p.Size, Path: p.Path, Issue: issue})
+		}
+	}
+	return result, nil
+}
+
+// verifyServer asks the LFS server for each object. Failures are reported
+// in the report, which is still worth having without this part.
+func verifyServer(pointers []lfspointer.Pointer, remote, endpoint string, batchSize int, hasCommits bool) report.Verification {
+	if !hasCommits {
+		return report.Verification{Note: "Not checked: the repository has no commits."}
+	}
+	var client *lfsapi.Client
+	if endpoint != "" {
+		client = lfsapi.NewClient(endpoint, true)
+	} else {
+		var err error
+		if client, _, err = lfsapi.NewRemoteClient(remote, "download"); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot verify the objects on the server: %v\n", err)
+			return report.Verification{Note: fmt.Sprintf("Not checked: %v", err)}
+		}
+	}
+
+	result := report.Verification{Where: client.Endpoint, Objects: len(pointers), Size: lfspointer.TotalSize(pointers)}
+	objects := make([]lfsapi.Object, len(pointers))
+	paths := make(map[string]string, len(pointers))
+	for i, p := range pointers {
+		objects[i] = lfsapi.Object{OID: p.OID, Size: p.Size}
+		paths[p.OID] = p.Path
+	}
+	fmt.Fprintf(os.Stderr, "Asking %s for %d %s...\n", client.Endpoint, len(objects), common.Plural(len(objects), "object", "objects"))
+	missing, err := client.Missing(objects, batchSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: verification failed: %v\n", err)
+		result.Error = err.Error()
+		return result
+	}
+	for _, obj := range missing {
+		result.Problems = append(result.Problems, report.Problem{OID: obj.OID, Size: obj.Size, Path: paths[obj.OID], Issue: "missing on the server"})
+	}
+	return result
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-report - Write a Markdown or HTML report of a repository's Git LFS use
+
+		USAGE:
+		  git lfs-report [OPTIONS]
+
+		OPTIONS:
+		  -o, --output FILE    Write the report to FILE instead of standard output
+		  -f, --format FORMAT  markdown or html (default: html for an --output
+		                       ending in .html, else markdown)
+		  --title TEXT         Title of the report (default: Git LFS report:
+		                       DIRECTORY)
+		  --top N              Extensions charted and listed; the others are
+		                       summed as (other) (default: 10)
+		  --policy FILE        Policy file (default: .lfspolicy.yaml at the top of
+		                       the working tree, when it exists)
+		  --commits N          How many recent commits the policy check covers
+		                       (default: the policy's commits, or 10)
+		  --range RANGE        The commits the policy check covers instead, e.g.
+		                       origin/main..HEAD
+		  --verify-remote      Also ask the LFS server whether it has every object
+		  -r, --remote NAME    With --verify-remote, the Git remote whose LFS
+		                       endpoint is asked (default: origin)
+		  -e, --endpoint URL   With --verify-remote, the LFS endpoint to ask
+		                       instead of the remote's
+		  --batch-size N       With --verify-remote, objects per Batch API request
+		                       (default: 100)
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Collects in one document what git-nonlfs, git-lfs-policy check and
+		  git-lfs-verify-remote report separately, to attach to a migration
+		  proposal or to keep as a CI artifact:
+
+		    Storage     the files the next commit would hold, in Git LFS and as
+		                plain Git files, by extension, with SVG bar charts
+		    Policy      the violations of .lfspolicy.yaml with their fixes,
+		                when the repository has one
+		    Pointers    whether local storage holds the object of every pointer
+		                at HEAD, and with --verify-remote whether the LFS server
+		                does
+
+		  HTML reports are standalone pages with inline charts. Markdown
+		  reports embed the charts as data: URI images; viewers that do not
+		  show those, such as GitHub comments, still show the tables.
+
+		  Progress is printed on standard error. The exit status is 0 whenever
+		  the report is written, also when it lists problems; gate CI jobs with
+		  git lfs-policy check or git lfs-verify-remote.
+
+		EXAMPLES:
+		  # Print a Markdown report
+		  git lfs-report
+
+		  # Write an HTML report for a migration proposal
+		  git lfs-report -o lfs-report.html
+
+		  # In CI, also check the server and the commits of a pull request
+		  git lfs-report --verify-remote --range origin/main..HEAD -o lfs-report.md
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
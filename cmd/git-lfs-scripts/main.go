@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/plugin"
+	flag "github.com/spf13/pflag"
+)
+
+// describeTimeout bounds how long help waits for each plugin's summary
+const describeTimeout = 2 * time.Second
+
+// builtins are the suite's own commands, which plugins cannot shadow
+var builtins = []struct{ name, summary string }{
+	{"delete-github-repo", "Deletes the given GitHub, GitLab, Gitea or Bitbucket repo without prompting"},
+	{"giftless", "Run Giftless Git LFS server"},
+	{"lfs-archive", "Export a repository with its LFS objects as one file"},
+	{"lfs-bench", "Measure Git LFS transfer performance of a server"},
+	{"lfs-cache-serve", "Caching proxy for a Git LFS server"},
+	{"lfs-ci-prepare", "Fetch only the LFS files a CI build needs"},
+	{"lfs-compare", "Compare the LFS files of two refs or checkouts"},
+	{"lfs-cost", "Estimate monthly Git LFS hosting costs"},
+	{"lfs-endpoint", "Switch a repository between named LFS endpoint profiles"},
+	{"lfs-fetch-all-refs", "Fetch and verify LFS objects for all refs"},
+	{"lfs-files", "Frontend for git lfs ls-files with pattern permutation"},
+	{"lfs-folder-agent", "Store LFS objects in a shared folder (transfer agent)"},
+	{"lfs-forge", "Manage Git LFS settings on GitLab and Bitbucket"},
+	{"lfs-fsck-cache", "Verify, quarantine and restore local LFS objects"},
+	{"lfs-gc-server", "Prune unreachable LFS objects from bare repositories"},
+	{"lfs-hooks", "Report and repair the Git LFS hooks"},
+	{"lfs-inventory", "List GitHub repositories of an account and which use Git LFS"},
+	{"lfs-orphans", "Find LFS objects on the server that no ref references"},
+	{"lfs-policy", "Check a repository against its Git LFS policy file"},
+	{"lfs-preview", "Generate thumbnails and metadata previews of LFS assets"},
+	{"lfs-quota", "Report GitHub Git LFS quota and project exhaustion"},
+	{"lfs-report", "Write a Markdown or HTML report of Git LFS use"},
+	{"lfs-seed", "Copy local LFS objects into a server's storage over rsync"},
+	{"lfs-server-migrate", "Move LFS objects to another LFS server"},
+	{"lfs-teamsetup", "Set up a fresh clone with the team's Git LFS configuration"},
+	{"lfs-thin-clone", "Clone without LFS files, then pull only the paths needed"},
+	{"lfs-top", "Browse LFS files by size, age or path"},
+	{"lfs-trace", "Git LFS transfer adapter that reports protocol activity"},
+	{"lfs-track", "Frontend for git lfs track with pattern permutation"},
+	{"lfs-unarchive", "Restore a repository exported by git lfs-archive"},
+	{"lfs-untrack", "Frontend for git lfs untrack with pattern permutation"},
+	{"lfs-verify-remote", "Check that every referenced LFS object exists on the server"},
+	{"lfs-watch", "Warn about new large files that Git LFS does not track"},
+	{"ls-files", "Frontend for git ls-files with pattern permutation"},
+	{"new-bare-repo", "Creates a bare Git repository"},
+	{"nonlfs", "Lists files that are not in Git LFS"},
+	{"unmigrate", "Reverses git lfs migrate import for given wildmatch patterns"},
+}
+
+func main() {
+	// Everything after the subcommand belongs to it, so only leading
+	// options are parsed here
+	flag.CommandLine.SetInterspersed(false)
+	showHelp := flag.BoolP("help", "h", false, "Show help, including installed plugins")
+	showVersion := flag.Bool("version", false, "Show the version, commit, build date and plugin protocol")
+	subcommands := []string{"list", "context"}
+	for _, b := range builtins {
+		subcommands = append(subcommands, b.name)
+	}
+	completion.Handle(completion.Command{Name: "git-lfs-scripts", Flags: flag.CommandLine, Subcommands: subcommands})
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("%s\nPlugin protocol %d\n", common.VersionString("git-lfs-scripts"), plugin.Protocol)
+		return
+	}
+	args := flag.Args()
+	if *showHelp || len(args) == 0 {
+		printHelp(discover())
+		if len(args) == 0 && !*showHelp {
+			os.Exit(1)
+		}
+		return
+	}
+
+	name, rest := args[0], args[1:]
+	switch name {
+	case "help":
+		printHelp(discover())
+	case "list":
+		runList(rest)
+	case "context":
+		data, _ := json.MarshalIndent(plugin.NewContext("", common.Version), "", "  ")
+		fmt.Println(string(data))
+	default:
+		os.Exit(dispatch(name, rest))
+	}
+}
+
+// reserved returns the names plugins may not use
+func reserved() map[string]bool {
+	names := map[string]bool{"help": true, "list": true, "context": true}
+	for _, b := range builtins {
+		names[b.name] = true
+	}
+	return names
+}
+
+func discover() []plugin.Plugin {
+	plugins, err := plugin.Discover(os.Getenv("PATH"), plugin.DefaultManifests(), reserved())
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	return plugins
+}
+
+// dispatch runs a built-in command or a plugin and returns its exit code
+func dispatch(name string, args []string) int {
+	for _, b := range builtins {
+		if b.name == name {
+			cmd := exec.Command("git-"+name, args...)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					return exitErr.ExitCode()
+				}
+				common.PrintError("Cannot run git-%s: %v", name, err)
+			}
+			return 0
+		}
+	}
+
+	for _, p := range discover() {
+		if p.Name == name {
+			code, err := plugin.Run(p, args, plugin.NewContext(name, common.Version))
+			if err != nil {
+				common.PrintError("Cannot run plugin '%s' (%s): %v", name, p.Path, err)
+			}
+			return code
+		}
+	}
+
+	common.PrintError("'%s' is neither a command nor an installed plugin; run 'git lfs-scripts list'", name)
+	return 1
+}
+
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the plugins as JSON")
+	flags.Parse(args)
+
+	plugins := describeAll(discover())
+	if *asJSON {
+		if plugins == nil {
+			plugins = []plugin.Plugin{}
+		}
+		data, _ := json.MarshalIndent(plugins, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(plugins) == 0 {
+		fmt.Println("No plugins installed")
+		return
+	}
+	for _, p := range plugins {
+		fmt.Printf("%-20s %s\n", p.Name, p.Summary)
+		fmt.Printf("%-20s   %s (%s)\n", "", p.Path, p.Source)
+	}
+}
+
+func describeAll(plugins []plugin.Plugin) []plugin.Plugin {
+	for i, p := range plugins {
+		plugins[i] = plugin.Describe(p, describeTimeout)
+	}
+	return plugins
+}
+
+func printHelp(plugins []plugin.Plugin) {
+	var commands strings.Builder
+	for _, b := range builtins {
+		fmt.Fprintf(&commands, "  %-20s %s\n", b.name, b.summary)
+	}
+	var extensions strings.Builder
+	for _, p := range describeAll(plugins) {
+		fmt.Fprintf(&extensions, "  %-20s %s\n", p.Name, p.Summary)
+	}
+	if len(plugins) == 0 {
+		extensions.WriteString("  (none installed)\n")
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-scripts - Run the suite's commands and installed plugins
+
+		USAGE:
+		  git lfs-scripts COMMAND [ARGS...]
+		  git lfs-scripts list [--json]
+		  git lfs-scripts context
+
+		OPTIONS:
+		  -h, --help     Show this help message, including installed plugins
+		  --version      Show the suite version and plugin protocol
+
+		SUBCOMMANDS:
+		  list           List installed plugins, where they are and who registered them
+		  context        Print the JSON handshake a plugin would receive here
+		`))
+	fmt.Println("\nCOMMANDS:")
+	fmt.Print(commands.String())
+	fmt.Println("\nPLUGINS:")
+	fmt.Print(extensions.String())
+	fmt.Print(dedent.Dedent(`
+		DESCRIPTION:
+		  Plugins add subcommands without changing this repository. A plugin is
+		  either an executable on PATH named git-lfs-scripts-NAME, or any program
+		  registered in a plugin manifest:
+
+		    {"plugins": [{"name": "audit", "path": "/opt/lfs-tools/audit",
+		                  "summary": "Check the team's LFS policy"}]}
+
+		  Manifests are read from ~/.config/git-lfs-scripts/plugins.json and
+		  from every 'git config lfs-scripts.manifest' value, never from the
+		  working tree. Manifest entries win over PATH; built-in commands
+		  cannot be replaced.
+
+		  A plugin runs with the remaining arguments and these variables:
+		    GIT_LFS_SCRIPTS_CONTEXT   JSON with protocol, version, repo
+		                              (toplevel, git_dir, branch, head, remote_url)
+		                              and the lfs.*, audit.* and lfs-scripts.*
+		                              git config
+		    GIT_LFS_SCRIPTS_PROTOCOL  Handshake version, currently 1
+		    GIT_LFS_SCRIPTS_VERSION   Suite version
+		    GIT_LFS_SCRIPTS_TOPLEVEL  Top of the working tree, if any
+
+		  Its exit status is passed on. When called with --lfs-scripts-describe,
+		  a plugin may print {"summary": "..."} for this help and 'list'.
+
+		EXAMPLES:
+		  # Install a plugin written in any language
+		  install -m 755 audit.sh ~/bin/git-lfs-scripts-audit
+		  git lfs-scripts audit --strict
+
+		  # Register a team's plugins for every repository
+		  git config --global --add lfs-scripts.manifest /opt/lfs-tools/plugins.json
+
+		  # See what a plugin receives
+		  git lfs-scripts context
+	`))
+}
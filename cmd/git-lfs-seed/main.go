@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// rsync 3.1 introduced --info=progress2, which reports the whole transfer
+var rsync = prereq.Bin("rsync", "install from: https://rsync.samba.org/").WithPackage("rsync").AtLeast("3.1.0", "--version")
+
+// object is a file in the local LFS storage directory
+type object struct {
+	OID  string
+	Path string // Relative to the storage directory: OO/ID/OID
+	Size int64
+}
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	sshCommand := flag.StringP("ssh", "e", "ssh", "Remote shell command, e.g. 'ssh -p 2222 -i ~/.ssh/lfs'")
+	bwLimit := flag.String("bwlimit", "", "Limit the transfer rate, in rsync's --bwlimit syntax (e.g. 50M)")
+	noVerify := flag.Bool("no-verify", false, "Do not verify the object ids on the server after copying")
+	verifyOnly := flag.Bool("verify-only", false, "Only verify the object ids on the server")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-seed")
+	completion.Handle(completion.Command{Name: "git-lfs-seed", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp || flag.NArg() != 1 {
+		printHelp()
+		if *showHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	if *noVerify && *verifyOnly {
+		common.PrintError("--no-verify and --verify-only cannot be combined")
+	}
+	host, dir, err := parseDestination(flag.Arg(0))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	ssh := strings.Fields(*sshCommand)
+	if len(ssh) == 0 {
+		common.PrintError("--ssh must name a command")
+	}
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := prereq.Verify(prereq.Git, prereq.Bin(ssh[0], "install OpenSSH")); err != nil {
+		common.PrintError("%v", err)
+	}
+	if !*verifyOnly {
+		if err := prereq.Verify(rsync); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	objects, err := localObjects(storage)
+	if err != nil {
+		common.PrintError("Failed to read %s: %v", storage, err)
+	}
+	if len(objects) == 0 {
+		fmt.Printf("No LFS objects in %s; nothing to seed\n", storage)
+		return
+	}
+	var total int64
+	for _, obj := range objects {
+		total += obj.Size
+	}
+	destination := host + ":" + dir
+	fmt.Printf("Local LFS storage: %s (%d objects, %s)\n", storage, len(objects), common.FormatSize(total))
+	fmt.Printf("Remote LFS storage: %s\n", destination)
+
+	if !*verifyOnly {
+		audit := common.StartAudit("git-lfs-seed", *dryRun)
+		start := time.Now()
+		if err := seed(storage, objects, host, dir, ssh, *bwLimit); err != nil {
+			audit.Finish(err)
+			common.PrintError("%v", err)
+		}
+		if !*dryRun {
+			audit.Created(destination)
+			fmt.Printf("\n✓ Copied to %s in %s\n", destination, time.Since(start).Round(time.Second))
+		}
+		audit.Finish(nil)
+	}
+
+	if *noVerify {
+		return
+	}
+	if *dryRun && !*verifyOnly {
+		fmt.Printf("\nDRY RUN: would verify %d object ids on %s\n", len(objects), destination)
+		return
+	}
+
+	fmt.Printf("\nVerifying %d objects on %s...\n", len(objects), destination)
+	failed, err := verify(objects, host, dir, ssh)
+	if err != nil {
+		common.PrintError("Verification failed: %v", err)
+	}
+	if len(failed) > 0 {
+		fmt.Printf("✗ %d of %d objects are missing or corrupt on %s:\n", len(failed), len(objects), destination)
+		for _, path := range failed {
+			fmt.Printf("    %s\n", path)
+		}
+		fmt.Println("\nRerun the command to copy the missing objects; delete corrupt objects on the server first.")
+		os.Exit(2)
+	}
+	fmt.Printf("✓ All %d objects on %s match their object ids\n", len(objects), destination)
+}
+
+// parseDestination splits [USER@]HOST:DIR
+func parseDestination(arg string) (string, string, error) {
+	host, dir, found := strings.Cut(arg, ":")
+	if !found || host == "" || dir == "" || strings.Contains(host, "/") {
+		return "", "", fmt.Errorf("'%s' is not a remote directory; use [USER@]HOST:DIR", arg)
+	}
+	// ssh would take a host starting with a dash for an option
+	if strings.HasPrefix(host, "-") {
+		return "", "", fmt.Errorf("invalid host '%s'", host)
+	}
+	return host, strings.TrimSuffix(dir, "/"), nil
+}
+
+// localObjects lists the objects in the sharded storage directory. Files
+// elsewhere, such as incomplete downloads in tmp/, are ignored.
+func localObjects(storage string) ([]object, error) {
+	var objects []object
+	err := filepath.WalkDir(storage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == storage {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		name := d.Name()
+		if !d.Type().IsRegular() || !lfspointer.ValidOID(name) {
+			return nil
+		}
+		rel, err := filepath.Rel(storage, path)
+		if err != nil || filepath.ToSlash(rel) != filepath.ToSlash(filepath.Join(name[0:2], name[2:4], name)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object{OID: name, Path: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	return objects, err
+}
+
+// seed creates the remote directory and copies the objects missing there.
+// Objects are immutable, so files that already exist on the server are
+// skipped without comparing them; interrupted files wait in .rsync-partial
+// until a later run completes them.
+func seed(storage string, objects []object, host, dir string, ssh []string, bwLimit string) error {
+	fmt.Printf("\nCreating %s on %s...\n", dir, host)
+	mkdir := exec.Command(ssh[0], append(ssh[1:], "--", host, "mkdir -p -- "+common.RemoteQuote(dir))...)
+	if err := common.Run(mkdir); err != nil {
+		return fmt.Errorf("Failed to create %s on %s: %v", dir, host, err)
+	}
+
+	list, err := os.CreateTemp("", "git-lfs-seed-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	for _, obj := range objects {
+		fmt.Fprintln(list, obj.Path)
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+
+	args := []string{
+		"--recursive", "--times", "--ignore-existing",
+		"--partial-dir=.rsync-partial",
+		"--files-from=" + list.Name(),
+		"--info=progress2",
+		"--rsh=" + strings.Join(ssh, " "),
+	}
+	if bwLimit != "" {
+		args = append(args, "--bwlimit="+bwLimit)
+	}
+	args = append(args, storage+"/", host+":"+dir+"/")
+
+	fmt.Println("\nCopying objects with rsync...")
+	if err := common.RunCommand("rsync", args...); err != nil {
+		return fmt.Errorf("rsync failed: %v", err)
+	}
+	return nil
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-seed - Copy local Git LFS objects straight into a server's storage directory
+
+		USAGE:
+		  git lfs-seed [OPTIONS] [USER@]HOST:DIR
+
+		OPTIONS:
+		  -e, --ssh COMMAND    Remote shell command (default: ssh)
+		  --bwlimit RATE       Limit the transfer rate, e.g. 50M (rsync --bwlimit syntax)
+		  --no-verify          Do not verify the object ids on the server after copying
+		  --verify-only        Only verify the object ids on the server
+		  -d, --dry-run        Show what would be done without doing it
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Seeds a new LFS server with every object in the local LFS storage
+		  (.git/lfs/objects, or lfs.storage) by copying the files over SSH with
+		  rsync, instead of uploading them one by one through the Batch API.
+		  For initial imports of hundreds of gigabytes this is far faster.
+
+		  DIR must be the server's storage directory for this repository. Objects
+		  keep the sharded layout Git LFS uses everywhere, OO/ID/OID, which is
+		  also the layout of lfs/objects in bare repositories served over SSH
+		  (git-lfs-transfer, lfs-test-server). Servers that store objects in a
+		  different layout cannot be seeded this way.
+
+		  Objects already on the server are skipped, so an interrupted seed can
+		  simply be rerun; partial files wait in DIR/.rsync-partial until then.
+
+		  Afterwards, the server hashes every object with sha256sum (or shasum)
+		  and the command lists objects whose content does not match their object
+		  id. The exit status is 2 when objects are missing or corrupt.
+
+		  Copied files are owned by the SSH user. Make sure the account running
+		  the LFS server can read them.
+
+		EXAMPLES:
+		  # Seed a bare repository's LFS storage on a server
+		  git lfs-seed git@lfs.example.com:/srv/git/assets.git/lfs/objects
+
+		  # Use another SSH port and limit the bandwidth
+		  git lfs-seed -e 'ssh -p 2222' --bwlimit 50M lfs.example.com:/srv/lfs/assets
+
+		  # Re-check the server later
+		  git lfs-seed --verify-only lfs.example.com:/srv/lfs/assets
+	`))
+}
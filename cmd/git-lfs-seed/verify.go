@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// verifyScript checks a sha256sum list on stdin inside the storage
+// directory, printing only the files that are missing or do not match.
+// macOS and the BSDs ship shasum instead of sha256sum.
+const verifyScript = `if command -v sha256sum >/dev/null 2>&1; then sha256sum -c --quiet -; else shasum -a 256 -c --quiet -; fi`
+
+// verify has the server hash every object and returns the paths of those
+// that are missing or whose content does not match the object id
+func verify(objects []object, host, dir string, ssh []string) ([]string, error) {
+	var checklist bytes.Buffer
+	for _, obj := range objects {
+		fmt.Fprintf(&checklist, "%s  %s\n", obj.OID, obj.Path)
+	}
+
+	script := "cd -- " + common.RemoteQuote(dir) + " && " + verifyScript
+	cmd := exec.Command(ssh[0], append(ssh[1:], "--", host, script)...)
+	cmd.Stdin = &checklist
+	output, err := common.Query(cmd)
+
+	var failed []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if path, _, found := strings.Cut(scanner.Text(), ": FAILED"); found {
+			failed = append(failed, path)
+		}
+	}
+	if err != nil && len(failed) == 0 {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return failed, nil
+}
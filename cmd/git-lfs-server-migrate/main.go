@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	remote := flag.StringP("remote", "r", "origin", "Git remote whose LFS objects are migrated")
+	writeLFSConfig := flag.Bool("lfsconfig", false, "Also write the new URL to .lfsconfig (automatic when it already sets lfs.url)")
+	skipFetch := flag.Bool("skip-fetch", false, "Do not fetch from the current server; push what is already local")
+	verifyOnly := flag.Bool("verify-only", false, "Only verify that the new server has every object")
+	batchSize := flag.Int("batch-size", 100, "Objects per Batch API request during verification")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-server-migrate")
+	completion.Handle(completion.Command{Name: "git-lfs-server-migrate", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp || flag.NArg() != 1 {
+		printHelp()
+		if *showHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	newURL := strings.TrimSuffix(flag.Arg(0), "/")
+
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckLFSInstalled(); err != nil {
+		common.PrintError("%v", err)
+	}
+	if *batchSize <= 0 {
+		common.PrintError("--batch-size must be positive")
+	}
+
+	oldURL, source, err := lfsapi.Endpoint(*remote)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("Current LFS endpoint: %s (%s)\n", oldURL, source)
+	fmt.Printf("New LFS endpoint:     %s\n", newURL)
+	if oldURL == newURL && !*verifyOnly {
+		common.PrintError("The repository already uses %s", newURL)
+	}
+
+	updateLFSConfig := *writeLFSConfig || source == lfsapi.LFSConfigFile
+
+	var audit *common.Audit // Verification alone changes nothing
+	if !*verifyOnly {
+		audit = common.StartAudit("git-lfs-server-migrate", *dryRun)
+		if !*skipFetch {
+			networkStep("Fetching all LFS objects from the current server",
+				"git", "-c", "lfs.url="+oldURL, "lfs", "fetch", "--all", *remote)
+		}
+
+		step("Setting lfs.url in .git/config", "git", "config", "lfs.url", newURL)
+		if updateLFSConfig {
+			step("Setting lfs.url in "+lfsapi.LFSConfigFile, "git", "config", "-f", lfsapi.LFSConfigFile, "lfs.url", newURL)
+		}
+		if !*dryRun {
+			audit.Changed("lfs.url=" + newURL)
+			if updateLFSConfig {
+				audit.Changed(lfsapi.LFSConfigFile)
+			}
+		}
+
+		networkStep("Pushing all LFS objects to the new server", "git", "lfs", "push", "--all", *remote)
+	}
+
+	if *dryRun {
+		fmt.Println("\nDRY RUN: would verify every referenced object on the new server")
+		audit.Finish(nil)
+		return
+	}
+
+	fmt.Println("\nVerifying objects on the new server via the Batch API...")
+	objects, err := referencedObjects()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	client := lfsapi.NewClient(newURL, true)
+	missing, err := client.Missing(objects, *batchSize)
+	if err != nil {
+		common.PrintError("Verification failed: %v", err)
+	}
+
+	if len(missing) > 0 {
+		fmt.Printf("✗ %d of %d objects are missing on %s:\n", len(missing), len(objects), newURL)
+		for _, obj := range missing {
+			fmt.Printf("    %s (%s)\n", obj.OID, common.FormatSize(obj.Size))
+		}
+		fmt.Println()
+		fmt.Println("Fetch the missing objects and rerun, or restore the old endpoint with:")
+		fmt.Printf("  git config lfs.url %s\n", oldURL)
+		audit.Finish(fmt.Errorf("%d objects are missing on %s", len(missing), newURL))
+		os.Exit(2)
+	}
+
+	fmt.Printf("✓ All %d objects are present on %s\n", len(objects), newURL)
+	audit.Finish(nil)
+	if updateLFSConfig && !*verifyOnly {
+		fmt.Printf("\nCommit %s so other clones use the new server:\n", lfsapi.LFSConfigFile)
+		fmt.Printf("  git add %s && git commit -m \"Move Git LFS to %s\"\n", lfsapi.LFSConfigFile, newURL)
+	}
+}
+
+// referencedObjects returns every LFS object committed on any ref
+func referencedObjects() ([]lfsapi.Object, error) {
+	refs, err := lfspointer.AllRefs()
+	if err != nil {
+		return nil, err
+	}
+	pointers, err := lfspointer.ListRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	history, err := lfspointer.Added("", refs)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var objects []lfsapi.Object
+	for _, p := range append(pointers, history...) {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			objects = append(objects, lfsapi.Object{OID: p.OID, Size: p.Size})
+		}
+	}
+	return objects, nil
+}
+
+// step prints and runs one migration step, stopping at the first failure
+func step(description string, name string, args ...string) {
+	fmt.Printf("\n%s...\n", description)
+	if err := common.RunCommand(name, args...); err != nil {
+		common.PrintError("%s failed: %v", description, err)
+	}
+}
+
+// networkStep is step for a command that transfers objects, which is
+// retried and stopped after --timeout
+func networkStep(description string, name string, args ...string) {
+	fmt.Printf("\n%s...\n", description)
+	if err := common.RunNetwork(name, args...); err != nil {
+		common.PrintError("%s failed: %v", description, err)
+	}
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-server-migrate - Move a repository's Git LFS objects to another LFS server
+
+		USAGE:
+		  git lfs-server-migrate [OPTIONS] NEW_LFS_URL
+
+		OPTIONS:
+		  -r, --remote NAME    Git remote whose LFS objects are migrated (default: origin)
+		  --lfsconfig          Also write the new URL to .lfsconfig
+		                       (automatic when .lfsconfig already sets lfs.url)
+		  --skip-fetch         Do not fetch from the current server; push what is already local
+		  --verify-only        Only verify that the new server has every object
+		  --batch-size N       Objects per Batch API request during verification (default: 100)
+		  -d, --dry-run        Show what would be done without doing it
+		  --trace              Print every external command before running it
+		  --timeout DURATION   Stop the fetch or push if it takes longer, e.g. 2h
+		  --retries N          Retry a failed fetch or push N times (default: 2)
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Performs a server migration in four steps:
+		    1. Fetches every LFS object for all refs from the current endpoint
+		       (lfs.url, remote.NAME.lfsurl, .lfsconfig, or the remote's default)
+		    2. Sets lfs.url to NEW_LFS_URL in .git/config, and in .lfsconfig
+		    3. Pushes every LFS object for all refs to the new endpoint
+		    4. Asks the new server, via the Batch API, for every object referenced
+		       anywhere in the history of any ref, and lists those it lacks
+
+		  The migration stops at the first failing step. Credentials for the new
+		  server come from the Git credential helper.
+
+		  The exit status is 2 when objects are missing on the new server.
+
+		EXAMPLES:
+		  # Move from GitHub LFS to a self-hosted Giftless server
+		  git lfs-server-migrate https://lfs.example.com/myorg/myrepo
+
+		  # Preview the commands
+		  git lfs-server-migrate --dry-run https://lfs.example.com/myorg/myrepo
+
+		  # Re-check the new server later
+		  git lfs-server-migrate --verify-only https://lfs.example.com/myorg/myrepo
+	`))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// teamConfigFile is the committed file holding the team's recommended settings
+const teamConfigFile = ".lfsteamconfig"
+
+// setting is one key/value pair from the team configuration
+type setting struct {
+	key   string
+	value string
+}
+
+// teamConfig is the parsed team configuration. Only lfs.* settings are
+// applied to .git/config; a committed file must not be able to set options
+// such as core.hooksPath or core.fsmonitor that run arbitrary programs.
+type teamConfig struct {
+	lfs      []setting // Applied with git config --local
+	hooksDir string    // teamsetup.hooksdir: committed directory of hooks to install
+	fetch    bool      // teamsetup.fetch: perform the initial selective fetch
+	ignored  []string  // Keys outside the allowed sections
+}
+
+// readTeamConfig parses a team configuration file in git config syntax, e.g.
+//
+//	[lfs]
+//		fetchexclude = assets/raw/**,*.psd
+//		concurrenttransfers = 8
+//		locksverify = true
+//	[teamsetup]
+//		hooksdir = .githooks
+func readTeamConfig(path string) (*teamConfig, error) {
+	output, err := exec.Command("git", "config", "--file", path, "--null", "--list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return parseTeamConfig(string(output))
+}
+
+// parseTeamConfig parses git config --null --list output
+func parseTeamConfig(output string) (*teamConfig, error) {
+	config := &teamConfig{fetch: true}
+	for _, entry := range strings.Split(output, "\x00") {
+		if entry == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "\n")
+		if !found {
+			value = "true" // A key without '=' is a true boolean
+		}
+		switch {
+		case strings.HasPrefix(key, "lfs."):
+			config.lfs = append(config.lfs, setting{key: key, value: value})
+		case key == "teamsetup.hooksdir":
+			config.hooksDir = value
+		case key == "teamsetup.fetch":
+			fetch, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("teamsetup.fetch: %v", err)
+			}
+			config.fetch = fetch
+		default:
+			config.ignored = append(config.ignored, key)
+		}
+	}
+	return config, nil
+}
+
+// parseBool accepts the boolean spellings of git config
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' is not a boolean", value)
+}
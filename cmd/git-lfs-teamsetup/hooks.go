@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies hooks written by this command, so reruns may replace them
+const hookMarker = "# Installed by git-lfs-teamsetup"
+
+// lfsHooks are the hooks that git lfs install writes; a team hook with one of
+// these names runs before the Git LFS hook instead of replacing it
+var lfsHooks = map[string]bool{
+	"pre-push":      true,
+	"post-checkout": true,
+	"post-commit":   true,
+	"post-merge":    true,
+}
+
+// installHooks installs a wrapper in hooksPath for every executable file in
+// teamPath, the absolute form of teamDir. It returns the names of the
+// installed hooks.
+func installHooks(teamPath, hooksPath, teamDir string, force, dryRun bool) ([]string, error) {
+	entries, err := os.ReadDir(teamPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks directory %s: %v", teamDir, err)
+	}
+
+	var installed []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+			continue
+		}
+		name := entry.Name()
+		target := filepath.Join(hooksPath, name)
+
+		if existing, err := os.ReadFile(target); err == nil {
+			ours := strings.Contains(string(existing), hookMarker)
+			lfsOwned := lfsHooks[name] && isLFSHook(string(existing), name)
+			if !ours && !lfsOwned && !force {
+				fmt.Printf("  ⚠ %s: keeping the existing hook (use --force to replace it)\n", name)
+				continue
+			}
+		}
+
+		if dryRun {
+			fmt.Printf("  DRY RUN: would install %s from %s\n", name, teamDir)
+			installed = append(installed, name)
+			continue
+		}
+		if err := os.MkdirAll(hooksPath, 0755); err != nil {
+			return installed, err
+		}
+		if err := os.WriteFile(target, []byte(hookWrapper(teamDir, name)), 0755); err != nil {
+			return installed, fmt.Errorf("failed to write %s: %v", target, err)
+		}
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(target, 0755); err != nil {
+			return installed, err
+		}
+		fmt.Printf("  ✓ %s\n", name)
+		installed = append(installed, name)
+	}
+	return installed, nil
+}
+
+// isLFSHook reports whether a hook is the one git lfs install writes
+func isLFSHook(content, name string) bool {
+	return strings.Contains(content, "git lfs "+name)
+}
+
+// hookWrapper returns a hook that runs the committed team hook, so later
+// changes to it take effect without rerunning setup, followed by the Git LFS
+// hook of the same name if there is one. Standard input (e.g. the ref list
+// given to pre-push) is passed to both.
+func hookWrapper(teamDir, name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n%s from %s/%s\n", hookMarker, teamDir, name)
+	b.WriteString("input=$(cat)\n")
+	b.WriteString("feed() { if [ -n \"$input\" ]; then printf '%s\\n' \"$input\"; fi; }\n")
+	fmt.Fprintf(&b, "hook=\"$(git rev-parse --show-toplevel)/%s/%s\"\n", teamDir, name)
+	b.WriteString("if [ -x \"$hook\" ]; then\n")
+	b.WriteString("  feed | \"$hook\" \"$@\" || exit $?\n")
+	b.WriteString("fi\n")
+	if lfsHooks[name] {
+		b.WriteString("command -v git-lfs >/dev/null 2>&1 || { printf >&2 \"\\n%s\\n\\n\" \"This repository is configured for Git LFS but 'git-lfs' was not found on your path.\"; exit 2; }\n")
+		fmt.Fprintf(&b, "feed | git lfs %s \"$@\"\n", name)
+	}
+	return b.String()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	configFile := flag.StringP("config", "c", teamConfigFile, "Team configuration file, relative to the top of the working tree")
+	noHooks := flag.Bool("no-hooks", false, "Do not install the team's hooks")
+	noFetch := flag.Bool("no-fetch", false, "Skip the initial selective fetch")
+	force := flag.BoolP("force", "f", false, "Replace existing hooks that were not installed by this command")
+	installMissing := flag.Bool("install-missing", false, "Install Git and Git LFS if they are missing")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-teamsetup")
+	completion.Handle(completion.Command{Name: "git-lfs-teamsetup", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	fmt.Println("Checking prerequisites...")
+	if err := prereq.Ensure(*installMissing, prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	top, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	config := &teamConfig{fetch: true}
+	configPath := filepath.Join(top, *configFile)
+	if _, err := os.Stat(configPath); err == nil {
+		if config, err = readTeamConfig(configPath); err != nil {
+			common.PrintError("%v", err)
+		}
+		fmt.Printf("Using team configuration %s\n", *configFile)
+	} else {
+		fmt.Printf("No %s found; using the Git LFS defaults\n", *configFile)
+	}
+
+	audit := common.StartAudit("git-lfs-teamsetup", *dryRun)
+	step("Installing Git LFS filters and hooks", "git", "lfs", "install")
+
+	if len(config.lfs) > 0 {
+		fmt.Println("\nApplying the team's Git LFS settings...")
+		for _, s := range config.lfs {
+			fmt.Printf("  %s = %s\n", s.key, s.value)
+			if err := common.RunCommand("git", "config", "--local", s.key, s.value); err != nil {
+				common.PrintError("Failed to set %s: %v", s.key, err)
+			}
+			if !*dryRun {
+				audit.Changed(s.key + "=" + s.value)
+			}
+		}
+	}
+	for _, key := range config.ignored {
+		fmt.Printf("  ⚠ Ignoring %s: only lfs.* and teamsetup.* settings are applied\n", key)
+	}
+
+	if config.hooksDir != "" && !*noHooks {
+		fmt.Printf("\nInstalling the team's hooks from %s...\n", config.hooksDir)
+		if err := validateHooksDir(config.hooksDir); err != nil {
+			common.PrintError("teamsetup.hooksdir: %v", err)
+		}
+		hooksPath, err := gitOutput("rev-parse", "--path-format=absolute", "--git-path", "hooks")
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		installed, err := installHooks(filepath.Join(top, config.hooksDir), hooksPath, config.hooksDir, *force, *dryRun)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		if !*dryRun {
+			for _, name := range installed {
+				audit.Created(filepath.Join(hooksPath, name))
+			}
+		}
+	}
+
+	if config.fetch && !*noFetch {
+		include, _ := gitOutput("config", "--get", "lfs.fetchinclude")
+		exclude, _ := gitOutput("config", "--get", "lfs.fetchexclude")
+		if include != "" {
+			fmt.Printf("\nFetch include: %s", include)
+		}
+		if exclude != "" {
+			fmt.Printf("\nFetch exclude: %s", exclude)
+		}
+		if include != "" || exclude != "" {
+			fmt.Println()
+		}
+		fmt.Println("\nFetching and checking out Git LFS files...")
+		if err := common.RunNetwork("git", "lfs", "pull"); err != nil {
+			common.PrintError("Fetching Git LFS files failed: %v. Run 'git lfs pull' to try again", err)
+		}
+	}
+
+	audit.Finish(nil)
+	fmt.Println("\n✓ Setup complete")
+}
+
+// validateHooksDir rejects hook directories outside the working tree and
+// names that cannot be embedded safely in a shell script
+func validateHooksDir(dir string) error {
+	if filepath.IsAbs(dir) {
+		return fmt.Errorf("'%s' must be relative to the top of the working tree", dir)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if part == ".." {
+			return fmt.Errorf("'%s' must not leave the working tree", dir)
+		}
+	}
+	if strings.ContainsAny(dir, "\"$`\\\n") {
+		return fmt.Errorf("'%s' contains characters that are not allowed in a hook path", dir)
+	}
+	return nil
+}
+
+// step prints a description and runs a command, exiting if it fails
+func step(description string, name string, args ...string) {
+	fmt.Printf("\n%s...\n", description)
+	if err := common.RunCommand(name, args...); err != nil {
+		common.PrintError("%s failed: %v", description, err)
+	}
+}
+
+// gitOutput runs git and returns its trimmed standard output
+func gitOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-teamsetup - Prepare a fresh clone for working on a Git LFS repository
+
+		USAGE:
+		  git lfs-teamsetup [OPTIONS]
+
+		OPTIONS:
+		  -c, --config FILE     Team configuration file (default: .lfsteamconfig)
+		  --no-hooks            Do not install the team's hooks
+		  --no-fetch            Skip the initial selective fetch
+		  -f, --force           Replace existing hooks not installed by this command
+		  --install-missing     Install Git and Git LFS if they are missing
+		  -d, --dry-run         Show what would be done without doing it
+		  --trace               Print every external command before running it
+		  --timeout DURATION    Stop the fetch if it takes longer, e.g. 30m
+		  --retries N           Retry a failed fetch N times (default: 2)
+		  -h, --help            Show this help message
+		  --version             Show the version, commit and build date
+
+		DESCRIPTION:
+		  Run this once after cloning. It replaces the onboarding wiki page with
+		  a single command that:
+
+		    1. Verifies that Git and Git LFS are installed (--install-missing
+		       installs them with apt-get or Homebrew)
+		    2. Runs 'git lfs install'
+		    3. Applies the lfs.* settings from the committed team configuration
+		       to .git/config, e.g. fetch excludes, concurrent transfers and
+		       lock verification
+		    4. Installs the hooks from the directory named by teamsetup.hooksdir
+		    5. Runs 'git lfs pull', which honors lfs.fetchinclude and
+		       lfs.fetchexclude, so only the files the team needs are downloaded
+
+		  The team configuration uses git config syntax. Settings outside the
+		  [lfs] and [teamsetup] sections are ignored, so a committed file cannot
+		  enable options such as core.hooksPath that run arbitrary programs.
+
+		  Each installed hook is a small wrapper that runs the committed team
+		  hook, so later changes to it apply without rerunning setup. Team hooks
+		  named pre-push, post-checkout, post-commit or post-merge run before the
+		  Git LFS hook of the same name instead of replacing it.
+
+		  Rerunning the command is safe: settings are rewritten and hooks it
+		  installed earlier are replaced.
+
+		TEAM CONFIGURATION (.lfsteamconfig):
+		  [lfs]
+		      fetchexclude = assets/raw/**,*.psd
+		      concurrenttransfers = 8
+		      locksverify = true
+		  [teamsetup]
+		      hooksdir = .githooks
+		      fetch = true
+
+		EXAMPLES:
+		  # Set up a fresh clone
+		  git lfs-teamsetup
+
+		  # Preview the setup without changing anything
+		  git lfs-teamsetup --dry-run
+
+		  # Install missing prerequisites and skip the download
+		  git lfs-teamsetup --install-missing --no-fetch
+	`))
+}
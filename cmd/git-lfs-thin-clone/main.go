@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+// maxIncludeLength bounds the --include argument of one git lfs pull when
+// files are pulled by name, well below the command line limits of Windows
+const maxIncludeLength = 16 * 1024
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	includes := flag.StringSliceP("include", "I", nil, "Only pull LFS files matching these patterns (repeatable or comma-separated)")
+	excludes := flag.StringSliceP("exclude", "X", nil, "Do not pull LFS files matching these patterns (repeatable or comma-separated)")
+	maxSizeFlag := flag.StringP("max-size", "s", "", "Only pull LFS files of at most this size, e.g. 10MB")
+	branch := flag.StringP("branch", "b", "", "Check out this branch instead of the remote's HEAD")
+	depth := flag.Int("depth", 0, "Create a shallow clone with this many commits")
+	listSkipped := flag.Bool("list-skipped", false, "List every LFS file that was not pulled")
+	dryRun := flag.BoolP("dry-run", "d", false, "Show what would be done without doing it")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-thin-clone")
+	completion.Handle(completion.Command{Name: "git-lfs-thin-clone", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+	common.SetDryRun(*dryRun)
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() < 1 {
+		printHelp("Missing repository URL")
+	}
+	if flag.NArg() > 2 {
+		printHelp("Unexpected argument: " + flag.Arg(2))
+	}
+	var maxSize int64
+	if *maxSizeFlag != "" {
+		size, err := common.ParseSize(*maxSizeFlag)
+		if err != nil || size <= 0 {
+			printHelp("Invalid --max-size: " + *maxSizeFlag)
+		}
+		maxSize = size
+	}
+	if *depth < 0 {
+		printHelp("--depth must be positive")
+	}
+
+	url := flag.Arg(0)
+	dir := flag.Arg(1)
+	if dir == "" {
+		dir = cloneDir(url)
+	}
+	if dir == "" {
+		printHelp("Cannot derive a directory name from " + url + "; specify DIR")
+	}
+	// Checked before cloning, since retrying could not help
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		common.PrintError("%s already exists and is not empty", dir)
+	}
+
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	fmt.Printf("Cloning %s into %s without LFS files...\n", url, dir)
+	args := []string{"clone"}
+	if *branch != "" {
+		args = append(args, "--branch", *branch)
+	}
+	if *depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", *depth))
+	}
+	args = append(args, "--", url, dir)
+	err := common.Network("git clone", func(ctx context.Context) error {
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
+		return common.RunContext(ctx, cmd)
+	})
+	if err != nil {
+		common.PrintError("git clone failed: %v", err)
+	}
+
+	// Checkouts and pulls of the new clone must not download every LFS file
+	fmt.Println("\nConfiguring on-demand download of LFS files...")
+	if err := common.RunCommand("git", "-C", dir, "lfs", "install", "--local", "--skip-smudge"); err != nil {
+		common.PrintError("git lfs install --skip-smudge failed: %v", err)
+	}
+	// Later 'git lfs pull' and 'git lfs fetch' keep to the same paths
+	if len(*includes) > 0 {
+		if err := common.RunCommand("git", "-C", dir, "config", "lfs.fetchinclude", strings.Join(*includes, ",")); err != nil {
+			common.PrintError("Failed to set lfs.fetchinclude: %v", err)
+		}
+	}
+	if len(*excludes) > 0 {
+		if err := common.RunCommand("git", "-C", dir, "config", "lfs.fetchexclude", strings.Join(*excludes, ",")); err != nil {
+			common.PrintError("Failed to set lfs.fetchexclude: %v", err)
+		}
+	}
+
+	if common.DryRun {
+		fmt.Printf("DRY RUN: pull the LFS files of %s matching the selection\n", dir)
+		return
+	}
+
+	pointers, err := lfspointer.ListTreeIn(dir, "HEAD")
+	if err != nil {
+		common.PrintError("Failed to list the LFS files of HEAD: %v", err)
+	}
+	selected := lfsfiles.SelectPointers(pointers, *includes, *excludes)
+	var pulled, tooLarge []lfspointer.Pointer
+	for _, pointer := range selected {
+		if maxSize > 0 && pointer.Size > maxSize {
+			tooLarge = append(tooLarge, pointer)
+		} else {
+			pulled = append(pulled, pointer)
+		}
+	}
+	filtered := make([]lfspointer.Pointer, 0, len(pointers)-len(selected))
+	selectedPaths := make(map[string]bool, len(selected))
+	for _, pointer := range selected {
+		selectedPaths[pointer.Path] = true
+	}
+	for _, pointer := range pointers {
+		if !selectedPaths[pointer.Path] {
+			filtered = append(filtered, pointer)
+		}
+	}
+
+	fmt.Printf("\nPulling %d of %d LFS files (%s)...\n",
+		len(pulled), len(pointers), common.FormatSize(lfspointer.TotalSize(pulled)))
+	if len(pulled) > 0 {
+		if err := pull(dir, pulled, *includes, *excludes, maxSize > 0); err != nil {
+			common.PrintError("git lfs pull failed: %v", err)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("✓ Pulled %d LFS files (%s)\n", len(pulled), common.FormatSize(lfspointer.TotalSize(pulled)))
+	if len(filtered) > 0 {
+		fmt.Printf("  Skipped %d LFS files (%s) excluded by --include/--exclude\n",
+			len(filtered), common.FormatSize(lfspointer.TotalSize(filtered)))
+	}
+	if len(tooLarge) > 0 {
+		fmt.Printf("  Skipped %d LFS files (%s) larger than %s\n",
+			len(tooLarge), common.FormatSize(lfspointer.TotalSize(tooLarge)), common.FormatSize(maxSize))
+	}
+	skipped := append(filtered, tooLarge...)
+	if len(skipped) == 0 {
+		return
+	}
+	reportSkipped(skipped, *listSkipped)
+	fmt.Printf("\nThe skipped files are pointers in %s. Download them when needed with:\n", dir)
+	fmt.Println("  git lfs pull --include='PATH'")
+}
+
+// pull downloads the selected LFS files. Without a size limit, git lfs
+// pull applies the same patterns; with one, the files are named one by one,
+// in as many pulls as the length of the --include argument requires.
+func pull(dir string, pointers []lfspointer.Pointer, includes, excludes []string, byName bool) error {
+	if !byName {
+		args := []string{"-C", dir, "lfs", "pull"}
+		if len(includes) > 0 {
+			args = append(args, "--include="+strings.Join(includes, ","))
+		}
+		if len(excludes) > 0 {
+			args = append(args, "--exclude="+strings.Join(excludes, ","))
+		}
+		return common.RunNetwork("git", args...)
+	}
+
+	var batch []string
+	length := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// --exclude= overrides lfs.fetchexclude, which the names already obey
+		err := common.RunNetwork("git", "-C", dir, "lfs", "pull", "--include="+strings.Join(batch, ","), "--exclude=")
+		batch, length = batch[:0], 0
+		return err
+	}
+	for _, pointer := range pointers {
+		pattern := lfsfiles.EscapeFetchPattern(pointer.Path)
+		if length > 0 && length+len(pattern)+1 > maxIncludeLength {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, pattern)
+		length += len(pattern) + 1
+	}
+	return flush()
+}
+
+// dirTotal is the skipped LFS files of one top-level directory
+type dirTotal struct {
+	dir   string
+	files int
+	size  int64
+}
+
+// reportSkipped prints the skipped LFS files per top-level directory,
+// largest first, or every file with listAll
+func reportSkipped(skipped []lfspointer.Pointer, listAll bool) {
+	if listAll {
+		sort.Slice(skipped, func(i, j int) bool { return skipped[i].Path < skipped[j].Path })
+		fmt.Println("\nSkipped LFS files:")
+		for _, pointer := range skipped {
+			fmt.Printf("  %10s  %s\n", common.FormatSize(pointer.Size), pointer.Path)
+		}
+		return
+	}
+
+	totals := make(map[string]*dirTotal)
+	for _, pointer := range skipped {
+		dir := "."
+		if top, _, found := strings.Cut(pointer.Path, "/"); found {
+			dir = top + "/"
+		}
+		if totals[dir] == nil {
+			totals[dir] = &dirTotal{dir: dir}
+		}
+		totals[dir].files++
+		totals[dir].size += pointer.Size
+	}
+	var dirs []*dirTotal
+	for _, total := range totals {
+		dirs = append(dirs, total)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].size != dirs[j].size {
+			return dirs[i].size > dirs[j].size
+		}
+		return dirs[i].dir < dirs[j].dir
+	})
+	fmt.Println("\nSkipped LFS files by directory (--list-skipped lists them all):")
+	for _, total := range dirs {
+		fmt.Printf("  %10s  %5d files  %s\n", common.FormatSize(total.size), total.files, total.dir)
+	}
+}
+
+// cloneDir returns the directory git clone creates for a URL: the last
+// component of its path, without .git
+func cloneDir(url string) string {
+	name := strings.TrimRight(url, "/")
+	name = strings.TrimSuffix(name, "/.git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSuffix(name, ".git")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return path.Clean(name)
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	}
+	fmt.Print(dedent.Dedent(`
+		git-lfs-thin-clone - Clone without LFS files, then pull only the paths needed
+
+		USAGE:
+		  git lfs-thin-clone [OPTIONS] URL [DIR]
+
+		OPTIONS:
+		  -I, --include PATTERN  Only pull LFS files matching PATTERN; repeat or
+		                         separate with commas (default: every LFS file)
+		  -X, --exclude PATTERN  Do not pull LFS files matching PATTERN
+		  -s, --max-size SIZE    Only pull LFS files of at most SIZE, e.g. 10MB
+		  -b, --branch NAME      Check out NAME instead of the remote's HEAD
+		  --depth N              Create a shallow clone with N commits
+		  --list-skipped         List every LFS file that was not pulled,
+		                         instead of totals per directory
+		  -d, --dry-run          Show what would be done without doing it
+		  --trace                Print every external command before running it
+		  --timeout DURATION     Stop a clone or pull that takes longer, e.g. 30m
+		  --retries N            Retry a failed clone or pull N times (default: 2)
+		  -h, --help             Show this help message
+		  --version              Show the version, commit and build date
+
+		DESCRIPTION:
+		  Clones a repository for contributors who only need some of its LFS
+		  files. It:
+
+		    1. Clones URL into DIR with GIT_LFS_SKIP_SMUDGE=1, so every LFS file
+		       is checked out as a pointer
+		    2. Runs 'git lfs install --local --skip-smudge' in the clone, so that
+		       later checkouts and pulls leave LFS files as pointers too, and
+		       stores --include and --exclude as lfs.fetchinclude and
+		       lfs.fetchexclude, which later 'git lfs pull' and 'git lfs fetch'
+		       obey
+		    3. Pulls the LFS files of HEAD matching --include, not matching
+		       --exclude and no larger than --max-size
+		    4. Reports what was skipped, per top-level directory
+
+		  Patterns are those of 'git lfs fetch --include': globs, or directories
+		  standing for everything below them. DIR defaults to the last component
+		  of URL without .git, as for git clone.
+
+		  A skipped file stays a pointer until it is pulled by name, e.g.
+		  'git lfs pull --include=videos/intro.mp4'.
+
+		EXAMPLES:
+		  # Everything except the video assets
+		  git lfs-thin-clone -X 'assets/video' https://github.com/org/game.git
+
+		  # Only the textures, and none larger than 50 MB
+		  git lfs-thin-clone -I 'assets/textures/**' -s 50MB git@github.com:org/game.git
+
+		  # Later, fetch one of the skipped files
+		  cd game && git lfs pull --include='assets/video/intro.mp4'
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	list := flag.BoolP("list", "l", false, "Print the list instead of browsing it")
+	sortKey := flag.StringP("sort", "s", "size", "Sort by size, age or path")
+	reverse := flag.BoolP("reverse", "r", false, "Reverse the sort order")
+	limit := flag.IntP("limit", "n", 0, "With --list, print at most N files")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-top")
+	completion.Handle(completion.Command{Name: "git-lfs-top", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+		os.Exit(1)
+	}
+	if !slices.Contains(sortKeys, *sortKey) {
+		printHelp(fmt.Sprintf("Invalid --sort '%s': use %s", *sortKey, strings.Join(sortKeys, ", ")))
+		os.Exit(1)
+	}
+
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+
+	// The browser drives the terminal with stty, which Windows lacks
+	if *list || runtime.GOOS == "windows" || !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		objects, err := loadObjects()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		printList(objects, storage, *sortKey, *reverse, *limit)
+		return
+	}
+	if err := runBrowser(storage, *sortKey, *reverse); err != nil {
+		common.PrintError("%v", err)
+	}
+}
+
+// printList prints the summary and the sorted objects, at most limit of
+// them when limit is positive
+func printList(objects []object, storage, sortKey string, reverse bool, limit int) {
+	s := summarize(objects, storage)
+	fmt.Printf("%d LFS files, %s: %d local (%s), %d remote only (%s)\n",
+		s.Files, common.FormatSize(s.Size), s.LocalFiles, common.FormatSize(s.LocalSize),
+		s.Files-s.LocalFiles, common.FormatSize(s.Size-s.LocalSize))
+	fmt.Printf("Local storage: %d objects, %s; %d (%s) not used by HEAD\n\n",
+		s.StorageObjects, common.FormatSize(s.StorageSize), s.StaleObjects, common.FormatSize(s.StaleSize))
+	if len(objects) == 0 {
+		fmt.Println("No LFS files in HEAD")
+		return
+	}
+
+	sortObjects(objects, sortKey, reverse)
+	if limit > 0 && limit < len(objects) {
+		objects = objects[:limit]
+	}
+	fmt.Printf("%9s  %4s  %-6s  %-8s  %s\n", "SIZE", "AGE", "WHERE", "COMMIT", "PATH")
+	now := time.Now()
+	for _, o := range objects {
+		fmt.Println(formatObject(o, now))
+	}
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	}
+	fmt.Print(dedent.Dedent(`
+		git-lfs-top - Browse the Git LFS files of the current branch
+
+		USAGE:
+		  git lfs-top [OPTIONS]
+
+		OPTIONS:
+		  -s, --sort KEY   Sort by size (largest first), age (most recently
+		                   changed first) or path (default: size)
+		  -r, --reverse    Reverse the sort order
+		  -l, --list       Print the list instead of browsing it
+		  -n, --limit N    With --list, print at most N files
+		  -h, --help       Show this help message
+		  --trace          Print every external command before running it
+		  --version        Show the version, commit and build date
+
+		DESCRIPTION:
+		  Lists every LFS file of HEAD with its size, the commit that last
+		  changed it and how long ago, and where its content is:
+
+		    local   The object is in local storage and checked out
+		    cached  The object is in local storage; a pointer is checked out
+		    remote  Only the server has the object
+
+		  The header totals the files and the local storage, including the
+		  objects that no file of HEAD uses, which git lfs prune may remove.
+
+		KEYS:
+		  ↑ ↓ j k        Move; PgUp, PgDn, Home and End page through the list
+		  s  a  p        Sort by size, age or path; again to reverse
+		  r              Reverse the sort order
+		  /              Filter by a part of the path; empty to clear
+		  f              Fetch and check out the selected file (git lfs pull)
+		  c, Enter       Show the commit that last changed the selected file
+		  P              Run git lfs prune, after confirmation
+		  R              Rescan
+		  q, Esc         Quit
+
+		  When standard input or output is not a terminal, and on Windows, the
+		  list is printed as with --list.
+
+		EXAMPLES:
+		  # Browse the LFS files, most recently changed first
+		  git lfs-top --sort age
+
+		  # The 20 largest LFS files
+		  git lfs-top --list --limit 20
+	`))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// Sort orders of the object list
+var sortKeys = []string{"size", "age", "path"}
+
+// object is an LFS file of HEAD with the commit that last changed it
+type object struct {
+	lfsfiles.LongEntry
+	Commit string    // Empty when no commit of HEAD changed the path
+	Time   time.Time // Commit time of Commit
+}
+
+// summary describes the LFS files of HEAD and the local object storage
+type summary struct {
+	Files          int
+	Size           int64
+	LocalFiles     int // Files whose object is in local storage
+	LocalSize      int64
+	StorageObjects int // Every object in local storage
+	StorageSize    int64
+	StaleObjects   int // Stored objects no LFS file of HEAD references
+	StaleSize      int64
+}
+
+// loadObjects lists the LFS files of HEAD with their storage presence,
+// checkout state and last change
+func loadObjects() ([]object, error) {
+	entries, err := lfsfiles.ListLong(nil)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		paths[e.Path] = true
+	}
+	changes, err := lastChanges(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]object, len(entries))
+	for i, e := range entries {
+		objects[i] = object{LongEntry: e}
+		if c, ok := changes[e.Path]; ok {
+			objects[i].Commit, objects[i].Time = c.Commit, c.Time
+		}
+	}
+	return objects, nil
+}
+
+// change is the commit that last changed a path
+type change struct {
+	Commit string
+	Time   time.Time
+}
+
+// lastChanges finds the newest commit of HEAD changing each of paths,
+// reading the log only until every path was seen
+func lastChanges(paths map[string]bool) (map[string]change, error) {
+	changes := make(map[string]change, len(paths))
+	if len(paths) == 0 {
+		return changes, nil
+	}
+	cmd := exec.Command("git", "log", "--format=%x00%H %ct", "--name-only", "--no-renames", "HEAD")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var current change
+	for scanner.Scan() && len(changes) < len(paths) {
+		line := scanner.Text()
+		if header, found := strings.CutPrefix(line, "\x00"); found {
+			commit, seconds, _ := strings.Cut(header, " ")
+			unix, _ := strconv.ParseInt(seconds, 10, 64)
+			current = change{Commit: commit, Time: time.Unix(unix, 0)}
+			continue
+		}
+		if _, seen := changes[line]; paths[line] && !seen {
+			changes[line] = current
+		}
+	}
+	// The rest of the log is not needed
+	cmd.Process.Kill()
+	cmd.Wait()
+	return changes, nil
+}
+
+// summarize totals the objects and walks local storage for the objects
+// that no LFS file of HEAD references, which git lfs prune may remove
+func summarize(objects []object, storage string) summary {
+	var s summary
+	referenced := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		s.Files++
+		s.Size += max(o.Size, 0)
+		if o.Cached {
+			s.LocalFiles++
+			s.LocalSize += max(o.Size, 0)
+		}
+		referenced[o.OID] = true
+	}
+
+	filepath.WalkDir(storage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !lfspointer.ValidOID(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		s.StorageObjects++
+		s.StorageSize += info.Size()
+		if !referenced[d.Name()] {
+			s.StaleObjects++
+			s.StaleSize += info.Size()
+		}
+		return nil
+	})
+	return s
+}
+
+// sortObjects orders objects by key: largest, most recently changed, or by
+// path first; reverse inverts the order
+func sortObjects(objects []object, key string, reverse bool) {
+	less := func(a, b object) bool {
+		switch key {
+		case "age":
+			if !a.Time.Equal(b.Time) {
+				return a.Time.After(b.Time)
+			}
+		case "size":
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		}
+		return a.Path < b.Path
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if reverse {
+			return less(objects[j], objects[i])
+		}
+		return less(objects[i], objects[j])
+	})
+}
+
+// filterObjects returns the objects whose path contains text, ignoring case
+func filterObjects(objects []object, text string) []object {
+	if text == "" {
+		return objects
+	}
+	text = strings.ToLower(text)
+	var filtered []object
+	for _, o := range objects {
+		if strings.Contains(strings.ToLower(o.Path), text) {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// age formats how long ago t was, e.g. 3d or 5mo
+func age(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "?"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Hour:
+		return strconv.Itoa(int(d.Minutes())) + "m"
+	case d < 24*time.Hour:
+		return strconv.Itoa(int(d.Hours())) + "h"
+	case d < 60*24*time.Hour:
+		return strconv.Itoa(int(d.Hours()/24)) + "d"
+	case d < 2*365*24*time.Hour:
+		return strconv.Itoa(int(d.Hours()/24/30)) + "mo"
+	}
+	return strconv.Itoa(int(d.Hours()/24/365)) + "y"
+}
+
+// location describes where an object's content is
+func location(o object) string {
+	switch {
+	case o.Cached && o.Checkout == lfsfiles.CheckoutContent:
+		return "local"
+	case o.Cached:
+		return "cached"
+	}
+	return "remote"
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	clearLine   = "\033[K"
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[2m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+	reverseText = "\033[7m"
+
+	// headerLines and footerLines are the screen lines around the list
+	headerLines = 4
+	footerLines = 2
+)
+
+// Keys that arrive as escape sequences
+const (
+	keyUp = iota + 256
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEscape
+)
+
+// browser is the interactive object list
+type browser struct {
+	storage string
+	objects []object // Every LFS file of HEAD
+	shown   []object // The filtered and sorted objects on screen
+	summary summary
+	sortKey string
+	reverse bool
+	filter  string
+	cursor  int
+	offset  int // Index of the first shown object on screen
+	status  string
+	rows    int
+	cols    int
+	input   *bufio.Reader
+	saved   string // Terminal settings to restore
+}
+
+// runBrowser shows the objects until the user quits
+func runBrowser(storage, sortKey string, reverse bool) error {
+	b := &browser{storage: storage, sortKey: sortKey, reverse: reverse, input: bufio.NewReader(os.Stdin)}
+	if err := b.load(); err != nil {
+		return err
+	}
+	if err := b.raw(); err != nil {
+		return err
+	}
+	defer func() {
+		b.restore()
+		fmt.Print(clearScreen)
+	}()
+
+	for {
+		b.draw()
+		key := b.readKey()
+		b.status = ""
+		switch key {
+		case 'q', 'Q', keyEscape, 3, 4: // Ctrl-C and Ctrl-D too
+			return nil
+		case keyUp, 'k':
+			b.move(-1)
+		case keyDown, 'j':
+			b.move(1)
+		case keyPageUp:
+			b.move(-b.pageSize())
+		case keyPageDown, ' ':
+			b.move(b.pageSize())
+		case keyHome, 'g':
+			b.move(-len(b.shown))
+		case keyEnd, 'G':
+			b.move(len(b.shown))
+		case 's', 'a', 'p':
+			sortKey := map[int]string{'s': "size", 'a': "age", 'p': "path"}[key]
+			if sortKey == b.sortKey {
+				b.reverse = !b.reverse
+			} else {
+				b.sortKey, b.reverse = sortKey, false
+			}
+			b.refresh()
+		case 'r':
+			b.reverse = !b.reverse
+			b.refresh()
+		case '/':
+			b.filter = b.prompt("Filter paths: ", b.filter)
+			b.refresh()
+		case 'f':
+			b.fetch()
+		case 'c', '\r', '\n':
+			b.showCommit()
+		case 'P':
+			b.prune()
+		case 'R':
+			b.reload("Rescanned")
+		}
+	}
+}
+
+// load reads the objects and local storage again
+func (b *browser) load() error {
+	objects, err := loadObjects()
+	if err != nil {
+		return err
+	}
+	b.objects = objects
+	b.summary = summarize(objects, b.storage)
+	b.refresh()
+	return nil
+}
+
+// reload rescans after a command changed the objects, keeping the cursor
+// on the same path when it is still listed
+func (b *browser) reload(status string) {
+	selected := ""
+	if o, ok := b.selected(); ok {
+		selected = o.Path
+	}
+	if err := b.load(); err != nil {
+		b.status = colorRed + err.Error() + colorReset
+		return
+	}
+	for i, o := range b.shown {
+		if o.Path == selected {
+			b.cursor = i
+		}
+	}
+	b.move(0)
+	b.status = status
+}
+
+// refresh filters and sorts the objects after a change of settings
+func (b *browser) refresh() {
+	b.shown = filterObjects(b.objects, b.filter)
+	sortObjects(b.shown, b.sortKey, b.reverse)
+	b.cursor, b.offset = 0, 0
+}
+
+func (b *browser) selected() (object, bool) {
+	if b.cursor < len(b.shown) {
+		return b.shown[b.cursor], true
+	}
+	return object{}, false
+}
+
+func (b *browser) pageSize() int {
+	return max(b.rows-headerLines-footerLines, 1)
+}
+
+// move moves the cursor by delta lines, scrolling to keep it on screen
+func (b *browser) move(delta int) {
+	b.cursor = max(min(b.cursor+delta, len(b.shown)-1), 0)
+	page := b.pageSize()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+page {
+		b.offset = b.cursor - page + 1
+	}
+}
+
+func (b *browser) draw() {
+	b.rows, b.cols = terminalSize()
+	b.move(0)
+	s := b.summary
+	var out strings.Builder
+	out.WriteString(clearScreen)
+	fmt.Fprintf(&out, "%sgit-lfs-top%s  %d LFS files, %s  %s%d local (%s)%s  %s%d remote only (%s)%s\n",
+		colorBold, colorReset, s.Files, common.FormatSize(s.Size),
+		colorGreen, s.LocalFiles, common.FormatSize(s.LocalSize), colorReset,
+		colorYellow, s.Files-s.LocalFiles, common.FormatSize(s.Size-s.LocalSize), colorReset)
+	fmt.Fprintf(&out, "Local storage: %d objects, %s; %d (%s) not used by HEAD\n",
+		s.StorageObjects, common.FormatSize(s.StorageSize), s.StaleObjects, common.FormatSize(s.StaleSize))
+	direction := "↓"
+	if b.reverse {
+		direction = "↑"
+	}
+	fmt.Fprintf(&out, "Sort: %s %s", b.sortKey, direction)
+	if b.filter != "" {
+		fmt.Fprintf(&out, "   Filter: %s (%d of %d)", b.filter, len(b.shown), len(b.objects))
+	}
+	out.WriteString("\n")
+	fmt.Fprintf(&out, "%s  %9s  %4s  %-6s  %-8s  %s%s\n", colorDim, "SIZE", "AGE", "WHERE", "COMMIT", "PATH", colorReset)
+
+	now := time.Now()
+	end := min(b.offset+b.pageSize(), len(b.shown))
+	for i := b.offset; i < end; i++ {
+		line := formatObject(b.shown[i], now)
+		if len([]rune(line)) > b.cols-2 {
+			line = string([]rune(line)[:max(b.cols-3, 0)]) + "…"
+		}
+		if i == b.cursor {
+			fmt.Fprintf(&out, "%s> %s%s\n", reverseText, line, colorReset)
+		} else {
+			fmt.Fprintf(&out, "  %s\n", line)
+		}
+	}
+	for i := end - b.offset; i < b.pageSize(); i++ {
+		out.WriteString("\n")
+	}
+
+	fmt.Fprintf(&out, "%s%s%s\n", colorDim,
+		"↑↓ move  s/a/p sort by size/age/path  r reverse  / filter  f fetch  c commit  P prune  R rescan  q quit",
+		colorReset)
+	out.WriteString(b.status + clearLine)
+	fmt.Print(out.String())
+}
+
+// formatObject formats an object as a line of the list
+func formatObject(o object, now time.Time) string {
+	commit := o.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	size := "?"
+	if o.Size >= 0 {
+		size = common.FormatSize(o.Size)
+	}
+	return fmt.Sprintf("%9s  %4s  %-6s  %-8s  %s", size, age(o.Time, now), location(o), commit, o.Path)
+}
+
+// fetch downloads the selected object and checks it out
+func (b *browser) fetch() {
+	o, ok := b.selected()
+	switch {
+	case !ok:
+		return
+	case o.Cached && o.Checkout == lfsfiles.CheckoutContent:
+		b.status = o.Path + " is already local"
+		return
+	case strings.Contains(o.Path, ","):
+		// git lfs splits --include patterns at commas
+		b.status = colorRed + "Paths containing commas cannot be fetched individually; use git lfs pull" + colorReset
+		return
+	}
+	err := b.run(true, "git", "lfs", "pull", "--include="+lfsfiles.EscapeFetchPattern(o.Path))
+	if err != nil {
+		b.reload(colorRed + "git lfs pull failed: " + err.Error() + colorReset)
+		return
+	}
+	b.reload(colorGreen + "✓ Fetched " + o.Path + colorReset)
+}
+
+// showCommit shows the commit that last changed the selected file
+func (b *browser) showCommit() {
+	o, ok := b.selected()
+	if !ok {
+		return
+	}
+	if o.Commit == "" {
+		b.status = "No commit of HEAD changed " + o.Path
+		return
+	}
+	if err := b.run(false, "git", "show", "--stat", o.Commit, "--", o.Path); err != nil {
+		b.status = colorRed + "git show failed: " + err.Error() + colorReset
+	}
+}
+
+// prune runs git lfs prune once the user confirmed it
+func (b *browser) prune() {
+	s := b.summary
+	answer := b.prompt(fmt.Sprintf("Run git lfs prune? %d stored objects (%s) are not used by HEAD; prune keeps recent and unpushed ones [y/N] ",
+		s.StaleObjects, common.FormatSize(s.StaleSize)), "")
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		b.status = "Prune cancelled"
+		return
+	}
+	if err := b.run(true, "git", "lfs", "prune", "--verbose"); err != nil {
+		b.reload(colorRed + "git lfs prune failed: " + err.Error() + colorReset)
+		return
+	}
+	b.reload(colorGreen + "✓ Pruned" + colorReset)
+}
+
+// run runs a command on the normal terminal, waiting for a key afterwards
+// when pause is set so that its output can be read
+func (b *browser) run(pause bool, name string, args ...string) error {
+	b.restore()
+	fmt.Print(clearScreen)
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := common.RunInteractive(cmd)
+	if rawErr := b.raw(); rawErr != nil {
+		common.PrintError("%v", rawErr)
+	}
+	if pause {
+		fmt.Print("\nPress any key to return")
+		b.readKey()
+	}
+	return err
+}
+
+// prompt reads a line at the bottom of the screen, starting from value.
+// Escape, Ctrl-C and Ctrl-D cancel and return value unchanged.
+func (b *browser) prompt(label, value string) string {
+	line := []rune(value)
+	for {
+		fmt.Printf("\r%s%s%s", label, string(line), clearLine)
+		switch key := b.readKey(); key {
+		case '\r', '\n':
+			return string(line)
+		case keyEscape, 3, 4:
+			return value
+		case 127, 8:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			if key >= ' ' && key < keyUp {
+				line = append(line, rune(key))
+			}
+		}
+	}
+}
+
+// readKey reads a key, decoding the escape sequences of the arrow, page
+// and home/end keys. The end of input reads as Ctrl-D.
+func (b *browser) readKey() int {
+	r, _, err := b.input.ReadRune()
+	if err != nil {
+		return 4
+	}
+	if r != '\033' {
+		return int(r)
+	}
+	// A lone Escape arrives without the rest of a sequence
+	if b.input.Buffered() == 0 {
+		return keyEscape
+	}
+	sequence := ""
+	for b.input.Buffered() > 0 {
+		c, _ := b.input.ReadByte()
+		sequence += string(c)
+		if len(sequence) > 1 && (c >= 'A' && c <= 'Z' || c == '~') {
+			break
+		}
+	}
+	switch sequence {
+	case "[A", "OA":
+		return keyUp
+	case "[B", "OB":
+		return keyDown
+	case "[5~":
+		return keyPageUp
+	case "[6~":
+		return keyPageDown
+	case "[H", "OH", "[1~":
+		return keyHome
+	case "[F", "OF", "[4~":
+		return keyEnd
+	}
+	return 0
+}
+
+// raw switches the terminal to reading single keys without echo, Ctrl-C
+// included, remembering its settings for restore
+func (b *browser) raw() error {
+	saved, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("failed to read the terminal settings: %v", err)
+	}
+	b.saved = saved
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return fmt.Errorf("failed to configure the terminal: %v", err)
+	}
+	fmt.Print("\033[?25l") // Hide the cursor
+	return nil
+}
+
+func (b *browser) restore() {
+	if b.saved != "" {
+		stty(b.saved)
+	}
+	fmt.Print("\033[?25h")
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// terminalSize returns the rows and columns of the terminal, or 24x80
+func terminalSize() (int, int) {
+	output, err := stty("size")
+	if err == nil {
+		if rows, cols, found := strings.Cut(output, " "); found {
+			r, rErr := strconv.Atoi(rows)
+			c, cErr := strconv.Atoi(cols)
+			if rErr == nil && cErr == nil && r > 0 && c > 0 {
+				return r, c
+			}
+		}
+	}
+	return 24, 80
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
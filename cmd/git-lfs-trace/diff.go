@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+	flag "github.com/spf13/pflag"
+)
+
+// exchange is a request paired with the response that followed it in the same process
+type exchange struct {
+	key      string // event, oid and occurrence, used to align two sessions
+	event    string
+	oid      string
+	duration time.Duration
+	response *Response // nil when the session ended before the response
+}
+
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	threshold := flags.Duration("threshold", 100*time.Millisecond, "Report timing differences larger than this")
+	showHelp := flags.BoolP("help", "h", false, "Show help")
+	flags.Parse(args)
+
+	if *showHelp || flags.NArg() != 2 {
+		printDiffHelp()
+		if *showHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+
+	pathA, pathB := flags.Arg(0), flags.Arg(1)
+	a := loadExchanges(pathA)
+	b := loadExchanges(pathB)
+
+	fmt.Printf("--- %s (%d exchanges, %s)\n", pathA, len(a), totalDuration(a))
+	fmt.Printf("+++ %s (%d exchanges, %s)\n", pathB, len(b), totalDuration(b))
+
+	byKey := make(map[string]exchange, len(b))
+	for _, x := range b {
+		byKey[x.key] = x
+	}
+
+	matched, differing, onlyA := 0, 0, 0
+	for _, xa := range a {
+		xb, found := byKey[xa.key]
+		if !found {
+			onlyA++
+			fmt.Printf("- %s: only in %s\n", label(xa), pathA)
+			continue
+		}
+		delete(byKey, xa.key)
+		matched++
+
+		differences := compareExchanges(xa, xb, *threshold)
+		if len(differences) > 0 {
+			differing++
+			fmt.Printf("~ %s:\n", label(xa))
+			for _, d := range differences {
+				fmt.Printf("    %s\n", d)
+			}
+		}
+	}
+
+	onlyB := 0
+	for _, xb := range b {
+		if _, remaining := byKey[xb.key]; remaining {
+			onlyB++
+			fmt.Printf("+ %s: only in %s\n", label(xb), pathB)
+		}
+	}
+
+	fmt.Printf("\n%d matched, %d differ, %d only in %s, %d only in %s\n", matched, differing, onlyA, pathA, onlyB, pathB)
+	if differing > 0 || onlyA > 0 || onlyB > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadExchanges reads a session and pairs its requests and responses
+func loadExchanges(path string) []exchange {
+	entries, err := readSession(path)
+	if err != nil {
+		common.PrintError("Failed to read session: %v", err)
+	}
+	return pairExchanges(entries)
+}
+
+// pairExchanges pairs each request with the next response of the same process
+func pairExchanges(entries []sessionEntry) []exchange {
+	type pendingRequest struct {
+		index int
+		time  time.Time
+	}
+	pending := make(map[int]pendingRequest)
+	occurrences := make(map[string]int)
+	var exchanges []exchange
+
+	for _, entry := range entries {
+		switch {
+		case entry.Request != nil:
+			oid := requestOID(*entry.Request)
+			base := entry.Request.Event + " " + oid
+			occurrences[base]++
+			exchanges = append(exchanges, exchange{
+				key:   fmt.Sprintf("%s #%d", base, occurrences[base]),
+				event: entry.Request.Event,
+				oid:   oid,
+			})
+			pending[entry.PID] = pendingRequest{index: len(exchanges) - 1, time: entry.Time}
+		case entry.Response != nil:
+			p, found := pending[entry.PID]
+			if !found {
+				continue
+			}
+			delete(pending, entry.PID)
+			exchanges[p.index].response = entry.Response
+			exchanges[p.index].duration = entry.Time.Sub(p.time)
+		}
+	}
+	return exchanges
+}
+
+// compareExchanges describes how two aligned exchanges differ
+func compareExchanges(a, b exchange, threshold time.Duration) []string {
+	var differences []string
+	if outcomeA, outcomeB := outcome(a.response), outcome(b.response); outcomeA != outcomeB {
+		differences = append(differences, fmt.Sprintf("outcome: %s -> %s", outcomeA, outcomeB))
+	} else if a.response != nil && b.response != nil {
+		objectsA, _ := json.Marshal(a.response.Objects)
+		objectsB, _ := json.Marshal(b.response.Objects)
+		if string(objectsA) != string(objectsB) {
+			differences = append(differences, fmt.Sprintf("response: %s -> %s", objectsA, objectsB))
+		}
+	}
+
+	delta := b.duration - a.duration
+	if delta > threshold || -delta > threshold {
+		sign := "+"
+		if delta < 0 {
+			sign = ""
+		}
+		differences = append(differences, fmt.Sprintf("timing: %s -> %s (%s%s)",
+			a.duration.Round(time.Millisecond), b.duration.Round(time.Millisecond), sign, delta.Round(time.Millisecond)))
+	}
+	return differences
+}
+
+func outcome(response *Response) string {
+	switch {
+	case response == nil:
+		return "no response"
+	case response.Success:
+		return "success"
+	default:
+		return fmt.Sprintf("failed (%s)", response.Error)
+	}
+}
+
+// requestOID returns the oid of the first object in a request, if any
+func requestOID(request transfer.Request) string {
+	objects := request.Batch()
+	if len(objects) == 0 {
+		return ""
+	}
+	return objects[0].OID
+}
+
+func label(x exchange) string {
+	if x.oid == "" {
+		return x.event
+	}
+	return x.event + " " + shortOID(x.oid)
+}
+
+func totalDuration(exchanges []exchange) time.Duration {
+	var total time.Duration
+	for _, x := range exchanges {
+		total += x.duration
+	}
+	return total.Round(time.Millisecond)
+}
+
+func printDiffHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-trace diff - Compare two recorded trace sessions
+
+		USAGE:
+		  git lfs-trace diff [OPTIONS] A.log B.log
+
+		OPTIONS:
+		  --threshold DURATION   Report timing differences larger than this (default: 100ms)
+		  -h, --help             Show this help message
+
+		DESCRIPTION:
+		  Reads two sessions recorded with 'git lfs-trace --record FILE', pairs each
+		  request with its response, and aligns the two sessions by event and OID.
+		  For every aligned exchange it reports changed outcomes (success or the
+		  error message), changed response objects, and response times that differ
+		  by more than the threshold. Exchanges found in only one session are
+		  listed as well.
+
+		  Like diff(1), the exit status is 1 when the sessions differ.
+
+		EXAMPLES:
+		  # Record the same push against two servers, then compare
+		  git config lfs.customtransfer.trace.args "--record /tmp/before.log"
+		  git push old-server main
+		  git config lfs.customtransfer.trace.args "--record /tmp/after.log"
+		  git push new-server main
+		  git lfs-trace diff /tmp/before.log /tmp/after.log
+	`))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[0;31m"
+	colorGreen  = "\033[0;32m"
+	colorYellow = "\033[1;33m"
+	colorBlue   = "\033[0;34m"
+	colorCyan   = "\033[0;36m"
+)
+
+// traceLog writes the protocol stream with sequence numbers, direction
+// markers and timing. Requests travel client→agent, responses agent→client.
+type traceLog struct {
+	out   io.Writer
+	color bool
+	start time.Time
+	last  time.Time // Time of the previous message
+	seq   int
+	mu    sync.Mutex // Objects are transferred concurrently
+}
+
+// newTraceLog logs to stderr, or appends to path when it is not empty.
+// colorMode is auto, always or never; auto colors only a terminal and
+// honors NO_COLOR.
+func newTraceLog(path, colorMode string) (*traceLog, error) {
+	var out *os.File = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	var color bool
+	switch colorMode {
+	case "always":
+		color = true
+	case "never":
+		color = false
+	case "auto", "":
+		color = isTerminal(out) && os.Getenv("NO_COLOR") == ""
+	default:
+		return nil, fmt.Errorf("--color must be auto, always or never")
+	}
+
+	now := time.Now()
+	return &traceLog{out: out, color: color, start: now, last: now}, nil
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (l *traceLog) request(request transfer.Request) {
+	l.message("client→agent", colorCyan, request.Event, request)
+}
+
+func (l *traceLog) progress(progress transfer.Progress) {
+	l.message("agent→client", colorBlue, progress.Event, progress)
+}
+
+func (l *traceLog) response(response Response) {
+	l.agent(response.Event, response.Success, response)
+}
+
+// agent logs a message answering a request, v being a Response or, with
+// --proxy, the message of the real agent
+func (l *traceLog) agent(event string, success bool, v interface{}) {
+	color := colorGreen
+	if !success {
+		color, event = colorRed, event+" (failed)"
+	}
+	l.message("agent→client", color, event, v)
+}
+
+// message writes a header line followed by the indented JSON of v. The
+// header shows the time since the adapter started and since the previous
+// message, which for a response is the time the agent took to answer.
+func (l *traceLog) message(direction, color, event string, v interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.seq++
+	header := fmt.Sprintf("#%-4d %s %-8s +%s (Δ%s)", l.seq, direction, event,
+		formatElapsed(now.Sub(l.start)), formatElapsed(now.Sub(l.last)))
+	l.last = now
+
+	body, _ := json.MarshalIndent(v, "  ", "  ")
+	fmt.Fprintf(l.out, "\n%s\n  %s\n", l.paint(color, header), body)
+}
+
+// note writes an out-of-band line, such as a simulation event
+func (l *traceLog) note(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, "\n%s\n", l.paint(colorYellow, "== "+fmt.Sprintf(format, args...)+" =="))
+}
+
+func (l *traceLog) paint(color, s string) string {
+	if !l.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (l *traceLog) close() {
+	if f, ok := l.out.(*os.File); ok && f != os.Stderr {
+		f.Close()
+	}
+}
+
+// formatElapsed shows durations in milliseconds up to a second
+func formatElapsed(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
@@ -7,21 +7,31 @@ import (
 	"os"
 
 	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
 	flag "github.com/spf13/pflag"
 )
 
-// Request represents a Git LFS transfer request
-type Request struct {
-	Event   string                   `json:"event"`
-	Objects []map[string]interface{} `json:"objects,omitempty"`
+// Response answers a request: for an upload or download, every object of
+// the batch with its actions or its error. With --proxy, the message of the
+// real agent is its only object.
+type Response struct {
+	Event   string         `json:"event"`
+	Success bool           `json:"success"`
+	Error   string         `json:"error,omitempty"`
+	Objects []objectResult `json:"objects,omitempty"`
 }
 
-// Response represents a Git LFS transfer response
-type Response struct {
-	Event   string                   `json:"event"`
-	Success bool                     `json:"success"`
-	Error   string                   `json:"error,omitempty"`
-	Objects []map[string]interface{} `json:"objects,omitempty"`
+// objectResult is an object of a Response: the outcome of a simulated
+// transfer, or with --proxy the agent's complete event or answer to init
+type objectResult struct {
+	Event   string                     `json:"event,omitempty"`
+	OID     string                     `json:"oid,omitempty"`
+	Size    int64                      `json:"size,omitempty"`
+	Path    string                     `json:"path,omitempty"`
+	Actions map[string]transfer.Action `json:"actions,omitempty"`
+	Error   *transfer.Error            `json:"error,omitempty"`
 }
 
 func printHelp() {
@@ -30,23 +40,92 @@ func printHelp() {
 
 		USAGE:
 		  git lfs-trace [OPTIONS]
+		  git lfs-trace diff [OPTIONS] A.log B.log
 
 		OPTIONS:
-		  -h, --help       Show this help message
+		  --record FILE      Append requests and responses with timestamps to FILE
+		  --log-file FILE    Append the trace to FILE instead of writing it to stderr
+		  --color WHEN       Color the trace: auto, always or never (default: auto)
+		  --proxy CMD        Run CMD as the real transfer agent and relay every
+		                     message between it and Git LFS
+		  --no-summary       Do not print the session summary at the end
+		  --summary-csv FILE Append every transfer of the session to FILE as CSV
+		  --delay DURATION   Add latency before every response, e.g. 250ms or 2s
+		  --bandwidth SIZE   Simulate transferring each object at SIZE per second, e.g. 1M
+		  --fail-rate RATE   Fail this fraction of object transfers, from 0.0 to 1.0
+		  --seed N           Random seed for --fail-rate, for reproducible runs
+		  --fail-oid OID[,OID...]
+		                     Fail every transfer of these objects; an OID may be a prefix
+		  --fail-event EVENT Fail --fail-oid objects only on upload or download
+		                     (default: both)
+		  --fail-code CODE   Error code of --fail-oid failures (default: 500)
+		  --fail-message MSG Error message of --fail-oid failures
+		  -h, --help         Show this help message
+		  --version          Show the version, commit and build date
 
 		DESCRIPTION:
 		  This command acts as a Git LFS custom transfer adapter that logs all
 		  requests and responses to stderr for debugging purposes. It reads JSON
 		  requests from stdin and writes JSON responses to stdout.
 
+		  Every message is numbered and tagged with its direction, client→agent
+		  for requests and agent→client for responses, followed by the time since
+		  the adapter started and since the previous message; for a response the
+		  latter is how long the agent took to answer. Requests are cyan,
+		  successful responses green and failed ones red. Use --log-file to keep
+		  the trace apart from git's own progress output, e.g. in another
+		  terminal with 'tail -f'.
+
+		  Upload and download requests may carry a batch of objects, or a single
+		  object as Git LFS sends it (oid, size and path). The objects are
+		  transferred at the same time, up to concurrenttransfers of them when the
+		  init event sets concurrent, and otherwise one by one. While an object
+		  is transferred the adapter sends progress events (oid, bytesSoFar,
+		  bytesSinceLast), which appear in blue in the trace. The response lists
+		  every object, with its actions or its error, and fails when any object
+		  failed.
+
+		  With --proxy, the adapter runs CMD with sh, e.g. lfs-folderstore or
+		  any other custom transfer agent with its arguments, and forwards every
+		  message both ways unchanged, logging and recording it in between.
+		  Objects are really transferred, so the trace shows the production
+		  protocol: the agent's progress and complete events, its errors and
+		  how long it took. The Authorization header of request actions is
+		  redacted in the trace. The agent's stderr passes through, and its
+		  exit status becomes the adapter's. The simulation options cannot be
+		  combined with --proxy.
+
+		  --fail-rate fails objects at random, while --fail-oid fails the named
+		  objects on every attempt, so retries of them fail too and the other
+		  objects of the batch succeed. The failed objects carry --fail-code and
+		  --fail-message as their error; --fail-rate failures have code 500.
+
+		  When the session ends, after the terminate event, a summary is printed
+		  to stderr, and also to the --log-file: the uploads and downloads with
+		  the total size of their objects, how many failed or were never
+		  answered, the distinct objects, errors, the duration and the slowest
+		  transfers. Retries of an object count as transfers of their own, so
+		  more transfers than distinct objects means Git LFS retried. With
+		  --summary-csv, every transfer is also appended to FILE as a row of
+		  pid, event, oid, size, path, status (ok, failed or unanswered), error,
+		  start_ms (since the session started) and duration_ms, for a big push
+		  whose raw trace is too long to read. Git LFS may run several adapter
+		  processes at once; each prints its own summary, and their rows are
+		  told apart by pid.
+
 		  This is useful for understanding how Git LFS communicates with transfer
 		  adapters and for debugging custom transfer adapter implementations.
 
+		SUBCOMMANDS:
+		  diff             Compare two sessions recorded with --record
+		                   (see 'git lfs-trace diff -h')
+
 		SUPPORTED EVENTS:
-		  - init:       Initialize the transfer adapter
+		  - init:       Initialize the transfer adapter and its concurrency
 		  - terminate:  Terminate the transfer adapter
 		  - upload:     Handle file upload requests
 		  - download:   Handle file download requests
+		  - progress:   Sent by the adapter while an object is transferred
 
 		EXAMPLES:
 		  # Configure Git LFS to use this trace adapter
@@ -60,14 +139,57 @@ func printHelp() {
 		  git config --unset lfs.customtransfer.trace.path
 		  git config --unset lfs.standalonetransferagent
 
+		  # Follow the trace in another terminal, in color
+		  git config lfs.customtransfer.trace.args "--log-file /tmp/lfs-trace.log --color always"
+		  tail -f /tmp/lfs-trace.log
+
+		  # Simulate a slow, flaky server: 300ms latency, 2 MB/s, 10% failures
+		  git config lfs.customtransfer.trace.args "--delay 300ms --bandwidth 2M --fail-rate 0.1"
+
+		  # Keep every transfer of a big push for a spreadsheet
+		  git config lfs.customtransfer.trace.args "--no-summary --summary-csv /tmp/lfs-push.csv"
+
+		  # Trace a real agent, here lfs-folderstore, in production
+		  git config lfs.customtransfer.trace.args "--log-file /tmp/lfs-trace.log --proxy 'lfs-folderstore /mnt/lfs-store'"
+
+		  # Test retries and partial failure: two objects always fail to download
+		  git config lfs.customtransfer.trace.args "--fail-oid 4d7a2146,9f86d081 --fail-event download --fail-code 404 --fail-message 'Object does not exist'"
+
 		NOTE:
-		  This adapter logs all protocol messages but does not actually
-		  transfer files. It's intended for educational and debugging purposes.
+		  Without --proxy, this adapter logs all protocol messages but does not
+		  actually transfer files. It's intended for educational and debugging purposes.
+		  The simulation options only affect the timing and outcome of the
+		  adapter's responses.
 	`))
 }
 
 func main() {
+	// Subcommands parse their own options
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		}
+	}
+
 	showHelp := flag.BoolP("help", "h", false, "Show help message")
+	delay := flag.Duration("delay", 0, "Latency added before every response")
+	bandwidth := flag.String("bandwidth", "0", "Simulated transfer rate per second of each object")
+	failRate := flag.Float64("fail-rate", 0, "Fraction of object transfers that fail (0.0-1.0)")
+	seed := flag.Int64("seed", 0, "Random seed for --fail-rate")
+	failOIDs := flag.StringSlice("fail-oid", nil, "Fail every transfer of these objects (full oids or prefixes)")
+	failEvent := flag.String("fail-event", "", "Fail --fail-oid objects only on upload or download (default: both)")
+	failCode := flag.Int("fail-code", 500, "Error code of --fail-oid failures")
+	failMessage := flag.String("fail-message", "Injected failure (--fail-oid)", "Error message of --fail-oid failures")
+	recordPath := flag.String("record", "", "Append requests and responses with timestamps to this file")
+	logPath := flag.String("log-file", "", "Append the trace to this file instead of stderr")
+	colorMode := flag.String("color", "auto", "Color the trace: auto, always or never")
+	proxyCommand := flag.String("proxy", "", "Relay every message to and from this transfer agent command")
+	noSummary := flag.Bool("no-summary", false, "Do not print the session summary to stderr at the end")
+	summaryCSV := flag.String("summary-csv", "", "Append every transfer of the session to this CSV file at the end")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-trace")
+	completion.Handle(completion.Command{Name: "git-lfs-trace", Flags: flag.CommandLine, Args: completion.ArgNone, Subcommands: []string{"diff"}})
 	flag.Parse()
 
 	if *showHelp {
@@ -75,121 +197,90 @@ func main() {
 		os.Exit(0)
 	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		var request Request
-		if err := json.Unmarshal([]byte(line), &request); err != nil {
-			continue // Skip invalid JSON
+	bytesPerSecond, err := common.ParseSize(*bandwidth)
+	if err != nil {
+		common.PrintError("--bandwidth: %v", err)
+	}
+	if *failRate < 0 || *failRate > 1 {
+		common.PrintError("--fail-rate must be between 0.0 and 1.0")
+	}
+	if *failEvent != "" && *failEvent != "upload" && *failEvent != "download" {
+		common.PrintError("--fail-event must be upload or download, not '%s'", *failEvent)
+	}
+	if *failCode < 100 || *failCode > 599 {
+		common.PrintError("--fail-code must be an HTTP status code from 100 to 599")
+	}
+	if len(*failOIDs) == 0 && (flag.CommandLine.Changed("fail-event") || flag.CommandLine.Changed("fail-code") || flag.CommandLine.Changed("fail-message")) {
+		common.PrintError("--fail-event, --fail-code and --fail-message require --fail-oid")
+	}
+	if *proxyCommand != "" {
+		for _, name := range []string{"delay", "bandwidth", "fail-rate", "seed", "fail-oid", "fail-event", "fail-code", "fail-message"} {
+			if flag.CommandLine.Changed(name) {
+				common.PrintError("--%s simulates an agent and cannot be combined with --proxy", name)
+			}
 		}
-
-		logRequest(request)
-
-		response := handleRequest(request)
-		logResponse(response)
-
-		// Write response to stdout
-		responseJSON, _ := json.Marshal(response)
-		fmt.Println(string(responseJSON))
 	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+	tlog, err := newTraceLog(*logPath, *colorMode)
+	if err != nil {
+		common.PrintError("%v", err)
 	}
-}
+	defer tlog.close()
+	sim := newSimulation(*delay, bytesPerSecond, *failRate, *seed, tlog)
+	sim.inject = injection{oids: *failOIDs, event: *failEvent, code: *failCode, message: *failMessage}
 
-func logRequest(request Request) {
-	fmt.Fprintln(os.Stderr, "\n== Request ==")
-	requestJSON, _ := json.MarshalIndent(request, "", "  ")
-	fmt.Fprintln(os.Stderr, string(requestJSON))
-	fmt.Fprintln(os.Stderr, "================")
-}
-
-func logResponse(response Response) {
-	fmt.Fprintln(os.Stderr, "\n== Response ==")
-	responseJSON, _ := json.MarshalIndent(response, "", "  ")
-	fmt.Fprintln(os.Stderr, string(responseJSON))
-	fmt.Fprintln(os.Stderr, "================")
-}
-
-func handleRequest(request Request) Response {
-	switch request.Event {
-	case "init":
-		return Response{Event: "init", Success: true}
-	case "terminate":
-		return Response{Event: "terminate", Success: true}
-	case "upload":
-		return handleUpload(request)
-	case "download":
-		return handleDownload(request)
-	default:
-		return Response{
-			Event:   request.Event,
-			Success: false,
-			Error:   "Unsupported event",
-		}
+	rec, err := newRecorder(*recordPath)
+	if err != nil {
+		common.PrintError("Failed to open --record file: %v", err)
 	}
-}
+	defer rec.close()
 
-func handleUpload(request Request) Response {
-	if len(request.Objects) == 0 {
-		return Response{
-			Event:   "upload",
-			Success: false,
-			Error:   "No object specified",
+	var stats *summary
+	if !*noSummary || *summaryCSV != "" {
+		stats = newSummary()
+	}
+	report := func() {
+		if !*noSummary {
+			stats.write(os.Stderr)
+			if tlog.out != os.Stderr {
+				stats.write(tlog.out)
+			}
+		}
+		if err := stats.writeCSV(*summaryCSV); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write --summary-csv file: %v\n", err)
 		}
 	}
 
-	object := request.Objects[0]
-	oid, _ := object["oid"].(string)
-	size, _ := object["size"].(float64)
-
-	return Response{
-		Event:   "upload",
-		Success: true,
-		Objects: []map[string]interface{}{
-			{
-				"oid":  oid,
-				"size": size,
-				"actions": map[string]interface{}{
-					"upload": map[string]interface{}{
-						"href": fmt.Sprintf("https://example.com/upload/%s", oid),
-					},
-				},
-			},
-		},
+	if *proxyCommand != "" {
+		status := runProxy(*proxyCommand, tlog, rec, stats)
+		report()
+		rec.close()
+		tlog.close()
+		os.Exit(status)
 	}
-}
 
-func handleDownload(request Request) Response {
-	if len(request.Objects) == 0 {
-		return Response{
-			Event:   "download",
-			Success: false,
-			Error:   "No object specified",
+	a := newAdapter(sim, tlog, rec, stats, os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var request transfer.Request
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			continue // Skip invalid JSON
 		}
+		request = request.Redacted()
+
+		tlog.request(request)
+		rec.request(request)
+		stats.request(request)
+		a.respond(a.handle(request))
 	}
+	report()
 
-	object := request.Objects[0]
-	oid, _ := object["oid"].(string)
-	size, _ := object["size"].(float64)
-
-	return Response{
-		Event:   "download",
-		Success: true,
-		Objects: []map[string]interface{}{
-			{
-				"oid":  oid,
-				"size": size,
-				"actions": map[string]interface{}{
-					"download": map[string]interface{}{
-						"href": fmt.Sprintf("https://example.com/download/%s", oid),
-					},
-				},
-			},
-		},
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		rec.close()
+		tlog.close()
+		os.Exit(1)
 	}
 }
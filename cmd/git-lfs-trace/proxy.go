@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+// proxy sits between Git LFS and a real transfer agent, forwarding every
+// message unchanged while logging and recording it
+type proxy struct {
+	log   *traceLog
+	rec   *recorder
+	stats *summary
+}
+
+// runProxy runs command with sh as the transfer agent and relays messages
+// until the agent exits. It returns the agent's exit status.
+func runProxy(command string, log *traceLog, rec *recorder, stats *summary) int {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	toAgent, err := cmd.StdinPipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fromAgent, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to start the --proxy agent: %v\n", err)
+		return 1
+	}
+	log.note("Proxying to %s (pid %d)", command, cmd.Process.Pid)
+
+	p := &proxy{log: log, rec: rec, stats: stats}
+	go func() {
+		defer toAgent.Close()
+		p.relay(os.Stdin, toAgent, p.request)
+	}()
+	p.relay(fromAgent, os.Stdout, p.response)
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		log.note("Agent exited with status %d", exitErr.ExitCode())
+		return exitErr.ExitCode()
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	log.note("Agent exited")
+	return 0
+}
+
+// relay copies lines from r to w, passing each to observe first
+func (p *proxy) relay(r io.Reader, w io.Writer, observe func([]byte)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		observe(line)
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+// request logs and records a message from Git LFS, with the Authorization
+// header of its action redacted
+func (p *proxy) request(line []byte) {
+	var request transfer.Request
+	if json.Unmarshal(line, &request) != nil {
+		p.log.note("Invalid JSON from Git LFS: %s", line)
+		return
+	}
+	if err := request.Validate(); err != nil {
+		p.log.note("Invalid request from Git LFS: %v", err)
+	}
+	request = request.Redacted()
+	p.log.request(request)
+	p.rec.request(request)
+	p.stats.request(request)
+}
+
+// response logs and records a message from the agent: a progress event, or
+// a response such as init's or the complete event ending a transfer. Each
+// response is recorded with the agent's message as its only object, so
+// 'git lfs-trace diff' compares what the agent answered.
+func (p *proxy) response(line []byte) {
+	message, err := transfer.ParseAgentMessage(line)
+	if message == nil {
+		p.log.note("Invalid message from the agent: %v: %s", err, line)
+		return
+	}
+	if err != nil {
+		p.log.note("Invalid message from the agent: %v", err)
+	}
+
+	var event string
+	var result objectResult
+	switch m := message.(type) {
+	case transfer.Progress:
+		p.log.progress(m)
+		p.rec.progress(m)
+		return
+	case transfer.Complete:
+		event = m.Event
+		result = objectResult{Event: m.Event, OID: m.OID, Path: m.Path, Error: m.Error}
+	case transfer.InitResponse:
+		event = transfer.EventInit // The only response naming no event
+		result = objectResult{Error: m.Error}
+	}
+	response := Response{Event: event, Success: result.Error == nil, Objects: []objectResult{result}}
+	if result.Error != nil {
+		response.Error = result.Error.Message
+	}
+	p.log.agent(event, response.Success, message)
+	p.rec.response(response)
+	p.stats.response(response)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+// sessionEntry is one line of a recorded session (--record)
+type sessionEntry struct {
+	Time     time.Time          `json:"time"`
+	PID      int                `json:"pid"` // Git LFS may run several adapter processes at once
+	Request  *transfer.Request  `json:"request,omitempty"`
+	Response *Response          `json:"response,omitempty"`
+	Progress *transfer.Progress `json:"progress,omitempty"`
+}
+
+// recorder appends requests and responses to a session file as JSON lines;
+// a nil recorder records nothing
+type recorder struct {
+	file *os.File
+	pid  int
+}
+
+func newRecorder(path string) (*recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	// O_APPEND keeps lines from concurrent adapter processes intact; only
+	// the user may read the file, which holds object paths and URLs
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{file: file, pid: os.Getpid()}, nil
+}
+
+func (r *recorder) request(request transfer.Request) {
+	r.write(sessionEntry{Request: &request})
+}
+
+func (r *recorder) response(response Response) {
+	r.write(sessionEntry{Response: &response})
+}
+
+func (r *recorder) progress(progress transfer.Progress) {
+	r.write(sessionEntry{Progress: &progress})
+}
+
+func (r *recorder) write(entry sessionEntry) {
+	if r == nil {
+		return
+	}
+	entry.Time = time.Now()
+	entry.PID = r.pid
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// A single write per line
+	if _, err := r.file.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record session: %v\n", err)
+	}
+}
+
+func (r *recorder) close() {
+	if r != nil {
+		r.file.Close()
+	}
+}
+
+// readSession reads a session file written with --record
+func readSession(path string) ([]sessionEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []sessionEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry sessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressSteps is how many progress events a transfer at a simulated
+// bandwidth reports; unthrottled transfers report once
+const progressSteps = 4
+
+// simulation degrades responses to imitate a slow or flaky LFS server
+type simulation struct {
+	delay     time.Duration // Added before every response
+	bandwidth int64         // Bytes per second for each object transfer; 0 means unlimited
+	failRate  float64       // Probability that an object transfer fails
+	inject    injection
+	rng       *rand.Rand
+	rngMu     sync.Mutex // Objects are transferred concurrently
+	log       *traceLog
+}
+
+// injection fails the transfers of chosen objects every time, unlike
+// failRate, so that retries of the same object fail too
+type injection struct {
+	oids    []string // Full oids or prefixes of them
+	event   string   // upload or download; empty for both
+	code    int
+	message string
+}
+
+// matches reports whether the transfer of oid for event is to fail
+func (i injection) matches(event, oid string) bool {
+	if i.event != "" && i.event != event {
+		return false
+	}
+	for _, prefix := range i.oids {
+		if strings.HasPrefix(oid, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferError is a failed transfer with the code reported for the object
+type transferError struct {
+	code    int
+	message string
+}
+
+func (e *transferError) Error() string { return e.message }
+
+func newSimulation(delay time.Duration, bandwidth int64, failRate float64, seed int64, log *traceLog) *simulation {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &simulation{
+		delay:     delay,
+		bandwidth: bandwidth,
+		failRate:  failRate,
+		rng:       rand.New(rand.NewSource(seed)),
+		log:       log,
+	}
+}
+
+// latency waits for the simulated latency before a response
+func (s *simulation) latency(event string) {
+	if s.delay > 0 {
+		s.log.note("Simulation: delaying %s response by %s", event, s.delay.Round(time.Millisecond))
+		time.Sleep(s.delay)
+	}
+}
+
+// transfer simulates moving one object, calling progress with the bytes
+// transferred so far and since the previous call. It fails the objects
+// chosen by inject, and others with probability failRate.
+func (s *simulation) transfer(event, oid string, size int64, progress func(soFar, sinceLast int64)) error {
+	if s.inject.matches(event, oid) {
+		s.log.note("Simulation: failing %s of %s with code %d", event, shortOID(oid), s.inject.code)
+		return &transferError{code: s.inject.code, message: s.inject.message}
+	}
+	if s.failRate > 0 {
+		s.rngMu.Lock()
+		fail := s.rng.Float64() < s.failRate
+		s.rngMu.Unlock()
+		if fail {
+			s.log.note("Simulation: failing %s of %s", event, shortOID(oid))
+			return errors.New("Simulated failure (--fail-rate)")
+		}
+	}
+
+	steps := int64(1)
+	if s.bandwidth > 0 && size > 0 {
+		steps = min(progressSteps, size)
+	}
+	var soFar int64
+	for step := int64(1); step <= steps; step++ {
+		chunk := size*step/steps - soFar
+		if s.bandwidth > 0 {
+			time.Sleep(time.Duration(float64(chunk) / float64(s.bandwidth) * float64(time.Second)))
+		}
+		soFar += chunk
+		progress(soFar, chunk)
+	}
+	return nil
+}
+
+// shortOID abbreviates an oid for notes
+func shortOID(oid string) string {
+	if len(oid) > 12 {
+		return oid[:12]
+	}
+	return oid
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+// transferStat is one attempt to transfer an object, from its request to
+// the response or complete event naming its oid
+type transferStat struct {
+	event string // upload or download
+	oid   string
+	size  int64
+	path  string
+	start time.Time
+	end   time.Time // Zero while unanswered
+	err   string
+}
+
+// summary collects the transfers of a session, to report them when it
+// ends, unless --no-summary, and for --summary-csv; a nil summary collects
+// nothing
+type summary struct {
+	start     time.Time
+	transfers []*transferStat
+	pending   map[string]*transferStat // Unanswered transfers by oid
+	errors    int                      // Failed responses naming no object
+	mu        sync.Mutex               // Objects are transferred concurrently
+}
+
+func newSummary() *summary {
+	return &summary{start: time.Now(), pending: make(map[string]*transferStat)}
+}
+
+// request starts the transfers of an upload or download request
+func (s *summary) request(request transfer.Request) {
+	if s == nil || (request.Event != transfer.EventUpload && request.Event != transfer.EventDownload) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, object := range request.Batch() {
+		t := &transferStat{event: request.Event, oid: object.OID, size: object.Size, path: object.Path, start: now}
+		s.transfers = append(s.transfers, t)
+		s.pending[object.OID] = t
+	}
+}
+
+// response ends the transfers of the objects a response names, which is
+// every object of a batch, or the one of a complete event with --proxy
+func (s *summary) response(response Response) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	answered := false
+	for _, object := range response.Objects {
+		t, found := s.pending[object.OID]
+		if !found {
+			continue
+		}
+		delete(s.pending, object.OID)
+		answered = true
+		t.end = now
+		if object.Error != nil {
+			t.err = object.Error.Message
+		}
+	}
+	if !response.Success && !answered {
+		s.errors++
+	}
+}
+
+// eventTotals are the transfers of one event
+type eventTotals struct {
+	objects, failed, unanswered int
+	bytes                       int64
+}
+
+// write prints the totals of the session: transfers and bytes per event,
+// distinct objects, errors and how long the session took
+func (s *summary) write(w io.Writer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := map[string]*eventTotals{"upload": {}, "download": {}}
+	oids := make(map[string]bool)
+	failed := 0
+	for _, t := range s.transfers {
+		total := totals[t.event]
+		total.objects++
+		total.bytes += t.size
+		oids[t.oid] = true
+		switch {
+		case t.end.IsZero():
+			total.unanswered++
+		case t.err != "":
+			total.failed++
+			failed++
+		}
+	}
+
+	fmt.Fprintf(w, "\n== Session summary (pid %d) ==\n", os.Getpid())
+	fmt.Fprintf(w, "  Duration:          %s\n", formatElapsed(time.Since(s.start)))
+	for _, event := range []string{"upload", "download"} {
+		total := totals[event]
+		label := strings.ToUpper(event[:1]) + event[1:] + "s:"
+		line := fmt.Sprintf("  %-18s %d (%s)", label, total.objects, common.FormatSize(total.bytes))
+		if total.failed > 0 {
+			line += fmt.Sprintf(", %d failed", total.failed)
+		}
+		if total.unanswered > 0 {
+			line += fmt.Sprintf(", %d unanswered", total.unanswered)
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "  Distinct objects:  %d\n", len(oids))
+	fmt.Fprintf(w, "  Errors:            %d\n", failed+s.errors)
+	if slowest := s.slowest(3); len(slowest) > 0 {
+		fmt.Fprintln(w, "  Slowest:")
+		for _, t := range slowest {
+			line := fmt.Sprintf("    %8s  %-8s %s  %s", formatElapsed(t.end.Sub(t.start)), t.event, t.oid, t.path)
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+	}
+}
+
+// slowest returns up to n answered transfers that took longest
+func (s *summary) slowest(n int) []*transferStat {
+	var answered []*transferStat
+	for _, t := range s.transfers {
+		if !t.end.IsZero() {
+			answered = append(answered, t)
+		}
+	}
+	sort.SliceStable(answered, func(i, j int) bool {
+		return answered[i].end.Sub(answered[i].start) > answered[j].end.Sub(answered[j].start)
+	})
+	return answered[:min(n, len(answered))]
+}
+
+// writeCSV appends one row per transfer to path, for analysis in a
+// spreadsheet. The header is written when the file is new, and the rows
+// in a single write, so that concurrent adapter processes can share it.
+func (s *summary) writeCSV(path string) error {
+	if s == nil || path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if info.Size() == 0 {
+		w.Write([]string{"pid", "event", "oid", "size", "path", "status", "error", "start_ms", "duration_ms"})
+	}
+	pid := strconv.Itoa(os.Getpid())
+	for _, t := range s.transfers {
+		status, duration := "ok", ""
+		switch {
+		case t.end.IsZero():
+			status = "unanswered"
+		case t.err != "":
+			status = "failed"
+		}
+		if !t.end.IsZero() {
+			duration = strconv.FormatInt(t.end.Sub(t.start).Milliseconds(), 10)
+		}
+		w.Write([]string{pid, t.event, t.oid, strconv.FormatInt(t.size, 10), t.path, status, t.err,
+			strconv.FormatInt(t.start.Sub(s.start).Milliseconds(), 10), duration})
+	}
+	w.Flush()
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
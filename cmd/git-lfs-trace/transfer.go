@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mslinn/git_lfs_scripts/internal/transfer"
+)
+
+// adapter answers transfer requests. The objects of a batch are processed
+// by as many workers as the init event allowed, and every message is
+// written, logged and recorded under one lock, so progress events of
+// concurrent objects interleave but never mix.
+type adapter struct {
+	workers int // Objects transferred at the same time
+	sim     *simulation
+	log     *traceLog
+	rec     *recorder
+	stats   *summary
+	out     io.Writer
+	mu      sync.Mutex
+}
+
+func newAdapter(sim *simulation, log *traceLog, rec *recorder, stats *summary, out io.Writer) *adapter {
+	return &adapter{workers: 1, sim: sim, log: log, rec: rec, stats: stats, out: out}
+}
+
+// handle returns the response to a request, sending progress events for
+// transfers while it runs
+func (a *adapter) handle(request transfer.Request) Response {
+	var response Response
+	switch err := request.Validate(); {
+	case err != nil:
+		response = Response{Event: request.Event, Success: false, Error: err.Error()}
+	case request.Event == transfer.EventInit:
+		a.init(request)
+		response = Response{Event: request.Event, Success: true}
+	case request.Event == transfer.EventTerminate:
+		response = Response{Event: request.Event, Success: true}
+	default:
+		response = a.transfer(request)
+	}
+	a.sim.latency(request.Event)
+	return response
+}
+
+// init takes the concurrency Git LFS announced: with concurrent set, up to
+// concurrenttransfers objects are transferred at once
+func (a *adapter) init(request transfer.Request) {
+	a.workers = 1
+	if request.Concurrent && request.ConcurrentTransfers > 1 {
+		a.workers = request.ConcurrentTransfers
+	}
+	a.log.note("Transferring up to %d objects at a time", a.workers)
+}
+
+// transfer moves every object of the request and answers with the actions
+// of the objects that succeeded and the errors of those that failed
+func (a *adapter) transfer(request transfer.Request) Response {
+	objects := request.Batch()
+	results := make([]objectResult, len(objects))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(a.workers, len(objects)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = a.transferObject(request.Event, objects[i])
+			}
+		}()
+	}
+	for i := range objects {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	response := Response{Event: request.Event, Success: true, Objects: results}
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		response.Success = false
+		response.Error = fmt.Sprintf("%d of %d objects failed", failed, len(objects))
+	}
+	return response
+}
+
+// transferObject simulates the transfer of one object, reporting its
+// progress, and returns the object's entry in the response
+func (a *adapter) transferObject(event string, object transfer.Object) objectResult {
+	oid := object.OID
+	result := objectResult{OID: oid, Size: object.Size}
+
+	err := a.sim.transfer(event, oid, object.Size, func(soFar, sinceLast int64) {
+		a.send(transfer.Progress{Event: transfer.EventProgress, OID: oid, BytesSoFar: soFar, BytesSinceLast: sinceLast})
+	})
+	if err != nil {
+		code := 500
+		var injected *transferError
+		if errors.As(err, &injected) {
+			code = injected.code
+		}
+		result.Error = &transfer.Error{Code: code, Message: err.Error()}
+		return result
+	}
+	result.Actions = map[string]transfer.Action{
+		event: {Href: fmt.Sprintf("https://example.com/%s/%s", event, oid)},
+	}
+	return result
+}
+
+// send logs, records and writes a progress event
+func (a *adapter) send(progress transfer.Progress) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.log.progress(progress)
+	a.rec.progress(progress)
+	transfer.Write(a.out, progress)
+}
+
+// respond logs, records and writes a response
+func (a *adapter) respond(response Response) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.log.response(response)
+	a.rec.response(response)
+	a.stats.response(response)
+	transfer.Write(a.out, response)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/inventory"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// discoverExtensions returns the mostly binary extensions of the non-LFS
+// files below the current directory that have a file of at least minSize
+func discoverExtensions(minSize int64) ([]*lfsfiles.ExtensionStats, error) {
+	files, _, err := inventory.Load(true)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := common.ExecGitCommand("rev-parse", "--show-prefix")
+	files = inventory.RelativeTo(files, strings.TrimSpace(prefix))
+
+	var nonLFS []string
+	for _, file := range files {
+		if !file.LFS {
+			nonLFS = append(nonLFS, file.Path)
+		}
+	}
+
+	stats, _ := lfsfiles.GroupByExtension(nonLFS)
+	var qualifying []*lfsfiles.ExtensionStats
+	for _, s := range stats {
+		if s.MostlyBinary() && s.Largest >= minSize {
+			qualifying = append(qualifying, s)
+		}
+	}
+	return qualifying, nil
+}
+
+// autoTrack shows the extensions it found with the patterns each expands
+// to, then tracks them all after confirmation. Extensions spelled in more
+// than one case are expanded as with -c even without it. It returns the
+// patterns tracked.
+func autoTrack(opts lfsfiles.Options, minSize int64, yes bool) ([]string, error) {
+	extensions, err := discoverExtensions(minSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(extensions) == 0 {
+		fmt.Printf("No binary extensions have a file of at least %s outside Git LFS.\n", common.FormatSize(minSize))
+		return nil, nil
+	}
+
+	fmt.Println("Extensions to track (non-LFS files grouped by extension):")
+	fmt.Println()
+	fmt.Printf("  %-10s %7s %12s %12s  %s\n", "EXTENSION", "FILES", "TOTAL", "LARGEST", "PATTERNS")
+	plans := make([]lfsfiles.Options, len(extensions))
+	var expanded []string
+	for i, s := range extensions {
+		plans[i] = opts
+		if s.MixedCases && !opts.AllCases {
+			plans[i].BothCases = true
+		}
+		patterns := lfsfiles.ExpandPattern(s.Ext, plans[i])
+		expanded = append(expanded, patterns...)
+		fmt.Printf("  %-10s %7d %12s %12s  %s\n", s.Ext, s.Files, common.FormatSize(s.TotalSize),
+			common.FormatSize(s.Largest), strings.Join(patterns, " "))
+	}
+	fmt.Println()
+
+	if !opts.DryRun && !yes && !confirm(fmt.Sprintf("Track these %d extensions?", len(extensions))) {
+		return nil, fmt.Errorf("nothing tracked")
+	}
+	// The run is undone as a whole, not one extension at a time
+	var snapshot *lfsfiles.AttributesSnapshot
+	if !opts.KeepPartial {
+		var err error
+		if snapshot, err = lfsfiles.SnapshotAttributes(); err != nil {
+			return nil, err
+		}
+	}
+	var applied []string
+	for i, s := range extensions {
+		plans[i].KeepPartial = true
+		if err := lfsfiles.Execute([]string{s.Ext}, plans[i]); err != nil {
+			return nil, snapshot.Rollback(err, applied)
+		}
+		applied = append(applied, lfsfiles.ExpandPattern(s.Ext, plans[i])...)
+	}
+	return expanded, nil
+}
+
+// confirm asks a yes/no question on the terminal; anything but y or yes,
+// including end of input, declines
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
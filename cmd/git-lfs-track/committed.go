@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// maxCommittedListed is how many already committed files the warning lists
+const maxCommittedListed = 20
+
+// Ways to convert files that were committed before their pattern was tracked
+const (
+	fixMigrate     = "migrate"     // git lfs migrate import --no-rewrite: a new commit
+	fixRenormalize = "renormalize" // git add --renormalize: staged for the user to commit
+)
+
+// warnCommitted warns about files matching the tracked patterns that HEAD
+// holds as regular Git blobs, which tracking leaves in Git, and converts
+// them as fix says. Without fix, the user is asked when stdin is a terminal.
+func warnCommitted(expanded []string, fix string, dryRun bool) error {
+	committed, err := lfsfiles.CommittedBlobs(expanded)
+	if err != nil || len(committed) == 0 {
+		return err
+	}
+
+	var total int64
+	paths := make([]string, len(committed))
+	for i, file := range committed {
+		total += file.Size
+		paths[i] = file.Path
+	}
+	rule := strings.Repeat("━", 72)
+	fmt.Println()
+	fmt.Println(rule)
+	fmt.Printf("⚠ %d %s matching the tracked patterns %s already committed as regular\n",
+		len(committed), common.Plural(len(committed), "file", "files"), common.Plural(len(committed), "is", "are"))
+	fmt.Printf("  Git blobs (%s). Tracking alone does not move them into Git LFS;\n", common.FormatSize(total))
+	fmt.Println("  they stay in Git until they are converted.")
+	fmt.Println(rule)
+	for i, file := range committed {
+		if i == maxCommittedListed {
+			fmt.Printf("  ... and %d more\n", len(committed)-maxCommittedListed)
+			break
+		}
+		fmt.Printf("  %10s  %s\n", common.FormatSize(file.Size), file.Path)
+	}
+	fmt.Println()
+	fmt.Println("Convert them without rewriting history with either:")
+	fmt.Println("  git lfs migrate import --no-rewrite PATH ...   # in a new commit")
+	fmt.Println("  git add --renormalize -- PATH ...              # staged, to commit yourself")
+	fmt.Println("or rewrite history so they never reach Git: git lfs migrate import --include=PATTERN")
+
+	if fix == "" && !dryRun && isTerminal(os.Stdin) {
+		fix = choose()
+	}
+	switch fix {
+	case fixMigrate:
+		args := append([]string{"lfs", "migrate", "import", "--no-rewrite",
+			"--message", "Move files committed before they were tracked into Git LFS"}, paths...)
+		if err := common.RunCommand("git", args...); err != nil {
+			return fmt.Errorf("git lfs migrate import failed: %v", err)
+		}
+	case fixRenormalize:
+		if err := common.RunCommand("git", append([]string{"add", "--renormalize", "--"}, paths...)...); err != nil {
+			return fmt.Errorf("git add --renormalize failed: %v", err)
+		}
+		if !dryRun {
+			fmt.Println("Staged; commit the files together with .gitattributes.")
+		}
+	}
+	return nil
+}
+
+// choose asks how to convert the committed files; anything unexpected,
+// including end of input, converts nothing
+func choose() string {
+	fmt.Print("\nConvert them now? [m]igrate in a new commit, [r]enormalize and stage, [N]o: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "m", "migrate":
+		return fixMigrate
+	case "r", "renormalize":
+		return fixRenormalize
+	}
+	return ""
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
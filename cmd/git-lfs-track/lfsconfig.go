@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// lfsConfigOptions are the team-wide settings --write-lfsconfig writes
+type lfsConfigOptions struct {
+	url                 string   // lfs.url; empty keeps the current one
+	concurrentTransfers int      // lfs.concurrenttransfers
+	fetchExclude        []string // lfs.fetchexclude; nil keeps the current one
+}
+
+// writeLFSConfig creates or updates the .lfsconfig at the top of the
+// working tree, which every clone reads. lfs.fetchinclude lists the
+// patterns tracked in every .gitattributes except the excluded ones. It
+// returns whether anything changed; with dryRun the changes are only printed.
+func writeLFSConfig(opts lfsConfigOptions, dryRun bool) (bool, error) {
+	top, err := common.ExecGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		return false, fmt.Errorf("not inside a Git working tree")
+	}
+	file := filepath.Join(strings.TrimSpace(top), lfsapi.LFSConfigFile)
+
+	exclude := opts.fetchExclude
+	if exclude == nil {
+		exclude = splitPatterns(lfsConfigValue(file, "lfs.fetchexclude"))
+	}
+	tracked, err := lfsfiles.TrackedFetchPatterns()
+	if err != nil {
+		return false, err
+	}
+	var include []string
+	for _, pattern := range tracked {
+		if !slices.Contains(exclude, pattern) {
+			include = append(include, pattern)
+		}
+	}
+
+	settings := [][2]string{
+		{"lfs.fetchinclude", strings.Join(include, ",")},
+		{"lfs.fetchexclude", strings.Join(exclude, ",")},
+		{"lfs.concurrenttransfers", strconv.Itoa(opts.concurrentTransfers)},
+	}
+	if opts.url != "" {
+		settings = append(settings, [2]string{"lfs.url", opts.url})
+	}
+
+	changed := false
+	for _, setting := range settings {
+		key, value := setting[0], setting[1]
+		if lfsConfigValue(file, key) == value {
+			continue
+		}
+		changed = true
+		args := []string{"config", "--file", lfsapi.LFSConfigFile, key, value}
+		if value == "" {
+			args = []string{"config", "--file", lfsapi.LFSConfigFile, "--unset-all", key}
+		}
+		if dryRun {
+			fmt.Printf("DRY RUN: git %s\n", strings.Join(args, " "))
+			continue
+		}
+		args[2] = file
+		if output, err := common.ExecGitCommand(args...); err != nil {
+			return changed, fmt.Errorf("failed to set %s in %s: %s", key, lfsapi.LFSConfigFile, strings.TrimSpace(output))
+		}
+		if value == "" {
+			fmt.Printf("Removed %s from %s\n", key, lfsapi.LFSConfigFile)
+		} else {
+			fmt.Printf("Set %s = %s in %s\n", key, value, lfsapi.LFSConfigFile)
+		}
+	}
+	return changed, nil
+}
+
+// lfsConfigValue returns the value of key in file, or an empty string
+func lfsConfigValue(file, key string) string {
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	value, _ := common.ExecGitCommand("config", "--file", file, "--get", key)
+	return strings.TrimSpace(value)
+}
+
+// splitPatterns splits a comma separated lfs.fetchexclude value
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
@@ -4,35 +4,141 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
 	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
 	"github.com/spf13/pflag"
 )
 
 func main() {
 	var opts lfsfiles.Options
-	var showHelp bool
+	var showHelp, auto, yes, normalize, writeConfig bool
+	var lfsConfig lfsConfigOptions
+	var minSize, fix string
 
 	pflag.BoolVarP(&opts.BothCases, "bothcases", "c", false, "Expand pattern to upper and lower case")
+	pflag.BoolVar(&opts.AllCases, "all-cases", false, "Expand pattern to match every case combination")
 	pflag.BoolVarP(&opts.DryRun, "dryrun", "d", false, "Dry run")
 	pflag.BoolVarP(&opts.Everywhere, "everywhere", "e", false, "Apply pattern everywhere")
+	pflag.StringSliceVar(&opts.Paths, "path", nil, "Anchor patterns to these directories instead of the current one")
+	pflag.BoolVar(&opts.Gitignore, "gitignore", false, "Add the patterns to the managed block of .gitignore too")
+	pflag.BoolVar(&opts.Negate, "negate", false, "With --gitignore, write negated .gitignore entries")
+	pflag.BoolVar(&opts.KeepPartial, "keep-partial", false, "Keep the patterns applied before one fails instead of restoring .gitattributes")
+	pflag.BoolVar(&auto, "auto", false, "Track every binary extension found in the working tree")
+	pflag.StringVar(&minSize, "min-size", "1M", "With --auto, only extensions having a file at least this large")
+	pflag.BoolVarP(&yes, "yes", "y", false, "With --auto, track without asking for confirmation")
+	pflag.StringVar(&fix, "fix-committed", "", "Convert files committed before tracking: migrate or renormalize")
+	pflag.BoolVar(&normalize, "normalize", false, "Sort, deduplicate and normalize the Git LFS lines of .gitattributes")
+	pflag.BoolVar(&writeConfig, "write-lfsconfig", false, "Create or update .lfsconfig with team-wide Git LFS settings")
+	pflag.StringVar(&lfsConfig.url, "lfs-url", "", "With --write-lfsconfig, also set lfs.url")
+	pflag.IntVar(&lfsConfig.concurrentTransfers, "concurrent-transfers", 8, "With --write-lfsconfig, the lfs.concurrenttransfers to set")
+	pflag.StringSliceVar(&lfsConfig.fetchExclude, "fetch-exclude", nil, "With --write-lfsconfig, tracked patterns that clones do not download")
 	pflag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddTraceFlag(pflag.CommandLine)
+	common.AddVersionFlag(pflag.CommandLine, "git-lfs-track")
+	completion.Handle(completion.Command{Name: "git-lfs-track", Flags: pflag.CommandLine, Args: completion.ArgExtension})
 	pflag.Parse()
+	common.SetDryRun(opts.DryRun)
+	opts.DryRun = common.DryRun
 
 	if showHelp {
 		lfsfiles.PrintHelp(lfsfiles.LfsTrack)
 		os.Exit(0)
 	}
 
-	patterns := pflag.Args()
-	if len(patterns) == 0 && !showHelp {
+	patterns, err := lfsfiles.ExpandPresets(pflag.Args())
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	if len(patterns) == 0 && !auto && !normalize && !writeConfig {
 		lfsfiles.PrintHelp(lfsfiles.LfsTrack)
 		os.Exit(1)
 	}
 
 	opts.Command = lfsfiles.GetCommandString(lfsfiles.LfsTrack)
+	for _, name := range []string{"lfs-url", "concurrent-transfers", "fetch-exclude"} {
+		if pflag.CommandLine.Changed(name) && !writeConfig {
+			common.PrintError("--%s requires --write-lfsconfig", name)
+		}
+	}
+	if lfsConfig.concurrentTransfers <= 0 {
+		common.PrintError("--concurrent-transfers must be positive")
+	}
+	if pflag.CommandLine.Changed("fetch-exclude") && lfsConfig.fetchExclude == nil {
+		lfsConfig.fetchExclude = []string{} // --fetch-exclude= removes lfs.fetchexclude
+	}
+	if fix != "" && fix != fixMigrate && fix != fixRenormalize {
+		common.PrintError("--fix-committed must be %s or %s", fixMigrate, fixRenormalize)
+	}
 
-	if err := lfsfiles.Execute(patterns, opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	audit := common.StartAudit("git-lfs-track", opts.DryRun)
+	var expanded []string // The patterns tracked
+	if auto {
+		if len(patterns) > 0 {
+			common.PrintError("--auto discovers the extensions itself; do not give patterns")
+		}
+		minBytes, err := common.ParseSize(minSize)
+		if err != nil {
+			common.PrintError("--min-size: %v", err)
+		}
+		if err := common.CheckGitRepo(); err != nil {
+			common.PrintError("%v", err)
+		}
+		if expanded, err = autoTrack(opts, minBytes, yes); err != nil {
+			common.PrintError("%v", err)
+		}
+	} else if len(patterns) > 0 {
+		if err := lfsfiles.Execute(patterns, opts); err != nil {
+			common.PrintError("%v", err)
+		}
+		for _, pattern := range patterns {
+			expanded = append(expanded, lfsfiles.ExpandPattern(pattern, opts)...)
+		}
+	}
+	if len(expanded) > 0 {
+		if err := warnCommitted(expanded, fix, opts.DryRun); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+	if !opts.DryRun && (auto || len(patterns) > 0) {
+		audit.Changed(".gitattributes")
+		if opts.Gitignore {
+			audit.Changed(".gitignore")
+		}
+	}
+
+	// Runs last, so that the lines git lfs track appended are sorted in
+	if normalize {
+		normalizations, err := lfsfiles.NormalizeAttributesFiles(opts.Everywhere, opts.DryRun)
+		if err != nil {
+			common.PrintError("Failed to normalize .gitattributes: %v", err)
+		}
+		if len(normalizations) == 0 && !opts.DryRun {
+			fmt.Println("The Git LFS lines of .gitattributes are already normalized")
+		}
+		for _, n := range normalizations {
+			if !opts.DryRun {
+				fmt.Printf("Normalized %s: %s\n", n.Path, n)
+				audit.Changed(n.Path)
+			}
+		}
+	}
+
+	// Runs after tracking, so that the new patterns are fetched too
+	if writeConfig {
+		changed, err := writeLFSConfig(lfsConfig, opts.DryRun)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		switch {
+		case changed && !opts.DryRun:
+			audit.Changed(lfsapi.LFSConfigFile)
+			fmt.Printf("\nCommit %s so new clones use these settings:\n", lfsapi.LFSConfigFile)
+			fmt.Printf("  git add %s && git commit -m \"Share Git LFS settings in %s\"\n", lfsapi.LFSConfigFile, lfsapi.LFSConfigFile)
+		case !changed:
+			fmt.Printf("%s is already up to date\n", lfsapi.LFSConfigFile)
+		}
 	}
+	audit.Finish(nil)
 }
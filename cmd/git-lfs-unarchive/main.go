@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsarchive"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	origin := flag.String("origin", "", "URL of the origin remote (default: that of the archived repository)")
+	noOrigin := flag.Bool("no-origin", false, "Leave the clone without an origin remote")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-unarchive")
+	completion.Handle(completion.Command{Name: "git-lfs-unarchive", Flags: flag.CommandLine, Args: completion.ArgFile})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 || flag.NArg() > 2 {
+		printHelp("Error: The archive and optionally a directory must be specified")
+		os.Exit(1)
+	}
+	if *noOrigin && *origin != "" {
+		common.PrintError("--origin and --no-origin cannot be combined")
+	}
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	defer file.Close()
+
+	dir := flag.Arg(1)
+	manifest, restored, err := lfsarchive.Restore(file, func(m lfsarchive.Manifest, bundle string) (string, error) {
+		if dir == "" {
+			dir = m.Name
+		}
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return "", fmt.Errorf("%s already exists and is not empty", dir)
+		}
+		fmt.Printf("Cloning %d refs of %s into %s...\n", len(m.Refs), m.Name, dir)
+		cmd := exec.Command("git", "clone", "--", bundle, dir)
+		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
+		if err := common.Run(cmd); err != nil {
+			return "", fmt.Errorf("git clone of the bundle failed: %v", err)
+		}
+		return lfspointer.LocalStorageIn(dir)
+	})
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	fmt.Printf("Restored %d LFS objects\n", restored)
+
+	remoteURL := manifest.Source
+	if *origin != "" {
+		remoteURL = *origin
+	}
+	if err := finish(dir, remoteURL, *noOrigin); err != nil {
+		common.PrintError("%v", err)
+	}
+	if len(manifest.Missing) > 0 {
+		fmt.Printf("⚠ %d LFS objects were missing when the archive was made; their files remain pointers\n", len(manifest.Missing))
+	}
+	fmt.Printf("✓ %s restored in %s\n", manifest.Name, dir)
+}
+
+// finish points origin at remoteURL, or removes it, since the bundle it was
+// cloned from is gone, then replaces the pointer files with their objects
+func finish(dir, remoteURL string, noOrigin bool) error {
+	origin := []string{"remote", "set-url", "origin", remoteURL}
+	if noOrigin || remoteURL == "" {
+		origin = []string{"remote", "remove", "origin"}
+	}
+	for _, args := range [][]string{origin, {"lfs", "install", "--local"}, {"lfs", "checkout"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if err := common.Run(cmd); err != nil {
+			return fmt.Errorf("git %s failed in %s: %v", args[0]+" "+args[1], dir, err)
+		}
+	}
+	return nil
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-unarchive - Restore a repository exported by git-lfs-archive
+
+		USAGE:
+		  git lfs-unarchive [OPTIONS] ARCHIVE [DIRECTORY]
+
+		OPTIONS:
+		  --origin URL         URL of the origin remote (default: that of the
+		                       archived repository)
+		  --no-origin          Leave the clone without an origin remote
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Clones the git bundle of ARCHIVE into DIRECTORY, by default the name
+		  of the archived repository, without the network: the LFS objects are
+		  copied into the clone's local LFS storage, each verified against its
+		  oid and size, and the pointer files are then checked out as the
+		  files they stand for. Compressed archives are recognized by content.
+
+		  origin is set to the URL the archived repository had, so the clone
+		  can push and fetch once a network is available; change it with
+		  --origin or drop it with --no-origin. Its remote-tracking branches
+		  are those of the bundle.
+
+		  Without git-lfs-unarchive, extract the archive and run its
+		  restore.sh, which does the same without verifying the objects.
+
+		EXAMPLES:
+		  git lfs-unarchive /media/usb/assets.tar.gz
+		  git lfs-unarchive --origin https://git.internal/team/assets.git assets.tar ~/work/assets
+	`))
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
 	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
 	"github.com/spf13/pflag"
 )
@@ -13,17 +14,29 @@ func main() {
 	var showHelp bool
 
 	pflag.BoolVarP(&opts.BothCases, "bothcases", "c", false, "Expand pattern to upper and lower case")
+	pflag.BoolVar(&opts.AllCases, "all-cases", false, "Expand pattern to match every case combination")
 	pflag.BoolVarP(&opts.DryRun, "dryrun", "d", false, "Dry run")
 	pflag.BoolVarP(&opts.Everywhere, "everywhere", "e", false, "Apply pattern everywhere")
+	pflag.StringSliceVar(&opts.Paths, "path", nil, "Anchor patterns to these directories instead of the current one")
+	pflag.BoolVar(&opts.Gitignore, "gitignore", false, "Remove the patterns from the managed block of .gitignore too")
+	pflag.BoolVar(&opts.KeepPartial, "keep-partial", false, "Keep the patterns applied before one fails instead of restoring .gitattributes")
 	pflag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddTraceFlag(pflag.CommandLine)
+	common.AddVersionFlag(pflag.CommandLine, "git-lfs-untrack")
+	completion.Handle(completion.Command{Name: "git-lfs-untrack", Flags: pflag.CommandLine, Args: completion.ArgExtension})
 	pflag.Parse()
+	common.SetDryRun(opts.DryRun)
+	opts.DryRun = common.DryRun
 
 	if showHelp {
 		lfsfiles.PrintHelp(lfsfiles.LfsUntrack)
 		os.Exit(0)
 	}
 
-	patterns := pflag.Args()
+	patterns, err := lfsfiles.ExpandPresets(pflag.Args())
+	if err != nil {
+		common.PrintError("%v", err)
+	}
 	if len(patterns) == 0 && !showHelp {
 		lfsfiles.PrintHelp(lfsfiles.LfsUntrack)
 		os.Exit(1)
@@ -31,8 +44,15 @@ func main() {
 
 	opts.Command = lfsfiles.GetCommandString(lfsfiles.LfsUntrack)
 
+	audit := common.StartAudit("git-lfs-untrack", opts.DryRun)
 	if err := lfsfiles.Execute(patterns, opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		common.PrintError("%v", err)
+	}
+	if !opts.DryRun {
+		audit.Changed(".gitattributes")
+		if opts.Gitignore {
+			audit.Changed(".gitignore")
+		}
 	}
+	audit.Finish(nil)
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsapi"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	flag "github.com/spf13/pflag"
+)
+
+// maxReferences is how many referencing commits are listed per missing object
+const maxReferences = 5
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	remote := flag.StringP("remote", "r", "origin", "Git remote whose LFS endpoint is checked")
+	endpoint := flag.StringP("endpoint", "e", "", "LFS endpoint to check instead of the remote's")
+	allRefs := flag.BoolP("all", "a", false, "Check every branch, tag and remote-tracking branch")
+	history := flag.Bool("history", false, "Also check objects referenced anywhere in the history of the refs")
+	batchSize := flag.Int("batch-size", 100, "Objects per Batch API request")
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-verify-remote")
+	completion.Handle(completion.Command{Name: "git-lfs-verify-remote", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp()
+		os.Exit(0)
+	}
+	if *batchSize <= 0 {
+		common.PrintError("--batch-size must be positive")
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	refs := flag.Args()
+	if *allRefs {
+		all, err := lfspointer.AllRefs()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		refs = append(refs, all...)
+	}
+	if len(refs) == 0 {
+		refs = []string{"HEAD"}
+	}
+
+	var client *lfsapi.Client
+	source := "--endpoint"
+	if *endpoint != "" {
+		client = lfsapi.NewClient(*endpoint, true)
+	} else {
+		var err error
+		if client, source, err = lfsapi.NewRemoteClient(*remote, "download"); err != nil {
+			common.PrintError("%v", err)
+		}
+	}
+	url := client.Endpoint
+	fmt.Printf("LFS endpoint: %s (%s)\n", url, source)
+
+	objects, err := referencedObjects(refs, *history)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	scope := "the trees of"
+	if *history {
+		scope = "the history of"
+	}
+	var total int64
+	for _, obj := range objects {
+		total += obj.Size
+	}
+	names := strings.Join(refs, ", ")
+	if *allRefs {
+		names = "every ref"
+	}
+	fmt.Printf("Objects referenced by %s %s: %d (%s)\n", scope, names, len(objects), common.FormatSize(total))
+	if len(objects) == 0 {
+		return
+	}
+
+	fmt.Println("Asking the server for every object via the Batch API...")
+	missing, err := client.Missing(objects, *batchSize)
+	if err != nil {
+		common.PrintError("Verification failed: %v", err)
+	}
+	if len(missing) == 0 {
+		fmt.Printf("✓ All %d objects exist on %s\n", len(objects), url)
+		return
+	}
+
+	oids := make(map[string]bool, len(missing))
+	for _, obj := range missing {
+		oids[obj.OID] = true
+	}
+	references, err := lfspointer.References(refs, oids)
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].OID < missing[j].OID })
+
+	fmt.Printf("\n✗ %d of %d objects are missing on %s:\n", len(missing), len(objects), url)
+	for _, obj := range missing {
+		fmt.Printf("\n  %s  %s\n", obj.OID, common.FormatSize(obj.Size))
+		refsOf := references[obj.OID]
+		for i, r := range refsOf {
+			if i == maxReferences {
+				fmt.Printf("    ... and %d more commits\n", len(refsOf)-maxReferences)
+				break
+			}
+			fmt.Printf("    %s  (%s)\n", r.Commit, r.Path)
+		}
+	}
+	fmt.Println("\nPush the missing objects from a clone that has them with 'git lfs push --all'")
+	fmt.Println("before deleting local caches or decommissioning other copies.")
+	os.Exit(2)
+}
+
+// referencedObjects returns the objects in the trees of refs, and with
+// history those added anywhere in their history too
+func referencedObjects(refs []string, history bool) ([]lfsapi.Object, error) {
+	pointers, err := lfspointer.ListRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	if history {
+		added, err := lfspointer.Added("", refs)
+		if err != nil {
+			return nil, err
+		}
+		pointers = append(pointers, added...)
+	}
+
+	seen := make(map[string]bool)
+	var objects []lfsapi.Object
+	for _, p := range pointers {
+		if !seen[p.OID] {
+			seen[p.OID] = true
+			objects = append(objects, lfsapi.Object{OID: p.OID, Size: p.Size})
+		}
+	}
+	return objects, nil
+}
+
+func printHelp() {
+	fmt.Print(dedent.Dedent(`
+		git-lfs-verify-remote - Check that every referenced LFS object exists on the server
+
+		USAGE:
+		  git lfs-verify-remote [OPTIONS] [REF ...]
+
+		OPTIONS:
+		  -r, --remote NAME    Git remote whose LFS endpoint is checked (default: origin)
+		  -e, --endpoint URL   LFS endpoint to check instead of the remote's
+		  -a, --all            Check every branch, tag and remote-tracking branch
+		  --history            Also check objects referenced anywhere in the history of the refs
+		  --batch-size N       Objects per Batch API request (default: 100)
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Collects the LFS objects referenced by the trees of the given refs
+		  (default: HEAD), and with --history by every commit reachable from
+		  them, then asks the server for each one with a Batch API download
+		  request. Nothing is transferred: the server only answers whether it
+		  has the object.
+
+		  Missing objects are listed with the commits whose pointer files add
+		  them and their paths, so you can find a clone that still has them.
+		  Run this before deleting local LFS caches or decommissioning a mirror.
+
+		  The endpoint is lfs.url, remote.NAME.lfsurl, lfs.url in .lfsconfig, or
+		  the remote's default, as Git LFS would use it. Credentials come from
+		  the Git credential helper.
+
+		  The exit status is 2 when objects are missing.
+
+		EXAMPLES:
+		  # Check the objects of the current commit
+		  git lfs-verify-remote
+
+		  # Check everything any ref ever referenced, before pruning local storage
+		  git lfs-verify-remote --all --history
+
+		  # Check a mirror before switching it off
+		  git lfs-verify-remote -e https://mirror.example.com/team/assets.git/info/lfs main release
+	`))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	showHelp := flag.BoolP("help", "h", false, "Show help")
+	minSize := flag.StringP("min-size", "s", "1M", "Warn about new files at least this large")
+	interval := flag.DurationP("interval", "i", 10*time.Second, "How often the working tree is polled without a notified change")
+	poll := flag.Bool("poll", false, "Poll every --interval instead of using file system notifications")
+	track := flag.Bool("track", false, "Run git lfs track for the extension of every file reported")
+	once := flag.Bool("once", false, "Check once and exit, with status 1 if a file was reported")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-lfs-watch")
+	completion.Handle(completion.Command{Name: "git-lfs-watch", Flags: flag.CommandLine, Args: completion.ArgNone})
+	flag.Parse()
+
+	if *showHelp {
+		printHelp("")
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		printHelp("Unexpected argument: " + flag.Arg(0))
+	}
+	threshold, err := common.ParseSize(*minSize)
+	if err != nil {
+		printHelp(fmt.Sprintf("--min-size: %v", err))
+	}
+	if *interval <= 0 {
+		printHelp("--interval must be positive")
+	}
+
+	if err := prereq.Verify(prereq.Git, prereq.GitLFS); err != nil {
+		common.PrintError("%v", err)
+	}
+	if err := common.CheckGitRepo(); err != nil {
+		common.PrintError("%v", err)
+	}
+	top, err := common.ExecGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		common.PrintError("%v", err)
+	}
+	w := newWatcher(strings.TrimSpace(top), threshold, *track)
+
+	if *once {
+		found, err := w.poll()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		untracked := 0
+		for _, f := range found {
+			if !w.report(f) {
+				untracked++
+			}
+		}
+		if untracked > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var n *notifier
+	if !*poll {
+		if n, err = newNotifier(w.top); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠ File system notifications are unavailable (%v); polling every %s\n", err, *interval)
+		}
+	}
+	fmt.Printf("Watching %s for new files of %s or more that Git LFS does not track; press Ctrl-C to stop\n",
+		w.top, common.FormatSize(threshold))
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		found, err := w.poll()
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		for _, f := range found {
+			w.report(f)
+		}
+		if n == nil {
+			<-ticker.C
+		} else if err := n.wait(*interval); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠ File system notifications failed (%v); polling every %s\n", err, *interval)
+			n.Close()
+			n = nil
+		}
+	}
+}
+
+func printHelp(msg string) {
+	if msg != "" {
+		fmt.Println(msg)
+		fmt.Println()
+	}
+
+	fmt.Print(dedent.Dedent(`
+		git-lfs-watch - Warn as soon as a large file appears that Git LFS does not track
+
+		USAGE:
+		  git lfs-watch [OPTIONS]
+
+		OPTIONS:
+		  -s, --min-size SIZE  Warn about new files at least this large, e.g. 500K
+		                       or 20M (default: 1M)
+		  -i, --interval DURATION
+		                       How often the working tree is polled when no
+		                       change is notified (default: 10s)
+		  --poll               Poll every --interval instead of using file
+		                       system notifications, e.g. on a network drive
+		  --track              Run git lfs track for the extension of every file
+		                       reported, and stage staged files again
+		  --once               Check once and exit, with status 1 if a file was
+		                       reported
+		  --trace              Print every external command before running it
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+
+		DESCRIPTION:
+		  Runs until interrupted, watching the working tree for new files:
+		  untracked files that are not ignored, and files added to the index
+		  since HEAD. A new file of at least --min-size that no filter=lfs
+		  attribute covers is reported as soon as it appears, with the time,
+		  its size and the git lfs track command for its extension, so a
+		  mistake is caught before it is committed rather than rewritten out
+		  of history later. Each file is reported once, and again only if it
+		  is deleted and comes back.
+
+		  File system notifications (inotify, FSEvents, kqueue or
+		  ReadDirectoryChangesW) report changes in every directory that Git
+		  does not ignore, and the working tree is polled half a second after
+		  a change. Without a notified change, it is polled every --interval
+		  anyway, which catches files that other machines add on a network
+		  drive, whose changes are not notified. When notifications are
+		  unavailable, e.g. because fs.inotify.max_user_watches is lower than
+		  the number of directories, a warning is printed and the working tree
+		  is polled every --interval alone, as with --poll.
+
+		  Each poll runs git status, which Git's untracked cache and
+		  core.fsmonitor keep fast in large working trees. Polls take no
+		  optional locks, so they do not get in the way of Git commands run
+		  meanwhile.
+
+		  With --track, git lfs track '*.EXT' is run for the extension of each
+		  file reported, or for the file itself when it has none; commit the
+		  changed .gitattributes. A file that was already staged is staged
+		  again with git add --renormalize, so that the index holds an LFS
+		  pointer instead of its content.
+
+		  With --once, the working tree is checked a single time, e.g. in a
+		  pre-commit hook or CI job.
+
+		EXAMPLES:
+		  # Watch the repository in a spare terminal while working
+		  git lfs-watch
+
+		  # Only care about files of 20 MB or more, and track them right away
+		  git lfs-watch --min-size 20M --track
+
+		  # Fail a pre-commit hook when a large file is about to slip in
+		  git lfs-watch --once --min-size 5M
+	`))
+	if msg != "" {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// settleTime is how long changes are collected before the working tree is
+// polled, so that a burst of writes, e.g. while a file is copied, runs git
+// status a few times rather than once per write
+const settleTime = 500 * time.Millisecond
+
+// notifier reports changes to the directories of the working tree that Git
+// does not ignore. fsnotify watches single directories, so directories
+// created later are added as they appear.
+type notifier struct {
+	top     string
+	watcher *fsnotify.Watcher
+}
+
+// newNotifier watches the working tree at top. It fails when the platform
+// has no file system notifications or runs out of watches, e.g. when
+// fs.inotify.max_user_watches is too low for the number of directories.
+func newNotifier(top string) (*notifier, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	n := &notifier{top: top, watcher: watcher}
+	ignored, err := ignoredDirs(top)
+	if err == nil {
+		err = n.addTree(top, ignored)
+	}
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// ignoredDirs returns the directories below top that Git ignores as a
+// whole, relative to top, which need no watching
+func ignoredDirs(top string) (map[string]bool, error) {
+	cmd := exec.Command("git", "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	cmd.Dir = top
+	output, err := common.Query(cmd)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for _, p := range strings.Split(string(output), "\x00") {
+		if dir, found := strings.CutSuffix(p, "/"); found {
+			dirs[dir] = true
+		}
+	}
+	return dirs, nil
+}
+
+// isIgnored reports whether Git ignores the directory at path
+func (n *notifier) isIgnored(path string) bool {
+	cmd := exec.Command("git", "check-ignore", "--quiet", "--", path)
+	cmd.Dir = n.top
+	_, err := common.Query(cmd)
+	return err == nil
+}
+
+// addTree watches dir and the directories below it, except .git
+// directories and those in ignored. Directories that vanish or cannot be
+// read meanwhile are skipped.
+func (n *notifier) addTree(dir string, ignored map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(n.top, path)
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" || ignored[filepath.ToSlash(rel)] {
+			return filepath.SkipDir
+		}
+		return n.watcher.Add(path)
+	})
+}
+
+// wait returns settleTime after the first change to the working tree, or
+// after timeout when nothing changes, e.g. because the change was made by
+// another machine on a network drive. It fails when notifications stop.
+func (n *notifier) wait(timeout time.Duration) error {
+	deadline := time.After(timeout)
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return errors.New("file system notifications stopped")
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() && !n.isIgnored(event.Name) {
+					if err := n.addTree(event.Name, nil); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+			}
+			if settled == nil {
+				settled = time.After(settleTime)
+			}
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return errors.New("file system notifications stopped")
+			}
+			// Lost events only mean that the next poll is due now
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				return nil
+			}
+			return err
+		case <-settled:
+			return nil
+		case <-deadline:
+			return nil
+		}
+	}
+}
+
+// Close stops watching
+func (n *notifier) Close() error {
+	return n.watcher.Close()
+}
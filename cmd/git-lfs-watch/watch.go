@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/inventory"
+)
+
+// finding is a new file at least minSize large that Git LFS does not track
+type finding struct {
+	path   string // Relative to the top of the working tree
+	size   int64
+	staged bool // Already added to the index, as a regular blob
+}
+
+// watcher reports every new large file once. A file that disappears is
+// forgotten, so it is reported again if it comes back.
+type watcher struct {
+	top     string
+	minSize int64
+	track   bool
+	warned  map[string]bool
+	tracked map[string]bool // Patterns tracked with --track
+}
+
+func newWatcher(top string, minSize int64, track bool) *watcher {
+	return &watcher{top: top, minSize: minSize, track: track, warned: make(map[string]bool), tracked: make(map[string]bool)}
+}
+
+// poll returns the new large files that Git LFS does not track and that
+// were not reported before. Sizes are checked first, so only large files
+// are classified.
+func (w *watcher) poll() ([]finding, error) {
+	staged, untracked, err := inventory.NewFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool, len(staged)+len(untracked))
+	var candidates []finding
+	for _, list := range []struct {
+		paths  []string
+		staged bool
+	}{{staged, true}, {untracked, false}} {
+		for _, p := range list.paths {
+			current[p] = true
+			if w.warned[p] {
+				continue
+			}
+			info, err := os.Lstat(filepath.Join(w.top, p))
+			if err != nil || !info.Mode().IsRegular() || info.Size() < w.minSize {
+				continue
+			}
+			candidates = append(candidates, finding{path: p, size: info.Size(), staged: list.staged})
+		}
+	}
+	for p := range w.warned {
+		if !current[p] {
+			delete(w.warned, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, len(candidates))
+	for i, c := range candidates {
+		paths[i] = c.path
+	}
+	files, err := inventory.Classify(paths)
+	if err != nil {
+		return nil, err
+	}
+	lfs := make(map[string]bool, len(files))
+	for _, f := range files {
+		lfs[f.Path] = f.LFS
+	}
+
+	var found []finding
+	for _, c := range candidates {
+		if !lfs[c.path] {
+			w.warned[c.path] = true
+			found = append(found, c)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].path < found[j].path })
+	return found, nil
+}
+
+// report warns about a finding, and with --track tracks it with Git LFS.
+// It returns false if the file remains untracked by Git LFS.
+func (w *watcher) report(f finding) bool {
+	state := "new"
+	if f.staged {
+		state = "staged"
+	}
+	pattern := trackPattern(f.path)
+	fmt.Printf("[%s] ⚠ %s (%s) is %s and not tracked by Git LFS\n",
+		time.Now().Format("15:04:05"), f.path, common.FormatSize(f.size), state)
+	if !w.track {
+		// Quoted even without spaces, so the shell does not expand it
+		fmt.Printf("    git lfs track '%s'\n", strings.ReplaceAll(pattern, "'", `'\''`))
+		if f.staged {
+			fmt.Printf("    git add %s\n", common.ShellQuote(f.path))
+		}
+		return false
+	}
+
+	if !w.tracked[pattern] {
+		if err := w.git("lfs", "track", pattern); err != nil {
+			fmt.Fprintf(os.Stderr, "    ✗ git lfs track %s failed: %v\n", pattern, err)
+			return false
+		}
+		w.tracked[pattern] = true
+		fmt.Printf("    ✓ Tracking %s with Git LFS; commit .gitattributes\n", pattern)
+	}
+	if f.staged {
+		// Staging it again stores a pointer instead of the content; the
+		// file is unchanged, so only --renormalize runs the LFS filter
+		if err := w.git("add", "--renormalize", "--", f.path); err != nil {
+			fmt.Fprintf(os.Stderr, "    ✗ git add --renormalize %s failed: %v\n", f.path, err)
+			return false
+		}
+		fmt.Printf("    ✓ Staged %s again as an LFS pointer\n", f.path)
+	}
+	return true
+}
+
+// git runs a git command at the top of the working tree, whose output is
+// of no interest
+func (w *watcher) git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = w.top
+	cmd.Stdout = io.Discard
+	return common.Run(cmd)
+}
+
+// trackPattern returns the pattern that tracks a file by its extension, or
+// the file alone when it has none
+func trackPattern(path string) string {
+	base := filepath.Base(path)
+	if ext := filepath.Ext(base); ext != "" && ext != base {
+		return "*" + ext
+	}
+	return path
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
 	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
 	"github.com/spf13/pflag"
 )
@@ -13,10 +15,18 @@ func main() {
 	var showHelp bool
 
 	pflag.BoolVarP(&opts.BothCases, "bothcases", "c", false, "Expand pattern to upper and lower case")
+	pflag.BoolVar(&opts.AllCases, "all-cases", false, "Expand pattern to match every case combination")
 	pflag.BoolVarP(&opts.DryRun, "dryrun", "d", false, "Dry run")
 	pflag.BoolVarP(&opts.Everywhere, "everywhere", "e", false, "Apply pattern everywhere")
+	pflag.StringSliceVar(&opts.Paths, "path", nil, "Anchor patterns to these directories instead of the current one")
+	pflag.BoolVarP(&opts.Null, "null", "z", false, "Terminate paths with NUL instead of newline")
 	pflag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddTraceFlag(pflag.CommandLine)
+	common.AddVersionFlag(pflag.CommandLine, "git-ls-files")
+	completion.Handle(completion.Command{Name: "git-ls-files", Flags: pflag.CommandLine, Args: completion.ArgExtension})
 	pflag.Parse()
+	common.SetDryRun(opts.DryRun)
+	opts.DryRun = common.DryRun
 
 	if showHelp {
 		lfsfiles.PrintHelp(lfsfiles.LsFiles)
@@ -24,7 +34,11 @@ func main() {
 	}
 
 	opts.Command = lfsfiles.GetCommandString(lfsfiles.LsFiles)
-	patterns := pflag.Args()
+	patterns, err := lfsfiles.ExpandPresets(pflag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// For ls-files, if no patterns provided, just run the command
 	// For track/untrack, patterns are required
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// limits are the size limits enforced by the pre-receive hook; 0 means unlimited
+type limits struct {
+	maxRepoSize   int64 // Bytes in the object database after a push
+	maxFileSize   int64 // Bytes of any blob a push adds
+	maxLFSStorage int64 // Bytes in the repository's lfs/objects directory
+}
+
+// Git config keys holding the limits, read by the hook on every push
+const (
+	maxRepoSizeKey   = "limits.maxRepoSize"
+	maxFileSizeKey   = "limits.maxFileSize"
+	maxLFSStorageKey = "limits.maxLFSStorage"
+)
+
+// hookMarker identifies hooks written by this command
+const hookMarker = "# Installed by git-new-bare-repo"
+
+// set replaces the limits given as sizes such as 500M or 2G; an empty string
+// keeps the current limit and 0 lifts it
+func (l *limits) set(repoSize, fileSize, lfsStorage string) error {
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *int64
+	}{
+		{"max repo size", repoSize, &l.maxRepoSize},
+		{"max file size", fileSize, &l.maxFileSize},
+		{"max LFS storage", lfsStorage, &l.maxLFSStorage},
+	} {
+		if field.value == "" {
+			continue
+		}
+		size, err := common.ParseSize(field.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field.name, err)
+		}
+		*field.dest = size
+	}
+	return nil
+}
+
+// any reports whether at least one limit is set
+func (l limits) any() bool {
+	return l.maxRepoSize > 0 || l.maxFileSize > 0 || l.maxLFSStorage > 0
+}
+
+// installLimits records the limits in the repository's config and installs
+// the pre-receive hook that enforces them
+func installLimits(path string, l limits) error {
+	for _, setting := range []struct {
+		key   string
+		value int64
+	}{
+		{maxRepoSizeKey, l.maxRepoSize},
+		{maxFileSizeKey, l.maxFileSize},
+		{maxLFSStorageKey, l.maxLFSStorage},
+	} {
+		if setting.value == 0 {
+			continue
+		}
+		value := strconv.FormatInt(setting.value, 10)
+		if err := common.RunCommand("git", "-C", path, "config", setting.key, value); err != nil {
+			return err
+		}
+	}
+
+	hook := filepath.Join(path, "hooks", "pre-receive")
+	if common.DryRun {
+		fmt.Printf("DRY RUN: write %s\n", hook)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(hook), 0775); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hook, []byte(preReceiveHook), 0775); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(hook, 0775)
+}
+
+// preReceiveHook rejects pushes that exceed the limits in the repository's
+// config. The limits are read on every push, so administrators can change
+// them later with git config.
+const preReceiveHook = `#!/bin/sh
+` + hookMarker + `
+# Enforces the size limits in this repository's config (bytes; git config
+# also accepts k, m and g suffixes). A limit that is unset or 0 is not enforced:
+#   ` + maxRepoSizeKey + `     Object database size after the push
+#   ` + maxFileSizeKey + `     Size of any file the push adds
+#   ` + maxLFSStorageKey + `   Size of lfs/objects, which LFS uploads fill
+#                           before the push that references them
+
+limit() { git config --int "$1" 2>/dev/null || echo 0; }
+max_repo=$(limit ` + maxRepoSizeKey + `)
+max_file=$(limit ` + maxFileSizeKey + `)
+max_lfs=$(limit ` + maxLFSStorageKey + `)
+git_dir=$(git rev-parse --git-dir)
+errors=""
+
+reject() { errors="$errors  $1
+"; }
+
+if [ "$max_file" -gt 0 ]; then
+  while read -r old new ref; do
+    case "$new" in *[!0]*) ;; *) continue ;; esac # Deleted ref
+    large=$(git rev-list --objects "$new" --not --all |
+      git cat-file --batch-check='%(objecttype) %(objectsize) %(rest)' |
+      awk -v max="$max_file" '$1 == "blob" && $2 > max { size = $2; sub(/^[^ ]* [^ ]* /, ""); print "    " $0 " (" size " bytes)" }')
+    if [ -n "$large" ]; then
+      reject "$ref adds files larger than $max_file bytes:
+$large"
+    fi
+  done
+fi
+
+if [ "$max_repo" -gt 0 ]; then
+  # Incoming objects are quarantined below objects/ until the hook accepts them
+  size=$(( $(du -sk "$git_dir/objects" | cut -f1) * 1024 ))
+  if [ "$size" -gt "$max_repo" ]; then
+    reject "The repository would hold $size bytes of objects; the limit is $max_repo bytes"
+  fi
+fi
+
+if [ "$max_lfs" -gt 0 ] && [ -d "$git_dir/lfs/objects" ]; then
+  size=$(( $(du -sk "$git_dir/lfs/objects" | cut -f1) * 1024 ))
+  if [ "$size" -gt "$max_lfs" ]; then
+    reject "LFS storage holds $size bytes; the limit is $max_lfs bytes"
+  fi
+fi
+
+if [ -n "$errors" ]; then
+  printf '\n*** Push rejected by size limits:\n%s\nAsk the repository administrator to raise the limit if needed.\n\n' "$errors" >&2
+  exit 1
+fi
+`
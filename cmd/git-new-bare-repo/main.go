@@ -3,39 +3,209 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
 	flag "github.com/spf13/pflag"
 )
 
 func main() {
 	showHelp := flag.BoolP("help", "h", false, "Show help")
+	installMissing := flag.Bool("install-missing", false, "Install missing system packages")
+	keepPartial := flag.Bool("keep-partial", false, "Keep a partially created repository when a setup step fails")
+	manifest := flag.StringP("manifest", "m", "", "Create every repository listed in this CSV or YAML file")
+	dryRun := flag.BoolP("dry-run", "d", false, "Print the commands that would create the repositories without running them")
+	maxRepoSize := flag.String("max-repo-size", "", "Reject pushes that grow the object database beyond this size, e.g. 2G")
+	maxFileSize := flag.String("max-file-size", "", "Reject pushes that add a file larger than this, e.g. 50M")
+	maxLFSStorage := flag.String("max-lfs-storage", "", "Reject pushes once the repository's LFS storage exceeds this size, e.g. 10G")
+	mirrorFrom := flag.String("mirror-from", "", "Fetch every ref and LFS object of this repository into the new one")
+	shared := flag.String("shared", defaultShared, "Permissions of the repositories, as for git init --shared: umask, group, all or an octal mode")
+	defaultBranch := flag.String("default-branch", "", "Branch that HEAD names (default: git's init.defaultBranch)")
+	description := flag.String("description", "", "Text of the repository's description file (default: its name)")
+	sshUser := flag.String("ssh-user", "", "Serve the repositories over SSH as this system user, created if needed, e.g. git")
+	sshKeys := flag.StringArray("ssh-key", nil, "Authorize the public keys in this file for --ssh-user; repeatable")
+	sshHost := flag.String("ssh-host", "", "Host name of the printed clone URLs (default: this host's name)")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-new-bare-repo")
+	completion.Handle(completion.Command{Name: "git-new-bare-repo", Flags: flag.CommandLine, Args: completion.ArgDirectory})
 	flag.Parse()
 
-	if *showHelp || flag.NArg() == 0 {
+	if *showHelp || (flag.NArg() == 0 && *manifest == "" && *sshUser == "") {
 		printHelp("")
 		os.Exit(0)
 	}
+	common.SetDryRun(*dryRun)
+
+	defaults := repoSpec{group: defaultGroup, shared: *shared, defaultBranch: *defaultBranch}
+	if err := defaults.limits.set(*maxRepoSize, *maxFileSize, *maxLFSStorage); err != nil {
+		common.PrintError("%v", err)
+	}
+
+	var ssh *sshAccess
+	if *sshUser != "" {
+		var err error
+		if ssh, err = newSSHAccess(*sshUser, *sshKeys, *sshHost); err != nil {
+			common.PrintError("%v", err)
+		}
+	} else if len(*sshKeys) > 0 || *sshHost != "" {
+		common.PrintError("--ssh-key and --ssh-host need --ssh-user")
+	}
+
+	if *manifest != "" {
+		if *mirrorFrom != "" {
+			common.PrintError("--mirror-from cannot be combined with --manifest; set mirror_from in the manifest instead")
+		}
+		if *description != "" {
+			common.PrintError("--description cannot be combined with --manifest; set description in the manifest instead")
+		}
+		specs, err := readManifest(*manifest, defaults)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		checkPrerequisites(*installMissing, needsLFS(specs), ssh != nil)
+		audit := common.StartAudit("git-new-bare-repo", common.DryRun)
+		created, failed := createAll(specs, *keepPartial)
+		audit.Created(created...)
+		if ssh != nil {
+			for _, spec := range specs {
+				ssh.addGroup(spec.group)
+			}
+			if err := ssh.setupAndAudit(audit); err != nil {
+				audit.Finish(err)
+				common.PrintError("%v", err)
+			}
+			ssh.printCloneURLs(created)
+		}
+		if failed > 0 {
+			audit.Finish(fmt.Errorf("%d of %d repositories failed", failed, len(specs)))
+			os.Exit(1)
+		}
+		audit.Finish(nil)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		// Only SSH access is set up
+		checkPrerequisites(*installMissing, false, true)
+		ssh.addGroup(defaultGroup)
+		audit := common.StartAudit("git-new-bare-repo", common.DryRun)
+		err := ssh.setupAndAudit(audit)
+		audit.Finish(err)
+		if err != nil {
+			common.PrintError("%v", err)
+		}
+		return
+	}
 
 	repoPath := flag.Arg(0)
 
 	// Validate input
-	if repoPath == "." || repoPath == ".." || repoPath == "/" {
-		printHelp(fmt.Sprintf("Error: Invalid repository path '%s'.\nPlease provide a specific repository name or path.", repoPath))
+	if err := validateRepoPath(repoPath); err != nil {
+		printHelp(fmt.Sprintf("Error: %v\nPlease provide a specific repository name or path.", err))
 		os.Exit(1)
 	}
 
+	spec := defaults
+	spec.path, spec.description, spec.mirrorFrom = repoPath, *description, *mirrorFrom
+	if err := spec.validate(); err != nil {
+		common.PrintError("%v", err)
+	}
+
 	// Check prerequisites
-	checkPrerequisites()
+	checkPrerequisites(*installMissing, needsLFS([]repoSpec{spec}), ssh != nil)
+
+	audit := common.StartAudit("git-new-bare-repo", common.DryRun)
+	fullPath, err := createRepo(spec, *keepPartial)
+	if err != nil {
+		if os.IsExist(err) {
+			audit.Finish(err)
+			printHelp(fmt.Sprintf("Error: '%s' already exists.", fullPath))
+			os.Exit(1)
+		}
+		common.PrintError("%v", err)
+	}
+
+	if !common.DryRun {
+		audit.Created(fullPath)
+	}
+	if ssh != nil {
+		ssh.addGroup(spec.group)
+		if err := ssh.setupAndAudit(audit); err != nil {
+			audit.Finish(err)
+			common.PrintError("%v", err)
+		}
+	}
+	audit.Finish(nil)
+	if common.DryRun {
+		fmt.Printf("Would create bare repository at %s\n", fullPath)
+	} else {
+		fmt.Printf("Successfully created bare repository at %s\n", fullPath)
+	}
+	if ssh != nil {
+		ssh.printCloneURLs([]string{fullPath})
+	}
+}
+
+// repoSpec describes one repository to create
+type repoSpec struct {
+	path        string
+	description string // Written to the repository's description file
+	group       string // Group owning the repository
+	shared      string // Value for git init --shared
+	limits      limits // Size limits enforced by a pre-receive hook
+	mirrorFrom  string // URL of a repository whose refs and LFS objects are fetched
+	// Branch that HEAD names; git's init.defaultBranch when empty
+	defaultBranch string
+}
+
+const (
+	defaultGroup  = "git_access"
+	defaultShared = "everybody"
+)
 
-	// Ensure git_access group exists
-	ensureGitAccessGroup()
+// sharedModes are the named values of git init --shared
+var sharedModes = []string{"umask", "false", "group", "true", "all", "world", "everybody"}
+
+// validate checks the settings of a repository that git would only reject
+// once the repository is half created
+func (spec repoSpec) validate() error {
+	if !slices.Contains(sharedModes, spec.shared) && !octalMode.MatchString(spec.shared) {
+		return fmt.Errorf("invalid shared mode '%s': use umask, group, all or an octal mode such as 0640", spec.shared)
+	}
+	if spec.defaultBranch != "" {
+		if spec.mirrorFrom != "" {
+			return fmt.Errorf("a default branch cannot be combined with mirroring, which takes HEAD from %s", spec.mirrorFrom)
+		}
+		if _, err := common.QueryCommand("git", "check-ref-format", "--branch", spec.defaultBranch); err != nil {
+			return fmt.Errorf("invalid default branch '%s'", spec.defaultBranch)
+		}
+	}
+	return nil
+}
 
-	// Parse repo path and name
+// octalMode matches the octal permissions git init --shared accepts
+var octalMode = regexp.MustCompile(`^0[0-7]{3}$`)
+
+// validateRepoPath rejects paths that do not name a repository
+func validateRepoPath(repoPath string) error {
+	if repoPath == "" || repoPath == "." || repoPath == ".." || repoPath == "/" {
+		return fmt.Errorf("Invalid repository path '%s'.", repoPath)
+	}
+	if strings.ContainsAny(repoPath, " \t") {
+		return fmt.Errorf("Repository path '%s' must not contain spaces.", repoPath)
+	}
+	return nil
+}
+
+// resolveRepoPath returns the absolute repository path, with the .git suffix
+func resolveRepoPath(repoPath string) (string, error) {
 	// Clean the path first to handle relative paths properly
 	cleanPath := filepath.Clean(repoPath)
 	dir := filepath.Dir(cleanPath)
@@ -46,60 +216,132 @@ func main() {
 		name = name + ".git"
 	}
 
-	fullPath := filepath.Join(dir, name)
+	absPath, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %v", err)
+	}
+	return absPath, nil
+}
 
-	// Convert to absolute path for clarity
-	absPath, err := filepath.Abs(fullPath)
+// createRepo creates one bare repository, rolling back everything it created
+// if a step fails. It returns the repository's absolute path and an error
+// satisfying os.IsExist if the repository already exists.
+func createRepo(spec repoSpec, keepPartial bool) (string, error) {
+	fullPath, err := resolveRepoPath(spec.path)
 	if err != nil {
-		common.PrintError("Failed to resolve absolute path: %v", err)
+		return "", err
 	}
-	fullPath = absPath
 
 	// Check if repo already exists
 	if _, err := os.Stat(fullPath); err == nil {
-		printHelp(fmt.Sprintf("Error: '%s' already exists.", fullPath))
-		os.Exit(1)
+		return fullPath, &os.PathError{Op: "create", Path: fullPath, Err: os.ErrExist}
 	}
 
+	// Ensure the owning group exists
+	ensureGroup(spec.group)
+
+	// Every step below is rolled back if a later one fails
+	tx := &transaction{keepPartial: keepPartial}
+
 	// Create parent directory if needed
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		common.PrintError("Failed to create parent directory: %v", err)
+	err = tx.step("create parent directory", func() error {
+		return tx.mkdirAll(filepath.Dir(fullPath), 0755)
+	})
+	if err != nil {
+		return fullPath, err
 	}
 
 	// Create the bare repository directory with SGID
 	fmt.Printf("Creating bare repository at %s\n", fullPath)
 
-	if err := os.MkdirAll(fullPath, 0775); err != nil {
-		common.PrintError("Failed to create repository directory: %v", err)
-	}
-
-	// Change to the parent directory
-	if err := os.Chdir(dir); err != nil {
-		common.PrintError("Failed to change to directory %s: %v", dir, err)
+	err = tx.step("create repository directory", func() error {
+		return tx.mkdirAll(fullPath, 0775)
+	})
+	if err != nil {
+		return fullPath, err
 	}
 
-	// Set group ownership to git_access (requires sudo on Linux)
-	// This may fail on systems without sudo or git_access group
-	cmd := exec.Command("sudo", "chgrp", "git_access", name)
-	_ = cmd.Run() // Ignore error if sudo/chgrp fails
+	// Set group ownership (requires sudo on Linux)
+	// This may fail on systems without sudo or the group
+	_ = common.RunCommand("sudo", "chgrp", spec.group, fullPath) // Ignore error if sudo/chgrp fails
 
 	// Initialize bare repository with shared permissions
 	fmt.Println("Initializing bare repository...")
-	if err := initBareRepo(fullPath); err != nil {
-		common.PrintError("Failed to initialize bare repository: %v", err)
+	err = tx.step("git init --bare", func() error {
+		return initBareRepo(fullPath, spec.shared)
+	})
+	if err != nil {
+		return fullPath, err
 	}
 
 	// Configure the repository
-	if err := os.Chdir(fullPath); err != nil {
-		common.PrintError("Failed to change to repository directory: %v", err)
+	fmt.Println("Configuring repository...")
+	err = tx.step("configure repository", func() error {
+		return configureRepo(fullPath, spec)
+	})
+	if err != nil {
+		return fullPath, err
 	}
 
-	fmt.Println("Configuring repository...")
-	if err := configureRepo(); err != nil {
-		common.PrintError("Failed to configure repository: %v", err)
+	if spec.limits.any() {
+		fmt.Println("Installing size limits...")
+		err = tx.step("install size limits", func() error {
+			return installLimits(fullPath, spec.limits)
+		})
+		if err != nil {
+			return fullPath, err
+		}
 	}
 
-	fmt.Printf("Successfully created bare repository at %s\n", fullPath)
+	if spec.mirrorFrom != "" {
+		fmt.Printf("Mirroring %s...\n", spec.mirrorFrom)
+		err = tx.step("mirror "+spec.mirrorFrom, func() error {
+			return mirrorRepo(fullPath, spec.mirrorFrom)
+		})
+	}
+	return fullPath, err
+}
+
+// createAll creates the repositories of a manifest and prints a summary;
+// it returns the paths it created and the number of failures
+func createAll(specs []repoSpec, keepPartial bool) (createdPaths []string, failed int) {
+	type result struct {
+		path   string
+		status string
+	}
+	var results []result
+	created, existing := 0, 0
+
+	for i, spec := range specs {
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(specs), spec.path)
+		if err := validateRepoPath(spec.path); err != nil {
+			failed++
+			results = append(results, result{spec.path, "✗ " + err.Error()})
+			continue
+		}
+
+		fullPath, err := createRepo(spec, keepPartial)
+		switch {
+		case err == nil:
+			created++
+			createdPaths = append(createdPaths, fullPath)
+			results = append(results, result{fullPath, "✓ created"})
+		case os.IsExist(err):
+			existing++
+			results = append(results, result{fullPath, "- already exists, skipped"})
+		default:
+			failed++
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			results = append(results, result{fullPath, "✗ " + err.Error()})
+		}
+	}
+
+	fmt.Println("\nSummary:")
+	for _, r := range results {
+		fmt.Printf("  %s: %s\n", r.path, r.status)
+	}
+	fmt.Printf("\n%d created, %d already existed, %d failed\n", created, existing, failed)
+	return createdPaths, failed
 }
 
 func printHelp(msg string) {
@@ -113,9 +355,38 @@ func printHelp(msg string) {
 
 		USAGE:
 		  git new-bare-repo [OPTIONS] /path/to/new/repo.git
+		  git new-bare-repo [OPTIONS] --manifest FILE
+		  git new-bare-repo --ssh-user NAME [--ssh-key FILE ...]
 
 		OPTIONS:
-		  -h  Show this help message
+		  -d, --dry-run        Print the commands that would create the repositories
+		  -h, --help           Show this help message
+		  --version            Show the version, commit and build date
+		  -m, --manifest FILE  Create every repository listed in a CSV or YAML file
+		  --trace              Print every external command before running it
+		  --timeout DURATION   Stop a fetch of --mirror that takes longer, e.g. 1h
+		  --retries N          Retry a failed fetch of --mirror N times (default: 2)
+		  --install-missing    Install missing system packages (apt-get or Homebrew)
+		  --keep-partial       Keep a partially created repository when a setup step fails
+		  --max-repo-size SIZE Reject pushes that grow the object database beyond SIZE
+		  --max-file-size SIZE Reject pushes that add a file larger than SIZE
+		  --max-lfs-storage SIZE
+		                       Reject pushes once the repository's LFS storage exceeds SIZE
+		  --mirror-from URL    Fetch every ref and LFS object of the repository at URL
+		  --shared MODE        Permissions of the repositories, as for git init
+		                       --shared: umask, group, all (default: everybody,
+		                       the same as all) or an octal mode such as 0640
+		  --default-branch NAME
+		                       Branch that HEAD names (default: git's
+		                       init.defaultBranch)
+		  --description TEXT   Text of the description file shown by gitweb and
+		                       cgit (default: the repository's name)
+		  --ssh-user NAME      Serve the repositories over SSH as the system user NAME,
+		                       created if it does not exist, e.g. git
+		  --ssh-key FILE       Authorize the public keys in FILE for --ssh-user;
+		                       repeat for several files
+		  --ssh-host HOST      Host name of the printed clone URLs (default: this
+		                       host's name)
 
 		DESCRIPTION:
 		  Creates a new bare Git repository, typically run on a Git server where bare
@@ -128,88 +399,240 @@ func printHelp(msg string) {
 		  Features:
 		    - Parent directories are created automatically if needed
 		    - .git suffix is appended if not specified
-		    - Shared repository permissions (--shared=everybody)
+		    - Shared repository permissions: writable by the group and readable
+		      by everybody, unless --shared sets umask (the creator's umask
+		      alone), group (others get only what the umask allows) or an
+		      octal mode
+		    - HEAD names --default-branch, and the description file holds
+		      --description or the repository's name instead of git's boilerplate
 		    - Sets receive.denyCurrentBranch to ignore
+		    - If any setup step fails, the step is reported and everything
+		      created so far is removed, unless --keep-partial is given
 
 		  Note: Repository names must not contain spaces.
 
+		SIZE LIMITS:
+		  The --max-* options (sizes such as 500K, 50M or 2G) record limits in the
+		  repository's config and install a pre-receive hook that enforces them on
+		  every push, so a runaway repository is stopped before it fills the disk:
+		    limits.maxRepoSize    Size of the object database, including the
+		                          objects being pushed
+		    limits.maxFileSize    Size of any file added by the pushed commits
+		    limits.maxLFSStorage  Size of the repository's lfs/objects directory.
+		                          LFS objects are uploaded before the push that
+		                          references them, so once storage exceeds the
+		                          limit further pushes are rejected.
+
+		  The hook reads the limits on every push; change them later with
+		  'git config limits.maxFileSize 100M', or set one to 0 to lift it.
+
+		MIRRORING:
+		  --mirror-from URL moves a repository between servers in one command:
+		  once the new repository is set up, every ref of URL is fetched as
+		  git clone --mirror would (branches, tags, notes and any other refs),
+		  HEAD is pointed at the same default branch, and all of its LFS
+		  objects are fetched with git lfs fetch --all. URL keeps
+		  the name origin, so pushes made to it before clients switch over are
+		  picked up by running, in the new repository:
+		    git fetch --prune origin && git lfs fetch --all origin
+		  A failed fetch rolls the new repository back like any other step.
+
+		SSH ACCESS:
+		  --ssh-user turns a freshly provisioned box into an SSH Git server in
+		  one command. A user that does not exist is created as a system user
+		  with git-shell as its login shell, so it cannot log in interactively.
+		  The user joins the group of every repository created, and can then
+		  push to them.
+
+		  The keys of each --ssh-key file (public keys as ssh-keygen writes
+		  them, one per line) are appended to the user's authorized_keys, except
+		  keys already there, with the option restrict, so a key has no
+		  forwarding or terminal and can only run the Git commands git-shell
+		  allows. When an existing user has another login shell, the keys also
+		  get the option
+		    command="git-shell -c \"$SSH_ORIGINAL_COMMAND\""
+		  to pass their commands to git-shell. sshd runs that command with the
+		  login shell, so users whose login shell is git-shell cannot have it.
+
+		  Git LFS over SSH needs git-lfs-transfer or git-lfs-authenticate on the
+		  server. Whichever is installed is linked into ~NAME/git-shell-commands,
+		  the only other commands git-shell runs; with neither, a warning
+		  suggests serving LFS objects over HTTP instead, e.g. with git giftless.
+
+		  Clients that mount the repositories' directory, e.g. over NFS or SMB,
+		  need no LFS server: git lfs-folder-agent stores LFS objects in the
+		  lfs/objects directory of a bare repository on the share.
+
+		  Finally the clone URL of each repository is printed, NAME@HOST:PATH.
+		  Without a repository or manifest only the access is set up.
+
+		MANIFESTS:
+		  A manifest lists repositories with the fields path (required),
+		  description, group (default: git_access), shared (the value for
+		  git init --shared), max_repo_size, max_file_size and
+		  max_lfs_storage, which override the --max-* options, mirror_from,
+		  the URL of a repository to mirror, and default_branch.
+		  An entry without shared or default_branch takes --shared or
+		  --default-branch.
+		  Repositories that already exist
+		  are skipped; a failed repository is rolled back without stopping the
+		  others. A summary is printed at the end, and the exit status is 1 when
+		  any repository failed.
+
+		  CSV manifests need a header row naming the columns:
+		    path,description,group,shared
+		    /srv/git/web,Company website,web,group
+		    /srv/git/docs,Documentation,,
+
+		  YAML manifests (.yaml or .yml) hold a list of mappings:
+		    repositories:
+		      - path: /srv/git/web
+		        description: Company website
+		        group: web
+		        shared: group
+
 		REQUIREMENTS:
 		  - Git
+		  - Git LFS (with --mirror-from)
 		  - sudo (for group management operations)
 		  - getent (for checking group existence)
 		  - groupadd (for creating git_access group)
 		  - chgrp (for setting group ownership)
+		  - useradd, usermod and git-shell (with --ssh-user)
 
 		EXAMPLES:
 		  # Create a repository (adds .git automatically)
 		  git new-bare-repo /srv/git/myproject
 
+		  # Create a repository only its group can read, on branch main
+		  git new-bare-repo --shared group --default-branch main \
+		    --description "Payroll service" /srv/git/payroll
+
 		  # Create with explicit .git suffix
 		  git new-bare-repo /srv/git/myproject.git
 
 		  # Create in a nested path (parent dirs created automatically)
 		  git new-bare-repo /srv/git/team/project.git
+
+		  # Provision many repositories at once
+		  git new-bare-repo --manifest repos.csv
+
+		  # Stop a repository from growing beyond 5G or accepting files over 50M
+		  git new-bare-repo --max-repo-size 5G --max-file-size 50M /srv/git/myproject
+
+		  # Move a repository, with its LFS objects, from another server
+		  git new-bare-repo --mirror-from git@old.example.com:team/project.git /srv/git/team/project
+
+		  # Create a repository and let two developers push to it over SSH as git
+		  git new-bare-repo --ssh-user git --ssh-key alice.pub --ssh-key bob.pub /srv/git/myproject
+
+		  # Preview the exact commands first
+		  git new-bare-repo --dry-run --manifest repos.csv
 	`))
 }
 
-func checkPrerequisites() {
-	var missing []string
+// bareRepoRequirements lists the commands needed to create and share a bare repository
+var bareRepoRequirements = []prereq.Requirement{
+	prereq.Git,
+	prereq.Bin("sudo", "required for group management").WithPackage("sudo"),
+	prereq.Bin("getent", "usually part of glibc-common").WithPackage("libc-bin"),
+	prereq.Bin("groupadd", "usually part of shadow-utils").WithPackage("passwd"),
+	prereq.Bin("chgrp", "usually part of coreutils").WithPackage("coreutils"),
+}
 
-	// Check git
-	if _, err := exec.LookPath("git"); err != nil {
-		missing = append(missing, "git (install from: https://git-scm.com/)")
+// needsLFS reports whether any of specs mirrors a repository, which needs
+// Git LFS to fetch its objects
+func needsLFS(specs []repoSpec) bool {
+	for _, spec := range specs {
+		if spec.mirrorFrom != "" {
+			return true
+		}
 	}
+	return false
+}
 
-	// Check sudo
-	if _, err := exec.LookPath("sudo"); err != nil {
-		missing = append(missing, "sudo (required for group management)")
-	}
+// sshRequirements lists the commands needed to set up SSH access
+var sshRequirements = []prereq.Requirement{
+	prereq.Bin("useradd", "usually part of shadow-utils").WithPackage("passwd"),
+	prereq.Bin("usermod", "usually part of shadow-utils").WithPackage("passwd"),
+}
 
-	// Check getent
-	if _, err := exec.LookPath("getent"); err != nil {
-		missing = append(missing, "getent (usually part of glibc-common)")
+func checkPrerequisites(installMissing, lfs, ssh bool) {
+	requirements := append([]prereq.Requirement{}, bareRepoRequirements...)
+	if lfs {
+		requirements = append(requirements, prereq.GitLFS)
 	}
-
-	// Check groupadd
-	if _, err := exec.LookPath("groupadd"); err != nil {
-		missing = append(missing, "groupadd (usually part of shadow-utils)")
+	if ssh {
+		requirements = append(requirements, sshRequirements...)
+	}
+	if err := prereq.Ensure(installMissing, requirements...); err != nil {
+		common.PrintError("%v", err)
 	}
+}
 
-	// Check chgrp
-	if _, err := exec.LookPath("chgrp"); err != nil {
-		missing = append(missing, "chgrp (usually part of coreutils)")
+func ensureGroup(group string) {
+	// Check if the group exists, create if needed
+	if _, err := common.QueryCommand("getent", "group", group); err != nil {
+		// Group doesn't exist, try to create it
+		_ = common.RunCommand("sudo", "groupadd", group) // Ignore error if this fails
 	}
+}
 
-	if len(missing) > 0 {
-		fmt.Fprintf(os.Stderr, "Error: Missing required commands:\n")
-		for _, cmd := range missing {
-			fmt.Fprintf(os.Stderr, "  ✗ %s\n", cmd)
+func initBareRepo(path, shared string) error {
+	return common.RunCommand("git", "init", "--bare", "--shared="+shared, path)
+}
+
+// configureRepo sets the repository's config, HEAD and description; the
+// description defaults to the repository's name instead of git's
+// boilerplate
+func configureRepo(path string, spec repoSpec) error {
+	if err := common.RunCommand("git", "-C", path, "config", "receive.denyCurrentBranch", "ignore"); err != nil {
+		return err
+	}
+	if spec.defaultBranch != "" {
+		if err := common.RunCommand("git", "-C", path, "symbolic-ref", "HEAD", "refs/heads/"+spec.defaultBranch); err != nil {
+			return err
 		}
-		fmt.Fprintf(os.Stderr, "\nPlease install missing dependencies before running git-new-bare-repo.\n")
-		os.Exit(1)
 	}
-}
 
-func ensureGitAccessGroup() {
-	// Check if git_access group exists, create if needed
-	cmd := exec.Command("getent", "group", "git_access")
-	if err := cmd.Run(); err != nil {
-		// Group doesn't exist, try to create it
-		createCmd := exec.Command("sudo", "groupadd", "git_access")
-		_ = createCmd.Run() // Ignore error if this fails
+	description := spec.description
+	if description == "" {
+		description = strings.TrimSuffix(filepath.Base(path), ".git")
 	}
-}
 
-func initBareRepo(path string) error {
-	cmd := exec.Command("git", "init", "--bare", "--shared=everybody", path)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	if common.DryRun {
+		fmt.Printf("DRY RUN: write %s\n", filepath.Join(path, "description"))
+		return nil
+	}
+	return os.WriteFile(filepath.Join(path, "description"), []byte(description+"\n"), 0664)
 }
 
-func configureRepo() error {
-	cmd := exec.Command("git", "config", "receive.denyCurrentBranch", "ignore")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// mirrorRepo fetches every ref of the repository at url into the bare
+// repository at path, as git clone --mirror would, points HEAD at the
+// source's default branch, then fetches all of its LFS objects. The origin
+// remote is kept, so running 'git fetch origin' and 'git lfs fetch --all
+// origin' again catches up with pushes made before the move is complete.
+func mirrorRepo(path, url string) error {
+	if err := common.RunCommand("git", "-C", path, "remote", "add", "--mirror=fetch", "origin", url); err != nil {
+		return err
+	}
+	if err := common.RunNetwork("git", "-C", path, "fetch", "--prune", "origin"); err != nil {
+		return err
+	}
+
+	// Output: ref: refs/heads/main TAB HEAD, then the commit of HEAD
+	output, err := common.QueryNetwork("git", "ls-remote", "--symref", url, "HEAD")
+	if err != nil {
+		return fmt.Errorf("git ls-remote %s failed: %v", url, err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if ref, found := strings.CutPrefix(line, "ref: "); found {
+			ref, _, _ = strings.Cut(ref, "\t")
+			if err := common.RunCommand("git", "-C", path, "symbolic-ref", "HEAD", ref); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return common.RunNetwork("git", "-C", path, "lfs", "fetch", "--all", "origin")
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestFields are the columns (CSV) or keys (YAML) of a manifest entry
+var manifestFields = []string{"path", "description", "group", "shared", "max_repo_size", "max_file_size", "max_lfs_storage", "mirror_from", "default_branch"}
+
+// readManifest reads repository specs from a CSV file with a header row, or
+// from a YAML file (.yaml or .yml) holding a list of mappings. The group,
+// shared mode, default branch and limits an entry does not set are taken
+// from defaults.
+func readManifest(path string, defaults repoSpec) ([]repoSpec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %v", err)
+	}
+	defer file.Close()
+
+	var entries []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAMLManifest(file)
+	default:
+		entries, err = parseCSVManifest(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no repositories", path)
+	}
+
+	specs := make([]repoSpec, 0, len(entries))
+	for i, entry := range entries {
+		for key := range entry {
+			if !isManifestField(key) {
+				return nil, fmt.Errorf("invalid manifest %s: entry %d has unknown field '%s'", path, i+1, key)
+			}
+		}
+		spec := defaults
+		spec.path, spec.description, spec.mirrorFrom = entry["path"], entry["description"], entry["mirror_from"]
+		if spec.path == "" {
+			return nil, fmt.Errorf("invalid manifest %s: entry %d has no path", path, i+1)
+		}
+		if entry["group"] != "" {
+			spec.group = entry["group"]
+		}
+		if entry["shared"] != "" {
+			spec.shared = entry["shared"]
+		}
+		if entry["default_branch"] != "" {
+			spec.defaultBranch = entry["default_branch"]
+		}
+		if err := spec.limits.set(entry["max_repo_size"], entry["max_file_size"], entry["max_lfs_storage"]); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: entry %d: %v", path, i+1, err)
+		}
+		if err := spec.validate(); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: entry %d: %v", path, i+1, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func isManifestField(key string) bool {
+	for _, field := range manifestFields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCSVManifest reads a CSV file whose first row names the columns
+func parseCSVManifest(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	var entries []map[string]string
+	for _, record := range records[1:] {
+		entry := make(map[string]string)
+		for i, value := range record {
+			entry[strings.ToLower(strings.TrimSpace(header[i]))] = strings.TrimSpace(value)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseYAMLManifest reads the YAML subset used by manifests: a list of
+// mappings with scalar values, optionally under a top-level 'repositories' key
+//
+//	repositories:
+//	  - path: /srv/git/project
+//	    description: "Project repository"
+//	    group: developers
+func parseYAMLManifest(r io.Reader) ([]map[string]string, error) {
+	var entries []map[string]string
+	var current map[string]string
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" || line == "repositories:" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			current = make(map[string]string)
+			entries = append(entries, current)
+			line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+			if line == "" {
+				continue
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: expected a list entry starting with '- '", lineNumber)
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", lineNumber)
+		}
+		current[strings.TrimSpace(key)] = yamlScalar(value)
+	}
+	return entries, scanner.Err()
+}
+
+// yamlScalar removes quotes and trailing comments from a scalar value
+func yamlScalar(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.LastIndexByte(value, value[0]); end > 0 {
+			return value[1:end]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// sshKeyTypes are the public key algorithms accepted for authorized_keys
+var sshKeyTypes = []string{
+	"ssh-ed25519", "ssh-rsa",
+	"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+	"sk-ssh-ed25519@openssh.com", "sk-ecdsa-sha2-nistp256@openssh.com",
+}
+
+// gitShellCommand forces the commands of a key through git-shell when the
+// login shell is another one. sshd runs forced commands with the login
+// shell, so git-shell itself would reject it as an unrecognized command.
+const gitShellCommand = `command="git-shell -c \"$SSH_ORIGINAL_COMMAND\""`
+
+// authorizedKey returns the authorized_keys line of key for a user with
+// loginShell, restricted to the commands git-shell allows: no port, agent
+// or X11 forwarding, no terminal, and no other command
+func authorizedKey(key, loginShell string) string {
+	if filepath.Base(loginShell) == "git-shell" {
+		return "restrict " + key
+	}
+	return "restrict," + gitShellCommand + " " + key
+}
+
+// lfsSSHCommands are the Git LFS server commands that git-shell may run
+// from ~/git-shell-commands, so that Git LFS works over SSH too
+var lfsSSHCommands = []string{"git-lfs-transfer", "git-lfs-authenticate"}
+
+// userNamePattern matches the user names useradd accepts by default
+var userNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// sshAccess is the SSH login that serves the repositories
+type sshAccess struct {
+	user   string
+	keys   []string // authorized_keys entries without options: TYPE KEY [COMMENT]
+	host   string   // Host name of clone URLs
+	groups []string // Groups owning the repositories, which the user joins
+}
+
+// newSSHAccess validates the SSH options and reads the keys, before
+// anything is changed
+func newSSHAccess(user string, keyFiles []string, host string) (*sshAccess, error) {
+	if !userNamePattern.MatchString(user) {
+		return nil, fmt.Errorf("invalid --ssh-user '%s': use lowercase letters, digits, '_' and '-'", user)
+	}
+	keys, err := readPublicKeys(keyFiles)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		if host, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("cannot determine the host name; give --ssh-host: %v", err)
+		}
+	}
+	return &sshAccess{user: user, keys: keys, host: host}, nil
+}
+
+// addGroup makes the user join group, which owns a repository
+func (a *sshAccess) addGroup(group string) {
+	if !slices.Contains(a.groups, group) {
+		a.groups = append(a.groups, group)
+	}
+}
+
+// setupAndAudit sets up the access and records it in audit
+func (a *sshAccess) setupAndAudit(audit *common.Audit) error {
+	fmt.Println()
+	created, changed, err := a.setup()
+	if !common.DryRun {
+		audit.Created(created...)
+		audit.Changed(changed...)
+	}
+	return err
+}
+
+// printCloneURLs prints how to clone the repositories at paths over SSH
+func (a *sshAccess) printCloneURLs(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Println("\nClone over SSH with:")
+	for _, path := range paths {
+		fmt.Printf("  git clone %s\n", a.cloneURL(path))
+	}
+}
+
+// readPublicKeys reads the public keys in files, one per line as ssh-keygen
+// writes them; blank lines and comments are skipped
+func readPublicKeys(files []string) ([]string, error) {
+	var keys []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		found, err := parsePublicKeys(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%s: no public key found", file)
+		}
+		for _, key := range found {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// parsePublicKeys returns the keys of public key file content, rejecting
+// private keys and lines carrying authorized_keys options of their own
+func parsePublicKeys(content string) ([]string, error) {
+	if strings.Contains(content, "PRIVATE KEY") {
+		return nil, fmt.Errorf("this is a private key; give the .pub file")
+	}
+	var keys []string
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !slices.Contains(sshKeyTypes, fields[0]) {
+			return nil, fmt.Errorf("line %d is not a public key such as 'ssh-ed25519 AAAA... user@host'", i+1)
+		}
+		keys = append(keys, strings.Join(fields, " "))
+	}
+	return keys, nil
+}
+
+// keyID returns the type and key of an authorized_keys line, which identify
+// it whatever its options and comment are
+func keyID(line string) string {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if slices.Contains(sshKeyTypes, field) && i+1 < len(fields) {
+			return field + " " + fields[i+1]
+		}
+	}
+	return ""
+}
+
+// userHome returns the home directory and login shell of user, and whether
+// the user exists
+func userHome(user string) (string, string, bool) {
+	// Output: NAME:PASSWORD:UID:GID:GECOS:HOME:SHELL
+	output, err := common.QueryCommand("getent", "passwd", user)
+	if err != nil {
+		return "", "", false
+	}
+	fields := strings.Split(output, ":")
+	if len(fields) < 7 {
+		return "", "", false
+	}
+	return fields[5], fields[6], true
+}
+
+// gitShell returns the path of git-shell
+func gitShell() (string, error) {
+	if path, err := exec.LookPath("git-shell"); err == nil {
+		return path, nil
+	}
+	execPath, err := common.QueryCommand("git", "--exec-path")
+	if err == nil {
+		path := filepath.Join(execPath, "git-shell")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("git-shell not found; it is part of Git")
+}
+
+// setup creates the user when it does not exist, with git-shell as its
+// login shell, adds it to the groups, authorizes the keys restricted to
+// git-shell, and lets git-shell run the Git LFS SSH commands that are
+// installed. It returns what it created and changed, for the audit log.
+func (a sshAccess) setup() (created, changed []string, err error) {
+	shell, err := gitShell()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, group := range a.groups {
+		ensureGroup(group)
+	}
+
+	home, loginShell, exists := userHome(a.user)
+	if exists {
+		fmt.Printf("Adding user %s to %s...\n", a.user, strings.Join(a.groups, ", "))
+		if err := common.RunCommand("sudo", "usermod", "--append", "--groups", strings.Join(a.groups, ","), a.user); err != nil {
+			return nil, nil, fmt.Errorf("failed to add %s to %s: %v", a.user, strings.Join(a.groups, ", "), err)
+		}
+	} else {
+		home, loginShell = "/home/"+a.user, shell
+		fmt.Printf("Creating user %s with login shell %s...\n", a.user, shell)
+		err := common.RunCommand("sudo", "useradd", "--system", "--create-home", "--home-dir", home,
+			"--shell", shell, "--user-group", "--groups", strings.Join(a.groups, ","), a.user)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create user %s: %v", a.user, err)
+		}
+		created = append(created, "user "+a.user)
+	}
+
+	if len(a.keys) > 0 {
+		authorizedKeys, added, err := a.authorize(home, loginShell)
+		if err != nil {
+			return created, changed, err
+		}
+		if added > 0 {
+			changed = append(changed, authorizedKeys)
+		}
+	}
+
+	linked, err := a.linkLFSCommands(home)
+	if err != nil {
+		return created, changed, err
+	}
+	if len(linked) == 0 {
+		fmt.Println("⚠ Neither git-lfs-transfer nor git-lfs-authenticate is installed, so Git LFS")
+		fmt.Println("  objects cannot be transferred over SSH. Install git-lfs-transfer, or serve")
+		fmt.Println("  them over HTTP, e.g. with git giftless.")
+	}
+	return created, changed, nil
+}
+
+// authorize appends the keys that are not authorized yet to the user's
+// authorized_keys, restricted for loginShell by authorizedKey. It returns
+// the file and the number of keys added.
+func (a sshAccess) authorize(home, loginShell string) (string, int, error) {
+	sshDir := filepath.Join(home, ".ssh")
+	authorizedKeys := filepath.Join(sshDir, "authorized_keys")
+	if err := common.RunCommand("sudo", "install", "-d", "-m", "700", "-o", a.user, "-g", a.user, sshDir); err != nil {
+		return authorizedKeys, 0, fmt.Errorf("failed to create %s: %v", sshDir, err)
+	}
+
+	present := make(map[string]bool)
+	if existing, err := common.QueryCommand("sudo", "cat", authorizedKeys); err == nil {
+		for _, line := range strings.Split(existing, "\n") {
+			present[keyID(line)] = true
+		}
+	}
+	var lines []string
+	for _, key := range a.keys {
+		if !present[keyID(key)] {
+			lines = append(lines, authorizedKey(key, loginShell))
+		}
+	}
+	if skipped := len(a.keys) - len(lines); skipped > 0 {
+		fmt.Printf("%d %s already authorized for %s\n", skipped, common.Plural(skipped, "key is", "keys are"), a.user)
+	}
+	if len(lines) == 0 {
+		return authorizedKeys, 0, nil
+	}
+
+	fmt.Printf("Authorizing %d %s for %s, restricted to git-shell...\n", len(lines), common.Plural(len(lines), "key", "keys"), a.user)
+	if common.DryRun {
+		for _, line := range lines {
+			fmt.Printf("DRY RUN: append to %s: %s\n", authorizedKeys, line)
+		}
+	}
+	cmd := exec.Command("sudo", "tee", "-a", authorizedKeys)
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	cmd.Stdout = io.Discard
+	if err := common.Run(cmd); err != nil {
+		return authorizedKeys, 0, fmt.Errorf("failed to write %s: %v", authorizedKeys, err)
+	}
+	if err := common.RunCommand("sudo", "chown", a.user+":", authorizedKeys); err != nil {
+		return authorizedKeys, 0, err
+	}
+	if err := common.RunCommand("sudo", "chmod", "600", authorizedKeys); err != nil {
+		return authorizedKeys, 0, err
+	}
+	return authorizedKeys, len(lines), nil
+}
+
+// linkLFSCommands links the installed Git LFS SSH commands into the user's
+// git-shell-commands directory, the only other commands git-shell runs.
+// It returns the commands linked.
+func (a sshAccess) linkLFSCommands(home string) ([]string, error) {
+	var linked []string
+	dir := filepath.Join(home, "git-shell-commands")
+	for _, name := range lfsSSHCommands {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		if len(linked) == 0 {
+			if err := common.RunCommand("sudo", "install", "-d", "-m", "755", "-o", a.user, "-g", a.user, dir); err != nil {
+				return nil, fmt.Errorf("failed to create %s: %v", dir, err)
+			}
+		}
+		fmt.Printf("Allowing %s over SSH...\n", name)
+		if err := common.RunCommand("sudo", "ln", "-sf", path, filepath.Join(dir, name)); err != nil {
+			return linked, fmt.Errorf("failed to link %s: %v", name, err)
+		}
+		linked = append(linked, name)
+	}
+	return linked, nil
+}
+
+// cloneURL returns the SSH URL of the repository at path
+func (a sshAccess) cloneURL(path string) string {
+	return fmt.Sprintf("%s@%s:%s", a.user, a.host, path)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+// TestAuthorizedKey tests that keys are restricted to git-shell in a way
+// that the user's login shell can run
+func TestAuthorizedKey(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGx alice@laptop"
+	tests := []struct {
+		loginShell string
+		want       string
+	}{
+		// git-shell would take a forced command for an unrecognized one
+		{"/usr/bin/git-shell", "restrict " + key},
+		{"/usr/lib/git-core/git-shell", "restrict " + key},
+		{"/bin/bash", `restrict,command="git-shell -c \"$SSH_ORIGINAL_COMMAND\"" ` + key},
+	}
+	for _, tt := range tests {
+		if got := authorizedKey(key, tt.loginShell); got != tt.want {
+			t.Errorf("authorizedKey(%q) = %s, want %s", tt.loginShell, got, tt.want)
+		}
+		if keyID(tt.want) != "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGx" {
+			t.Errorf("keyID(%s) = %q", tt.want, keyID(tt.want))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// transaction records the directories created while setting up a repository
+// so a failed setup can be rolled back
+type transaction struct {
+	keepPartial bool
+	created     []string // Absolute paths, in creation order
+}
+
+// step runs one setup step; when it fails, everything created so far is
+// removed (unless keepPartial) and an error naming the step is returned
+func (t *transaction) step(name string, fn func() error) error {
+	if err := fn(); err != nil {
+		t.rollback()
+		return fmt.Errorf("Step '%s' failed: %v", name, err)
+	}
+	return nil
+}
+
+// mkdirAll is os.MkdirAll that records the outermost directory it created
+func (t *transaction) mkdirAll(path string, perm os.FileMode) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if common.DryRun {
+		fmt.Printf("DRY RUN: mkdir -p %s\n", abs)
+		return nil
+	}
+
+	// Find the outermost ancestor that does not exist yet
+	outermost := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		outermost = dir
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	err = os.MkdirAll(abs, perm)
+	// Recorded even when MkdirAll fails partway, so that rollback removes
+	// the directories it did create
+	if outermost != "" {
+		if _, statErr := os.Stat(outermost); statErr == nil {
+			t.created = append(t.created, outermost)
+		}
+	}
+	return err
+}
+
+// rollback removes the created directories, most recent first
+func (t *transaction) rollback() {
+	if len(t.created) == 0 {
+		return
+	}
+	if t.keepPartial {
+		fmt.Fprintln(os.Stderr, "Keeping partially created files (--keep-partial):")
+		for _, path := range t.created {
+			fmt.Fprintf(os.Stderr, "  %s\n", path)
+		}
+		return
+	}
+
+	for i := len(t.created) - 1; i >= 0; i-- {
+		path := t.created[i]
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Rolled back: removed %s\n", path)
+	}
+}
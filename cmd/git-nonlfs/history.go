@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// reportHistory lists large non-LFS blobs that only exist in the history of
+// HEAD, or of every ref, so the cost of keeping them can be weighed against
+// rewriting history
+func reportHistory(allRefs bool, minSize int64) {
+	refs := []string{"HEAD"}
+	scope := "HEAD"
+	if allRefs {
+		var err error
+		if refs, err = lfspointer.AllRefs(); err != nil {
+			common.PrintError("%v", err)
+		}
+		scope = "any ref"
+	}
+
+	blobs, err := lfsfiles.HistoryOnly(refs, minSize)
+	if err != nil {
+		common.PrintError("Failed to scan history: %v", err)
+	}
+	if len(blobs) == 0 {
+		fmt.Printf("No non-LFS blobs of at least %s exist only in the history of %s.\n", common.FormatSize(minSize), scope)
+		return
+	}
+
+	var total int64
+	extensions := make(map[string]bool)
+	fmt.Printf("%10s  %-10s  %-10s  %s\n", "SIZE", "COMMIT", "DATE", "PATH")
+	for _, b := range blobs {
+		commit := "(merge)"
+		if b.Commit != "" {
+			commit = b.Commit[:10]
+		}
+		fmt.Printf("%10s  %-10s  %-10s  %s\n", common.FormatSize(b.Size), commit, b.Date, b.Path)
+		total += b.Size
+		if ext := strings.ToLower(path.Ext(b.Path)); ext != "" {
+			extensions["*"+ext] = true
+		}
+	}
+
+	fmt.Printf("\n%d blobs totaling %s exist only in the history of %s.\n", len(blobs), common.FormatSize(total), scope)
+	fmt.Println("Every clone downloads them, although no current tree contains them.")
+	if len(extensions) > 0 {
+		patterns := make([]string, 0, len(extensions))
+		for ext := range extensions {
+			patterns = append(patterns, ext)
+		}
+		sort.Strings(patterns)
+		fmt.Println("Rewriting history moves them to Git LFS; every collaborator must then re-clone:")
+		fmt.Printf("  git lfs migrate import --everything --include=\"%s\"\n", strings.Join(patterns, ","))
+	}
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/inventory"
 	flag "github.com/spf13/pflag"
 )
 
 func main() {
 	showHelp := flag.BoolP("help", "h", false, "Show help")
+	suggest := flag.BoolP("suggest", "s", false, "Suggest extensions to track with Git LFS")
+	minTotal := flag.String("min-total", "10M", "Suggest extensions whose files total at least this size")
+	minFile := flag.String("min-file", "1M", "Suggest extensions having a file at least this large")
+	noCache := flag.Bool("no-cache", false, "Classify every file without using the inventory cache")
+	clearCache := flag.Bool("clear-cache", false, "Delete the inventory cache before running")
+	verbose := flag.BoolP("verbose", "v", false, "Report how the inventory was obtained")
+	history := flag.Bool("history", false, "Report large non-LFS blobs that exist only in history")
+	allRefs := flag.Bool("all-refs", false, "With --history, scan every branch, tag and remote-tracking branch")
+	minSize := flag.String("min-size", "1M", "With --history, report blobs at least this large")
+	mismatched := flag.Bool("mismatched", false, "Report committed files whose storage disagrees with the LFS patterns")
+	trackedOnly := flag.Bool("tracked-only", false, "List only files in the index (the default)")
+	includeUntracked := flag.Bool("include-untracked", false, "Also list untracked files")
+	respectGitignore := flag.Bool("respect-gitignore", true, "With --include-untracked, leave out files .gitignore ignores")
+	null := flag.BoolP("null", "z", false, "Terminate paths with NUL instead of newline")
+	common.AddVersionFlag(flag.CommandLine, "git-nonlfs")
+	completion.Handle(completion.Command{Name: "git-nonlfs", Flags: flag.CommandLine, Args: completion.ArgNone})
 	flag.Parse()
 
 	if *showHelp {
@@ -27,33 +43,85 @@ func main() {
 		common.PrintError("%v", err)
 	}
 
-	// Get all files in the repository (excluding .git directory)
-	allFiles, err := getAllFiles()
-	if err != nil {
-		common.PrintError("Failed to get all files: %v", err)
+	if *trackedOnly && *includeUntracked {
+		common.PrintError("--tracked-only and --include-untracked cannot be combined")
+	}
+	if flag.CommandLine.Changed("respect-gitignore") && !*includeUntracked {
+		common.PrintError("--respect-gitignore only applies with --include-untracked")
+	}
+	if *null && (*suggest || *history || *mismatched) {
+		common.PrintError("--null only applies to the list of files, not to --suggest, --history or --mismatched")
+	}
+
+	if *history {
+		minSizeBytes, err := common.ParseSize(*minSize)
+		if err != nil {
+			common.PrintError("--min-size: %v", err)
+		}
+		reportHistory(*allRefs, minSizeBytes)
+		return
 	}
 
-	// Get LFS tracked patterns from .gitattributes
-	lfsPatterns, err := getLFSPatterns()
+	if *clearCache {
+		if err := inventory.Clear(); err != nil {
+			common.PrintError("Failed to clear the inventory cache: %v", err)
+		}
+	}
+
+	// Classify the files below the current directory
+	files, stats, err := inventory.Load(!*noCache)
 	if err != nil {
-		common.PrintError("Failed to get LFS patterns: %v", err)
+		common.PrintError("Failed to list files: %v", err)
+	}
+	if *includeUntracked && !*respectGitignore {
+		ignored, err := inventory.Ignored()
+		if err != nil {
+			common.PrintError("Failed to list ignored files: %v", err)
+		}
+		files = append(files, ignored...)
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	}
+	prefix, _ := common.ExecGitCommand("rev-parse", "--show-prefix")
+	files = inventory.RelativeTo(files, strings.TrimSpace(prefix))
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "Inventory: %s, %d paths reclassified\n", stats.Source, stats.Changed)
 	}
 
-	// Find files matching LFS patterns
-	lfsFiles := make(map[string]bool)
-	for _, pattern := range lfsPatterns {
-		matches, _ := findMatchingFiles(pattern)
-		for _, match := range matches {
-			lfsFiles[match] = true
+	if *mismatched {
+		if reportMismatched(files) {
+			os.Exit(1)
 		}
+		return
 	}
 
-	// Print files that are NOT in LFS
-	for _, file := range allFiles {
-		if !lfsFiles[file] {
-			fmt.Println(file)
+	// Collect files that are NOT in LFS
+	var nonLFSFiles []string
+	for _, file := range files {
+		if !file.LFS && (!file.Untracked || *includeUntracked) {
+			nonLFSFiles = append(nonLFSFiles, file.Path)
 		}
 	}
+
+	if *suggest {
+		minTotalBytes, err := common.ParseSize(*minTotal)
+		if err != nil {
+			common.PrintError("--min-total: %v", err)
+		}
+		minFileBytes, err := common.ParseSize(*minFile)
+		if err != nil {
+			common.PrintError("--min-file: %v", err)
+		}
+		suggestTracking(nonLFSFiles, minTotalBytes, minFileBytes)
+		return
+	}
+
+	end := "\n"
+	if *null {
+		end = "\x00"
+	}
+	for _, file := range nonLFSFiles {
+		fmt.Print(file, end)
+	}
 }
 
 func printHelp() {
@@ -64,100 +132,84 @@ func printHelp() {
 		  git nonlfs [OPTIONS]
 
 		OPTIONS:
-		  -h  Show this help message
+		  -h, --help          Show this help message
+		  --version           Show the version, commit and build date
+		  -s, --suggest       Suggest extensions to track with Git LFS instead of listing files
+		  --min-total SIZE    With --suggest, extensions whose files total at least SIZE (default: 10M)
+		  --min-file SIZE     With --suggest, extensions having a file at least SIZE (default: 1M)
+		  --no-cache          Classify every file without using the inventory cache
+		  --clear-cache       Delete the inventory cache before running
+		  -v, --verbose       Report whether the inventory came from the cache
+		  --history           Report large non-LFS blobs that exist only in history
+		  --all-refs          With --history, scan every ref instead of HEAD
+		  --min-size SIZE     With --history, blobs at least SIZE (default: 1M)
+		  --mismatched        Report committed files whose storage disagrees with
+		                      the LFS patterns, and how to fix them
+		  --tracked-only      List only files in the index (the default)
+		  --include-untracked Also list untracked files that .gitignore does not ignore
+		  --respect-gitignore=false
+		                      With --include-untracked, list ignored files too
+		  -z, --null          Terminate each path with NUL instead of newline, for
+		                      xargs -0 and names holding spaces or newlines
 
 		DESCRIPTION:
 		  This command lists all files in the repository that are not tracked by Git LFS.
-		  It reads .gitattributes to determine which patterns are tracked by LFS, then
-		  lists all files that don't match those patterns.
+		  Files are classified with git check-attr, so every .gitattributes file and
+		  $GIT_DIR/info/attributes is honored.
+
+		  Only files in the index, committed or staged, are listed, since only they
+		  are subject to LFS decisions. --include-untracked adds the untracked files
+		  a 'git add -A' would stage; files ignored by .gitignore,
+		  $GIT_DIR/info/exclude or core.excludesFile, such as build artifacts and
+		  node_modules, stay out unless --respect-gitignore=false is given too.
+
+		  The classification of the HEAD tree is cached in .git/lfs-scripts/inventory.json
+		  and shared with 'git lfs-files --name-only'. When HEAD moves, only the changed
+		  paths are reclassified; staged, unstaged and untracked changes are applied on
+		  every run. Changing any attributes file rebuilds the cache.
+
+		  With --suggest, non-LFS files are grouped by extension and classified as
+		  binary or text. Binary extensions exceeding either size threshold are listed
+		  with their file count, total size and largest file, followed by ready-to-run
+		  'git lfs-track' commands. Sizes accept K, M, G and T suffixes.
+
+		  With --history, every blob reachable from HEAD (or, with --all-refs,
+		  from any branch, tag or remote-tracking branch) is checked instead. Blobs
+		  of at least --min-size that are no longer in the tree of any scanned ref
+		  are listed, largest first, with the commit and path that added them.
+		  These blobs are invisible in the working tree, yet every clone still
+		  downloads them; only a history-rewriting migration removes them.
+
+		  With --mismatched, the files of HEAD are compared with the LFS patterns
+		  in effect now: files that match a pattern but are committed as regular
+		  Git blobs, because the pattern was tracked after they were committed,
+		  and files committed as pointers that no pattern matches any more, which
+		  check out as pointer text. Both are listed with the commands that fix
+		  them, and the exit status is 1, so it can guard CI.
 
 		  Requires:
 		    - Git repository
-		    - find command (standard on Unix/Linux/macOS)
 
 		EXAMPLES:
 		  # List all non-LFS files
 		  git nonlfs
 
+		  # Include new files that are not staged yet
+		  git nonlfs --include-untracked
+
 		  # Count non-LFS files
 		  git nonlfs | wc -l
 
-		  # Find large non-LFS files
-		  git nonlfs | xargs du -h | sort -hr | head -10
-	`))
-}
-
-func getAllFiles() ([]string, error) {
-	var files []string
+		  # Find large non-LFS files, whatever characters their names hold
+		  git nonlfs -z | xargs -0 du -h | sort -hr | head -10
 
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
-		// Only include files, not directories
-		if !info.IsDir() {
-			// Remove leading "./"
-			cleanPath := strings.TrimPrefix(path, "./")
-			files = append(files, cleanPath)
-		}
-
-		return nil
-	})
-
-	return files, err
-}
-
-func getLFSPatterns() ([]string, error) {
-	file, err := os.Open(".gitattributes")
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil // No .gitattributes file
-		}
-		return nil, err
-	}
-	defer file.Close()
-
-	var patterns []string
-	scanner := bufio.NewScanner(file)
+		  # Plan a migration of a legacy repository
+		  git nonlfs --suggest --min-total 50M --min-file 5M
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+		  # Find files that were committed before their pattern was tracked
+		  git nonlfs --mismatched
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Parse lines like "*.pdf filter=lfs diff=lfs merge=lfs -text"
-		fields := strings.Fields(line)
-		if len(fields) > 0 && strings.Contains(line, "filter=lfs") {
-			patterns = append(patterns, fields[0])
-		}
-	}
-
-	return patterns, scanner.Err()
-}
-
-func findMatchingFiles(pattern string) ([]string, error) {
-	// Use find command to locate files matching the pattern
-	cmd := exec.Command("find", ".", "-name", pattern, "-type", "f")
-	output, err := cmd.Output()
-	if err != nil {
-		return []string{}, nil
-	}
-
-	var files []string
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		path := strings.TrimPrefix(scanner.Text(), "./")
-		files = append(files, path)
-	}
-
-	return files, nil
+		  # Decide whether a history-rewriting migration is warranted
+		  git nonlfs --history --all-refs --min-size 5M
+	`))
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/inventory"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// maxFixPaths is how many paths a suggested fix command names; with more,
+// the command is shown with a placeholder
+const maxFixPaths = 20
+
+// reportMismatched lists the files of HEAD whose storage disagrees with
+// their filter attribute, with commands to fix them. It returns whether any
+// were found.
+func reportMismatched(files []inventory.File) bool {
+	lfs := make(map[string]bool, len(files))
+	for _, file := range files {
+		if !file.Untracked {
+			lfs[file.Path] = file.LFS
+		}
+	}
+	mismatched, err := lfsfiles.Mismatched(lfs)
+	if err != nil {
+		common.PrintError("Failed to compare HEAD with the LFS patterns: %v", err)
+	}
+
+	var blobs, pointers []lfsfiles.MismatchedFile
+	for _, file := range mismatched {
+		if file.Pointer {
+			pointers = append(pointers, file)
+		} else {
+			blobs = append(blobs, file)
+		}
+	}
+	if len(mismatched) == 0 {
+		fmt.Println("Every committed file matches its LFS pattern.")
+		return false
+	}
+
+	if len(blobs) > 0 {
+		n := len(blobs)
+		fmt.Printf("⚠ %d %s an LFS pattern but %s committed as regular Git blobs,\n",
+			n, common.Plural(n, "file matches", "files match"), common.Plural(n, "is", "are"))
+		fmt.Println("  because the pattern was tracked after they were committed:")
+		paths := listMismatched(blobs)
+		fmt.Println("Move them into Git LFS without rewriting history with either:")
+		fmt.Printf("  git add --renormalize -- %s  # staged, to commit yourself\n", fixPaths(paths))
+		fmt.Printf("  git lfs migrate import --no-rewrite %s  # in a new commit\n", fixPaths(paths))
+	}
+
+	if len(pointers) > 0 {
+		if len(blobs) > 0 {
+			fmt.Println()
+		}
+		n := len(pointers)
+		fmt.Printf("⚠ %d %s no LFS pattern but %s committed as LFS pointers,\n",
+			n, common.Plural(n, "file matches", "files match"), common.Plural(n, "is", "are"))
+		fmt.Println("  because the pattern was untracked without converting them; they check")
+		fmt.Println("  out as pointer text:")
+		paths := listMismatched(pointers)
+		fmt.Println("Keep them in Git LFS by tracking them again:")
+		fmt.Printf("  git lfs-track %s\n", strings.Join(extensions(paths), " "))
+		fmt.Println("or move their content back into Git, which also untracks them:")
+		fmt.Printf("  git unmigrate %s\n", strings.Join(extensions(paths), " "))
+	}
+	return true
+}
+
+// listMismatched prints the files with their size and returns their paths
+func listMismatched(files []lfsfiles.MismatchedFile) []string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		fmt.Printf("  %10s  %s\n", common.FormatSize(file.Size), file.Path)
+		paths[i] = file.Path
+	}
+	return paths
+}
+
+// fixPaths quotes paths for a suggested command, or gives a placeholder
+// when there are too many to paste
+func fixPaths(paths []string) string {
+	if len(paths) > maxFixPaths {
+		return "PATH ..."
+	}
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = common.ShellQuote(p)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// extensions returns the distinct extensions of paths, without the dot,
+// as git lfs-track and git unmigrate take them; PATTERN when a path has none
+func extensions(paths []string) []string {
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		ext := strings.TrimPrefix(path.Ext(p), ".")
+		if ext == "" {
+			ext = "PATTERN"
+		}
+		seen[ext] = true
+	}
+	result := make([]string, 0, len(seen))
+	for ext := range seen {
+		result = append(result, ext)
+	}
+	sort.Strings(result)
+	return result
+}
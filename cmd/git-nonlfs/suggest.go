@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// suggestTracking groups non-LFS files by extension and prints git lfs-track
+// commands for binary extensions whose aggregate or largest file size exceeds
+// the thresholds
+func suggestTracking(files []string, minTotal, minFile int64) {
+	stats, noExtension := lfsfiles.GroupByExtension(files)
+
+	var candidates []*lfsfiles.ExtensionStats
+	for _, s := range stats {
+		if !s.MostlyBinary() {
+			continue // Mostly text; Git handles text well
+		}
+		if s.TotalSize >= minTotal || s.Largest >= minFile {
+			candidates = append(candidates, s)
+		}
+	}
+
+	if len(candidates) == 0 {
+		fmt.Printf("No binary extensions exceed the thresholds (total %s, largest file %s).\n",
+			common.FormatSize(minTotal), common.FormatSize(minFile))
+		return
+	}
+
+	fmt.Println("Suggested LFS tracking candidates (non-LFS files grouped by extension):")
+	fmt.Println()
+	fmt.Printf("  %-10s %7s %12s %12s\n", "EXTENSION", "FILES", "TOTAL", "LARGEST")
+	for _, s := range candidates {
+		fmt.Printf("  %-10s %7d %12s %12s\n", s.Ext, s.Files, common.FormatSize(s.TotalSize), common.FormatSize(s.Largest))
+	}
+
+	fmt.Println()
+	fmt.Println("Run these commands to track them:")
+	for _, s := range candidates {
+		flags := "-e"
+		if s.MixedCases {
+			flags = "-ce"
+		}
+		fmt.Printf("  git lfs-track %s %s\n", flags, s.Ext)
+	}
+	fmt.Println("Or track them all at once with: git lfs-track --auto")
+
+	if noExtension > 0 {
+		fmt.Println()
+		fmt.Printf("Note: %d non-LFS files have no extension and were not analyzed.\n", noExtension)
+	}
+}
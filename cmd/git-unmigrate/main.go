@@ -8,17 +8,29 @@ import (
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
 	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
 	flag "github.com/spf13/pflag"
 )
 
 func main() {
-	var bothCases, dryRun, everywhere, showHelp bool
+	var bothCases, allCases, dryRun, everywhere, deleteEmpty, installMissing, showHelp bool
+	var excepts []string
 
 	flag.BoolVarP(&bothCases, "case", "c", false, "Expand pattern to upper and lower case")
+	flag.BoolVar(&allCases, "all-cases", false, "Expand pattern to match every case combination")
 	flag.BoolVarP(&dryRun, "dry-run", "d", false, "Dry run")
 	flag.BoolVarP(&everywhere, "everywhere", "e", false, "Apply pattern everywhere")
+	flag.BoolVar(&deleteEmpty, "delete-empty", false, "Delete .gitattributes files left without attributes")
+	flag.StringArrayVar(&excepts, "except", nil, "Keep matching files below this glob in Git LFS (repeatable)")
+	flag.BoolVar(&installMissing, "install-missing", false, "Install missing Git and Git LFS packages")
 	flag.BoolVarP(&showHelp, "help", "h", false, "Show help")
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddNetworkFlags(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "git-unmigrate")
+	completion.Handle(completion.Command{Name: "git-unmigrate", Flags: flag.CommandLine, Args: completion.ArgExtension})
 	flag.Parse()
 
 	if showHelp {
@@ -26,19 +38,24 @@ func main() {
 		os.Exit(0)
 	}
 
-	patterns := flag.Args()
+	patterns, err := lfsfiles.ExpandPresets(flag.Args())
+	if err != nil {
+		common.PrintError("%v", err)
+	}
 	if len(patterns) == 0 {
 		printHelp()
 		os.Exit(1)
 	}
+	common.SetDryRun(dryRun)
+	dryRun = common.DryRun
 
-	// Check if we're in a git repository
-	if err := common.CheckGitRepo(); err != nil {
+	// Check that git and git-lfs are installed
+	if err := prereq.Ensure(installMissing, prereq.Git, prereq.GitLFS); err != nil {
 		common.PrintError("%v", err)
 	}
 
-	// Check if git-lfs is installed
-	if err := common.CheckLFSInstalled(); err != nil {
+	// Check if we're in a git repository
+	if err := common.CheckGitRepo(); err != nil {
 		common.PrintError("%v", err)
 	}
 
@@ -49,56 +66,130 @@ func main() {
 
 	opts := lfsfiles.Options{
 		BothCases:  bothCases,
+		AllCases:   allCases,
 		DryRun:     dryRun,
 		Everywhere: everywhere,
 		Command:    "git lfs untrack",
 	}
 
-	// If dry run, just show what would be done
-	if dryRun {
-		for _, pattern := range patterns {
-			expanded := lfsfiles.ExpandPattern(pattern, opts)
-			fmt.Printf("DRY RUN: git lfs untrack %s\n", strings.Join(expanded, " "))
+	warnings := lfsfiles.CheckPatterns(patterns, opts)
+	for _, except := range excepts {
+		for _, warning := range lfsfiles.PatternWarnings(except) {
+			warnings = append(warnings, fmt.Sprintf("--except '%s': %s", except, warning))
 		}
-		fmt.Println("DRY RUN: git add --renormalize .")
-		fmt.Printf("DRY RUN: git commit -m \"Restore patterns to Git from Git LFS\"\n")
-		fmt.Println("DRY RUN: git push")
-		os.Exit(0)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
 
-	// Untrack patterns from LFS
+	audit := common.StartAudit("git-unmigrate", dryRun)
+
+	// Patterns that keep the --except subtrees in LFS after untracking
+	var allExpanded []string
 	for _, pattern := range patterns {
-		expanded := lfsfiles.ExpandPattern(pattern, opts)
-		args := append([]string{"lfs", "untrack"}, expanded...)
+		allExpanded = append(allExpanded, lfsfiles.ExpandPattern(pattern, opts)...)
+	}
+	exceptions := lfsfiles.ExceptionPatterns(allExpanded, excepts)
 
-		cmd := exec.Command("git", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	// In dry-run mode common.Run prints each command instead of running it,
+	// and those lines are the only output
+	progress := func(message string) {
+		if !dryRun {
+			fmt.Println(message)
+		}
+	}
 
-		if err := cmd.Run(); err != nil {
+	for _, pattern := range patterns {
+		expanded := lfsfiles.EscapeAttributesPatterns(lfsfiles.ExpandPattern(pattern, opts))
+		if err := common.RunCommand("git", append([]string{"lfs", "untrack"}, expanded...)...); err != nil {
 			common.PrintError("Failed to untrack pattern %s: %v", pattern, err)
 		}
 	}
 
-	// Renormalize and commit
-	fmt.Println("Renormalizing files...")
-	if err := runGitCommand("add", "--renormalize", "."); err != nil {
+	// Later .gitattributes lines take precedence, so the exceptions appended
+	// by git lfs track override the untracked patterns for those subtrees
+	if len(exceptions) > 0 {
+		progress("Keeping exceptions in Git LFS...")
+		if err := common.RunCommand("git", append([]string{"lfs", "track"}, lfsfiles.EscapeAttributesPatterns(exceptions)...)...); err != nil {
+			common.PrintError("Failed to track exceptions: %v", err)
+		}
+	}
+
+	// git lfs untrack only edits the top-level .gitattributes and leaves
+	// duplicates and emptied entries behind
+	cleanups, err := lfsfiles.CleanAttributesFiles(allExpanded, everywhere, deleteEmpty, dryRun)
+	if err != nil {
+		common.PrintError("Failed to clean up .gitattributes: %v", err)
+	}
+	for _, cleanup := range cleanups {
+		if deleteEmpty && cleanup.Empty {
+			progress(fmt.Sprintf("Deleted %s, which has no attributes left", cleanup.Path))
+		} else {
+			progress(fmt.Sprintf("Removed %d stale lines from %s", len(cleanup.Removed), cleanup.Path))
+		}
+	}
+
+	if !dryRun {
+		audit.Changed(".gitattributes")
+		for _, cleanup := range cleanups {
+			if cleanup.Path != ".gitattributes" {
+				audit.Changed(cleanup.Path)
+			}
+		}
+	}
+
+	// The pointers of HEAD are what the restored files must match
+	var before []lfspointer.Pointer
+	var top string
+	if !dryRun {
+		if before, err = lfspointer.ListTree("HEAD"); err != nil {
+			common.PrintError("Failed to list the LFS files of HEAD: %v", err)
+		}
+		output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+		if err != nil {
+			common.PrintError("Failed to find the top of the working tree: %v", err)
+		}
+		top = strings.TrimSpace(string(output))
+	}
+
+	// Renormalize, verify and commit
+	progress("Renormalizing files...")
+	if err := common.RunCommand("git", "add", "--renormalize", "."); err != nil {
 		common.PrintError("Failed to renormalize: %v", err)
 	}
 
-	commitMsg := fmt.Sprintf("Restore patterns to Git from Git LFS")
-	fmt.Printf("Committing changes...\n")
-	if err := runGitCommand("commit", "-m", commitMsg); err != nil {
+	if !dryRun {
+		progress("Verifying restored files against their LFS objects...")
+		v, err := verifyRestored(top, before)
+		if err != nil {
+			common.PrintError("Failed to verify the restored files: %v", err)
+		}
+		if len(v.Mismatches) > 0 {
+			for _, m := range v.Mismatches {
+				fmt.Fprintf(os.Stderr, "  ✗ %s: %s\n", m.Path, m.Reason)
+			}
+			err := fmt.Errorf("%d of the restored files differ from their LFS objects", len(v.Mismatches))
+			audit.Finish(err)
+			common.PrintError("%v. Nothing was committed or pushed; the changes are staged. "+
+				"Fix the files listed above and run git unmigrate again, or undo everything with 'git reset --hard'", err)
+		}
+		progress(fmt.Sprintf("✓ %d restored files match their LFS objects", v.Restored))
+	}
+
+	progress("Committing changes...")
+	if err := common.RunCommand("git", "commit", "-m", "Restore patterns to Git from Git LFS"); err != nil {
 		// It's ok if there's nothing to commit
 		fmt.Println("No changes to commit")
 	}
 
-	fmt.Println("Pushing changes...")
-	if err := runGitCommand("push"); err != nil {
-		common.PrintError("Failed to push: %v", err)
+	progress("Pushing changes...")
+	if err := common.RunNetwork("git", "push"); err != nil {
+		audit.Finish(err)
+		common.PrintError("Failed to push: %v. The changes are committed; push them with 'git push'", err)
 	}
 
-	fmt.Println("Unmigration complete!")
+	audit.Finish(nil)
+	progress("Unmigration complete!")
 }
 
 func printHelp() {
@@ -110,18 +201,39 @@ func printHelp() {
 
 		OPTIONS:
 		  -c  Expand pattern to upper and lower case, helpful for media files
+		  --all-cases  Expand pattern to match every case combination, e.g. Mp3 and mP3
 		  -d  Dry run (display filename patterns that would be affected)
 		  -e  Apply the pattern everywhere (all directories in the Git repository)
 		  -h  Show this help message
+		  --version  Show the version, commit and build date
+		  --trace  Print every external command before running it
+		  --timeout DURATION  Stop the push if it takes longer, e.g. 30m (default: no limit)
+		  --retries N  Retry a failed push N times (default: 2)
+		  --except GLOB  Keep files below GLOB in Git LFS (repeatable), e.g. 'archive/**'
+		  --delete-empty  Delete .gitattributes files left without any attributes
+		  --install-missing  Install missing Git and Git LFS packages
 
 		DESCRIPTION:
 		  This command reverses 'git lfs migrate import' by moving files back to regular
 		  Git tracking. By default, only files in the current directory matching the
 		  specified patterns are processed.
 
+		  After untracking, stale .gitattributes lines are removed: Git LFS lines of
+		  the untracked patterns, patterns left without attributes, and repeated
+		  lines. With -e, nested .gitattributes files are cleaned as well. With
+		  --delete-empty, a .gitattributes file left with only comments is deleted.
+
+		  After renormalizing, every restored file is hashed and compared to the
+		  oid and size of the pointer it replaces. A file that differs, or that
+		  still holds its pointer because the object was never downloaded, is
+		  listed and the command stops before committing or pushing.
+
 		  This process does NOT rewrite Git history, so other Git users will not need
 		  to re-clone the repository after this process concludes.
 
+		  A PATTERN of the form @NAME stands for every extension of a preset, such
+		  as @video or @images; 'git lfs-track --help' lists them.
+
 		  Note: This process might take a long time if you have many large files to
 		  unmigrate back to Git.
 
@@ -143,6 +255,10 @@ func printHelp() {
 		  git unmigrate -dc mp3
 		  # Output: DRY RUN: git lfs untrack *.mp3 *.MP3
 
+		  # Unmigrate files tracked with 'git lfs-track --all-cases mp3'
+		  git unmigrate -d --all-cases mp3
+		  # Output: DRY RUN: git lfs untrack *.[mM][pP]3
+
 		  # Apply everywhere in repository
 		  git unmigrate -de zip
 		  # Output: DRY RUN: git lfs untrack *.zip **/*.zip
@@ -151,6 +267,17 @@ func printHelp() {
 		  git unmigrate -dce mp3
 		  # Output: DRY RUN: git lfs untrack *.mp3 *.MP3 **/*.mp3 **/*.MP3
 
+		  # Unmigrate every audio format
+		  git unmigrate -dce @audio
+
+		  # Unmigrate everywhere except below archive/, which stays in LFS
+		  git unmigrate -de psd --except 'archive/**'
+		  # Output: DRY RUN: git lfs untrack *.psd **/*.psd
+		  #         DRY RUN: git lfs track archive/**/*.psd
+
+		  # Unmigrate everywhere, deleting nested .gitattributes files that end up empty
+		  git unmigrate -e --delete-empty psd
+
 		  # Actually unmigrate (remove -d flag)
 		  git unmigrate zip
 
@@ -158,10 +285,3 @@ func printHelp() {
 		  git-ls-files, git-lfs-track, git-lfs-untrack
 	`))
 }
-
-func runGitCommand(args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
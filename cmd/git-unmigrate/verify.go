@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// mismatch is a restored file whose staged content is not the LFS object
+// its pointer referenced
+type mismatch struct {
+	Path   string
+	Reason string
+}
+
+// verification is the result of comparing restored files to their pointers
+type verification struct {
+	Restored   int // Files staged with their content instead of a pointer
+	Mismatches []mismatch
+}
+
+// stagedBlobs returns the blob id of every file in the index of the
+// working tree at top, by path
+func stagedBlobs(top string) (map[string]string, error) {
+	cmd := exec.Command("git", "ls-files", "--stage", "-z")
+	cmd.Dir = top
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %v", err)
+	}
+	blobs := make(map[string]string)
+	for _, entry := range strings.Split(string(output), "\x00") {
+		// MODE SP BLOB SP STAGE TAB PATH
+		info, path, found := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !found || len(fields) != 3 {
+			continue
+		}
+		blobs[path] = fields[1]
+	}
+	return blobs, nil
+}
+
+// lfsTracked returns the paths below top that still have filter=lfs
+func lfsTracked(top string, paths []string) (map[string]bool, error) {
+	lfs := make(map[string]bool)
+	if len(paths) == 0 {
+		return lfs, nil
+	}
+	cmd := exec.Command("git", "check-attr", "-z", "--stdin", "filter")
+	cmd.Dir = top
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git check-attr failed: %v", err)
+	}
+	// Output records: PATH NUL ATTRIBUTE NUL VALUE NUL
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == "lfs" {
+			lfs[fields[i]] = true
+		}
+	}
+	return lfs, nil
+}
+
+// verifyRestored hashes the staged content of every file in the working
+// tree at top that was a pointer before renormalizing and no longer has
+// filter=lfs, and compares it to the oid and size of that pointer
+func verifyRestored(top string, before []lfspointer.Pointer) (verification, error) {
+	var v verification
+	blobs, err := stagedBlobs(top)
+	if err != nil {
+		return v, err
+	}
+	var paths []string
+	for _, pointer := range before {
+		if _, staged := blobs[pointer.Path]; staged {
+			paths = append(paths, pointer.Path)
+		}
+	}
+	tracked, err := lfsTracked(top, paths)
+	if err != nil {
+		return v, err
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = top
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return v, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return v, err
+	}
+	if err := cmd.Start(); err != nil {
+		return v, fmt.Errorf("git cat-file failed: %v", err)
+	}
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+	reader := bufio.NewReader(stdout)
+
+	for _, pointer := range before {
+		blob, staged := blobs[pointer.Path]
+		if !staged || tracked[pointer.Path] {
+			continue // Deleted, or still in Git LFS
+		}
+
+		// One blob at a time, so that large contents are streamed
+		if _, err := fmt.Fprintln(stdin, blob); err != nil {
+			return v, fmt.Errorf("git cat-file failed: %v", err)
+		}
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return v, fmt.Errorf("unexpected end of git cat-file output")
+		}
+		// Header: OBJECT SP TYPE SP SIZE, or OBJECT SP missing
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			v.Mismatches = append(v.Mismatches, mismatch{pointer.Path, "the staged blob is missing"})
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid git cat-file header: %s", strings.TrimSpace(header))
+		}
+
+		hash := sha256.New()
+		var head bytes.Buffer // The start of the content, to recognize pointers
+		if _, err := io.CopyN(io.MultiWriter(hash, &limitedBuffer{&head, lfspointer.MaxPointerSize + 1}), reader, size); err != nil {
+			return v, fmt.Errorf("failed to read blob %s: %v", blob, err)
+		}
+		if _, err := reader.Discard(1); err != nil { // Content is followed by a newline
+			return v, fmt.Errorf("failed to read blob %s: %v", blob, err)
+		}
+
+		if _, ok := lfspointer.Parse(head.Bytes()); ok {
+			v.Mismatches = append(v.Mismatches, mismatch{pointer.Path, "the pointer itself was staged as the content; " +
+				"the object was never downloaded, run 'git lfs pull' first"})
+			continue
+		}
+
+		v.Restored++
+		oid := hex.EncodeToString(hash.Sum(nil))
+		switch {
+		case size != pointer.Size:
+			v.Mismatches = append(v.Mismatches, mismatch{pointer.Path,
+				fmt.Sprintf("%d bytes staged, the LFS object has %d", size, pointer.Size)})
+		case oid != pointer.OID:
+			v.Mismatches = append(v.Mismatches, mismatch{pointer.Path,
+				fmt.Sprintf("sha256 %s, the LFS object is %s", oid[:12], pointer.OID[:12])})
+		}
+	}
+	return v, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.max - l.buf.Len(); room > 0 {
+		l.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
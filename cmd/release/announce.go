@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// AnnouncePolicy says where the changelog excerpt of a release is published
+// after GoReleaser succeeds, configured in .release.json:
+//
+//	{"announce": {"release_body": true, "discussion": "Announcements",
+//	              "webhooks": [{"format": "slack", "url_env": "SLACK_WEBHOOK_URL"}]}}
+type AnnouncePolicy struct {
+	ReleaseBody bool      `json:"release_body"` // Put the excerpt above GoReleaser's notes
+	Discussion  string    `json:"discussion"`   // Discussion category to announce in
+	Webhooks    []Webhook `json:"webhooks"`
+}
+
+// Webhook is a Slack, Discord or generic JSON incoming webhook. Webhook URLs
+// are secrets, so they are normally read from an environment variable.
+type Webhook struct {
+	Format string `json:"format"`  // slack, discord or json (default: json)
+	URL    string `json:"url"`     // Webhook URL
+	URLEnv string `json:"url_env"` // Environment variable holding the URL
+}
+
+// enabled reports whether .release.json asks for any announcement
+func (p AnnouncePolicy) enabled() bool {
+	return p.ReleaseBody || p.Discussion != "" || len(p.Webhooks) > 0
+}
+
+// announcement is what is published about a release
+type announcement struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+	Tag     string `json:"tag"`
+	URL     string `json:"url"`
+	Notes   string `json:"notes"`
+}
+
+// announceRelease publishes the changelog excerpt of version everywhere the
+// policy asks. The release already exists, so each failure is only reported
+// and the remaining channels are still tried.
+func announceRelease(target releaseTarget, version string, policy AnnouncePolicy) {
+	repo, err := githubRepo()
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot determine the GitHub repository: %v", err))
+	}
+	content, err := os.ReadFile(target.changelog)
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot read %s: %v", target.changelog, err))
+	}
+	notes := changelogExcerpt(string(content), version)
+	if notes == "" {
+		warning(fmt.Sprintf("%s has no section for %s; nothing to announce", target.changelog, version))
+		return
+	}
+
+	tag := target.tag(version)
+	a := announcement{
+		Title:   fmt.Sprintf("%s %s", target.label(), tag),
+		Version: version,
+		Tag:     tag,
+		URL:     fmt.Sprintf("https://github.com/%s/releases/tag/%s", repo, tag),
+		Notes:   notes,
+	}
+
+	if policy.ReleaseBody {
+		if err := updateReleaseBody(repo, a); err != nil {
+			warning(fmt.Sprintf("Release notes not added to the GitHub release: %v", err))
+		} else {
+			success("Release notes added to the GitHub release")
+		}
+	}
+	if policy.Discussion != "" {
+		body := fmt.Sprintf("%s\n\n[Download %s](%s)\n", a.Notes, a.Tag, a.URL)
+		if url, err := github.CreateDiscussion(repo, policy.Discussion, a.Title, body); err != nil {
+			warning(fmt.Sprintf("Discussion not created: %v", err))
+		} else {
+			success(fmt.Sprintf("Announced in discussion %s", url))
+		}
+	}
+	for _, hook := range policy.Webhooks {
+		if err := postWebhook(hook, a); err != nil {
+			warning(fmt.Sprintf("%s webhook failed: %v", hook.format(), err))
+		} else {
+			success(fmt.Sprintf("Announced via %s webhook", hook.format()))
+		}
+	}
+}
+
+// updateReleaseBody puts the notes above GoReleaser's generated body, once
+func updateReleaseBody(repo string, a announcement) error {
+	release, err := github.ReleaseByTag(repo, a.Tag)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(release.Body, a.Notes) {
+		return nil
+	}
+	body := a.Notes
+	if strings.TrimSpace(release.Body) != "" {
+		body += "\n\n" + release.Body
+	}
+	return github.SetReleaseBody(repo, release.ID, body)
+}
+
+// changelogExcerpt returns the body of the CHANGELOG.md section whose
+// heading mentions version, up to the next heading of the same or a higher
+// level; "" when there is no such section
+func changelogExcerpt(changelog, version string) string {
+	lines := strings.Split(changelog, "\n")
+	level := 0
+	var excerpt []string
+	for _, line := range lines {
+		depth := len(line) - len(strings.TrimLeft(line, "#"))
+		isHeading := depth > 0 && strings.HasPrefix(line[depth:], " ")
+		if level == 0 {
+			if isHeading && mentionsVersion(line, version) {
+				level = depth
+			}
+			continue
+		}
+		if isHeading && depth <= level {
+			break
+		}
+		excerpt = append(excerpt, line)
+	}
+	return strings.TrimSpace(strings.Join(excerpt, "\n"))
+}
+
+// mentionsVersion reports whether a heading names version as a whole word,
+// so 1.2.1 does not match the heading of 1.2.10
+func mentionsVersion(heading, version string) bool {
+	for _, word := range strings.FieldsFunc(heading, func(r rune) bool {
+		return r == ' ' || r == '[' || r == ']' || r == '/' || r == '(' || r == ')'
+	}) {
+		if strings.TrimPrefix(word, "v") == version {
+			return true
+		}
+	}
+	return false
+}
+
+// format returns the webhook's payload format
+func (w Webhook) format() string {
+	if w.Format == "" {
+		return "json"
+	}
+	return w.Format
+}
+
+// postWebhook sends the announcement in the webhook's format
+func postWebhook(hook Webhook, a announcement) error {
+	url := hook.URL
+	if hook.URLEnv != "" {
+		url = os.Getenv(hook.URLEnv)
+		if url == "" {
+			return fmt.Errorf("%s is not set", hook.URLEnv)
+		}
+	}
+	if url == "" {
+		return fmt.Errorf("no url or url_env configured")
+	}
+
+	text := fmt.Sprintf("%s released\n%s\n\n%s", a.Title, a.URL, a.Notes)
+	var payload interface{}
+	switch hook.format() {
+	case "slack":
+		payload = map[string]string{"text": text}
+	case "discord":
+		// Discord rejects messages over 2000 characters
+		if runes := []rune(text); len(runes) > 2000 {
+			text = string(runes[:1996]) + "\n..."
+		}
+		payload = map[string]string{"content": text}
+	case "json":
+		payload = a
+	default:
+		return fmt.Errorf("unknown format '%s' (use slack, discord or json)", hook.Format)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Component is a separately versioned part of the repository, configured in
+// .release.json:
+//
+//	{"components": {"trace": {"dir": "cmd/git-lfs-trace", "goreleaser": ".goreleaser-trace.yml"}}}
+type Component struct {
+	Dir        string `json:"dir"`        // Holds the component's VERSION and CHANGELOG.md
+	GoReleaser string `json:"goreleaser"` // GoReleaser config file (default: DIR/.goreleaser.yml)
+	TagPrefix  string `json:"tag_prefix"` // Prefix of the component's tags (default: NAME/)
+}
+
+// releaseTarget is what a release versions, tags and publishes: the whole
+// repository, or one component
+type releaseTarget struct {
+	name             string // Component name; empty for the whole repository
+	versionFile      string
+	changelog        string
+	tagPrefix        string
+	goreleaserConfig string // Empty for GoReleaser's default
+}
+
+// componentName is restricted so it can be used in tags and file names
+var componentName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// resolveTarget returns the release target for a component name, or the
+// whole repository when name is empty
+func resolveTarget(config ReleaseConfig, name string) (releaseTarget, error) {
+	if name == "" {
+		return releaseTarget{versionFile: "VERSION", changelog: "CHANGELOG.md"}, nil
+	}
+
+	component, ok := config.Components[name]
+	if !ok {
+		known := make([]string, 0, len(config.Components))
+		for n := range config.Components {
+			known = append(known, n)
+		}
+		sort.Strings(known)
+		if len(known) == 0 {
+			return releaseTarget{}, fmt.Errorf("unknown component '%s': %s defines no components", name, releaseConfigFile)
+		}
+		return releaseTarget{}, fmt.Errorf("unknown component '%s' (configured: %s)", name, strings.Join(known, ", "))
+	}
+	if !componentName.MatchString(name) {
+		return releaseTarget{}, fmt.Errorf("invalid component name '%s'", name)
+	}
+	if component.Dir == "" {
+		return releaseTarget{}, fmt.Errorf("component '%s' in %s has no dir", name, releaseConfigFile)
+	}
+
+	target := releaseTarget{
+		name:             name,
+		versionFile:      filepath.Join(component.Dir, "VERSION"),
+		changelog:        filepath.Join(component.Dir, "CHANGELOG.md"),
+		tagPrefix:        component.TagPrefix,
+		goreleaserConfig: component.GoReleaser,
+	}
+	if target.tagPrefix == "" {
+		target.tagPrefix = name + "/"
+	}
+	if target.goreleaserConfig == "" {
+		target.goreleaserConfig = filepath.Join(component.Dir, ".goreleaser.yml")
+	}
+	return target, nil
+}
+
+// tag returns the tag of a version, e.g. trace/v1.2.0
+func (t releaseTarget) tag(version string) string {
+	return t.tagPrefix + "v" + version
+}
+
+// label names the target in messages
+func (t releaseTarget) label() string {
+	if t.name == "" {
+		return "Git LFS Scripts"
+	}
+	return "Git LFS Scripts " + t.name
+}
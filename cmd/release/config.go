@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// releaseConfigFile holds optional release settings, committed at the repository root
+const releaseConfigFile = ".release.json"
+
+// ReleaseConfig holds settings read from .release.json
+type ReleaseConfig struct {
+	Licenses   LicensePolicy        `json:"licenses"`
+	Components map[string]Component `json:"components"`
+	Signoff    SignoffPolicy        `json:"signoff"`
+	Announce   AnnouncePolicy       `json:"announce"`
+	Tests      TestPolicy           `json:"tests"`
+}
+
+// LicensePolicy lists the SPDX license identifiers that dependencies may use
+type LicensePolicy struct {
+	Allowed []string `json:"allowed"`
+}
+
+// defaultConfig returns the settings used when .release.json is absent
+func defaultConfig() ReleaseConfig {
+	return ReleaseConfig{
+		Licenses: LicensePolicy{
+			Allowed: []string{"Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC", "MIT", "MPL-2.0"},
+		},
+	}
+}
+
+// loadConfig reads .release.json, falling back to defaults for missing settings
+func loadConfig() (ReleaseConfig, error) {
+	config := defaultConfig()
+
+	data, err := os.ReadFile(releaseConfigFile)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read %s: %v", releaseConfigFile, err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %v", releaseConfigFile, err)
+	}
+	return config, nil
+}
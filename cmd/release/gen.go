@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/manpage"
+)
+
+// assetsDir receives what 'release gen' generates; GoReleaser attaches the
+// SBOM and the two tarballs to the release and puts the completion scripts
+// and man pages into every archive
+var assetsDir = filepath.Join(buildDir, "release-assets")
+
+const (
+	sbomFile        = "sbom.spdx.json"
+	completionsFile = "completions.tar.gz"
+	manFile         = "man.tar.gz"
+)
+
+// completionFiles names the completion script of a command as each shell's
+// completion directory expects it
+var completionFiles = map[string]string{
+	"bash":       "%s",
+	"zsh":        "_%s",
+	"fish":       "%s.fish",
+	"powershell": "%s.ps1",
+}
+
+// spdxIDInvalid matches the characters SPDX identifiers cannot contain
+var spdxIDInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// generateAssets builds every command and writes their completion scripts
+// and man pages, and an SPDX SBOM of the modules compiled into them, to
+// assetsDir. Timestamps come from the last commit, so that generating the
+// assets of a version again gives the same files.
+func generateAssets(version string) {
+	info(fmt.Sprintf("Generating release assets for %s in %s...", version, assetsDir))
+	released, err := releaseTime()
+	if err != nil {
+		errorExit(err.Error())
+	}
+	names, err := commandNames()
+	if err != nil {
+		errorExit(err.Error())
+	}
+
+	binDir, err := os.MkdirTemp("", "release-gen")
+	if err != nil {
+		errorExit(err.Error())
+	}
+	defer os.RemoveAll(binDir)
+	args := []string{"build", "-o", binDir + string(filepath.Separator)}
+	for _, name := range names {
+		args = append(args, "./cmd/"+name)
+	}
+	if output, err := runCommand("go", args...); err != nil {
+		errorExit(fmt.Sprintf("go build failed: %s", output))
+	}
+
+	if err := os.RemoveAll(assetsDir); err != nil {
+		errorExit(err.Error())
+	}
+	for _, name := range names {
+		binary := filepath.Join(binDir, name)
+		if err := writeCompletions(binary, name); err != nil {
+			errorExit(err.Error())
+		}
+		if err := writeManPage(binary, name, version, released); err != nil {
+			errorExit(err.Error())
+		}
+	}
+	for archive, dir := range map[string]string{completionsFile: "completions", manFile: "man"} {
+		if err := writeTarball(filepath.Join(assetsDir, archive), dir, released); err != nil {
+			errorExit(err.Error())
+		}
+	}
+	if err := writeSBOM(filepath.Join(assetsDir, sbomFile), version, released); err != nil {
+		errorExit(err.Error())
+	}
+	success(fmt.Sprintf("Completion scripts and man pages of %d commands, and %s, generated", len(names), sbomFile))
+}
+
+// commandNames returns the commands the release ships, one per cmd/git-* directory
+func commandNames() ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join("cmd", "git-*"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			names = append(names, filepath.Base(dir))
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no commands found in cmd/git-*; run release gen at the top of the repository")
+	}
+	return names, nil
+}
+
+// releaseTime returns the time of the last commit
+func releaseTime() (time.Time, error) {
+	output, err := runCommand("git", "log", "-1", "--format=%ct")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("git log failed: %s", output)
+	}
+	seconds, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected commit time '%s'", output)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// writeCompletions writes the completion script of a command for every shell
+func writeCompletions(binary, name string) error {
+	for _, shell := range completion.Shells {
+		output, err := exec.Command(binary, "completion", shell).Output()
+		if err != nil {
+			return fmt.Errorf("%s completion %s failed: %v", name, shell, err)
+		}
+		path := filepath.Join(assetsDir, "completions", shell, fmt.Sprintf(completionFiles[shell], name))
+		if err := writeAsset(path, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeManPage writes the man page of a command, converted from its --help
+func writeManPage(binary, name, version string, released time.Time) error {
+	// Some commands print their help to stderr
+	output, err := exec.Command(binary, "--help").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s --help failed: %v", name, err)
+	}
+	page, err := manpage.FromHelp(string(output), manpage.Page{
+		Section: "1",
+		Version: version,
+		Date:    released.Format("2006-01-02"),
+		Manual:  "Git LFS Scripts Manual",
+		Source:  "git_lfs_scripts",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return writeAsset(filepath.Join(assetsDir, "man", "man1", name+".1"), []byte(page))
+}
+
+func writeAsset(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// writeTarball packs the files below dir in assetsDir into a tar.gz at
+// path, sorted and stamped with modified, so the same files give the same
+// tarball
+func writeTarball(path, dir string, modified time.Time) error {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(assetsDir, dir), func(file string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			files = append(files, file)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(assetsDir, file)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    filepath.ToSlash(name),
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: modified,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// SPDX 2.3 document (https://spdx.github.io/spdx-spec/v2.3/), with the
+// fields a package-level SBOM needs
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// writeSBOM writes an SPDX SBOM listing the module of the commands and
+// every module compiled into them, with their licenses
+func writeSBOM(path, version string, created time.Time) error {
+	module, err := runCommand("go", "list", "-m")
+	if err != nil {
+		return fmt.Errorf("go list -m failed: %s", module)
+	}
+	deps, err := listDependencies()
+	if err != nil {
+		return err
+	}
+
+	root := dependency{path: module, version: "v" + strings.TrimPrefix(version, "v"), dir: "."}
+	detectLicense(&root)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s %s", module, root.version),
+		DocumentNamespace: fmt.Sprintf("https://%s/spdx/%s", module, root.version),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: git_lfs_scripts-release-gen"},
+		},
+		Packages: []spdxPackage{spdxPackageOf(root)},
+	}
+	rootID := doc.Packages[0].SPDXID
+	doc.Relationships = append(doc.Relationships, spdxRelationship{doc.SPDXID, "DESCRIBES", rootID})
+	for i := range deps {
+		detectLicense(&deps[i])
+		pkg := spdxPackageOf(deps[i])
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{rootID, "DEPENDS_ON", pkg.SPDXID})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAsset(path, append(data, '\n'))
+}
+
+// spdxPackageOf describes a Go module as an SPDX package with its purl
+func spdxPackageOf(dep dependency) spdxPackage {
+	license := dep.license
+	switch license {
+	case "", "Unknown", "GPL", "LGPL", "AGPL":
+		// Not SPDX identifiers: the GPL families do not name a version
+		license = "NOASSERTION"
+	}
+	return spdxPackage{
+		Name:             dep.path,
+		SPDXID:           "SPDXRef-Package-" + strings.Trim(spdxIDInvalid.ReplaceAllString(dep.path, "-"), "-"),
+		VersionInfo:      dep.version,
+		DownloadLocation: "NOASSERTION",
+		FilesAnalyzed:    false,
+		LicenseConcluded: license,
+		LicenseDeclared:  license,
+		CopyrightText:    "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  "pkg:golang/" + dep.path + "@" + dep.version,
+		}},
+	}
+}
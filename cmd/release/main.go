@@ -9,13 +9,21 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/changelog"
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/completion"
+	"github.com/mslinn/git_lfs_scripts/internal/forge"
 	flag "github.com/spf13/pflag"
 )
 
@@ -27,25 +35,101 @@ const (
 	colorBlue   = "\033[0;34m"
 )
 
+// stdin is shared by all prompts so buffered input is not lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
 type Options struct {
 	skipTests bool
 	debug     bool
+	sign      bool
+	tui       bool
+	restart   bool
+	draft     bool
+	component string
 }
 
 func main() {
 	opts := Options{}
-	flag.BoolVarP(&opts.skipTests, "skip-tests", "s", false, "Skip running tests")
+	flag.BoolVarP(&opts.skipTests, "skip-tests", "s", false, "Skip go vet, the tests and the coverage check (asks for confirmation)")
 	flag.BoolVarP(&opts.debug, "debug", "d", false, "Debug mode (additional output)")
+	flag.BoolVar(&opts.sign, "sign", false, "Sign the tag and checksums (GPG or SSH, per git config)")
+	flag.BoolVar(&opts.tui, "tui", false, "Show the release as an interactive checklist with retry and skip")
+	flag.BoolVar(&opts.restart, "restart", false, "Discard the progress of an unfinished release and start from the first step")
+	flag.BoolVar(&opts.draft, "draft", false, "Publish the GitHub release as a draft, made public later with 'release publish VERSION'")
+	flag.StringVarP(&opts.component, "component", "c", "", "Release the component `NAME` configured in .release.json")
 	flag.Usage = usage
+	common.AddTraceFlag(flag.CommandLine)
+	common.AddVersionFlag(flag.CommandLine, "release")
+	completion.Handle(completion.Command{Name: "release", Flags: flag.CommandLine, Args: completion.ArgNone})
 	flag.Parse()
 
+	config, err := loadConfig()
+	if err != nil {
+		errorExit(err.Error())
+	}
+
+	// 'release notices' only generates THIRD-PARTY-NOTICES; goreleaser runs it as a hook
+	if flag.NArg() > 0 && flag.Arg(0) == "notices" {
+		checkLicenses(config)
+		return
+	}
+
+	// 'release gen [VERSION]' generates the SBOM, completion scripts and man
+	// pages; goreleaser runs it as a hook too
+	if flag.NArg() > 0 && flag.Arg(0) == "gen" {
+		if flag.NArg() > 2 {
+			errorExit("Usage: release gen [VERSION]")
+		}
+		version := flag.Arg(1)
+		if version == "" {
+			data, err := os.ReadFile("VERSION")
+			if err != nil {
+				errorExit("Give the VERSION to generate assets for: release gen VERSION")
+			}
+			version = strings.TrimSpace(string(data))
+		}
+		generateAssets(version)
+		return
+	}
+
+	target, err := resolveTarget(config, opts.component)
+	if err != nil {
+		errorExit(err.Error())
+	}
+
+	// 'release announce VERSION' repeats the announcements of a published release
+	if flag.NArg() > 0 && flag.Arg(0) == "announce" {
+		if flag.NArg() != 2 {
+			errorExit("Usage: release announce VERSION")
+		}
+		if !config.Announce.enabled() {
+			errorExit(fmt.Sprintf("%s configures no announcements", releaseConfigFile))
+		}
+		announceRelease(target, flag.Arg(1), config.Announce)
+		return
+	}
+
+	// 'release publish VERSION' makes a release published with --draft public
+	if flag.NArg() > 0 && flag.Arg(0) == "publish" {
+		if flag.NArg() != 2 {
+			errorExit("Usage: release publish VERSION")
+		}
+		publishRelease(target, flag.Arg(1), config)
+		return
+	}
+
+	// Two releases at once would interleave commits, tags and uploads
+	if err := acquireLock(); err != nil {
+		errorExit(err.Error())
+	}
+
 	fmt.Println("==================================")
-	fmt.Println("  Git LFS Scripts Release")
+	fmt.Printf("  %s Release\n", target.label())
 	fmt.Println("==================================")
 	fmt.Println()
 
 	// Show current version
-	showCurrentVersion()
+	showCurrentVersion(target)
 	fmt.Println()
 
 	// Get version from argument or prompt
@@ -53,8 +137,12 @@ func main() {
 	if flag.NArg() > 0 {
 		version = flag.Arg(0)
 	} else {
-		nextVersion := getNextVersion()
-		version = promptVersion(nextVersion)
+		suggestion := suggestVersion(target)
+		info(fmt.Sprintf("Suggested version: %s, from %s", suggestion.version, suggestion.basis))
+		for _, reason := range suggestion.reasons {
+			fmt.Printf("  - %s\n", reason)
+		}
+		version = promptVersion(suggestion)
 	}
 
 	// Validate version
@@ -62,55 +150,63 @@ func main() {
 		errorExit(err.Error())
 	}
 	success(fmt.Sprintf("Version format is valid: %s", version))
-
-	// Run checks
-	checkBranch()
-	checkClean()
-	checkTag(version)
-	checkChangelog(version)
-
-	// Run tests
-	if !opts.skipTests {
-		runTests()
-	} else {
-		warning("Skipping tests.")
+	if opts.skipTests {
+		confirmSkipTests(version)
 	}
 
-	// Update version files
-	updateVersionFiles(version)
-
-	// Confirmation
-	fmt.Println()
-	warning(fmt.Sprintf("Ready to create release v%s", version))
-	if !confirmDefault("Proceed with release?", true) {
-		errorExit("Release cancelled")
+	// Checks, tests, version files, tag and GoReleaser, resuming after the
+	// steps an earlier run of this release completed
+	state, err := loadState(target.tag(version), opts.restart)
+	if err != nil {
+		errorExit(err.Error())
 	}
-
-	// Create and push tag
-	createTag(version, opts.debug)
-
-	// Run GoReleaser to create GitHub release and upload binaries
-	runGoReleaser(version, opts.debug)
+	if len(state.Completed) > 0 {
+		info(fmt.Sprintf("Resuming the release of %s; done by the earlier run: %s", target.tag(version), strings.Join(state.Completed, ", ")))
+	}
+	steps := resumeSteps(releaseSteps(version, target, opts, config), state)
+	if opts.tui {
+		if !runTUI(fmt.Sprintf("%s Release %s", target.label(), target.tag(version)), steps) {
+			errorExit("Release aborted")
+		}
+	} else {
+		runSteps(steps)
+	}
+	state.finish()
+	releaseLock()
 
 	fmt.Println()
-	success(fmt.Sprintf("Release v%s completed successfully!", version))
+	success(fmt.Sprintf("Release %s completed successfully!", target.tag(version)))
 	fmt.Println()
 
 	// Display release URL
-	repoURL, err := getRepoURL()
-	if err == nil && repoURL != "" {
-		info(fmt.Sprintf("View release at: https://github.com/%s/releases/tag/v%s", repoURL, version))
+	repo, err := githubRepo()
+	if opts.draft {
+		if err == nil {
+			info(fmt.Sprintf("The release is a draft, listed at: https://github.com/%s/releases", repo))
+		}
+		command := "./release publish " + version
+		if target.name != "" {
+			command = fmt.Sprintf("./release -c %s publish %s", target.name, version)
+		}
+		info(fmt.Sprintf("Smoke test its binaries, then make it public with: %s", command))
+	} else if err == nil {
+		info(fmt.Sprintf("View release at: https://github.com/%s/releases/tag/%s", repo, target.tag(version)))
 	}
 	fmt.Println()
 }
 
 func usage() {
-	nextVersion := getNextVersion()
+	root, _ := resolveTarget(ReleaseConfig{}, "")
+	nextVersion := suggestVersion(root).version
 	fmt.Fprint(os.Stderr, dedent.Dedent(fmt.Sprintf(`
 		Release a new version of Git LFS Scripts
 
 		USAGE:
 		  release [OPTIONS] [VERSION]
+		  release notices
+		  release gen [VERSION]
+		  release announce VERSION
+		  release publish VERSION
 
 		OPTIONS:
 	`)))
@@ -121,23 +217,162 @@ func usage() {
 	fmt.Fprint(os.Stderr, dedent.Dedent(fmt.Sprintf(`
 
 		VERSION:
-		  The version to release (e.g., %s)
+		  The version to release (e.g., %s): X.Y.Z, or a pre-release
+		  X.Y.Z-rc.N or X.Y.Z-beta.N. Versions are ordered as semver orders
+		  them, so 1.2.0-beta.2 < 1.2.0-rc.1 < 1.2.0, and the version offered
+		  after 1.2.0-rc.1 is 1.2.0-rc.2. Pre-releases are published as GitHub
+		  pre-releases: their release sets 'prerelease: auto' in the GoReleaser
+		  config if it does not already.
+
+		  Without VERSION, the version offered follows from the changes since
+		  the latest tag, and the reasons are shown. The headings of the
+		  Unreleased section of CHANGELOG.md decide: Removed, or an entry
+		  starting with BREAKING:, bumps the major version; Added, Changed and
+		  Deprecated the minor one; Fixed and Security the patch. Without
+		  Unreleased entries, conventional commit messages decide: 'feat!:' or
+		  a BREAKING CHANGE footer is major, feat minor, fix and perf patch.
+		  Before 1.0.0 breaking changes bump the minor version. A newer
+		  version in VERSION is offered instead. Answer patch, minor or major
+		  to the prompt to choose another bump.
 
 		DESCRIPTION:
 		  Automates the release process including:
 		    - Version validation and management
-		    - Pre-release checks (branch, working directory, tags)
-		    - CHANGELOG.md verification
-		    - Test execution
-		    - VERSION file updates and commits
-		    - Git tag creation and pushing
-		    - GoReleaser execution for GitHub releases
+		    - Pre-release checks (branch, origin, working directory, tags)
+		    - CHANGELOG.md checks and Unreleased entry release (Keep a Changelog)
+		    - Third-party license policy check and THIRD-PARTY-NOTICES generation
+		    - Required approvals and CI results on GitHub, when configured
+		    - go vet, test execution and a coverage threshold, when configured
+		    - VERSION file, version constant and GoReleaser ldflags updates and
+		      commits, verified by running every rebuilt binary with --version
+		    - Git tag creation and pushing (signed and verified with --sign)
+		    - GoReleaser execution for GitHub releases, with an SBOM, shell
+		      completion scripts and man pages generated by 'release gen'
+		    - Verification of the published artifacts, which turns the release
+		      back into a draft when any fails
+		    - Release announcements, when configured
+
+		  With --draft, GoReleaser publishes the release as a draft, which only
+		  users with push access see, so the uploaded binaries can be smoke
+		  tested first. GoReleaser runs with a temporary copy of its config
+		  that sets 'draft: true' in the release section; the committed config
+		  is not changed. Announcements wait until 'release publish VERSION'
+		  verifies the artifacts again, makes the release public and then
+		  makes them.
+
+		  After the branch check, origin is fetched and the branch compared with
+		  its counterpart there, so the tag lands on the commit CI built. A
+		  branch behind origin is fast-forwarded and one that has diverged is
+		  rebased onto it, each only when confirmed; otherwise the release
+		  stops. Unpushed local commits are reported, as CI has not built them.
+
+		  Only one release runs at a time: a second one stops while .release.lock
+		  names a running release process. The steps that succeed are recorded
+		  in .release-state.json. When a step fails, fix the cause and run the
+		  same release again: it resumes at the failed step, skipping the
+		  checks, commits and tag already done, unless HEAD moved meanwhile.
+		  --restart discards the recorded progress. The file is removed once
+		  the release completes.
+
+		  With --tui, the steps are shown as a checklist with the live output of
+		  the running step. When a step fails you can retry it, skip it or quit;
+		  the tag, license, sign-off, vet and test checks cannot be skipped. A
+		  summary of all steps is printed at the end.
 
 		EXAMPLES:
 		  ./release              # Interactive mode
 		  ./release 1.0.0        # Release specific version
-		  ./release -s 1.0.0     # Skip tests
+		  ./release 1.1.0-rc.1   # Release candidate, published as a pre-release
+		  ./release -s 1.0.0     # Skip vet, tests and coverage (asks for confirmation)
 		  ./release -d 1.0.0     # Debug mode
+		  ./release --sign 1.0.0 # Signed tag and signed checksums.txt
+		  ./release --tui 1.0.0  # Checklist screen with live logs, retry and skip
+		  ./release --restart 1.0.0  # Start a failed release over from the first step
+		  ./release -c trace 1.2.0  # Release the trace component as trace/v1.2.0
+		  ./release notices      # Only generate THIRD-PARTY-NOTICES and check licenses
+		  ./release gen 1.0.0    # Only generate the SBOM, completions and man pages
+		  ./release announce 1.0.0  # Repeat the announcements of a published release
+		  ./release --draft 1.0.0   # Publish as a draft for smoke testing
+		  ./release publish 1.0.0   # Make the draft public and announce it
+
+		CHANGELOG:
+		  CHANGELOG.md follows Keep a Changelog (https://keepachangelog.com/).
+		  The release needs a '## [VERSION]' section with at least one list item.
+		  Without one, the items of the '## [Unreleased]' section are moved into
+		  a new '## [VERSION] - DATE' section, which is committed with VERSION.
+		  The [Unreleased] comparison link at the bottom of the file then starts
+		  at the new tag, and a link comparing the previous tag with the new one
+		  is added. Older headings such as '## v1.2.0 / 2024-05-01' are accepted.
+
+		LICENSE POLICY:
+		  Dependencies must use a license listed in .release.json, for example:
+		    {"licenses": {"allowed": ["Apache-2.0", "BSD-3-Clause", "MIT"]}}
+		  Without .release.json, Apache-2.0, BSD-2-Clause, BSD-3-Clause, ISC, MIT
+		  and MPL-2.0 are allowed.
+
+		COMPONENTS:
+		  Parts of the repository can be versioned separately. Each component in
+		  .release.json names the directory holding its VERSION and CHANGELOG.md:
+		    {"components": {"trace": {"dir": "cmd/git-lfs-trace"}}}
+		  'release --component trace' then tags trace/vX.Y.Z (change the prefix
+		  with "tag_prefix") and runs GoReleaser with DIR/.goreleaser.yml (change
+		  it with "goreleaser"), setting GORELEASER_CURRENT_TAG to the new tag.
+
+		SIGN-OFF:
+		  With a "signoff" section in .release.json, GitHub is asked whether the
+		  release may proceed before anything is tagged:
+		    {"signoff": {"required_approvals": 1, "required_reviewers": ["alice"],
+		                 "required_checks": ["test"], "require_green": true}}
+		  Every commit since the previous tag must have been merged through a pull
+		  request with the required approvals (set "allow_direct" to permit direct
+		  pushes), and the checks must have passed on the release commit; with
+		  "require_green" every check must pass. Missing approvals and failing
+		  checks are listed and the release stops.
+
+		TESTS:
+		  Before the version files change, 'go vet ./...' must report nothing
+		  and 'go test' must pass. With a "tests" section in .release.json the
+		  coverage of the tests must also reach a threshold:
+		    {"tests": {"min_coverage": 60, "coverage_packages": ["./internal/..."]}}
+		  "coverage_packages" defaults to ./...; packages without tests count
+		  as uncovered. --skip-tests skips all three, and asks you to type
+		  'release VERSION without tests' first.
+
+		RELEASE ASSETS:
+		  'release gen VERSION', which GoReleaser runs as a hook, builds every
+		  command and writes to build/release-assets:
+		    completions/SHELL/   Completion scripts for bash, zsh, fish and
+		                         PowerShell, from 'COMMAND completion SHELL'
+		    man/man1/            Man pages converted from each command's --help
+		    completions.tar.gz   Both directories packed for packagers
+		    man.tar.gz
+		    sbom.spdx.json       SPDX 2.3 SBOM of the modules compiled into the
+		                         commands, with their licenses and purls
+		  The SBOM and tarballs are attached to the release and listed in
+		  checksums.txt; every archive also carries the completions and man
+		  pages. Dates come from the last commit, so regenerating is repeatable.
+
+		ARTIFACT VERIFICATION:
+		  After GoReleaser uploads, every artifact of the release is downloaded,
+		  four at a time, and its SHA-256 compared with checksums.txt; an artifact
+		  missing from either side also fails. The binaries in the archive for
+		  this OS and architecture are then run with --version. Any failure makes
+		  the release a draft again, hidden from users, and stops the release
+		  before announcements. Fix the artifacts and publish the draft on GitHub,
+		  or with 'release publish VERSION'.
+
+		ANNOUNCEMENTS:
+		  With an "announce" section in .release.json, the CHANGELOG.md section
+		  of the version is published after GoReleaser succeeds:
+		    {"announce": {"release_body": true, "discussion": "Announcements",
+		                  "webhooks": [{"format": "slack", "url_env": "SLACK_WEBHOOK_URL"},
+		                               {"format": "discord", "url_env": "DISCORD_WEBHOOK_URL"}]}}
+		  "release_body" puts it above GoReleaser's notes on the GitHub release,
+		  "discussion" opens a discussion in that category, and each webhook
+		  receives it as Slack, Discord or plain JSON ("format": "json"). Keep
+		  webhook URLs out of the repository with "url_env". A failed
+		  announcement is reported without failing the release; retry it with
+		  'release announce VERSION'.
 	`, nextVersion)))
 	os.Exit(0)
 }
@@ -160,81 +395,134 @@ func errorMsg(msg string) {
 
 func errorExit(msg string) {
 	errorMsg(msg)
+	if catchFailures {
+		panic(stepFailure{msg: msg})
+	}
+	releaseLock()
 	os.Exit(1)
 }
 
+// runCommand runs a command through common.Query and returns its trimmed
+// output, followed by its error output when it fails
 func runCommand(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
 	cmd := exec.Command(name, args...)
-	output, err := cmd.CombinedOutput()
+	cmd.Stderr = &stderr
+	output, err := common.Query(cmd)
+	if err != nil {
+		output = append(output, stderr.Bytes()...)
+	}
 	return strings.TrimSpace(string(output)), err
 }
 
+// runCommandVerbose runs a command through common.Run, with its output on
+// the terminal
 func runCommandVerbose(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return common.Run(exec.Command(name, args...))
 }
 
-func getNextVersion() string {
-	// Get version from git tags and increment
-	output, err := runCommand("git", "describe", "--tags", "--abbrev=0")
-	incrementedVersion := "1.0.0"
-	if err == nil {
-		latestTag := strings.TrimPrefix(output, "v")
-		parts := strings.Split(latestTag, ".")
-		if len(parts) == 3 {
-			// Increment patch version
-			var major, minor, patch int
-			fmt.Sscanf(latestTag, "%d.%d.%d", &major, &minor, &patch)
-			incrementedVersion = fmt.Sprintf("%d.%d.%d", major, minor, patch+1)
-		}
-	}
+// semver is a version such as 1.2.3 or 1.2.3-rc.1
+type semver struct {
+	major, minor, patch int
+	pre                 []string // Pre-release identifiers, e.g. rc and 1
+}
 
-	// Read VERSION file
-	versionFileContent, err := os.ReadFile("VERSION")
-	if err != nil {
-		// VERSION file doesn't exist, use incremented version
-		return incrementedVersion
-	}
+// versionPattern matches X.Y.Z with an optional pre-release
+var versionPattern = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
 
-	versionFileVersion := strings.TrimSpace(string(versionFileContent))
+// releasePattern matches the versions that may be released: X.Y.Z,
+// X.Y.Z-rc.N and X.Y.Z-beta.N
+var releasePattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-(rc|beta)\.[0-9]+)?$`)
 
-	// Validate VERSION file format
-	if err := validateVersion(versionFileVersion); err != nil {
-		// Invalid format in VERSION file, use incremented version
-		return incrementedVersion
+// parseVersion parses a semantic version without build metadata
+func parseVersion(version string) (semver, bool) {
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return semver{}, false
+	}
+	var v semver
+	fmt.Sscanf(m[1]+" "+m[2]+" "+m[3], "%d %d %d", &v.major, &v.minor, &v.patch)
+	if m[4] != "" {
+		v.pre = strings.Split(m[4], ".")
 	}
+	return v, true
+}
 
-	// Compare versions and return the newer one
-	if isNewerVersion(versionFileVersion, incrementedVersion) {
-		return versionFileVersion
+// next returns the version following v: the next pre-release of the same
+// kind for a pre-release such as 1.2.0-rc.1, otherwise the next patch
+func (v semver) next() string {
+	if n := len(v.pre); n > 0 {
+		if number, err := strconv.Atoi(v.pre[n-1]); err == nil {
+			pre := append(append([]string{}, v.pre[:n-1]...), strconv.Itoa(number+1))
+			return fmt.Sprintf("%d.%d.%d-%s", v.major, v.minor, v.patch, strings.Join(pre, "."))
+		}
+		return fmt.Sprintf("%d.%d.%d-%s.1", v.major, v.minor, v.patch, strings.Join(v.pre, "."))
 	}
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch+1)
+}
 
-	return incrementedVersion
+// compare returns -1, 0 or 1 as v is older than, equal to or newer than w,
+// ordering pre-releases as semver does: 1.0.0-beta.2 < 1.0.0-beta.11 <
+// 1.0.0-rc.1 < 1.0.0
+func (v semver) compare(w semver) int {
+	for _, pair := range [][2]int{{v.major, w.major}, {v.minor, w.minor}, {v.patch, w.patch}} {
+		if pair[0] != pair[1] {
+			return sign(pair[0] - pair[1])
+		}
+	}
+	switch {
+	case len(v.pre) == 0 && len(w.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1 // A release is newer than its pre-releases
+	case len(w.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		a, errA := strconv.Atoi(v.pre[i])
+		b, errB := strconv.Atoi(w.pre[i])
+		switch {
+		case errA == nil && errB == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case errA == nil:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case errB == nil:
+			return 1
+		case v.pre[i] != w.pre[i]:
+			return strings.Compare(v.pre[i], w.pre[i])
+		}
+	}
+	return sign(len(v.pre) - len(w.pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
 }
 
 // isNewerVersion returns true if v1 is newer than v2
 func isNewerVersion(v1, v2 string) bool {
-	var major1, minor1, patch1 int
-	var major2, minor2, patch2 int
-
-	fmt.Sscanf(v1, "%d.%d.%d", &major1, &minor1, &patch1)
-	fmt.Sscanf(v2, "%d.%d.%d", &major2, &minor2, &patch2)
+	a, _ := parseVersion(v1)
+	b, _ := parseVersion(v2)
+	return a.compare(b) > 0
+}
 
-	if major1 != major2 {
-		return major1 > major2
-	}
-	if minor1 != minor2 {
-		return minor1 > minor2
-	}
-	return patch1 > patch2
+// isPrerelease reports whether version is a release candidate or beta
+func isPrerelease(version string) bool {
+	v, ok := parseVersion(version)
+	return ok && len(v.pre) > 0
 }
 
 func validateVersion(version string) error {
-	matched, _ := regexp.MatchString(`^[0-9]+\.[0-9]+\.[0-9]+$`, version)
-	if !matched {
-		return fmt.Errorf("invalid version format: %s (expected: X.Y.Z)", version)
+	if !releasePattern.MatchString(version) {
+		return fmt.Errorf("invalid version format: %s (expected: X.Y.Z, X.Y.Z-rc.N or X.Y.Z-beta.N)", version)
 	}
 	return nil
 }
@@ -264,15 +552,22 @@ func checkBranch() {
 }
 
 func checkClean() {
-	output, _ := runCommand("git", "status", "-s")
+	status, _ := runCommand("git", "status", "-s")
+	// The files of the release itself are not changes to commit
+	var changes []string
+	for _, line := range strings.Split(status, "\n") {
+		if line != "" && !slices.Contains([]string{stateFile, lockFile}, strings.TrimSpace(line[min(2, len(line)):])) {
+			changes = append(changes, line)
+		}
+	}
+	output := strings.Join(changes, "\n")
 	if output != "" {
 		warning("Working directory is not clean.")
 		fmt.Println(output)
 		fmt.Println()
 
-		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Commit message (or press Enter for 'Pre-release commit'): ")
-		commitMsg, _ := reader.ReadString('\n')
+		commitMsg, _ := stdin.ReadString('\n')
 		commitMsg = strings.TrimSpace(commitMsg)
 		if commitMsg == "" {
 			commitMsg = "Pre-release commit"
@@ -282,6 +577,9 @@ func checkClean() {
 		if err := runCommandVerbose("git", "add", "-A"); err != nil {
 			errorExit("Failed to add changes")
 		}
+		if _, err := runCommand("git", "reset", "-q", "--", stateFile, lockFile); err != nil {
+			errorExit("Failed to leave the release state out of the commit")
+		}
 
 		info("Committing changes...")
 		if err := runCommandVerbose("git", "commit", "-m", commitMsg); err != nil {
@@ -299,8 +597,14 @@ func checkClean() {
 	}
 }
 
-func checkTag(version string) {
-	tag := fmt.Sprintf("v%s", version)
+// latestTag returns the most recent tag of the target; the prefixes keep
+// the tags of other components out of the way
+func latestTag(target releaseTarget) (string, error) {
+	return runCommand("git", "describe", "--tags", "--abbrev=0", "--match", target.tagPrefix+"v[0-9]*")
+}
+
+func checkTag(target releaseTarget, version string) {
+	tag := target.tag(version)
 	_, err := runCommand("git", "rev-parse", tag)
 	if err == nil {
 		errorExit(fmt.Sprintf("Tag %s already exists", tag))
@@ -308,75 +612,132 @@ func checkTag(version string) {
 	success(fmt.Sprintf("Tag %s is available", tag))
 }
 
-func checkChangelog(version string) {
-	content, err := os.ReadFile("CHANGELOG.md")
+func checkChangelog(target releaseTarget, version string) {
+	content, err := os.ReadFile(target.changelog)
 	if err != nil {
-		warning("CHANGELOG.md not found")
+		warning(fmt.Sprintf("%s not found", target.changelog))
 		if !confirm("Continue anyway?") {
-			errorExit("Please create CHANGELOG.md")
+			errorExit(fmt.Sprintf("Please create %s", target.changelog))
 		}
 		return
 	}
 
-	if !strings.Contains(string(content), version) {
-		warning(fmt.Sprintf("CHANGELOG.md does not mention version %s", version))
-		if !confirm("Continue anyway?") {
-			errorExit("Please update CHANGELOG.md before releasing")
+	log := changelog.Parse(string(content))
+	if section := log.Section(version); section != nil {
+		if section.Entries() == 0 {
+			errorExit(fmt.Sprintf("The %s section of %s has no entries", version, target.changelog))
 		}
-	} else {
-		success(fmt.Sprintf("CHANGELOG.md mentions version %s", version))
+		success(fmt.Sprintf("%s has %d entries for %s", target.changelog, section.Entries(), version))
+		return
+	}
+
+	// Release the Unreleased entries; updateVersionFiles commits the result
+	unreleased := log.Section(changelog.Unreleased)
+	if unreleased == nil || unreleased.Entries() == 0 {
+		errorExit(fmt.Sprintf("%s has no '## [%s]' section and no Unreleased entries to move into one", target.changelog, version))
 	}
+	entries := unreleased.Entries()
+	repoURL := ""
+	if repo, err := githubRepo(); err == nil {
+		repoURL = "https://github.com/" + repo
+	}
+	if err := log.Release(version, time.Now().Format("2006-01-02"), repoURL, target.tag); err != nil {
+		errorExit(err.Error())
+	}
+	if err := os.WriteFile(target.changelog, []byte(log.String()), 0644); err != nil {
+		errorExit(fmt.Sprintf("Failed to write %s: %v", target.changelog, err))
+	}
+	success(fmt.Sprintf("Moved %d Unreleased entries of %s to a new %s section", entries, target.changelog, version))
 }
 
-func runTests() {
-	info("Running tests...")
+func updateVersionFiles(target releaseTarget, version string) {
+	info(fmt.Sprintf("Updating %s to %s...", target.versionFile, version))
 
-	// Try make test first, fall back to go test
-	err := runCommandVerbose("make", "test")
-	if err != nil {
-		// Try go test directly
-		err = runCommandVerbose("go", "test", "./...")
+	if err := os.WriteFile(target.versionFile, []byte(version+"\n"), 0644); err != nil {
+		errorExit(fmt.Sprintf("Failed to write %s", target.versionFile))
 	}
+	success(fmt.Sprintf("%s updated", target.versionFile))
+	files := []string{target.versionFile}
 
-	if err != nil {
-		errorExit("Tests failed. Fix issues before releasing.")
+	// The suite's version constant is only the repository's to change
+	if target.name == "" {
+		if err := writeReleaseVersion(version); err != nil {
+			errorExit(fmt.Sprintf("Failed to write %s: %v", releaseVersionFile, err))
+		}
+		success(fmt.Sprintf("%s updated", releaseVersionFile))
+		files = append(files, releaseVersionFile)
 	}
-	success("All tests passed")
-}
 
-func updateVersionFiles(version string) {
-	info(fmt.Sprintf("Updating VERSION file to %s...", version))
-
-	if err := os.WriteFile("VERSION", []byte(version+"\n"), 0644); err != nil {
-		errorExit("Failed to write VERSION file")
+	goreleaserConfig := target.goreleaserConfig
+	if goreleaserConfig == "" {
+		goreleaserConfig = ".goreleaser.yml"
+	}
+	changed, err := fixGoReleaserLDFlags(goreleaserConfig)
+	if err != nil {
+		errorExit(err.Error())
+	}
+	if changed {
+		success(fmt.Sprintf("Hard-coded versions in %s replaced by {{.Version}}", goreleaserConfig))
+		files = append(files, goreleaserConfig)
+	} else {
+		success(fmt.Sprintf("Every build in %s stamps the release version", goreleaserConfig))
+	}
+	if isPrerelease(version) {
+		changed, err := fixGoReleaserPrerelease(goreleaserConfig)
+		if err != nil {
+			errorExit(err.Error())
+		}
+		if changed {
+			success(fmt.Sprintf("%s now marks pre-release versions as GitHub pre-releases", goreleaserConfig))
+			files = append(files, goreleaserConfig)
+		} else {
+			success(fmt.Sprintf("%s marks %s as a GitHub pre-release", goreleaserConfig, version))
+		}
 	}
-	success("VERSION file updated")
 
-	// Rebuild with new version
+	// Rebuild with new version; the tag does not exist yet, so git describe
+	// would still name the previous release
 	info("Rebuilding with new version...")
-	err := runCommandVerbose("make", "build")
-	if err != nil {
+	if err := runCommandVerbose("make", "build", "VERSION="+version); err != nil {
 		errorExit("Build failed")
 	}
 	success("Binaries rebuilt with new version")
 
-	// Commit VERSION file change if there are changes
-	runCommandVerbose("git", "add", "VERSION")
-	status, _ := runCommand("git", "status", "--porcelain", "VERSION")
+	names, err := builtBinaries(target)
+	if err != nil {
+		errorExit(fmt.Sprintf("Failed to list the built binaries: %v", err))
+	}
+	if err := verifyVersions(names, version, target.name == ""); err != nil {
+		errorExit(err.Error())
+	}
+	success(fmt.Sprintf("Every binary reports version %s", version))
+
+	// Commit the version files, and CHANGELOG.md if checkChangelog released its entries
+	if _, err := os.Stat(target.changelog); err == nil {
+		files = append(files, target.changelog)
+	}
+	runCommandVerbose("git", append([]string{"add"}, files...)...)
+	status, _ := runCommand("git", append([]string{"status", "--porcelain"}, files...)...)
 	if status != "" {
-		if err := runCommandVerbose("git", "commit", "-m", fmt.Sprintf("Bump version to %s", version)); err != nil {
-			errorExit("Failed to commit VERSION file")
+		message := fmt.Sprintf("Bump version to %s", version)
+		if target.name != "" {
+			message = fmt.Sprintf("Bump %s version to %s", target.name, version)
 		}
-		if err := runCommandVerbose("git", "push", "origin"); err != nil {
-			errorExit("Failed to push VERSION file")
+		if err := runCommandVerbose("git", "commit", "-m", message); err != nil {
+			errorExit("Failed to commit version files")
 		}
-		success("VERSION file committed and pushed")
+		success("Version files committed")
 	} else {
-		success("VERSION file already up to date (no commit needed)")
+		success("Version files already up to date (no commit needed)")
+	}
+	// Also pushes the commit of a resumed release whose push failed
+	if err := runCommandVerbose("git", "push", "origin"); err != nil {
+		errorExit("Failed to push version files")
 	}
+	success("Version files pushed")
 }
 
-func runGoReleaser(version string, debug bool) {
+func runGoReleaser(target releaseTarget, version string, debug, draft bool, signing *signingConfig) {
 	// Check for GITHUB_TOKEN
 	token := os.Getenv("GITHUB_TOKEN")
 	if token == "" {
@@ -421,33 +782,70 @@ func runGoReleaser(version string, debug bool) {
 	info("Running goreleaser to create GitHub release...")
 
 	args := []string{"release", "--clean"}
+	if target.goreleaserConfig != "" {
+		if _, err := os.Stat(target.goreleaserConfig); err != nil {
+			errorExit(fmt.Sprintf("GoReleaser config %s not found", target.goreleaserConfig))
+		}
+		info(fmt.Sprintf("Using %s", target.goreleaserConfig))
+	}
+	goreleaserConfig := target.goreleaserConfig
+	if draft {
+		if goreleaserConfig == "" {
+			goreleaserConfig = ".goreleaser.yml"
+		}
+		path, err := draftGoReleaserConfig(goreleaserConfig)
+		if err != nil {
+			errorExit(fmt.Sprintf("Failed to write the draft GoReleaser config: %v", err))
+		}
+		defer os.Remove(path)
+		goreleaserConfig = path
+		info(fmt.Sprintf("Publishing a draft release (release.draft overridden in %s)", path))
+	}
+	if goreleaserConfig != "" {
+		args = append(args, "--config", goreleaserConfig)
+	}
+	if target.tagPrefix != "" {
+		// GoReleaser otherwise picks the latest tag of any component
+		os.Setenv("GORELEASER_CURRENT_TAG", target.tag(version))
+		if previous, err := runCommand("git", "describe", "--tags", "--abbrev=0", "--match", target.tagPrefix+"v[0-9]*", target.tag(version)+"^"); err == nil {
+			os.Setenv("GORELEASER_PREVIOUS_TAG", previous)
+		}
+	}
 	if debug {
 		args = append(args, "--debug")
 	}
+	if signing != nil {
+		exportSigningEnv(*signing)
+	} else {
+		args = append(args, "--skip=sign")
+	}
 
 	if err := runCommandVerbose("goreleaser", args...); err != nil {
 		errorExit("goreleaser failed. The tag has been pushed but the release was not created.")
 	}
 
+	if draft {
+		success("Draft GitHub release created with binaries uploaded")
+		return
+	}
 	success("GitHub release created with binaries uploaded")
 }
 
-func getRepoURL() (string, error) {
-	repoURL, err := runCommand("git", "config", "--get", "remote.origin.url")
+// githubRepo returns OWNER/NAME of the GitHub repository of
+// remote.origin.url, where releases are published
+func githubRepo() (string, error) {
+	remote, err := forge.CurrentRepo("github")
 	if err != nil {
 		return "", err
 	}
-
-	// Extract repo path from git URL
-	repoURL = strings.TrimSuffix(repoURL, ".git")
-	repoURL = strings.TrimPrefix(repoURL, "git@github.com:")
-	repoURL = strings.TrimPrefix(repoURL, "https://github.com/")
-
-	return repoURL, nil
+	if remote.Host != "github.com" {
+		return "", fmt.Errorf("releases are published on github.com, but remote.origin.url is on %s", remote.Host)
+	}
+	return remote.Path, nil
 }
 
-func createTag(version string, debug bool) {
-	tag := fmt.Sprintf("v%s", version)
+func createTag(target releaseTarget, version string, debug bool, signing *signingConfig) {
+	tag := target.tag(version)
 	tagMessage := fmt.Sprintf("Release %s", tag)
 
 	if debug {
@@ -455,11 +853,29 @@ func createTag(version string, debug bool) {
 		warning("Debug mode enabled")
 	}
 
-	info(fmt.Sprintf("Creating tag %s...", tag))
-	if err := runCommandVerbose("git", "tag", "-a", tag, "-m", tagMessage); err != nil {
-		errorExit("Failed to create tag")
+	tagFlag := "-a"
+	if signing != nil {
+		tagFlag = "-s"
+	}
+
+	// A resumed release finds the tag of a run whose push failed
+	head, _ := runCommand("git", "rev-parse", "HEAD")
+	if tagged, err := runCommand("git", "rev-parse", tag+"^{commit}"); err == nil && tagged == head {
+		info(fmt.Sprintf("Tag %s already points at HEAD", tag))
+	} else {
+		info(fmt.Sprintf("Creating tag %s...", tag))
+		if err := runCommandVerbose("git", "tag", tagFlag, tag, "-m", tagMessage); err != nil {
+			errorExit("Failed to create tag")
+		}
+		success(fmt.Sprintf("Tag %s created", tag))
+	}
+
+	// A tag that fails verification is deleted before anyone sees it, so
+	// the next run signs it again
+	if signing != nil && !verifyTagSignature(tag, *signing) {
+		runCommand("git", "tag", "-d", tag)
+		errorExit(fmt.Sprintf("Signature verification failed for tag %s; the tag was deleted, not pushed", tag))
 	}
-	success(fmt.Sprintf("Tag %s created", tag))
 
 	info("Pushing tag to origin...")
 	if err := runCommandVerbose("git", "push", "origin", tag); err != nil {
@@ -468,28 +884,37 @@ func createTag(version string, debug bool) {
 	success("Tag pushed to origin")
 }
 
-func showCurrentVersion() {
-	latestTag, err := runCommand("git", "describe", "--tags", "--abbrev=0")
+func showCurrentVersion(target releaseTarget) {
+	tag, err := latestTag(target)
 	if err != nil {
-		latestTag = "none"
+		tag = "none"
 	}
-	info(fmt.Sprintf("Most recent version tag: %s", latestTag))
+	info(fmt.Sprintf("Most recent version tag: %s", tag))
 
-	versionFile, err := os.ReadFile("VERSION")
+	versionFile, err := os.ReadFile(target.versionFile)
 	if err != nil {
-		info("VERSION file contains: unknown")
+		info(fmt.Sprintf("%s contains: unknown", target.versionFile))
 	} else {
-		info(fmt.Sprintf("VERSION file contains: %s", strings.TrimSpace(string(versionFile))))
+		info(fmt.Sprintf("%s contains: %s", target.versionFile, strings.TrimSpace(string(versionFile))))
 	}
 }
 
-func promptVersion(defaultVersion string) string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("What version number should this release have (accept the default with Enter) [%s] ", defaultVersion)
-	version, _ := reader.ReadString('\n')
+// promptVersion asks for the version, offering the suggestion. Instead of a
+// version the answer may name a bump: patch, minor or major.
+func promptVersion(suggestion versionSuggestion) string {
+	prompt := "What version number should this release have (accept the default with Enter"
+	if len(suggestion.bumps) > 0 {
+		prompt += fmt.Sprintf("; patch %s, minor %s, major %s",
+			suggestion.bumps["patch"], suggestion.bumps["minor"], suggestion.bumps["major"])
+	}
+	fmt.Printf("%s) [%s] ", prompt, suggestion.version)
+	version, _ := stdin.ReadString('\n')
 	version = strings.TrimSpace(version)
 	if version == "" {
-		version = defaultVersion
+		return suggestion.version
+	}
+	if bumped, ok := suggestion.bumps[strings.ToLower(version)]; ok {
+		return bumped
 	}
 	return version
 }
@@ -499,7 +924,6 @@ func confirm(prompt string) bool {
 }
 
 func confirmDefault(prompt string, defaultYes bool) bool {
-	reader := bufio.NewReader(os.Stdin)
 
 	suffix := "(y/N)"
 	if defaultYes {
@@ -507,7 +931,7 @@ func confirmDefault(prompt string, defaultYes bool) bool {
 	}
 
 	fmt.Printf("%s %s ", prompt, suffix)
-	response, _ := reader.ReadString('\n')
+	response, _ := stdin.ReadString('\n')
 	response = strings.ToLower(strings.TrimSpace(response))
 
 	// If empty response, use default
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// publishRelease makes the draft release of version, published with
+// --draft, public once its binaries were smoke tested. The artifacts are
+// verified again first, as they may have been replaced meanwhile, and the
+// announcements that --draft held back follow.
+func publishRelease(target releaseTarget, version string, config ReleaseConfig) {
+	repo, err := githubRepo()
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot determine the GitHub repository: %v", err))
+	}
+	tag := target.tag(version)
+	release, err := github.ReleaseByTag(repo, tag)
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot read release %s: %v", tag, err))
+	}
+	if !release.Draft {
+		info(fmt.Sprintf("Release %s is already public: %s", tag, release.URL))
+		return
+	}
+
+	verifyPublished(target, version)
+	if err := github.SetReleaseDraft(repo, release.ID, false); err != nil {
+		errorExit(fmt.Sprintf("Failed to publish release %s: %v", tag, err))
+	}
+	success(fmt.Sprintf("Release %s is public: https://github.com/%s/releases/tag/%s", tag, repo, tag))
+
+	if config.Announce.enabled() {
+		announceRelease(target, version, config.Announce)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// checkRemote fetches origin and compares the current branch with its
+// counterpart there, so the tag lands on the commit CI built. A branch that
+// is behind is fast-forwarded and one that has diverged is rebased, when
+// confirmed; otherwise the release stops.
+func checkRemote() {
+	branch, err := runCommand("git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil || branch == "HEAD" {
+		errorExit("Failed to get current branch; a detached HEAD cannot be compared with origin")
+	}
+	remoteBranch := "origin/" + branch
+
+	info("Fetching origin...")
+	if output, err := runCommand("git", "fetch", "--quiet", "origin"); err != nil {
+		errorExit(fmt.Sprintf("Failed to fetch origin: %s", output))
+	}
+	if _, err := runCommand("git", "rev-parse", "--verify", "--quiet", "refs/remotes/"+remoteBranch); err != nil {
+		warning(fmt.Sprintf("%s does not exist; nothing on origin to compare %s with", remoteBranch, branch))
+		if !confirm("Continue anyway?") {
+			errorExit("Aborted")
+		}
+		return
+	}
+
+	ahead, behind, err := divergence("HEAD", remoteBranch)
+	if err != nil {
+		errorExit(fmt.Sprintf("Failed to compare %s with %s: %v", branch, remoteBranch, err))
+	}
+	switch {
+	case ahead == 0 && behind == 0:
+		success(fmt.Sprintf("%s matches %s", branch, remoteBranch))
+
+	case ahead == 0:
+		warning(fmt.Sprintf("%s is %d %s behind %s", branch, behind, common.Plural(behind, "commit", "commits"), remoteBranch))
+		if !confirmDefault(fmt.Sprintf("Fast-forward %s to %s?", branch, remoteBranch), true) {
+			errorExit(fmt.Sprintf("Aborted; pull %s before releasing", remoteBranch))
+		}
+		if err := runCommandVerbose("git", "merge", "--ff-only", "--autostash", remoteBranch); err != nil {
+			errorExit(fmt.Sprintf("Failed to fast-forward %s", branch))
+		}
+		success(fmt.Sprintf("%s fast-forwarded to %s", branch, remoteBranch))
+
+	case behind == 0:
+		// The version commit pushes them, but CI has not built them yet
+		warning(fmt.Sprintf("%s is %d %s ahead of %s; CI has not built unpushed commits",
+			branch, ahead, common.Plural(ahead, "commit", "commits"), remoteBranch))
+		if !confirm("Continue anyway?") {
+			errorExit(fmt.Sprintf("Aborted; push %s and wait for CI before releasing", branch))
+		}
+		success(fmt.Sprintf("%s is ahead of %s", branch, remoteBranch))
+
+	default:
+		warning(fmt.Sprintf("%s and %s have diverged: %d %s only here, %d %s only on origin",
+			branch, remoteBranch, ahead, common.Plural(ahead, "commit", "commits"), behind, common.Plural(behind, "commit", "commits")))
+		if !confirm(fmt.Sprintf("Rebase %s onto %s?", branch, remoteBranch)) {
+			errorExit(fmt.Sprintf("Aborted; reconcile %s with %s before releasing", branch, remoteBranch))
+		}
+		if err := runCommandVerbose("git", "rebase", "--autostash", remoteBranch); err != nil {
+			runCommand("git", "rebase", "--abort")
+			errorExit(fmt.Sprintf("Failed to rebase %s onto %s; the rebase was aborted", branch, remoteBranch))
+		}
+		success(fmt.Sprintf("%s rebased onto %s", branch, remoteBranch))
+	}
+}
+
+// divergence returns how many commits local has that remote lacks, and
+// the other way around
+func divergence(local, remote string) (ahead, behind int, err error) {
+	output, err := runCommand("git", "rev-list", "--left-right", "--count", local+"..."+remote)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s", output)
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %s", output)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err == nil {
+		behind, err = strconv.Atoi(fields[1])
+	}
+	return ahead, behind, err
+}
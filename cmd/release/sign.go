@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// signingConfig describes how tags and checksums are signed, taken from git config
+type signingConfig struct {
+	format string // "openpgp" or "ssh" (git's gpg.format)
+	key    string // git's user.signingkey; may be empty for GPG's default key
+}
+
+// checkSigning verifies git is configured for signing and the signing tool is available
+func checkSigning() signingConfig {
+	format, _ := runCommand("git", "config", "--get", "gpg.format")
+	if format == "" {
+		format = "openpgp"
+	}
+	key, _ := runCommand("git", "config", "--get", "user.signingkey")
+
+	switch format {
+	case "ssh":
+		if key == "" {
+			errorExit("gpg.format is ssh but user.signingkey is not set")
+		}
+		if _, err := exec.LookPath("ssh-keygen"); err != nil {
+			errorExit("ssh-keygen is required for SSH signing")
+		}
+	case "openpgp":
+		if _, err := exec.LookPath("gpg"); err != nil {
+			errorExit("gpg is required for GPG signing (install GnuPG or set gpg.format to ssh)")
+		}
+	default:
+		errorExit(fmt.Sprintf("Unsupported gpg.format '%s' (expected openpgp or ssh)", format))
+	}
+
+	keyDesc := key
+	if keyDesc == "" {
+		keyDesc = "default key"
+	}
+	success(fmt.Sprintf("Signing with %s (%s)", format, keyDesc))
+	return signingConfig{format: format, key: key}
+}
+
+// exportSigningEnv passes the signing configuration to the goreleaser signs
+// section in .goreleaser.yml
+func exportSigningEnv(sign signingConfig) {
+	os.Setenv("RELEASE_SIGN_FORMAT", sign.format)
+	os.Setenv("RELEASE_SIGN_KEY", sign.key)
+}
+
+// verifyTagSignature reports whether the signature of a tag verifies, before
+// the tag is pushed
+func verifyTagSignature(tag string, sign signingConfig) bool {
+	info(fmt.Sprintf("Verifying signature of tag %s...", tag))
+	output, err := runCommand("git", "tag", "-v", tag)
+	if err != nil {
+		fmt.Println(output)
+		if sign.format == "ssh" {
+			info("SSH signature verification requires gpg.ssh.allowedSignersFile to list your key")
+		}
+		return false
+	}
+	success(fmt.Sprintf("Tag %s signature verified", tag))
+	return true
+}
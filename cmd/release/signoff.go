@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// SignoffPolicy lists the approvals and CI results that must be recorded on
+// GitHub before a release, configured in .release.json:
+//
+//	{"signoff": {"required_approvals": 1, "required_checks": ["test"], "require_green": true}}
+type SignoffPolicy struct {
+	RequiredApprovals int      `json:"required_approvals"` // Approvals each pull request needs
+	RequiredReviewers []string `json:"required_reviewers"` // Logins that must approve every pull request
+	RequiredChecks    []string `json:"required_checks"`    // Checks that must pass on the release commit
+	RequireGreen      bool     `json:"require_green"`      // Every check on the release commit must pass
+	AllowDirect       bool     `json:"allow_direct"`       // Allow commits that were not merged via a pull request
+}
+
+// enabled reports whether .release.json asks for any sign-off
+func (p SignoffPolicy) enabled() bool {
+	return p.RequiredApprovals > 0 || len(p.RequiredReviewers) > 0 || len(p.RequiredChecks) > 0 || p.RequireGreen
+}
+
+// checkSignoff verifies the policy against the release commit and the
+// commits since the previous tag, listing everything that is missing
+func checkSignoff(target releaseTarget, policy SignoffPolicy) {
+	repo, err := githubRepo()
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot determine the GitHub repository: %v", err))
+	}
+	head, err := runCommand("git", "rev-parse", "HEAD")
+	if err != nil {
+		errorExit("Failed to resolve HEAD")
+	}
+
+	var missing []string
+	if policy.RequireGreen || len(policy.RequiredChecks) > 0 {
+		info(fmt.Sprintf("Checking CI results of %s...", head[:12]))
+		checks, err := github.CommitChecks(repo, head)
+		if err != nil {
+			errorExit(fmt.Sprintf("Failed to read checks: %v", err))
+		}
+		missing = append(missing, missingChecks(checks, policy)...)
+	}
+
+	if policy.RequiredApprovals > 0 || len(policy.RequiredReviewers) > 0 {
+		commits, err := commitsSinceTag(target)
+		if err != nil {
+			errorExit(err.Error())
+		}
+		info(fmt.Sprintf("Checking approvals of %d commits...", len(commits)))
+		problems, err := missingApprovals(repo, commits, policy)
+		if err != nil {
+			errorExit(fmt.Sprintf("Failed to read approvals: %v", err))
+		}
+		missing = append(missing, problems...)
+	}
+
+	if len(missing) > 0 {
+		for _, m := range missing {
+			errorMsg(m)
+		}
+		errorExit(fmt.Sprintf("Release sign-off incomplete: %d problems", len(missing)))
+	}
+	success("Required approvals and checks are present")
+}
+
+// missingChecks describes required checks that are absent or not passing
+func missingChecks(checks []github.CommitCheck, policy SignoffPolicy) []string {
+	var missing []string
+	states := make(map[string]string)
+	for _, c := range checks {
+		states[c.Name] = c.State
+		if policy.RequireGreen && c.State != "success" {
+			missing = append(missing, fmt.Sprintf("Check '%s' is %s on the release commit", c.Name, c.State))
+		}
+	}
+	for _, name := range policy.RequiredChecks {
+		state, ok := states[name]
+		switch {
+		case !ok:
+			missing = append(missing, fmt.Sprintf("Required check '%s' has not run on the release commit", name))
+		case state != "success" && !policy.RequireGreen: // Already reported above
+			missing = append(missing, fmt.Sprintf("Required check '%s' is %s on the release commit", name, state))
+		}
+	}
+	if policy.RequireGreen && len(checks) == 0 {
+		missing = append(missing, "No checks have run on the release commit")
+	}
+	return missing
+}
+
+// missingApprovals describes commits whose pull requests lack approvals;
+// each pull request is only looked up once
+func missingApprovals(repo string, commits []string, policy SignoffPolicy) ([]string, error) {
+	var missing []string
+	checked := make(map[int]bool)
+	for _, sha := range commits {
+		pulls, err := github.PullRequestsForCommit(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		if len(pulls) == 0 {
+			if !policy.AllowDirect {
+				subject, _ := runCommand("git", "log", "-1", "--format=%s", sha)
+				missing = append(missing, fmt.Sprintf("Commit %s (%s) was not merged through a pull request", sha[:12], subject))
+			}
+			continue
+		}
+
+		for _, pr := range pulls {
+			if checked[pr.Number] {
+				continue
+			}
+			checked[pr.Number] = true
+
+			approvers, err := github.Approvers(repo, pr.Number)
+			if err != nil {
+				return nil, err
+			}
+			missing = append(missing, approvalProblems(pr, approvers, policy)...)
+		}
+	}
+	return missing, nil
+}
+
+// approvalProblems compares the approvers of one pull request with the policy
+func approvalProblems(pr github.PullRequest, approvers []string, policy SignoffPolicy) []string {
+	var problems []string
+	if len(approvers) < policy.RequiredApprovals {
+		problems = append(problems, fmt.Sprintf("PR #%d (%s) has %d of %d required approvals",
+			pr.Number, pr.Title, len(approvers), policy.RequiredApprovals))
+	}
+	approved := make(map[string]bool)
+	for _, login := range approvers {
+		approved[login] = true
+	}
+	for _, reviewer := range policy.RequiredReviewers {
+		if !approved[strings.ToLower(reviewer)] {
+			problems = append(problems, fmt.Sprintf("PR #%d (%s) is not approved by %s", pr.Number, pr.Title, reviewer))
+		}
+	}
+	return problems
+}
+
+// commitsSinceTag lists the non-merge commits since the target's latest tag;
+// for a component, only commits that touch its directory. Without a previous
+// tag only HEAD is checked.
+func commitsSinceTag(target releaseTarget) ([]string, error) {
+	previous, err := latestTag(target)
+	if err != nil {
+		head, err := runCommand("git", "rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve HEAD")
+		}
+		return []string{head}, nil
+	}
+
+	args := []string{"rev-list", "--no-merges", previous + "..HEAD"}
+	if target.name != "" {
+		args = append(args, "--", filepath.Dir(target.versionFile))
+	}
+	output, err := runCommand("git", args...)
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list failed: %v", err)
+	}
+	return strings.Fields(output), nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// stateFile records the progress of a release, so that running the release
+// again after a failure resumes at the failed step
+const stateFile = ".release-state.json"
+
+// lockFile exists while a release runs, so that two cannot run at once
+const lockFile = ".release.lock"
+
+// releaseState is the progress of the release of one tag
+type releaseState struct {
+	Tag       string    `json:"tag"`
+	Completed []string  `json:"completed"` // Steps that succeeded, in order
+	Head      string    `json:"head"`      // HEAD when the last step succeeded
+	Updated   time.Time `json:"updated"`
+}
+
+// loadState returns the progress of an earlier run releasing tag, or a new
+// state. It refuses to resume when that run released another tag, or when
+// HEAD was reset or switched since, as the steps done may no longer hold;
+// restart discards the earlier run instead.
+func loadState(tag string, restart bool) (*releaseState, error) {
+	fresh := &releaseState{Tag: tag}
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if restart {
+		return fresh, os.Remove(stateFile)
+	}
+
+	var state releaseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s is corrupt (%v); start over with --restart", stateFile, err)
+	}
+	if state.Tag != tag {
+		return nil, fmt.Errorf("%s records an unfinished release of %s; finish it first, or start over with --restart", stateFile, state.Tag)
+	}
+	// Commits on top, such as fixes of a failed test, keep the steps done
+	if _, err := runCommand("git", "merge-base", "--is-ancestor", state.Head, "HEAD"); err != nil {
+		return nil, fmt.Errorf("HEAD no longer contains the commits of the unfinished release of %s; check what changed, then start over with --restart", tag)
+	}
+	return &state, nil
+}
+
+func (s *releaseState) done(name string) bool {
+	return slices.Contains(s.Completed, name)
+}
+
+// complete records that a step succeeded. The file is replaced in one
+// rename, so an interrupted write cannot leave it half written.
+func (s *releaseState) complete(name string) {
+	s.Completed = append(s.Completed, name)
+	s.Head, _ = runCommand("git", "rev-parse", "HEAD")
+	s.Updated = time.Now().UTC()
+	data, _ := json.MarshalIndent(s, "", "  ")
+	tmp := stateFile + ".tmp"
+	err := os.WriteFile(tmp, append(data, '\n'), 0644)
+	if err == nil {
+		err = os.Rename(tmp, stateFile)
+	}
+	if err != nil {
+		warning(fmt.Sprintf("Failed to record the progress of the release in %s: %v", stateFile, err))
+	}
+}
+
+// finish forgets the progress of a release that completed
+func (s *releaseState) finish() {
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		warning(fmt.Sprintf("Failed to remove %s: %v", stateFile, err))
+	}
+}
+
+// resumeSteps skips the steps an earlier run completed, except those whose
+// results later steps need, and records each step that succeeds
+func resumeSteps(steps []step, state *releaseState) []step {
+	resumed := make([]step, len(steps))
+	for i, s := range steps {
+		run, name := s.run, s.name
+		s.run = func() {
+			run()
+			state.complete(name)
+		}
+		if s.disabled == "" && !s.repeat && state.done(name) {
+			s.disabled = "done by the earlier run"
+		}
+		resumed[i] = s
+	}
+	return resumed
+}
+
+// lockHolder is the content of lockFile
+type lockHolder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// lockHeld is set while this process holds lockFile
+var lockHeld bool
+
+// acquireLock creates lockFile, failing while another release runs. A lock
+// left by a release that died on this host is taken over.
+func acquireLock() error {
+	host, _ := os.Hostname()
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			data, _ := json.Marshal(lockHolder{PID: os.Getpid(), Host: host, Started: time.Now().UTC()})
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockFile)
+				return err
+			}
+			lockHeld = true
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		var holder lockHolder
+		data, err := os.ReadFile(lockFile)
+		if err == nil {
+			err = json.Unmarshal(data, &holder)
+		}
+		if err != nil {
+			return fmt.Errorf("%s is unreadable (%v); remove it if no release is running", lockFile, err)
+		}
+		if holder.Host != host {
+			return fmt.Errorf("a release started on %s at %s holds %s; remove it if that release is no longer running",
+				holder.Host, holder.Started.Local().Format(time.DateTime), lockFile)
+		}
+		if running(holder.PID) {
+			return fmt.Errorf("another release is running (pid %d, started %s)", holder.PID, holder.Started.Local().Format(time.DateTime))
+		}
+		warning(fmt.Sprintf("Taking over the lock of release process %d, which is no longer running", holder.PID))
+		os.Remove(lockFile)
+	}
+	return fmt.Errorf("failed to create %s", lockFile)
+}
+
+// releaseLock removes lockFile if this process holds it
+func releaseLock() {
+	if lockHeld {
+		os.Remove(lockFile)
+		lockHeld = false
+	}
+}
+
+// running reports whether a process runs on this host
+func running(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err == nil {
+		err = process.Signal(syscall.Signal(0))
+	}
+	return err == nil
+}
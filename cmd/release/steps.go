@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// step is one stage of the release pipeline. Steps report failure through
+// errorExit, which ends the process in plain mode and fails only the step in
+// TUI mode.
+type step struct {
+	name     string
+	run      func()
+	disabled string // Reason the step is skipped without running, if any
+	repeat   bool   // Runs again when a release resumes, as later steps use its result
+	gate     bool   // A check the release must pass: the TUI does not offer to skip it
+}
+
+// stepStatus is the state of a step in the TUI
+type stepStatus int
+
+const (
+	stepPending stepStatus = iota
+	stepRunning
+	stepDone
+	stepSkipped
+	stepFailed
+)
+
+// stepFailure is raised by errorExit while a TUI step runs
+type stepFailure struct {
+	msg string
+}
+
+// catchFailures makes errorExit raise stepFailure instead of exiting
+var catchFailures bool
+
+// releaseSteps returns the release pipeline for version
+func releaseSteps(version string, target releaseTarget, opts Options, config ReleaseConfig) []step {
+	var signing *signingConfig
+
+	testsDisabled := ""
+	if opts.skipTests {
+		testsDisabled = "--skip-tests"
+	}
+	steps := []step{
+		{name: "Check branch", run: checkBranch},
+		{name: "Check remote branch", run: checkRemote},
+		{name: "Check working directory", run: checkClean},
+		{name: "Check tag", gate: true, run: func() { checkTag(target, version) }},
+		{name: "Check changelog", run: func() { checkChangelog(target, version) }},
+		{name: "Check licenses", gate: true, run: func() { checkLicenses(config) }},
+	}
+	if config.Signoff.enabled() {
+		steps = append(steps, step{name: "Check sign-off", gate: true, run: func() { checkSignoff(target, config.Signoff) }})
+	}
+	if opts.sign {
+		steps = append(steps, step{name: "Check signing", repeat: true, run: func() {
+			sign := checkSigning()
+			signing = &sign
+		}})
+	}
+
+	steps = append(steps, []step{
+		{name: "Run vet and tests", disabled: testsDisabled, gate: true, run: func() { runTests(config.Tests) }},
+		{name: "Update version files", run: func() { updateVersionFiles(target, version) }},
+		{name: "Confirm release", run: func() {
+			fmt.Println()
+			warning(fmt.Sprintf("Ready to create release %s", target.tag(version)))
+			if !confirmDefault("Proceed with release?", true) {
+				errorExit("Release cancelled")
+			}
+		}},
+		{name: "Create and push tag", run: func() { createTag(target, version, opts.debug, signing) }},
+		{name: "Run GoReleaser", run: func() { runGoReleaser(target, version, opts.debug, opts.draft, signing) }},
+		{name: "Verify published artifacts", run: func() { verifyPublished(target, version) }},
+	}...)
+	if config.Announce.enabled() {
+		announceDisabled := ""
+		if opts.draft {
+			announceDisabled = "--draft; 'release publish' announces"
+		}
+		steps = append(steps, step{name: "Announce release", disabled: announceDisabled, run: func() { announceRelease(target, version, config.Announce) }})
+	}
+	return steps
+}
+
+// runSteps runs the pipeline in plain mode, stopping at the first failure
+func runSteps(steps []step) {
+	for _, s := range steps {
+		if s.disabled != "" {
+			warning(fmt.Sprintf("Skipping %s (%s).", s.name, s.disabled))
+			continue
+		}
+		s.run()
+	}
+}
+
+// runStep runs a step, converting errorExit into an error
+func runStep(s step) (err error) {
+	catchFailures = true
+	defer func() {
+		catchFailures = false
+		if r := recover(); r != nil {
+			failure, ok := r.(stepFailure)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("%s", failure.msg)
+		}
+	}()
+	s.run()
+	return nil
+}
+
+// formatDuration rounds durations for display
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
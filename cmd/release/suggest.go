@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/changelog"
+)
+
+// versionSuggestion is the version offered for a release, what it is based
+// on and why, and the versions each kind of bump would give instead
+type versionSuggestion struct {
+	version string
+	basis   string // e.g. "3 commits since v1.2.0"
+	reasons []string
+	bumps   map[string]string // patch, minor and major
+}
+
+// bump returns the version following v for a bump. A pre-release is
+// followed by its release when the bump would not go past it, so patch
+// after 1.2.0-rc.1 gives 1.2.0.
+func (v semver) bump(b changelog.Bump) string {
+	pre := len(v.pre) > 0
+	switch {
+	case b == changelog.BumpMajor && !(pre && v.minor == 0 && v.patch == 0):
+		return fmt.Sprintf("%d.0.0", v.major+1)
+	case b >= changelog.BumpMinor && !(pre && v.patch == 0):
+		return fmt.Sprintf("%d.%d.0", v.major, v.minor+1)
+	case b >= changelog.BumpPatch && !pre:
+		return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch+1)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// suggestVersion suggests the next version of target from the nature of
+// the changes since its latest tag: the Unreleased section of its changelog
+// or, without one, conventional commit messages
+func suggestVersion(target releaseTarget) versionSuggestion {
+	s := versionSuggestion{version: "1.0.0", basis: "no earlier release"}
+	tag, err := latestTag(target)
+	if err != nil {
+		return s.versionFile(target)
+	}
+	latest, ok := parseVersion(strings.TrimPrefix(tag, target.tagPrefix+"v"))
+	if !ok {
+		return s.versionFile(target)
+	}
+	s.bumps = map[string]string{}
+	for _, b := range []changelog.Bump{changelog.BumpPatch, changelog.BumpMinor, changelog.BumpMajor} {
+		s.bumps[b.String()] = latest.bump(b)
+	}
+
+	if len(latest.pre) > 0 {
+		s.version = latest.next()
+		s.basis = tag
+		s.reasons = []string{tag + " is a pre-release; the next one continues its series"}
+		return s.versionFile(target)
+	}
+
+	changes, source := changesSince(target, tag)
+	s.basis = source + " since " + tag
+	s.reasons = changes.Reasons
+	bump := changes.Bump
+	switch {
+	case bump == changelog.BumpNone:
+		bump = changelog.BumpPatch
+		s.reasons = append(s.reasons, "no classified changes (patch)")
+	case bump == changelog.BumpMajor && latest.major == 0:
+		bump = changelog.BumpMinor
+		s.reasons = append(s.reasons, "before 1.0.0 breaking changes bump the minor version")
+	}
+	s.version = latest.bump(bump)
+	return s.versionFile(target)
+}
+
+// changesSince classifies the changes of target since tag, from the
+// Unreleased section of its changelog when it has entries, otherwise from
+// the commit messages. It also returns where the changes were read.
+func changesSince(target releaseTarget, tag string) (changelog.Suggestion, string) {
+	if content, err := os.ReadFile(target.changelog); err == nil {
+		unreleased := changelog.Parse(string(content)).Section(changelog.Unreleased)
+		if unreleased != nil && unreleased.Entries() > 0 {
+			return unreleased.Suggest(), "the Unreleased entries of " + target.changelog
+		}
+	}
+
+	args := []string{"log", "--format=%B%x00", tag + "..HEAD"}
+	if target.name != "" {
+		args = append(args, "--", filepath.Dir(target.changelog))
+	}
+	output, err := runCommand("git", args...)
+	if err != nil {
+		return changelog.Suggestion{}, "no commits"
+	}
+	var messages []string
+	for _, message := range strings.Split(output, "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) == 1 {
+		return changelog.SuggestFromCommits(messages), "1 commit"
+	}
+	return changelog.SuggestFromCommits(messages), fmt.Sprintf("%d commits", len(messages))
+}
+
+// versionFile prefers the version in target's VERSION file when it is newer
+// than the suggestion, as it was set by hand
+func (s versionSuggestion) versionFile(target releaseTarget) versionSuggestion {
+	content, err := os.ReadFile(target.versionFile)
+	if err != nil {
+		return s
+	}
+	version := strings.TrimSpace(string(content))
+	if validateVersion(version) == nil && isNewerVersion(version, s.version) {
+		s.reasons = append(s.reasons, fmt.Sprintf("%s already holds %s, newer than %s", target.versionFile, version, s.version))
+		s.version = version
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TestPolicy sets the quality gates of the test step, configured in
+// .release.json:
+//
+//	{"tests": {"min_coverage": 60, "coverage_packages": ["./internal/..."]}}
+type TestPolicy struct {
+	MinCoverage      float64  `json:"min_coverage"`      // Percentage of statements the tests must cover; 0 disables the gate
+	CoveragePackages []string `json:"coverage_packages"` // Packages the coverage is computed over (default ./...)
+}
+
+// packages returns the packages whose coverage is measured
+func (p TestPolicy) packages() []string {
+	if len(p.CoveragePackages) == 0 {
+		return []string{"./..."}
+	}
+	return p.CoveragePackages
+}
+
+// totalCoverage matches the last line of go tool cover -func output
+var totalCoverage = regexp.MustCompile(`(?m)^total:\s+\(statements\)\s+([0-9.]+)%`)
+
+// runTests runs go vet and the tests with coverage, failing when vet reports
+// anything, a test fails or the coverage is below the policy's threshold
+func runTests(policy TestPolicy) {
+	info("Running go vet...")
+	if err := runCommandVerbose("go", "vet", "./..."); err != nil {
+		errorExit("go vet reported issues. Fix them before releasing.")
+	}
+	success("go vet found no issues")
+
+	info("Running tests...")
+	profile, err := os.CreateTemp("", "release-coverage-*.out")
+	if err != nil {
+		errorExit(fmt.Sprintf("Failed to create the coverage profile: %v", err))
+	}
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	args := append([]string{"test", "-coverprofile=" + profile.Name()}, policy.packages()...)
+	if err := runCommandVerbose("go", args...); err != nil {
+		errorExit("Tests failed. Fix issues before releasing.")
+	}
+	success("All tests passed")
+
+	output, err := runCommand("go", "tool", "cover", "-func="+profile.Name())
+	if err != nil {
+		errorExit(fmt.Sprintf("Failed to compute coverage: %s", output))
+	}
+	coverage, err := parseCoverage(output)
+	if err != nil {
+		errorExit(err.Error())
+	}
+	packages := strings.Join(policy.packages(), " ")
+	if policy.MinCoverage <= 0 {
+		info(fmt.Sprintf("Coverage of %s: %.1f%% (no threshold configured)", packages, coverage))
+		return
+	}
+	if coverage < policy.MinCoverage {
+		errorExit(fmt.Sprintf("Coverage of %s is %.1f%%, below the required %.1f%%", packages, coverage, policy.MinCoverage))
+	}
+	success(fmt.Sprintf("Coverage of %s: %.1f%% (required %.1f%%)", packages, coverage, policy.MinCoverage))
+}
+
+// parseCoverage returns the total percentage reported by go tool cover -func
+func parseCoverage(output string) (float64, error) {
+	match := totalCoverage.FindStringSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("no total coverage in 'go tool cover' output")
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+// confirmSkipTests makes skipping the quality gates deliberate: the
+// maintainer must type a phrase naming the version
+func confirmSkipTests(version string) {
+	phrase := "release " + version + " without tests"
+	warning("--skip-tests releases without running go vet, the tests or the coverage check")
+	fmt.Printf("Type '%s' to continue: ", phrase)
+	response, _ := stdin.ReadString('\n')
+	if strings.TrimSpace(response) != phrase {
+		errorExit("Confirmation phrase not entered; release cancelled")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	colorDim    = "\033[2m"
+
+	// tuiLogLines is the number of log lines shown for the current step
+	tuiLogLines = 15
+)
+
+// tuiStep is a step with its state and output in the TUI
+type tuiStep struct {
+	step
+	status   stepStatus
+	duration time.Duration
+	log      []string
+	err      error
+}
+
+// tui shows the release pipeline as a checklist with the live log of the current step
+type tui struct {
+	mu      sync.Mutex
+	title   string
+	steps   []*tuiStep
+	current int
+	screen  *os.File // The terminal, while os.Stdout is redirected to the step log
+	input   *bufio.Reader
+}
+
+// runTUI runs the pipeline interactively; failed steps can be retried or skipped.
+// It returns false when the release was aborted.
+func runTUI(title string, steps []step) bool {
+	t := &tui{title: title, screen: os.Stdout, input: stdin}
+	for _, s := range steps {
+		ts := &tuiStep{step: s}
+		if s.disabled != "" {
+			ts.status = stepSkipped
+		}
+		t.steps = append(t.steps, ts)
+	}
+
+	aborted := false
+	for i, s := range t.steps {
+		if s.status == stepSkipped {
+			continue
+		}
+		t.current = i
+		if !t.runWithRetry(s) {
+			aborted = true
+			break
+		}
+	}
+
+	t.printSummary()
+	return !aborted
+}
+
+// runWithRetry runs a step until it succeeds, is skipped, or the user quits.
+// Gate steps cannot be skipped.
+func (t *tui) runWithRetry(s *tuiStep) bool {
+	for {
+		t.execute(s)
+		if s.status == stepDone {
+			return true
+		}
+
+		choices := "[r]etry, [s]kip or [q]uit"
+		if s.gate {
+			choices = "[r]etry or [q]uit"
+		}
+		t.draw(fmt.Sprintf("%s✗ %s failed: %v%s\n%s? ", colorRed, s.name, s.err, colorReset, choices))
+		answer, err := t.input.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "r", "retry":
+			s.log = append(s.log, "--- retry ---")
+		case "s", "skip":
+			if !s.gate {
+				s.status = stepSkipped
+				return true
+			}
+			s.log = append(s.log, "--- cannot be skipped; retry ---")
+		case "q", "quit":
+			return false
+		}
+	}
+}
+
+// execute runs one step with stdout and stderr captured into its log
+func (t *tui) execute(s *tuiStep) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		s.status, s.err = stepFailed, err
+		return
+	}
+
+	t.mu.Lock()
+	s.status = stepRunning
+	s.err = nil
+	t.mu.Unlock()
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = writer, writer
+	copied := make(chan struct{})
+	go t.capture(s, reader, copied)
+	t.draw("")
+
+	start := time.Now()
+	err = runStep(s.step)
+	duration := time.Since(start)
+
+	os.Stdout, os.Stderr = savedStdout, savedStderr
+	writer.Close()
+	<-copied
+	reader.Close()
+
+	t.mu.Lock()
+	s.duration += duration
+	s.status = stepDone
+	if err != nil {
+		s.status, s.err = stepFailed, err
+	}
+	t.mu.Unlock()
+	t.draw("")
+}
+
+// capture appends output to the step log and redraws, keeping partial lines
+// such as prompts visible while they wait for input
+func (t *tui) capture(s *tuiStep, reader *os.File, done chan struct{}) {
+	defer close(done)
+	buf := make([]byte, 4096)
+	partial := false
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			for i, line := range strings.Split(string(buf[:n]), "\n") {
+				if i == 0 && partial {
+					s.log[len(s.log)-1] += line
+				} else {
+					s.log = append(s.log, line)
+				}
+			}
+			// A chunk ending in newline leaves an empty last line to continue
+			partial = true
+			t.mu.Unlock()
+			t.draw("")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// draw renders the checklist, the tail of the current step's log, and a footer
+func (t *tui) draw(footer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "%s\n\n", t.title)
+	for _, s := range t.steps {
+		fmt.Fprintf(&b, "  %s %-26s %s\n", statusMark(s.status), s.name, stepDetail(s))
+	}
+
+	current := t.steps[t.current]
+	fmt.Fprintf(&b, "\n%s── %s %s%s\n", colorDim, current.name, strings.Repeat("─", max(0, 50-len(current.name))), colorReset)
+	log := current.log
+	if len(log) > tuiLogLines {
+		log = log[len(log)-tuiLogLines:]
+	}
+	b.WriteString(strings.Join(log, "\n"))
+	if footer != "" {
+		b.WriteString("\n" + footer)
+	}
+	fmt.Fprint(t.screen, b.String())
+}
+
+// printSummary replaces the TUI with a final list of step outcomes
+func (t *tui) printSummary() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprint(t.screen, clearScreen)
+	fmt.Fprintf(t.screen, "%s\n\nSummary:\n", t.title)
+	var total time.Duration
+	for _, s := range t.steps {
+		total += s.duration
+		fmt.Fprintf(t.screen, "  %s %-26s %s\n", statusMark(s.status), s.name, stepDetail(s))
+	}
+	fmt.Fprintf(t.screen, "\nTotal time: %s\n", formatDuration(total))
+
+	// The TUI no longer shows the logs, so repeat those of failed steps
+	for _, s := range t.steps {
+		if s.status == stepFailed {
+			fmt.Fprintf(t.screen, "\nLog of '%s':\n%s\n", s.name, strings.Join(s.log, "\n"))
+		}
+	}
+}
+
+func statusMark(status stepStatus) string {
+	switch status {
+	case stepRunning:
+		return colorBlue + "▶" + colorReset
+	case stepDone:
+		return colorGreen + "✓" + colorReset
+	case stepSkipped:
+		return colorYellow + "↷" + colorReset
+	case stepFailed:
+		return colorRed + "✗" + colorReset
+	default:
+		return colorDim + "·" + colorReset
+	}
+}
+
+func stepDetail(s *tuiStep) string {
+	switch {
+	case s.status == stepSkipped && s.disabled != "":
+		return colorDim + "skipped (" + s.disabled + ")" + colorReset
+	case s.status == stepSkipped:
+		return colorDim + "skipped" + colorReset
+	case s.status == stepRunning:
+		return colorDim + "running..." + colorReset
+	case s.status == stepPending:
+		return ""
+	default:
+		return colorDim + formatDuration(s.duration) + colorReset
+	}
+}
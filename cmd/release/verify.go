@@ -0,0 +1,301 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// verifyWorkers is how many artifacts are downloaded and checked at once
+const verifyWorkers = 4
+
+// checksumsSuffix ends the name of GoReleaser's checksum file
+const checksumsSuffix = "checksums.txt"
+
+// verifyPublished downloads every artifact of the published release, checks
+// it against checksums.txt, and runs the binaries built for this platform
+// with --version. A release that fails is turned back into a draft, so
+// nobody downloads broken artifacts while it is fixed.
+func verifyPublished(target releaseTarget, version string) {
+	repo, err := githubRepo()
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot determine the GitHub repository: %v", err))
+	}
+	tag := target.tag(version)
+	info(fmt.Sprintf("Verifying the published artifacts of %s...", tag))
+	release, err := github.ReleaseByTag(repo, tag)
+	if err != nil {
+		errorExit(fmt.Sprintf("Cannot read release %s: %v", tag, err))
+	}
+
+	dir, err := os.MkdirTemp("", "release-verify")
+	if err != nil {
+		errorExit(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	download := func(asset github.ReleaseAsset, path string) error {
+		return github.DownloadReleaseAsset(repo, asset.ID, path)
+	}
+	verified, failures := verifyAssets(release.Assets, download, dir, version)
+	if len(failures) == 0 {
+		success(fmt.Sprintf("%d artifacts match checksums.txt and the %s/%s binaries report %s",
+			verified, runtime.GOOS, runtime.GOARCH, version))
+		return
+	}
+
+	for _, failure := range failures {
+		errorMsg(failure)
+	}
+	if err := github.SetReleaseDraft(repo, release.ID, true); err != nil {
+		errorExit(fmt.Sprintf("Artifact verification failed and release %s could not be made a draft: %v", tag, err))
+	}
+	errorExit(fmt.Sprintf("Artifact verification failed; release %s is a draft again. Fix the artifacts and publish it at %s",
+		tag, release.URL))
+}
+
+// verifyAssets checks the release assets downloaded into dir by download.
+// It returns how many artifacts matched their checksums and what failed.
+func verifyAssets(assets []github.ReleaseAsset, download func(github.ReleaseAsset, string) error, dir, version string) (int, []string) {
+	var checksumsAsset *github.ReleaseAsset
+	byName := make(map[string]github.ReleaseAsset, len(assets))
+	for i, asset := range assets {
+		byName[asset.Name] = asset
+		if strings.HasSuffix(asset.Name, checksumsSuffix) {
+			checksumsAsset = &assets[i]
+		}
+	}
+	if checksumsAsset == nil {
+		return 0, []string{"The release has no " + checksumsSuffix}
+	}
+
+	path := filepath.Join(dir, checksumsAsset.Name)
+	if err := download(*checksumsAsset, path); err != nil {
+		return 0, []string{fmt.Sprintf("Cannot download %s: %v", checksumsAsset.Name, err)}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, []string{err.Error()}
+	}
+	checksums, err := parseChecksums(string(content))
+	if err != nil {
+		return 0, []string{fmt.Sprintf("%s: %v", checksumsAsset.Name, err)}
+	}
+
+	var failures []string
+	var names []string
+	for name := range checksums {
+		if _, ok := byName[name]; ok {
+			names = append(names, name)
+		} else {
+			failures = append(failures, fmt.Sprintf("%s is listed in %s but was not published", name, checksumsAsset.Name))
+		}
+	}
+	for _, asset := range assets {
+		// Signatures of the checksum file are named after it
+		if _, ok := checksums[asset.Name]; !ok && !strings.HasPrefix(asset.Name, checksumsAsset.Name) {
+			failures = append(failures, fmt.Sprintf("%s was published but is not listed in %s", asset.Name, checksumsAsset.Name))
+		}
+	}
+	sort.Strings(names)
+
+	// Every artifact is downloaded by one of the workers and checked as it
+	// arrives; checkArtifact reports into the slot of its name
+	results := make([]string, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < verifyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = checkArtifact(byName[names[i]], checksums[names[i]], download, dir)
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	verified := 0
+	for _, result := range results {
+		if result == "" {
+			verified++
+		} else {
+			failures = append(failures, result)
+		}
+	}
+
+	// Only an archive that matched its checksum is worth running
+	archive := hostArchive(names)
+	switch {
+	case archive == "":
+		failures = append(failures, fmt.Sprintf("No archive was published for %s/%s, so no binary could be run", runtime.GOOS, runtime.GOARCH))
+	case results[sort.SearchStrings(names, archive)] == "":
+		failures = append(failures, runArchivedBinaries(filepath.Join(dir, archive), version)...)
+	}
+	return verified, failures
+}
+
+// parseChecksums reads the "SHA256  NAME" lines of a checksum file
+func parseChecksums(content string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("line %d is not 'SHA256  NAME'", i+1)
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	if len(checksums) == 0 {
+		return nil, fmt.Errorf("no checksums")
+	}
+	return checksums, nil
+}
+
+// checkArtifact downloads an artifact and compares its SHA-256 with the
+// expected one, returning "" when they match
+func checkArtifact(asset github.ReleaseAsset, expected string, download func(github.ReleaseAsset, string) error, dir string) string {
+	path := filepath.Join(dir, asset.Name)
+	if err := download(asset, path); err != nil {
+		return fmt.Sprintf("Cannot download %s: %v", asset.Name, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Sprintf("Cannot read %s: %v", asset.Name, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Sprintf("%s has SHA-256 %s, but checksums.txt lists %s", asset.Name, actual, expected)
+	}
+	return ""
+}
+
+// hostArchive returns the archive built for this platform, preferring
+// tar.gz, or "" when there is none
+func hostArchive(names []string) string {
+	platform := "_" + runtime.GOOS + "_" + runtime.GOARCH
+	zipped := ""
+	for _, name := range names {
+		switch {
+		case strings.HasSuffix(name, platform+".tar.gz"):
+			return name
+		case strings.HasSuffix(name, platform+".zip"):
+			zipped = name
+		}
+	}
+	return zipped
+}
+
+// runArchivedBinaries extracts the executables of an archive next to it and
+// runs each with --version, returning what failed
+func runArchivedBinaries(archive, version string) []string {
+	dir := strings.TrimSuffix(strings.TrimSuffix(archive, ".tar.gz"), ".zip")
+	binaries, err := extractExecutables(archive, dir)
+	if err != nil {
+		return []string{fmt.Sprintf("Cannot extract %s: %v", filepath.Base(archive), err)}
+	}
+	if len(binaries) == 0 {
+		return []string{fmt.Sprintf("%s contains no executables", filepath.Base(archive))}
+	}
+	var failures []string
+	for _, path := range binaries {
+		name := strings.TrimSuffix(filepath.Base(path), ".exe")
+		if err := checkVersion(name, path, version); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	return failures
+}
+
+// extractExecutables writes the executable files of a tar.gz or zip archive
+// into dir and returns their paths. Directories inside the archive are
+// flattened.
+func extractExecutables(archive, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	extract := func(name string, r io.Reader) error {
+		path := filepath.Join(dir, filepath.Base(name))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, r); err != nil {
+			file.Close()
+			return err
+		}
+		paths = append(paths, path)
+		return file.Close()
+	}
+
+	if strings.HasSuffix(archive, ".zip") {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() || (f.Mode()&0111 == 0 && !strings.HasSuffix(f.Name, ".exe")) {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = extract(f.Name, r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return paths, nil
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && header.Mode&0111 != 0 {
+			if err := extract(header.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
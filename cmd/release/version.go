@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// releaseVersionFile holds the version that builds without -ldflags report
+const releaseVersionFile = "internal/common/release_version.go"
+
+// buildDir is where 'make build' puts the binaries
+const buildDir = "build"
+
+// versionLDFlag matches the -X flag stamping the version into a binary
+var versionLDFlag = regexp.MustCompile(`(-X\s+\S+/internal/common\.Version=)(\S+)`)
+
+// writeReleaseVersion rewrites the version constant in the common package
+func writeReleaseVersion(version string) error {
+	content := fmt.Sprintf(`// Code generated by the release tool; DO NOT EDIT.
+
+package common
+
+// releaseVersion is the version of the latest release, which builds
+// without -ldflags report
+const releaseVersion = %q
+`, version)
+	return os.WriteFile(releaseVersionFile, []byte(content), 0644)
+}
+
+// fixGoReleaserLDFlags makes every build in a GoReleaser config stamp the
+// release version: a hard-coded version is replaced by {{.Version}}, and
+// builds without the flag are reported. It returns whether the file changed.
+func fixGoReleaserLDFlags(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	content := versionLDFlag.ReplaceAllString(string(data), "${1}{{.Version}}")
+	var binaries, unstamped []string
+	stamped := make(map[string]bool)
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "binary:"):
+			current = strings.TrimSpace(strings.TrimPrefix(trimmed, "binary:"))
+			binaries = append(binaries, current)
+		case trimmed == "archives:" || (line != "" && line[0] != ' ' && line[0] != '#'):
+			current = "" // The builds end here
+		case current != "" && versionLDFlag.MatchString(line):
+			stamped[current] = true
+		}
+	}
+	for _, binary := range binaries {
+		if !stamped[binary] {
+			unstamped = append(unstamped, binary)
+		}
+	}
+	if len(unstamped) > 0 {
+		return false, fmt.Errorf("%s builds %s without '-X github.com/mslinn/git_lfs_scripts/internal/common.Version={{.Version}}' in ldflags",
+			path, strings.Join(unstamped, ", "))
+	}
+
+	if content == string(data) {
+		return false, nil
+	}
+	return true, os.WriteFile(path, []byte(content), 0644)
+}
+
+// fixGoReleaserPrerelease makes a GoReleaser config publish pre-release
+// versions as GitHub pre-releases: the release section's prerelease setting
+// becomes auto unless it is already auto or true. It returns whether the
+// file changed.
+func fixGoReleaserPrerelease(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if _, _, value := releaseSetting(lines, "prerelease"); value == "auto" || value == "true" {
+		return false, nil
+	}
+	return true, os.WriteFile(path, []byte(strings.Join(setReleaseSetting(lines, "prerelease", "auto"), "\n")), 0644)
+}
+
+// draftGoReleaserConfig writes a copy of a GoReleaser config whose release
+// section sets draft: true to a temporary file and returns its path. The
+// copy stays out of the working tree, which GoReleaser requires to be clean;
+// paths in the config are relative to the working directory, not to it.
+func draftGoReleaserConfig(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	lines := setReleaseSetting(strings.Split(string(data), "\n"), "draft", "true")
+
+	file, err := os.CreateTemp("", "goreleaser-draft-*.yml")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString(strings.Join(lines, "\n"))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// releaseSetting finds key in the release section of the lines of a
+// GoReleaser config. It returns the line of the key and of 'release:', -1
+// for those missing, and the value of the key.
+func releaseSetting(lines []string, key string) (int, int, string) {
+	section := -1 // Line of 'release:' while in its section
+	header := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case line == "release:":
+			section, header = i, i
+		case section < 0 || trimmed == "" || trimmed[0] == '#':
+		case line[0] != ' ':
+			section = -1 // The release section ends here
+		case strings.HasPrefix(trimmed, key+":"):
+			return i, header, strings.TrimSpace(strings.TrimPrefix(trimmed, key+":"))
+		}
+	}
+	return -1, header, ""
+}
+
+// setReleaseSetting sets key to value in the release section of the lines
+// of a GoReleaser config, adding the key at the top of the section, and the
+// section at the end, when missing
+func setReleaseSetting(lines []string, key, value string) []string {
+	line, header, _ := releaseSetting(lines, key)
+	switch {
+	case line >= 0:
+		lines[line] = lines[line][:len(lines[line])-len(strings.TrimLeft(lines[line], " "))] + key + ": " + value
+		return lines
+	case header >= 0:
+		return append(lines[:header+1], append([]string{"  " + key + ": " + value}, lines[header+1:]...)...)
+	default:
+		return append(lines[:len(lines)-1], lines[len(lines)-1], "release:", "  "+key+": "+value, "")
+	}
+}
+
+// verifyVersions runs the built binaries with --version, and with source
+// also a binary built without -ldflags, checking that each reports version
+func verifyVersions(names []string, version string, source bool) error {
+	var stale []string
+	check := func(name, path string) {
+		if err := checkVersion(name, path, version); err != nil {
+			stale = append(stale, err.Error())
+		}
+	}
+
+	for _, name := range names {
+		check(name, filepath.Join(buildDir, name))
+	}
+
+	// Without -ldflags and VCS stamping, a binary falls back on releaseVersion
+	if source && len(names) > 0 {
+		dir, err := os.MkdirTemp("", "release-version")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		plain := filepath.Join(dir, names[0])
+		if output, err := exec.Command("go", "build", "-buildvcs=false", "-o", plain, "./cmd/"+names[0]).CombinedOutput(); err != nil {
+			return fmt.Errorf("go build ./cmd/%s failed: %s", names[0], strings.TrimSpace(string(output)))
+		}
+		check(names[0], plain)
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("binaries do not report %s:\n  %s", version, strings.Join(stale, "\n  "))
+	}
+	return nil
+}
+
+// checkVersion runs a binary with --version and checks that it reports version
+func checkVersion(name, path, version string) error {
+	output, err := exec.Command(path, "--version").Output()
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	if err != nil || !strings.HasPrefix(firstLine, name+" "+version+" (") {
+		return fmt.Errorf("%s reports '%s'", path, strings.TrimSpace(firstLine))
+	}
+	return nil
+}
+
+// builtBinaries returns the binaries 'make build' produced for a target: all
+// of them for the repository, the one named after the directory for a
+// component
+func builtBinaries(target releaseTarget) ([]string, error) {
+	if target.name != "" {
+		return []string{filepath.Base(filepath.Dir(target.versionFile))}, nil
+	}
+	entries, err := os.ReadDir(buildDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
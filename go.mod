@@ -3,6 +3,10 @@ module github.com/mslinn/git_lfs_scripts
 go 1.24.2
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/lithammer/dedent v1.1.0
 	github.com/spf13/pflag v1.0.10
+	golang.org/x/crypto v0.45.0
 )
+
+require golang.org/x/sys v0.38.0 // indirect
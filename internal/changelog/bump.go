@@ -0,0 +1,127 @@
+package changelog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// Bump is the part of a version a set of changes calls for incrementing
+type Bump int
+
+// Bumps, from smallest to largest
+const (
+	BumpNone Bump = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+// String returns "none", "patch", "minor" or "major"
+func (b Bump) String() string {
+	return [...]string{"none", "patch", "minor", "major"}[b]
+}
+
+// Suggestion is the bump a set of changes calls for, with the reasons
+type Suggestion struct {
+	Bump    Bump
+	Reasons []string
+}
+
+func (s *Suggestion) add(bump Bump, reason string) {
+	s.Bump = max(s.Bump, bump)
+	s.Reasons = append(s.Reasons, fmt.Sprintf("%s (%s)", reason, bump))
+}
+
+// subsectionBumps maps the change types of Keep a Changelog to bumps.
+// Removing something breaks whoever used it.
+var subsectionBumps = map[string]Bump{
+	"removed":    BumpMajor,
+	"added":      BumpMinor,
+	"changed":    BumpMinor,
+	"deprecated": BumpMinor,
+	"fixed":      BumpPatch,
+	"security":   BumpPatch,
+}
+
+var (
+	// subsectionPattern matches a change type heading: '### Added'
+	subsectionPattern = regexp.MustCompile(`^###\s+(.+?)\s*$`)
+	// breakingPattern matches an entry starting with BREAKING: or
+	// **BREAKING CHANGE:**, and captures the rest
+	breakingPattern = regexp.MustCompile(`^\s*[-*+]\s+(?:\*\*)?BREAKING(?: CHANGES?)?:?(?:\*\*)?:?\s+(.*)$`)
+	// commitPattern matches a conventional commit subject: 'feat(api)!: ...'
+	commitPattern = regexp.MustCompile(`^(\w+)(?:\([^)]*\))?(!)?:\s`)
+)
+
+// Suggest returns the bump the entries of a section call for, by their
+// '### Added', '### Fixed' and other headings; an entry marked BREAKING
+// calls for a major one
+func (s *Section) Suggest() Suggestion {
+	var suggestion Suggestion
+	counts := make(map[string]int)
+	var order []string
+	heading := ""
+	for _, line := range s.Body {
+		if m := subsectionPattern.FindStringSubmatch(line); m != nil {
+			heading = m[1]
+			continue
+		}
+		if !entryPattern.MatchString(line) {
+			continue
+		}
+		if m := breakingPattern.FindStringSubmatch(line); m != nil {
+			suggestion.add(BumpMajor, "breaking: "+m[1])
+			continue
+		}
+		if counts[heading] == 0 {
+			order = append(order, heading)
+		}
+		counts[heading]++
+	}
+
+	for _, heading := range order {
+		bump, known := subsectionBumps[strings.ToLower(heading)]
+		name := "'" + heading + "'"
+		if !known {
+			bump = BumpPatch
+			if heading == "" {
+				name = "unclassified"
+			}
+		}
+		suggestion.add(bump, fmt.Sprintf("%d %s", counts[heading], common.Plural(counts[heading], name+" entry", name+" entries")))
+	}
+	return suggestion
+}
+
+// SuggestFromCommits returns the bump conventional commit messages call
+// for: a '!' after the type or a BREAKING CHANGE footer calls for a major
+// one, feat for a minor one, and fix and perf for a patch. Other types
+// call for none.
+func SuggestFromCommits(messages []string) Suggestion {
+	var suggestion Suggestion
+	counts := make(map[string]int)
+	for _, message := range messages {
+		subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+		m := commitPattern.FindStringSubmatch(subject)
+		switch {
+		case m != nil && m[2] == "!",
+			strings.Contains(body, "BREAKING CHANGE:"), strings.Contains(body, "BREAKING-CHANGE:"):
+			suggestion.add(BumpMajor, "breaking: "+subject)
+		case m != nil:
+			counts[strings.ToLower(m[1])]++
+		}
+	}
+
+	for _, kind := range []struct {
+		name string
+		bump Bump
+	}{{"feat", BumpMinor}, {"fix", BumpPatch}, {"perf", BumpPatch}} {
+		if n := counts[kind.name]; n > 0 {
+			suggestion.add(kind.bump, fmt.Sprintf("%d %s", n, common.Plural(n, kind.name+" commit", kind.name+" commits")))
+		}
+	}
+	return suggestion
+}
@@ -0,0 +1,208 @@
+// Package changelog reads and updates changelogs in the Keep a Changelog
+// format (https://keepachangelog.com/)
+package changelog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Unreleased is the version of the section collecting changes for the next release
+const Unreleased = "Unreleased"
+
+var (
+	// headingPattern matches release headings: '## [1.2.0] - 2024-05-01',
+	// '## [Unreleased]', and the older '## v1.2.0 / 2024-05-01'
+	headingPattern = regexp.MustCompile(`^##\s+\[?v?([^\]\s]+)\]?(?:\s+[-/]\s+(\S+))?`)
+	// linkPattern matches a link reference definition: '[1.2.0]: URL'
+	linkPattern = regexp.MustCompile(`^\[([^\]]+)\]:\s*(\S+)\s*$`)
+	// entryPattern matches a list item
+	entryPattern = regexp.MustCompile(`^\s*[-*+]\s+\S`)
+)
+
+// Section is one release of a changelog
+type Section struct {
+	Heading string
+	Version string // Without a leading v; Unreleased for upcoming changes
+	Date    string
+	Body    []string
+}
+
+// Changelog is a parsed changelog. Joining its parts gives back the file.
+type Changelog struct {
+	Preamble []string
+	Sections []*Section
+	Trailer  []string // Link reference definitions and blank lines ending the file
+}
+
+// Parse splits a changelog into the preamble, one section per level-2
+// heading, and the link definitions at the end
+func Parse(content string) *Changelog {
+	lines := strings.Split(content, "\n")
+
+	end := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		// Blank lines before the first link stay with the last section
+		if linkPattern.MatchString(lines[i]) {
+			end = i
+		} else if strings.TrimSpace(lines[i]) != "" {
+			break
+		}
+	}
+
+	c := &Changelog{Trailer: lines[end:]}
+	var current *Section
+	for _, line := range lines[:end] {
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			current = &Section{Heading: line, Version: m[1], Date: m[2]}
+			c.Sections = append(c.Sections, current)
+			continue
+		}
+		if current == nil {
+			c.Preamble = append(c.Preamble, line)
+		} else {
+			current.Body = append(current.Body, line)
+		}
+	}
+	return c
+}
+
+// String returns the changelog as file content
+func (c *Changelog) String() string {
+	lines := append([]string{}, c.Preamble...)
+	for _, s := range c.Sections {
+		lines = append(lines, s.Heading)
+		lines = append(lines, s.Body...)
+	}
+	return strings.Join(append(lines, c.Trailer...), "\n")
+}
+
+// Section returns the section of version, or nil. The Unreleased section
+// is found case-insensitively.
+func (c *Changelog) Section(version string) *Section {
+	version = strings.TrimPrefix(version, "v")
+	for _, s := range c.Sections {
+		if s.Version == version || strings.EqualFold(s.Version, Unreleased) && strings.EqualFold(version, Unreleased) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Entries returns the number of list items in the section
+func (s *Section) Entries() int {
+	count := 0
+	for _, line := range s.Body {
+		if entryPattern.MatchString(line) {
+			count++
+		}
+	}
+	return count
+}
+
+// Release moves the entries of the Unreleased section into a new section
+// for version, dated date, and updates the comparison links. tag returns
+// the tag of a version. repoURL, e.g. https://github.com/OWNER/REPO, is
+// only used when the changelog has no Unreleased link to take it from;
+// without either, links are left alone.
+func (c *Changelog) Release(version, date, repoURL string, tag func(string) string) error {
+	version = strings.TrimPrefix(version, "v")
+	if c.Section(version) != nil {
+		return fmt.Errorf("the changelog already has a section for %s", version)
+	}
+	unreleased := c.Section(Unreleased)
+	if unreleased == nil || unreleased.Entries() == 0 {
+		return fmt.Errorf("the changelog has no %s entries to release as %s", Unreleased, version)
+	}
+
+	index := 0
+	for i, s := range c.Sections {
+		if s == unreleased {
+			index = i
+		}
+	}
+	previous := "" // Skips sections such as '## Notes'
+	for _, s := range c.Sections[index+1:] {
+		if s.Version[0] >= '0' && s.Version[0] <= '9' {
+			previous = s.Version
+			break
+		}
+	}
+
+	body := trimBlankLines(unreleased.Body)
+	released := &Section{
+		Heading: fmt.Sprintf("## [%s] - %s", version, date),
+		Version: version,
+		Date:    date,
+		Body:    append(append([]string{""}, body...), ""),
+	}
+	unreleased.Body = []string{""}
+	c.Sections = append(c.Sections[:index+1], append([]*Section{released}, c.Sections[index+1:]...)...)
+
+	c.updateLinks(version, previous, repoURL, tag)
+	return nil
+}
+
+// updateLinks points the Unreleased link at the changes since version and
+// adds a link comparing version with the previous release
+func (c *Changelog) updateLinks(version, previous, repoURL string, tag func(string) string) {
+	unreleasedLine := -1
+	previousTag := ""
+	if previous != "" {
+		previousTag = tag(previous)
+	}
+	for i, line := range c.Trailer {
+		m := linkPattern.FindStringSubmatch(line)
+		if m == nil || !strings.EqualFold(m[1], Unreleased) {
+			continue
+		}
+		unreleasedLine = i
+		if base, compare, found := strings.Cut(m[2], "/compare/"); found {
+			repoURL = base
+			if from, _, found := strings.Cut(compare, "..."); found {
+				previousTag = from
+			}
+		}
+	}
+	if repoURL == "" {
+		return
+	}
+
+	releaseLink := fmt.Sprintf("[%s]: %s/releases/tag/%s", version, repoURL, tag(version))
+	if previousTag != "" {
+		releaseLink = fmt.Sprintf("[%s]: %s/compare/%s...%s", version, repoURL, previousTag, tag(version))
+	}
+	unreleasedLink := fmt.Sprintf("[%s]: %s/compare/%s...HEAD", Unreleased, repoURL, tag(version))
+
+	if unreleasedLine >= 0 {
+		c.Trailer[unreleasedLine] = unreleasedLink
+		c.Trailer = append(c.Trailer[:unreleasedLine+1], append([]string{releaseLink}, c.Trailer[unreleasedLine+1:]...)...)
+		return
+	}
+	links := []string{unreleasedLink, releaseLink}
+	if len(c.Trailer) == 0 {
+		// The file ends in the last section; keep one blank line before the links
+		c.Trailer = append(links, "")
+		if n := len(c.Sections); n > 0 {
+			last := c.Sections[n-1]
+			last.Body = append(trimTrailingBlankLines(last.Body), "")
+		}
+		return
+	}
+	c.Trailer = append(links, c.Trailer...)
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	return trimTrailingBlankLines(lines)
+}
+
+func trimTrailingBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,149 @@
+package changelog
+
+import (
+	"strings"
+	"testing"
+)
+
+func tag(version string) string {
+	return "v" + version
+}
+
+// TestParseRoundTrip tests that parsing and printing gives back the file
+func TestParseRoundTrip(t *testing.T) {
+	content := "# Changelog\n\n## [Unreleased]\n\n### Added\n- Seeding\n\n## [1.1.0] - 2024-05-01\n\n- Tracing\n\n" +
+		"[Unreleased]: https://github.com/o/r/compare/v1.1.0...HEAD\n[1.1.0]: https://github.com/o/r/releases/tag/v1.1.0\n"
+	c := Parse(content)
+	if got := c.String(); got != content {
+		t.Errorf("String() = %q, want %q", got, content)
+	}
+	if len(c.Sections) != 2 || len(c.Trailer) != 3 {
+		t.Fatalf("Parse() found %d sections and %d trailer lines", len(c.Sections), len(c.Trailer))
+	}
+	if s := c.Section("v1.1.0"); s == nil || s.Date != "2024-05-01" || s.Entries() != 1 {
+		t.Errorf("Section(1.1.0) = %+v", s)
+	}
+	if s := c.Section("unreleased"); s == nil || s.Entries() != 1 {
+		t.Errorf("Section(unreleased) = %+v", s)
+	}
+}
+
+// TestParseLegacyHeadings tests headings such as '## v0.1.5 / 2025-10-23'
+func TestParseLegacyHeadings(t *testing.T) {
+	c := Parse("# Change Log\n\n## v0.1.5 / 2025-10-23\n\n* Added tests\n")
+	s := c.Section("0.1.5")
+	if s == nil || s.Date != "2025-10-23" || s.Entries() != 1 {
+		t.Errorf("Section(0.1.5) = %+v", s)
+	}
+	if c.Section("0.1.50") != nil {
+		t.Error("Section(0.1.50) matched 0.1.5")
+	}
+}
+
+// TestRelease tests moving Unreleased entries and updating the links
+func TestRelease(t *testing.T) {
+	content := "# Changelog\n\n## [Unreleased]\n\n### Added\n- Seeding\n\n## [1.1.0] - 2024-05-01\n\n- Tracing\n\n" +
+		"[Unreleased]: https://github.com/o/r/compare/v1.1.0...HEAD\n[1.1.0]: https://github.com/o/r/releases/tag/v1.1.0\n"
+	c := Parse(content)
+	if err := c.Release("1.2.0", "2024-06-01", "", tag); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Changelog\n\n## [Unreleased]\n\n## [1.2.0] - 2024-06-01\n\n### Added\n- Seeding\n\n## [1.1.0] - 2024-05-01\n\n- Tracing\n\n" +
+		"[Unreleased]: https://github.com/o/r/compare/v1.2.0...HEAD\n" +
+		"[1.2.0]: https://github.com/o/r/compare/v1.1.0...v1.2.0\n" +
+		"[1.1.0]: https://github.com/o/r/releases/tag/v1.1.0\n"
+	if got := c.String(); got != want {
+		t.Errorf("Release() gave\n%s\nwant\n%s", got, want)
+	}
+
+	if err := c.Release("1.2.0", "2024-06-01", "", tag); err == nil {
+		t.Error("Release() released a version twice")
+	}
+	if err := c.Release("1.3.0", "2024-07-01", "", tag); err == nil {
+		t.Error("Release() released an empty Unreleased section")
+	}
+}
+
+// TestReleaseWithoutLinks tests adding links to a changelog that has none
+func TestReleaseWithoutLinks(t *testing.T) {
+	c := Parse("# Changelog\n\n## Unreleased\n- First\n")
+	if err := c.Release("0.1.0", "2024-06-01", "https://github.com/o/r", func(v string) string { return "tool/v" + v }); err != nil {
+		t.Fatal(err)
+	}
+	got := c.String()
+	for _, want := range []string{
+		"## [0.1.0] - 2024-06-01\n\n- First\n\n[Unreleased]",
+		"[Unreleased]: https://github.com/o/r/compare/tool/v0.1.0...HEAD\n",
+		"[0.1.0]: https://github.com/o/r/releases/tag/tool/v0.1.0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Release() gave %q, missing %q", got, want)
+		}
+	}
+
+	plain := Parse("## [Unreleased]\n- First\n")
+	if err := plain.Release("0.1.0", "2024-06-01", "", tag); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain.String(), "]: ") {
+		t.Errorf("Release() added links without a repository URL: %q", plain.String())
+	}
+}
+
+// TestSuggest tests suggesting a bump from the change types of a section
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Bump
+		reasons []string
+	}{
+		{"fixes", "### Fixed\n- One\n- Two\n", BumpPatch, []string{"2 'Fixed' entries (patch)"}},
+		{"features", "### Fixed\n- One\n\n### Added\n- New\n", BumpMinor,
+			[]string{"1 'Fixed' entry (patch)", "1 'Added' entry (minor)"}},
+		{"removal", "### Removed\n- Old flag\n", BumpMajor, []string{"1 'Removed' entry (major)"}},
+		{"breaking entry", "### Changed\n- **BREAKING:** Renamed --foo\n- Faster\n", BumpMajor,
+			[]string{"breaking: Renamed --foo (major)", "1 'Changed' entry (minor)"}},
+		{"mentioning breaking", "### Fixed\n- Fixed breaking links\n", BumpPatch, []string{"1 'Fixed' entry (patch)"}},
+		{"unclassified", "- Something\n", BumpPatch, []string{"1 unclassified entry (patch)"}},
+		{"empty", "\n", BumpNone, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := &Section{Body: strings.Split(tt.body, "\n")}
+			got := section.Suggest()
+			if got.Bump != tt.want || strings.Join(got.Reasons, "|") != strings.Join(tt.reasons, "|") {
+				t.Errorf("Suggest() = %v %q, want %v %q", got.Bump, got.Reasons, tt.want, tt.reasons)
+			}
+		})
+	}
+}
+
+// TestSuggestFromCommits tests suggesting a bump from conventional commits
+func TestSuggestFromCommits(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     Bump
+		reasons  []string
+	}{
+		{"fixes", []string{"fix: crash", "perf(scan): faster", "docs: typo"}, BumpPatch,
+			[]string{"1 fix commit (patch)", "1 perf commit (patch)"}},
+		{"features", []string{"feat(api): add X", "feat: add Y", "fix: Z"}, BumpMinor,
+			[]string{"2 feat commits (minor)", "1 fix commit (patch)"}},
+		{"bang", []string{"feat!: drop Go 1.20"}, BumpMajor, []string{"breaking: feat!: drop Go 1.20 (major)"}},
+		{"footer", []string{"refactor: config\n\nBREAKING CHANGE: keys renamed"}, BumpMajor,
+			[]string{"breaking: refactor: config (major)"}},
+		{"unconventional", []string{"Update README", "chore: deps"}, BumpNone, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SuggestFromCommits(tt.messages)
+			if got.Bump != tt.want || strings.Join(got.Reasons, "|") != strings.Join(tt.reasons, "|") {
+				t.Errorf("SuggestFromCommits() = %v %q, want %v %q", got.Bump, got.Reasons, tt.want, tt.reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AuditRecord is one line of the audit log
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	Repo    string    `json:"repo,omitempty"`
+	User    string    `json:"user"` // Git identity, e.g. "Jane Doe <jane@example.com>"
+	Login   string    `json:"login,omitempty"`
+	DryRun  bool      `json:"dry_run,omitempty"`
+	Outcome string    `json:"outcome"` // "success", "failed" or "dry-run"
+	Error   string    `json:"error,omitempty"`
+	Commits []string  `json:"commits,omitempty"` // Commits created on the current branch
+	Tags    []string  `json:"tags,omitempty"`
+	Created []string  `json:"created,omitempty"`
+	Changed []string  `json:"changed,omitempty"`
+	Deleted []string  `json:"deleted,omitempty"`
+}
+
+// Audit collects what a mutating command did and appends it to the audit log
+// named by git config audit.path. A nil *Audit, returned when auditing is
+// off, ignores every call, so commands need no checks of their own.
+type Audit struct {
+	record   AuditRecord
+	path     string
+	head     string // HEAD when the command started
+	finished bool
+}
+
+// currentAudit is finished by PrintError, so failures are recorded too
+var currentAudit *Audit
+
+// StartAudit begins the audit record of a command. Dry runs are only recorded
+// when git config audit.dryRun is true.
+func StartAudit(command string, dryRun bool) *Audit {
+	path := auditConfig("--path", "audit.path")
+	if path == "" {
+		return nil
+	}
+	if dryRun && auditConfig("--bool", "audit.dryRun") != "true" {
+		return nil
+	}
+
+	a := &Audit{
+		path: path,
+		record: AuditRecord{
+			Command: command,
+			Args:    os.Args[1:],
+			User:    gitIdentity(),
+			DryRun:  dryRun,
+		},
+	}
+	if u, err := user.Current(); err == nil {
+		a.record.Login = u.Username
+	}
+	if top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output(); err == nil {
+		a.record.Repo = strings.TrimSpace(string(top))
+		a.head = revParse("HEAD")
+	}
+	currentAudit = a
+	return a
+}
+
+// Created records paths or resources the command created
+func (a *Audit) Created(items ...string) {
+	if a != nil {
+		a.record.Created = append(a.record.Created, items...)
+	}
+}
+
+// Changed records files or settings the command modified
+func (a *Audit) Changed(items ...string) {
+	if a != nil {
+		a.record.Changed = append(a.record.Changed, items...)
+	}
+}
+
+// Deleted records paths or resources the command deleted
+func (a *Audit) Deleted(items ...string) {
+	if a != nil {
+		a.record.Deleted = append(a.record.Deleted, items...)
+	}
+}
+
+// Tagged records tags the command created
+func (a *Audit) Tagged(tags ...string) {
+	if a != nil {
+		a.record.Tags = append(a.record.Tags, tags...)
+	}
+}
+
+// Finish appends the record to the audit log. Commits made since StartAudit
+// are found automatically. Write failures are reported but never fatal.
+func (a *Audit) Finish(err error) {
+	if a == nil || a.finished {
+		return
+	}
+	a.finished = true
+
+	a.record.Time = time.Now().UTC()
+	switch {
+	case err != nil:
+		a.record.Outcome = "failed"
+		a.record.Error = err.Error()
+	case a.record.DryRun:
+		a.record.Outcome = "dry-run"
+	default:
+		a.record.Outcome = "success"
+	}
+	if a.record.Repo != "" {
+		a.record.Commits = newCommits(a.head)
+	}
+
+	if err := appendAuditRecord(a.path, a.record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit log %s: %v\n", a.path, err)
+	}
+}
+
+// appendAuditRecord writes one JSON line; O_APPEND keeps concurrent writers'
+// lines intact
+func appendAuditRecord(path string, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// newCommits lists the commits reachable from HEAD but not from start, oldest first
+func newCommits(start string) []string {
+	head := revParse("HEAD")
+	if head == "" || head == start {
+		return nil
+	}
+	args := []string{"rev-list", "--reverse", head}
+	if start != "" {
+		args = append(args, "^"+start)
+	}
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(output))
+}
+
+func gitIdentity() string {
+	name := auditConfig("", "user.name")
+	email := auditConfig("", "user.email")
+	switch {
+	case name != "" && email != "":
+		return fmt.Sprintf("%s <%s>", name, email)
+	case email != "":
+		return email
+	default:
+		return name
+	}
+}
+
+// auditConfig reads a git config value, optionally with a type such as --path
+func auditConfig(typ, key string) string {
+	args := []string{"config"}
+	if typ != "" {
+		args = append(args, typ)
+	}
+	output, err := exec.Command("git", append(args, "--get", key)...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func revParse(rev string) string {
+	output, err := exec.Command("git", "rev-parse", "--verify", "--quiet", rev).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
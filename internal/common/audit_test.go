@@ -0,0 +1,46 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestNilAudit tests that a disabled audit ignores every call
+func TestNilAudit(t *testing.T) {
+	var audit *Audit
+	audit.Created("a")
+	audit.Changed("b")
+	audit.Deleted("c")
+	audit.Tagged("v1.0.0")
+	audit.Finish(nil)
+}
+
+// TestAppendAuditRecord tests that records are appended as JSON lines
+func TestAppendAuditRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+
+	for _, command := range []string{"git-lfs-track", "git-unmigrate"} {
+		if err := appendAuditRecord(path, AuditRecord{Command: command, Outcome: "success"}); err != nil {
+			t.Fatalf("appendAuditRecord() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if record.Command != "git-unmigrate" || record.Outcome != "success" {
+		t.Errorf("record = %+v", record)
+	}
+}
@@ -6,10 +6,9 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-)
 
-// Version of the git_lfs_scripts suite
-const Version = "1.0.0"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
+)
 
 // ExecGitCommand executes a git command and returns the combined output
 func ExecGitCommand(args ...string) (string, error) {
@@ -27,19 +26,17 @@ func CheckGitRepo() error {
 	return nil
 }
 
-// PrintError prints an error message to stderr and exits
+// PrintError prints an error message to stderr, records the failure in the
+// audit log if a command started one, and exits
 func PrintError(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	currentAudit.Finish(fmt.Errorf(format, args...))
 	os.Exit(1)
 }
 
 // CheckLFSInstalled verifies Git LFS is installed
 func CheckLFSInstalled() error {
-	cmd := exec.Command("git", "lfs", "version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Git LFS is not installed or not available.\nInstall from: https://git-lfs.com/")
-	}
-	return nil
+	return prereq.Verify(prereq.GitLFS)
 }
 
 // CheckLFSInitialized verifies Git LFS is configured in the repository
@@ -70,3 +67,11 @@ func CheckLFSInitialized() error {
 
 	return nil
 }
+
+// Plural returns one when n is 1 and many otherwise
+func Plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
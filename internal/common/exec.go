@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Environment variables that switch on dry-run and trace mode for every
+// command of the suite, including commands started by other commands
+const (
+	EnvDryRun = "GIT_LFS_SCRIPTS_DRY_RUN"
+	EnvTrace  = "GIT_LFS_SCRIPTS_TRACE"
+)
+
+var (
+	// DryRun makes Run print commands that change something instead of running them
+	DryRun = envBool(EnvDryRun)
+	// Trace makes Run and Query print every external command before running it
+	Trace = envBool(EnvTrace)
+)
+
+// AddTraceFlag registers --trace on flags. Commands register their own
+// dry-run flag and pass its value to SetDryRun.
+func AddTraceFlag(flags *pflag.FlagSet) {
+	flags.BoolVar(&Trace, "trace", Trace, "Print every external command before running it")
+}
+
+// SetDryRun turns dry-run mode on when dryRun is set. It also exports both
+// modes, so suite commands started from this one behave the same way.
+func SetDryRun(dryRun bool) {
+	DryRun = DryRun || dryRun
+	if DryRun {
+		os.Setenv(EnvDryRun, "1")
+	}
+	if Trace {
+		os.Setenv(EnvTrace, "1")
+	}
+}
+
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// killDelay is how long a command may take to exit after it was
+// interrupted, before it is killed
+const killDelay = 10 * time.Second
+
+var (
+	signalOnce sync.Once
+	signalCtx  context.Context
+	running    atomic.Int32 // Commands started by RunContext and QueryContext
+	// interactive counts commands started by RunInteractive, which handle
+	// the signals themselves
+	interactive atomic.Int32
+)
+
+// Context returns the context of the commands Run and Query start. It is
+// canceled when the process is interrupted or terminated: a running command
+// is interrupted in turn, so the caller sees it fail and can clean up,
+// instead of the process dying while the command goes on. Without a running
+// command the process exits at once, as it would by default, and so does a
+// second signal.
+func Context() context.Context {
+	signalOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		signalCtx = ctx
+		go func() {
+			for sig := range signals {
+				if interactive.Load() > 0 {
+					continue
+				}
+				signal.Stop(signals)
+				cancel(fmt.Errorf("interrupted by %v", sig))
+				if running.Load() == 0 {
+					os.Exit(exitStatus(sig))
+				}
+				return
+			}
+		}()
+	})
+	return signalCtx
+}
+
+// exitStatus is the status of a shell whose command was killed by sig
+func exitStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 130
+}
+
+// withContext returns a copy of cmd that is interrupted when ctx is done,
+// and killed if it has not exited killDelay later
+func withContext(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	c := exec.CommandContext(ctx, cmd.Path)
+	c.Args, c.Env, c.Dir, c.Err = cmd.Args, cmd.Env, cmd.Dir, cmd.Err
+	c.Stdin, c.Stdout, c.Stderr = cmd.Stdin, cmd.Stdout, cmd.Stderr
+	c.ExtraFiles, c.SysProcAttr = cmd.ExtraFiles, cmd.SysProcAttr
+	c.Cancel = func() error { return c.Process.Signal(os.Interrupt) }
+	c.WaitDelay = killDelay
+	return c
+}
+
+// contextError explains why a command failed when ctx ended it
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", context.Cause(ctx), err)
+	}
+	return err
+}
+
+// Run runs a command that changes something. In dry-run mode it only prints
+// 'DRY RUN: COMMAND' and succeeds; with Trace it prints '+ COMMAND' to
+// stderr first. Unset Stdout and Stderr are connected to the terminal.
+func Run(cmd *exec.Cmd) error {
+	return RunContext(Context(), cmd)
+}
+
+// RunContext is Run stopping the command when ctx is done
+func RunContext(ctx context.Context, cmd *exec.Cmd) error {
+	if DryRun {
+		fmt.Printf("DRY RUN: %s\n", FormatCommand(cmd))
+		return nil
+	}
+	trace(cmd)
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	running.Add(1)
+	defer running.Add(-1)
+	return contextError(ctx, withContext(ctx, cmd).Run())
+}
+
+// RunCommand is Run for a command with its output on the terminal
+func RunCommand(name string, args ...string) error {
+	return Run(exec.Command(name, args...))
+}
+
+// Query runs a command that only reads, even in dry-run mode, and returns
+// its standard output
+func Query(cmd *exec.Cmd) ([]byte, error) {
+	return QueryContext(Context(), cmd)
+}
+
+// QueryContext is Query stopping the command when ctx is done
+func QueryContext(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	trace(cmd)
+	running.Add(1)
+	defer running.Add(-1)
+	output, err := withContext(ctx, cmd).Output()
+	return output, contextError(ctx, err)
+}
+
+// RunInteractive runs a command attached to the terminal, such as a pager,
+// for which Ctrl-C only ends the command: the terminal sends the signal to
+// the command itself, and this process carries on
+func RunInteractive(cmd *exec.Cmd) error {
+	Context()
+	interactive.Add(1)
+	defer interactive.Add(-1)
+	return Run(cmd)
+}
+
+// Interrupted reports whether err is the failure of a command that was
+// stopped because the process was interrupted or terminated
+func Interrupted(err error) bool {
+	return err != nil && Context().Err() != nil && errors.Is(err, context.Cause(Context()))
+}
+
+// QueryCommand is Query returning trimmed output
+func QueryCommand(name string, args ...string) (string, error) {
+	output, err := Query(exec.Command(name, args...))
+	return strings.TrimSpace(string(output)), err
+}
+
+func trace(cmd *exec.Cmd) {
+	if Trace {
+		fmt.Fprintf(os.Stderr, "+ %s\n", FormatCommand(cmd))
+	}
+}
+
+// FormatCommand renders a command as a shell command line that can be
+// pasted. Glob characters are left unquoted, so Git patterns read as they
+// are usually written; arguments with spaces or other shell syntax are
+// single-quoted.
+func FormatCommand(cmd *exec.Cmd) string {
+	words := make([]string, 0, len(cmd.Args)+2)
+	if cmd.Dir != "" {
+		words = append(words, "(cd", ShellQuote(cmd.Dir), "&&")
+	}
+	for _, arg := range cmd.Args {
+		words = append(words, ShellQuote(arg))
+	}
+	line := strings.Join(words, " ")
+	if cmd.Dir != "" {
+		line += ")"
+	}
+	return line
+}
+
+// RemoteQuote always single-quotes arg, glob characters included, for a
+// command line that another shell will parse, such as a remote one or a
+// generated script
+func RemoteQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// ShellQuote quotes arg for a POSIX shell when it contains shell syntax
+func ShellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if !strings.ContainsFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,*?[]", r))
+	}) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
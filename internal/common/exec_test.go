@@ -0,0 +1,136 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFormatCommand tests that commands render as pasteable shell command lines
+func TestFormatCommand(t *testing.T) {
+	tests := []struct {
+		cmd  *exec.Cmd
+		want string
+	}{
+		{exec.Command("git", "lfs", "untrack", "*.zip", "**/*.[mM][pP]3"), "git lfs untrack *.zip **/*.[mM][pP]3"},
+		{exec.Command("git", "commit", "-m", "Restore patterns to Git"), "git commit -m 'Restore patterns to Git'"},
+		{exec.Command("git", "commit", "-m", "it's", ""), `git commit -m 'it'\''s' ''`},
+	}
+	for _, tt := range tests {
+		if got := FormatCommand(tt.cmd); got != tt.want {
+			t.Errorf("FormatCommand() = %s, want %s", got, tt.want)
+		}
+	}
+
+	cmd := exec.Command("git", "config", "core.sharedRepository", "group")
+	cmd.Dir = "/srv/my repo.git"
+	if got, want := FormatCommand(cmd), "(cd '/srv/my repo.git' && git config core.sharedRepository group)"; got != want {
+		t.Errorf("FormatCommand() = %s, want %s", got, want)
+	}
+}
+
+// TestRemoteQuote tests that a remote shell expands nothing in quoted words
+func TestRemoteQuote(t *testing.T) {
+	for _, arg := range []string{"/srv/lfs", "/srv/*.[ch]", "it's", "$HOME", ""} {
+		output, err := exec.Command("sh", "-c", "printf %s "+RemoteQuote(arg)).Output()
+		if err != nil || string(output) != arg {
+			t.Errorf("RemoteQuote(%q) read back as %q, %v", arg, output, err)
+		}
+	}
+}
+
+// TestRunDryRun tests that dry-run mode skips changing commands but not queries
+func TestRunDryRun(t *testing.T) {
+	defer func(saved bool) { DryRun = saved }(DryRun)
+	DryRun = true
+
+	if err := RunCommand("false"); err != nil {
+		t.Errorf("RunCommand() in dry-run mode ran the command: %v", err)
+	}
+	if _, err := QueryCommand("false"); err == nil {
+		t.Error("QueryCommand() in dry-run mode did not run the command")
+	}
+	if output, err := QueryCommand("echo", "read"); err != nil || output != "read" {
+		t.Errorf("QueryCommand() = %q, %v", output, err)
+	}
+}
+
+// TestNetworkRetries tests that a failing command is run again Retries times
+func TestNetworkRetries(t *testing.T) {
+	defer func(retries int, delay time.Duration) { Retries, retryDelay = retries, delay }(Retries, retryDelay)
+	Retries, retryDelay = 2, time.Millisecond
+
+	log := filepath.Join(t.TempDir(), "attempts")
+	err := RunNetwork("sh", "-c", "echo attempt >> "+ShellQuote(log)+"; exit 1")
+	if err == nil {
+		t.Error("RunNetwork() of a failing command succeeded")
+	}
+	data, _ := os.ReadFile(log)
+	if got := strings.Count(string(data), "attempt"); got != 3 {
+		t.Errorf("RunNetwork() ran the command %d times, want 3", got)
+	}
+
+	if output, err := QueryNetwork("echo", "fetched"); err != nil || output != "fetched" {
+		t.Errorf("QueryNetwork() = %q, %v", output, err)
+	}
+}
+
+// TestNetworkPermanent tests that a Permanent failure is not retried
+func TestNetworkPermanent(t *testing.T) {
+	defer func(retries int, delay time.Duration) { Retries, retryDelay = retries, delay }(Retries, retryDelay)
+	Retries, retryDelay = 2, time.Millisecond
+
+	attempts := 0
+	notFound := errors.New("not found")
+	err := Network("lookup", func(ctx context.Context) error {
+		attempts++
+		return Permanent(notFound)
+	})
+	if attempts != 1 || !errors.Is(err, notFound) {
+		t.Errorf("Network() made %d attempts and returned %v, want 1 and %v", attempts, err, notFound)
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) is not nil")
+	}
+}
+
+// TestNetworkTimeout tests that a command is stopped after Timeout
+func TestNetworkTimeout(t *testing.T) {
+	defer func(timeout time.Duration, retries int) { Timeout, Retries = timeout, retries }(Timeout, Retries)
+	Timeout, Retries = 100*time.Millisecond, 0
+
+	start := time.Now()
+	err := RunNetwork("sleep", "5")
+	if err == nil || !strings.Contains(err.Error(), "sleep 5 timed out after 100ms") {
+		t.Errorf("RunNetwork() = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("RunNetwork() returned after %v", elapsed)
+	}
+	if Interrupted(err) {
+		t.Error("Interrupted() is true for a timeout")
+	}
+}
+
+// TestDescribe tests that commands are named by their first words
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"git", []string{"push", "--force", "origin"}, "git push"},
+		{"git", []string{"-C", "/tmp/repo.git", "lfs", "fetch", "--all"}, "git lfs fetch"},
+		{"gh", []string{"api", "-H", "Accept: application/json", "repos/o/r"}, "gh api"},
+	}
+	for _, tt := range tests {
+		if got := describe(tt.name, tt.args); got != tt.want {
+			t.Errorf("describe(%s, %q) = %s, want %s", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
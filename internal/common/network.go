@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Environment variables that set the timeout and retries of every command
+// of the suite that talks to a remote
+const (
+	EnvTimeout = "GIT_LFS_SCRIPTS_TIMEOUT"
+	EnvRetries = "GIT_LFS_SCRIPTS_RETRIES"
+)
+
+// DefaultRetries is how often a failed push, fetch or API call is retried
+const DefaultRetries = 2
+
+var (
+	// Timeout stops each attempt of a command that talks to a remote after
+	// this long; 0 waits for ever
+	Timeout = envDuration(EnvTimeout)
+	// Retries is how often a command that talks to a remote is run again
+	// after it failed
+	Retries = envInt(EnvRetries, DefaultRetries)
+
+	// retryDelay is the wait before the first retry, doubled for each next one
+	retryDelay = 2 * time.Second
+	// maxRetryDelay caps the wait between retries
+	maxRetryDelay = 30 * time.Second
+)
+
+func envDuration(name string) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+func envInt(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// AddNetworkFlags registers --timeout and --retries on flags, for commands
+// that push, fetch or call an API
+func AddNetworkFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&Timeout, "timeout", Timeout, "Stop a push, fetch or API call that takes longer, e.g. 30m")
+	flags.IntVar(&Retries, "retries", Retries, "Retry a failed push, fetch or API call this many times")
+}
+
+// permanentError is a failure that trying again cannot fix
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks err as a failure that Network does not retry, such as a
+// response saying that something does not exist
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Network runs attempt, which runs a command that talks to a remote with
+// the context it is given. Each attempt ends after Timeout; a failed one is
+// run again up to Retries times, waiting longer each time, unless the
+// process was interrupted or the failure is Permanent.
+func Network(description string, attempt func(ctx context.Context) error) error {
+	delay := retryDelay
+	for try := 0; ; try++ {
+		ctx, cancel := Context(), context.CancelFunc(func() {})
+		if Timeout > 0 {
+			ctx, cancel = context.WithTimeoutCause(ctx, Timeout,
+				fmt.Errorf("%s timed out after %v", description, Timeout))
+		}
+		err := attempt(ctx)
+		cancel()
+		if err == nil || try >= Retries || Interrupted(err) || errors.As(err, new(permanentError)) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s failed: %v\nRetrying in %v (%d of %d retries)...\n",
+			description, err, delay, try+1, Retries)
+		select {
+		case <-time.After(delay):
+		case <-Context().Done():
+			return err
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// RunNetwork is RunCommand for a command that talks to a remote, such as
+// git push or git lfs fetch, with the timeout and retries of Network
+func RunNetwork(name string, args ...string) error {
+	return Network(describe(name, args), func(ctx context.Context) error {
+		return RunContext(ctx, exec.Command(name, args...))
+	})
+}
+
+// QueryNetwork is QueryCommand for a command that talks to a remote, with
+// the timeout and retries of Network
+func QueryNetwork(name string, args ...string) (string, error) {
+	var output []byte
+	err := Network(describe(name, args), func(ctx context.Context) error {
+		var err error
+		output, err = QueryContext(ctx, exec.Command(name, args...))
+		return err
+	})
+	return strings.TrimSpace(string(output)), err
+}
+
+// describe names a command by its first words, e.g. 'git lfs fetch' for
+// git -C DIR lfs fetch --all origin
+func describe(name string, args []string) string {
+	words := []string{name}
+	for i := 0; i < len(args) && len(words) < 3; i++ {
+		switch {
+		case name == "git" && (args[i] == "-C" || args[i] == "-c"):
+			i++ // Skip the option's value
+		case strings.HasPrefix(args[i], "-"):
+			return strings.Join(words, " ")
+		default:
+			words = append(words, args[i])
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to their multipliers (binary units)
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a human-readable size such as 500K, 5M, 1.5G or 1024
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "IB")
+	if len(str) > 1 && strings.HasSuffix(str, "B") && strings.ContainsAny(str[len(str)-2:len(str)-1], "KMGT") {
+		str = strings.TrimSuffix(str, "B")
+	}
+	if str == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			multiplier = unit.multiplier
+			str = strings.TrimSuffix(str, unit.suffix)
+			break
+		}
+	}
+
+	// NaN, infinities and sizes beyond int64 convert to nonsense
+	value, err := strconv.ParseFloat(str, 64)
+	bytes := value * float64(multiplier)
+	if err != nil || value < 0 || math.IsNaN(value) || bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size '%s' (examples: 500K, 5M, 1.5G)", s)
+	}
+	return int64(bytes), nil
+}
+
+// FormatSize formats a byte count as a human-readable size
+func FormatSize(bytes int64) string {
+	for _, unit := range sizeUnits[:4] {
+		if bytes >= unit.multiplier {
+			return fmt.Sprintf("%.1f %sB", float64(bytes)/float64(unit.multiplier), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
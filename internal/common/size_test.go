@@ -0,0 +1,60 @@
+package common
+
+import "testing"
+
+// TestParseSize tests parsing of human-readable sizes
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"1024", 1024, false},
+		{"500K", 500 * 1024, false},
+		{"5M", 5 * 1024 * 1024, false},
+		{"5MB", 5 * 1024 * 1024, false},
+		{"5MiB", 5 * 1024 * 1024, false},
+		{"1.5G", 1536 * 1024 * 1024, false},
+		{"2t", 2 << 40, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"-5M", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"-Inf", 0, true},
+		{"1e30T", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFormatSize tests formatting of byte counts
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{512, "512 B"},
+		{1024, "1.0 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+		{1536 * 1024 * 1024, "1.5 GB"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatSize(tt.input); result != tt.expected {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Build information of the suite, set when building with
+//
+//	-ldflags "-X github.com/mslinn/git_lfs_scripts/internal/common.Version=1.2.0
+//	          -X github.com/mslinn/git_lfs_scripts/internal/common.Commit=abc1234
+//	          -X github.com/mslinn/git_lfs_scripts/internal/common.Date=2024-05-01T12:00:00Z"
+//
+// Builds without them fall back on the module version that 'go install'
+// records, or else on the latest release, and on the VCS information Go
+// records in the binary.
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// pseudoVersion matches the versions Go derives from a commit, e.g.
+// v0.1.5-0.20240501120000-0123456789ab or v0.1.4+dirty
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}|\+dirty$`)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if Version == "" {
+		Version = releaseVersion
+		// Builds in a checkout get a pseudo-version, which says less than
+		// the release and the commit
+		if ok && info.Main.Version != "" && info.Main.Version != "(devel)" && !pseudoVersion.MatchString(info.Main.Version) {
+			Version = strings.TrimPrefix(info.Main.Version, "v")
+		}
+	}
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && Commit == "":
+			Commit = setting.Value
+		case setting.Key == "vcs.time" && Date == "":
+			Date = setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true" && Commit != "" && !strings.HasSuffix(Commit, "-dirty"):
+			Commit += "-dirty"
+		}
+	}
+}
+
+// VersionString describes the build of the named command for bug reports,
+// e.g. 'git-lfs-files 1.2.0 (commit abc1234, built 2024-05-01T12:00:00Z, go1.24.1 linux/amd64)'
+func VersionString(name string) string {
+	var details []string
+	if Commit != "" {
+		commit, dirty := strings.CutSuffix(Commit, "-dirty")
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if dirty {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if Date != "" {
+		details = append(details, "built "+Date)
+	}
+	details = append(details, runtime.Version()+" "+runtime.GOOS+"/"+runtime.GOARCH)
+	return fmt.Sprintf("%s %s (%s)", name, Version, strings.Join(details, ", "))
+}
+
+// AddVersionFlag registers --version on flags. Parsing it prints
+// VersionString(name) and exits, so commands need no code of their own.
+func AddVersionFlag(flags *pflag.FlagSet, name string) {
+	flag := flags.VarPF(versionFlag(name), "version", "", "Show the version, commit and build date")
+	flag.NoOptDefVal = "true"
+}
+
+// versionFlag is a boolean flag value that prints the version when set
+type versionFlag string
+
+func (v versionFlag) String() string   { return "false" }
+func (v versionFlag) Type() string     { return "bool" }
+func (v versionFlag) IsBoolFlag() bool { return true }
+
+func (v versionFlag) Set(value string) error {
+	if value != "true" {
+		return nil
+	}
+	fmt.Println(VersionString(string(v)))
+	os.Exit(0)
+	return nil
+}
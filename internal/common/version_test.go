@@ -0,0 +1,38 @@
+package common
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestVersionString tests the build description printed by --version
+func TestVersionString(t *testing.T) {
+	saved := []string{Version, Commit, Date}
+	defer func() { Version, Commit, Date = saved[0], saved[1], saved[2] }()
+	platform := runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH
+
+	Version, Commit, Date = "1.2.0", "0123456789abcdef0123456789abcdef01234567-dirty", "2024-05-01T12:00:00Z"
+	if got, want := VersionString("git-nonlfs"), "git-nonlfs 1.2.0 (commit 0123456789ab-dirty, built 2024-05-01T12:00:00Z, "+platform+")"; got != want {
+		t.Errorf("VersionString() = %s, want %s", got, want)
+	}
+
+	Version, Commit, Date = "dev", "", ""
+	if got, want := VersionString("git-nonlfs"), "git-nonlfs dev ("+platform+")"; got != want {
+		t.Errorf("VersionString() = %s, want %s", got, want)
+	}
+}
+
+// TestPseudoVersion tests telling release versions from those Go derives from commits
+func TestPseudoVersion(t *testing.T) {
+	for version, want := range map[string]bool{
+		"v1.2.0":                               false,
+		"v1.2.0-rc.1":                          false,
+		"v0.1.5-0.20240501120000-0123456789ab": true,
+		"v0.0.0-20240501120000-0123456789ab":   true,
+		"v0.1.4+dirty":                         true,
+	} {
+		if got := pseudoVersion.MatchString(version); got != want {
+			t.Errorf("pseudoVersion.MatchString(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package completion
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ArgKind describes the positional arguments a command accepts
+type ArgKind int
+
+const (
+	ArgNone       ArgKind = iota // No positional arguments
+	ArgExtension                 // File extensions found in the current Git repository
+	ArgFile                      // File names
+	ArgDirectory                 // Directory names
+	ArgGitHubRepo                // GitHub repositories visible to the gh CLI
+)
+
+// Shells lists the shells for which completion scripts can be generated
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// Command describes a command for completion script generation
+type Command struct {
+	Name        string         // Binary name, e.g. git-lfs-track
+	Flags       *pflag.FlagSet // Flags accepted by the command
+	Args        ArgKind        // Kind of positional arguments
+	Subcommands []string       // Optional subcommands offered as the first argument
+}
+
+// flagSpec is the shell-neutral description of a single flag
+type flagSpec struct {
+	long       string
+	short      string
+	usage      string
+	needsValue bool
+}
+
+// Handle prints a completion script and exits when the command line is
+// 'completion SHELL'. It must be called after all flags are defined and
+// before the flags are parsed.
+func Handle(cmd Command) {
+	if len(os.Args) != 3 || os.Args[1] != "completion" {
+		return
+	}
+
+	script, err := Generate(cmd, os.Args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(script)
+	os.Exit(0)
+}
+
+// Generate returns the completion script for the given shell
+func Generate(cmd Command, shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return generateBash(cmd), nil
+	case "zsh":
+		return generateZsh(cmd), nil
+	case "fish":
+		return generateFish(cmd), nil
+	case "powershell":
+		return generatePowerShell(cmd), nil
+	default:
+		return "", fmt.Errorf("unsupported shell '%s' (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+}
+
+// flagSpecs returns the visible flags of a command, sorted by long name
+func flagSpecs(flags *pflag.FlagSet) []flagSpec {
+	var specs []flagSpec
+	if flags == nil {
+		return specs
+	}
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		specs = append(specs, flagSpec{
+			long:       f.Name,
+			short:      f.Shorthand,
+			usage:      f.Usage,
+			needsValue: f.NoOptDefVal == "",
+		})
+	})
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].long < specs[j].long })
+	return specs
+}
+
+// argCommand returns a POSIX shell pipeline listing candidate arguments
+func argCommand(kind ArgKind) string {
+	switch kind {
+	case ArgExtension:
+		return `git ls-files 2>/dev/null | sed -n 's/.*\.\([^./]*\)$/\1/p' | sort -u`
+	case ArgGitHubRepo:
+		return `gh repo list --limit 1000 --json nameWithOwner --jq '.[].nameWithOwner' 2>/dev/null`
+	default:
+		return ""
+	}
+}
+
+// funcName converts a command name into a shell function name fragment
+func funcName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// gitSubcommand returns the name used after 'git', e.g. lfs-track for git-lfs-track
+func gitSubcommand(name string) string {
+	return strings.TrimPrefix(name, "git-")
+}
+
+func generateBash(cmd Command) string {
+	specs := flagSpecs(cmd.Flags)
+	fn := funcName(cmd.Name)
+
+	var words, valueFlags []string
+	for _, s := range specs {
+		words = append(words, "--"+s.long)
+		if s.short != "" {
+			words = append(words, "-"+s.short)
+		}
+		if s.needsValue {
+			valueFlags = append(valueFlags, "--"+s.long)
+			if s.short != "" {
+				valueFlags = append(valueFlags, "-"+s.short)
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s\n", cmd.Name)
+	fmt.Fprintf(&b, "# Install with: source <(%s completion bash)\n\n", cmd.Name)
+	fmt.Fprintf(&b, "__%s_complete() {\n", fn)
+	b.WriteString("  local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("  local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(&b, "  case \"$prev\" in\n    %s)\n", strings.Join(valueFlags, "|"))
+		b.WriteString("      COMPREPLY=( $(compgen -f -- \"$cur\") )\n      return\n      ;;\n  esac\n")
+	}
+	b.WriteString("  if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(words, " "))
+	b.WriteString("    return\n  fi\n")
+	if len(cmd.Subcommands) > 0 {
+		b.WriteString("  if [[ $COMP_CWORD -le 2 && \"${COMP_WORDS[0]}\" == git ]] || [[ $COMP_CWORD -eq 1 ]]; then\n")
+		fmt.Fprintf(&b, "    COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(cmd.Subcommands, " "))
+		b.WriteString("    return\n  fi\n")
+	}
+	switch cmd.Args {
+	case ArgFile:
+		b.WriteString("  COMPREPLY=( $(compgen -f -- \"$cur\") )\n")
+	case ArgDirectory:
+		b.WriteString("  COMPREPLY=( $(compgen -d -- \"$cur\") )\n")
+	case ArgExtension, ArgGitHubRepo:
+		fmt.Fprintf(&b, "  COMPREPLY=( $(compgen -W \"$(%s)\" -- \"$cur\") )\n", argCommand(cmd.Args))
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "complete -F __%s_complete %s\n\n", fn, cmd.Name)
+	fmt.Fprintf(&b, "# Invoked by git's own completion for 'git %s'\n", gitSubcommand(cmd.Name))
+	fmt.Fprintf(&b, "_%s() {\n  __%s_complete\n}\n", fn, fn)
+	return b.String()
+}
+
+// zshEscape escapes characters that are special inside _arguments descriptions
+func zshEscape(s string) string {
+	r := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]", ":", "\\:")
+	return r.Replace(s)
+}
+
+func generateZsh(cmd Command) string {
+	specs := flagSpecs(cmd.Flags)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#compdef %s\n", cmd.Name)
+	fmt.Fprintf(&b, "# zsh completion for %s\n", cmd.Name)
+	fmt.Fprintf(&b, "# Install with: source <(%s completion zsh)\n", cmd.Name)
+	fmt.Fprintf(&b, "# For 'git %s', also run: zstyle ':completion:*:*:git:*' user-commands %s:'%s'\n\n",
+		gitSubcommand(cmd.Name), gitSubcommand(cmd.Name), cmd.Name)
+	if cmd.Args == ArgExtension || cmd.Args == ArgGitHubRepo {
+		fmt.Fprintf(&b, "__%s_args() {\n  compadd -- ${(f)\"$(%s)\"}\n}\n\n", cmd.Name, argCommand(cmd.Args))
+	}
+	fmt.Fprintf(&b, "_%s() {\n", cmd.Name)
+	b.WriteString("  _arguments -s \\\n")
+	for _, s := range specs {
+		value := ""
+		if s.needsValue {
+			value = ":" + s.long + ":_files"
+		}
+		desc := zshEscape(s.usage)
+		if s.short != "" {
+			fmt.Fprintf(&b, "    '(-%s --%s)'{-%s,--%s}'[%s]%s' \\\n", s.short, s.long, s.short, s.long, desc, value)
+		} else {
+			fmt.Fprintf(&b, "    '--%s[%s]%s' \\\n", s.long, desc, value)
+		}
+	}
+	if len(cmd.Subcommands) > 0 {
+		fmt.Fprintf(&b, "    '1:subcommand:(%s)' \\\n", strings.Join(cmd.Subcommands, " "))
+	}
+	switch cmd.Args {
+	case ArgFile:
+		b.WriteString("    '*:file:_files'\n")
+	case ArgDirectory:
+		b.WriteString("    '*:directory:_files -/'\n")
+	case ArgExtension:
+		fmt.Fprintf(&b, "    '*:extension:__%s_args'\n", cmd.Name)
+	case ArgGitHubRepo:
+		fmt.Fprintf(&b, "    '*:repository:__%s_args'\n", cmd.Name)
+	default:
+		b.WriteString("    '*: :'\n")
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "compdef _%s %s\n", cmd.Name, cmd.Name)
+	return b.String()
+}
+
+// fishEscape escapes single quotes for fish
+func fishEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "\\'")
+}
+
+func generateFish(cmd Command) string {
+	specs := flagSpecs(cmd.Flags)
+	sub := gitSubcommand(cmd.Name)
+
+	// Each completion is registered for the binary and for 'git SUBCOMMAND'
+	targets := []string{
+		fmt.Sprintf("-c %s", cmd.Name),
+		fmt.Sprintf("-c git -n '__fish_seen_subcommand_from %s'", sub),
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s\n", cmd.Name)
+	fmt.Fprintf(&b, "# Install with: %s completion fish > ~/.config/fish/completions/%s.fish\n\n", cmd.Name, cmd.Name)
+	fmt.Fprintf(&b, "complete -c git -n '__fish_use_subcommand' -a %s -d '%s'\n", sub, cmd.Name)
+	for _, target := range targets {
+		for _, s := range specs {
+			line := fmt.Sprintf("complete %s -l %s", target, s.long)
+			if s.short != "" {
+				line += " -s " + s.short
+			}
+			if s.needsValue {
+				line += " -r"
+			}
+			line += fmt.Sprintf(" -d '%s'", fishEscape(s.usage))
+			b.WriteString(line + "\n")
+		}
+		if len(cmd.Subcommands) > 0 {
+			fmt.Fprintf(&b, "complete %s -f -a '%s'\n", target, strings.Join(cmd.Subcommands, " "))
+		}
+		switch cmd.Args {
+		case ArgExtension, ArgGitHubRepo:
+			fmt.Fprintf(&b, "complete %s -f -a '(%s)'\n", target, fishEscape(argCommand(cmd.Args)))
+		case ArgNone:
+			if len(cmd.Subcommands) == 0 {
+				fmt.Fprintf(&b, "complete %s -f\n", target)
+			}
+		}
+	}
+	return b.String()
+}
+
+func generatePowerShell(cmd Command) string {
+	specs := flagSpecs(cmd.Flags)
+
+	var words []string
+	for _, s := range specs {
+		words = append(words, "'--"+s.long+"'")
+		if s.short != "" {
+			words = append(words, "'-"+s.short+"'")
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		words = append(words, "'"+sub+"'")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# PowerShell completion for %s\n", cmd.Name)
+	fmt.Fprintf(&b, "# Install with: %s completion powershell | Out-String | Invoke-Expression\n\n", cmd.Name)
+	fmt.Fprintf(&b, "Register-ArgumentCompleter -Native -CommandName '%s' -ScriptBlock {\n", cmd.Name)
+	b.WriteString("  param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(&b, "  $candidates = @(%s)\n", strings.Join(words, ", "))
+	switch cmd.Args {
+	case ArgExtension:
+		b.WriteString("  if (-not $wordToComplete.StartsWith('-')) {\n")
+		b.WriteString("    $candidates += git ls-files 2>$null | ForEach-Object { [IO.Path]::GetExtension($_).TrimStart('.') } | Where-Object { $_ } | Sort-Object -Unique\n")
+		b.WriteString("  }\n")
+	case ArgGitHubRepo:
+		b.WriteString("  if (-not $wordToComplete.StartsWith('-')) {\n")
+		b.WriteString("    $candidates += gh repo list --limit 1000 --json nameWithOwner --jq '.[].nameWithOwner' 2>$null\n")
+		b.WriteString("  }\n")
+	}
+	b.WriteString("  $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("    [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	b.WriteString("  }\n")
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package completion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func testCommand() Command {
+	flags := pflag.NewFlagSet("git-lfs-track", pflag.ContinueOnError)
+	flags.BoolP("dryrun", "d", false, "Dry run")
+	flags.String("port", "9876", "Port to listen on")
+	flags.Bool("secret", false, "Hidden flag")
+	_ = flags.MarkHidden("secret")
+
+	return Command{Name: "git-lfs-track", Flags: flags, Args: ArgExtension}
+}
+
+// TestGenerateAllShells tests that every supported shell produces a script
+// mentioning the visible flags and omitting hidden ones
+func TestGenerateAllShells(t *testing.T) {
+	cmd := testCommand()
+
+	for _, shell := range Shells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := Generate(cmd, shell)
+			if err != nil {
+				t.Fatalf("Generate(%q) returned error: %v", shell, err)
+			}
+			if !strings.Contains(script, "dryrun") {
+				t.Errorf("%s script is missing the dryrun flag:\n%s", shell, script)
+			}
+			if strings.Contains(script, "secret") {
+				t.Errorf("%s script contains a hidden flag:\n%s", shell, script)
+			}
+		})
+	}
+}
+
+// TestGenerateUnsupportedShell tests that unknown shells are rejected
+func TestGenerateUnsupportedShell(t *testing.T) {
+	if _, err := Generate(testCommand(), "tcsh"); err == nil {
+		t.Error("Generate(\"tcsh\") should return an error")
+	}
+}
+
+// TestBashGitIntegration tests that the bash script defines the function
+// git's own completion calls for 'git lfs-track'
+func TestBashGitIntegration(t *testing.T) {
+	script, _ := Generate(testCommand(), "bash")
+
+	if !strings.Contains(script, "_git_lfs_track() {") {
+		t.Errorf("bash script does not define _git_lfs_track:\n%s", script)
+	}
+	if !strings.Contains(script, "--port|") && !strings.Contains(script, "--port)") {
+		t.Errorf("bash script does not treat --port as taking a value:\n%s", script)
+	}
+}
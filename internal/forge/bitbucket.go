@@ -0,0 +1,152 @@
+package forge
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// BitbucketCloudURL is the web URL of Bitbucket Cloud; any other base URL is
+// taken as a Bitbucket Data Center (or Server) instance
+const BitbucketCloudURL = "https://bitbucket.org"
+
+// bitbucketCloudAPI is the REST API 2.0 of Bitbucket Cloud
+const bitbucketCloudAPI = "https://api.bitbucket.org/2.0"
+
+// Bitbucket is a client for the Bitbucket Cloud REST API 2.0 or the
+// Bitbucket Data Center REST API 1.0
+type Bitbucket struct {
+	api   *apiClient
+	cloud bool
+}
+
+// NewBitbucket creates a Bitbucket client. An empty baseURL or
+// https://bitbucket.org selects Bitbucket Cloud. An empty token falls back to
+// the BITBUCKET_TOKEN environment variable, which is sent as a bearer token,
+// or with BITBUCKET_USERNAME set as the password of basic authentication
+// (Cloud API tokens and app passwords).
+func NewBitbucket(baseURL, token string) (*Bitbucket, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	cloud := baseURL == "" || baseURL == BitbucketCloudURL || baseURL == "https://www.bitbucket.org"
+	if token == "" {
+		token = os.Getenv("BITBUCKET_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no Bitbucket token found.\nCreate an HTTP access token (Data Center) or an API token (Cloud) with repository admin\npermission and set BITBUCKET_TOKEN; for an API token also set BITBUCKET_USERNAME")
+	}
+
+	auth := "Bearer " + token
+	if username := os.Getenv("BITBUCKET_USERNAME"); username != "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+token))
+	}
+	if cloud {
+		return &Bitbucket{api: newAPIClient(bitbucketCloudAPI, "Authorization", auth), cloud: true}, nil
+	}
+	return &Bitbucket{api: newAPIClient(baseURL, "Authorization", auth)}, nil
+}
+
+// Name returns "bitbucket"
+func (b *Bitbucket) Name() string { return "bitbucket" }
+
+// splitRepo splits a repository given as WORKSPACE/SLUG on Cloud or
+// PROJECT/SLUG on Data Center. The scm/ prefix of Data Center clone URLs is
+// dropped.
+func (b *Bitbucket) splitRepo(repo string) (string, string, error) {
+	if !b.cloud {
+		repo = strings.TrimPrefix(repo, "scm/")
+	}
+	owner, slug, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || slug == "" || strings.Contains(slug, "/") {
+		if b.cloud {
+			return "", "", fmt.Errorf("Bitbucket repository '%s' must be given as WORKSPACE/SLUG", repo)
+		}
+		return "", "", fmt.Errorf("Bitbucket repository '%s' must be given as PROJECT/SLUG", repo)
+	}
+	return owner, slug, nil
+}
+
+// repoPath returns the path of a repository below the API root
+func (b *Bitbucket) repoPath(repo string) (string, error) {
+	owner, slug, err := b.splitRepo(repo)
+	if err != nil {
+		return "", err
+	}
+	if b.cloud {
+		return "/repositories/" + url.PathEscape(owner) + "/" + url.PathEscape(slug), nil
+	}
+	return "/projects/" + url.PathEscape(owner) + "/repos/" + url.PathEscape(slug), nil
+}
+
+// DeleteRepo deletes the repository. Data Center schedules the deletion and
+// returns before it completes.
+func (b *Bitbucket) DeleteRepo(repo string) error {
+	path, err := b.repoPath(repo)
+	if err != nil {
+		return err
+	}
+	if b.cloud {
+		return b.api.do("DELETE", path, nil, nil)
+	}
+	return b.api.do("DELETE", "/rest/api/1.0"+path, nil, nil)
+}
+
+// CreateRepo creates an empty Git repository, on Cloud in the workspace's
+// default project
+func (b *Bitbucket) CreateRepo(repo string, private bool) error {
+	owner, slug, err := b.splitRepo(repo)
+	if err != nil {
+		return err
+	}
+	if b.cloud {
+		path := "/repositories/" + url.PathEscape(owner) + "/" + url.PathEscape(slug)
+		return b.api.do("POST", path, map[string]interface{}{"scm": "git", "is_private": private}, nil)
+	}
+	body := map[string]interface{}{"name": slug, "scmId": "git", "public": !private}
+	return b.api.do("POST", "/rest/api/1.0/projects/"+url.PathEscape(owner)+"/repos", body, nil)
+}
+
+// lfsPath returns the Data Center path that enables Git LFS for a repository
+func (b *Bitbucket) lfsPath(repo string) (string, error) {
+	if b.cloud {
+		return "", fmt.Errorf("Bitbucket Cloud has no API for the Git LFS setting; it is enabled for every repository")
+	}
+	path, err := b.repoPath(repo)
+	if err != nil {
+		return "", err
+	}
+	return "/rest/git-lfs/admin" + path + "/enabled", nil
+}
+
+// LFSEnabled reports whether Git LFS is enabled for the repository. Cloud
+// always enables it.
+func (b *Bitbucket) LFSEnabled(repo string) (bool, error) {
+	if b.cloud {
+		return true, nil
+	}
+	path, err := b.lfsPath(repo)
+	if err != nil {
+		return false, err
+	}
+	if err := b.api.do("GET", path, nil, nil); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SetLFSEnabled enables or disables Git LFS for the repository; only Data
+// Center has the setting
+func (b *Bitbucket) SetLFSEnabled(repo string, enabled bool) error {
+	path, err := b.lfsPath(repo)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return b.api.do("PUT", path, nil, nil)
+	}
+	return b.api.do("DELETE", path, nil, nil)
+}
@@ -0,0 +1,203 @@
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// Remote describes a Git remote URL split into its host and repository path
+type Remote struct {
+	Host string // e.g. gitlab.com
+	Path string // e.g. group/subgroup/project (no .git suffix)
+}
+
+// ParseRemoteURL splits an HTTPS, SSH or scp-style Git remote URL
+func ParseRemoteURL(remoteURL string) (Remote, error) {
+	raw := strings.TrimSpace(remoteURL)
+	if raw == "" {
+		return Remote{}, fmt.Errorf("empty remote URL")
+	}
+
+	// scp-style: git@host:path
+	if !strings.Contains(raw, "://") {
+		at := strings.Index(raw, "@")
+		colon := strings.Index(raw, ":")
+		if colon < 0 || colon < at {
+			return Remote{}, fmt.Errorf("unrecognized remote URL '%s'", remoteURL)
+		}
+		return Remote{
+			Host: raw[at+1 : colon],
+			Path: cleanRepoPath(raw[colon+1:]),
+		}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Remote{}, fmt.Errorf("unrecognized remote URL '%s': %v", remoteURL, err)
+	}
+	if u.Hostname() == "" {
+		return Remote{}, fmt.Errorf("remote URL '%s' has no host", remoteURL)
+	}
+	return Remote{Host: u.Hostname(), Path: cleanRepoPath(u.Path)}, nil
+}
+
+// cleanRepoPath removes leading/trailing slashes and the .git suffix
+func cleanRepoPath(path string) string {
+	path = strings.Trim(path, "/")
+	return strings.TrimSuffix(path, ".git")
+}
+
+// Owner returns the path of the repository without its name: the owner on
+// GitHub, Gitea and Bitbucket, or the group and subgroups on GitLab
+func (r Remote) Owner() string {
+	owner, _ := splitRepoPath(r.Path)
+	return owner
+}
+
+// Name returns the last component of the repository path
+func (r Remote) Name() string {
+	_, name := splitRepoPath(r.Path)
+	return name
+}
+
+// Provider guesses the forge of the remote from its host, or returns ""
+func (r Remote) Provider() string {
+	return DetectProvider(r.Host)
+}
+
+// WebURL returns the address of the repository's web page
+func (r Remote) WebURL() string {
+	return "https://" + r.Host + "/" + r.Path
+}
+
+func splitRepoPath(path string) (string, string) {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+// OriginRemote parses the URL of the origin remote of the current
+// repository, as rewritten by url.<base>.insteadOf
+func OriginRemote() (Remote, error) {
+	output, err := common.ExecGitCommand("remote", "get-url", "origin")
+	if err != nil {
+		return Remote{}, fmt.Errorf("no remote.origin.url configured for this repository")
+	}
+	return ParseRemoteURL(output)
+}
+
+// CurrentRepo returns the repository of remote.origin.url, which commands
+// act on when they are not given one. With provider set, origin must be on
+// a forge of that provider.
+func CurrentRepo(provider string) (Remote, error) {
+	remote, err := OriginRemote()
+	if err != nil {
+		return Remote{}, err
+	}
+	if remote.Owner() == "" {
+		return Remote{}, fmt.Errorf("remote.origin.url does not name an owner and a repository: %s/%s", remote.Host, remote.Path)
+	}
+	if provider != "" && remote.Provider() != provider {
+		return Remote{}, fmt.Errorf("remote.origin.url is on %s, not a %s host", remote.Host, provider)
+	}
+	return remote, nil
+}
+
+// apiClient performs authenticated JSON requests against a forge REST API
+type apiClient struct {
+	baseURL    string
+	authHeader string
+	authValue  string
+	http       *http.Client
+}
+
+func newAPIClient(baseURL, authHeader, authValue string) *apiClient {
+	return &apiClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		authHeader: authHeader,
+		authValue:  authValue,
+		http:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is returned when a forge API responds with a non-2xx status
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s failed with HTTP %d: %s", e.Method, e.URL, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// IsNotFound reports whether err is an API error with HTTP status 404
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// do sends a request with an optional JSON body and decodes a JSON response into out.
+// In dry-run mode, requests that change something are only printed.
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	reqURL := c.baseURL + path
+	if common.DryRun && method != "GET" {
+		fmt.Printf("DRY RUN: %s %s\n", method, reqURL)
+		return nil
+	}
+	if common.Trace {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", method, reqURL)
+	}
+	req, err := http.NewRequest(method, reqURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authValue != "" {
+		req.Header.Set(c.authHeader, c.authValue)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Method: method, URL: reqURL, StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode response from %s: %v", reqURL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package forge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestParseRemoteURL tests splitting of common Git remote URL forms
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Remote
+		wantErr  bool
+	}{
+		{
+			name:     "scp-style SSH",
+			input:    "git@gitlab.com:group/project.git",
+			expected: Remote{Host: "gitlab.com", Path: "group/project"},
+		},
+		{
+			name:     "HTTPS with subgroup",
+			input:    "https://gitlab.example.com/group/sub/project.git",
+			expected: Remote{Host: "gitlab.example.com", Path: "group/sub/project"},
+		},
+		{
+			name:     "HTTPS without .git suffix",
+			input:    "https://github.com/mslinn/git_lfs_scripts",
+			expected: Remote{Host: "github.com", Path: "mslinn/git_lfs_scripts"},
+		},
+		{
+			name:     "SSH URL with port",
+			input:    "ssh://git@gitea.local:2222/team/repo.git",
+			expected: Remote{Host: "gitea.local", Path: "team/repo"},
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "local path",
+			input:   "/srv/git/repo.git",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseRemoteURL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRemoteURL(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("ParseRemoteURL(%q) = %+v, want %+v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRemoteParts tests splitting a remote's path into owner and name
+func TestRemoteParts(t *testing.T) {
+	tests := []struct {
+		remote                        Remote
+		owner, name, provider, webURL string
+	}{
+		{Remote{Host: "github.com", Path: "mslinn/git_lfs_scripts"}, "mslinn", "git_lfs_scripts", "github", "https://github.com/mslinn/git_lfs_scripts"},
+		{Remote{Host: "gitlab.example.com", Path: "group/sub/project"}, "group/sub", "project", "gitlab", "https://gitlab.example.com/group/sub/project"},
+		{Remote{Host: "git.example.com", Path: "repo"}, "", "repo", "", "https://git.example.com/repo"},
+	}
+	for _, tt := range tests {
+		r := tt.remote
+		if r.Owner() != tt.owner || r.Name() != tt.name || r.Provider() != tt.provider || r.WebURL() != tt.webURL {
+			t.Errorf("%+v: Owner, Name, Provider, WebURL = %q, %q, %q, %q, want %q, %q, %q, %q", r,
+				r.Owner(), r.Name(), r.Provider(), r.WebURL(), tt.owner, tt.name, tt.provider, tt.webURL)
+		}
+	}
+}
+
+// TestDetectProvider tests guessing the forge from a host name
+func TestDetectProvider(t *testing.T) {
+	tests := map[string]string{
+		"github.com":         "github",
+		"GitHub.com":         "github",
+		"gitlab.com":         "gitlab",
+		"gitlab.example.com": "gitlab",
+		"codeberg.org":       "gitea",
+		"gitea.local":        "gitea",
+		"forgejo.example.io": "gitea",
+		"bitbucket.org":      "bitbucket",
+		"bitbucket.corp.com": "bitbucket",
+		"git.example.org":    "",
+	}
+	for host, want := range tests {
+		if got := DetectProvider(host); got != want {
+			t.Errorf("DetectProvider(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+// TestGiteaDeleteRepo tests the request that deletes a Gitea repository
+func TestGiteaDeleteRepo(t *testing.T) {
+	var method, path, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	gitea, err := NewGitea(server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gitea.DeleteRepo("team/assets"); err != nil {
+		t.Fatalf("DeleteRepo() error = %v", err)
+	}
+	if method != "DELETE" || path != "/api/v1/repos/team/assets" || auth != "token secret" {
+		t.Errorf("DeleteRepo() sent %s %s with Authorization %q", method, path, auth)
+	}
+	if err := gitea.DeleteRepo("group/sub/assets"); err == nil {
+		t.Error("DeleteRepo() accepted a nested repository path")
+	}
+}
+
+// TestBitbucketDataCenter tests the requests that manage a Bitbucket Data Center repository
+func TestBitbucketDataCenter(t *testing.T) {
+	var requests []string
+	lfsEnabled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/rest/git-lfs/admin/projects/TEAM/repos/assets/enabled" && r.Method == "GET" && !lfsEnabled:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "DELETE" && r.URL.Path == "/rest/api/1.0/projects/TEAM/repos/assets":
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("BITBUCKET_USERNAME", "")
+	p, err := NewProvider("bitbucket", "bitbucket.corp.com", server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitbucket := p.(*Bitbucket)
+	if enabled, err := bitbucket.LFSEnabled("TEAM/assets"); err != nil || enabled {
+		t.Errorf("LFSEnabled() = %v, %v; want false", enabled, err)
+	}
+	if err := bitbucket.SetLFSEnabled("TEAM/assets", true); err != nil {
+		t.Fatalf("SetLFSEnabled() error = %v", err)
+	}
+	if err := bitbucket.CreateRepo("TEAM/assets", true); err != nil {
+		t.Fatalf("CreateRepo() error = %v", err)
+	}
+	if err := bitbucket.DeleteRepo("scm/TEAM/assets"); err != nil {
+		t.Fatalf("DeleteRepo() error = %v", err)
+	}
+
+	want := []string{
+		"GET /rest/git-lfs/admin/projects/TEAM/repos/assets/enabled Bearer secret",
+		"PUT /rest/git-lfs/admin/projects/TEAM/repos/assets/enabled Bearer secret",
+		"POST /rest/api/1.0/projects/TEAM/repos Bearer secret",
+		"DELETE /rest/api/1.0/projects/TEAM/repos/assets Bearer secret",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if err := bitbucket.DeleteRepo("TEAM/sub/assets"); err == nil {
+		t.Error("DeleteRepo() accepted a nested repository path")
+	}
+}
+
+// TestBitbucketCloud tests the requests that manage a Bitbucket Cloud repository
+func TestBitbucketCloud(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bitbucket := &Bitbucket{api: newAPIClient(server.URL, "Authorization", "Bearer secret"), cloud: true}
+	if err := bitbucket.CreateRepo("workspace/assets", true); err != nil {
+		t.Fatalf("CreateRepo() error = %v", err)
+	}
+	if err := bitbucket.DeleteRepo("workspace/assets"); err != nil {
+		t.Fatalf("DeleteRepo() error = %v", err)
+	}
+	want := []string{"POST /repositories/workspace/assets", "DELETE /repositories/workspace/assets"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if err := bitbucket.SetLFSEnabled("workspace/assets", false); err == nil {
+		t.Error("SetLFSEnabled() succeeded on Bitbucket Cloud, which has no such setting")
+	}
+}
@@ -0,0 +1,41 @@
+package forge
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Gitea is a client for the Gitea (and Forgejo) REST API v1
+type Gitea struct {
+	api *apiClient
+}
+
+// NewGitea creates a Gitea client. Gitea is always self-hosted or Codeberg,
+// so baseURL is required; an empty token falls back to the GITEA_TOKEN
+// environment variable.
+func NewGitea(baseURL, token string) (*Gitea, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("no Gitea instance URL given; Gitea has no default instance")
+	}
+	if token == "" {
+		token = os.Getenv("GITEA_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no Gitea token found.\nCreate an access token with the 'write:repository' scope and set GITEA_TOKEN")
+	}
+	return &Gitea{api: newAPIClient(baseURL+"/api/v1", "Authorization", "token "+token)}, nil
+}
+
+// Name returns "gitea"
+func (g *Gitea) Name() string { return "gitea" }
+
+// DeleteRepo deletes the repository given as OWNER/NAME
+func (g *Gitea) DeleteRepo(repo string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("Gitea repository '%s' must be given as OWNER/NAME", repo)
+	}
+	return g.api.do("DELETE", "/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(name), nil, nil)
+}
@@ -0,0 +1,83 @@
+package forge
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/github"
+)
+
+// GitHub deletes and creates repositories with the gh CLI, which holds the
+// credentials
+type GitHub struct {
+	host string // Empty or github.com for github.com, else a GitHub Enterprise host
+}
+
+// NewGitHub creates a GitHub provider for host; empty selects github.com
+func NewGitHub(host string) *GitHub {
+	return &GitHub{host: host}
+}
+
+// Name returns "github"
+func (g *GitHub) Name() string { return "github" }
+
+// DeleteRepo deletes a repository using the gh CLI
+func (g *GitHub) DeleteRepo(repo string) error {
+	if g.host != "" && g.host != "github.com" {
+		repo = g.host + "/" + repo
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command("gh", "repo", "delete", repo, "--yes")
+	cmd.Stdout, cmd.Stderr = &output, &output
+
+	if err := common.Run(cmd); err != nil {
+		return fmt.Errorf("failed to delete repository %s: %v\nOutput: %s", repo, err, output.String())
+	}
+	return nil
+}
+
+// CreateRepo creates an empty repository OWNER/NAME, under the organization
+// when OWNER is one
+func (g *GitHub) CreateRepo(repo string, private bool) error {
+	if g.host != "" && g.host != "github.com" {
+		return fmt.Errorf("creating repositories is only supported on github.com, not %s", g.host)
+	}
+	return github.CreateRepo(repo, private)
+}
+
+// LFSUsage reads the repository's Git LFS storage from the billing usage
+// report of its owner, which takes an admin or billing manager token
+func (g *GitHub) LFSUsage(repo string) (LFSUsage, error) {
+	if g.host != "" && g.host != "github.com" {
+		return LFSUsage{}, fmt.Errorf("Git LFS usage is only reported on github.com, not %s", g.host)
+	}
+	r, err := github.GetRepo(repo)
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	if r.Fork && r.Source != nil {
+		// Objects pushed to a fork are stored with, and billed to, the
+		// root of its network
+		return LFSUsage{StoredIn: r.Source.FullName, Notes: []string{
+			fmt.Sprintf("%s is a fork; its LFS objects count against %s, so deleting it frees no LFS storage", repo, r.Source.FullName),
+		}}, nil
+	}
+
+	usage, err := github.GetRepoLFSUsage(r.FullName, r.Owner.Type == "Organization", time.Now())
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	return LFSUsage{
+		Bytes:  github.GBToBytes(usage.StorageGB),
+		Source: "average this billing month",
+		Notes: []string{
+			"GitHub deletes the repository's LFS objects with it; storage is billed by the hour, so the charge stops accruing",
+			"Forks of the repository keep the LFS objects they reference",
+			"Storage already used this month stays on this month's bill",
+		},
+	}, nil
+}
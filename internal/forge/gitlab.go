@@ -0,0 +1,141 @@
+package forge
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// DefaultGitLabURL is used when no GitLab instance URL is given
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLab is a client for the GitLab REST API v4
+type GitLab struct {
+	api *apiClient
+}
+
+// GitLabProject holds the project fields relevant to Git LFS
+type GitLabProject struct {
+	ID                int               `json:"id"`
+	PathWithNamespace string            `json:"path_with_namespace"`
+	WebURL            string            `json:"web_url"`
+	LFSEnabled        bool              `json:"lfs_enabled"`
+	Statistics        *GitLabStatistics `json:"statistics,omitempty"`
+}
+
+// GitLabStatistics holds project storage statistics in bytes
+type GitLabStatistics struct {
+	StorageSize    int64 `json:"storage_size"`
+	RepositorySize int64 `json:"repository_size"`
+	LFSObjectsSize int64 `json:"lfs_objects_size"`
+}
+
+// GitLabPushRule holds the push rule fields relevant to Git LFS.
+// MaxFileSize is in megabytes; 0 means unlimited.
+type GitLabPushRule struct {
+	ID          int `json:"id"`
+	MaxFileSize int `json:"max_file_size"`
+}
+
+// NewGitLab creates a GitLab client. An empty baseURL selects gitlab.com and
+// an empty token falls back to the GITLAB_TOKEN environment variable.
+func NewGitLab(baseURL, token string) (*GitLab, error) {
+	if baseURL == "" {
+		baseURL = DefaultGitLabURL
+	}
+	if token == "" {
+		token = os.Getenv("GITLAB_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no GitLab token found.\nCreate a personal access token with the 'api' scope and set GITLAB_TOKEN")
+	}
+	return &GitLab{api: newAPIClient(baseURL+"/api/v4", "PRIVATE-TOKEN", token)}, nil
+}
+
+// projectPath returns the API path for a project given as group/name
+func projectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// Name returns "gitlab"
+func (g *GitLab) Name() string { return "gitlab" }
+
+// DeleteRepo deletes the project given as GROUP/.../NAME. GitLab instances
+// with delayed deletion keep the project until the retention period ends.
+func (g *GitLab) DeleteRepo(project string) error {
+	return g.api.do("DELETE", projectPath(project), nil, nil)
+}
+
+// GetProject returns the project including storage statistics
+func (g *GitLab) GetProject(project string) (*GitLabProject, error) {
+	var p GitLabProject
+	if err := g.api.do("GET", projectPath(project)+"?statistics=true", nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LFSUsage reads the size of the project's LFS objects from its statistics,
+// which take at least the Reporter role
+func (g *GitLab) LFSUsage(project string) (LFSUsage, error) {
+	p, err := g.GetProject(project)
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	if p.Statistics == nil {
+		return LFSUsage{}, fmt.Errorf("GitLab did not return the statistics of %s; they take at least the Reporter role", project)
+	}
+	return LFSUsage{
+		Bytes:  p.Statistics.LFSObjectsSize,
+		Source: "project statistics",
+		Notes: []string{
+			"GitLab deletes LFS objects no other project references with the project; forks keep those they share",
+			"Instances with delayed deletion keep the project, and its storage, until the retention period ends",
+		},
+	}, nil
+}
+
+// LFSEnabled reports whether Git LFS is enabled for the project
+func (g *GitLab) LFSEnabled(project string) (bool, error) {
+	p, err := g.GetProject(project)
+	if err != nil {
+		return false, err
+	}
+	return p.LFSEnabled, nil
+}
+
+// SetLFSEnabled enables or disables Git LFS for the project
+func (g *GitLab) SetLFSEnabled(project string, enabled bool) error {
+	body := map[string]interface{}{"lfs_enabled": enabled}
+	return g.api.do("PUT", projectPath(project), body, nil)
+}
+
+// GetPushRule returns the project's push rule, or nil if none is configured
+func (g *GitLab) GetPushRule(project string) (*GitLabPushRule, error) {
+	var rule GitLabPushRule
+	if err := g.api.do("GET", projectPath(project)+"/push_rule", nil, &rule); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if rule.ID == 0 {
+		return nil, nil
+	}
+	return &rule, nil
+}
+
+// SetMaxFileSize sets the push rule limiting the size of pushed files, in
+// megabytes; 0 removes the limit. Push rules require GitLab Premium.
+func (g *GitLab) SetMaxFileSize(project string, megabytes int) error {
+	rule, err := g.GetPushRule(project)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{"max_file_size": megabytes}
+	if rule == nil {
+		return g.api.do("POST", projectPath(project)+"/push_rule", body, nil)
+	}
+	return g.api.do("PUT", projectPath(project)+"/push_rule", body, nil)
+}
@@ -0,0 +1,78 @@
+package forge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Provider deletes repositories on one kind of forge
+type Provider interface {
+	Name() string                 // github, gitlab, gitea or bitbucket
+	DeleteRepo(repo string) error // repo is OWNER/NAME, or GROUP/.../NAME on GitLab
+}
+
+// RepoCreator is a Provider that can create repositories
+type RepoCreator interface {
+	CreateRepo(repo string, private bool) error
+}
+
+// LFSToggler is a Provider with a per-repository Git LFS setting
+type LFSToggler interface {
+	LFSEnabled(repo string) (bool, error)
+	SetLFSEnabled(repo string, enabled bool) error
+}
+
+// LFSReporter is a Provider that reports the Git LFS storage of a repository
+type LFSReporter interface {
+	LFSUsage(repo string) (LFSUsage, error)
+}
+
+// LFSUsage is the Git LFS storage a repository accounts for on its forge
+type LFSUsage struct {
+	Bytes    int64    // Stored LFS objects
+	Source   string   // What Bytes measures, e.g. "average this billing month"
+	StoredIn string   // Repository whose storage holds the objects instead, for forks
+	Notes    []string // What deleting the repository does to the usage
+}
+
+// Providers lists the names accepted by NewProvider
+var Providers = []string{"github", "gitlab", "gitea", "bitbucket"}
+
+// NewProvider creates the named provider for the forge at host. An empty
+// baseURL selects https://HOST, and an empty token falls back to the
+// provider's token environment variable.
+func NewProvider(name, host, baseURL, token string) (Provider, error) {
+	if baseURL == "" && host != "" {
+		baseURL = "https://" + host
+	}
+	switch name {
+	case "github":
+		return NewGitHub(host), nil
+	case "gitlab":
+		return NewGitLab(baseURL, token)
+	case "gitea":
+		return NewGitea(baseURL, token)
+	case "bitbucket":
+		return NewBitbucket(baseURL, token)
+	default:
+		return nil, fmt.Errorf("unknown provider '%s'; use one of %s", name, strings.Join(Providers, ", "))
+	}
+}
+
+// DetectProvider guesses the provider from a host name. GitHub, GitLab and
+// Bitbucket hosts are recognized by name; Codeberg and hosts with 'gitea' or
+// 'forgejo' in their name are taken as Gitea. Other hosts return "".
+func DetectProvider(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com" || strings.HasPrefix(host, "github."):
+		return "github"
+	case strings.Contains(host, "gitlab"):
+		return "gitlab"
+	case strings.Contains(host, "bitbucket"):
+		return "bitbucket"
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return "gitea"
+	}
+	return ""
+}
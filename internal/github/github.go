@@ -8,41 +8,23 @@ import (
 	"strings"
 
 	"github.com/lithammer/dedent"
+	"github.com/mslinn/git_lfs_scripts/internal/prereq"
 )
 
-// DeleteRepo deletes a GitHub repository using the gh CLI
-func DeleteRepo(repoName string) error {
-	cmd := exec.Command("gh", "repo", "delete", repoName, "--yes")
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		return fmt.Errorf("failed to delete repository %s: %v\nOutput: %s", repoName, err, string(output))
-	}
-
-	return nil
-}
-
 // CheckGHInstalled checks if the gh CLI is installed and attempts to install it if not
 func CheckGHInstalled() error {
-	// Check if gh is already installed
-	cmd := exec.Command("gh", "--version")
-	if err := cmd.Run(); err == nil {
+	gh := prereq.Bin("gh", "install from: https://cli.github.com/").WithInstaller(installGH)
+	if err := prereq.Verify(gh); err == nil {
 		return nil // gh is already installed
 	}
 
 	// gh not found, attempt installation
 	fmt.Println("GitHub CLI (gh) not found. Attempting to install...")
 
-	if err := installGH(); err != nil {
+	if err := prereq.Ensure(true, gh); err != nil {
 		return fmt.Errorf("failed to install gh CLI: %v\nPlease install manually from: https://cli.github.com/", err)
 	}
 
-	// Verify installation succeeded
-	cmd = exec.Command("gh", "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("gh CLI installation appeared to succeed but gh is still not available\nPlease install manually from: https://cli.github.com/")
-	}
-
 	fmt.Println("Successfully installed GitHub CLI (gh)")
 	return nil
 }
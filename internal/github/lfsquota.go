@@ -0,0 +1,202 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// bytesPerGB is the gigabyte GitHub bills in
+const bytesPerGB = 1 << 30
+
+// LFSUsage is the Git LFS usage of an account in one billing month
+type LFSUsage struct {
+	Account     string
+	Month       time.Time // First day of the billing month
+	StorageGB   float64   // Average storage so far this month
+	BandwidthGB float64   // Download bandwidth so far this month
+	NetAmount   float64   // Billed amount so far, in USD
+}
+
+// usageItem is one entry of the enhanced billing platform usage report
+type usageItem struct {
+	Date      string  `json:"date"`
+	Product   string  `json:"product"`
+	Repo      string  `json:"repositoryName"`
+	SKU       string  `json:"sku"`
+	Quantity  float64 `json:"quantity"`
+	UnitType  string  `json:"unitType"`
+	NetAmount float64 `json:"netAmount"`
+}
+
+// AccountType returns "User" or "Organization" for a GitHub account
+func AccountType(account string) (string, error) {
+	output, err := ghAPI("users/"+account, "--jq", ".type")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CurrentUser returns the login of the account gh is authenticated as
+func CurrentUser() (string, error) {
+	output, err := ghAPI("user", "--jq", ".login")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetLFSUsage reads the Git LFS storage and bandwidth usage of a user or
+// organization for the current billing month from the billing usage API.
+// Reading it requires an admin or billing manager token.
+func GetLFSUsage(account string, isOrg bool, now time.Time) (LFSUsage, error) {
+	endpoint := fmt.Sprintf("users/%s/settings/billing/usage", account)
+	if isOrg {
+		endpoint = fmt.Sprintf("organizations/%s/settings/billing/usage", account)
+	}
+	endpoint += fmt.Sprintf("?year=%d&month=%d", now.Year(), int(now.Month()))
+
+	output, err := ghAPI(endpoint)
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	usage, err := parseLFSUsage(output, now, "")
+	usage.Account = account
+	return usage, err
+}
+
+// GetRepoLFSUsage reads the Git LFS usage of the repository OWNER/NAME for
+// the current billing month, from the billing usage report of its owner
+func GetRepoLFSUsage(repo string, isOrg bool, now time.Time) (LFSUsage, error) {
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	endpoint := fmt.Sprintf("users/%s/settings/billing/usage", owner)
+	if isOrg {
+		endpoint = fmt.Sprintf("organizations/%s/settings/billing/usage", owner)
+	}
+	endpoint += fmt.Sprintf("?year=%d&month=%d", now.Year(), int(now.Month()))
+
+	output, err := ghAPI(endpoint)
+	if err != nil {
+		return LFSUsage{}, err
+	}
+	usage, err := parseLFSUsage(output, now, name)
+	usage.Account = owner
+	return usage, err
+}
+
+// parseLFSUsage sums the Git LFS items of a billing usage report, only those
+// of the repository named repo unless it is empty. Storage is reported in
+// gigabyte-hours, so the month's average is the total divided by the hours
+// elapsed.
+func parseLFSUsage(data []byte, now time.Time, repo string) (LFSUsage, error) {
+	var report struct {
+		UsageItems []usageItem `json:"usageItems"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return LFSUsage{}, fmt.Errorf("invalid billing usage response: %v", err)
+	}
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	usage := LFSUsage{Month: month}
+	var gigabyteHours float64
+	for _, item := range report.UsageItems {
+		if !strings.EqualFold(item.Product, "git_lfs") {
+			continue
+		}
+		// Reports name repositories with or without their owner
+		if repo != "" && !strings.EqualFold(path.Base(item.Repo), repo) {
+			continue
+		}
+		usage.NetAmount += item.NetAmount
+		switch {
+		case strings.Contains(item.SKU, "storage"):
+			if strings.EqualFold(item.UnitType, "GigabyteHours") {
+				gigabyteHours += item.Quantity
+			} else {
+				usage.StorageGB = max(usage.StorageGB, item.Quantity)
+			}
+		case strings.Contains(item.SKU, "bandwidth"):
+			usage.BandwidthGB += item.Quantity
+		}
+	}
+
+	if hours := now.Sub(month).Hours(); gigabyteHours > 0 && hours > 0 {
+		usage.StorageGB = gigabyteHours / hours
+	}
+	return usage, nil
+}
+
+// GBToBytes converts billed gigabytes to bytes
+func GBToBytes(gb float64) int64 {
+	return int64(gb * bytesPerGB)
+}
+
+// ghAPI runs a gh api request and returns the response. Requests that only
+// read are retried and stopped after common.Timeout; changes are not
+// retried, as a change that failed may have been made anyway.
+func ghAPI(args ...string) ([]byte, error) {
+	var output []byte
+	attempt := func(ctx context.Context) error {
+		var err error
+		cmd := exec.Command("gh", append([]string{"api", "-H", "Accept: application/vnd.github+json"}, args...)...)
+		output, err = common.QueryContext(ctx, cmd)
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			message := strings.TrimSpace(string(exitErr.Stderr))
+			if clientError(message) {
+				return common.Permanent(errors.New(message))
+			}
+			return errors.New(message)
+		}
+		return err
+	}
+
+	var err error
+	if readOnly(args) {
+		err = common.Network("gh api "+args[0], attempt)
+	} else {
+		err = attempt(common.Context())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gh api %s failed: %v", args[0], err)
+	}
+	return output, nil
+}
+
+// clientErrorPattern matches the status gh reports for a rejected request
+var clientErrorPattern = regexp.MustCompile(`\(HTTP 4\d\d\)`)
+
+// clientError reports whether gh failed with an HTTP 4xx status other than
+// a rate limit, such as 404 Not Found, which asking again does not change
+func clientError(message string) bool {
+	return clientErrorPattern.MatchString(message) && !strings.Contains(message, "HTTP 429") &&
+		!strings.Contains(strings.ToLower(message), "rate limit")
+}
+
+// readOnly reports whether gh api arguments make a request that changes
+// nothing: a GET, which sends no fields, or a GraphQL query
+func readOnly(args []string) bool {
+	graphQL := len(args) > 0 && args[0] == "graphql"
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-X"), strings.HasPrefix(arg, "--method"), arg == "--input":
+			return false
+		case strings.HasPrefix(arg, "query=mutation"):
+			return false
+		case !graphQL && (arg == "-f" || arg == "-F" || arg == "--field" || arg == "--raw-field"):
+			return false
+		}
+	}
+	return true
+}
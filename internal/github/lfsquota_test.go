@@ -0,0 +1,93 @@
+package github
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestParseLFSUsage tests summing the Git LFS items of a billing usage report
+func TestParseLFSUsage(t *testing.T) {
+	report := []byte(`{"usageItems": [
+		{"date": "2026-10-01", "product": "git_lfs", "sku": "git_lfs_storage", "quantity": 240, "unitType": "GigabyteHours", "netAmount": 0.1},
+		{"date": "2026-10-02", "product": "git_lfs", "sku": "git_lfs_storage", "quantity": 240, "unitType": "GigabyteHours", "netAmount": 0.1},
+		{"date": "2026-10-01", "product": "git_lfs", "sku": "git_lfs_bandwidth", "quantity": 1.5, "unitType": "Gigabytes", "netAmount": 0},
+		{"date": "2026-10-02", "product": "git_lfs", "sku": "git_lfs_bandwidth", "quantity": 2.5, "unitType": "Gigabytes", "netAmount": 0.5},
+		{"date": "2026-10-02", "product": "actions", "sku": "actions_linux", "quantity": 100, "unitType": "Minutes", "netAmount": 3}
+	]}`)
+	now := time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC) // 48 hours into the month
+
+	usage, err := parseLFSUsage(report, now, "")
+	if err != nil {
+		t.Fatalf("parseLFSUsage() error = %v", err)
+	}
+	if math.Abs(usage.StorageGB-10) > 1e-9 {
+		t.Errorf("StorageGB = %v, want 10", usage.StorageGB)
+	}
+	if usage.BandwidthGB != 4 {
+		t.Errorf("BandwidthGB = %v, want 4", usage.BandwidthGB)
+	}
+	if math.Abs(usage.NetAmount-0.7) > 1e-9 {
+		t.Errorf("NetAmount = %v, want 0.7", usage.NetAmount)
+	}
+	if want := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC); !usage.Month.Equal(want) {
+		t.Errorf("Month = %v, want %v", usage.Month, want)
+	}
+
+	repoReport := []byte(`{"usageItems": [
+		{"product": "git_lfs", "sku": "git_lfs_storage", "repositoryName": "org/assets", "quantity": 96, "unitType": "GigabyteHours"},
+		{"product": "git_lfs", "sku": "git_lfs_storage", "repositoryName": "org/assets-old", "quantity": 480, "unitType": "GigabyteHours"},
+		{"product": "git_lfs", "sku": "git_lfs_bandwidth", "repositoryName": "Assets", "quantity": 3, "unitType": "Gigabytes"}
+	]}`)
+	usage, err = parseLFSUsage(repoReport, now, "assets")
+	if err != nil {
+		t.Fatalf("parseLFSUsage() error = %v", err)
+	}
+	if math.Abs(usage.StorageGB-2) > 1e-9 || usage.BandwidthGB != 3 {
+		t.Errorf("repository usage = %v GB stored, %v GB downloaded, want 2 and 3", usage.StorageGB, usage.BandwidthGB)
+	}
+
+	if _, err := parseLFSUsage([]byte("not json"), now, ""); err == nil {
+		t.Error("parseLFSUsage() accepted invalid JSON")
+	}
+}
+
+// TestReadOnly tests which gh api requests are retried
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"repos/o/r"}, true},
+		{[]string{"orgs/o/repos", "--paginate", "--jq", ".[].full_name"}, true},
+		{[]string{"repos/o/r/releases/1", "-X", "PATCH", "-f", "body=x"}, false},
+		{[]string{"repos/o/r/issues", "-f", "title=x"}, false},
+		{[]string{"graphql", "-f", "query=query { viewer { login } }"}, true},
+		{[]string{"graphql", "-f", "query=mutation($repo: ID!) { x }", "-f", "repo=1"}, false},
+	}
+	for _, tt := range tests {
+		if got := readOnly(tt.args); got != tt.want {
+			t.Errorf("readOnly(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestClientError tests which gh api failures are not retried
+func TestClientError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{"gh: Not Found (HTTP 404)", true},
+		{"gh: Validation Failed (HTTP 422)", true},
+		{"gh: API rate limit exceeded for user ID 1. (HTTP 403)", false},
+		{"gh: Too Many Requests (HTTP 429)", false},
+		{"gh: Server Error (HTTP 502)", false},
+		{"error connecting to api.github.com", false},
+	}
+	for _, tt := range tests {
+		if got := clientError(tt.message); got != tt.want {
+			t.Errorf("clientError(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// TeamPermissions lists the permissions a team can have on a repository,
+// weakest first
+var TeamPermissions = []string{"pull", "triage", "push", "maintain", "admin"}
+
+// Repo is the part of a GitHub repository that administration uses
+type Repo struct {
+	FullName string `json:"full_name"`
+	URL      string `json:"html_url"`
+	Private  bool   `json:"private"`
+	Fork     bool   `json:"fork"`
+	Owner    struct {
+		Login string `json:"login"`
+		Type  string `json:"type"` // User or Organization
+	} `json:"owner"`
+	Source *struct {
+		FullName string `json:"full_name"`
+	} `json:"source,omitempty"` // Root of the fork network, for forks
+}
+
+// TeamAccess is a team's permission on a repository
+type TeamAccess struct {
+	Slug       string `json:"slug"`
+	Permission string `json:"permission"`
+}
+
+// GetRepo returns the repository OWNER/NAME
+func GetRepo(repo string) (Repo, error) {
+	var r Repo
+	output, err := ghAPI("repos/" + repo)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(output, &r); err != nil {
+		return r, fmt.Errorf("invalid repository response: %v", err)
+	}
+	return r, nil
+}
+
+// CreateRepo creates the empty repository OWNER/NAME. An organization owner
+// gets it under the organization, which needs permission to create
+// repositories there; a user owner must be the account gh is authenticated as.
+func CreateRepo(repo string, private bool) error {
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return err
+	}
+	ownerType, err := AccountType(owner)
+	if err != nil {
+		return err
+	}
+	endpoint := "user/repos"
+	if ownerType == "Organization" {
+		endpoint = "orgs/" + owner + "/repos"
+	} else if user, err := CurrentUser(); err != nil {
+		return err
+	} else if !strings.EqualFold(user, owner) {
+		return fmt.Errorf("%s is a user other than %s; only organizations and your own account can own new repositories", owner, user)
+	}
+	return ghAPIChange(endpoint, "-X", "POST", "-f", "name="+name, "-F", fmt.Sprintf("private=%t", private))
+}
+
+// RepoTeams returns the teams with access to the organization repository OWNER/NAME
+func RepoTeams(repo string) ([]TeamAccess, error) {
+	output, err := ghAPI("repos/"+repo+"/teams", "--paginate")
+	if err != nil {
+		return nil, err
+	}
+	return parseTeams(output)
+}
+
+// parseTeams reads the teams of a repository; --paginate concatenates the
+// arrays of the pages
+func parseTeams(data []byte) ([]TeamAccess, error) {
+	var teams []TeamAccess
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var page []TeamAccess
+		if err := decoder.Decode(&page); err != nil {
+			return nil, fmt.Errorf("invalid teams response: %v", err)
+		}
+		teams = append(teams, page...)
+	}
+	return teams, nil
+}
+
+// SetTeamPermission grants a team of the repository's organization a
+// permission on the repository OWNER/NAME, adding the team if needed
+func SetTeamPermission(repo, team, permission string) error {
+	owner, _, err := splitRepo(repo)
+	if err != nil {
+		return err
+	}
+	if !validPermission(permission) {
+		return fmt.Errorf("invalid team permission '%s'; use one of %s", permission, strings.Join(TeamPermissions, ", "))
+	}
+	return ghAPIChange(fmt.Sprintf("orgs/%s/teams/%s/repos/%s", owner, team, repo), "-X", "PUT", "-f", "permission="+permission)
+}
+
+// RemoveTeam takes away a team's access to the repository OWNER/NAME
+func RemoveTeam(repo, team string) error {
+	owner, _, err := splitRepo(repo)
+	if err != nil {
+		return err
+	}
+	return ghAPIChange(fmt.Sprintf("orgs/%s/teams/%s/repos/%s", owner, team, repo), "-X", "DELETE")
+}
+
+// ParseTeamPermission splits a TEAM:PERMISSION option value
+func ParseTeamPermission(value string) (string, string, error) {
+	team, permission, found := strings.Cut(value, ":")
+	if !found || team == "" || !validPermission(permission) {
+		return "", "", fmt.Errorf("'%s' is not TEAM:PERMISSION, with PERMISSION one of %s", value, strings.Join(TeamPermissions, ", "))
+	}
+	return team, permission, nil
+}
+
+func validPermission(permission string) bool {
+	for _, p := range TeamPermissions {
+		if permission == p {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLFSEnabled enables or disables Git LFS for the repository OWNER/NAME.
+// GitHub has no organization-wide switch in its API, and no way to read the
+// setting back.
+func SetLFSEnabled(repo string, enabled bool) error {
+	method := "PUT"
+	if !enabled {
+		method = "DELETE"
+	}
+	return ghAPIChange("repos/"+repo+"/lfs", "-X", method)
+}
+
+// OrgRepos returns the OWNER/NAME of every repository of an organization
+func OrgRepos(org string) ([]string, error) {
+	output, err := ghAPI("orgs/"+org+"/repos", "--paginate", "--jq", ".[].full_name")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// splitRepo splits OWNER/NAME
+func splitRepo(repo string) (string, string, error) {
+	owner, name, found := strings.Cut(strings.Trim(repo, "/"), "/")
+	if !found || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("'%s' is not OWNER/NAME", repo)
+	}
+	return owner, name, nil
+}
+
+// ghAPIChange runs a gh api request that changes something; in dry-run mode
+// it is only printed
+func ghAPIChange(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("gh", append([]string{"api", "-H", "Accept: application/vnd.github+json"}, args...)...)
+	cmd.Stdout = &bytes.Buffer{}
+	cmd.Stderr = &stderr
+	if err := common.Run(cmd); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("gh api %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("gh api %s failed: %v", args[0], err)
+	}
+	return nil
+}
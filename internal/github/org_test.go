@@ -0,0 +1,46 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseTeams tests reading the paginated teams of a repository
+func TestParseTeams(t *testing.T) {
+	data := []byte(`[{"slug": "artists", "permission": "push"}]
+[{"slug": "leads", "permission": "maintain"}]`)
+
+	teams, err := parseTeams(data)
+	want := []TeamAccess{{Slug: "artists", Permission: "push"}, {Slug: "leads", Permission: "maintain"}}
+	if err != nil || !reflect.DeepEqual(teams, want) {
+		t.Errorf("parseTeams() = %v, %v, want %v", teams, err, want)
+	}
+	if teams, err := parseTeams([]byte("[]")); err != nil || len(teams) != 0 {
+		t.Errorf("parseTeams([]) = %v, %v", teams, err)
+	}
+}
+
+// TestParseTeamPermission tests parsing of --team values
+func TestParseTeamPermission(t *testing.T) {
+	team, permission, err := ParseTeamPermission("artists:push")
+	if err != nil || team != "artists" || permission != "push" {
+		t.Errorf("ParseTeamPermission(artists:push) = %q, %q, %v", team, permission, err)
+	}
+	for _, value := range []string{"artists", ":push", "artists:write", "artists:"} {
+		if _, _, err := ParseTeamPermission(value); err == nil {
+			t.Errorf("ParseTeamPermission(%q) accepted an invalid value", value)
+		}
+	}
+}
+
+// TestSplitRepo tests splitting of OWNER/NAME
+func TestSplitRepo(t *testing.T) {
+	if owner, name, err := splitRepo("acme/assets"); err != nil || owner != "acme" || name != "assets" {
+		t.Errorf("splitRepo(acme/assets) = %q, %q, %v", owner, name, err)
+	}
+	for _, repo := range []string{"assets", "acme/", "/assets", "acme/sub/assets"} {
+		if _, _, err := splitRepo(repo); err == nil {
+			t.Errorf("splitRepo(%q) accepted an invalid repository", repo)
+		}
+	}
+}
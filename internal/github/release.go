@@ -0,0 +1,187 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Release is the part of a GitHub release that announcements and artifact
+// verification use
+type Release struct {
+	ID      int64          `json:"id"`
+	TagName string         `json:"tag_name"`
+	Body    string         `json:"body"`
+	URL     string         `json:"html_url"`
+	Draft   bool           `json:"draft"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file uploaded to a release
+type ReleaseAsset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// ReleaseByTag returns the release of a tag in OWNER/REPO. The tags
+// endpoint only knows published releases, so drafts are looked up in the
+// list of all releases.
+func ReleaseByTag(repo, tag string) (Release, error) {
+	var release Release
+	output, err := ghAPI(fmt.Sprintf("repos/%s/releases/tags/%s", repo, tag))
+	if err != nil {
+		list, listErr := ghAPI(fmt.Sprintf("repos/%s/releases", repo), "--paginate")
+		if listErr != nil {
+			return release, err
+		}
+		if draft, found, parseErr := findRelease(list, tag); parseErr == nil && found {
+			return draft, nil
+		}
+		return release, err
+	}
+	if err := json.Unmarshal(output, &release); err != nil {
+		return release, fmt.Errorf("invalid release response: %v", err)
+	}
+	return release, nil
+}
+
+// findRelease finds the release of a tag in a list of releases; --paginate
+// concatenates the arrays of the pages
+func findRelease(data []byte, tag string) (Release, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var page []Release
+		if err := decoder.Decode(&page); err != nil {
+			return Release{}, false, fmt.Errorf("invalid releases response: %v", err)
+		}
+		for _, release := range page {
+			if release.TagName == tag {
+				return release, true, nil
+			}
+		}
+	}
+	return Release{}, false, nil
+}
+
+// SetReleaseBody replaces the body of a release
+func SetReleaseBody(repo string, id int64, body string) error {
+	_, err := ghAPI(fmt.Sprintf("repos/%s/releases/%d", repo, id), "-X", "PATCH", "-f", "body="+body)
+	return err
+}
+
+// SetReleaseDraft turns a published release back into a draft, or publishes
+// a draft. Drafts are hidden from everyone without push access.
+func SetReleaseDraft(repo string, id int64, draft bool) error {
+	_, err := ghAPI(fmt.Sprintf("repos/%s/releases/%d", repo, id), "-X", "PATCH", "-F", fmt.Sprintf("draft=%t", draft))
+	return err
+}
+
+// DownloadReleaseAsset writes the content of a release asset to path
+func DownloadReleaseAsset(repo string, id int64, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("gh", "api", "-H", "Accept: application/octet-stream", fmt.Sprintf("repos/%s/releases/assets/%d", repo, id))
+	cmd.Stdout = file
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		if stderr.Len() > 0 {
+			return fmt.Errorf("gh api failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("gh api failed: %v", err)
+	}
+	return nil
+}
+
+// CreateDiscussion opens a discussion in the named category of OWNER/REPO
+// and returns its URL. Discussions must be enabled for the repository.
+func CreateDiscussion(repo, category, title, body string) (string, error) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return "", fmt.Errorf("repository '%s' must be given as OWNER/NAME", repo)
+	}
+	output, err := ghAPI("graphql",
+		"-f", `query=query($owner: String!, $name: String!) {
+			repository(owner: $owner, name: $name) {
+				id
+				discussionCategories(first: 100) { nodes { id name } }
+			}
+		}`,
+		"-f", "owner="+owner, "-f", "name="+name)
+	if err != nil {
+		return "", err
+	}
+	repoID, categoryID, err := parseDiscussionCategory(output, category)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", repo, err)
+	}
+
+	output, err = ghAPI("graphql",
+		"-f", `query=mutation($repo: ID!, $category: ID!, $title: String!, $body: String!) {
+			createDiscussion(input: {repositoryId: $repo, categoryId: $category, title: $title, body: $body}) {
+				discussion { url }
+			}
+		}`,
+		"-f", "repo="+repoID, "-f", "category="+categoryID, "-f", "title="+title, "-f", "body="+body)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Data struct {
+			CreateDiscussion struct {
+				Discussion struct {
+					URL string `json:"url"`
+				} `json:"discussion"`
+			} `json:"createDiscussion"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return "", fmt.Errorf("invalid discussion response: %v", err)
+	}
+	return response.Data.CreateDiscussion.Discussion.URL, nil
+}
+
+// parseDiscussionCategory returns the repository ID and the ID of the
+// category whose name matches, ignoring case
+func parseDiscussionCategory(data []byte, category string) (string, string, error) {
+	var response struct {
+		Data struct {
+			Repository struct {
+				ID         string `json:"id"`
+				Categories struct {
+					Nodes []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"nodes"`
+				} `json:"discussionCategories"`
+			} `json:"repository"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", "", fmt.Errorf("invalid repository response: %v", err)
+	}
+
+	repo := response.Data.Repository
+	var names []string
+	for _, c := range repo.Categories.Nodes {
+		if strings.EqualFold(c.Name, category) {
+			return repo.ID, c.ID, nil
+		}
+		names = append(names, c.Name)
+	}
+	if len(names) == 0 {
+		return "", "", fmt.Errorf("discussions are not enabled")
+	}
+	return "", "", fmt.Errorf("no discussion category '%s' (available: %s)", category, strings.Join(names, ", "))
+}
@@ -0,0 +1,41 @@
+package github
+
+import "testing"
+
+// TestParseDiscussionCategory tests finding a discussion category by name
+func TestParseDiscussionCategory(t *testing.T) {
+	data := []byte(`{"data": {"repository": {"id": "R_1", "discussionCategories": {"nodes": [
+		{"id": "C_1", "name": "General"},
+		{"id": "C_2", "name": "Announcements"}
+	]}}}}`)
+
+	repoID, categoryID, err := parseDiscussionCategory(data, "announcements")
+	if err != nil || repoID != "R_1" || categoryID != "C_2" {
+		t.Errorf("parseDiscussionCategory() = %q, %q, %v", repoID, categoryID, err)
+	}
+	if _, _, err := parseDiscussionCategory(data, "Releases"); err == nil {
+		t.Error("parseDiscussionCategory() found a missing category")
+	}
+
+	empty := []byte(`{"data": {"repository": {"id": "R_1", "discussionCategories": {"nodes": []}}}}`)
+	if _, _, err := parseDiscussionCategory(empty, "Announcements"); err == nil {
+		t.Error("parseDiscussionCategory() accepted a repository without discussions")
+	}
+}
+
+// TestFindRelease tests finding a draft in the pages of the releases list
+func TestFindRelease(t *testing.T) {
+	data := []byte(`[{"id": 1, "tag_name": "v1.1.0", "draft": false}]
+[{"id": 2, "tag_name": "v1.2.0", "draft": true, "html_url": "https://github.com/o/r/releases/tag/untagged-1"}]`)
+
+	release, found, err := findRelease(data, "v1.2.0")
+	if err != nil || !found || release.ID != 2 || !release.Draft {
+		t.Errorf("findRelease(v1.2.0) = %+v, %v, %v", release, found, err)
+	}
+	if _, found, err := findRelease(data, "v1.3.0"); err != nil || found {
+		t.Errorf("findRelease(v1.3.0) = %v, %v", found, err)
+	}
+	if _, _, err := findRelease([]byte(`{"message": "Not Found"}`), "v1.2.0"); err == nil {
+		t.Error("findRelease() accepted an object")
+	}
+}
@@ -0,0 +1,140 @@
+package github
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListedRepo is a repository as ListRepos returns it
+type ListedRepo struct {
+	FullName      string    `json:"full_name"`
+	Name          string    `json:"name"`
+	URL           string    `json:"html_url"`
+	Private       bool      `json:"private"`
+	Fork          bool      `json:"fork"`
+	Archived      bool      `json:"archived"`
+	DefaultBranch string    `json:"default_branch"`
+	Language      string    `json:"language"`
+	SizeKB        int64     `json:"size"` // Git repository size, without LFS objects
+	PushedAt      time.Time `json:"pushed_at"`
+}
+
+// RepoFilter selects the repositories of ListRepos. The zero value selects
+// every repository that is neither archived nor a fork.
+type RepoFilter struct {
+	Visibility  string    // public or private; empty for both
+	Archived    bool      // Include archived repositories
+	Forks       bool      // Include forks
+	Match       string    // Glob the repository name must match, e.g. game-*
+	Language    string    // Main language, as GitHub detects it
+	PushedSince time.Time // Only repositories pushed to since then
+}
+
+// ListRepos returns the repositories of a user or organization that match
+// the filter, sorted by name. For the authenticated user, private
+// repositories are included; other users only show their public ones.
+func ListRepos(owner string, filter RepoFilter) ([]ListedRepo, error) {
+	if filter.Visibility != "" && filter.Visibility != "public" && filter.Visibility != "private" {
+		return nil, fmt.Errorf("invalid visibility '%s'; use public or private", filter.Visibility)
+	}
+	if _, err := path.Match(filter.Match, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern '%s': %v", filter.Match, err)
+	}
+
+	ownerType, err := AccountType(owner)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := "users/" + owner + "/repos?type=owner&per_page=100"
+	if ownerType == "Organization" {
+		endpoint = "orgs/" + owner + "/repos?type=all&per_page=100"
+	} else if user, err := CurrentUser(); err == nil && strings.EqualFold(user, owner) {
+		endpoint = "user/repos?affiliation=owner&per_page=100"
+	}
+	output, err := ghAPI(endpoint, "--paginate")
+	if err != nil {
+		return nil, err
+	}
+	repos, err := parseRepos(output)
+	if err != nil {
+		return nil, err
+	}
+	return filterRepos(repos, filter), nil
+}
+
+// parseRepos reads a repository listing; --paginate concatenates the
+// arrays of the pages
+func parseRepos(data []byte) ([]ListedRepo, error) {
+	var repos []ListedRepo
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var page []ListedRepo
+		if err := decoder.Decode(&page); err != nil {
+			return nil, fmt.Errorf("invalid repositories response: %v", err)
+		}
+		repos = append(repos, page...)
+	}
+	return repos, nil
+}
+
+// filterRepos keeps the repositories that match the filter, sorted by name
+func filterRepos(repos []ListedRepo, filter RepoFilter) []ListedRepo {
+	var kept []ListedRepo
+	for _, r := range repos {
+		switch {
+		case r.Archived && !filter.Archived, r.Fork && !filter.Forks:
+			continue
+		case filter.Visibility == "public" && r.Private, filter.Visibility == "private" && !r.Private:
+			continue
+		case filter.Language != "" && !strings.EqualFold(r.Language, filter.Language):
+			continue
+		case !filter.PushedSince.IsZero() && r.PushedAt.Before(filter.PushedSince):
+			continue
+		}
+		if filter.Match != "" {
+			if matched, _ := path.Match(strings.ToLower(filter.Match), strings.ToLower(r.Name)); !matched {
+				continue
+			}
+		}
+		kept = append(kept, r)
+	}
+	sort.Slice(kept, func(i, j int) bool { return strings.ToLower(kept[i].FullName) < strings.ToLower(kept[j].FullName) })
+	return kept
+}
+
+// FileContent returns a file of the repository OWNER/NAME on its default
+// branch, read with the contents API. found is false when the file, or any
+// commit, does not exist.
+func FileContent(repo, file string) (content []byte, found bool, err error) {
+	output, err := ghAPI("repos/" + repo + "/contents/" + file)
+	if err != nil {
+		if strings.Contains(err.Error(), "HTTP 404") {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	content, err = parseContent(output)
+	return content, err == nil, err
+}
+
+// parseContent decodes the base64 content of a contents API response
+func parseContent(data []byte) ([]byte, error) {
+	var file struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+		Content  string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid contents response: %v", err)
+	}
+	if file.Type != "file" || file.Encoding != "base64" {
+		return nil, fmt.Errorf("not a file, or not base64 encoded: type '%s', encoding '%s'", file.Type, file.Encoding)
+	}
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+}
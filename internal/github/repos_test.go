@@ -0,0 +1,75 @@
+package github
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseRepos tests reading the paginated repositories of an owner
+func TestParseRepos(t *testing.T) {
+	data := []byte(`[{"full_name": "acme/web", "name": "web", "private": false}]
+[{"full_name": "acme/game", "name": "game", "private": true, "pushed_at": "2024-05-01T10:00:00Z"}]`)
+
+	repos, err := parseRepos(data)
+	if err != nil || len(repos) != 2 {
+		t.Fatalf("parseRepos() = %v, %v, want 2 repositories", repos, err)
+	}
+	if repos[1].FullName != "acme/game" || !repos[1].Private || repos[1].PushedAt.Year() != 2024 {
+		t.Errorf("parseRepos() second repository = %+v", repos[1])
+	}
+}
+
+// TestFilterRepos tests selecting repositories by filter
+func TestFilterRepos(t *testing.T) {
+	pushed := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	repos := []ListedRepo{
+		{FullName: "acme/web", Name: "web", Language: "Go", PushedAt: pushed},
+		{FullName: "acme/Game-Art", Name: "Game-Art", Private: true, PushedAt: pushed},
+		{FullName: "acme/old", Name: "old", Archived: true},
+		{FullName: "acme/fork", Name: "fork", Fork: true, PushedAt: pushed},
+	}
+
+	tests := []struct {
+		name   string
+		filter RepoFilter
+		want   []string
+	}{
+		{"default", RepoFilter{}, []string{"acme/Game-Art", "acme/web"}},
+		{"archived and forks", RepoFilter{Archived: true, Forks: true}, []string{"acme/fork", "acme/Game-Art", "acme/old", "acme/web"}},
+		{"private", RepoFilter{Visibility: "private"}, []string{"acme/Game-Art"}},
+		{"public", RepoFilter{Visibility: "public"}, []string{"acme/web"}},
+		{"match", RepoFilter{Match: "game-*"}, []string{"acme/Game-Art"}},
+		{"language", RepoFilter{Language: "go"}, []string{"acme/web"}},
+		{"pushed since", RepoFilter{Archived: true, PushedSince: pushed.Add(-time.Hour)}, []string{"acme/Game-Art", "acme/web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterRepos(repos, tt.filter)
+			var names []string
+			for _, r := range got {
+				names = append(names, r.FullName)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("filterRepos() = %v, want %v", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Errorf("filterRepos() = %v, want %v", names, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestParseContent tests decoding a file of the contents API
+func TestParseContent(t *testing.T) {
+	data := []byte(`{"type": "file", "encoding": "base64", "content": "Ki5wc2QgZmlsdGVy\nPWxmcwo=\n"}`)
+	content, err := parseContent(data)
+	if err != nil || string(content) != "*.psd filter=lfs\n" {
+		t.Errorf("parseContent() = %q, %v", content, err)
+	}
+	if _, err := parseContent([]byte(`[{"type": "file"}]`)); err == nil {
+		t.Error("parseContent() accepted a directory listing")
+	}
+}
@@ -0,0 +1,162 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CommitCheck is the outcome of a check run or commit status on a commit
+type CommitCheck struct {
+	Name  string
+	State string // "success", "pending" or "failure"
+}
+
+// PullRequest is a pull request associated with a commit
+type PullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"html_url"`
+}
+
+// CommitChecks returns the check runs and commit statuses of a commit in
+// OWNER/REPO, so CI from both GitHub Actions and external services counts
+func CommitChecks(repo, sha string) ([]CommitCheck, error) {
+	runs, err := ghAPI(fmt.Sprintf("repos/%s/commits/%s/check-runs?per_page=100", repo, sha))
+	if err != nil {
+		return nil, err
+	}
+	checks, err := parseCheckRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := ghAPI(fmt.Sprintf("repos/%s/commits/%s/status?per_page=100", repo, sha))
+	if err != nil {
+		return nil, err
+	}
+	more, err := parseStatuses(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return append(checks, more...), nil
+}
+
+// parseCheckRuns maps check runs to states; neutral and skipped runs pass
+func parseCheckRuns(data []byte) ([]CommitCheck, error) {
+	var response struct {
+		CheckRuns []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid check runs response: %v", err)
+	}
+
+	var checks []CommitCheck
+	for _, run := range response.CheckRuns {
+		state := "failure"
+		switch {
+		case run.Status != "completed":
+			state = "pending"
+		case run.Conclusion == "success" || run.Conclusion == "neutral" || run.Conclusion == "skipped":
+			state = "success"
+		}
+		checks = append(checks, CommitCheck{Name: run.Name, State: state})
+	}
+	return checks, nil
+}
+
+// parseStatuses reads the statuses of a combined commit status; error
+// statuses count as failures
+func parseStatuses(data []byte) ([]CommitCheck, error) {
+	var response struct {
+		Statuses []struct {
+			Context string `json:"context"`
+			State   string `json:"state"`
+		} `json:"statuses"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid commit status response: %v", err)
+	}
+
+	var checks []CommitCheck
+	for _, status := range response.Statuses {
+		state := status.State
+		if state == "error" {
+			state = "failure"
+		}
+		checks = append(checks, CommitCheck{Name: status.Context, State: state})
+	}
+	return checks, nil
+}
+
+// PullRequestsForCommit returns the merged pull requests that contain a commit
+func PullRequestsForCommit(repo, sha string) ([]PullRequest, error) {
+	output, err := ghAPI(fmt.Sprintf("repos/%s/commits/%s/pulls", repo, sha))
+	if err != nil {
+		return nil, err
+	}
+	return parsePullRequests(output)
+}
+
+func parsePullRequests(data []byte) ([]PullRequest, error) {
+	var pulls []struct {
+		PullRequest
+		MergedAt *string `json:"merged_at"`
+	}
+	if err := json.Unmarshal(data, &pulls); err != nil {
+		return nil, fmt.Errorf("invalid pull request list: %v", err)
+	}
+
+	var merged []PullRequest
+	for _, p := range pulls {
+		if p.MergedAt != nil && *p.MergedAt != "" {
+			merged = append(merged, p.PullRequest)
+		}
+	}
+	return merged, nil
+}
+
+// Approvers returns the logins whose latest review of a pull request approves it
+func Approvers(repo string, number int) ([]string, error) {
+	output, err := ghAPI(fmt.Sprintf("repos/%s/pulls/%d/reviews?per_page=100", repo, number))
+	if err != nil {
+		return nil, err
+	}
+	return parseApprovers(output)
+}
+
+// parseApprovers keeps each reviewer's latest decisive review; comments
+// neither grant nor withdraw an approval
+func parseApprovers(data []byte) ([]string, error) {
+	var reviews []struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(data, &reviews); err != nil {
+		return nil, fmt.Errorf("invalid review list: %v", err)
+	}
+
+	latest := make(map[string]string)
+	for _, review := range reviews { // Reviews are listed oldest first
+		switch review.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			latest[strings.ToLower(review.User.Login)] = review.State
+		}
+	}
+
+	var approvers []string
+	for login, state := range latest {
+		if state == "APPROVED" {
+			approvers = append(approvers, login)
+		}
+	}
+	sort.Strings(approvers)
+	return approvers, nil
+}
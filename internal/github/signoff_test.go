@@ -0,0 +1,63 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseCheckRuns tests mapping check run conclusions to states
+func TestParseCheckRuns(t *testing.T) {
+	data := []byte(`{"total_count": 4, "check_runs": [
+		{"name": "test", "status": "completed", "conclusion": "success"},
+		{"name": "lint", "status": "completed", "conclusion": "failure"},
+		{"name": "docs", "status": "completed", "conclusion": "skipped"},
+		{"name": "build", "status": "in_progress", "conclusion": null}
+	]}`)
+	checks, err := parseCheckRuns(data)
+	if err != nil {
+		t.Fatalf("parseCheckRuns() error = %v", err)
+	}
+	want := []CommitCheck{
+		{Name: "test", State: "success"},
+		{Name: "lint", State: "failure"},
+		{Name: "docs", State: "success"},
+		{Name: "build", State: "pending"},
+	}
+	if !reflect.DeepEqual(checks, want) {
+		t.Errorf("parseCheckRuns() = %+v, want %+v", checks, want)
+	}
+}
+
+// TestParseApprovers tests that only each reviewer's latest decision counts
+func TestParseApprovers(t *testing.T) {
+	data := []byte(`[
+		{"user": {"login": "alice"}, "state": "CHANGES_REQUESTED"},
+		{"user": {"login": "bob"}, "state": "APPROVED"},
+		{"user": {"login": "alice"}, "state": "APPROVED"},
+		{"user": {"login": "alice"}, "state": "COMMENTED"},
+		{"user": {"login": "carol"}, "state": "APPROVED"},
+		{"user": {"login": "carol"}, "state": "DISMISSED"}
+	]`)
+	approvers, err := parseApprovers(data)
+	if err != nil {
+		t.Fatalf("parseApprovers() error = %v", err)
+	}
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(approvers, want) {
+		t.Errorf("parseApprovers() = %v, want %v", approvers, want)
+	}
+}
+
+// TestParsePullRequests tests that unmerged pull requests are ignored
+func TestParsePullRequests(t *testing.T) {
+	data := []byte(`[
+		{"number": 12, "title": "Add feature", "html_url": "https://github.com/o/r/pull/12", "merged_at": "2026-10-01T10:00:00Z"},
+		{"number": 13, "title": "Abandoned", "html_url": "https://github.com/o/r/pull/13", "merged_at": null}
+	]`)
+	pulls, err := parsePullRequests(data)
+	if err != nil {
+		t.Fatalf("parsePullRequests() error = %v", err)
+	}
+	if len(pulls) != 1 || pulls[0].Number != 12 || pulls[0].Title != "Add feature" {
+		t.Errorf("parsePullRequests() = %+v, want only #12", pulls)
+	}
+}
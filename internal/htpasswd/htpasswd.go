@@ -0,0 +1,153 @@
+// Package htpasswd manages Apache-style htpasswd files of bcrypt-hashed
+// credentials, as read by uwsgi's basicauth router
+package htpasswd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt costs; each step doubles the work
+const (
+	MinCost     = bcrypt.MinCost
+	MaxCost     = bcrypt.MaxCost
+	DefaultCost = bcrypt.DefaultCost
+)
+
+// maxPasswordLength is how many bytes of a password bcrypt uses; crypt()
+// ignores the rest, and so do Hash and Compare
+const maxPasswordLength = 72
+
+// ErrMismatch is returned by Compare for a wrong password
+var ErrMismatch = bcrypt.ErrMismatchedHashAndPassword
+
+// Hash returns the bcrypt hash of password with a random salt, in the $2y$
+// variant Apache's htpasswd writes
+func Hash(password string, cost int) (string, error) {
+	if cost < MinCost || cost > MaxCost {
+		return "", fmt.Errorf("bcrypt cost must be between %d and %d", MinCost, MaxCost)
+	}
+	hash, err := bcrypt.GenerateFromPassword(usedBytes(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return "$2y$" + strings.TrimPrefix(string(hash), "$2a$"), nil
+}
+
+// Compare checks password against a bcrypt hash; $2a$, $2b$ and $2y$
+// hashes verify alike
+func Compare(hash, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), usedBytes(password))
+}
+
+// usedBytes returns the part of password bcrypt uses
+func usedBytes(password string) []byte {
+	if len(password) > maxPasswordLength {
+		password = password[:maxPasswordLength]
+	}
+	return []byte(password)
+}
+
+// Entry is a user and the hash of their password
+type Entry struct {
+	User string
+	Hash string
+}
+
+// File is the content of an htpasswd file, in file order
+type File struct {
+	Path    string
+	Entries []Entry
+}
+
+// Load reads an htpasswd file; a missing file has no entries
+func Load(path string) (*File, error) {
+	f := &File{Path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected USER:HASH", path, n+1)
+		}
+		f.Entries = append(f.Entries, Entry{User: user, Hash: hash})
+	}
+	return f, nil
+}
+
+// ValidUser checks that a user name can be stored and sent with basic auth
+func ValidUser(user string) error {
+	if user == "" || strings.ContainsAny(user, ": \t\r\n#") {
+		return fmt.Errorf("invalid user name '%s': it must be non-empty without colons, whitespace or #", user)
+	}
+	return nil
+}
+
+// Find returns the entry of user, or nil
+func (f *File) Find(user string) *Entry {
+	for i := range f.Entries {
+		if f.Entries[i].User == user {
+			return &f.Entries[i]
+		}
+	}
+	return nil
+}
+
+// Set stores the hash of user, replacing any previous one; it reports
+// whether user is new
+func (f *File) Set(user, hash string) bool {
+	if entry := f.Find(user); entry != nil {
+		entry.Hash = hash
+		return false
+	}
+	f.Entries = append(f.Entries, Entry{User: user, Hash: hash})
+	return true
+}
+
+// Remove deletes user and reports whether it was present
+func (f *File) Remove(user string) bool {
+	for i, entry := range f.Entries {
+		if entry.User == user {
+			f.Entries = append(f.Entries[:i], f.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the file, readable only by its owner, replacing it atomically
+func (f *File) Save() error {
+	var b strings.Builder
+	for _, entry := range f.Entries {
+		fmt.Fprintf(&b, "%s:%s\n", entry.User, entry.Hash)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(b.String())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,86 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCompare tests bcrypt against hashes made by the C library's crypt()
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		password string
+		hash     string
+	}{
+		{"x", "$2b$04$abcdefghijklmnopqrstuuPp7HPfoAs8I2dCQCQ/fW7zEJv8I8C8e"},
+		{"", "$2y$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy"},
+		{"correct horse battery staple", "$2y$06$0123456789abcdefghijkeh5EYuTQp5F9p.ZOGN24mdsHNpBbgdAm"},
+		{strings.Repeat("a", 80), "$2b$04$......................UaUp2CqHXn14N7RprrzoDsNv91ahi36"},
+	}
+	for _, tt := range tests {
+		if err := Compare(tt.hash, tt.password); err != nil {
+			t.Errorf("Compare(%s, %q) = %v", tt.hash, tt.password, err)
+		}
+		if err := Compare(tt.hash, tt.password+"!"); err != ErrMismatch && len(tt.password) < maxPasswordLength {
+			t.Errorf("Compare(%s) accepted a wrong password: %v", tt.hash, err)
+		}
+	}
+	if err := Compare("$1$salt$hash", "x"); err == nil {
+		t.Error("Compare() accepted a non-bcrypt hash")
+	}
+}
+
+// TestHash tests that a new hash verifies and uses a fresh salt
+func TestHash(t *testing.T) {
+	first, err := Hash("secret", MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Hash("secret", MinCost)
+	if !strings.HasPrefix(first, "$2y$04$") || first == second {
+		t.Errorf("Hash() = %s, %s", first, second)
+	}
+	if err := Compare(first, "secret"); err != nil {
+		t.Errorf("Compare(Hash()) = %v", err)
+	}
+	if _, err := Hash("secret", 3); err == nil {
+		t.Error("Hash() accepted cost 3")
+	}
+}
+
+// TestFile tests adding, replacing and removing users of an htpasswd file
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth", "htpasswd")
+	f, err := Load(path)
+	if err != nil || len(f.Entries) != 0 {
+		t.Fatalf("Load(missing) = %+v, %v", f, err)
+	}
+	if !f.Set("alice", "h1") || !f.Set("bob", "h2") || f.Set("alice", "h3") {
+		t.Error("Set() reported new users wrongly")
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Save() mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	f, err = Load(path)
+	if err != nil || len(f.Entries) != 2 || f.Find("alice").Hash != "h3" {
+		t.Fatalf("Load() = %+v, %v", f, err)
+	}
+	if !f.Remove("alice") || f.Remove("carol") || f.Find("alice") != nil {
+		t.Error("Remove() failed")
+	}
+
+	os.WriteFile(path, []byte("# comment\n\nbroken line\n"), 0600)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), ":3:") {
+		t.Errorf("Load(invalid) error = %v", err)
+	}
+	for _, user := range []string{"", "a:b", "a b"} {
+		if ValidUser(user) == nil {
+			t.Errorf("ValidUser(%q) = nil", user)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cacheVersion changes whenever the cache format changes
+const cacheVersion = 1
+
+// File is a file in the working tree, classified by its filter attribute
+type File struct {
+	Path      string `json:"path"` // Relative to the top of the working tree
+	LFS       bool   `json:"lfs"`  // filter=lfs applies to the file
+	Untracked bool   `json:"-"`    // Not in the index; never cached
+}
+
+// cache is the on-disk inventory of the HEAD tree. Working tree changes are
+// applied on every load with git status, because untracked files do not
+// change HEAD or the index.
+type cache struct {
+	Version    int    `json:"version"`
+	Head       string `json:"head"`
+	Attributes string `json:"attributes"` // Hash of every attributes file the classification used
+	Files      []File `json:"files"`
+}
+
+// Stats describes how Load produced the inventory
+type Stats struct {
+	Source  string // "cache", "incremental" or "full"
+	Changed int    // Paths reclassified
+}
+
+// Load returns the classified files of the working tree, reusing and
+// refreshing the cache in the repository's Git directory. With useCache
+// false the cache is neither read nor written.
+func Load(useCache bool) ([]File, Stats, error) {
+	head := headCommit()
+
+	var stored *cache
+	if useCache {
+		stored = readCache()
+	}
+
+	base, stats, err := baseFiles(stored, head)
+	if err != nil {
+		return nil, stats, err
+	}
+	added, removed, untracked, err := statusChanges()
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// The classification depends on the attributes files in the working tree
+	attributes := attributesHash(base, added)
+	if stored != nil && stats.Source != "full" && stored.Attributes != attributes {
+		if base, err = buildBase(head); err != nil {
+			return nil, stats, err
+		}
+		stats = Stats{Source: "full", Changed: len(base)}
+	}
+
+	if useCache && stats.Source != "cache" {
+		writeCache(cache{Version: cacheVersion, Head: head, Attributes: attributes, Files: base})
+	}
+
+	files, err := merge(base, added, removed)
+	stats.Changed += len(added) + len(removed)
+	markUntracked(files, untracked)
+	return files, stats, err
+}
+
+// Ignored returns the classified untracked files that .gitignore,
+// $GIT_DIR/info/exclude or core.excludesFile ignore, which Load leaves out
+func Ignored() ([]File, error) {
+	output, err := git("ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--full-name", "--", ":/")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range strings.Split(output, "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	files, err := Classify(paths)
+	markUntracked(files, paths)
+	return files, err
+}
+
+// markUntracked flags the files whose paths are listed
+func markUntracked(files []File, untracked []string) {
+	if len(untracked) == 0 {
+		return
+	}
+	set := make(map[string]bool, len(untracked))
+	for _, p := range untracked {
+		set[p] = true
+	}
+	for i := range files {
+		files[i].Untracked = set[files[i].Path]
+	}
+}
+
+// Clear removes the cache file
+func Clear() error {
+	path, err := cachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RelativeTo keeps the files below prefix (as printed by git rev-parse
+// --show-prefix) and makes their paths relative to it
+func RelativeTo(files []File, prefix string) []File {
+	if prefix == "" {
+		return files
+	}
+	var relative []File
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, prefix) {
+			f.Path = strings.TrimPrefix(f.Path, prefix)
+			relative = append(relative, f)
+		}
+	}
+	return relative
+}
+
+// baseFiles returns the classified HEAD tree, from the cache when it matches
+// HEAD, incrementally refreshed when HEAD moved, or rebuilt
+func baseFiles(stored *cache, head string) ([]File, Stats, error) {
+	if stored != nil && stored.Head == head {
+		return stored.Files, Stats{Source: "cache"}, nil
+	}
+
+	if stored != nil && stored.Head != "" && head != "" {
+		output, err := git("diff-tree", "-r", "-z", "--no-renames", "--name-status", stored.Head, head)
+		if err == nil {
+			added, removed := parseNameStatus(output)
+			if !touchesAttributes(added) && !touchesAttributes(removed) {
+				files, err := merge(stored.Files, added, removed)
+				return files, Stats{Source: "incremental", Changed: len(added) + len(removed)}, err
+			}
+		}
+	}
+
+	files, err := buildBase(head)
+	return files, Stats{Source: "full", Changed: len(files)}, err
+}
+
+// buildBase classifies every file in the HEAD tree
+func buildBase(head string) ([]File, error) {
+	if head == "" {
+		return nil, nil // No commits yet
+	}
+	output, err := git("ls-tree", "-r", "-z", "--full-tree", head)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, record := range strings.Split(output, "\x00") {
+		// Format: MODE SP TYPE SP OBJECT TAB PATH
+		meta, p, found := strings.Cut(record, "\t")
+		if found && strings.Contains(meta, " blob ") {
+			paths = append(paths, p)
+		}
+	}
+	return Classify(paths)
+}
+
+// statusChanges lists the staged, unstaged and untracked changes relative
+// to HEAD, and separately the untracked paths among the added ones
+func statusChanges() (added, removed, untracked []string, err error) {
+	output, err := git("status", "--porcelain=v1", "-z", "--untracked-files=all", "--no-renames")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	added, removed = parseStatus(output)
+	return added, removed, parseUntracked(output), nil
+}
+
+// NewFiles returns the paths that are new since HEAD, unclassified: the
+// files added to the index, and the untracked files that are not ignored.
+// It takes no optional locks, so it can run while other Git commands do.
+func NewFiles() (staged, untracked []string, err error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "status", "--porcelain=v1", "-z", "--untracked-files=all", "--no-renames")
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("git status failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseStaged(string(output)), parseUntracked(string(output)), nil
+}
+
+// merge removes and adds paths, classifying the added ones
+func merge(files []File, added, removed []string) ([]File, error) {
+	if len(added) == 0 && len(removed) == 0 {
+		return files, nil
+	}
+
+	drop := make(map[string]bool, len(added)+len(removed))
+	for _, p := range removed {
+		drop[p] = true
+	}
+	for _, p := range added {
+		drop[p] = true
+	}
+
+	merged := make([]File, 0, len(files)+len(added))
+	for _, f := range files {
+		if !drop[f.Path] {
+			merged = append(merged, f)
+		}
+	}
+
+	classified, err := Classify(added)
+	if err != nil {
+		return nil, err
+	}
+	merged = append(merged, classified...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Path < merged[j].Path })
+	return merged, nil
+}
+
+// parseNameStatus parses git diff-tree -z --name-status output
+func parseNameStatus(output string) (added, removed []string) {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "D":
+			removed = append(removed, fields[i+1])
+		default:
+			added = append(added, fields[i+1])
+		}
+	}
+	return added, removed
+}
+
+// parseStatus parses git status --porcelain=v1 -z --no-renames output;
+// deleted files are removed and every other listed file is (re)added
+func parseStatus(output string) (added, removed []string) {
+	for _, entry := range strings.Split(output, "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		status, p := entry[:2], entry[3:]
+		if strings.Contains(status, "D") {
+			removed = append(removed, p)
+		} else {
+			added = append(added, p)
+		}
+	}
+	return added, removed
+}
+
+// parseUntracked returns the untracked paths ('??' entries) of git status
+// --porcelain=v1 -z output
+func parseUntracked(output string) []string {
+	var untracked []string
+	for _, entry := range strings.Split(output, "\x00") {
+		if p, found := strings.CutPrefix(entry, "?? "); found {
+			untracked = append(untracked, p)
+		}
+	}
+	return untracked
+}
+
+// parseStaged returns the paths added to the index ('A' in the first
+// column) of git status --porcelain=v1 -z output
+func parseStaged(output string) []string {
+	var staged []string
+	for _, entry := range strings.Split(output, "\x00") {
+		if len(entry) >= 4 && entry[0] == 'A' {
+			staged = append(staged, entry[3:])
+		}
+	}
+	return staged
+}
+
+// Classify reports which paths, relative to the top of the working tree,
+// have filter=lfs, using git check-attr
+func Classify(paths []string) ([]File, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	// Paths are relative to the top of the working tree
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "check-attr", "-z", "--stdin", "filter")
+	cmd.Dir = strings.TrimSpace(top)
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git check-attr failed: %v", err)
+	}
+
+	lfs := make(map[string]bool)
+	// Output records: PATH NUL ATTRIBUTE NUL VALUE NUL
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == "lfs" {
+			lfs[fields[i]] = true
+		}
+	}
+
+	files := make([]File, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, File{Path: p, LFS: lfs[p]})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func touchesAttributes(paths []string) bool {
+	for _, p := range paths {
+		if path.Base(p) == ".gitattributes" {
+			return true
+		}
+	}
+	return false
+}
+
+// attributesHash hashes the working tree .gitattributes files, including
+// untracked ones, and $GIT_DIR/info/attributes
+func attributesHash(files []File, added []string) string {
+	top, _ := git("rev-parse", "--show-toplevel")
+	top = strings.TrimSpace(top)
+
+	paths := make(map[string]bool)
+	for _, f := range files {
+		if path.Base(f.Path) == ".gitattributes" {
+			paths[f.Path] = true
+		}
+	}
+	for _, p := range added {
+		if path.Base(p) == ".gitattributes" {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	hash := sha256.New()
+	for _, p := range sorted {
+		content, _ := os.ReadFile(filepath.Join(top, p))
+		fmt.Fprintf(hash, "%s\x00%d\x00", p, len(content))
+		hash.Write(content)
+	}
+	if gitDir, err := git("rev-parse", "--path-format=absolute", "--git-common-dir"); err == nil {
+		content, _ := os.ReadFile(filepath.Join(strings.TrimSpace(gitDir), "info", "attributes"))
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func headCommit() string {
+	head, err := git("rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(head)
+}
+
+func cachePath() (string, error) {
+	gitDir, err := git("rev-parse", "--path-format=absolute", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(strings.TrimSpace(gitDir), "lfs-scripts", "inventory.json"), nil
+}
+
+func readCache() *cache {
+	path, err := cachePath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var stored cache
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Version != cacheVersion {
+		return nil
+	}
+	return &stored
+}
+
+// writeCache saves the inventory; failures only cost speed on the next run
+func writeCache(c cache) {
+	path, err := cachePath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
+
+func git(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,52 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseStatus tests classification of git status entries into added and removed paths
+func TestParseStatus(t *testing.T) {
+	output := " M src/main.go\x00D  old.bin\x00 D gone.txt\x00?? new/video.mp4\x00A  added.psd\x00"
+
+	added, removed := parseStatus(output)
+	if want := []string{"src/main.go", "new/video.mp4", "added.psd"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"old.bin", "gone.txt"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if want := []string{"new/video.mp4"}; !reflect.DeepEqual(parseUntracked(output), want) {
+		t.Errorf("untracked = %v, want %v", parseUntracked(output), want)
+	}
+	if want := []string{"added.psd"}; !reflect.DeepEqual(parseStaged(output), want) {
+		t.Errorf("staged = %v, want %v", parseStaged(output), want)
+	}
+}
+
+// TestParseNameStatus tests parsing of git diff-tree --name-status -z output
+func TestParseNameStatus(t *testing.T) {
+	output := "M\x00a.txt\x00D\x00b.bin\x00A\x00dir/c.mp3\x00"
+
+	added, removed := parseNameStatus(output)
+	if want := []string{"a.txt", "dir/c.mp3"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"b.bin"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+}
+
+// TestRelativeTo tests restricting an inventory to a subdirectory
+func TestRelativeTo(t *testing.T) {
+	files := []File{{Path: "a.txt"}, {Path: "sub/b.bin", LFS: true}, {Path: "subway/c.txt"}}
+
+	got := RelativeTo(files, "sub/")
+	want := []File{{Path: "b.bin", LFS: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RelativeTo() = %v, want %v", got, want)
+	}
+	if got := RelativeTo(files, ""); !reflect.DeepEqual(got, files) {
+		t.Errorf("RelativeTo() with empty prefix = %v, want %v", got, files)
+	}
+}
@@ -0,0 +1,177 @@
+package lfsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sshRemote is the host and repository path of an SSH remote
+type sshRemote struct {
+	host string // [USER@]HOST
+	port string
+	path string
+}
+
+// parseSSHRemote splits an ssh:// URL or an scp-style [USER@]HOST:PATH. A
+// host starting with '-' is refused, as ssh would take it for an option.
+func parseSSHRemote(remoteURL string) (sshRemote, bool) {
+	raw := strings.TrimSpace(remoteURL)
+	if strings.HasPrefix(raw, "ssh://") || strings.HasPrefix(raw, "git+ssh://") {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			return sshRemote{}, false
+		}
+		host := u.Hostname()
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+		if strings.HasPrefix(host, "-") {
+			return sshRemote{}, false
+		}
+		return sshRemote{host: host, port: u.Port(), path: strings.TrimPrefix(u.Path, "/")}, true
+	}
+	if strings.Contains(raw, "://") {
+		return sshRemote{}, false
+	}
+	host, path, found := strings.Cut(raw, ":")
+	if !found || host == "" || path == "" || strings.Contains(host, "/") || strings.HasPrefix(host, "-") {
+		return sshRemote{}, false
+	}
+	return sshRemote{host: host, path: path}, true
+}
+
+// sshAuth is the reply of git-lfs-authenticate: the endpoint to use and the
+// headers that authorize requests to it
+type sshAuth struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header"`
+	ExpiresIn int               `json:"expires_in"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// parseSSHAuth reads a git-lfs-authenticate reply received at now and
+// returns it with the time the authorization expires; zero means never
+func parseSSHAuth(data []byte, now time.Time) (sshAuth, time.Time, error) {
+	var auth sshAuth
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return auth, time.Time{}, fmt.Errorf("invalid git-lfs-authenticate reply: %v", err)
+	}
+	if auth.Href == "" {
+		return auth, time.Time{}, fmt.Errorf("git-lfs-authenticate replied without an href")
+	}
+	expiry := auth.ExpiresAt
+	if auth.ExpiresIn > 0 {
+		expiry = now.Add(time.Duration(auth.ExpiresIn) * time.Second)
+	}
+	return auth, expiry, nil
+}
+
+// sshAuthenticate runs git-lfs-authenticate on the host of an SSH remote,
+// as Git LFS does, with the ssh command of GIT_SSH_COMMAND or GIT_SSH
+func sshAuthenticate(remote sshRemote, operation string) (sshAuth, time.Time, error) {
+	var args []string
+	if remote.port != "" {
+		args = append(args, "-p", remote.port)
+	}
+	args = append(args, "--", remote.host, "git-lfs-authenticate "+shellQuote(remote.path)+" "+operation)
+
+	var cmd *exec.Cmd
+	switch {
+	case os.Getenv("GIT_SSH_COMMAND") != "":
+		cmd = exec.Command("sh", append([]string{"-c", os.Getenv("GIT_SSH_COMMAND") + ` "$@"`, "ssh"}, args...)...)
+	case os.Getenv("GIT_SSH") != "":
+		cmd = exec.Command(os.Getenv("GIT_SSH"), args...)
+	default:
+		cmd = exec.Command("ssh", append([]string{"-o", "BatchMode=yes"}, args...)...)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return sshAuth{}, time.Time{}, fmt.Errorf("git-lfs-authenticate on %s failed: %s", remote.host, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return sshAuth{}, time.Time{}, fmt.Errorf("git-lfs-authenticate on %s failed: %v", remote.host, err)
+	}
+	return parseSSHAuth(output, time.Now())
+}
+
+// shellQuote quotes a path for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// NewSSHClient returns a client authorized by git-lfs-authenticate on the
+// host of an SSH remote, for operation ("download" or "upload"). The
+// authorization is renewed when it expires.
+func NewSSHClient(remoteURL, operation string) (*Client, error) {
+	remote, ok := parseSSHRemote(remoteURL)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not an SSH remote", remoteURL)
+	}
+	auth, expiry, err := sshAuthenticate(remote, operation)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(auth.Href, false)
+	c.Header, c.expiry = auth.Header, expiry
+	c.renew = func() error {
+		auth, expiry, err := sshAuthenticate(remote, operation)
+		if err != nil {
+			return err
+		}
+		c.Header, c.expiry = auth.Header, expiry
+		return nil
+	}
+	return c, nil
+}
+
+// NewRemoteClient returns a client for the LFS endpoint Git LFS uses for
+// remote in the current repository, and where the endpoint came from. When
+// it is derived from an SSH remote, git-lfs-authenticate is asked first, as
+// Git LFS does; servers without it are reached over HTTPS with the
+// credentials of git credential fill.
+func NewRemoteClient(remote, operation string) (*Client, string, error) {
+	endpoint, source, err := Endpoint(remote)
+	if err != nil {
+		return nil, "", err
+	}
+	remoteURL := gitConfig("remote." + remote + ".url")
+	if _, isSSH := parseSSHRemote(remoteURL); isSSH && source == "derived from remote "+remote {
+		if c, err := NewSSHClient(remoteURL, operation); err == nil {
+			return c, source + " via git-lfs-authenticate", nil
+		}
+	}
+	return NewClient(endpoint, true), source, nil
+}
+
+// Authorize adds the client's authorization to a request for its endpoint
+// that has none: the headers of git-lfs-authenticate, a bearer token, or
+// basic credentials
+func (c *Client) Authorize(req *http.Request) {
+	c.mu.Lock()
+	if c.renew != nil && !c.expiry.IsZero() && time.Now().After(c.expiry.Add(-30*time.Second)) {
+		// A failed renewal leaves the old headers; the server then rejects the request
+		c.renew()
+	}
+	header := c.Header
+	c.mu.Unlock()
+
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	switch {
+	case req.Header.Get("Authorization") != "":
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "" || c.Password != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
@@ -0,0 +1,103 @@
+package lfsapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestParseSSHRemote tests recognizing SSH remotes
+func TestParseSSHRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   sshRemote
+		ok     bool
+	}{
+		{"git@github.com:user/repo.git", sshRemote{host: "git@github.com", path: "user/repo.git"}, true},
+		{"ssh://git@gitlab.com:2222/group/repo.git", sshRemote{host: "git@gitlab.com", port: "2222", path: "group/repo.git"}, true},
+		{"git+ssh://host/repo", sshRemote{host: "host", path: "repo"}, true},
+		{"https://github.com/user/repo.git", sshRemote{}, false},
+		{"../local/repo", sshRemote{}, false},
+		{"./dir:with/colon", sshRemote{}, false},
+		{"-oProxyCommand=touch$IFS/tmp/x:repo", sshRemote{}, false},
+		{"ssh://-oProxyCommand=x/repo", sshRemote{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			got, ok := parseSSHRemote(tt.remote)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseSSHRemote(%q) = %+v, %v, want %+v, %v", tt.remote, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// TestParseSSHAuth tests reading git-lfs-authenticate replies and their expiry
+func TestParseSSHAuth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	auth, expiry, err := parseSSHAuth([]byte(`{"href":"https://host/repo.git/info/lfs","header":{"Authorization":"RemoteAuth abc"},"expires_in":300}`), now)
+	if err != nil {
+		t.Fatalf("parseSSHAuth() error = %v", err)
+	}
+	if auth.Href != "https://host/repo.git/info/lfs" || auth.Header["Authorization"] != "RemoteAuth abc" {
+		t.Errorf("parseSSHAuth() = %+v", auth)
+	}
+	if !expiry.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("expiry = %v, want %v", expiry, now.Add(5*time.Minute))
+	}
+
+	if _, expiry, _ := parseSSHAuth([]byte(`{"href":"https://host/lfs"}`), now); !expiry.IsZero() {
+		t.Errorf("expiry without expires_in = %v, want zero", expiry)
+	}
+	if _, _, err := parseSSHAuth([]byte(`{"header":{}}`), now); err == nil {
+		t.Error("parseSSHAuth() accepted a reply without an href")
+	}
+}
+
+// TestAuthorize tests the order in which a client authorizes requests
+func TestAuthorize(t *testing.T) {
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "https://host/lfs/objects/batch", nil)
+		return req
+	}
+
+	c := &Client{Username: "user", Password: "pass"}
+	req := newRequest()
+	c.Authorize(req)
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+	}
+
+	c.Token = "tok"
+	req = newRequest()
+	c.Authorize(req)
+	if got := req.Header.Get("Authorization"); got != "Bearer tok" {
+		t.Errorf("Authorization = %q, want bearer token", got)
+	}
+
+	req = newRequest()
+	req.Header.Set("Authorization", "Custom x")
+	c.Authorize(req)
+	if got := req.Header.Get("Authorization"); got != "Custom x" {
+		t.Errorf("Authorization = %q, want it kept", got)
+	}
+
+	renewed := 0
+	c = &Client{Header: map[string]string{"Authorization": "RemoteAuth old"}, expiry: time.Now().Add(10 * time.Second)}
+	c.renew = func() error {
+		renewed++
+		c.Header, c.expiry = map[string]string{"Authorization": "RemoteAuth new"}, time.Now().Add(time.Hour)
+		return nil
+	}
+	for range 2 {
+		req = newRequest()
+		c.Authorize(req)
+		if got := req.Header.Get("Authorization"); got != "RemoteAuth new" {
+			t.Errorf("Authorization = %q, want the renewed header", got)
+		}
+	}
+	if renewed != 1 {
+		t.Errorf("renewed %d times, want 1", renewed)
+	}
+}
@@ -0,0 +1,352 @@
+package lfsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mediaType is the content type of Git LFS API requests and responses
+const mediaType = "application/vnd.git-lfs+json"
+
+// Object identifies an LFS object in a batch request or response
+type Object struct {
+	OID     string            `json:"oid"`
+	Size    int64             `json:"size"`
+	Actions map[string]Action `json:"actions,omitempty"`
+	Error   *ObjectError      `json:"error,omitempty"`
+}
+
+// Action is a transfer action (download, upload or verify) for one object
+type Action struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+}
+
+// ObjectError is a per-object error; code 404 means the object does not exist
+type ObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchRequest is the body of POST {endpoint}/objects/batch
+type BatchRequest struct {
+	Operation string   `json:"operation"`
+	Transfers []string `json:"transfers,omitempty"`
+	Ref       *Ref     `json:"ref,omitempty"`
+	Objects   []Object `json:"objects"`
+	HashAlgo  string   `json:"hash_algo,omitempty"`
+}
+
+// Ref names the ref a batch request is for, which servers may use to
+// authorize it
+type Ref struct {
+	Name string `json:"name"`
+}
+
+// BatchResponse is the response to a batch request
+type BatchResponse struct {
+	Transfer string   `json:"transfer,omitempty"`
+	Objects  []Object `json:"objects"`
+}
+
+// Client talks to the Git LFS API of one endpoint (e.g. https://host/repo.git/info/lfs)
+type Client struct {
+	Endpoint string
+	Username string
+	Password string
+	Token    string            // Sent as a bearer token instead of Username and Password
+	Header   map[string]string // Sent with every request to the endpoint, e.g. from git-lfs-authenticate
+	Retries  int               // Times a request is repeated after a network error, HTTP 429 or 5xx
+
+	mu     sync.Mutex
+	expiry time.Time    // When Header expires; zero means never
+	renew  func() error // Replaces an expired Header
+	http   *http.Client
+}
+
+// NewClient returns a client for endpoint. Credentials are looked up with
+// git credential fill; set useCredentials to false for anonymous access.
+func NewClient(endpoint string, useCredentials bool) *Client {
+	c := &Client{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Retries:  DefaultRetries,
+		http:     &http.Client{Timeout: 60 * time.Second},
+	}
+	if useCredentials {
+		c.Username, c.Password = credentials(c.Endpoint)
+	}
+	return c
+}
+
+// Batch sends a batch request
+func (c *Client) Batch(req BatchRequest) (*BatchResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reqURL := c.Endpoint + "/objects/batch"
+	resp, err := do(c.http, c.Retries, func() (*http.Request, error) {
+		httpReq, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", mediaType)
+		httpReq.Header.Set("Content-Type", mediaType)
+		c.Authorize(httpReq)
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("POST %s: %v", reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("POST %s failed with HTTP %d: %s", reqURL, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var batch BatchResponse
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("invalid batch response from %s: %v", reqURL, err)
+	}
+	return &batch, nil
+}
+
+// Missing asks the server to download the objects and returns those it does
+// not have. Objects are sent in batches of batchSize.
+func (c *Client) Missing(objects []Object, batchSize int) ([]Object, error) {
+	var missing []Object
+	for start := 0; start < len(objects); start += batchSize {
+		end := min(start+batchSize, len(objects))
+		resp, err := c.Batch(BatchRequest{
+			Operation: "download",
+			Transfers: []string{"basic"},
+			Objects:   objects[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		found := make(map[string]bool)
+		for _, obj := range resp.Objects {
+			if obj.Error == nil && obj.Actions["download"].Href != "" {
+				found[obj.OID] = true
+			}
+		}
+		for _, obj := range objects[start:end] {
+			if !found[obj.OID] {
+				missing = append(missing, obj)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// Download returns the content of an object from its download action. The
+// endpoint's credentials are only sent when the action brings no
+// Authorization header of its own and points at the endpoint's host.
+func (c *Client) Download(action Action) (io.ReadCloser, error) {
+	// Objects can be large, so only the connection is subject to a timeout
+	resp, err := do(&http.Client{Transport: c.http.Transport}, c.Retries, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, action.Href, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.authorize(req, action)
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %v", action.Href, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, httpError("GET", action.Href, resp)
+	}
+	return resp.Body, nil
+}
+
+// Upload sends an object's content to the href of an upload action. It is
+// only retried when content is an io.Seeker, which is read again from where
+// it started.
+func (c *Client) Upload(action Action, content io.Reader, size int64) error {
+	retries, start := 0, int64(0)
+	seeker, canSeek := content.(io.Seeker)
+	if canSeek {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			retries, start = c.Retries, offset
+		}
+	}
+	attempt := 0
+	resp, err := do(&http.Client{Transport: c.http.Transport}, retries, func() (*http.Request, error) {
+		if attempt++; attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequest(http.MethodPut, action.Href, io.NopCloser(content))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		c.authorize(req, action)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("PUT %s: %v", action.Href, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpError("PUT", action.Href, resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Verify confirms an upload with the href of a verify action
+func (c *Client) Verify(action Action, obj Object) error {
+	body, err := json.Marshal(Object{OID: obj.OID, Size: obj.Size})
+	if err != nil {
+		return err
+	}
+	resp, err := do(c.http, c.Retries, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, action.Href, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaType)
+		req.Header.Set("Content-Type", mediaType)
+		c.authorize(req, action)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("POST %s: %v", action.Href, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpError("POST", action.Href, resp)
+	}
+	return nil
+}
+
+// authorize applies an action's headers, and the client's authorization
+// when the action has none and points at the endpoint's own host
+func (c *Client) authorize(req *http.Request, action Action) {
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+	if sameHost(c.Endpoint, action.Href) {
+		c.Authorize(req)
+	}
+}
+
+// httpError describes a failed transfer request, including the start of the body
+func httpError(method, href string, resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s %s failed with HTTP %d: %s", method, href, resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+// sameHost reports whether two URLs have the same scheme and host
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+// credentials asks git credential fill for the username and password of the
+// endpoint's host, without prompting
+func credentials(endpoint string) (string, string) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", ""
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		return u.User.Username(), password
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(cmd.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", ""
+	}
+
+	var username, password string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+	return username, password
+}
+
+// EndpointForRemote returns the default LFS endpoint of a Git remote URL
+// (REMOTE/info/lfs for HTTP remotes, https://HOST/PATH/info/lfs for SSH remotes)
+func EndpointForRemote(remoteURL string) string {
+	raw := strings.TrimSuffix(strings.TrimSpace(remoteURL), "/")
+	if !strings.Contains(raw, "://") {
+		// scp-style: git@host:path
+		if at, colon := strings.Index(raw, "@"), strings.Index(raw, ":"); colon > at {
+			raw = "https://" + raw[at+1:colon] + "/" + raw[colon+1:]
+		}
+	} else if strings.HasPrefix(raw, "ssh://") {
+		if u, err := url.Parse(raw); err == nil {
+			raw = "https://" + u.Hostname() + u.Path
+		}
+	}
+	if !strings.HasSuffix(raw, ".git") {
+		raw += ".git"
+	}
+	return raw + "/info/lfs"
+}
+
+// LFSConfigFile is the committed file that can set lfs.url for every clone
+const LFSConfigFile = ".lfsconfig"
+
+// Endpoint returns the LFS endpoint Git LFS uses for remote in the current
+// repository, and where it was configured
+func Endpoint(remote string) (string, string, error) {
+	if url := gitConfig("lfs.url"); url != "" {
+		return url, "lfs.url", nil
+	}
+	if url := gitConfig("remote." + remote + ".lfsurl"); url != "" {
+		return url, "remote." + remote + ".lfsurl", nil
+	}
+	if url := gitConfig("-f", LFSConfigFile, "lfs.url"); url != "" {
+		return url, LFSConfigFile, nil
+	}
+	remoteURL := gitConfig("remote." + remote + ".url")
+	if remoteURL == "" {
+		return "", "", fmt.Errorf("remote '%s' is not configured and no lfs.url is set", remote)
+	}
+	return EndpointForRemote(remoteURL), "derived from remote " + remote, nil
+}
+
+// gitConfig returns a trimmed git config value, or "" when it is not set
+func gitConfig(args ...string) string {
+	output, err := exec.Command("git", append([]string{"config", "--get"}, args...)...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,162 @@
+package lfsapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMissing tests that objects without a download action are reported missing
+func TestMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repo.git/info/lfs/objects/batch" {
+			http.NotFound(w, r)
+			return
+		}
+		var req BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp BatchResponse
+		for _, obj := range req.Objects {
+			if obj.OID == "present" {
+				obj.Actions = map[string]Action{"download": {Href: "http://example.com/" + obj.OID}}
+			} else {
+				obj.Error = &ObjectError{Code: 404, Message: "Object does not exist"}
+			}
+			resp.Objects = append(resp.Objects, obj)
+		}
+		w.Header().Set("Content-Type", mediaType)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/repo.git/info/lfs", false)
+	missing, err := client.Missing([]Object{{OID: "present", Size: 1}, {OID: "absent", Size: 2}, {OID: "present", Size: 1}}, 2)
+	if err != nil {
+		t.Fatalf("Missing() error = %v", err)
+	}
+	if len(missing) != 1 || missing[0].OID != "absent" {
+		t.Errorf("Missing() = %+v, want only 'absent'", missing)
+	}
+}
+
+// TestDownload tests that action headers are sent and credentials only go to the endpoint's host
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/objects/signed":
+			if r.Header.Get("X-Token") != "secret" {
+				http.Error(w, "missing token", http.StatusForbidden)
+				return
+			}
+			io.WriteString(w, "content")
+		case "/objects/basic":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "u" || pass != "p" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, "basic")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/repo.git/info/lfs", false)
+	client.Username, client.Password = "u", "p"
+
+	tests := []struct {
+		action  Action
+		want    string
+		wantErr bool
+	}{
+		{Action{Href: server.URL + "/objects/signed", Header: map[string]string{"X-Token": "secret"}}, "content", false},
+		{Action{Href: server.URL + "/objects/basic"}, "basic", false},
+		{Action{Href: server.URL + "/objects/missing"}, "", true},
+	}
+	for _, tt := range tests {
+		body, err := client.Download(tt.action)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Download(%s) error = %v, wantErr %v", tt.action.Href, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != tt.want {
+			t.Errorf("Download(%s) = %q, want %q", tt.action.Href, data, tt.want)
+		}
+	}
+
+	if sameHost(server.URL, "https://storage.example.com/object") {
+		t.Error("sameHost() matched a different host")
+	}
+}
+
+// TestUpload tests uploading content and confirming it with a verify action
+func TestUpload(t *testing.T) {
+	var stored string
+	var verified Object
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/objects/abc":
+			if r.Header.Get("X-Token") != "secret" || r.ContentLength != 7 {
+				http.Error(w, "bad upload", http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			stored = string(data)
+		case r.Method == http.MethodPost && r.URL.Path == "/verify":
+			json.NewDecoder(r.Body).Decode(&verified)
+		default:
+			http.Error(w, "rejected", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/repo.git/info/lfs", false)
+	upload := Action{Href: server.URL + "/objects/abc", Header: map[string]string{"X-Token": "secret"}}
+	if err := client.Upload(upload, strings.NewReader("content"), 7); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if stored != "content" {
+		t.Errorf("Upload() stored %q, want %q", stored, "content")
+	}
+	if err := client.Verify(Action{Href: server.URL + "/verify"}, Object{OID: "abc", Size: 7}); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if verified.OID != "abc" || verified.Size != 7 {
+		t.Errorf("Verify() sent %+v", verified)
+	}
+	if err := client.Upload(Action{Href: server.URL + "/objects/other"}, strings.NewReader("x"), 1); err == nil {
+		t.Error("Upload() to a rejecting server succeeded")
+	}
+}
+
+// TestEndpointForRemote tests deriving LFS endpoints from remote URLs
+func TestEndpointForRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"https://github.com/user/repo.git", "https://github.com/user/repo.git/info/lfs"},
+		{"https://github.com/user/repo", "https://github.com/user/repo.git/info/lfs"},
+		{"git@github.com:user/repo.git", "https://github.com/user/repo.git/info/lfs"},
+		{"ssh://git@gitlab.com/group/repo.git", "https://gitlab.com/group/repo.git/info/lfs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			if got := EndpointForRemote(tt.remote); got != tt.want {
+				t.Errorf("EndpointForRemote(%q) = %q, want %q", tt.remote, got, tt.want)
+			}
+		})
+	}
+}
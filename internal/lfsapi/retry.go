@@ -0,0 +1,73 @@
+package lfsapi
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetries is how often NewClient repeats a failed request
+const DefaultRetries = 3
+
+// The wait before the first retry doubles with each further one, up to maxBackoff
+const (
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+)
+
+// sleep waits between attempts; tests replace it
+var sleep = time.Sleep
+
+// retryable reports whether a response status is worth repeating the
+// request for: the server is overloaded, rate limiting or failing
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff returns the wait before retry attempt (counting from 0), or the
+// wait the server asked for with Retry-After
+func backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return min(wait, maxBackoff)
+		}
+	}
+	return min(baseBackoff<<attempt, maxBackoff)
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
+
+// do sends the request build creates, repeating it up to retries times
+// after network errors and retryable statuses. build is called for every
+// attempt, so that request bodies can be read again.
+func do(client *http.Client, retries int, build func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if attempt >= retries || (err == nil && !retryable(resp.StatusCode)) {
+			return resp, err
+		}
+		wait := backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		sleep(wait)
+	}
+}
@@ -0,0 +1,119 @@
+package lfsapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubSleep records the waits between attempts instead of sleeping
+func stubSleep(t *testing.T) *[]time.Duration {
+	var waits []time.Duration
+	saved := sleep
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() { sleep = saved })
+	return &waits
+}
+
+// TestRetry tests that overloaded responses are retried with growing waits
+func TestRetry(t *testing.T) {
+	waits := stubSleep(t)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	body, err := client.Download(Action{Href: server.URL + "/objects/abc"})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "content" || attempts != 3 {
+		t.Errorf("Download() = %q after %d attempts, want %q after 3", data, attempts, "content")
+	}
+	if len(*waits) != 2 || (*waits)[0] != baseBackoff || (*waits)[1] != 2*baseBackoff {
+		t.Errorf("waits = %v, want [%v %v]", *waits, baseBackoff, 2*baseBackoff)
+	}
+
+	attempts = 0
+	client.Retries = 1
+	if _, err := client.Download(Action{Href: server.URL + "/objects/abc"}); err == nil {
+		t.Error("Download() succeeded after running out of retries")
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+// TestRetryUpload tests that uploads are only repeated when the content can be read again
+func TestRetryUpload(t *testing.T) {
+	stubSleep(t)
+	var attempts int
+	var stored string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		data, _ := io.ReadAll(r.Body)
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusTooManyRequests)
+			return
+		}
+		stored = string(data)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	if err := client.Upload(Action{Href: server.URL + "/objects/abc"}, strings.NewReader("content"), 7); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if stored != "content" || attempts != 2 {
+		t.Errorf("Upload() stored %q after %d attempts, want %q after 2", stored, attempts, "content")
+	}
+
+	attempts = 0
+	if err := client.Upload(Action{Href: server.URL + "/objects/abc"}, io.MultiReader(strings.NewReader("content")), 7); err == nil {
+		t.Error("Upload() of a stream was retried")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+// TestBackoff tests the waits between attempts and honoring Retry-After
+func TestBackoff(t *testing.T) {
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+	tests := []struct {
+		name    string
+		attempt int
+		resp    *http.Response
+		want    time.Duration
+	}{
+		{"first", 0, nil, baseBackoff},
+		{"third", 2, nil, 4 * baseBackoff},
+		{"capped", 20, nil, maxBackoff},
+		{"retry after seconds", 0, withRetryAfter("7"), 7 * time.Second},
+		{"retry after capped", 0, withRetryAfter("3600"), maxBackoff},
+		{"retry after past date", 0, withRetryAfter("Mon, 02 Jan 2006 15:04:05 GMT"), 0},
+		{"invalid retry after", 1, withRetryAfter("soon"), 2 * baseBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(tt.attempt, tt.resp); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package lfsarchive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// Format is the version of the archive layout written by Write
+const Format = 1
+
+// Names of the entries below the top directory of an archive, in the order
+// Write stores them; Restore relies on the manifest and the bundle coming
+// before the objects
+const (
+	ManifestName = "manifest.json"
+	ScriptName   = "restore.sh"
+	BundleName   = "repo.bundle"
+	objectsDir   = "lfs/objects"
+)
+
+// Object is an LFS object of the archived history
+type Object struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+	Path string `json:"path,omitempty"` // A path the object was found at
+}
+
+// Manifest describes an archive
+type Manifest struct {
+	Format  int       `json:"format"`
+	Name    string    `json:"name"` // Top directory of the archive and default clone directory
+	Created time.Time `json:"created"`
+	Source  string    `json:"source,omitempty"` // remote.origin.url of the archived repository
+	Head    string    `json:"head,omitempty"`   // Branch that was checked out
+	Refs    []string  `json:"refs"`
+	Objects []Object  `json:"objects"`           // Objects in the archive
+	Missing []Object  `json:"missing,omitempty"` // Referenced, but absent from local storage
+}
+
+// IsGzip reports whether an archive name asks for gzip compression
+func IsGzip(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// validName reports whether name can be the top directory of an archive
+// and a clone directory: a single relative path element that no command
+// takes for an option and that prints on one line
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "-") && !strings.Contains(name, "..") &&
+		!strings.ContainsAny(name, `/\`) && filepath.VolumeName(name) == "" &&
+		!strings.ContainsFunc(name, unicode.IsControl)
+}
+
+// objectName returns the entry name of an object below the top directory
+func objectName(oid string) string {
+	return path.Join(objectsDir, oid[0:2], oid[2:4], oid)
+}
+
+// RestoreScript returns a shell script that restores the archive with only
+// git and git-lfs, for machines without git-lfs-unarchive
+func RestoreScript(m Manifest) string {
+	origin := "git remote remove origin"
+	if m.Source != "" {
+		origin = "git remote set-url origin " + common.RemoteQuote(m.Source)
+	}
+	return fmt.Sprintf(`#!/bin/sh
+# Restores the repository archived by git-lfs-archive, with its Git LFS
+# objects, using only git and git-lfs. Run it from the extracted archive:
+#   sh %s/restore.sh [DIRECTORY]
+set -e
+here=$(cd "$(dirname "$0")" && pwd)
+name=%s
+dir=${1:-$name}
+
+GIT_LFS_SKIP_SMUDGE=1 git clone -- "$here/%s" "$dir"
+cd "$dir"
+if [ -d "$here/%s" ]; then
+  storage="$(git rev-parse --path-format=absolute --git-common-dir)/lfs/objects"
+  mkdir -p "$storage"
+  cp -R "$here/%s/." "$storage/"
+fi
+%s
+git lfs install --local
+git lfs checkout
+echo "Restored $name in $dir"
+`, m.Name, common.RemoteQuote(m.Name), BundleName, objectsDir, objectsDir, origin)
+}
+
+// Write writes a tar archive of the manifest, a restore script, the bundle
+// file and the manifest's objects, read from local LFS storage
+func Write(w io.Writer, m Manifest, bundle, storage string) error {
+	if !validName(m.Name) {
+		return fmt.Errorf("'%s' cannot name an archive", m.Name)
+	}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	addBytes := func(name string, mode int64, data []byte) error {
+		header := &tar.Header{Name: m.Name + "/" + name, Mode: mode, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	addFile := func(name, file string) error {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{Name: m.Name + "/" + name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("failed to archive %s: %v", file, err)
+		}
+		return nil
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addBytes(ManifestName, 0644, append(manifest, '\n')); err != nil {
+		return err
+	}
+	if err := addBytes(ScriptName, 0755, []byte(RestoreScript(m))); err != nil {
+		return err
+	}
+	if err := addFile(BundleName, bundle); err != nil {
+		return err
+	}
+	for _, obj := range m.Objects {
+		if err := addFile(objectName(obj.OID), filepath.Join(storage, obj.OID[0:2], obj.OID[2:4], obj.OID)); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Restore reads an archive written by Write, compressed or not. clone is
+// called with the manifest and the path of the extracted bundle, and
+// returns the LFS storage directory of the new clone, into which the
+// objects are then extracted and verified against their oid and size. It
+// returns the manifest and how many objects were restored.
+func Restore(r io.Reader, clone func(m Manifest, bundle string) (string, error)) (Manifest, int, error) {
+	var m Manifest
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return m, 0, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	tr := tar.NewReader(r)
+	expected := make(map[string]int64) // Size of each object yet to be restored
+	storage := ""
+	restored := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, restored, fmt.Errorf("invalid archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		_, name, _ := strings.Cut(header.Name, "/")
+
+		switch {
+		case name == ManifestName:
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, 0, fmt.Errorf("invalid %s: %v", ManifestName, err)
+			}
+			if m.Format != Format {
+				return m, 0, fmt.Errorf("archive format %d is not supported (expected %d)", m.Format, Format)
+			}
+			// The name becomes the clone directory and the oids become
+			// storage paths, so neither may leave the directory they are in
+			if !validName(m.Name) {
+				return m, 0, fmt.Errorf("invalid %s: '%s' cannot name a directory", ManifestName, m.Name)
+			}
+			for _, obj := range m.Objects {
+				if !lfspointer.ValidOID(obj.OID) {
+					return m, 0, fmt.Errorf("invalid %s: '%s' is not an object id", ManifestName, obj.OID)
+				}
+				expected[obj.OID] = obj.Size
+			}
+
+		case name == BundleName:
+			if m.Format == 0 {
+				return m, 0, fmt.Errorf("the archive does not start with %s", ManifestName)
+			}
+			if storage, err = extractBundle(tr, m, clone); err != nil {
+				return m, 0, err
+			}
+
+		case strings.HasPrefix(name, objectsDir+"/"):
+			oid := path.Base(name)
+			size, ok := expected[oid]
+			if !ok || name != objectName(oid) {
+				return m, restored, fmt.Errorf("unexpected archive entry %s", header.Name)
+			}
+			if storage == "" {
+				return m, restored, fmt.Errorf("the archive has objects before %s", BundleName)
+			}
+			if err := extractObject(tr, storage, oid, size); err != nil {
+				return m, restored, err
+			}
+			delete(expected, oid)
+			restored++
+		}
+	}
+
+	if m.Format == 0 {
+		return m, 0, fmt.Errorf("the archive has no %s", ManifestName)
+	}
+	if storage == "" {
+		return m, 0, fmt.Errorf("the archive has no %s", BundleName)
+	}
+	if len(expected) > 0 {
+		return m, restored, fmt.Errorf("the archive is truncated: %d of %d objects are missing", len(expected), len(m.Objects))
+	}
+	return m, restored, nil
+}
+
+// extractBundle writes the bundle to a temporary file for clone
+func extractBundle(r io.Reader, m Manifest, clone func(Manifest, string) (string, error)) (string, error) {
+	tmp, err := os.CreateTemp("", "lfs-archive-*.bundle")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %s: %v", BundleName, err)
+	}
+	return clone(m, tmp.Name())
+}
+
+// extractObject writes an object into storage once its content matches its
+// oid and size; an object already present is kept
+func extractObject(r io.Reader, storage, oid string, size int64) error {
+	target := filepath.Join(storage, oid[0:2], oid[2:4], oid)
+	if info, err := os.Stat(target); err == nil && info.Size() == size {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), oid+".tmp*")
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && (written != size || hex.EncodeToString(hash.Sum(nil)) != oid) {
+		err = fmt.Errorf("object %s is corrupt: its content does not match its oid and size", oid)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package lfsarchive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// storeObject puts content into the LFS storage at dir and returns its object
+func storeObject(t *testing.T, dir, content string) Object {
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	path := filepath.Join(dir, oid[0:2], oid[2:4], oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Object{OID: oid, Size: int64(len(content)), Path: "assets/" + content}
+}
+
+// TestWriteRestore tests that Restore recovers what Write archived
+func TestWriteRestore(t *testing.T) {
+	source := t.TempDir()
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	if err := os.WriteFile(bundle, []byte("# v2 git bundle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := Manifest{
+		Format:  Format,
+		Name:    "assets",
+		Source:  "https://example.com/team/assets.git",
+		Refs:    []string{"refs/heads/main"},
+		Objects: []Object{storeObject(t, source, "first"), storeObject(t, source, "second")},
+	}
+
+	for _, compressed := range []bool{false, true} {
+		var archive bytes.Buffer
+		if compressed {
+			gz := gzip.NewWriter(&archive)
+			if err := Write(gz, m, bundle, source); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			gz.Close()
+		} else if err := Write(&archive, m, bundle, source); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		target := t.TempDir()
+		var cloned string
+		restoredManifest, restored, err := Restore(&archive, func(m Manifest, bundle string) (string, error) {
+			data, _ := os.ReadFile(bundle)
+			cloned = string(data)
+			return target, nil
+		})
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if restored != 2 || restoredManifest.Name != "assets" || cloned != "# v2 git bundle\n" {
+			t.Errorf("Restore() = %+v, %d objects, bundle %q", restoredManifest, restored, cloned)
+		}
+		for _, obj := range m.Objects {
+			data, err := os.ReadFile(filepath.Join(target, obj.OID[0:2], obj.OID[2:4], obj.OID))
+			if err != nil || int64(len(data)) != obj.Size {
+				t.Errorf("object %s not restored: %v", obj.OID, err)
+			}
+		}
+	}
+}
+
+// TestRestoreCorrupt tests that an object whose content does not match its
+// oid is not restored
+func TestRestoreCorrupt(t *testing.T) {
+	source := t.TempDir()
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	os.WriteFile(bundle, []byte("bundle"), 0644)
+	obj := storeObject(t, source, "original")
+	os.WriteFile(filepath.Join(source, obj.OID[0:2], obj.OID[2:4], obj.OID), []byte("tampered"), 0644)
+
+	var archive bytes.Buffer
+	m := Manifest{Format: Format, Name: "repo", Objects: []Object{obj}}
+	if err := Write(&archive, m, bundle, source); err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	_, _, err := Restore(&archive, func(Manifest, string) (string, error) { return target, nil })
+	if err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Restore() error = %v, want a corrupt object", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, obj.OID[0:2], obj.OID[2:4], obj.OID)); err == nil {
+		t.Error("Restore() kept a corrupt object")
+	}
+}
+
+// TestRestoreScript tests the shell script that restores without git-lfs-unarchive
+func TestRestoreScript(t *testing.T) {
+	script := RestoreScript(Manifest{Name: "assets", Source: "git@example.com:team/assets.git"})
+	if !strings.Contains(script, "git remote set-url origin 'git@example.com:team/assets.git'") {
+		t.Errorf("RestoreScript() does not restore origin:\n%s", script)
+	}
+	if script = RestoreScript(Manifest{Name: "assets"}); !strings.Contains(script, "git remote remove origin") {
+		t.Errorf("RestoreScript() keeps the bundle as origin:\n%s", script)
+	}
+}
+
+// TestRestoreInvalidManifest tests that manifest names and oids cannot
+// reach outside the clone and its storage
+func TestRestoreInvalidManifest(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{"absolute name", `{"format": 1, "name": "/tmp/repo"}`},
+		{"parent name", `{"format": 1, "name": ".."}`},
+		{"nested name", `{"format": 1, "name": "repo/sub"}`},
+		{"option name", `{"format": 1, "name": "--upload-pack=touch"}`},
+		{"short oid", `{"format": 1, "name": "repo", "objects": [{"oid": "a", "size": 1}]}`},
+		{"path oid", `{"format": 1, "name": "repo", "objects": [{"oid": "../` + oid[3:] + `", "size": 1}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			tw.WriteHeader(&tar.Header{Name: "repo/" + ManifestName, Mode: 0644, Size: int64(len(tt.manifest)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(tt.manifest))
+			tw.Close()
+
+			_, _, err := Restore(&archive, func(Manifest, string) (string, error) {
+				t.Error("Restore() cloned an invalid archive")
+				return t.TempDir(), nil
+			})
+			if err == nil || !strings.Contains(err.Error(), "invalid "+ManifestName) {
+				t.Errorf("Restore() error = %v, want an invalid manifest", err)
+			}
+		})
+	}
+}
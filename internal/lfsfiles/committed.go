@@ -0,0 +1,109 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// CommittedFile is a file of HEAD stored as a regular Git blob
+type CommittedFile struct {
+	Path string // Relative to the current directory
+	Blob string
+	Size int64
+}
+
+// parseTreeBlobs reads 'git ls-tree -r -l -z' output, keeping regular files
+// that have content; symbolic links and submodules cannot move to Git LFS,
+// and Git LFS leaves empty files alone
+func parseTreeBlobs(output string) []CommittedFile {
+	var files []CommittedFile
+	for _, record := range strings.Split(output, "\x00") {
+		// Format: MODE SP TYPE SP OBJECT SP SIZE TAB PATH
+		meta, path, found := strings.Cut(record, "\t")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		if size, err := strconv.ParseInt(fields[3], 10, 64); err == nil && size > 0 {
+			files = append(files, CommittedFile{Path: path, Blob: fields[2], Size: size})
+		}
+	}
+	return files
+}
+
+// CommittedBlobs returns the files of HEAD below the current directory that
+// match any expanded pattern but are committed as regular Git blobs rather
+// than LFS pointers. Tracking the patterns does not change them.
+func CommittedBlobs(expanded []string) ([]CommittedFile, error) {
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+		return nil, nil // No commits yet
+	}
+	// Without --full-tree, ls-tree lists the current directory relative to it
+	output, err := exec.Command("git", "ls-tree", "-r", "-l", "-z", "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree HEAD failed: %v", err)
+	}
+	pointers, err := lfspointer.ListTree("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	isPointer := make(map[string]bool, len(pointers))
+	for _, p := range pointers {
+		isPointer[p.Blob] = true
+	}
+
+	var committed []CommittedFile
+	for _, file := range parseTreeBlobs(string(output)) {
+		if !isPointer[file.Blob] && matchAny(expanded, file.Path) {
+			committed = append(committed, file)
+		}
+	}
+	return committed, nil
+}
+
+// MismatchedFile is a file of HEAD whose storage disagrees with its filter
+// attribute
+type MismatchedFile struct {
+	CommittedFile
+	Pointer bool // A pointer without filter=lfs; otherwise a regular blob with it
+}
+
+// Mismatched returns the files of HEAD below the current directory that are
+// committed as regular Git blobs although filter=lfs applies to them, which
+// happens when a pattern is tracked after the files were committed, and
+// those committed as pointers although it no longer applies. lfs tells for
+// each path relative to the current directory whether filter=lfs applies;
+// paths it does not list, such as deleted files, are skipped.
+func Mismatched(lfs map[string]bool) ([]MismatchedFile, error) {
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+		return nil, nil // No commits yet
+	}
+	output, err := exec.Command("git", "ls-tree", "-r", "-l", "-z", "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree HEAD failed: %v", err)
+	}
+	pointers, err := lfspointer.ListTree("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	isPointer := make(map[string]bool, len(pointers))
+	for _, p := range pointers {
+		isPointer[p.Blob] = true
+	}
+
+	var mismatched []MismatchedFile
+	for _, file := range parseTreeBlobs(string(output)) {
+		tracked, known := lfs[file.Path]
+		if known && tracked != isPointer[file.Blob] {
+			mismatched = append(mismatched, MismatchedFile{CommittedFile: file, Pointer: isPointer[file.Blob]})
+		}
+	}
+	return mismatched, nil
+}
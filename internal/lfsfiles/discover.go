@@ -0,0 +1,96 @@
+package lfsfiles
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// binarySniffLength is the number of leading bytes examined for binary
+// detection; git uses the same heuristic (a NUL byte in the first 8000 bytes)
+const binarySniffLength = 8000
+
+// ExtensionStats aggregates the files sharing an extension
+type ExtensionStats struct {
+	Ext        string // Lower-case extension without the leading dot
+	Files      int
+	TotalSize  int64
+	Largest    int64
+	Binary     int  // Number of files detected as binary
+	MixedCases bool // Spelled other than in lower case, e.g. PSD or Psd
+	spellings  map[string]bool
+}
+
+// MostlyBinary reports whether at least half of the files are binary; Git
+// handles text well, so only binary extensions are worth tracking
+func (s *ExtensionStats) MostlyBinary() bool {
+	return s.Binary*2 >= s.Files
+}
+
+// GroupByExtension groups regular files by lower-case extension, largest
+// total size first, and counts the files without an extension
+func GroupByExtension(files []string) ([]*ExtensionStats, int) {
+	stats := map[string]*ExtensionStats{}
+	noExtension := 0
+
+	for _, file := range files {
+		rawExt := strings.TrimPrefix(filepath.Ext(file), ".")
+		if rawExt == "" {
+			noExtension++
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		ext := strings.ToLower(rawExt)
+		s, ok := stats[ext]
+		if !ok {
+			s = &ExtensionStats{Ext: ext, spellings: map[string]bool{}}
+			stats[ext] = s
+		}
+		s.Files++
+		s.TotalSize += info.Size()
+		if info.Size() > s.Largest {
+			s.Largest = info.Size()
+		}
+		if IsBinaryFile(file) {
+			s.Binary++
+		}
+		s.spellings[rawExt] = true
+	}
+
+	grouped := make([]*ExtensionStats, 0, len(stats))
+	for _, s := range stats {
+		s.MixedCases = len(s.spellings) > 1 || !s.spellings[s.Ext]
+		grouped = append(grouped, s)
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		if grouped[i].TotalSize != grouped[j].TotalSize {
+			return grouped[i].TotalSize > grouped[j].TotalSize
+		}
+		return grouped[i].Ext < grouped[j].Ext
+	})
+	return grouped, noExtension
+}
+
+// IsBinaryFile reports whether the file contains a NUL byte near its start
+func IsBinaryFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
@@ -0,0 +1,61 @@
+package lfsfiles
+
+import (
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// MatchFetchFilter reports whether a path matches an --include or --exclude
+// pattern of git lfs fetch and pull as Git LFS applies them: a glob, or a
+// directory and everything below it
+func MatchFetchFilter(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	dir := strings.TrimSuffix(pattern, "/")
+	if dir != "" && (p == dir || strings.HasPrefix(p, dir+"/")) {
+		return true
+	}
+	return MatchPath(pattern, p) || MatchPath(dir+"/**", p)
+}
+
+// SelectPointers returns the pointers that match an include pattern, or all
+// of them without includes, and no exclude pattern
+func SelectPointers(pointers []lfspointer.Pointer, includes, excludes []string) []lfspointer.Pointer {
+	matches := func(patterns []string, p string) bool {
+		for _, pattern := range patterns {
+			if MatchFetchFilter(pattern, p) {
+				return true
+			}
+		}
+		return false
+	}
+	var selected []lfspointer.Pointer
+	for _, pointer := range pointers {
+		if len(includes) > 0 && !matches(includes, pointer.Path) {
+			continue
+		}
+		if matches(excludes, pointer.Path) {
+			continue
+		}
+		selected = append(selected, pointer)
+	}
+	return selected
+}
+
+// EscapeFetchPattern escapes the wildcards of a path, so that it is an
+// --include pattern of git lfs fetch and pull matching that path. Commas,
+// which separate patterns and cannot be escaped, become '?', so a path
+// holding one also matches paths with another character in its place.
+func EscapeFetchPattern(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		switch {
+		case r == ',':
+			r = '?'
+		case strings.ContainsRune(`*?[]\`, r):
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
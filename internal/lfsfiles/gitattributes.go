@@ -0,0 +1,276 @@
+package lfsfiles
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AttributesCleanup is the result of cleaning one .gitattributes file
+type AttributesCleanup struct {
+	Path    string   // Relative to the top of the working tree
+	Removed []string // Lines removed, as they were written
+	Empty   bool     // No attributes remain, only comments and blank lines
+}
+
+// splitAttributesLine returns the pattern and attributes of a .gitattributes
+// line. Patterns may be quoted to contain spaces.
+func splitAttributesLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, `"`) {
+		if end := strings.Index(line[1:], `"`); end >= 0 {
+			return line[:end+2], strings.Fields(line[end+2:])
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// CleanAttributes removes stale lines from .gitattributes content: the Git
+// LFS lines of untracked patterns, patterns left without attributes, and
+// repeated lines. Of repeated lines the last is kept, because later lines
+// take precedence. It returns the cleaned content, the removed lines and
+// whether any attributes remain.
+func CleanAttributes(content string, untracked map[string]bool) (string, []string, bool) {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	// The normalized form of each line and where it last occurs
+	keys := make([]string, len(lines))
+	last := make(map[string]int)
+	for i, line := range lines {
+		pattern, attrs := splitAttributesLine(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		keys[i] = strings.Join(append([]string{pattern}, attrs...), " ")
+		last[keys[i]] = i
+	}
+
+	var kept, removed []string
+	attributes := false
+	for i, line := range lines {
+		pattern, attrs := splitAttributesLine(line)
+		stale := keys[i] != "" &&
+			(len(attrs) == 0 || last[keys[i]] != i || (untracked[pattern] && hasLFSFilter(attrs)))
+		if stale {
+			removed = append(removed, line)
+			continue
+		}
+		if keys[i] != "" {
+			attributes = true
+		}
+		kept = append(kept, line)
+	}
+
+	if len(removed) == 0 {
+		return content, nil, attributes
+	}
+	for len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+		kept = kept[:len(kept)-1]
+	}
+	if len(kept) == 0 {
+		return "", removed, false
+	}
+	return strings.Join(kept, "\n") + "\n", removed, attributes
+}
+
+// LFSPatterns returns the patterns of .gitattributes content that set
+// filter=lfs, in order
+func LFSPatterns(content string) []string {
+	var patterns []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if pattern, attrs := splitAttributesLine(line); pattern != "" && hasLFSFilter(attrs) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func hasLFSFilter(attrs []string) bool {
+	for _, attr := range attrs {
+		if attr == "filter=lfs" {
+			return true
+		}
+	}
+	return false
+}
+
+// UntrackedSet returns the .gitattributes patterns that expanded patterns
+// untrack, as given and as git lfs track escapes them. A nested
+// .gitattributes is relative to its own directory, so **/*.zip also covers
+// its *.zip lines.
+func UntrackedSet(expanded []string) map[string]bool {
+	untracked := make(map[string]bool)
+	for _, pattern := range expanded {
+		for _, p := range []string{pattern, EscapeAttributesPattern(pattern)} {
+			untracked[p] = true
+			if rest, ok := strings.CutPrefix(p, "**/"); ok {
+				untracked[rest] = true
+			}
+		}
+	}
+	return untracked
+}
+
+// CleanAttributesFiles applies CleanAttributes to the .gitattributes at the
+// top of the working tree, and with everywhere to every nested one too.
+// With deleteEmpty, files left without attributes are deleted. With dryRun
+// nothing is written and the changes are printed instead.
+func CleanAttributesFiles(expanded []string, everywhere, deleteEmpty, dryRun bool) ([]AttributesCleanup, error) {
+	top, files, err := attributesFiles(everywhere)
+	if err != nil {
+		return nil, err
+	}
+
+	untracked := UntrackedSet(expanded)
+	var cleanups []AttributesCleanup
+	for _, file := range files {
+		path := filepath.Join(top, file)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return cleanups, err
+		}
+
+		cleaned, removed, hasAttributes := CleanAttributes(string(data), untracked)
+		cleanup := AttributesCleanup{Path: file, Removed: removed, Empty: !hasAttributes}
+		remove := deleteEmpty && cleanup.Empty
+		if len(removed) == 0 && !remove {
+			continue
+		}
+		cleanups = append(cleanups, cleanup)
+
+		if dryRun {
+			for _, line := range removed {
+				fmt.Printf("DRY RUN: remove from %s: %s\n", file, strings.TrimSpace(line))
+			}
+			if remove {
+				fmt.Printf("DRY RUN: delete %s\n", file)
+			}
+			continue
+		}
+		if remove {
+			// git add --renormalize fails on deleted files, so the deletion
+			// is staged here
+			if err = os.Remove(path); err == nil {
+				cmd := exec.Command("git", "rm", "--cached", "--quiet", "--ignore-unmatch", "--", file)
+				cmd.Dir = top
+				err = cmd.Run()
+			}
+		} else {
+			err = os.WriteFile(path, []byte(cleaned), 0644)
+		}
+		if err != nil {
+			return cleanups, err
+		}
+	}
+	return cleanups, nil
+}
+
+// attributesFiles returns the top of the working tree and the
+// .gitattributes at its top, followed with everywhere by every nested one,
+// relative to the top
+func attributesFiles(everywhere bool) (string, []string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a Git working tree")
+	}
+	top := strings.TrimSpace(string(output))
+
+	files := []string{".gitattributes"}
+	if everywhere {
+		cmd := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard", "-z", "--", ":(glob)**/.gitattributes")
+		cmd.Dir = top
+		output, err := cmd.Output()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list .gitattributes files: %v", err)
+		}
+		for _, file := range strings.Split(string(output), "\x00") {
+			if file != "" && file != ".gitattributes" {
+				files = append(files, file)
+			}
+		}
+	}
+	return top, files, nil
+}
+
+// AttributesSnapshot is the content of the .gitattributes at the top of the
+// working tree, the only one git lfs track and untrack change, before a
+// run, so that a run failing partway can be undone
+type AttributesSnapshot struct {
+	path    string
+	data    []byte
+	existed bool
+}
+
+// SnapshotAttributes records the .gitattributes at the top of the working
+// tree, which need not exist
+func SnapshotAttributes() (*AttributesSnapshot, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("not inside a Git working tree")
+	}
+	return snapshotFile(filepath.Join(strings.TrimSpace(string(output)), ".gitattributes"))
+}
+
+func snapshotFile(path string) (*AttributesSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &AttributesSnapshot{path: path, data: data, existed: err == nil}, nil
+}
+
+// restore puts the recorded content back, removing a file that did not
+// exist, and reports whether the file had changed
+func (s *AttributesSnapshot) restore() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return false, err
+	case os.IsNotExist(err) && !s.existed:
+		return false, nil
+	case err == nil && s.existed && bytes.Equal(data, s.data):
+		return false, nil
+	case !s.existed:
+		return true, os.Remove(s.path)
+	}
+	return true, os.WriteFile(s.path, s.data, 0644)
+}
+
+// Rollback restores .gitattributes after err, so that a run applies all of
+// its patterns or none, and explains what became of the patterns applied
+// before the failure. A nil snapshot, as with --keep-partial, keeps them.
+func (s *AttributesSnapshot) Rollback(err error, applied []string) error {
+	if s == nil {
+		if len(applied) == 0 {
+			return err
+		}
+		return fmt.Errorf("%v\nKept the changes to .gitattributes for %s (--keep-partial)", err, strings.Join(applied, " "))
+	}
+	changed, restoreErr := s.restore()
+	switch {
+	case restoreErr != nil:
+		return fmt.Errorf("%v\nRestoring .gitattributes failed too: %v", err, restoreErr)
+	case !changed:
+		return err
+	case len(applied) == 0:
+		return fmt.Errorf("%v\nRestored .gitattributes as it was before", err)
+	}
+	return fmt.Errorf("%v\nRestored .gitattributes as it was before, undoing %s; pass --keep-partial to keep the patterns applied before a failure",
+		err, strings.Join(applied, " "))
+}
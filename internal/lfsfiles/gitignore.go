@@ -0,0 +1,126 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Markers delimiting the part of .gitignore maintained by git-lfs-track and
+// git-lfs-untrack; lines outside the block are never touched
+const (
+	gitignoreBegin = "# BEGIN git-lfs-track managed block"
+	gitignoreEnd   = "# END git-lfs-track managed block"
+)
+
+// GitignoreEntries returns the .gitignore lines corresponding to expanded
+// patterns, each prefixed with '!' when negate is set
+func GitignoreEntries(expanded []string, negate bool) []string {
+	entries := make([]string, 0, len(expanded))
+	for _, pattern := range expanded {
+		if negate {
+			pattern = "!" + pattern
+		}
+		entries = append(entries, pattern)
+	}
+	return entries
+}
+
+// UpdateManagedBlock adds and removes entries in the managed block of
+// .gitignore content, creating the block at the end when it is missing and
+// dropping it once it is empty. Removing a pattern also removes its negation,
+// so untracking does not depend on how the pattern was added.
+func UpdateManagedBlock(content string, add, remove []string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case gitignoreBegin:
+			begin = i
+		case gitignoreEnd:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+
+	var before, entries, after []string
+	if begin >= 0 && end > begin {
+		before, entries, after = lines[:begin], lines[begin+1:end], lines[end+1:]
+	} else {
+		before = lines
+	}
+
+	removed := make(map[string]bool)
+	for _, pattern := range remove {
+		removed[strings.TrimPrefix(pattern, "!")] = true
+	}
+	var kept []string
+	seen := make(map[string]bool)
+	for _, entry := range append(entries, add...) {
+		if removed[strings.TrimPrefix(entry, "!")] || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		kept = append(kept, entry)
+	}
+
+	result := append([]string{}, before...)
+	if len(kept) > 0 {
+		if len(result) > 0 && strings.TrimSpace(result[len(result)-1]) != "" {
+			result = append(result, "")
+		}
+		result = append(result, gitignoreBegin)
+		result = append(result, kept...)
+		result = append(result, gitignoreEnd)
+	} else {
+		for len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" {
+			result = result[:len(result)-1]
+		}
+	}
+	result = append(result, after...)
+
+	if len(result) == 0 {
+		return ""
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+// syncGitignore applies UpdateManagedBlock to the .gitignore at the top of
+// the working tree, next to the .gitattributes that git lfs track maintains
+func syncGitignore(add, remove []string, dryRun bool) error {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return fmt.Errorf("not inside a Git working tree")
+	}
+	path := filepath.Join(strings.TrimSpace(string(output)), ".gitignore")
+
+	if dryRun {
+		if len(add) > 0 {
+			fmt.Printf("DRY RUN: add to .gitignore: %s\n", strings.Join(add, " "))
+		}
+		if len(remove) > 0 {
+			fmt.Printf("DRY RUN: remove from .gitignore: %s\n", strings.Join(remove, " "))
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated := UpdateManagedBlock(string(data), add, remove)
+	if updated == string(data) {
+		return nil
+	}
+	if updated == "" && err == nil {
+		return os.Remove(path)
+	}
+	return os.WriteFile(path, []byte(updated), 0644)
+}
@@ -0,0 +1,123 @@
+package lfsfiles
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// HistoryBlob is a large blob, not stored in Git LFS, that is reachable from
+// the scanned refs but is no longer in any of their trees
+type HistoryBlob struct {
+	Blob   string
+	Size   int64
+	Path   string // Path the blob was added at
+	Commit string // Oldest commit adding the blob; "" when only a merge did
+	Date   string // Commit date, YYYY-MM-DD
+}
+
+// HistoryOnly returns the blobs of at least minSize bytes reachable from refs
+// that are not in the tree of any of the refs, largest first. Blobs small
+// enough to be LFS pointers are never reported.
+func HistoryOnly(refs []string, minSize int64) ([]HistoryBlob, error) {
+	output, err := exec.Command("git", append([]string{"rev-list", "--objects"}, refs...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list failed: %v", err)
+	}
+	paths := make(map[string]string)
+	var input bytes.Buffer
+	for _, line := range strings.Split(string(output), "\n") {
+		object, path, _ := strings.Cut(line, " ")
+		if object == "" {
+			continue
+		}
+		if _, seen := paths[object]; !seen {
+			paths[object] = path
+			input.WriteString(object + "\n")
+		}
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	cmd.Stdin = &input
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %v", err)
+	}
+	large := make(map[string]*HistoryBlob)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err == nil && size >= minSize && size > lfspointer.MaxPointerSize {
+			large[fields[0]] = &HistoryBlob{Blob: fields[0], Size: size, Path: paths[fields[0]]}
+		}
+	}
+	if len(large) == 0 {
+		return nil, nil
+	}
+
+	// Blobs still in a tree show up in the working tree listing instead
+	for _, ref := range refs {
+		output, err := exec.Command("git", "ls-tree", "-r", "--full-tree", ref).Output()
+		if err != nil {
+			return nil, fmt.Errorf("git ls-tree %s failed: %v", ref, err)
+		}
+		// MODE SP TYPE SP OBJECT TAB PATH
+		for _, line := range strings.Split(string(output), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 3 {
+				delete(large, fields[2])
+			}
+		}
+	}
+	if len(large) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"log", "--raw", "--no-abbrev", "--no-renames", "--format=commit %H %cs"}, refs...)
+	output, err = exec.Command("git", append(args, "--")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v", err)
+	}
+	applyAdditions(string(output), large)
+
+	blobs := make([]HistoryBlob, 0, len(large))
+	for _, b := range large {
+		blobs = append(blobs, *b)
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		if blobs[i].Size != blobs[j].Size {
+			return blobs[i].Size > blobs[j].Size
+		}
+		return blobs[i].Path < blobs[j].Path
+	})
+	return blobs, nil
+}
+
+// applyAdditions reads 'git log --raw --format="commit %H %cs"' output,
+// newest commit first, and records in blobs the oldest commit that added
+// or modified a file to have each blob's content
+func applyAdditions(log string, blobs map[string]*HistoryBlob) {
+	var commit, date string
+	for _, line := range strings.Split(log, "\n") {
+		if rest, found := strings.CutPrefix(line, "commit "); found {
+			commit, date, _ = strings.Cut(rest, " ")
+			continue
+		}
+		// :OLDMODE NEWMODE OLDBLOB NEWBLOB STATUS<TAB>PATH
+		meta, path, found := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !found || !strings.HasPrefix(line, ":") || len(fields) != 5 {
+			continue
+		}
+		if b, ok := blobs[fields[3]]; ok {
+			b.Commit, b.Date, b.Path = commit, date, path
+		}
+	}
+}
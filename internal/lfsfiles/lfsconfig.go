@@ -0,0 +1,57 @@
+package lfsfiles
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// TrackedFetchPatterns returns the patterns of every .gitattributes in the
+// working tree that set filter=lfs, as lfs.fetchinclude patterns: those of
+// a nested .gitattributes are prefixed with its directory. Repeated
+// patterns are given once, in the order found.
+func TrackedFetchPatterns() ([]string, error) {
+	top, files, err := attributesFiles(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(top, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Dir(filepath.ToSlash(file))
+		for _, pattern := range LFSPatterns(string(data)) {
+			if fetch := fetchPattern(dir, pattern); !seen[fetch] {
+				seen[fetch] = true
+				patterns = append(patterns, fetch)
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// fetchPattern converts a .gitattributes pattern of the directory dir into
+// an lfs.fetchinclude pattern matching the same paths. A pattern without a
+// slash matches at any depth below dir; one with a slash is relative to
+// dir. Commas, which separate fetch patterns, become '?'.
+func fetchPattern(dir, pattern string) string {
+	if unquoted, ok := strings.CutPrefix(pattern, `"`); ok {
+		pattern = strings.TrimSuffix(unquoted, `"`)
+	}
+	pattern = strings.ReplaceAll(pattern, ",", "?")
+	if dir == "." {
+		return pattern
+	}
+	if strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		return dir + "/" + strings.TrimPrefix(pattern, "/")
+	}
+	return dir + "/**/" + pattern
+}
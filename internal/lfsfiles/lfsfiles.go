@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/lithammer/dedent"
 	"github.com/mslinn/git_lfs_scripts/internal/common"
@@ -22,18 +25,42 @@ const (
 
 // Options holds the command-line options
 type Options struct {
-	BothCases  bool   // -c: Expand pattern to upper and lower case
-	DryRun     bool   // -d: Dry run
-	Everywhere bool   // -e: Apply pattern everywhere (all directories)
-	Command    string // The git command to execute
+	BothCases   bool     // -c: Expand pattern to upper and lower case
+	AllCases    bool     // --all-cases: Expand pattern to a character class matching every case
+	DryRun      bool     // -d: Dry run
+	Everywhere  bool     // -e: Apply pattern everywhere (all directories)
+	Paths       []string // --path: Anchor patterns to these directories instead of the current one
+	Gitignore   bool     // --gitignore: Keep the managed block of .gitignore in sync
+	Negate      bool     // --negate: Write .gitignore entries as negations ('!*.psd')
+	KeepPartial bool     // --keep-partial: Keep the changes of earlier patterns when a later one fails
+	Null        bool     // -z: Terminate listed paths with NUL instead of newline
+	Command     string   // The git command to execute
 }
 
 // ExpandPattern expands a file extension pattern based on options
 func ExpandPattern(pattern string, opts Options) []string {
+	return AnchorPatterns(expandExtension(pattern, opts), opts.Paths)
+}
+
+// expandExtension expands a file extension pattern relative to the
+// current directory
+func expandExtension(pattern string, opts Options) []string {
 	var patterns []string
 
 	lc := strings.ToLower(pattern)
 	uc := strings.ToUpper(pattern)
+	if lc == uc {
+		// An extension without letters, such as '001', has only one case
+		opts.BothCases = false
+	}
+
+	if opts.AllCases {
+		pattern = CaseClassPattern(pattern)
+		if opts.Everywhere {
+			return []string{"*." + pattern, "**/*." + pattern}
+		}
+		return []string{"*." + pattern}
+	}
 
 	if opts.Everywhere {
 		if opts.BothCases {
@@ -65,6 +92,103 @@ func ExpandPattern(pattern string, opts Options) []string {
 	return patterns
 }
 
+// AnchorPatterns prefixes expanded patterns with each directory, so
+// '*.mp4' and '**/*.mp4' anchored to 'media' become 'media/*.mp4' and
+// 'media/**/*.mp4'. Directories are cleaned; '.' stands for the current
+// directory and leaves the patterns unchanged. Without directories the
+// patterns are returned as they are.
+func AnchorPatterns(expanded []string, dirs []string) []string {
+	if len(dirs) == 0 {
+		return expanded
+	}
+
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		dir = strings.Trim(path.Clean(filepath.ToSlash(dir)), "/")
+		for _, pattern := range expanded {
+			if dir != "." && dir != "" {
+				pattern = dir + "/" + pattern
+			}
+			if !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// CaseClassPattern replaces each letter with a bracket expression matching
+// both cases, e.g. 'mp3' becomes '[mM][pP]3'. Existing bracket expressions
+// are kept as they are.
+func CaseClassPattern(pattern string) string {
+	var b strings.Builder
+	inBracket := false
+	for _, r := range pattern {
+		switch {
+		case inBracket:
+			b.WriteRune(r)
+			inBracket = r != ']'
+		case r == '[':
+			b.WriteRune(r)
+			inBracket = true
+		case unicode.IsLetter(r) && unicode.ToLower(r) != unicode.ToUpper(r):
+			b.WriteString("[" + string(unicode.ToLower(r)) + string(unicode.ToUpper(r)) + "]")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ExceptionPatterns combines subtree globs such as 'archive/**' with expanded
+// patterns, producing patterns that keep matching files in those subtrees.
+// A glob whose last segment already names files (e.g. 'archive/*.psd') is
+// used as given.
+func ExceptionPatterns(expanded []string, excepts []string) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, except := range excepts {
+		segments := strings.Split(strings.Trim(except, "/"), "/")
+		if last := segments[len(segments)-1]; last != "**" && strings.Contains(last, "*") {
+			add(except)
+			continue
+		}
+
+		// Repeated ** segments match nothing more than one, a trailing ** is
+		// the subtree itself, and '**' alone is the whole tree
+		var kept []string
+		for _, segment := range segments {
+			if segment != "**" || len(kept) == 0 || kept[len(kept)-1] != "**" {
+				kept = append(kept, segment)
+			}
+		}
+		for len(kept) > 0 && kept[len(kept)-1] == "**" {
+			kept = kept[:len(kept)-1]
+		}
+		prefix := strings.Join(kept, "/")
+		for _, pattern := range expanded {
+			pattern = strings.TrimPrefix(pattern, "**/")
+			if prefix == "" {
+				add("**/" + pattern)
+			} else {
+				add(prefix + "/**/" + pattern)
+			}
+		}
+	}
+
+	return patterns
+}
+
 // Execute runs the git command with expanded patterns
 func Execute(patterns []string, opts Options) error {
 	// Check if this is an LFS command (not regular git ls-files)
@@ -80,41 +204,153 @@ func Execute(patterns []string, opts Options) error {
 		}
 	}
 
+	// track and untrack write .gitattributes lines, where broken patterns
+	// fail silently
+	writesAttributes := opts.Command == GetCommandString(LfsTrack) || opts.Command == GetCommandString(LfsUntrack)
+	if writesAttributes {
+		for _, warning := range CheckPatterns(patterns, opts) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+	}
+	arguments := func(expanded []string) []string {
+		if writesAttributes {
+			return EscapeAttributesPatterns(expanded)
+		}
+		if opts.Null && opts.Command == GetCommandString(LsFiles) {
+			return append([]string{"-z"}, expanded...)
+		}
+		return expanded
+	}
+
 	if opts.DryRun {
+		var all []string
 		for _, pattern := range patterns {
 			expanded := ExpandPattern(pattern, opts)
-			fmt.Printf("DRY RUN: %s %s\n", opts.Command, strings.Join(expanded, " "))
+			all = append(all, expanded...)
+			fmt.Printf("DRY RUN: %s %s\n", opts.Command, strings.Join(arguments(expanded), " "))
 		}
-		return nil
+		return updateGitignore(all, opts)
 	}
 
 	// If no patterns provided and it's a ls-files command, just run the command
 	if len(patterns) == 0 && (opts.Command == "git ls-files" || opts.Command == "git lfs ls-files") {
-		return executeCommand(opts.Command, []string{})
+		return executeCommand(opts.Command, arguments(nil))
+	}
+
+	var snapshot *AttributesSnapshot
+	if writesAttributes && !opts.KeepPartial {
+		var err error
+		if snapshot, err = SnapshotAttributes(); err != nil {
+			return err
+		}
+	}
+	fail := func(err error, applied []string) error {
+		if !writesAttributes {
+			return err
+		}
+		return snapshot.Rollback(err, applied)
 	}
 
 	// Execute command for each pattern
+	var all []string
 	for _, pattern := range patterns {
 		expanded := ExpandPattern(pattern, opts)
-		if err := executeCommand(opts.Command, expanded); err != nil {
-			return err
+		if err := executeCommand(opts.Command, arguments(expanded)); err != nil {
+			err = fmt.Errorf("%s %s failed: %v", opts.Command, strings.Join(arguments(expanded), " "), err)
+			return fail(err, all)
 		}
+		all = append(all, expanded...)
+	}
+
+	if err := updateGitignore(all, opts); err != nil {
+		return fail(err, all)
 	}
+	return nil
+}
 
+// updateGitignore mirrors a track or untrack in .gitignore when requested
+func updateGitignore(expanded []string, opts Options) error {
+	if !opts.Gitignore {
+		return nil
+	}
+	switch opts.Command {
+	case GetCommandString(LfsTrack):
+		return syncGitignore(GitignoreEntries(expanded, opts.Negate), nil, opts.DryRun)
+	case GetCommandString(LfsUntrack):
+		return syncGitignore(nil, expanded, opts.DryRun)
+	}
 	return nil
 }
 
-// executeCommand runs a git command with the given arguments
+// MatchPath reports whether a path relative to the top of the working tree
+// matches an expanded pattern. Like .gitattributes, a pattern without a slash
+// matches the file name at any depth, and a ** segment matches any number of
+// directories, including none.
+func MatchPath(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "**/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(p))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+// matchSegments matches slash-separated pattern segments against path segments
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// TopRelativeDirs converts directories given relative to the current
+// directory, as --path takes them, to directories relative to the top of
+// the working tree, as MatchPath expects paths
+func TopRelativeDirs(dirs []string) ([]string, error) {
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+	prefix, err := common.QueryCommand("git", "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("git rev-parse failed: %v", err)
+	}
+	converted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		converted[i] = path.Join(prefix, filepath.ToSlash(dir))
+	}
+	return converted, nil
+}
+
+// executeCommand runs a git command with the given arguments: ls-files
+// through common.Query, as it only reads, and track and untrack through
+// common.Run
 func executeCommand(cmdStr string, args []string) error {
 	parts := strings.Fields(cmdStr)
 	allArgs := append(parts[1:], args...)
 
 	cmd := exec.Command(parts[0], allArgs...)
-	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-
-	return cmd.Run()
+	if strings.HasSuffix(cmdStr, "ls-files") {
+		output, err := common.Query(cmd)
+		os.Stdout.Write(output)
+		return err
+	}
+	return common.Run(cmd)
 }
 
 // GetCommandString returns the git command string for the given command type
@@ -164,10 +400,17 @@ func PrintHelp(cmdType CommandType) {
 			  %s [OPTIONS] PATTERN ...
 
 			OPTIONS:
-			  -c  Expand pattern to upper and lower case, helpful for media files
-			  -d  Dry run (display filename patterns that would be affected)
-			  -e  Apply the pattern everywhere (all directories in the Git repository)
-			  -h  Show this help message
+			  -c           Expand pattern to upper and lower case, helpful for media files
+			  --all-cases  Expand pattern to match every case combination, e.g. Mp3 and mP3
+			  -d           Dry run (display filename patterns that would be affected)
+			  -e           Apply the pattern everywhere (all directories in the Git repository)
+			  --path DIR   Anchor the patterns to DIR instead of the current directory;
+			               repeat or separate with commas for several directories
+			  -z, --null   Terminate each path with NUL instead of newline, and list
+			               it unquoted, for xargs -0
+			  --trace      Print every external command before running it
+			  -h           Show this help message
+			  --version    Show the version, commit and build date
 
 			DESCRIPTION:
 			  This command acts as a frontend to 'git ls-files', permutating wildmatch
@@ -200,6 +443,10 @@ func PrintHelp(cmdType CommandType) {
 			  # Output: DRY RUN: %s *.mp3 *.MP3
 			  #         DRY RUN: %s *.mp4 *.MP4
 
+			  # Every case combination with a single pattern
+			  %s -d --all-cases mp3
+			  # Output: DRY RUN: %s *.[mM][pP]3
+
 			  # Apply everywhere in repository
 			  %s -de zip
 			  # Output: DRY RUN: %s *.zip **/*.zip
@@ -213,6 +460,13 @@ func PrintHelp(cmdType CommandType) {
 			  # Output: DRY RUN: %s *.mp3 *.MP3 **/*.mp3 **/*.MP3
 			  #         DRY RUN: %s *.mp4 *.MP4 **/*.mp4 **/*.MP4
 
+			  # Only below given directories
+			  %s -de --path media --path assets/video mp4
+			  # Output: DRY RUN: %s media/*.mp4 media/**/*.mp4 assets/video/*.mp4 assets/video/**/*.mp4
+
+			  # Delete every zip file, even those with spaces or newlines in their names
+			  %s -ze zip | xargs -0 git rm --
+
 			SEE ALSO:
 			  Related commands: git-lfs-files, git-ls-files, git-lfs-track, git-unmigrate, git-lfs-untrack
 			  Documentation: https://mslinn.com/git/5300-git-lfs-patterns-tracking.html
@@ -223,7 +477,10 @@ func PrintHelp(cmdType CommandType) {
 			cmdName, gitCmd, gitCmd,
 			cmdName, gitCmd,
 			cmdName, gitCmd,
-			cmdName, gitCmd, gitCmd))
+			cmdName, gitCmd,
+			cmdName, gitCmd, gitCmd,
+			cmdName, gitCmd,
+			cmdName))
 	} else {
 		helpText = dedent.Dedent(fmt.Sprintf(`
 			%s
@@ -232,10 +489,15 @@ func PrintHelp(cmdType CommandType) {
 			  %s [OPTIONS] PATTERN ...
 
 			OPTIONS:
-			  -c  Expand pattern to upper and lower case, helpful for media files
-			  -d  Dry run (display filename patterns that would be affected)
-			  -e  Apply the pattern everywhere (all directories in the Git repository)
-			  -h  Show this help message
+			  -c           Expand pattern to upper and lower case, helpful for media files
+			  --all-cases  Expand pattern to match every case combination, e.g. Mp3 and mP3
+			  -d           Dry run (display filename patterns that would be affected)
+			  -e           Apply the pattern everywhere (all directories in the Git repository)
+			  --path DIR   Anchor the patterns to DIR instead of the current directory;
+			               repeat or separate with commas for several directories
+			  --trace      Print every external command before running it
+			  -h           Show this help message
+			  --version    Show the version, commit and build date
 
 			DESCRIPTION:
 			  This command permutates wildmatch patterns for use with the underlying
@@ -260,6 +522,10 @@ func PrintHelp(cmdType CommandType) {
 			  # Output: DRY RUN: %s *.mp3 *.MP3
 			  #         DRY RUN: %s *.mp4 *.MP4
 
+			  # Every case combination with a single pattern
+			  %s -d --all-cases mp3
+			  # Output: DRY RUN: %s *.[mM][pP]3
+
 			  # Apply everywhere in repository
 			  %s -de zip
 			  # Output: DRY RUN: %s *.zip **/*.zip
@@ -273,6 +539,10 @@ func PrintHelp(cmdType CommandType) {
 			  # Output: DRY RUN: %s *.mp3 *.MP3 **/*.mp3 **/*.MP3
 			  #         DRY RUN: %s *.mp4 *.MP4 **/*.mp4 **/*.MP4
 
+			  # Only below given directories
+			  %s -de --path media --path assets/video mp4
+			  # Output: DRY RUN: %s media/*.mp4 media/**/*.mp4 assets/video/*.mp4 assets/video/**/*.mp4
+
 			SEE ALSO:
 			  Related commands: git-lfs-files, git-ls-files, git-lfs-track, git-unmigrate, git-lfs-untrack
 			  Documentation: https://mslinn.com/git/5300-git-lfs-patterns-tracking.html
@@ -283,8 +553,105 @@ func PrintHelp(cmdType CommandType) {
 			cmdName, gitCmd, gitCmd,
 			cmdName, gitCmd,
 			cmdName, gitCmd,
-			cmdName, gitCmd, gitCmd))
+			cmdName, gitCmd,
+			cmdName, gitCmd, gitCmd,
+			cmdName, gitCmd))
+	}
+
+	if cmdType == LfsTrack || cmdType == LfsUntrack {
+		verb := "Add the expanded patterns to"
+		if cmdType == LfsUntrack {
+			verb = "Remove the expanded patterns from"
+		}
+		helpText = strings.Replace(helpText, "  -h           Show this help message\n",
+			"  -h           Show this help message\n"+
+				"  --gitignore  "+verb+" a managed block in .gitignore\n"+
+				"               too, keeping .gitignore in sync with .gitattributes\n"+
+				"  --keep-partial\n"+
+				"               When a pattern fails, keep the changes the patterns before\n"+
+				"               it made; by default .gitattributes is restored as it was\n"+
+				"               before the run\n", 1)
 	}
+	if cmdType == LfsTrack || cmdType == LfsUntrack {
+		helpText = strings.Replace(helpText, "  Git or Git LFS command.\n",
+			"  Git or Git LFS command.\n\n"+
+				"  Patterns that would match something else than intended in\n"+
+				"  .gitattributes are reported as warnings: an extension given as '*.psd'\n"+
+				"  or '.psd', '**' inside a path segment, backslashes, and --path\n"+
+				"  directories starting with '#'. Whitespace is written as [[:space:]],\n"+
+				"  which git lfs track also does, and a leading '#' as '\\#'.\n", 1)
+	}
+	if cmdType == LfsTrack {
+		helpText = strings.Replace(helpText, "               too, keeping .gitignore in sync with .gitattributes\n",
+			"               too, keeping .gitignore in sync with .gitattributes\n"+
+				"  --negate     With --gitignore, write negated entries ('!*.psd') so tracked\n"+
+				"               files stay visible inside otherwise ignored directories\n"+
+				"  --auto       Instead of PATTERNs, group the non-LFS files below the current\n"+
+				"               directory by extension and track every mostly binary one,\n"+
+				"               showing the plan first; -c and -e apply to each extension,\n"+
+				"               and extensions spelled in several cases get -c anyway\n"+
+				"  --min-size N With --auto, only extensions having a file at least N\n"+
+				"               bytes large, e.g. 5M (default: 1M)\n"+
+				"  -y, --yes    With --auto, track without asking for confirmation\n"+
+				"  --fix-committed ACTION\n"+
+				"               Files matching the patterns that are already committed as\n"+
+				"               regular Git blobs stay in Git and are listed in a warning;\n"+
+				"               'migrate' converts them in a new commit with git lfs migrate\n"+
+				"               import --no-rewrite, 'renormalize' stages them with git add\n"+
+				"               --renormalize. Without it, a terminal is asked which to do\n"+
+				"  --normalize  Sort and deduplicate the Git LFS lines of .gitattributes and\n"+
+				"               give each the attributes 'filter=lfs diff=lfs merge=lfs\n"+
+				"               -text', keeping comments and other lines in place, so the\n"+
+				"               file diffs cleanly; with -e, every nested .gitattributes too.\n"+
+				"               With PATTERNs, runs after tracking them\n"+
+				"  --write-lfsconfig\n"+
+				"               Create or update the committed .lfsconfig, which every clone\n"+
+				"               reads, with team-wide settings: lfs.fetchinclude lists the\n"+
+				"               patterns of every .gitattributes that sets filter=lfs, those\n"+
+				"               of nested ones prefixed with their directory, and\n"+
+				"               lfs.concurrenttransfers is set. Run it again after tracking\n"+
+				"               more patterns without it, or their files are not downloaded.\n"+
+				"               With PATTERNs, runs after tracking them\n"+
+				"  --lfs-url URL\n"+
+				"               With --write-lfsconfig, also set lfs.url\n"+
+				"  --concurrent-transfers N\n"+
+				"               With --write-lfsconfig, set lfs.concurrenttransfers (default: 8)\n"+
+				"  --fetch-exclude PATTERN,...\n"+
+				"               With --write-lfsconfig, tracked patterns that clones do not\n"+
+				"               download, as lfs.fetchexclude, e.g. 'raw/**'; without it the\n"+
+				"               current lfs.fetchexclude is kept\n", 1)
+		helpText = strings.Replace(helpText, "  "+cmdName+" [OPTIONS] PATTERN ...\n",
+			"  "+cmdName+" [OPTIONS] PATTERN ...\n"+
+				"  "+cmdName+" [OPTIONS] --auto [--min-size N]\n"+
+				"  "+cmdName+" [-d] [-e] --normalize\n"+
+				"  "+cmdName+" [-d] --write-lfsconfig [--lfs-url URL] [--fetch-exclude PATTERN,...]\n", 1)
+	}
+
+	if cmdType == LfsLsFiles {
+		helpText = strings.Replace(helpText, "  -h           Show this help message\n",
+			"  -h           Show this help message\n"+
+				"  -n           List matching LFS paths from the inventory cache shared with\n"+
+				"               git-nonlfs, without running git lfs ls-files\n"+
+				"  --no-cache   With -n, classify every file without using the cache\n"+
+				"  -l, --long   Show oid, size, whether the object is in local LFS storage\n"+
+				"               ('cached' or 'absent') and whether the working tree holds\n"+
+				"               the content, the pointer file or nothing\n"+
+				"  -z, --null   Terminate each path, or each --long line, with NUL instead\n"+
+				"               of newline, for xargs -0. git lfs ls-files cannot do so, so\n"+
+				"               without -l the paths come from the inventory cache, as with -n\n", 1)
+	}
+
+	helpText = strings.Replace(helpText, "\nSEE ALSO:\n",
+		"\n  # Every extension of a preset\n"+
+			"  "+cmdName+" -dce @video\n"+
+			"  # Output: DRY RUN: "+gitCmd+" *.mp4 *.MP4 **/*.mp4 **/*.MP4\n"+
+			"  #         DRY RUN: "+gitCmd+" *.mov *.MOV **/*.mov **/*.MOV ...\n"+
+			"\nPRESETS:\n"+
+			"  A PATTERN of the form @NAME stands for every extension of a preset.\n"+
+			"  Define more, or redefine these, in git config:\n"+
+			"    git config lfs-scripts.preset.textures \"tga dds exr\"\n\n"+
+			presetHelp()+
+			"\nSEE ALSO:\n", 1)
 
 	fmt.Print(helpText)
 }
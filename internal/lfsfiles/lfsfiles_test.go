@@ -1,8 +1,17 @@
 package lfsfiles
 
 import (
+	"errors"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
 )
 
 // TestExpandPattern tests the wildmatch pattern expansion logic
@@ -67,6 +76,24 @@ func TestExpandPattern(t *testing.T) {
 			},
 			expected: []string{"*.mov", "*.MOV", "**/*.mov", "**/*.MOV"},
 		},
+		{
+			name:    "all cases - current directory",
+			pattern: "mp3",
+			opts: Options{
+				AllCases: true,
+			},
+			expected: []string{"*.[mM][pP]3"},
+		},
+		{
+			name:    "all cases everywhere, overriding both cases",
+			pattern: "Mp4",
+			opts: Options{
+				BothCases:  true,
+				AllCases:   true,
+				Everywhere: true,
+			},
+			expected: []string{"*.[mM][pP]4", "**/*.[mM][pP]4"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -284,3 +311,795 @@ func TestWildmatchPatternExamples(t *testing.T) {
 		})
 	}
 }
+
+// TestExceptionPatterns tests combining subtree exceptions with expanded patterns
+func TestExceptionPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		expanded []string
+		excepts  []string
+		expected []string
+	}{
+		{
+			name:     "subtree glob",
+			expanded: []string{"*.psd"},
+			excepts:  []string{"archive/**"},
+			expected: []string{"archive/**/*.psd"},
+		},
+		{
+			name:     "everywhere patterns collapse to one exception",
+			expanded: []string{"*.psd", "**/*.psd"},
+			excepts:  []string{"archive/**"},
+			expected: []string{"archive/**/*.psd"},
+		},
+		{
+			name:     "plain directory with case variations",
+			expanded: []string{"*.psd", "*.PSD"},
+			excepts:  []string{"art/old/"},
+			expected: []string{"art/old/**/*.psd", "art/old/**/*.PSD"},
+		},
+		{
+			name:     "explicit file glob is used as given",
+			expanded: []string{"*.psd"},
+			excepts:  []string{"archive/*.psd", "keep/**"},
+			expected: []string{"archive/*.psd", "keep/**/*.psd"},
+		},
+		{
+			name:     "no exceptions",
+			expanded: []string{"*.psd"},
+			excepts:  nil,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ExceptionPatterns(tt.expanded, tt.excepts)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ExceptionPatterns(%v, %v) = %v, want %v",
+					tt.expanded, tt.excepts, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCaseClassPattern tests conversion of letters to bracket expressions
+func TestCaseClassPattern(t *testing.T) {
+	tests := map[string]string{
+		"mp3":    "[mM][pP]3",
+		"tar.gz": "[tT][aA][rR].[gG][zZ]",
+		"[jt]pg": "[jt][pP][gG]",
+		"7z":     "7[zZ]",
+		"":       "",
+	}
+
+	for pattern, want := range tests {
+		if got := CaseClassPattern(pattern); got != want {
+			t.Errorf("CaseClassPattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+// TestMatchPath tests matching of expanded patterns against repository paths
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		expected      bool
+	}{
+		{"*.mp3", "song.mp3", true},
+		{"*.mp3", "music/song.mp3", true},
+		{"**/*.mp3", "music/live/song.mp3", true},
+		{"*.[mM][pP]3", "music/song.MP3", true},
+		{"*.mp3", "song.MP3", false},
+		{"music/*.mp3", "music/song.mp3", true},
+		{"music/*.mp3", "other/song.mp3", false},
+		{"music/*.mp3", "music/live/song.mp3", false},
+		{"music/**/*.mp3", "music/song.mp3", true},
+		{"music/**/*.mp3", "music/live/2024/song.mp3", true},
+		{"music/**/*.mp3", "other/music/song.mp3", false},
+		{"a/**/b/*.psd", "a/x/y/b/f.psd", true},
+		{"a/**/b/*.psd", "a/b/f.psd", true},
+		{"a/**/b/*.psd", "a/b/c/f.psd", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.path); got != tt.expected {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.expected)
+		}
+	}
+}
+
+// TestAnchorPatterns tests anchoring expanded patterns to directories
+func TestAnchorPatterns(t *testing.T) {
+	everywhere := []string{"*.mp4", "**/*.mp4"}
+	tests := []struct {
+		name     string
+		expanded []string
+		dirs     []string
+		want     []string
+	}{
+		{"no directories", everywhere, nil, everywhere},
+		{"one directory", everywhere, []string{"media"}, []string{"media/*.mp4", "media/**/*.mp4"}},
+		{"cleaned", []string{"*.mp4"}, []string{"./media//video/"}, []string{"media/video/*.mp4"}},
+		{"current directory", []string{"*.mp4"}, []string{"."}, []string{"*.mp4"}},
+		{"several, no duplicates", []string{"*.mp4"}, []string{"a", "b", "a/"}, []string{"a/*.mp4", "b/*.mp4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnchorPatterns(tt.expanded, tt.dirs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnchorPatterns(%v, %v) = %v, want %v", tt.expanded, tt.dirs, got, tt.want)
+			}
+		})
+	}
+
+	// Anchored patterns match inside the directory only, at any depth with -e
+	opts := Options{BothCases: true, Everywhere: true, Paths: []string{"media"}}
+	expanded := ExpandPattern("mp4", opts)
+	for p, want := range map[string]bool{
+		"media/a.MP4":       true,
+		"media/x/y/a.mp4":   true,
+		"other/a.mp4":       false,
+		"other/media/a.mp4": false,
+		"a.mp4":             false,
+	} {
+		if got := matchAny(expanded, p); got != want {
+			t.Errorf("%v matching %q = %v, want %v", expanded, p, got, want)
+		}
+	}
+}
+
+// TestUpdateManagedBlock tests keeping .gitignore entries in sync with tracked patterns
+func TestUpdateManagedBlock(t *testing.T) {
+	block := func(entries ...string) string {
+		return gitignoreBegin + "\n" + strings.Join(entries, "\n") + "\n" + gitignoreEnd + "\n"
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		add     []string
+		remove  []string
+		want    string
+	}{
+		{"create file", "", []string{"*.psd", "*.PSD"}, nil, block("*.psd", "*.PSD")},
+		{"append block", "raw/\n", []string{"!*.psd"}, nil, "raw/\n\n" + block("!*.psd")},
+		{"no duplicates", "raw/\n\n" + block("*.psd"), []string{"*.psd", "*.tif"}, nil, "raw/\n\n" + block("*.psd", "*.tif")},
+		{"remove negation", "raw/\n\n" + block("!*.psd", "*.tif") + "tmp/\n", nil, []string{"*.psd"}, "raw/\n\n" + block("*.tif") + "tmp/\n"},
+		{"drop empty block", "raw/\n\n" + block("*.psd"), nil, []string{"*.psd"}, "raw/\n"},
+		{"outside lines kept", "*.psd\n", nil, []string{"*.psd"}, "*.psd\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UpdateManagedBlock(tt.content, tt.add, tt.remove); got != tt.want {
+				t.Errorf("UpdateManagedBlock() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := GitignoreEntries([]string{"*.psd", "**/*.psd"}, true); !reflect.DeepEqual(got, []string{"!*.psd", "!**/*.psd"}) {
+		t.Errorf("GitignoreEntries() = %v", got)
+	}
+}
+
+// extensionInput is a random file extension for property tests, built from
+// letters of both cases, digits and dots, e.g. 'tar.Gz' or '7z'
+type extensionInput string
+
+func (extensionInput) Generate(r *rand.Rand, size int) reflect.Value {
+	const alphabet = "abcxyzABCXYZ0127."
+	n := 1 + r.Intn(min(size, 8)+1)
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	b[0] = alphabet[r.Intn(len(alphabet)-1)] // Never start with a dot
+	return reflect.ValueOf(extensionInput(b))
+}
+
+// TestExpandPatternProperties checks invariants of ExpandPattern across
+// random extensions and every option combination
+func TestExpandPatternProperties(t *testing.T) {
+	property := func(ext extensionInput, bothCases, allCases, everywhere bool) bool {
+		pattern := string(ext)
+		opts := Options{BothCases: bothCases, AllCases: allCases, Everywhere: everywhere}
+		expanded := ExpandPattern(pattern, opts)
+		lc, uc := strings.ToLower(pattern), strings.ToUpper(pattern)
+
+		// No duplicates
+		seen := make(map[string]bool)
+		for _, p := range expanded {
+			if seen[p] {
+				t.Logf("%q %+v: duplicate %q in %v", pattern, opts, p, expanded)
+				return false
+			}
+			seen[p] = true
+		}
+
+		// The current directory comes first, then the same patterns with **/
+		var local, deep []string
+		for _, p := range expanded {
+			if rest, ok := strings.CutPrefix(p, "**/"); ok {
+				deep = append(deep, rest)
+			} else if len(deep) > 0 {
+				t.Logf("%q %+v: %q follows a **/ pattern in %v", pattern, opts, p, expanded)
+				return false
+			} else {
+				local = append(local, p)
+			}
+		}
+		if everywhere != (len(deep) > 0) || (everywhere && !reflect.DeepEqual(local, deep)) {
+			t.Logf("%q %+v: **/ variants %v do not mirror %v", pattern, opts, deep, local)
+			return false
+		}
+
+		// Case variants exactly when requested, lower case first
+		var want []string
+		switch {
+		case allCases:
+			want = []string{"*." + CaseClassPattern(pattern)}
+		case bothCases && lc != uc:
+			want = []string{"*." + lc, "*." + uc}
+		case bothCases:
+			want = []string{"*." + lc}
+		default:
+			want = []string{"*." + pattern}
+		}
+		if !reflect.DeepEqual(local, want) {
+			t.Logf("%q %+v: got %v, want %v", pattern, opts, local, want)
+			return false
+		}
+
+		// Every requested spelling of a file name is matched at any depth
+		names := []string{pattern}
+		switch {
+		case allCases:
+			names = append(names, lc, uc, mixedCase(pattern))
+		case bothCases:
+			names = []string{lc, uc}
+		}
+		for _, name := range names {
+			for _, dir := range []string{"", "a/", "a/b/"} {
+				matched := false
+				for _, p := range expanded {
+					matched = matched || MatchPath(p, dir+"file."+name)
+				}
+				if !matched {
+					t.Logf("%q %+v: %v does not match %q", pattern, opts, expanded, dir+"file."+name)
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// Extensions without letters have a single case
+	for _, ext := range []extensionInput{"7", "0.1", "mp3"} {
+		for _, everywhere := range []bool{false, true} {
+			if !property(ext, true, false, everywhere) {
+				t.Errorf("property fails for %q", ext)
+			}
+		}
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// mixedCase alternates the case of the letters in s, e.g. 'mp3' becomes 'mP3'
+func mixedCase(s string) string {
+	b := []byte(s)
+	for i := range b {
+		if i%2 == 1 {
+			b[i] = strings.ToUpper(string(b[i]))[0]
+		} else {
+			b[i] = strings.ToLower(string(b[i]))[0]
+		}
+	}
+	return string(b)
+}
+
+// FuzzCaseClassPattern checks that the character classes match both cases
+// and that converting twice changes nothing
+func FuzzCaseClassPattern(f *testing.F) {
+	for _, seed := range []string{"mp3", "tar.gz", "[jt]pg", "7z", "[", "a]b", "Ä"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		class := CaseClassPattern(s)
+		if again := CaseClassPattern(class); again != class {
+			t.Fatalf("CaseClassPattern(%q) = %q, but converting again gives %q", s, class, again)
+		}
+		if strings.ContainsAny(s, "[]*?\\/") || !isASCII(s) {
+			return
+		}
+		for _, name := range []string{s, strings.ToLower(s), strings.ToUpper(s)} {
+			if matched, err := path.Match(class, name); err != nil || !matched {
+				t.Fatalf("CaseClassPattern(%q) = %q does not match %q (err %v)", s, class, name, err)
+			}
+		}
+	})
+}
+
+// FuzzExceptionPatterns checks that subtree exceptions never produce
+// duplicates or redundant **/** segments, and stay inside the subtree
+func FuzzExceptionPatterns(f *testing.F) {
+	for _, seed := range []string{"archive/**", "archive", "/archive/", "archive/*.psd", "a/**/**", "**", "", "a/b/**", "0**/**", "**/**/a"} {
+		f.Add(seed)
+	}
+	expanded := []string{"*.psd", "*.PSD", "**/*.psd", "**/*.PSD"}
+	f.Fuzz(func(t *testing.T, except string) {
+		patterns := ExceptionPatterns(expanded, []string{except, except})
+		seen := make(map[string]bool)
+		for _, p := range patterns {
+			if seen[p] {
+				t.Fatalf("ExceptionPatterns(%q) has duplicate %q: %v", except, p, patterns)
+			}
+			seen[p] = true
+			if p == except {
+				continue
+			}
+			segments := strings.Split(p, "/")
+			for i := 1; i < len(segments); i++ {
+				if segments[i] == "**" && segments[i-1] == "**" {
+					t.Fatalf("ExceptionPatterns(%q) has redundant **/**: %q", except, p)
+				}
+			}
+			if !strings.HasSuffix(p, "/*.psd") && !strings.HasSuffix(p, "/*.PSD") {
+				t.Fatalf("ExceptionPatterns(%q) = %q does not end with an expanded pattern", except, p)
+			}
+		}
+	})
+}
+
+// FuzzMatchPath checks that a leading **/ never changes a match and that an
+// extension pattern matches at any depth
+func FuzzMatchPath(f *testing.F) {
+	f.Add("mp3", "music/song.mp3")
+	f.Add("[mM][pP]3", "song.MP3")
+	f.Add("psd", ".hidden/file.psd")
+	f.Fuzz(func(t *testing.T, ext, p string) {
+		pattern := "*." + ext
+		if MatchPath(pattern, p) != MatchPath("**/"+pattern, p) {
+			t.Fatalf("MatchPath(%q, %q) differs with **/", pattern, p)
+		}
+		if strings.ContainsAny(ext, "[]*?\\/") {
+			return
+		}
+		for _, dir := range []string{"", "d/", ".git-like/", "a/b/"} {
+			if !MatchPath(pattern, dir+"file."+ext) {
+				t.Fatalf("MatchPath(%q, %q) = false", pattern, dir+"file."+ext)
+			}
+		}
+	})
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestParseLsFilesLong tests reading the output of git lfs ls-files -l
+func TestParseLsFilesLong(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	output := oid + " * assets/logo one.psd\n" + oid + " - video.mp4\nnot an entry\n"
+	want := []LongEntry{
+		{OID: oid, Size: -1, Path: "assets/logo one.psd"},
+		{OID: oid, Size: -1, Path: "video.mp4"},
+	}
+	if got := parseLsFilesLong(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLsFilesLong() = %+v, want %+v", got, want)
+	}
+}
+
+// TestCheckoutState tests telling content, pointer files and missing files apart
+func TestCheckoutState(t *testing.T) {
+	dir := t.TempDir()
+	oid := strings.Repeat("b", 64)
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n"
+	os.WriteFile(filepath.Join(dir, "pointer.bin"), []byte(pointer), 0644)
+	os.WriteFile(filepath.Join(dir, "content.bin"), []byte("real content"), 0644)
+
+	entry := LongEntry{OID: oid, Size: -1}
+	if got := checkoutState(filepath.Join(dir, "pointer.bin"), &entry); got != CheckoutPointer || entry.Size != 12345 {
+		t.Errorf("checkoutState(pointer) = %s with size %d", got, entry.Size)
+	}
+	if got := checkoutState(filepath.Join(dir, "content.bin"), &entry); got != CheckoutContent {
+		t.Errorf("checkoutState(content) = %s", got)
+	}
+	if got := checkoutState(filepath.Join(dir, "gone.bin"), &entry); got != CheckoutMissing {
+		t.Errorf("checkoutState(missing) = %s", got)
+	}
+}
+
+// TestPrintLong tests that --null ends each line with NUL and keeps
+// newlines in paths intact
+func TestPrintLong(t *testing.T) {
+	entries := []LongEntry{
+		{OID: strings.Repeat("a", 64), Size: 2048, Path: "a b\nc.psd", Cached: true, Checkout: CheckoutContent},
+		{OID: strings.Repeat("b", 64), Size: -1, Path: "d.psd", Checkout: CheckoutMissing},
+	}
+	var b strings.Builder
+	PrintLong(&b, entries, true)
+	want := strings.Repeat("a", 64) + "      2.0 KB  cached  content  a b\nc.psd\x00" +
+		strings.Repeat("b", 64) + "           ?  absent  missing  d.psd\x00"
+	if b.String() != want {
+		t.Errorf("PrintLong(null) = %q, want %q", b.String(), want)
+	}
+}
+
+// TestGroupByExtension tests grouping files by extension for discovery
+func TestGroupByExtension(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0644)
+		return path
+	}
+	files := []string{
+		write("a.psd", append([]byte{0}, make([]byte, 99)...)),
+		write("b.PSD", []byte{0, 1, 2}),
+		write("notes.txt", []byte("plain text\n")),
+		write("Makefile", []byte("all:\n")),
+	}
+
+	stats, noExtension := GroupByExtension(files)
+	if noExtension != 1 || len(stats) != 2 {
+		t.Fatalf("GroupByExtension() = %d groups, %d without extension", len(stats), noExtension)
+	}
+	psd := stats[0]
+	if psd.Ext != "psd" || psd.Files != 2 || psd.TotalSize != 103 || psd.Largest != 100 || !psd.MixedCases || !psd.MostlyBinary() {
+		t.Errorf("psd group = %+v", *psd)
+	}
+	if txt := stats[1]; txt.Ext != "txt" || txt.MostlyBinary() || txt.MixedCases {
+		t.Errorf("txt group = %+v", *txt)
+	}
+}
+
+// TestApplyAdditions tests finding the oldest commit that added each blob
+func TestApplyAdditions(t *testing.T) {
+	blob := strings.Repeat("c", 40)
+	zero := strings.Repeat("0", 40)
+	log := "commit 2222222222 2024-05-02\n\n" +
+		":100644 100644 " + blob + " " + strings.Repeat("d", 40) + " M\tassets/hero.psd\n" +
+		"commit 1111111111 2024-05-01\n\n" +
+		":000000 100644 " + zero + " " + blob + " A\tassets/hero.psd\n" +
+		":000000 100644 " + zero + " " + strings.Repeat("e", 40) + " A\tother.bin\n"
+	blobs := map[string]*HistoryBlob{blob: {Blob: blob, Size: 5000000, Path: "hero.psd"}}
+	applyAdditions(log, blobs)
+
+	want := HistoryBlob{Blob: blob, Size: 5000000, Path: "assets/hero.psd", Commit: "1111111111", Date: "2024-05-01"}
+	if got := *blobs[blob]; got != want {
+		t.Errorf("applyAdditions() = %+v, want %+v", got, want)
+	}
+}
+
+// TestLFSPatterns tests listing the patterns that .gitattributes tracks with Git LFS
+func TestLFSPatterns(t *testing.T) {
+	content := "# Art\n*.psd filter=lfs diff=lfs merge=lfs -text\n*.txt text\n" +
+		"# *.zip filter=lfs\n\"my file.bin\" filter=lfs\n*.wav -filter=lfs\n"
+	got := LFSPatterns(content)
+	want := []string{"*.psd", "\"my file.bin\""}
+	if len(got) != len(want) {
+		t.Fatalf("LFSPatterns() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("LFSPatterns()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestFetchPattern tests converting .gitattributes patterns to lfs.fetchinclude patterns
+func TestFetchPattern(t *testing.T) {
+	tests := []struct {
+		dir, pattern, want string
+	}{
+		{".", "*.psd", "*.psd"},
+		{".", "assets/**/*.wav", "assets/**/*.wav"},
+		{"art", "*.psd", "art/**/*.psd"},
+		{"art", "/raw/*.tif", "art/raw/*.tif"},
+		{"art", "textures/*.dds", "art/textures/*.dds"},
+		{".", "\"my file.bin\"", "my file.bin"},
+		{".", "a,b.zip", "a?b.zip"},
+	}
+	for _, tt := range tests {
+		if got := fetchPattern(tt.dir, tt.pattern); got != tt.want {
+			t.Errorf("fetchPattern(%q, %q) = %q, want %q", tt.dir, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestCleanAttributes tests removing stale .gitattributes lines after untracking
+func TestCleanAttributes(t *testing.T) {
+	lfs := " filter=lfs diff=lfs merge=lfs -text"
+	untracked := UntrackedSet([]string{"*.zip", "**/*.zip", "*.my file"})
+
+	tests := []struct {
+		name       string
+		content    string
+		want       string
+		removed    int
+		attributes bool
+	}{
+		{"untracked pattern", "*.zip" + lfs + "\n*.psd" + lfs + "\n", "*.psd" + lfs + "\n", 1, true},
+		{"nested form", "**/*.zip" + lfs + "\n", "", 1, false},
+		{"non-LFS line kept", "*.zip -diff\n", "*.zip -diff\n", 0, true},
+		{"empty entry", "*.psd\n*.txt text\n", "*.txt text\n", 1, true},
+		{"last duplicate kept", "*.psd" + lfs + "\n*.psd -text\n*.psd  filter=lfs diff=lfs merge=lfs -text\n",
+			"*.psd -text\n*.psd  filter=lfs diff=lfs merge=lfs -text\n", 1, true},
+		{"quoted pattern", "\"my file.zip\"" + lfs + "\n\"my file.zip\"\n", "\"my file.zip\"" + lfs + "\n", 1, true},
+		{"escaped space", "*.my[[:space:]]file" + lfs + "\n*.psd" + lfs + "\n", "*.psd" + lfs + "\n", 1, true},
+		{"only comments left", "# Assets\n*.zip" + lfs + "\n\n", "# Assets\n", 1, false},
+		{"unchanged", "# Assets\n*.psd" + lfs + "\n", "# Assets\n*.psd" + lfs + "\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed, attributes := CleanAttributes(tt.content, untracked)
+			if got != tt.want || len(removed) != tt.removed || attributes != tt.attributes {
+				t.Errorf("CleanAttributes() = %q, %q, %v; want %q, %d removed, %v", got, removed, attributes, tt.want, tt.removed, tt.attributes)
+			}
+		})
+	}
+}
+
+// TestAttributesRollback tests restoring .gitattributes after a failed run
+func TestAttributesRollback(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".gitattributes")
+	before := "*.psd filter=lfs diff=lfs merge=lfs -text\n"
+	os.WriteFile(file, []byte(before), 0644)
+	failure := errors.New("git lfs track *.bad failed")
+
+	snapshot, err := snapshotFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Rollback(failure, nil); err != failure {
+		t.Errorf("Rollback() of an unchanged file = %v", err)
+	}
+	os.WriteFile(file, []byte(before+"*.png filter=lfs diff=lfs merge=lfs -text\n"), 0644)
+	err = snapshot.Rollback(failure, []string{"*.png"})
+	if data, _ := os.ReadFile(file); string(data) != before {
+		t.Errorf("Rollback() left %q", data)
+	}
+	if err == nil || !strings.Contains(err.Error(), "undoing *.png") {
+		t.Errorf("Rollback() = %v", err)
+	}
+
+	// A file the run created is removed
+	os.Remove(file)
+	if snapshot, err = snapshotFile(file); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(file, []byte("*.png filter=lfs diff=lfs merge=lfs -text\n"), 0644)
+	snapshot.Rollback(failure, []string{"*.png"})
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Rollback() kept the created file: %v", err)
+	}
+
+	var keep *AttributesSnapshot
+	if err := keep.Rollback(failure, []string{"*.png"}); err == nil || !strings.Contains(err.Error(), "--keep-partial") {
+		t.Errorf("Rollback() with --keep-partial = %v", err)
+	}
+}
+
+// TestNormalizeAttributes tests sorting, deduplicating and normalizing the
+// Git LFS lines of .gitattributes
+func TestNormalizeAttributes(t *testing.T) {
+	lfs := " filter=lfs diff=lfs merge=lfs -text"
+
+	tests := []struct {
+		name       string
+		content    string
+		want       string
+		rewritten  int
+		duplicates int
+		reordered  bool
+	}{
+		{"unchanged", "# Assets\n*.png" + lfs + "\n*.psd" + lfs + "\n", "# Assets\n*.png" + lfs + "\n*.psd" + lfs + "\n", 0, 0, false},
+		{"sorted ignoring case", "*.zip" + lfs + "\n*.MP3" + lfs + "\n*.mp3" + lfs + "\n",
+			"*.MP3" + lfs + "\n*.mp3" + lfs + "\n*.zip" + lfs + "\n", 0, 0, true},
+		{"canonical attributes", "*.psd   -text filter=lfs\tmerge=lfs diff=lfs lockable\n*.zip filter=lfs binary\n",
+			"*.psd" + lfs + " lockable\n*.zip" + lfs + "\n", 2, 0, false},
+		{"last duplicate kept", "*.psd" + lfs + "\n*.zip" + lfs + "\n*.psd filter=lfs diff=lfs merge=lfs -text\n",
+			"*.psd" + lfs + "\n*.zip" + lfs + "\n", 0, 1, true},
+		{"runs sorted separately", "# Video\n*.mp4" + lfs + "\n*.avi" + lfs + "\n\n# Images\n*.png" + lfs + "\n*.gif" + lfs + "\n",
+			"# Video\n*.avi" + lfs + "\n*.mp4" + lfs + "\n\n# Images\n*.gif" + lfs + "\n*.png" + lfs + "\n", 0, 0, true},
+		{"other lines stay", "*.zip" + lfs + "\n*.txt text eol=lf\n*.bin" + lfs + "\n*.bin -filter\n",
+			"*.zip" + lfs + "\n*.txt text eol=lf\n*.bin" + lfs + "\n*.bin -filter\n", 0, 0, false},
+		{"quoted pattern", "\"b c.psd\" diff=lfs filter=lfs merge=lfs -text\n\"a b.psd\"" + lfs + "\n",
+			"\"a b.psd\"" + lfs + "\n\"b c.psd\"" + lfs + "\n", 1, 0, true},
+		{"CRLF kept", "*.zip" + lfs + "\r\n*.bin" + lfs + "\r\n", "*.bin" + lfs + "\r\n*.zip" + lfs + "\r\n", 0, 0, true},
+		{"empty", "", "", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := NormalizeAttributes(tt.content)
+			if got != tt.want || n.Rewritten != tt.rewritten || len(n.Duplicates) != tt.duplicates || n.Reordered != tt.reordered {
+				t.Errorf("NormalizeAttributes() = %q, %+v; want %q, %d rewritten, %d duplicates, reordered %v",
+					got, n, tt.want, tt.rewritten, tt.duplicates, tt.reordered)
+			}
+			if again, n := NormalizeAttributes(got); again != got || n.Changed() {
+				t.Errorf("NormalizeAttributes() is not idempotent: %q became %q", got, again)
+			}
+		})
+	}
+}
+
+// TestParseTreeBlobs tests reading committed files from git ls-tree -l output
+func TestParseTreeBlobs(t *testing.T) {
+	output := "100644 blob aaa     132\tpointer.psd\x00" +
+		"100644 blob bbb 5242880\tmedia/big file.psd\x00" +
+		"100644 blob ccc       0\tempty.psd\x00" +
+		"120000 blob ddd      11\tlink.psd\x00" +
+		"160000 commit eee       -\tvendor/lib\x00"
+	want := []CommittedFile{
+		{Path: "pointer.psd", Blob: "aaa", Size: 132},
+		{Path: "media/big file.psd", Blob: "bbb", Size: 5242880},
+	}
+	if got := parseTreeBlobs(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTreeBlobs() = %+v, want %+v", got, want)
+	}
+}
+
+// TestExpandPresets tests replacing @NAME by the extensions of a preset
+func TestExpandPresets(t *testing.T) {
+	configured := parsePresetConfig("lfs-scripts.preset.textures tga, dds exr\n" +
+		"lfs-scripts.preset.video *.mp4 .mov\n" +
+		"lfs-scripts.preset.textures psd\n" +
+		"user.name someone\n")
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"built-in", []string{"@audio"}, Presets["audio"]},
+		{"video", []string{"@video"}, []string{"mp4", "mov"}},
+		{"configured", []string{"@Textures"}, []string{"tga", "dds", "exr", "psd"}},
+		{"mixed without duplicates", []string{"zip", "@textures", "tga", "@fonts"}, append([]string{"zip", "tga", "dds", "exr", "psd"}, Presets["fonts"]...)},
+		{"no preset", []string{"*.bin", "data/**"}, []string{"*.bin", "data/**"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPresets(tt.patterns, configured)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandPresets(%v) = %v, %v, want %v", tt.patterns, got, err, tt.want)
+			}
+		})
+	}
+
+	if got, _ := expandPresets([]string{"@video"}, nil); !reflect.DeepEqual(got, []string{"mp4", "mov", "avi", "mkv", "webm"}) {
+		t.Errorf("expandPresets(@video) = %v", got)
+	}
+	if _, err := expandPresets([]string{"@nope"}, configured); err == nil || !strings.Contains(err.Error(), "@textures") {
+		t.Errorf("expandPresets(@nope) error = %v, want the known presets listed", err)
+	}
+}
+
+// TestPatternWarnings tests detecting patterns that wildmatch treats unexpectedly
+func TestPatternWarnings(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		warnings int
+		contains string
+	}{
+		{"*.psd", 0, ""},
+		{"media/**/*.psd", 0, ""},
+		{"archive/**", 0, ""},
+		{"/media/*.psd", 1, "leading '/'"},
+		{"!*.psd", 1, "negative"},
+		{"#raw/*.psd", 1, "comment"},
+		{"my file.psd", 1, "[[:space:]]"},
+		{`media\*.psd`, 1, "escapes"},
+		{"media/", 1, "DIR/**"},
+		{"media**/*.psd", 1, "acts like '*'"},
+		{"media/**.psd", 1, "acts like '*'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			warnings := PatternWarnings(tt.pattern)
+			if len(warnings) != tt.warnings || (tt.contains != "" && !strings.Contains(warnings[0], tt.contains)) {
+				t.Errorf("PatternWarnings(%q) = %q, want %d warning(s) containing %q", tt.pattern, warnings, tt.warnings, tt.contains)
+			}
+		})
+	}
+}
+
+// TestCheckPatterns tests the warnings about extension arguments and --path directories
+func TestCheckPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		paths    []string
+		want     []string // Start of each warning
+	}{
+		{"plain", []string{"psd", "mp4"}, []string{"media", "/assets"}, nil},
+		{"glob given", []string{"*.psd"}, nil, []string{"'*.psd': it expands to '*.*.psd'"}},
+		{"dot given", []string{".psd"}, nil, []string{"'.psd': it expands to '*..psd'"}},
+		{"directory in extension", []string{"raw/psd"}, nil, []string{"'raw/psd': an extension cannot contain '/'"}},
+		{"comment directory", []string{"psd"}, []string{"#raw"}, []string{"--path '#raw': a line starting with '#'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckPatterns(tt.patterns, Options{Paths: tt.paths})
+			if len(got) != len(tt.want) {
+				t.Fatalf("CheckPatterns() = %q, want %d warnings", got, len(tt.want))
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(got[i], prefix) {
+					t.Errorf("warning %d = %q, want it to start with %q", i, got[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+// TestEscapeAttributesPattern tests escaping patterns for .gitattributes lines
+func TestEscapeAttributesPattern(t *testing.T) {
+	tests := map[string]string{
+		"*.psd":          "*.psd",
+		"*.my file":      "*.my[[:space:]]file",
+		"a b\tc/*.psd":   "a[[:space:]]b[[:space:]]c/*.psd",
+		"#raw/*.psd":     `\#raw/*.psd`,
+		"media/#1/*.psd": "media/#1/*.psd",
+	}
+	for pattern, want := range tests {
+		if got := EscapeAttributesPattern(pattern); got != want {
+			t.Errorf("EscapeAttributesPattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+// TestSelectPointers tests selecting pointers with --include and --exclude patterns
+func TestSelectPointers(t *testing.T) {
+	var pointers []lfspointer.Pointer
+	for _, p := range []string{"assets/video/intro.mp4", "assets/textures/wall.png", "docs/logo.png", "logo.psd"} {
+		pointers = append(pointers, lfspointer.Pointer{Path: p})
+	}
+	tests := []struct {
+		name               string
+		includes, excludes []string
+		want               []string
+	}{
+		{"everything", nil, nil, []string{"assets/video/intro.mp4", "assets/textures/wall.png", "docs/logo.png", "logo.psd"}},
+		{"directory", []string{"assets"}, nil, []string{"assets/video/intro.mp4", "assets/textures/wall.png"}},
+		{"glob", []string{"*.png"}, nil, []string{"assets/textures/wall.png", "docs/logo.png"}},
+		{"exclude directory", nil, []string{"assets/video/"}, []string{"assets/textures/wall.png", "docs/logo.png", "logo.psd"}},
+		{"include and exclude", []string{"assets/**"}, []string{"*.mp4"}, []string{"assets/textures/wall.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, pointer := range SelectPointers(pointers, tt.includes, tt.excludes) {
+				got = append(got, pointer.Path)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("SelectPointers(%q, %q) = %q, want %q", tt.includes, tt.excludes, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEscapeFetchPattern tests escaping paths for --include patterns
+func TestEscapeFetchPattern(t *testing.T) {
+	tests := map[string]string{
+		"assets/intro.mp4":  "assets/intro.mp4",
+		"shots/take[1].mov": `shots/take\[1\].mov`,
+		"what?*.wav":        `what\?\*.wav`,
+		"a,b.psd":           "a?b.psd",
+	}
+	for path, want := range tests {
+		if got := EscapeFetchPattern(path); got != want {
+			t.Errorf("EscapeFetchPattern(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
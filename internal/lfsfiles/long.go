@@ -0,0 +1,140 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// Checkout states of an LFS file in the working tree
+const (
+	CheckoutContent = "content" // The real content is checked out
+	CheckoutPointer = "pointer" // Only the pointer file is checked out
+	CheckoutMissing = "missing" // The file is not in the working tree
+)
+
+// LongEntry is one LFS file as listed by git-lfs-files --long
+type LongEntry struct {
+	OID      string
+	Size     int64 // -1 when the pointer could not be read
+	Path     string
+	Cached   bool   // The object is in local LFS storage
+	Checkout string // CheckoutContent, CheckoutPointer or CheckoutMissing
+}
+
+// parseLsFilesLong reads the output of 'git lfs ls-files -l', whose lines
+// look like 'OID * PATH' (content checked out) or 'OID - PATH' (pointer)
+func parseLsFilesLong(output string) []LongEntry {
+	var entries []LongEntry
+	for _, line := range strings.Split(output, "\n") {
+		oid, rest, found := strings.Cut(line, " ")
+		if !found || len(oid) != 64 || len(rest) < 3 || rest[1] != ' ' {
+			continue
+		}
+		entries = append(entries, LongEntry{OID: oid, Size: -1, Path: rest[2:]})
+	}
+	return entries
+}
+
+// ListLong lists the LFS files of HEAD that match any expanded pattern, or
+// all of them when there are none, with their oid, size, local storage
+// presence and checkout state. Sizes come from the pointer files in HEAD.
+func ListLong(expanded []string) ([]LongEntry, error) {
+	output, err := exec.Command("git", "lfs", "ls-files", "-l").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git lfs ls-files -l failed: %v", err)
+	}
+	toplevel, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-parse failed: %v", err)
+	}
+	storage, err := lfspointer.LocalStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	if pointers, err := lfspointer.ListTree("HEAD"); err == nil {
+		for _, p := range pointers {
+			sizes[p.Path] = p.Size
+		}
+	}
+
+	var entries []LongEntry
+	for _, entry := range parseLsFilesLong(string(output)) {
+		if !matchAny(expanded, entry.Path) {
+			continue
+		}
+		if size, ok := sizes[entry.Path]; ok {
+			entry.Size = size
+		}
+		if _, err := os.Stat(lfspointer.ObjectPath(storage, entry.OID)); err == nil {
+			entry.Cached = true
+		}
+		entry.Checkout = checkoutState(filepath.Join(strings.TrimSpace(string(toplevel)), entry.Path), &entry)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// checkoutState inspects a working tree file; a pointer file also supplies
+// the size when HEAD did not
+func checkoutState(path string, entry *LongEntry) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return CheckoutMissing
+	}
+	if info.Size() > lfspointer.MaxPointerSize {
+		return CheckoutContent
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CheckoutMissing
+	}
+	pointer, ok := lfspointer.Parse(data)
+	if !ok {
+		return CheckoutContent
+	}
+	if entry.Size < 0 && pointer.OID == entry.OID {
+		entry.Size = pointer.Size
+	}
+	return CheckoutPointer
+}
+
+func matchAny(expanded []string, path string) bool {
+	if len(expanded) == 0 {
+		return true
+	}
+	for _, pattern := range expanded {
+		if MatchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintLong writes one line per entry: oid, size, storage presence,
+// checkout state and path. With null, lines end with NUL instead of newline.
+func PrintLong(w io.Writer, entries []LongEntry, null bool) {
+	end := "\n"
+	if null {
+		end = "\x00"
+	}
+	for _, e := range entries {
+		size := "?"
+		if e.Size >= 0 {
+			size = common.FormatSize(e.Size)
+		}
+		cached := "absent"
+		if e.Cached {
+			cached = "cached"
+		}
+		fmt.Fprintf(w, "%s  %10s  %-6s  %-7s  %s%s", e.OID, size, cached, e.Checkout, e.Path, end)
+	}
+}
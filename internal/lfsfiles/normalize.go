@@ -0,0 +1,186 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// lfsAttributes are the attributes of a Git LFS line, in the order git lfs
+// track writes them
+var lfsAttributes = []string{"filter=lfs", "diff=lfs", "merge=lfs", "-text"}
+
+// AttributesNormalization is the result of normalizing one .gitattributes file
+type AttributesNormalization struct {
+	Path       string   // Relative to the top of the working tree
+	Rewritten  int      // Git LFS lines whose attributes or spacing changed
+	Duplicates []string // Repeated Git LFS lines removed, as they were written
+	Reordered  bool     // Git LFS lines were sorted
+}
+
+// Changed reports whether normalizing changed the file
+func (n AttributesNormalization) Changed() bool {
+	return n.Rewritten > 0 || len(n.Duplicates) > 0 || n.Reordered
+}
+
+// String describes the changes, e.g. "2 lines rewritten, sorted"
+func (n AttributesNormalization) String() string {
+	var changes []string
+	if n.Rewritten == 1 {
+		changes = append(changes, "1 line rewritten")
+	} else if n.Rewritten > 1 {
+		changes = append(changes, fmt.Sprintf("%d lines rewritten", n.Rewritten))
+	}
+	if len(n.Duplicates) == 1 {
+		changes = append(changes, "1 duplicate removed")
+	} else if len(n.Duplicates) > 1 {
+		changes = append(changes, fmt.Sprintf("%d duplicates removed", len(n.Duplicates)))
+	}
+	if n.Reordered {
+		changes = append(changes, "sorted")
+	}
+	if len(changes) == 0 {
+		return "already normalized"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// canonicalAttributes returns the attributes of a Git LFS line as git lfs
+// track writes them, followed by its other attributes such as lockable.
+// Settings of filter, diff, merge and text, and the binary macro, which
+// would override them, are dropped.
+func canonicalAttributes(attrs []string) []string {
+	canonical := slices.Clone(lfsAttributes)
+	for _, attr := range attrs {
+		name, _, _ := strings.Cut(strings.TrimLeft(attr, "-!"), "=")
+		switch name {
+		case "filter", "diff", "merge", "text", "binary":
+			continue
+		}
+		if !slices.Contains(canonical, attr) {
+			canonical = append(canonical, attr)
+		}
+	}
+	return canonical
+}
+
+// NormalizeAttributes rewrites the Git LFS lines of .gitattributes content
+// so that the file diffs cleanly: each gets the attributes git lfs track
+// writes, separated by single spaces; repeated lines are removed, keeping
+// the last because later lines take precedence; and each run of
+// consecutive Git LFS lines is sorted by pattern. Comments, blank lines and
+// other lines stay where they are, and Git LFS lines are not moved across
+// them, so the precedence between the two is unchanged.
+func NormalizeAttributes(content string) (string, AttributesNormalization) {
+	var n AttributesNormalization
+	if content == "" {
+		return content, n
+	}
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.TrimRight(content, "\r\n"), "\n")
+
+	// The normalized form of each Git LFS line, and where it last occurs
+	normalized := make([]string, len(lines))
+	patterns := make([]string, len(lines))
+	last := make(map[string]int)
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+		pattern, attrs := splitAttributesLine(lines[i])
+		if pattern == "" || strings.HasPrefix(pattern, "#") || !hasLFSFilter(attrs) {
+			continue
+		}
+		patterns[i] = pattern
+		normalized[i] = strings.Join(append([]string{pattern}, canonicalAttributes(attrs)...), " ")
+		last[normalized[i]] = i
+	}
+
+	var result []string
+	var run []int // Indexes of the current run of Git LFS lines
+	flush := func() {
+		sorted := slices.Clone(run)
+		slices.SortStableFunc(sorted, func(a, b int) int {
+			return comparePatterns(patterns[a], patterns[b])
+		})
+		if !slices.Equal(sorted, run) {
+			n.Reordered = true
+		}
+		for _, i := range sorted {
+			result = append(result, normalized[i])
+		}
+		run = run[:0]
+	}
+	for i, line := range lines {
+		if normalized[i] == "" {
+			flush()
+			result = append(result, line)
+			continue
+		}
+		if last[normalized[i]] != i {
+			n.Duplicates = append(n.Duplicates, line)
+			continue
+		}
+		if line != normalized[i] {
+			n.Rewritten++
+		}
+		run = append(run, i)
+	}
+	flush()
+
+	if !n.Changed() {
+		return content, n
+	}
+	return strings.Join(result, newline) + newline, n
+}
+
+// comparePatterns orders patterns alphabetically ignoring case, so that
+// *.mp3 and *.MP3 are next to each other, then by byte value
+func comparePatterns(a, b string) int {
+	if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// NormalizeAttributesFiles applies NormalizeAttributes to the .gitattributes
+// at the top of the working tree, and with everywhere to every nested one
+// too. It returns the files that changed. With dryRun nothing is written
+// and the changes are printed instead.
+func NormalizeAttributesFiles(everywhere, dryRun bool) ([]AttributesNormalization, error) {
+	top, files, err := attributesFiles(everywhere)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalizations []AttributesNormalization
+	for _, file := range files {
+		path := filepath.Join(top, file)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return normalizations, err
+		}
+
+		normalized, n := NormalizeAttributes(string(data))
+		if !n.Changed() {
+			continue
+		}
+		n.Path = file
+		normalizations = append(normalizations, n)
+
+		if dryRun {
+			fmt.Printf("DRY RUN: normalize %s: %s\n", file, n)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(normalized), 0644); err != nil {
+			return normalizations, err
+		}
+	}
+	return normalizations, nil
+}
@@ -0,0 +1,124 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// presetPrefix marks a pattern argument that names a preset, e.g. @video
+const presetPrefix = "@"
+
+// presetConfig is the git config section holding user presets:
+// git config lfs-scripts.preset.textures "tga dds exr"
+const presetConfig = "lfs-scripts.preset."
+
+// Presets are the built-in groups of extensions that @NAME stands for
+var Presets = map[string][]string{
+	"3d":        {"fbx", "obj", "blend", "glb", "gltf", "usd", "usdz", "max", "ma", "mb", "c4d"},
+	"archives":  {"zip", "7z", "rar", "tar", "gz", "tgz", "bz2", "xz", "iso", "dmg"},
+	"audio":     {"mp3", "wav", "flac", "aac", "ogg", "m4a", "aif", "aiff", "wma"},
+	"cad":       {"dwg", "dxf", "step", "stp", "iges", "igs", "stl", "3dm", "sldprt", "sldasm", "ipt", "iam", "f3d", "skp"},
+	"fonts":     {"ttf", "otf", "woff", "woff2", "eot"},
+	"images":    {"png", "jpg", "jpeg", "gif", "bmp", "tif", "tiff", "psd", "webp", "heic", "exr", "tga", "dds", "raw"},
+	"ml-models": {"onnx", "pt", "pth", "ckpt", "safetensors", "h5", "pb", "tflite", "gguf", "pkl", "joblib"},
+	"video":     {"mp4", "mov", "avi", "mkv", "webm"},
+}
+
+// ExpandPresets replaces every @NAME argument by the extensions of that
+// preset, defined by git config lfs-scripts.preset.NAME or built in. Other
+// patterns are kept, and each extension appears once.
+func ExpandPresets(patterns []string) ([]string, error) {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, presetPrefix) {
+			return expandPresets(patterns, configuredPresets())
+		}
+	}
+	return patterns, nil
+}
+
+// expandPresets expands presets with configured ones taking precedence over
+// the built-in ones of the same name
+func expandPresets(patterns []string, configured map[string][]string) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			expanded = append(expanded, pattern)
+		}
+	}
+	for _, pattern := range patterns {
+		name, isPreset := strings.CutPrefix(pattern, presetPrefix)
+		if !isPreset {
+			add(pattern)
+			continue
+		}
+		extensions, ok := configured[strings.ToLower(name)]
+		if !ok {
+			extensions, ok = Presets[strings.ToLower(name)]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown preset '%s'; presets are %s", pattern, strings.Join(PresetNames(configured), ", "))
+		}
+		for _, ext := range extensions {
+			add(ext)
+		}
+	}
+	return expanded, nil
+}
+
+// configuredPresets reads the presets defined in git config. A value lists
+// extensions separated by spaces or commas; several values add up.
+func configuredPresets() map[string][]string {
+	output, _ := exec.Command("git", "config", "--get-regexp", `^lfs-scripts\.preset\.`).Output()
+	return parsePresetConfig(string(output))
+}
+
+// parsePresetConfig parses 'git config --get-regexp' output, whose lines
+// are KEY SP VALUE with the key in lower case
+func parsePresetConfig(output string) map[string][]string {
+	presets := make(map[string][]string)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		name, ok := strings.CutPrefix(key, presetConfig)
+		if !ok || name == "" {
+			continue
+		}
+		for _, ext := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+			presets[name] = append(presets[name], strings.TrimPrefix(strings.TrimPrefix(ext, "*"), "."))
+		}
+	}
+	return presets
+}
+
+// PresetNames returns the names of the built-in and configured presets,
+// sorted and each prefixed with @
+func PresetNames(configured map[string][]string) []string {
+	var names []string
+	for name := range Presets {
+		names = append(names, presetPrefix+name)
+	}
+	for name := range configured {
+		if _, builtin := Presets[name]; !builtin {
+			names = append(names, presetPrefix+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presetHelp lists the presets for help text, configured ones included
+func presetHelp() string {
+	configured := configuredPresets()
+	var b strings.Builder
+	for _, name := range PresetNames(configured) {
+		extensions, ok := configured[name[1:]]
+		if !ok {
+			extensions = Presets[name[1:]]
+		}
+		fmt.Fprintf(&b, "  %-12s %s\n", name, strings.Join(extensions, " "))
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package lfsfiles
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// attributesSpace is how git lfs track writes a space in a .gitattributes
+// pattern, whose fields are separated by whitespace
+const attributesSpace = "[[:space:]]"
+
+// PatternWarnings returns the ways a pattern would behave unexpectedly as a
+// line of .gitattributes, where Git matches it with wildmatch
+func PatternWarnings(pattern string) []string {
+	var warnings []string
+	if strings.HasPrefix(pattern, "/") {
+		warnings = append(warnings, "a leading '/' anchors the pattern to the directory of its .gitattributes, "+
+			"and Git Bash on Windows turns it into a file system path")
+	}
+	if strings.HasPrefix(pattern, "!") {
+		warnings = append(warnings, "negative patterns are not allowed in .gitattributes; Git ignores the line")
+	}
+	if strings.HasPrefix(pattern, "#") {
+		warnings = append(warnings, "a line starting with '#' is a comment; it is written as '\\#'")
+	}
+	if strings.ContainsFunc(pattern, unicode.IsSpace) {
+		warnings = append(warnings, "whitespace separates the pattern from its attributes; it is written as "+attributesSpace)
+	}
+	if strings.Contains(pattern, `\`) {
+		warnings = append(warnings, "'\\' escapes the next character; separate directories with '/'")
+	}
+	if strings.HasSuffix(pattern, "/") {
+		warnings = append(warnings, "a pattern ending in '/' matches no file in .gitattributes; use DIR/** for a directory")
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment != "**" && strings.Contains(segment, "**") {
+			warnings = append(warnings, fmt.Sprintf("'**' in '%s' acts like '*'; it only matches across directories as a whole segment, as in '**/' or '/**'", segment))
+			break
+		}
+	}
+	return warnings
+}
+
+// ExtensionWarnings returns the ways an extension argument of the pattern
+// commands would expand to patterns matching something else than intended
+func ExtensionWarnings(ext string) []string {
+	var warnings []string
+	switch {
+	case strings.HasPrefix(ext, "*."):
+		warnings = append(warnings, fmt.Sprintf("it expands to '*.%s'; give the extension alone, as '%s'", ext, ext[2:]))
+	case strings.HasPrefix(ext, "."):
+		warnings = append(warnings, fmt.Sprintf("it expands to '*.%s'; give the extension without the dot, as '%s'", ext, ext[1:]))
+	}
+	if strings.Contains(ext, "/") {
+		warnings = append(warnings, "an extension cannot contain '/'; use --path to anchor the patterns to a directory")
+	}
+	// The extension ends up inside *.EXT, where a leading '/', '!' or '#'
+	// is not special
+	warnings = append(warnings, PatternWarnings("*."+ext)...)
+	return warnings
+}
+
+// CheckPatterns returns the warnings about the extension arguments and the
+// --path directories of a pattern command, each prefixed by its argument
+func CheckPatterns(patterns []string, opts Options) []string {
+	var warnings []string
+	for _, pattern := range patterns {
+		for _, warning := range ExtensionWarnings(pattern) {
+			warnings = append(warnings, fmt.Sprintf("'%s': %s", pattern, warning))
+		}
+	}
+	for _, dir := range opts.Paths {
+		// AnchorPatterns drops a leading '/'
+		for _, warning := range PatternWarnings(strings.TrimLeft(dir, "/") + "/*") {
+			warnings = append(warnings, fmt.Sprintf("--path '%s': %s", dir, warning))
+		}
+	}
+	return warnings
+}
+
+// EscapeAttributesPattern escapes a pattern for a .gitattributes line the
+// way git lfs track does: whitespace becomes [[:space:]] and a leading '#'
+// is escaped so that the line is not a comment
+func EscapeAttributesPattern(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		if unicode.IsSpace(r) {
+			b.WriteString(attributesSpace)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	escaped := b.String()
+	if strings.HasPrefix(escaped, "#") {
+		escaped = `\` + escaped
+	}
+	return escaped
+}
+
+// EscapeAttributesPatterns applies EscapeAttributesPattern to each pattern
+func EscapeAttributesPatterns(patterns []string) []string {
+	escaped := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		escaped[i] = EscapeAttributesPattern(pattern)
+	}
+	return escaped
+}
@@ -0,0 +1,65 @@
+package lfspointer
+
+import "sort"
+
+// Change is a pointer file that differs between two trees
+type Change struct {
+	Path string
+	From *Pointer // Nil when the file was added
+	To   *Pointer // Nil when the file was removed
+}
+
+// Comparison is the difference between the pointer files of two trees
+type Comparison struct {
+	Added     []Change
+	Removed   []Change
+	Changed   []Change // Same path, different object
+	Unchanged int
+
+	// Objects referenced by the second tree but not by the first: what
+	// switching from one to the other downloads. Each oid is listed once.
+	Transfer []Pointer
+}
+
+// Compare compares the pointer files of two trees by path, sorting each
+// kind of change by path
+func Compare(from, to []Pointer) Comparison {
+	var c Comparison
+	fromPaths := make(map[string]*Pointer, len(from))
+	fromOIDs := make(map[string]bool, len(from))
+	for i := range from {
+		fromPaths[from[i].Path] = &from[i]
+		fromOIDs[from[i].OID] = true
+	}
+
+	toPaths := make(map[string]bool, len(to))
+	transferred := make(map[string]bool)
+	for i := range to {
+		p := &to[i]
+		toPaths[p.Path] = true
+		old, existed := fromPaths[p.Path]
+		switch {
+		case !existed:
+			c.Added = append(c.Added, Change{Path: p.Path, To: p})
+		case old.OID != p.OID:
+			c.Changed = append(c.Changed, Change{Path: p.Path, From: old, To: p})
+		default:
+			c.Unchanged++
+		}
+		if !fromOIDs[p.OID] && !transferred[p.OID] {
+			transferred[p.OID] = true
+			c.Transfer = append(c.Transfer, *p)
+		}
+	}
+	for i := range from {
+		if !toPaths[from[i].Path] {
+			c.Removed = append(c.Removed, Change{Path: from[i].Path, From: &from[i]})
+		}
+	}
+
+	for _, changes := range [][]Change{c.Added, c.Removed, c.Changed} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	}
+	sort.Slice(c.Transfer, func(i, j int) bool { return c.Transfer[i].OID < c.Transfer[j].OID })
+	return c
+}
@@ -0,0 +1,394 @@
+package lfspointer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxPointerSize is the largest blob considered a possible pointer file;
+// the Git LFS specification limits pointers to 1024 bytes
+const MaxPointerSize = 1024
+
+// specPrefix is the first line of every Git LFS pointer file
+const specPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// oidPattern matches a Git LFS object id: a SHA-256 in lower case hex
+var oidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidOID reports whether oid is a Git LFS object id. Paths and URLs are
+// built from object ids, so anything else must be refused.
+func ValidOID(oid string) bool {
+	return oidPattern.MatchString(oid)
+}
+
+// Pointer is a Git LFS pointer file found in a Git tree
+type Pointer struct {
+	OID  string // SHA-256 of the object content (hex, without the sha256: prefix)
+	Size int64  // Size of the object content in bytes
+	Path string // Path of the pointer file in the tree
+	Blob string // Git blob id of the pointer file
+}
+
+// Parse parses the content of a pointer file
+func Parse(data []byte) (Pointer, bool) {
+	if len(data) > MaxPointerSize || !bytes.HasPrefix(data, []byte(specPrefix)) {
+		return Pointer{}, false
+	}
+
+	var p Pointer
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "oid":
+			p.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Pointer{}, false
+			}
+			p.Size = size
+		}
+	}
+
+	if len(p.OID) != 64 {
+		return Pointer{}, false
+	}
+	return p, true
+}
+
+// treeEntry is a small blob listed by git ls-tree
+type treeEntry struct {
+	blob string
+	path string
+}
+
+// ListTree returns the pointer files in the tree of ref
+func ListTree(ref string) ([]Pointer, error) {
+	return ListTreeIn("", ref)
+}
+
+// ListTreeIn returns the pointer files in the tree of ref in the repository
+// at dir, or in the current one when dir is empty
+func ListTreeIn(dir, ref string) ([]Pointer, error) {
+	cmd := exec.Command("git", "ls-tree", "-r", "-l", "-z", "--full-tree", ref)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree %s failed: %v", ref, err)
+	}
+
+	var candidates []treeEntry
+	for _, record := range strings.Split(string(output), "\x00") {
+		// Format: MODE SP TYPE SP OBJECT SP SIZE TAB PATH
+		meta, path, found := strings.Cut(record, "\t")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size > MaxPointerSize {
+			continue
+		}
+		candidates = append(candidates, treeEntry{blob: fields[2], path: path})
+	}
+
+	return readPointers(dir, candidates)
+}
+
+// ListRefs returns the pointers in the trees of all refs, keeping the first
+// path seen for each distinct oid
+func ListRefs(refs []string) ([]Pointer, error) {
+	seen := make(map[string]bool)
+	var pointers []Pointer
+	for _, ref := range refs {
+		found, err := ListTree(ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			if !seen[p.OID] {
+				seen[p.OID] = true
+				pointers = append(pointers, p)
+			}
+		}
+	}
+	return pointers, nil
+}
+
+// AllRefs returns HEAD and the full names of every local branch, tag and
+// remote-tracking branch, so that objects only referenced by a remote's
+// branches count too. The symbolic refs/remotes/*/HEAD are left out.
+func AllRefs() ([]string, error) {
+	output, err := exec.Command("git", "for-each-ref", "--format=%(refname)", "refs/heads", "refs/tags", "refs/remotes").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %v", err)
+	}
+	refs := []string{"HEAD"}
+	for _, ref := range strings.Fields(string(output)) {
+		if !strings.HasSuffix(ref, "/HEAD") {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// Reachable returns the pointers in every blob reachable from any ref or
+// reflog entry. Unlike Added, it also finds pointers that only merge commits
+// introduced, so it is safe to decide what may be deleted from it.
+func Reachable() ([]Pointer, error) {
+	return ReachableIn("")
+}
+
+// ReachableIn is Reachable for the repository at dir, or the current one
+// when dir is empty
+func ReachableIn(dir string) ([]Pointer, error) {
+	return ReachableFromIn(dir, []string{"--all", "--reflog"})
+}
+
+// ReachableFrom returns the pointers in every blob reachable from revs,
+// which may also be rev-list options such as --branches
+func ReachableFrom(revs []string) ([]Pointer, error) {
+	return ReachableFromIn("", revs)
+}
+
+// ReachableFromIn is ReachableFrom for the repository at dir, or the
+// current one when dir is empty
+func ReachableFromIn(dir string, revs []string) ([]Pointer, error) {
+	cmd := exec.Command("git", append([]string{"rev-list", "--objects"}, revs...)...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list failed: %v", err)
+	}
+
+	// Lines are OBJECT or OBJECT SP PATH; only blobs have a path worth keeping
+	paths := make(map[string]string)
+	var input bytes.Buffer
+	for _, line := range strings.Split(string(output), "\n") {
+		object, path, _ := strings.Cut(line, " ")
+		if object == "" {
+			continue
+		}
+		if _, seen := paths[object]; !seen {
+			paths[object] = path
+			input.WriteString(object + "\n")
+		}
+	}
+
+	cmd = exec.Command("git", "cat-file", "--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	cmd.Dir = dir
+	cmd.Stdin = &input
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %v", err)
+	}
+	return readPointers(dir, smallBlobs(string(output), paths))
+}
+
+// FromBlobs returns the pointers among blobs of the current repository,
+// which map blob ids to the path each was found at
+func FromBlobs(blobs map[string]string) ([]Pointer, error) {
+	entries := make([]treeEntry, 0, len(blobs))
+	for blob, path := range blobs {
+		entries = append(entries, treeEntry{blob: blob, path: path})
+	}
+	return readPointers("", entries)
+}
+
+// smallBlobs picks the blobs small enough to be pointers from git cat-file
+// --batch-check output
+func smallBlobs(batchCheck string, paths map[string]string) []treeEntry {
+	var candidates []treeEntry
+	for _, line := range strings.Split(batchCheck, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		if size, err := strconv.Atoi(fields[2]); err == nil && size <= MaxPointerSize {
+			candidates = append(candidates, treeEntry{blob: fields[0], path: paths[fields[0]]})
+		}
+	}
+	return candidates
+}
+
+// readPointers reads candidate blobs of the repository at dir with git
+// cat-file --batch and keeps the pointers
+func readPointers(dir string, entries []treeEntry) ([]Pointer, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	var input bytes.Buffer
+	for _, e := range entries {
+		input.WriteString(e.blob + "\n")
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	cmd.Stdin = &input
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %v", err)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(output))
+	var pointers []Pointer
+	for _, e := range entries {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unexpected end of git cat-file output")
+		}
+		// Header: OBJECT SP TYPE SP SIZE, or OBJECT SP missing
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.Atoi(fields[2])
+		content := make([]byte, size+1) // Content is followed by a newline
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("failed to read blob %s: %v", e.blob, err)
+		}
+		if p, ok := Parse(content[:size]); ok {
+			p.Path = e.path
+			p.Blob = e.blob
+			pointers = append(pointers, p)
+		}
+	}
+	return pointers, nil
+}
+
+// Added returns the pointers added or modified by commits since the given
+// date (any git approxidate such as "30 days ago") on the given refs; an
+// empty since covers the whole history
+func Added(since string, refs []string) ([]Pointer, error) {
+	args := []string{"log", "--format=", "-p", "--no-textconv", "--no-ext-diff", "--diff-filter=AM", "--no-renames"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	args = append(args, refs...)
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v", err)
+	}
+	return parseAddedPointers(string(output)), nil
+}
+
+// parseAddedPointers extracts pointers from the added lines of a patch
+func parseAddedPointers(patch string) []Pointer {
+	seen := make(map[string]bool)
+	var pointers []Pointer
+	var current Pointer
+	path := ""
+
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ b/"):
+			path = strings.TrimPrefix(line, "+++ b/")
+			current = Pointer{}
+		case strings.HasPrefix(line, "+oid sha256:"):
+			current.OID = strings.TrimPrefix(line, "+oid sha256:")
+		case strings.HasPrefix(line, "+size "):
+			size, err := strconv.ParseInt(strings.TrimPrefix(line, "+size "), 10, 64)
+			if err == nil && len(current.OID) == 64 && !seen[current.OID] {
+				seen[current.OID] = true
+				pointers = append(pointers, Pointer{OID: current.OID, Size: size, Path: path})
+			}
+			current = Pointer{}
+		}
+	}
+	return pointers
+}
+
+// Reference is a commit whose pointer file adds or changes an object
+type Reference struct {
+	Commit string // Abbreviated hash, date and subject
+	Path   string
+}
+
+// References returns, for each of the oids, the commits reachable from refs
+// whose pointer files add or change it, newest first
+func References(refs []string, oids map[string]bool) (map[string][]Reference, error) {
+	args := []string{"log", "--format=commit %h %cs %s", "-p", "--no-textconv", "--no-ext-diff", "--diff-filter=AM", "--no-renames"}
+	output, err := exec.Command("git", append(append(args, refs...), "--")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v", err)
+	}
+	return parseReferences(string(output), oids), nil
+}
+
+// parseReferences reads the output of git log -p with a 'commit %h %cs %s'
+// format. Patch lines never start with 'commit ', so those lines are commits.
+func parseReferences(log string, oids map[string]bool) map[string][]Reference {
+	references := make(map[string][]Reference)
+	commit, path := "", ""
+	for _, line := range strings.Split(log, "\n") {
+		switch {
+		case strings.HasPrefix(line, "commit "):
+			commit = strings.TrimPrefix(line, "commit ")
+		case strings.HasPrefix(line, "+++ b/"):
+			path = strings.TrimPrefix(line, "+++ b/")
+		case strings.HasPrefix(line, "+oid sha256:"):
+			if oid := strings.TrimPrefix(line, "+oid sha256:"); oids[oid] {
+				references[oid] = append(references[oid], Reference{Commit: commit, Path: path})
+			}
+		}
+	}
+	return references
+}
+
+// LocalStorage returns the directory holding the repository's local LFS
+// objects, honoring lfs.storage
+func LocalStorage() (string, error) {
+	return LocalStorageIn("")
+}
+
+// LocalStorageIn returns the local LFS object directory of the repository at
+// dir, or of the current one when dir is empty
+func LocalStorageIn(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-common-dir")
+	cmd.Dir = dir
+	gitDir, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse failed: %v", err)
+	}
+	base := filepath.Join(strings.TrimSpace(string(gitDir)), "lfs")
+
+	cmd = exec.Command("git", "config", "--get", "lfs.storage")
+	cmd.Dir = dir
+	if configured, err := cmd.Output(); err == nil {
+		if storage := strings.TrimSpace(string(configured)); storage != "" {
+			if !filepath.IsAbs(storage) {
+				storage = filepath.Join(filepath.Dir(base), storage)
+			}
+			base = storage
+		}
+	}
+	return filepath.Join(base, "objects"), nil
+}
+
+// ObjectPath returns the path of an object in local LFS storage
+func ObjectPath(storage, oid string) string {
+	return filepath.Join(storage, oid[0:2], oid[2:4], oid)
+}
+
+// TotalSize sums the sizes of the pointers
+func TotalSize(pointers []Pointer) int64 {
+	var total int64
+	for _, p := range pointers {
+		total += p.Size
+	}
+	return total
+}
@@ -0,0 +1,147 @@
+package lfspointer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOID = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+// TestParse tests parsing of pointer file content
+func TestParse(t *testing.T) {
+	valid := "version https://git-lfs.github.com/spec/v1\noid sha256:" + testOID + "\nsize 12345\n"
+
+	tests := []struct {
+		name    string
+		content string
+		want    Pointer
+		ok      bool
+	}{
+		{"valid pointer", valid, Pointer{OID: testOID, Size: 12345}, true},
+		{"not a pointer", "hello world\n", Pointer{}, false},
+		{"short oid", "version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 1\n", Pointer{}, false},
+		{"bad size", "version https://git-lfs.github.com/spec/v1\noid sha256:" + testOID + "\nsize x\n", Pointer{}, false},
+		{"too large", valid + strings.Repeat("x", MaxPointerSize), Pointer{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse([]byte(tt.content))
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Parse() = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// TestParseAddedPointers tests extraction of pointers from a patch
+func TestParseAddedPointers(t *testing.T) {
+	patch := strings.Join([]string{
+		"diff --git a/video.mp4 b/video.mp4",
+		"new file mode 100644",
+		"--- /dev/null",
+		"+++ b/video.mp4",
+		"@@ -0,0 +1,3 @@",
+		"+version https://git-lfs.github.com/spec/v1",
+		"+oid sha256:" + testOID,
+		"+size 1000",
+		"diff --git a/copy.mp4 b/copy.mp4",
+		"+++ b/copy.mp4",
+		"+oid sha256:" + testOID,
+		"+size 1000",
+	}, "\n")
+
+	got := parseAddedPointers(patch)
+	want := []Pointer{{OID: testOID, Size: 1000, Path: "video.mp4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAddedPointers() = %+v, want %+v", got, want)
+	}
+}
+
+// TestSmallBlobs tests picking pointer candidates from git cat-file --batch-check output
+func TestSmallBlobs(t *testing.T) {
+	batchCheck := strings.Join([]string{
+		"1111111111111111111111111111111111111111 commit 250",
+		"2222222222222222222222222222222222222222 tree 90",
+		"3333333333333333333333333333333333333333 blob 131",
+		"4444444444444444444444444444444444444444 blob 52000",
+	}, "\n")
+	paths := map[string]string{"3333333333333333333333333333333333333333": "assets/logo.psd"}
+
+	got := smallBlobs(batchCheck, paths)
+	want := []treeEntry{{blob: "3333333333333333333333333333333333333333", path: "assets/logo.psd"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("smallBlobs() = %+v, want %+v", got, want)
+	}
+}
+
+// TestParseReferences tests finding the commits whose pointer files add an object
+func TestParseReferences(t *testing.T) {
+	other := strings.Repeat("f", 64)
+	log := strings.Join([]string{
+		"commit 2222222 2024-05-02 Re-export the video",
+		"",
+		"diff --git a/media/video.mp4 b/media/video.mp4",
+		"--- a/media/video.mp4",
+		"+++ b/media/video.mp4",
+		"-oid sha256:" + other,
+		"+oid sha256:" + testOID,
+		"commit 1111111 2024-05-01 Add media",
+		"",
+		"+++ b/video.mp4",
+		"+oid sha256:" + testOID,
+		"+++ b/other.mp4",
+		"+oid sha256:" + other,
+	}, "\n")
+
+	got := parseReferences(log, map[string]bool{testOID: true})
+	want := map[string][]Reference{testOID: {
+		{Commit: "2222222 2024-05-02 Re-export the video", Path: "media/video.mp4"},
+		{Commit: "1111111 2024-05-01 Add media", Path: "video.mp4"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseReferences() = %+v, want %+v", got, want)
+	}
+}
+
+// TestCompare tests comparing the pointer files of two trees
+func TestCompare(t *testing.T) {
+	oid := func(c string) string { return strings.Repeat(c, 64) }
+	from := []Pointer{
+		{OID: oid("a"), Size: 10, Path: "same.psd"},
+		{OID: oid("b"), Size: 20, Path: "changed.psd"},
+		{OID: oid("c"), Size: 30, Path: "removed.psd"},
+		{OID: oid("d"), Size: 40, Path: "moved/old.psd"},
+	}
+	to := []Pointer{
+		{OID: oid("a"), Size: 10, Path: "same.psd"},
+		{OID: oid("e"), Size: 25, Path: "changed.psd"},
+		{OID: oid("d"), Size: 40, Path: "moved/new.psd"},
+		{OID: oid("f"), Size: 50, Path: "z-added.psd"},
+		{OID: oid("f"), Size: 50, Path: "a-added-copy.psd"},
+	}
+
+	c := Compare(from, to)
+	paths := func(changes []Change) []string {
+		var p []string
+		for _, change := range changes {
+			p = append(p, change.Path)
+		}
+		return p
+	}
+	if got, want := paths(c.Added), []string{"a-added-copy.psd", "moved/new.psd", "z-added.psd"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Added = %v, want %v", got, want)
+	}
+	if got, want := paths(c.Removed), []string{"moved/old.psd", "removed.psd"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Removed = %v, want %v", got, want)
+	}
+	if len(c.Changed) != 1 || c.Changed[0].From.Size != 20 || c.Changed[0].To.Size != 25 || c.Unchanged != 1 {
+		t.Errorf("Changed = %+v, Unchanged = %d", c.Changed, c.Unchanged)
+	}
+
+	// A moved object is already present and a copied one is downloaded once
+	if got, want := TotalSize(c.Transfer), int64(75); len(c.Transfer) != 2 || got != want {
+		t.Errorf("Transfer = %+v (%d bytes), want 2 objects of %d bytes", c.Transfer, got, want)
+	}
+}
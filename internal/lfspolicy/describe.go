@@ -0,0 +1,71 @@
+package lfspolicy
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// Tracker returns a function reporting whether .gitattributes at top tracks
+// an extension of the policy, for Describe
+func (p Policy) Tracker(top string) (func(string) bool, error) {
+	untracked, err := UntrackedExtensions(top, p.Extensions(), p.BothCases)
+	if err != nil {
+		return nil, err
+	}
+	return func(ext string) bool { return !slices.Contains(untracked, ext) }, nil
+}
+
+// Describe explains a violation and gives the commands that fix it
+func (p Policy) Describe(v Violation, tracked func(string) bool) (string, string) {
+	f := v.File
+	if f.Path == "" {
+		if p.BothCases && strings.ToUpper(v.Extension) != v.Extension {
+			return fmt.Sprintf("*.%s and *.%s are not both tracked by Git LFS", v.Extension, strings.ToUpper(v.Extension)), "git lfs-policy apply"
+		}
+		return fmt.Sprintf("*.%s is not tracked by Git LFS", v.Extension), "git lfs-policy apply"
+	}
+
+	where := f.Path
+	if f.Commit != "" {
+		where = f.Commit[:min(len(f.Commit), 10)] + " " + f.Path
+	}
+	where += " (" + common.FormatSize(f.Size) + ")"
+	quoted := common.ShellQuote(f.Path)
+
+	var problem string
+	switch v.Rule {
+	case RuleRequired, RuleForbidden:
+		problem = fmt.Sprintf("%s is a plain Git file; .%s files must be stored in Git LFS", where, v.Extension)
+	case RuleMaxGitFileSize:
+		problem = fmt.Sprintf("%s is a plain Git file larger than %s", where, common.FormatSize(p.MaxGitFileSize))
+	case RuleMaxLFSFileSize:
+		problem = fmt.Sprintf("%s is larger than the %s allowed in Git LFS", where, common.FormatSize(p.MaxLFSFileSize))
+		if f.Commit != "" {
+			return problem, "remove it from the history before pushing, e.g. by amending or rebasing " + f.Commit[:min(len(f.Commit), 10)]
+		}
+		return problem, "keep it out of the repository: git rm --cached " + quoted + ", then add it to .gitignore"
+	}
+
+	if f.Commit != "" {
+		return problem, "git lfs migrate import --include=" + common.ShellQuote(f.Path) + " (rewrites the history of the current branch)"
+	}
+	var steps []string
+	switch {
+	case v.Extension != "" && !tracked(v.Extension):
+		steps = append(steps, "git lfs-policy apply")
+	case v.Extension == "" && path.Ext(f.Path) != "":
+		steps = append(steps, "git lfs-track "+common.ShellQuote(strings.TrimPrefix(path.Ext(f.Path), ".")))
+	case v.Extension == "":
+		steps = append(steps, "git lfs track "+quoted)
+	}
+	if f.Staged {
+		steps = append(steps, "git add --renormalize "+quoted)
+	} else {
+		steps = append(steps, "git add "+quoted)
+	}
+	return problem, strings.Join(steps, " && ")
+}
@@ -0,0 +1,309 @@
+package lfspolicy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// git runs a git command in dir and returns its output
+func git(dir string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+	return string(output), nil
+}
+
+// splitNul splits NUL-terminated records
+func splitNul(output string) []string {
+	return strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+}
+
+// lfsAttributes returns the paths filter=lfs applies to
+func lfsAttributes(top string, paths []string) (map[string]bool, error) {
+	lfs := make(map[string]bool)
+	if len(paths) == 0 {
+		return lfs, nil
+	}
+	output, err := git(top, strings.Join(paths, "\x00")+"\x00", "check-attr", "-z", "--stdin", "filter")
+	if err != nil {
+		return nil, err
+	}
+	// Output records: PATH NUL ATTRIBUTE NUL VALUE NUL
+	fields := splitNul(output)
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == "lfs" {
+			lfs[fields[i]] = true
+		}
+	}
+	return lfs, nil
+}
+
+// blobSizes returns the size of each blob
+func blobSizes(blobs []string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	if len(blobs) == 0 {
+		return sizes, nil
+	}
+	output, err := git("", strings.Join(blobs, "\n")+"\n", "cat-file", "--batch-check=%(objectname) %(objectsize)")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if size, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			sizes[fields[0]] = size
+		}
+	}
+	return sizes, nil
+}
+
+// UntrackedExtensions returns the extensions that filter=lfs does not apply
+// to, at the top of the working tree or below it, in lower case or, with
+// bothCases, in upper case
+func UntrackedExtensions(top string, extensions []string, bothCases bool) ([]string, error) {
+	probes := make(map[string][]string)
+	var paths []string
+	for _, ext := range extensions {
+		cases := []string{ext}
+		if bothCases && strings.ToUpper(ext) != ext {
+			cases = append(cases, strings.ToUpper(ext))
+		}
+		for _, e := range cases {
+			probes[ext] = append(probes[ext], "file."+e, "dir/file."+e)
+		}
+		paths = append(paths, probes[ext]...)
+	}
+	lfs, err := lfsAttributes(top, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var untracked []string
+	for _, ext := range extensions {
+		for _, probe := range probes[ext] {
+			if !lfs[probe] {
+				untracked = append(untracked, ext)
+				break
+			}
+		}
+	}
+	return untracked, nil
+}
+
+// WorkingTree returns the regular files the next commit would hold: those
+// in the index and the untracked files that are not ignored. A file
+// committed as a plain blob although filter=lfs now applies to it is not
+// counted as in LFS until it is renormalized, and the size of a pointer
+// file that is not checked out is that of its object.
+func WorkingTree(top string) ([]File, error) {
+	staged, err := git(top, "", "ls-files", "-z", "--cached", "--stage")
+	if err != nil {
+		return nil, err
+	}
+	others, err := git(top, "", "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]string) // Path to index blob
+	var paths []string
+	for _, record := range splitNul(staged) {
+		// MODE SP BLOB SP STAGE TAB PATH
+		meta, p, found := strings.Cut(record, "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 3 {
+			continue
+		}
+		if _, seen := blobs[p]; !seen {
+			paths = append(paths, p)
+		}
+		blobs[p] = fields[1]
+	}
+	for _, p := range splitNul(others) {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+
+	lfs, err := lfsAttributes(top, paths)
+	if err != nil {
+		return nil, err
+	}
+	var lfsBlobs []string
+	for p, blob := range blobs {
+		if lfs[p] {
+			lfsBlobs = append(lfsBlobs, blob)
+		}
+	}
+	sizes, err := blobSizes(lfsBlobs)
+	if err != nil {
+		return nil, err
+	}
+	small := make(map[string]string)
+	for p, blob := range blobs {
+		if lfs[p] && sizes[blob] <= lfspointer.MaxPointerSize {
+			small[blob] = p
+		}
+	}
+	pointers, err := lfspointer.FromBlobs(small)
+	if err != nil {
+		return nil, err
+	}
+	indexPointers := make(map[string]bool)
+	for _, pointer := range pointers {
+		indexPointers[pointer.Blob] = true
+	}
+
+	var files []File
+	for _, p := range paths {
+		info, err := os.Lstat(filepath.Join(top, p))
+		if err != nil || !info.Mode().IsRegular() {
+			continue // Deleted, a symbolic link or a submodule
+		}
+		blob, staged := blobs[p]
+		f := File{Path: p, Size: info.Size(), LFS: lfs[p], Staged: staged}
+		if f.LFS && staged && !indexPointers[blob] {
+			f.LFS = false
+		}
+		if f.LFS && f.Size <= lfspointer.MaxPointerSize {
+			// Not checked out: the size is that of the object
+			if data, err := os.ReadFile(filepath.Join(top, p)); err == nil {
+				if pointer, ok := lfspointer.Parse(data); ok {
+					f.Size = pointer.Size
+				}
+			}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Commits returns the blobs that the non-merge commits revs select add or
+// modify, with the size of their content for LFS pointers
+func Commits(revs []string) ([]File, error) {
+	commits, err := git("", "", append([]string{"rev-list", "--no-merges"}, revs...)...)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(commits) == "" {
+		return nil, nil
+	}
+	output, err := git("", commits, "diff-tree", "--stdin", "-z", "-r", "--root", "--no-renames", "--diff-filter=AM")
+	if err != nil {
+		return nil, err
+	}
+	added := parseDiffTree(output)
+
+	var ids []string
+	for _, a := range added {
+		ids = append(ids, a.blob)
+	}
+	sizes, err := blobSizes(ids)
+	if err != nil {
+		return nil, err
+	}
+	small := make(map[string]string)
+	for _, a := range added {
+		if sizes[a.blob] <= lfspointer.MaxPointerSize {
+			small[a.blob] = a.path
+		}
+	}
+	pointers, err := lfspointer.FromBlobs(small)
+	if err != nil {
+		return nil, err
+	}
+	pointerSizes := make(map[string]int64)
+	for _, p := range pointers {
+		pointerSizes[p.Blob] = p.Size
+	}
+
+	files := make([]File, 0, len(added))
+	for _, a := range added {
+		f := File{Path: a.path, Commit: a.commit, Size: sizes[a.blob]}
+		if size, ok := pointerSizes[a.blob]; ok {
+			f.Size, f.LFS = size, true
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// addedBlob is a blob a commit adds or modifies
+type addedBlob struct {
+	commit string
+	blob   string
+	path   string
+}
+
+// parseDiffTree reads git diff-tree --stdin -z -r output, where each commit
+// id is followed by :OLDMODE NEWMODE OLDBLOB NEWBLOB STATUS records and
+// their paths. Gitlinks are skipped.
+func parseDiffTree(output string) []addedBlob {
+	var added []addedBlob
+	commit := ""
+	fields := splitNul(output)
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimSpace(fields[i])
+		if !strings.HasPrefix(field, ":") {
+			if field != "" {
+				commit = field
+			}
+			continue
+		}
+		meta := strings.Fields(field)
+		if i+1 >= len(fields) || len(meta) != 5 {
+			break
+		}
+		i++
+		if meta[1] == "160000" {
+			continue
+		}
+		added = append(added, addedBlob{commit: commit, blob: meta[3], path: fields[i]})
+	}
+	return added
+}
+
+// Check returns the violations of the working tree at top, of the commits
+// revs select when there are any, and of the extensions of the policy that
+// .gitattributes does not track
+func (p Policy) Check(top string, revs []string) ([]Violation, error) {
+	var violations []Violation
+	untracked, err := UntrackedExtensions(top, p.RequiredExtensions, p.BothCases)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range untracked {
+		violations = append(violations, Violation{Rule: RuleRequired, Extension: ext})
+	}
+
+	files, err := WorkingTree(top)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) > 0 {
+		committed, err := Commits(revs)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, committed...)
+	}
+	for _, f := range files {
+		violations = append(violations, p.Evaluate(f)...)
+	}
+	return violations, nil
+}
@@ -0,0 +1,264 @@
+// Package lfspolicy reads the .lfspolicy.yaml file a repository commits to
+// state which files belong in Git LFS, and checks files against it
+package lfspolicy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfsfiles"
+)
+
+// FileName is the policy file at the top of the working tree
+const FileName = ".lfspolicy.yaml"
+
+// DefaultCommits is how many recent commits are checked when the policy
+// does not say
+const DefaultCommits = 10
+
+// Policy is the content of a policy file
+type Policy struct {
+	MaxGitFileSize      int64    // max_git_file_size: larger files must be in LFS; 0 for no limit
+	MaxLFSFileSize      int64    // max_lfs_file_size: larger LFS objects are refused; 0 for no limit
+	RequiredExtensions  []string // required_extensions: must be tracked in .gitattributes
+	ForbiddenExtensions []string // forbidden_extensions: must not be stored as plain Git blobs
+	BothCases           bool     // both_cases: extensions are tracked in upper case too
+	Commits             int      // commits: how many recent commits check looks at
+}
+
+// Rules, as named in violations
+const (
+	RuleRequired       = "required_extensions"
+	RuleForbidden      = "forbidden_extensions"
+	RuleMaxGitFileSize = "max_git_file_size"
+	RuleMaxLFSFileSize = "max_lfs_file_size"
+)
+
+// File is a file of the working tree or a blob added by a commit
+type File struct {
+	Path   string // Relative to the top of the working tree
+	Size   int64  // Of the content, also for LFS files
+	LFS    bool   // Stored as an LFS pointer, or filter=lfs applies to it
+	Commit string // Commit adding the blob; "" for the working tree
+	Staged bool   // In the index; working tree files only
+}
+
+// Violation is a file, or for RuleRequired an extension, breaking a rule
+type Violation struct {
+	Rule      string
+	File      File   // Unset for an extension that is not tracked
+	Extension string // Extension of the file the rule names
+}
+
+// Load reads a policy file
+func Load(file string) (Policy, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Policy{}, err
+	}
+	defer f.Close()
+	p, err := Parse(f)
+	if err != nil {
+		return p, fmt.Errorf("invalid %s: %v", file, err)
+	}
+	return p, nil
+}
+
+// Parse reads the YAML subset of policy files: keys with a scalar value, a
+// flow list ([psd, zip]) or a block list of '- item' lines. Extensions may
+// be presets such as @video.
+//
+//	max_git_file_size: 5M
+//	required_extensions: [psd, "@video"]
+//	forbidden_extensions:
+//	  - exe
+//	  - iso
+func Parse(r io.Reader) (Policy, error) {
+	p := Policy{Commits: DefaultCommits}
+	values := make(map[string][]string)
+	var order []string
+	list := ""
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		if item, ok := strings.CutPrefix(line, "- "); ok && list != "" {
+			values[list] = append(values[list], scalar(item))
+			continue
+		}
+		if raw != line {
+			return p, fmt.Errorf("line %d: unexpected indentation", lineNumber)
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return p, fmt.Errorf("line %d: expected 'key: value'", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		if _, seen := values[key]; seen {
+			return p, fmt.Errorf("line %d: %s is set twice", lineNumber, key)
+		}
+		order = append(order, key)
+		value = scalar(value)
+		list = ""
+		switch {
+		case value == "":
+			values[key] = nil
+			list = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			values[key] = []string{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = scalar(item); item != "" {
+					values[key] = append(values[key], item)
+				}
+			}
+		default:
+			values[key] = []string{value}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+
+	for _, key := range order {
+		if err := p.set(key, values[key]); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// set applies one key of a policy file
+func (p *Policy) set(key string, values []string) error {
+	single := func() (string, error) {
+		if len(values) != 1 {
+			return "", fmt.Errorf("%s must have a single value", key)
+		}
+		return values[0], nil
+	}
+	switch key {
+	case RuleMaxGitFileSize, RuleMaxLFSFileSize:
+		value, err := single()
+		if err != nil {
+			return err
+		}
+		size, err := common.ParseSize(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		if key == RuleMaxGitFileSize {
+			p.MaxGitFileSize = size
+		} else {
+			p.MaxLFSFileSize = size
+		}
+	case RuleRequired, RuleForbidden:
+		values, err := lfsfiles.ExpandPresets(values)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		var extensions []string
+		for _, value := range values {
+			ext := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(value, "*"), "."))
+			if ext == "" || strings.ContainsAny(ext, "/*?[") {
+				return fmt.Errorf("%s: '%s' is not an extension", key, value)
+			}
+			extensions = append(extensions, ext)
+		}
+		if key == RuleRequired {
+			p.RequiredExtensions = extensions
+		} else {
+			p.ForbiddenExtensions = extensions
+		}
+	case "both_cases":
+		value, err := single()
+		if err != nil {
+			return err
+		}
+		if p.BothCases, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("both_cases must be true or false, not '%s'", value)
+		}
+	case "commits":
+		value, err := single()
+		if err != nil {
+			return err
+		}
+		if p.Commits, err = strconv.Atoi(value); err != nil || p.Commits < 0 {
+			return fmt.Errorf("commits must be a number of commits, not '%s'", value)
+		}
+	default:
+		return fmt.Errorf("unknown key '%s'", key)
+	}
+	return nil
+}
+
+// scalar removes quotes and trailing comments from a scalar value
+func scalar(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.LastIndexByte(value, value[0]); end > 0 {
+			return value[1:end]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// Extensions returns the required then the forbidden extensions, each once:
+// those that must be tracked by Git LFS
+func (p Policy) Extensions() []string {
+	var extensions []string
+	seen := make(map[string]bool)
+	for _, ext := range append(append([]string{}, p.RequiredExtensions...), p.ForbiddenExtensions...) {
+		if !seen[ext] {
+			seen[ext] = true
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// Evaluate returns the rules a file breaks
+func (p Policy) Evaluate(f File) []Violation {
+	var violations []Violation
+	if f.LFS {
+		if p.MaxLFSFileSize > 0 && f.Size > p.MaxLFSFileSize {
+			violations = append(violations, Violation{Rule: RuleMaxLFSFileSize, File: f})
+		}
+		return violations
+	}
+	if ext := matchExtension(p.RequiredExtensions, f.Path); ext != "" {
+		violations = append(violations, Violation{Rule: RuleRequired, File: f, Extension: ext})
+	} else if ext := matchExtension(p.ForbiddenExtensions, f.Path); ext != "" {
+		violations = append(violations, Violation{Rule: RuleForbidden, File: f, Extension: ext})
+	}
+	if p.MaxGitFileSize > 0 && f.Size > p.MaxGitFileSize {
+		violations = append(violations, Violation{Rule: RuleMaxGitFileSize, File: f})
+	}
+	return violations
+}
+
+// matchExtension returns the longest of extensions the file name ends with,
+// ignoring case, so that tar.gz wins over gz
+func matchExtension(extensions []string, p string) string {
+	name := strings.ToLower(path.Base(p))
+	match := ""
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, "."+ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	return match
+}
@@ -0,0 +1,132 @@
+package lfspolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParse tests reading the YAML subset of policy files
+func TestParse(t *testing.T) {
+	p, err := Parse(strings.NewReader(`---
+# Team policy
+max_git_file_size: 1M
+max_lfs_file_size: "2G"   # per object
+required_extensions: [psd, "*.blend", .Tar.GZ]
+forbidden_extensions:
+  - exe
+- '@fonts'
+both_cases: true
+commits: 25
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := Policy{
+		MaxGitFileSize:      1 << 20,
+		MaxLFSFileSize:      2 << 30,
+		RequiredExtensions:  []string{"psd", "blend", "tar.gz"},
+		ForbiddenExtensions: []string{"exe", "ttf", "otf", "woff", "woff2", "eot"},
+		BothCases:           true,
+		Commits:             25,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Parse() = %+v, want %+v", p, want)
+	}
+
+	if p, err := Parse(strings.NewReader("")); err != nil || p.Commits != DefaultCommits {
+		t.Errorf("Parse(empty) = %+v, %v", p, err)
+	}
+	for _, invalid := range []string{
+		"max_git_file_size: lots",
+		"maximum: 1M",
+		"commits: [1, 2]",
+		"required_extensions: [assets/*.psd]",
+		"both_cases: sometimes",
+		"commits: 1\ncommits: 2",
+		"  max_git_file_size: 1M",
+		"just text",
+	} {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid policy", invalid)
+		}
+	}
+}
+
+// TestEvaluate tests which rules a file breaks
+func TestEvaluate(t *testing.T) {
+	p := Policy{
+		MaxGitFileSize:      100,
+		MaxLFSFileSize:      1000,
+		RequiredExtensions:  []string{"psd", "tar.gz"},
+		ForbiddenExtensions: []string{"gz", "psd"},
+	}
+	tests := []struct {
+		file File
+		want []string
+	}{
+		{File{Path: "art/Logo.PSD", Size: 10}, []string{RuleRequired}},
+		{File{Path: "dist/a.tar.gz", Size: 10}, []string{RuleRequired}},
+		{File{Path: "a.gz", Size: 500}, []string{RuleForbidden, RuleMaxGitFileSize}},
+		{File{Path: "notes.txt", Size: 500}, []string{RuleMaxGitFileSize}},
+		{File{Path: "notes.txt", Size: 50}, nil},
+		{File{Path: "art/logo.psd", Size: 500, LFS: true}, nil},
+		{File{Path: "video.bin", Size: 5000, LFS: true}, []string{RuleMaxLFSFileSize}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range p.Evaluate(tt.file) {
+			got = append(got, v.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Evaluate(%+v) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+	if got := p.Extensions(); !reflect.DeepEqual(got, []string{"psd", "tar.gz", "gz"}) {
+		t.Errorf("Extensions() = %v", got)
+	}
+}
+
+// TestDescribe tests the explanations and fixes of violations
+func TestDescribe(t *testing.T) {
+	p := Policy{MaxGitFileSize: 100, BothCases: true}
+	tracked := func(ext string) bool { return ext == "psd" }
+	tests := []struct {
+		v       Violation
+		problem string
+		fix     string
+	}{
+		{Violation{Rule: RuleRequired, Extension: "zip"},
+			"*.zip and *.ZIP are not both tracked by Git LFS", "git lfs-policy apply"},
+		{Violation{Rule: RuleRequired, Extension: "zip", File: File{Path: "a.zip", Size: 10}},
+			"a.zip (10 B) is a plain Git file; .zip files must be stored in Git LFS", "git lfs-policy apply && git add a.zip"},
+		{Violation{Rule: RuleForbidden, Extension: "psd", File: File{Path: "a.psd", Size: 10, Staged: true}},
+			"a.psd (10 B) is a plain Git file; .psd files must be stored in Git LFS", "git add --renormalize a.psd"},
+		{Violation{Rule: RuleMaxGitFileSize, File: File{Path: "b.bin", Size: 500, Commit: "0123456789abcdef"}},
+			"0123456789 b.bin (500 B) is a plain Git file larger than 100 B", "git lfs migrate import --include=b.bin (rewrites the history of the current branch)"},
+	}
+	for _, tt := range tests {
+		problem, fix := p.Describe(tt.v, tracked)
+		if problem != tt.problem || fix != tt.fix {
+			t.Errorf("Describe(%+v) = %q, %q; want %q, %q", tt.v, problem, fix, tt.problem, tt.fix)
+		}
+	}
+}
+
+// TestParseDiffTree tests reading the blobs that commits add
+func TestParseDiffTree(t *testing.T) {
+	output := "c1\x00" +
+		":000000 100644 0000 aaa A\x00art/logo.psd\x00" +
+		":100644 100644 bbb ccc M\x00notes with spaces.txt\x00" +
+		"c2\x00" +
+		":000000 160000 0000 ddd A\x00vendor/lib\x00" +
+		":000000 100644 0000 eee A\x00:odd name\x00"
+	want := []addedBlob{
+		{commit: "c1", blob: "aaa", path: "art/logo.psd"},
+		{commit: "c1", blob: "ccc", path: "notes with spaces.txt"},
+		{commit: "c2", blob: "eee", path: ":odd name"},
+	}
+	if got := parseDiffTree(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiffTree() = %+v, want %+v", got, want)
+	}
+}
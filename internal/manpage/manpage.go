@@ -0,0 +1,116 @@
+// Package manpage turns the --help text of the suite's commands into man
+// pages (man-pages(7) roff), so that 'man git-lfs-track' and
+// 'git lfs-track --help' through git's help viewer show the same text
+package manpage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Page is the header of a man page
+type Page struct {
+	Section string // e.g. "1"
+	Version string // e.g. "1.4.0"
+	Date    string // Of the release, e.g. "2026-10-16"
+	Manual  string // e.g. "Git LFS Scripts Manual"
+	Source  string // e.g. "git_lfs_scripts"
+}
+
+// headingPattern matches a section heading of help text, e.g. 'SEE ALSO:'
+var headingPattern = regexp.MustCompile(`^([A-Z][A-Z /-]*[A-Z]):$`)
+
+// sectionNames maps help headings to the standard man page sections
+var sectionNames = map[string]string{
+	"USAGE":  "SYNOPSIS",
+	"SYNTAX": "SYNOPSIS",
+}
+
+// FromHelp converts help text to a man page. The help text starts with
+// 'NAME - SUMMARY' and is divided into sections by unindented headings
+// ending with a colon, such as 'OPTIONS:'. Section content is kept as it is
+// laid out, since the help text aligns options and examples in columns.
+func FromHelp(help string, page Page) (string, error) {
+	lines := strings.Split(strings.TrimSpace(help), "\n")
+	name, summary, found := strings.Cut(lines[0], " - ")
+	if !found || strings.ContainsAny(name, " \t") {
+		return "", fmt.Errorf("help text does not start with 'NAME - SUMMARY': %q", lines[0])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s %s %s %s %s\n",
+		quote(strings.ToUpper(name)), quote(page.Section), quote(page.Date),
+		quote(strings.TrimSpace(page.Source+" "+page.Version)), quote(page.Manual))
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", escape(name), escape(summary))
+
+	var body []string
+	flush := func() {
+		writeBody(&b, body)
+		body = body[:0]
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t")
+		if match := headingPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			heading := match[1]
+			if standard, ok := sectionNames[heading]; ok {
+				heading = standard
+			}
+			fmt.Fprintf(&b, ".SH %s\n", quote(heading))
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return b.String(), nil
+}
+
+// writeBody writes the lines of a section as preformatted text, without
+// the blank lines around them and the indentation they share
+func writeBody(b *strings.Builder, lines []string) {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	indent := -1
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " ")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	b.WriteString(".nf\n")
+	for _, line := range lines {
+		if len(line) >= indent {
+			line = line[indent:]
+		}
+		b.WriteString(escape(line) + "\n")
+	}
+	b.WriteString(".fi\n")
+}
+
+// escape makes text literal in roff: backslashes and hyphens are escaped,
+// so that options can be copied, and lines cannot start a request
+func escape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
+
+// quote makes text one argument of a roff request
+func quote(text string) string {
+	return `"` + strings.ReplaceAll(escape(text), `"`, `\(dq`) + `"`
+}
@@ -0,0 +1,63 @@
+package manpage
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFromHelp tests the conversion of help text to a man page
+func TestFromHelp(t *testing.T) {
+	help := `
+git-lfs-track - Frontend for git lfs track with pattern permutation
+
+USAGE:
+  git-lfs-track [OPTIONS] PATTERN ...
+
+OPTIONS:
+  -c           Expand pattern to upper and lower case
+  --path DIR   Anchor the patterns to DIR;
+               repeat for several directories
+
+EXAMPLES:
+  git lfs-track -c mp3   # Track *.mp3 and *.MP3
+  .\hooks\run
+
+SEE ALSO:
+  git-lfs-untrack
+`
+	page := Page{Section: "1", Version: "1.4.0", Date: "2026-10-16", Manual: "Git LFS Scripts Manual", Source: "git_lfs_scripts"}
+	got, err := FromHelp(help, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `.TH "GIT\-LFS\-TRACK" "1" "2026\-10\-16" "git_lfs_scripts 1.4.0" "Git LFS Scripts Manual"
+.SH NAME
+git\-lfs\-track \- Frontend for git lfs track with pattern permutation
+.SH "SYNOPSIS"
+.nf
+git\-lfs\-track [OPTIONS] PATTERN ...
+.fi
+.SH "OPTIONS"
+.nf
+\-c           Expand pattern to upper and lower case
+\-\-path DIR   Anchor the patterns to DIR;
+             repeat for several directories
+.fi
+.SH "EXAMPLES"
+.nf
+git lfs\-track \-c mp3   # Track *.mp3 and *.MP3
+\&.\ehooks\erun
+.fi
+.SH "SEE ALSO"
+.nf
+git\-lfs\-untrack
+.fi
+`
+	if got != want {
+		t.Errorf("FromHelp() =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := FromHelp("Usage: git-lfs-track PATTERN", page); err == nil || !strings.Contains(err.Error(), "NAME - SUMMARY") {
+		t.Errorf("FromHelp() of help without a name = %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefix is the name prefix of plugin executables on PATH; the rest of the
+// name is the subcommand, e.g. git-lfs-scripts-audit adds 'audit'
+const Prefix = "git-lfs-scripts-"
+
+// Protocol is the version of the handshake described by Context; plugins
+// should refuse versions they do not know
+const Protocol = 1
+
+// DescribeFlag asks a plugin to print its Description as JSON and exit
+const DescribeFlag = "--lfs-scripts-describe"
+
+// Environment variables set for every plugin run
+const (
+	EnvContext  = "GIT_LFS_SCRIPTS_CONTEXT"  // Context as JSON
+	EnvProtocol = "GIT_LFS_SCRIPTS_PROTOCOL" // Protocol version
+	EnvVersion  = "GIT_LFS_SCRIPTS_VERSION"  // Suite version
+	EnvTopLevel = "GIT_LFS_SCRIPTS_TOPLEVEL" // Top of the working tree, empty outside a repository
+)
+
+// Plugin is a subcommand provided outside this repository
+type Plugin struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Summary string `json:"summary,omitempty"`
+	Source  string `json:"source"` // "PATH" or the manifest that registered it
+}
+
+// Description is what a plugin prints in answer to DescribeFlag
+type Description struct {
+	Summary string `json:"summary"`
+	Version string `json:"version,omitempty"`
+}
+
+// Manifest registers plugins that are not on PATH or not named with Prefix,
+// such as Go programs installed in a team directory:
+//
+//	{"plugins": [{"name": "audit", "path": "/opt/lfs-tools/audit", "summary": "Check LFS policy"}]}
+//
+// Relative paths are resolved against the manifest's directory.
+type Manifest struct {
+	Plugins []Plugin `json:"plugins"`
+}
+
+// Context is the handshake passed to a plugin in EnvContext
+type Context struct {
+	Protocol int               `json:"protocol"`
+	Version  string            `json:"version"` // Suite version
+	Plugin   string            `json:"plugin"`  // Subcommand name
+	Repo     *Repo             `json:"repo,omitempty"`
+	Config   map[string]string `json:"config"` // lfs.*, audit.* and lfs-scripts.* git config
+}
+
+// Repo describes the repository the plugin runs in
+type Repo struct {
+	TopLevel  string `json:"toplevel"`
+	GitDir    string `json:"git_dir"`
+	Branch    string `json:"branch,omitempty"` // Empty on a detached HEAD
+	Head      string `json:"head,omitempty"`   // Empty before the first commit
+	RemoteURL string `json:"remote_url,omitempty"`
+}
+
+// DefaultManifests returns the user manifest and any manifests named by the
+// multi-valued git config lfs-scripts.manifest. Manifests are never read from
+// the working tree, so cloning a repository cannot register plugins.
+func DefaultManifests() []string {
+	var manifests []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		manifests = append(manifests, filepath.Join(dir, "git-lfs-scripts", "plugins.json"))
+	}
+	output, _ := exec.Command("git", "config", "--path", "--get-all", "lfs-scripts.manifest").Output()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			manifests = append(manifests, line)
+		}
+	}
+	return manifests
+}
+
+// Discover finds plugins in manifests and in the directories of pathList.
+// Manifest entries win over PATH, and earlier entries win over later ones.
+// Names in reserved, the built-in commands, are skipped so plugins cannot
+// shadow them. Missing manifests are ignored.
+func Discover(pathList string, manifests []string, reserved map[string]bool) ([]Plugin, error) {
+	found := make(map[string]Plugin)
+	add := func(p Plugin) {
+		if p.Name == "" || reserved[p.Name] || strings.ContainsAny(p.Name, `/\ `) {
+			return
+		}
+		if _, ok := found[p.Name]; !ok {
+			found[p.Name] = p
+		}
+	}
+
+	for _, manifest := range manifests {
+		plugins, err := ReadManifest(manifest)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range plugins {
+			add(p)
+		}
+	}
+
+	for _, dir := range filepath.SplitList(pathList) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, Prefix) {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if !isExecutable(path) {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			add(Plugin{Name: strings.TrimPrefix(name, Prefix), Path: path, Source: "PATH"})
+		}
+	}
+
+	plugins := make([]Plugin, 0, len(found))
+	for _, p := range found {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins, nil
+}
+
+// ReadManifest returns the plugins registered in a manifest file
+func ReadManifest(path string) ([]Plugin, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %v", path, err)
+	}
+	for i := range manifest.Plugins {
+		p := &manifest.Plugins[i]
+		if p.Path == "" {
+			return nil, fmt.Errorf("plugin manifest %s: plugin '%s' has no path", path, p.Name)
+		}
+		if !filepath.IsAbs(p.Path) {
+			p.Path = filepath.Join(filepath.Dir(path), p.Path)
+		}
+		p.Source = path
+	}
+	return manifest.Plugins, nil
+}
+
+// isExecutable reports whether path is a regular file that can be run
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(path))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return info.Mode()&0111 != 0
+}
+
+// Describe asks a plugin for its summary. Plugins that do not answer within
+// the timeout, or answer with anything but a Description, keep the summary
+// from their manifest entry.
+func Describe(p Plugin, timeout time.Duration) Plugin {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.Path, DescribeFlag)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", EnvProtocol, Protocol))
+	output, err := cmd.Output()
+	if err != nil {
+		return p
+	}
+	var d Description
+	if json.Unmarshal(output, &d) == nil && d.Summary != "" {
+		p.Summary = d.Summary
+	}
+	return p
+}
+
+// NewContext collects the handshake for a plugin run; outside a repository
+// Repo is nil
+func NewContext(name, version string) Context {
+	ctx := Context{Protocol: Protocol, Version: version, Plugin: name, Config: make(map[string]string)}
+
+	if top := gitOutput("rev-parse", "--show-toplevel"); top != "" {
+		gitDir := gitOutput("rev-parse", "--absolute-git-dir")
+		ctx.Repo = &Repo{
+			TopLevel:  top,
+			GitDir:    gitDir,
+			Branch:    gitOutput("symbolic-ref", "--quiet", "--short", "HEAD"),
+			Head:      gitOutput("rev-parse", "--verify", "--quiet", "HEAD"),
+			RemoteURL: gitOutput("config", "--get", "remote.origin.url"),
+		}
+	}
+
+	output := gitOutput("config", "--null", "--get-regexp", `^(lfs|audit|lfs-scripts)\.`)
+	for key, value := range parseConfig(output) {
+		ctx.Config[key] = value
+	}
+	return ctx
+}
+
+// parseConfig parses git config --null --get-regexp output, in which each
+// entry is 'key\nvalue\x00'; the last value of a multi-valued key wins
+func parseConfig(output string) map[string]string {
+	config := make(map[string]string)
+	for _, entry := range strings.Split(output, "\x00") {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "\n")
+		config[key] = value
+	}
+	return config
+}
+
+// Env returns the environment for a plugin run
+func (c Context) Env() ([]string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	env := append(os.Environ(),
+		EnvContext+"="+string(data),
+		fmt.Sprintf("%s=%d", EnvProtocol, c.Protocol),
+		EnvVersion+"="+c.Version,
+	)
+	if c.Repo != nil {
+		env = append(env, EnvTopLevel+"="+c.Repo.TopLevel)
+	}
+	return env, nil
+}
+
+// Run executes a plugin with args and the handshake, connected to the
+// terminal, and returns its exit code
+func Run(p Plugin, args []string, ctx Context) (int, error) {
+	env, err := ctx.Env()
+	if err != nil {
+		return 1, err
+	}
+	cmd := exec.Command(p.Path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// gitOutput returns the trimmed output of a git command, or "" on failure
+func gitOutput(args ...string) string {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestDiscover tests finding plugins on PATH and in manifests
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX executable bits")
+	}
+	bin1, bin2, conf := t.TempDir(), t.TempDir(), t.TempDir()
+	write := func(path string, mode os.FileMode) {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(bin1, Prefix+"audit"), 0755)
+	write(filepath.Join(bin1, Prefix+"notes.txt"), 0644) // Not executable
+	write(filepath.Join(bin1, Prefix+"lfs-track"), 0755) // Reserved
+	write(filepath.Join(bin2, Prefix+"audit"), 0755)     // Shadowed by bin1
+	write(filepath.Join(bin2, Prefix+"sync"), 0755)
+	os.WriteFile(filepath.Join(conf, "plugins.json"),
+		[]byte(`{"plugins": [{"name": "sync", "path": "tools/sync", "summary": "Team sync"}]}`), 0644)
+
+	plugins, err := Discover(bin1+string(os.PathListSeparator)+bin2,
+		[]string{filepath.Join(conf, "plugins.json"), filepath.Join(conf, "missing.json")},
+		map[string]bool{"lfs-track": true})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	want := []Plugin{
+		{Name: "audit", Path: filepath.Join(bin1, Prefix+"audit"), Source: "PATH"},
+		{Name: "sync", Path: filepath.Join(conf, "tools", "sync"), Summary: "Team sync", Source: filepath.Join(conf, "plugins.json")},
+	}
+	if !reflect.DeepEqual(plugins, want) {
+		t.Errorf("Discover() = %+v, want %+v", plugins, want)
+	}
+}
+
+// TestParseConfig tests reading git config --null --get-regexp output
+func TestParseConfig(t *testing.T) {
+	got := parseConfig("lfs.url\nhttps://lfs.example.com\x00audit.path\n/var/log/lfs.jsonl\x00lfs.url\nhttps://other.example.com\x00")
+	want := map[string]string{"lfs.url": "https://other.example.com", "audit.path": "/var/log/lfs.jsonl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseConfig() = %v, want %v", got, want)
+	}
+}
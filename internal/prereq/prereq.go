@@ -0,0 +1,334 @@
+package prereq
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind identifies how a requirement is checked
+type Kind int
+
+const (
+	Binary       Kind = iota // An executable on PATH
+	PythonModule             // A module importable by python3
+	PythonScript             // An executable on PATH installed by a pip package
+)
+
+// Requirement describes a single prerequisite of a command
+type Requirement struct {
+	Name        string       // Executable or Python module name
+	Kind        Kind         // How the requirement is checked
+	Hint        string       // Shown when the requirement is missing, e.g. an install URL
+	Package     string       // Package that provides it (pip package, or apt/brew package)
+	MinVersion  string       // Optional minimum version, e.g. "2.30.0"
+	VersionArgs []string     // Arguments that make a binary print its version
+	Install     func() error // Optional custom installer used by Ensure
+}
+
+// Result is the outcome of checking one requirement
+type Result struct {
+	Requirement
+	OK      bool
+	Version string // Detected version, if any
+	Problem string // Why the requirement is not satisfied
+}
+
+// Common requirements shared by several commands
+var (
+	Git    = Bin("git", "install from: https://git-scm.com/").WithPackage("git")
+	GitLFS = Bin("git-lfs", "install from: https://git-lfs.com/").WithPackage("git-lfs")
+	Python = Bin("python3", "install from: https://www.python.org/").WithPackage("python3")
+)
+
+// Bin declares a required executable
+func Bin(name, hint string) Requirement {
+	return Requirement{Name: name, Kind: Binary, Hint: hint}
+}
+
+// Module declares a required Python module provided by the given pip package
+func Module(module, pkg string) Requirement {
+	return Requirement{Name: module, Kind: PythonModule, Package: pkg}
+}
+
+// Script declares a required executable installed by the given pip package
+func Script(name, pkg string) Requirement {
+	return Requirement{Name: name, Kind: PythonScript, Package: pkg}
+}
+
+// WithPackage sets the package that provides the requirement
+func (r Requirement) WithPackage(pkg string) Requirement {
+	r.Package = pkg
+	return r
+}
+
+// WithInstaller sets a custom installer used instead of the package manager
+func (r Requirement) WithInstaller(install func() error) Requirement {
+	r.Install = install
+	return r
+}
+
+// AtLeast sets a minimum version, determined by running the binary with args
+func (r Requirement) AtLeast(version string, args ...string) Requirement {
+	r.MinVersion = version
+	r.VersionArgs = args
+	return r
+}
+
+// isPip reports whether the requirement is installed with pip
+func (r Requirement) isPip() bool {
+	return r.Kind == PythonModule || r.Kind == PythonScript
+}
+
+// label is how the requirement is described in messages
+func (r Requirement) label() string {
+	label := r.Name
+	if r.isPip() && r.Package != "" {
+		label = r.Package
+	}
+	if r.MinVersion != "" {
+		label += " " + r.MinVersion + " or later"
+	}
+	return label
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]Result{}
+)
+
+func cacheKey(r Requirement) string {
+	return fmt.Sprintf("%d:%s:%s", r.Kind, r.Name, r.MinVersion)
+}
+
+// ClearCache forgets previous results, e.g. after installing packages
+func ClearCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cache = map[string]Result{}
+}
+
+// Check evaluates the requirements; results are cached for the life of the process
+func Check(reqs ...Requirement) []Result {
+	results := make([]Result, len(reqs))
+	for i, r := range reqs {
+		key := cacheKey(r)
+		cacheMu.Lock()
+		result, ok := cache[key]
+		cacheMu.Unlock()
+		if !ok {
+			result = check(r)
+			cacheMu.Lock()
+			cache[key] = result
+			cacheMu.Unlock()
+		}
+		result.Requirement = r
+		results[i] = result
+	}
+	return results
+}
+
+func check(r Requirement) Result {
+	result := Result{Requirement: r}
+
+	switch r.Kind {
+	case PythonModule:
+		if err := exec.Command("python3", "-c", "import "+r.Name).Run(); err != nil {
+			result.Problem = "not installed"
+			return result
+		}
+	default:
+		if _, err := exec.LookPath(r.Name); err != nil {
+			result.Problem = "not found"
+			return result
+		}
+	}
+
+	if len(r.VersionArgs) > 0 {
+		output, _ := exec.Command(r.Name, r.VersionArgs...).CombinedOutput()
+		result.Version = ExtractVersion(string(output))
+		if r.MinVersion != "" && CompareVersions(result.Version, r.MinVersion) < 0 {
+			found := result.Version
+			if found == "" {
+				found = "unknown version"
+			}
+			result.Problem = "found " + found
+			return result
+		}
+	}
+
+	result.OK = true
+	return result
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// ExtractVersion returns the first dotted version number in s
+func ExtractVersion(s string) string {
+	return versionPattern.FindString(s)
+}
+
+// CompareVersions compares dotted numeric versions, returning -1, 0 or 1
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// MissingError lists unsatisfied requirements
+type MissingError struct {
+	Missing     []Result
+	Installable bool // The command supports --install-missing
+}
+
+func (e *MissingError) Error() string {
+	var b strings.Builder
+	b.WriteString("Missing required dependencies:\n")
+	var pipPackages []string
+	for _, m := range e.Missing {
+		line := "  ✗ " + m.label()
+		details := []string{}
+		if m.Problem != "" && m.Problem != "not found" && m.Problem != "not installed" {
+			details = append(details, m.Problem)
+		}
+		if m.Hint != "" {
+			details = append(details, m.Hint)
+		}
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, "; ") + ")"
+		}
+		b.WriteString(line + "\n")
+		if m.isPip() && m.Package != "" {
+			pipPackages = append(pipPackages, m.Package)
+		}
+	}
+
+	if len(pipPackages) > 0 {
+		b.WriteString("\nTo install all missing Python packages, run:\n")
+		b.WriteString("  pip install " + strings.Join(pipPackages, " ") + "\n")
+	}
+	if e.Installable {
+		b.WriteString("\nRerun with --install-missing to attempt automatic installation.\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Verify returns a *MissingError if any requirement is unsatisfied
+func Verify(reqs ...Requirement) error {
+	var missing []Result
+	for _, result := range Check(reqs...) {
+		if !result.OK {
+			missing = append(missing, result)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingError{Missing: missing}
+	}
+	return nil
+}
+
+// Ensure verifies the requirements and, when installMissing is set, tries to
+// install the missing ones before verifying again
+func Ensure(installMissing bool, reqs ...Requirement) error {
+	err := Verify(reqs...)
+	if err == nil {
+		return nil
+	}
+
+	missingErr := err.(*MissingError)
+	if !installMissing {
+		missingErr.Installable = true
+		return missingErr
+	}
+
+	if err := install(missingErr.Missing); err != nil {
+		return fmt.Errorf("%v\n\n%v", missingErr, err)
+	}
+
+	ClearCache()
+	return Verify(reqs...)
+}
+
+// install runs custom installers, pip, and the system package manager for
+// the missing requirements
+func install(missing []Result) error {
+	var pipPackages, systemPackages []string
+	for _, m := range missing {
+		switch {
+		case m.Install != nil:
+			if err := m.Install(); err != nil {
+				return fmt.Errorf("failed to install %s: %v", m.Name, err)
+			}
+		case m.isPip() && m.Package != "":
+			pipPackages = append(pipPackages, m.Package)
+		case m.Package != "":
+			systemPackages = append(systemPackages, m.Package)
+		default:
+			return fmt.Errorf("don't know how to install %s; please install it manually", m.Name)
+		}
+	}
+
+	if len(pipPackages) > 0 {
+		fmt.Printf("Installing Python packages: %s\n", strings.Join(pipPackages, " "))
+		if err := runVisible("python3", append([]string{"-m", "pip", "install"}, pipPackages...)...); err != nil {
+			return fmt.Errorf("pip install failed: %v", err)
+		}
+	}
+
+	if len(systemPackages) > 0 {
+		fmt.Printf("Installing system packages: %s\n", strings.Join(systemPackages, " "))
+		if err := installSystemPackages(systemPackages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installSystemPackages uses apt-get on Debian/Ubuntu and Homebrew on macOS
+func installSystemPackages(packages []string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("brew"); err != nil {
+			return fmt.Errorf("Homebrew not found. Please install Homebrew first: https://brew.sh/")
+		}
+		return runVisible("brew", append([]string{"install"}, packages...)...)
+	case "linux":
+		if _, err := exec.LookPath("apt-get"); err != nil {
+			return fmt.Errorf("automatic installation only supported on Ubuntu/Debian (apt-get not found)")
+		}
+		args := append([]string{"apt-get", "install", "-y"}, packages...)
+		if os.Geteuid() != 0 {
+			return runVisible("sudo", args...)
+		}
+		return runVisible(args[0], args[1:]...)
+	default:
+		return fmt.Errorf("automatic installation not supported on %s", runtime.GOOS)
+	}
+}
+
+func runVisible(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,67 @@
+package prereq
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCompareVersions tests ordering of dotted version numbers
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.30.0", "2.30.0", 0},
+		{"2.30", "2.30.0", 0},
+		{"2.9.1", "2.30.0", -1},
+		{"3.0", "2.99.99", 1},
+		{"", "1.0", -1},
+	}
+
+	for _, tt := range tests {
+		if result := CompareVersions(tt.a, tt.b); result != tt.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, result, tt.expected)
+		}
+	}
+}
+
+// TestExtractVersion tests version extraction from typical --version output
+func TestExtractVersion(t *testing.T) {
+	tests := map[string]string{
+		"git version 2.43.0":                           "2.43.0",
+		"git-lfs/3.4.1 (GitHub; linux amd64; go 1.21)": "3.4.1",
+		"Python 3.12.3":                                "3.12.3",
+		"no version here":                              "",
+	}
+
+	for input, expected := range tests {
+		if result := ExtractVersion(input); result != expected {
+			t.Errorf("ExtractVersion(%q) = %q, want %q", input, result, expected)
+		}
+	}
+}
+
+// TestVerifyMissing tests that missing requirements are rendered together
+func TestVerifyMissing(t *testing.T) {
+	reqs := []Requirement{
+		Bin("definitely-not-a-real-binary-xyz", "install from: https://example.com/"),
+		Script("another-missing-binary-xyz", "another-pkg"),
+	}
+
+	err := Ensure(false, reqs...)
+	if err == nil {
+		t.Fatal("Ensure should fail for missing binaries")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"✗ definitely-not-a-real-binary-xyz (install from: https://example.com/)",
+		"✗ another-pkg",
+		"pip install another-pkg",
+		"--install-missing",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error message missing %q:\n%s", want, msg)
+		}
+	}
+}
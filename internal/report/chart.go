@@ -0,0 +1,89 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+)
+
+// Chart layout in pixels
+const (
+	chartWidth  = 640
+	labelWidth  = 110 // Bar labels, right-aligned
+	barLeft     = labelWidth + 10
+	barWidth    = 400
+	rowHeight   = 24
+	barHeight   = 16
+	legendSpace = 28
+	lfsColor    = "#2f81f7"
+	gitColor    = "#d29922"
+)
+
+// bar is one row of a chart: the LFS and plain Git parts of a quantity
+type bar struct {
+	label    string
+	lfs, git int64
+	value    string // Printed after the bar
+}
+
+// shareChart shows the part of the size and of the files in Git LFS
+func shareChart(total Extension) string {
+	files := int64(total.LFSFiles + total.GitFiles)
+	return barChart([]bar{
+		{"Size", total.LFSSize, total.GitSize, percent(total.LFSSize, total.Size()) + " in Git LFS"},
+		{"Files", int64(total.LFSFiles), int64(total.GitFiles), percent(int64(total.LFSFiles), files) + " in Git LFS"},
+	}, 0)
+}
+
+// sizeChart shows the size of each extension, split into Git LFS and plain Git
+func sizeChart(stats Stats) string {
+	var bars []bar
+	var largest int64
+	for _, e := range stats.Extensions {
+		bars = append(bars, bar{e.Name, e.LFSSize, e.GitSize, common.FormatSize(e.Size())})
+		largest = max(largest, e.Size())
+	}
+	return barChart(bars, largest)
+}
+
+// barChart draws horizontal stacked bars scaled so that scale fills the
+// width, or with scale 0 each bar filling it, above a legend
+func barChart(bars []bar, scale int64) string {
+	height := legendSpace + len(bars)*rowHeight + 4
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, height, chartWidth, height)
+	legend := func(x int, color, text string) {
+		fmt.Fprintf(&b, `<rect x="%d" y="6" width="12" height="12" fill="%s"/><text x="%d" y="16">%s</text>`+"\n", x, color, x+16, text)
+	}
+	legend(barLeft, lfsColor, "Git LFS")
+	legend(barLeft+90, gitColor, "Plain Git")
+
+	for i, bar := range bars {
+		y := legendSpace + i*rowHeight
+		total := bar.lfs + bar.git
+		full := scale
+		if full == 0 {
+			full = total
+		}
+		width := func(n int64) int {
+			if full == 0 {
+				return 0
+			}
+			return int(float64(barWidth) * float64(n) / float64(full))
+		}
+		lfsWidth, gitWidth := width(bar.lfs), width(total)-width(bar.lfs)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", labelWidth, y+12, html.EscapeString(bar.label))
+		if lfsWidth > 0 {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", barLeft, y, lfsWidth, barHeight, lfsColor)
+		}
+		if gitWidth > 0 {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", barLeft+lfsWidth, y, gitWidth, barHeight, gitColor)
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", barLeft+lfsWidth+gitWidth+6, y+12, html.EscapeString(bar.value))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package report
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// block is part of a document: heading, paragraph, table or chart
+type block interface{}
+
+type heading struct {
+	level int
+	text  string
+}
+
+type paragraph struct {
+	text string
+}
+
+// table is a table of plain text cells
+type table struct {
+	header []string
+	right  []bool // Columns aligned to the right
+	code   []bool // Columns of commands or object IDs, shown as code
+	rows   [][]string
+}
+
+func (t table) isCode(column int) bool {
+	return column < len(t.code) && t.code[column]
+}
+
+func (t table) alignRight(column int) bool {
+	return column < len(t.right) && t.right[column]
+}
+
+type chart struct {
+	title string
+	svg   string
+}
+
+// markdownEscaper escapes the characters Markdown would format
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "|", `\|`, "#", `\#`)
+
+// Markdown writes the report as GitHub flavored Markdown. Charts are
+// embedded as data: URI images, as Markdown cannot hold SVG itself.
+func (r Report) Markdown(w io.Writer) error {
+	var b strings.Builder
+	for _, blk := range r.document() {
+		switch blk := blk.(type) {
+		case heading:
+			fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", blk.level), markdownEscaper.Replace(blk.text))
+		case paragraph:
+			fmt.Fprintf(&b, "%s\n\n", markdownEscaper.Replace(blk.text))
+		case chart:
+			fmt.Fprintf(&b, "![%s](data:image/svg+xml;base64,%s)\n\n",
+				markdownEscaper.Replace(blk.title), base64.StdEncoding.EncodeToString([]byte(blk.svg)))
+		case table:
+			cells := func(row []string) {
+				for i, cell := range row {
+					if blk.isCode(i) && cell != "" {
+						cell = codeSpan(cell)
+					} else {
+						cell = markdownEscaper.Replace(cell)
+					}
+					fmt.Fprintf(&b, "| %s ", cell)
+				}
+				b.WriteString("|\n")
+			}
+			header := make([]string, len(blk.header))
+			for i, h := range blk.header {
+				header[i] = markdownEscaper.Replace(h)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(header, " | "))
+			for i := range blk.header {
+				if blk.alignRight(i) {
+					b.WriteString("|---:")
+				} else {
+					b.WriteString("|---")
+				}
+			}
+			b.WriteString("|\n")
+			for _, row := range blk.rows {
+				cells(row)
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, strings.TrimSuffix(b.String(), "\n"))
+	return err
+}
+
+// codeSpan formats text as inline code, fenced by more backticks than it
+// contains in a row; a | would still end the table cell
+func codeSpan(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	text = strings.ReplaceAll(text, "|", `\|`)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+// htmlStyle keeps the standalone HTML report readable without other files
+const htmlStyle = `body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.7em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.right { text-align: right; }
+code { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 90%; }
+figure { margin: 1em 0; }
+figcaption { font-weight: 600; margin-bottom: 0.3em; }`
+
+// HTML writes the report as a standalone HTML page with inline SVG charts
+func (r Report) HTML(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n",
+		html.EscapeString(r.Title), htmlStyle)
+	for _, blk := range r.document() {
+		switch blk := blk.(type) {
+		case heading:
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", blk.level, html.EscapeString(blk.text), blk.level)
+		case paragraph:
+			fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(blk.text))
+		case chart:
+			fmt.Fprintf(&b, "<figure>\n<figcaption>%s</figcaption>\n%s</figure>\n", html.EscapeString(blk.title), blk.svg)
+		case table:
+			b.WriteString("<table>\n<thead><tr>")
+			for _, h := range blk.header {
+				fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(h))
+			}
+			b.WriteString("</tr></thead>\n<tbody>\n")
+			for _, row := range blk.rows {
+				b.WriteString("<tr>")
+				for i, cell := range row {
+					class := ""
+					if blk.alignRight(i) {
+						class = ` class="right"`
+					}
+					cell = html.EscapeString(cell)
+					if blk.isCode(i) && cell != "" {
+						cell = "<code>" + cell + "</code>"
+					}
+					fmt.Fprintf(&b, "<td%s>%s</td>", class, cell)
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</tbody>\n</table>\n")
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
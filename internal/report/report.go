@@ -0,0 +1,276 @@
+// Package report renders the storage statistics, policy check and pointer
+// verification of a repository as one Markdown or HTML document with SVG
+// charts, to attach to a migration proposal or keep as a CI artifact
+package report
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/common"
+	"github.com/mslinn/git_lfs_scripts/internal/lfspolicy"
+)
+
+// maxRows is how many policy findings or object problems a table lists
+const maxRows = 50
+
+// Report is everything a report shows
+type Report struct {
+	Title      string
+	Repository string // e.g. the URL of origin, or the directory
+	Commit     string // HEAD; "" in a repository without commits
+	Generated  time.Time
+	Stats      Stats
+	Policy     Policy
+	Local      Verification // Of the local objects of the pointers at HEAD
+	Remote     Verification // Of the objects on the LFS server
+}
+
+// Stats summarizes the files the next commit would hold by extension
+type Stats struct {
+	Extensions []Extension // Largest total first
+}
+
+// Extension is the files having one extension
+type Extension struct {
+	Name     string // Lower case, without the dot, or "(none)" or "(other)"
+	LFSFiles int
+	LFSSize  int64
+	GitFiles int
+	GitSize  int64
+}
+
+// Size is the total size of the files
+func (e Extension) Size() int64 {
+	return e.LFSSize + e.GitSize
+}
+
+func (e *Extension) add(o Extension) {
+	e.LFSFiles += o.LFSFiles
+	e.LFSSize += o.LFSSize
+	e.GitFiles += o.GitFiles
+	e.GitSize += o.GitSize
+}
+
+// Policy is the result of checking the policy file
+type Policy struct {
+	File     string // "" when not checked
+	Scope    string // e.g. "the working tree and the last 10 commits"
+	Note     string // Why it was not checked
+	Findings []Finding
+}
+
+// Finding is a policy violation
+type Finding struct {
+	Rule    string
+	Problem string
+	Fix     string
+}
+
+// Verification is the result of checking the objects of LFS pointers
+type Verification struct {
+	Where    string // e.g. the local storage directory or the endpoint URL
+	Note     string // Why it was not checked
+	Error    string // Why checking failed
+	Objects  int    // Objects checked
+	Size     int64  // Of the objects checked
+	Problems []Problem
+}
+
+// Problem is an object that is missing or damaged
+type Problem struct {
+	OID   string
+	Size  int64
+	Path  string // A pointer file referencing the object
+	Issue string // e.g. "not downloaded"
+}
+
+// Summarize counts the files by extension
+func Summarize(files []lfspolicy.File) Stats {
+	byName := make(map[string]*Extension)
+	for _, f := range files {
+		name := strings.ToLower(strings.TrimPrefix(path.Ext(f.Path), "."))
+		if name == "" {
+			name = "(none)"
+		}
+		e := byName[name]
+		if e == nil {
+			e = &Extension{Name: name}
+			byName[name] = e
+		}
+		if f.LFS {
+			e.LFSFiles++
+			e.LFSSize += f.Size
+		} else {
+			e.GitFiles++
+			e.GitSize += f.Size
+		}
+	}
+
+	var stats Stats
+	for _, e := range byName {
+		stats.Extensions = append(stats.Extensions, *e)
+	}
+	sort.Slice(stats.Extensions, func(i, j int) bool {
+		a, b := stats.Extensions[i], stats.Extensions[j]
+		if a.Size() != b.Size() {
+			return a.Size() > b.Size()
+		}
+		return a.Name < b.Name
+	})
+	return stats
+}
+
+// Total sums every extension
+func (s Stats) Total() Extension {
+	total := Extension{Name: "Total"}
+	for _, e := range s.Extensions {
+		total.add(e)
+	}
+	return total
+}
+
+// Top keeps the n largest extensions and merges the others into "(other)"
+func (s Stats) Top(n int) Stats {
+	if n <= 0 || len(s.Extensions) <= n {
+		return s
+	}
+	other := Extension{Name: "(other)"}
+	for _, e := range s.Extensions[n:] {
+		other.add(e)
+	}
+	return Stats{Extensions: append(s.Extensions[:n:n], other)}
+}
+
+// document lays out the report as blocks both renderers understand
+func (r Report) document() []block {
+	total := r.Stats.Total()
+	doc := []block{
+		heading{1, r.Title},
+		paragraph{r.header()},
+		heading{2, "Summary"},
+		table{
+			header: []string{"Measure", "Value"},
+			rows: [][]string{
+				{"Files in Git LFS", fmt.Sprintf("%d (%s)", total.LFSFiles, common.FormatSize(total.LFSSize))},
+				{"Plain Git files", fmt.Sprintf("%d (%s)", total.GitFiles, common.FormatSize(total.GitSize))},
+				{"Share of the size in Git LFS", percent(total.LFSSize, total.Size())},
+				{"Policy", r.Policy.summary()},
+				{"Local objects", r.Local.summary()},
+				{"Objects on the server", r.Remote.summary()},
+			},
+		},
+		heading{2, "Storage"},
+		paragraph{"The files the next commit would hold: those in the index and the untracked files that are not ignored. " +
+			"The size of an LFS file is that of its object, also when it is not checked out."},
+	}
+	if total.LFSFiles+total.GitFiles > 0 {
+		doc = append(doc,
+			chart{"Share in Git LFS", shareChart(total)},
+			chart{"Size by extension", sizeChart(r.Stats)})
+	}
+	extensions := table{
+		header: []string{"Extension", "LFS files", "LFS size", "Git files", "Git size"},
+		right:  []bool{false, true, true, true, true},
+	}
+	for _, e := range slices.Concat(r.Stats.Extensions, []Extension{total}) {
+		extensions.rows = append(extensions.rows, []string{e.Name,
+			fmt.Sprint(e.LFSFiles), common.FormatSize(e.LFSSize),
+			fmt.Sprint(e.GitFiles), common.FormatSize(e.GitSize)})
+	}
+	doc = append(doc, extensions)
+
+	doc = append(doc, heading{2, "Policy compliance"})
+	doc = append(doc, r.Policy.blocks()...)
+	doc = append(doc, heading{2, "Pointer verification"}, heading{3, "Local objects"})
+	doc = append(doc, r.Local.blocks("referenced by the pointers at HEAD")...)
+	doc = append(doc, heading{3, "Objects on the server"})
+	doc = append(doc, r.Remote.blocks("referenced by the pointers at HEAD")...)
+	return doc
+}
+
+// header names the repository, commit and time of the report
+func (r Report) header() string {
+	parts := []string{"Repository: " + r.Repository}
+	if r.Commit != "" {
+		parts = append(parts, "Commit: "+r.Commit[:min(len(r.Commit), 12)])
+	}
+	parts = append(parts, "Generated: "+r.Generated.Format("2006-01-02 15:04 MST"))
+	return strings.Join(parts, " · ")
+}
+
+func (p Policy) summary() string {
+	switch {
+	case p.File == "":
+		return "Not checked"
+	case len(p.Findings) == 0:
+		return "✓ No violations"
+	}
+	return fmt.Sprintf("✗ %d %s", len(p.Findings), common.Plural(len(p.Findings), "violation", "violations"))
+}
+
+func (p Policy) blocks() []block {
+	if p.File == "" {
+		return []block{paragraph{p.Note}}
+	}
+	intro := fmt.Sprintf("Checked %s against %s.", p.Scope, p.File)
+	if len(p.Findings) == 0 {
+		return []block{paragraph{intro + " ✓ No violations."}}
+	}
+	t := table{header: []string{"Rule", "Problem", "Fix"}, code: []bool{false, false, true}}
+	for _, f := range p.Findings[:min(len(p.Findings), maxRows)] {
+		t.rows = append(t.rows, []string{f.Rule, f.Problem, f.Fix})
+	}
+	return append([]block{paragraph{intro + " " + p.summary() + ":"}, t}, more(len(p.Findings))...)
+}
+
+func (v Verification) summary() string {
+	switch {
+	case v.Error != "":
+		return "Failed"
+	case v.Where == "":
+		return "Not checked"
+	case len(v.Problems) == 0:
+		return fmt.Sprintf("✓ All %d present", v.Objects)
+	}
+	return fmt.Sprintf("✗ %d of %d with problems", len(v.Problems), v.Objects)
+}
+
+func (v Verification) blocks(scope string) []block {
+	if v.Where == "" {
+		return []block{paragraph{v.Note}}
+	}
+	intro := fmt.Sprintf("%d %s (%s) %s, checked in %s.",
+		v.Objects, common.Plural(v.Objects, "object", "objects"), common.FormatSize(v.Size), scope, v.Where)
+	if v.Error != "" {
+		return []block{paragraph{intro + " Checking failed: " + v.Error}}
+	}
+	if len(v.Problems) == 0 {
+		return []block{paragraph{intro + " " + v.summary() + "."}}
+	}
+	t := table{header: []string{"Object", "Size", "Path", "Problem"}, right: []bool{false, true, false, false}, code: []bool{true}}
+	for _, p := range v.Problems[:min(len(v.Problems), maxRows)] {
+		t.rows = append(t.rows, []string{p.OID[:min(len(p.OID), 12)], common.FormatSize(p.Size), p.Path, p.Issue})
+	}
+	return append([]block{paragraph{intro + " " + v.summary() + ":"}, t}, more(len(v.Problems))...)
+}
+
+// more notes the rows a table leaves out
+func more(n int) []block {
+	if n <= maxRows {
+		return nil
+	}
+	return []block{paragraph{fmt.Sprintf("... and %d more.", n-maxRows)}}
+}
+
+// percent formats part as a percentage of whole
+func percent(part, whole int64) string {
+	if whole == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(whole))
+}
@@ -0,0 +1,141 @@
+package report
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspolicy"
+)
+
+// TestSummarize tests counting files by extension
+func TestSummarize(t *testing.T) {
+	stats := Summarize([]lfspolicy.File{
+		{Path: "art/a.PSD", Size: 500, LFS: true},
+		{Path: "art/b.psd", Size: 300},
+		{Path: "README", Size: 10},
+		{Path: "main.go", Size: 20},
+		{Path: "x.zip", Size: 20, LFS: true},
+	})
+	want := []Extension{
+		{Name: "psd", LFSFiles: 1, LFSSize: 500, GitFiles: 1, GitSize: 300},
+		{Name: "go", GitFiles: 1, GitSize: 20},
+		{Name: "zip", LFSFiles: 1, LFSSize: 20},
+		{Name: "(none)", GitFiles: 1, GitSize: 10},
+	}
+	if !reflect.DeepEqual(stats.Extensions, want) {
+		t.Errorf("Summarize() = %+v, want %+v", stats.Extensions, want)
+	}
+
+	top := stats.Top(2)
+	if len(top.Extensions) != 3 || top.Extensions[2] != (Extension{Name: "(other)", LFSFiles: 1, LFSSize: 20, GitFiles: 1, GitSize: 10}) {
+		t.Errorf("Top(2) = %+v", top.Extensions)
+	}
+	if len(stats.Extensions) != 4 || stats.Extensions[2].Name != "zip" {
+		t.Errorf("Top(2) changed the stats: %+v", stats.Extensions)
+	}
+	if total := stats.Total(); total.LFSSize != 520 || total.GitFiles != 3 {
+		t.Errorf("Total() = %+v", total)
+	}
+}
+
+// sample returns a report with findings and problems
+func sample() Report {
+	return Report{
+		Title:      "Git LFS report: assets",
+		Repository: "https://example.com/team/assets.git",
+		Commit:     "0123456789abcdef0123",
+		Generated:  time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Stats: Summarize([]lfspolicy.File{
+			{Path: "a.psd", Size: 3000, LFS: true},
+			{Path: "b.zip", Size: 1000},
+		}),
+		Policy: Policy{File: ".lfspolicy.yaml", Scope: "the working tree", Findings: []Finding{
+			{Rule: "forbidden_extensions", Problem: "b.zip (1000 B) is a plain Git file", Fix: "git lfs-policy apply && git add --renormalize b.zip"},
+		}},
+		Local: Verification{Where: "local storage", Objects: 1, Size: 3000, Problems: []Problem{
+			{OID: strings.Repeat("ab", 32), Size: 3000, Path: "a.psd", Issue: "not downloaded"},
+		}},
+		Remote: Verification{Note: "Not checked <remote>"},
+	}
+}
+
+// TestMarkdown tests the Markdown rendering
+func TestMarkdown(t *testing.T) {
+	var b strings.Builder
+	if err := sample().Markdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"# Git LFS report: assets\n\nRepository: https://example.com/team/assets.git · Commit: 0123456789ab · Generated: 2026-10-16 12:00 UTC\n",
+		"| Files in Git LFS | 1 (2.9 KB) |\n",
+		"| Share of the size in Git LFS | 75.0% |\n",
+		"![Size by extension](data:image/svg+xml;base64,",
+		"| Extension | LFS files | LFS size | Git files | Git size |\n|---|---:|---:|---:|---:|\n",
+		"| forbidden\\_extensions | b.zip (1000 B) is a plain Git file | `git lfs-policy apply && git add --renormalize b.zip` |\n",
+		"| `abababababab` | 2.9 KB | a.psd | not downloaded |\n",
+		"Not checked \\<remote\\>\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Markdown() lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestHTML tests that the HTML rendering escapes text and holds valid SVG
+func TestHTML(t *testing.T) {
+	var b strings.Builder
+	if err := sample().HTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"<title>Git LFS report: assets</title>",
+		"<td><code>git lfs-policy apply &amp;&amp; git add --renormalize b.zip</code></td>",
+		"<p>Not checked &lt;remote&gt;</p>",
+		"<figcaption>Share in Git LFS</figcaption>\n<svg ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("HTML() lacks %q", want)
+		}
+	}
+
+	svg := sizeChart(Stats{Extensions: []Extension{{Name: "<a&b>", LFSSize: 10, GitSize: 5}, {Name: "c", GitSize: 3}}})
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	rects := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("sizeChart() is not valid XML: %v\n%s", err, svg)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "rect" {
+			rects++
+		}
+	}
+	// Two legend squares, two parts of the first bar, one of the second
+	if rects != 5 {
+		t.Errorf("sizeChart() draws %d rectangles, want 5:\n%s", rects, svg)
+	}
+}
+
+// TestCodeSpan tests fencing code that holds backticks and pipes
+func TestCodeSpan(t *testing.T) {
+	tests := map[string]string{
+		"git add a.zip": "`git add a.zip`",
+		"echo `x`":      "`` echo `x` ``",
+		"a | b":         "`a \\| b`",
+		"x ``y`` z":     "```x ``y`` z```",
+	}
+	for text, want := range tests {
+		if got := codeSpan(text); got != want {
+			t.Errorf("codeSpan(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package transfer holds the messages of the Git LFS custom transfer
+// protocol (https://github.com/git-lfs/git-lfs/blob/main/docs/custom-transfers.md),
+// which Git LFS and a transfer agent exchange as JSON lines on the agent's
+// stdin and stdout, and validates them.
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mslinn/git_lfs_scripts/internal/lfspointer"
+)
+
+// Events of the protocol. Git LFS sends init, upload, download and
+// terminate; the agent answers with progress and complete.
+const (
+	EventInit      = "init"
+	EventUpload    = "upload"
+	EventDownload  = "download"
+	EventTerminate = "terminate"
+	EventProgress  = "progress"
+	EventComplete  = "complete"
+)
+
+// Error is the error of a failed init or object transfer
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// Action is where and how to transfer an object, as the Batch API answered
+type Action struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+}
+
+// Object is an object to upload or download
+type Object struct {
+	OID    string  `json:"oid"`
+	Size   int64   `json:"size"`
+	Path   string  `json:"path,omitempty"` // The file to upload
+	Action *Action `json:"action,omitempty"`
+}
+
+// Request is a message from Git LFS to the agent. Init sets Operation,
+// Remote and the concurrency; upload and download carry one object in OID,
+// Size, Path and Action. Objects holds a batch of objects instead, which
+// only git-lfs-trace accepts.
+type Request struct {
+	Event               string   `json:"event"`
+	Operation           string   `json:"operation,omitempty"`
+	Remote              string   `json:"remote,omitempty"`
+	Concurrent          bool     `json:"concurrent,omitempty"`
+	ConcurrentTransfers int      `json:"concurrenttransfers,omitempty"`
+	OID                 string   `json:"oid,omitempty"`
+	Size                int64    `json:"size,omitempty"`
+	Path                string   `json:"path,omitempty"`
+	Action              *Action  `json:"action,omitempty"`
+	Objects             []Object `json:"objects,omitempty"`
+}
+
+// Batch returns the objects of an upload or download request: its Objects,
+// or the single object it carries
+func (r Request) Batch() []Object {
+	if len(r.Objects) > 0 || r.OID == "" {
+		return r.Objects
+	}
+	return []Object{{OID: r.OID, Size: r.Size, Path: r.Path, Action: r.Action}}
+}
+
+// Validate checks that a request is one Git LFS sends: a known event, with
+// an operation for init and valid objects for upload and download
+func (r Request) Validate() error {
+	switch r.Event {
+	case EventInit:
+		if r.Operation != EventUpload && r.Operation != EventDownload {
+			return fmt.Errorf("init operation must be upload or download, not '%s'", r.Operation)
+		}
+		if r.ConcurrentTransfers < 0 {
+			return fmt.Errorf("concurrenttransfers must not be negative")
+		}
+	case EventUpload, EventDownload:
+		objects := r.Batch()
+		if len(objects) == 0 {
+			return fmt.Errorf("%s names no object", r.Event)
+		}
+		for _, object := range objects {
+			if err := object.validate(r.Event); err != nil {
+				return err
+			}
+		}
+	case EventTerminate:
+	default:
+		return fmt.Errorf("unsupported event '%s'", r.Event)
+	}
+	return nil
+}
+
+func (o Object) validate(event string) error {
+	if !lfspointer.ValidOID(o.OID) {
+		return fmt.Errorf("%s of invalid oid '%s'", event, o.OID)
+	}
+	if o.Size < 0 {
+		return fmt.Errorf("%s of %s has negative size %d", event, o.OID, o.Size)
+	}
+	return nil
+}
+
+// Redacted returns a copy of the request whose Authorization headers read
+// REDACTED, for logs and recordings that must not leak credentials
+func (r Request) Redacted() Request {
+	r.Action = r.Action.redacted()
+	if r.Objects != nil {
+		objects := make([]Object, len(r.Objects))
+		for i, object := range r.Objects {
+			object.Action = object.Action.redacted()
+			objects[i] = object
+		}
+		r.Objects = objects
+	}
+	return r
+}
+
+func (a *Action) redacted() *Action {
+	if a == nil || a.Header == nil {
+		return a
+	}
+	copied := *a
+	copied.Header = make(map[string]string, len(a.Header))
+	for name, value := range a.Header {
+		if strings.EqualFold(name, "Authorization") {
+			value = "REDACTED"
+		}
+		copied.Header[name] = value
+	}
+	return &copied
+}
+
+// InitResponse answers init: empty when the agent is ready
+type InitResponse struct {
+	Error *Error `json:"error,omitempty"`
+}
+
+// Progress reports how much of one object has been transferred; any number
+// of them may precede its complete event
+type Progress struct {
+	Event          string `json:"event"` // Always "progress"
+	OID            string `json:"oid"`
+	BytesSoFar     int64  `json:"bytesSoFar"`
+	BytesSinceLast int64  `json:"bytesSinceLast"`
+}
+
+// Complete ends the transfer of one object, successful unless Error is set
+type Complete struct {
+	Event string `json:"event"` // Always "complete"
+	OID   string `json:"oid"`
+	Path  string `json:"path,omitempty"` // Where a download was written
+	Error *Error `json:"error,omitempty"`
+}
+
+// ParseAgentMessage decodes and validates a message from an agent to Git
+// LFS. It returns an InitResponse, which names no event, a Progress or a
+// Complete.
+func ParseAgentMessage(line []byte) (any, error) {
+	var head struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(line, &head); err != nil {
+		return nil, err
+	}
+	switch head.Event {
+	case "":
+		var response InitResponse
+		err := json.Unmarshal(line, &response)
+		return response, err
+	case EventProgress:
+		var progress Progress
+		if err := json.Unmarshal(line, &progress); err != nil {
+			return nil, err
+		}
+		if !lfspointer.ValidOID(progress.OID) {
+			return progress, fmt.Errorf("progress of invalid oid '%s'", progress.OID)
+		}
+		if progress.BytesSoFar < 0 || progress.BytesSinceLast < 0 {
+			return progress, fmt.Errorf("progress of %s has a negative byte count", progress.OID)
+		}
+		return progress, nil
+	case EventComplete:
+		var complete Complete
+		if err := json.Unmarshal(line, &complete); err != nil {
+			return nil, err
+		}
+		if !lfspointer.ValidOID(complete.OID) {
+			return complete, fmt.Errorf("complete event of invalid oid '%s'", complete.OID)
+		}
+		return complete, nil
+	default:
+		return nil, fmt.Errorf("unsupported event '%s'", head.Event)
+	}
+}
+
+// Write sends a message as one JSON line
+func Write(w io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,118 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testOID = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+// TestValidate tests accepting the requests Git LFS sends and refusing others
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		wantErr string
+	}{
+		{"init", Request{Event: EventInit, Operation: EventUpload, Concurrent: true, ConcurrentTransfers: 3}, ""},
+		{"init without operation", Request{Event: EventInit}, "init operation"},
+		{"upload", Request{Event: EventUpload, OID: testOID, Size: 12, Path: "/tmp/a"}, ""},
+		{"download batch", Request{Event: EventDownload, Objects: []Object{{OID: testOID, Size: 12}}}, ""},
+		{"download without object", Request{Event: EventDownload}, "names no object"},
+		{"short oid", Request{Event: EventDownload, OID: "4d7a2146", Size: 12}, "invalid oid"},
+		{"path in oid", Request{Event: EventUpload, OID: "../../etc/passwd", Size: 12}, "invalid oid"},
+		{"negative size", Request{Event: EventUpload, OID: testOID, Size: -1}, "negative size"},
+		{"terminate", Request{Event: EventTerminate}, ""},
+		{"unknown event", Request{Event: "delete"}, "unsupported event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.request.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBatch tests that a single object request yields a batch of one
+func TestBatch(t *testing.T) {
+	single := Request{Event: EventUpload, OID: testOID, Size: 12, Path: "/tmp/a"}
+	got := single.Batch()
+	if len(got) != 1 || got[0].OID != testOID || got[0].Size != 12 || got[0].Path != "/tmp/a" {
+		t.Errorf("Batch() = %+v, want the single object", got)
+	}
+	if got := (Request{Event: EventTerminate}).Batch(); len(got) != 0 {
+		t.Errorf("Batch() of terminate = %+v, want none", got)
+	}
+}
+
+// TestRedacted tests hiding Authorization headers without touching the
+// original request
+func TestRedacted(t *testing.T) {
+	request := Request{
+		Event: EventDownload,
+		OID:   testOID,
+		Action: &Action{Href: "https://lfs.example.com/" + testOID, Header: map[string]string{
+			"authorization": "Basic c2VjcmV0",
+			"Accept":        "application/octet-stream",
+		}},
+		Objects: []Object{{OID: testOID, Action: &Action{Header: map[string]string{"Authorization": "Bearer t"}}}},
+	}
+
+	redacted := request.Redacted()
+	if got := redacted.Action.Header["authorization"]; got != "REDACTED" {
+		t.Errorf("action Authorization = %q, want REDACTED", got)
+	}
+	if got := redacted.Action.Header["Accept"]; got != "application/octet-stream" {
+		t.Errorf("action Accept = %q, want it unchanged", got)
+	}
+	if got := redacted.Objects[0].Action.Header["Authorization"]; got != "REDACTED" {
+		t.Errorf("object Authorization = %q, want REDACTED", got)
+	}
+	if request.Action.Header["authorization"] != "Basic c2VjcmV0" || request.Objects[0].Action.Header["Authorization"] != "Bearer t" {
+		t.Errorf("Redacted() changed the original request")
+	}
+}
+
+// TestParseAgentMessage tests decoding and validating messages of an agent
+func TestParseAgentMessage(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    any
+		wantErr bool
+	}{
+		{`{}`, InitResponse{}, false},
+		{`{"error":{"code":32,"message":"no store"}}`, InitResponse{Error: &Error{Code: 32, Message: "no store"}}, false},
+		{`{"event":"progress","oid":"` + testOID + `","bytesSoFar":10,"bytesSinceLast":10}`,
+			Progress{Event: EventProgress, OID: testOID, BytesSoFar: 10, BytesSinceLast: 10}, false},
+		{`{"event":"progress","oid":"` + testOID + `","bytesSoFar":-1}`,
+			Progress{Event: EventProgress, OID: testOID, BytesSoFar: -1}, true},
+		{`{"event":"complete","oid":"` + testOID + `","path":"/tmp/b"}`,
+			Complete{Event: EventComplete, OID: testOID, Path: "/tmp/b"}, false},
+		{`{"event":"complete","oid":"abc"}`, Complete{Event: EventComplete, OID: "abc"}, true},
+		{`{"event":"upload"}`, nil, true},
+		{`not json`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseAgentMessage([]byte(tt.line))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAgentMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var buf, want bytes.Buffer
+			Write(&buf, got)
+			Write(&want, tt.want)
+			if buf.String() != want.String() {
+				t.Errorf("ParseAgentMessage() = %s, want %s", buf.String(), want.String())
+			}
+		})
+	}
+}